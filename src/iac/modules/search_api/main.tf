@@ -109,6 +109,28 @@ resource "google_cloud_run_v2_service" "search_api_service" {
           memory = var.memory_limit
         }
       }
+
+      # Only start routing traffic once Spanner and Vertex AI are reachable
+      startup_probe {
+        http_get {
+          path = "/readyz"
+          port = 8080
+        }
+        initial_delay_seconds = 5
+        timeout_seconds       = 5
+        period_seconds        = 10
+        failure_threshold     = 6
+      }
+
+      liveness_probe {
+        http_get {
+          path = "/healthz"
+          port = 8080
+        }
+        timeout_seconds   = 5
+        period_seconds    = 30
+        failure_threshold = 3
+      }
     }
 
     service_account = var.service_account_email
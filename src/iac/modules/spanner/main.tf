@@ -44,7 +44,52 @@ resource "google_spanner_database" "products_db" {
   ddl = [
     "CREATE TABLE products (product_id STRING(MAX), product_data JSON, title STRING(MAX), title_tokens TOKENLIST AS (TOKENIZE_FULLTEXT(title)) HIDDEN, embedding ARRAY<FLOAT32>(vector_length=>768)) PRIMARY KEY(product_id)",
     "CREATE SEARCH INDEX products_by_title ON products(title_tokens)",
-    "CREATE VECTOR INDEX products_by_embedding ON products(embedding) WHERE embedding IS NOT NULL OPTIONS(distance_type=\"COSINE\", num_leaves=1000)"
+    "CREATE VECTOR INDEX products_by_embedding ON products(embedding) WHERE embedding IS NOT NULL OPTIONS(distance_type=\"COSINE\", num_leaves=1000)",
+    "CREATE TABLE query_latency_baselines (query_class STRING(MAX) NOT NULL, p95_ms FLOAT64, stage_p95_ms JSON, sample_count INT64, revision STRING(MAX), updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(query_class)",
+    "CREATE TABLE saved_searches (saved_search_id STRING(64) NOT NULL, name STRING(MAX), query STRING(MAX) NOT NULL, filter STRING(MAX), webhook_url STRING(MAX), pubsub_topic STRING(MAX), query_embedding ARRAY<FLOAT32>(vector_length=>768), created_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(saved_search_id)",
+    "CREATE TABLE saved_search_matches (saved_search_id STRING(64) NOT NULL, product_id STRING(MAX) NOT NULL, matched_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(saved_search_id, product_id), INTERLEAVE IN PARENT saved_searches ON DELETE CASCADE",
+    "CREATE TABLE product_change_history (product_id STRING(MAX) NOT NULL, changed_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true), price FLOAT64, currency_code STRING(3), availability STRING(MAX)) PRIMARY KEY(product_id, changed_at DESC)",
+    "CREATE TABLE head_queries (query STRING(MAX) NOT NULL, search_count INT64 NOT NULL, updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(query)",
+    "CREATE TABLE product_quality (product_id STRING(MAX), score FLOAT64 NOT NULL, issues ARRAY<STRING(MAX)>, scored_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(product_id), INTERLEAVE IN PARENT products ON DELETE CASCADE",
+    "CREATE TABLE query_templates (template_id STRING(64) NOT NULL, description STRING(MAX), search JSON NOT NULL, parameters JSON, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(template_id)",
+    "CREATE TABLE scoring_profiles (category STRING(MAX) NOT NULL, alpha FLOAT64, min_score FLOAT64, mode STRING(16), updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(category)",
+    "ALTER TABLE products ADD COLUMN catalog_id STRING(64)",
+    "CREATE INDEX products_by_catalog ON products(catalog_id)",
+    "ALTER TABLE saved_searches ADD COLUMN catalog_id STRING(64)",
+    "ALTER TABLE products ADD COLUMN gtin STRING(64) AS (JSON_VALUE(product_data, '$.gtin')) STORED",
+    "CREATE INDEX products_by_gtin ON products(gtin)",
+    "ALTER TABLE products ADD COLUMN price FLOAT64 AS (SAFE_CAST(JSON_VALUE(product_data, '$.priceInfo.price') AS FLOAT64)) STORED",
+    "ALTER VECTOR INDEX products_by_embedding ADD STORED COLUMN price",
+    "CREATE TABLE catalog_versions (catalog_id STRING(64) NOT NULL, version STRING(MAX) NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(catalog_id)",
+    "CREATE TABLE merchandising_rules (rule_id STRING(64) NOT NULL, name STRING(MAX), query_pattern STRING(MAX), category STRING(MAX), boost_product_ids ARRAY<STRING(MAX)>, bury_product_ids ARRAY<STRING(MAX)>, pins JSON, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(rule_id)",
+    "CREATE TABLE user_profiles (user_id STRING(128) NOT NULL, embedding ARRAY<FLOAT32>(vector_length=>768), clicks INT64 NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(user_id)",
+    "CREATE TABLE search_events (event_id STRING(32) NOT NULL, event_type STRING(32) NOT NULL, query STRING(MAX), product_id STRING(MAX) NOT NULL, position INT64, session_id STRING(MAX), user_id STRING(128), catalog_id STRING(MAX), occurred_at TIMESTAMP NOT NULL, received_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(event_id)",
+    "CREATE INDEX search_events_by_product ON search_events(product_id, event_type, occurred_at DESC)",
+    "CREATE TABLE product_stats (product_id STRING(MAX), click_count INT64 NOT NULL, purchase_count INT64 NOT NULL, updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(product_id), INTERLEAVE IN PARENT products ON DELETE CASCADE",
+    "CREATE TABLE relevance_samples (week STRING(8) NOT NULL, query STRING(MAX) NOT NULL, stratum STRING(64) NOT NULL, searches INT64 NOT NULL, results JSON, sampled_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(week, query)",
+    "ALTER TABLE products ADD COLUMN description_tokens TOKENLIST AS (TOKENIZE_FULLTEXT(JSON_VALUE(product_data, '$.description'))) HIDDEN",
+    "ALTER SEARCH INDEX products_by_title ADD COLUMN description_tokens",
+    "ALTER TABLE products ADD COLUMN brand_tokens TOKENLIST AS (TOKENIZE_FULLTEXT(JSON_VALUE_ARRAY(product_data, '$.brands'))) HIDDEN",
+    "ALTER SEARCH INDEX products_by_title ADD COLUMN brand_tokens",
+    "ALTER TABLE products ADD COLUMN attribute_tokens TOKENLIST AS (TOKENIZE_FULLTEXT(TO_JSON_STRING(JSON_QUERY(product_data, '$.attributes')))) HIDDEN",
+    "ALTER SEARCH INDEX products_by_title ADD COLUMN attribute_tokens",
+    "ALTER TABLE products ADD COLUMN deleted_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)",
+    "CREATE TABLE experiments (experiment_id STRING(64) NOT NULL, description STRING(MAX), enabled BOOL NOT NULL, arms JSON NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(experiment_id)",
+    "ALTER TABLE search_events ADD COLUMN experiment_id STRING(64)",
+    "ALTER TABLE search_events ADD COLUMN experiment_arm STRING(64)",
+    "CREATE INDEX search_events_by_experiment ON search_events(experiment_id, occurred_at) STORING (experiment_arm, event_type)",
+    "CREATE TABLE query_analytics (hour TIMESTAMP NOT NULL, query STRING(MAX) NOT NULL, searches INT64 NOT NULL, zero_results INT64 NOT NULL, latency_ms_sum FLOAT64 NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(hour, query)",
+    "CREATE TABLE reembed_jobs (job_id STRING(64) NOT NULL, model STRING(MAX) NOT NULL, dimension INT64 NOT NULL, column_name STRING(64) NOT NULL, status STRING(16) NOT NULL, total INT64 NOT NULL, processed INT64 NOT NULL, skipped INT64 NOT NULL, failed INT64 NOT NULL, error STRING(MAX), started_at TIMESTAMP NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true), finished_at TIMESTAMP) PRIMARY KEY(job_id)",
+    "ALTER TABLE products ADD COLUMN image_embedding ARRAY<FLOAT32>(vector_length=>1408)",
+    "CREATE VECTOR INDEX products_by_image_embedding ON products(image_embedding) STORING (price) WHERE image_embedding IS NOT NULL OPTIONS(distance_type=\"COSINE\", num_leaves=1000)",
+    "ALTER TABLE reembed_jobs ADD COLUMN source STRING(16)",
+    "CREATE TABLE stores (store_id STRING(64) NOT NULL, name STRING(MAX), latitude FLOAT64 NOT NULL, longitude FLOAT64 NOT NULL, updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(store_id)",
+    "CREATE INDEX stores_by_latitude ON stores(latitude) STORING (name, longitude)",
+    "CREATE TABLE product_store_availability (product_id STRING(MAX), store_id STRING(64) NOT NULL, quantity INT64 NOT NULL, updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(product_id, store_id), INTERLEAVE IN PARENT products ON DELETE CASCADE",
+    "ALTER TABLE saved_searches ADD COLUMN user_id STRING(128)",
+    "ALTER TABLE saved_searches ADD COLUMN last_evaluated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)",
+    "CREATE INDEX saved_searches_by_user ON saved_searches(user_id)",
+    "CREATE TABLE runtime_config (id STRING(64) NOT NULL, overrides JSON NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(id)"
   ]
 }
 
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command psearch-config exports the admin-managed relevance configuration
+// of a deployment and imports it into another, e.g. to promote changes
+// tested in staging to production:
+//
+//	psearch-config -url https://search-staging.example.com export > bundle.json
+//	psearch-config -url https://search.example.com import -dry-run bundle.json
+//	psearch-config -url https://search.example.com import -prune bundle.json
+//
+// The admin API key is read from -api-key or the ADMIN_API_KEY environment
+// variable.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	log.SetFlags(0)
+	baseURL := flag.String("url", "", "base URL of the search service")
+	apiKey := flag.String("api-key", os.Getenv("ADMIN_API_KEY"), "admin API key (default $ADMIN_API_KEY)")
+	timeout := flag.Duration("timeout", time.Minute, "request timeout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: psearch-config -url URL [flags] export | import [-prune] [-dry-run] FILE\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *baseURL == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client := &adminClient{baseURL: strings.TrimSuffix(*baseURL, "/"), apiKey: *apiKey, http: &http.Client{Timeout: *timeout}}
+	var err error
+	switch command, args := flag.Arg(0), flag.Args()[1:]; command {
+	case "export":
+		err = client.export(os.Stdout)
+	case "import":
+		err = runImport(client, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+// runImport parses the import command's flags and imports the bundle file
+func runImport(client *adminClient, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	prune := flags.Bool("prune", false, "delete configuration the bundle does not contain")
+	dryRun := flags.Bool("dry-run", false, "validate the bundle and report changes without writing them")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one bundle file, got %d arguments", flags.NArg())
+	}
+
+	bundle, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("prune", fmt.Sprint(*prune))
+	query.Set("dry_run", fmt.Sprint(*dryRun))
+	return client.importBundle(bundle, query, os.Stdout)
+}
+
+// adminClient calls the service's admin API
+type adminClient struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// export writes the exported bundle to out
+func (c *adminClient) export(out io.Writer) error {
+	return c.do(http.MethodGet, "/admin/config:export", nil, out)
+}
+
+// importBundle posts bundle and writes the import result to out
+func (c *adminClient) importBundle(bundle []byte, query url.Values, out io.Writer) error {
+	return c.do(http.MethodPost, "/admin/config:import?"+query.Encode(), bundle, out)
+}
+
+// do sends a request and copies a successful response body to out
+func (c *adminClient) do(method, path string, body []byte, out io.Writer) error {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", c.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(message))
+	}
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
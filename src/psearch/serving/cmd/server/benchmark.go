@@ -0,0 +1,152 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"psearch/serving/internal/api"
+	"psearch/serving/internal/benchmark"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// runBenchmark optionally loads a synthetic catalog into the configured
+// Spanner database (or emulator), then drives concurrent search load
+// in-process or against a deployment and prints throughput and latency
+// percentiles. It returns the process exit code: 1 if the run fails or
+// misses the -max-p95 or -min-qps bounds, so it can gate a release.
+func runBenchmark(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("benchmark", flag.ExitOnError)
+	products := flags.Int("products", 0, "number of synthetic products to load before the run; 0 searches the existing catalog")
+	seed := flags.Uint64("seed", 1, "seed of the synthetic catalog and the query sequence")
+	catalogID := flags.String("catalog-id", "", "catalog to load the products into and to search")
+	batchSize := flags.Int("batch-size", 500, "products written per Spanner commit")
+	loadConcurrency := flags.Int("load-concurrency", 4, "product batches written at the same time")
+	target := flags.String("target", "", "base URL of a deployment to search; empty searches in-process")
+	apiKey := flags.String("api-key", "", "X-API-Key sent to -target")
+	concurrency := flags.Int("concurrency", 16, "concurrent search workers")
+	duration := flags.Duration("duration", 30*time.Second, "length of the run")
+	requests := flags.Int("requests", 0, "stop after this many searches instead of after -duration")
+	queryCount := flags.Int("queries", 500, "distinct queries drawn from, head to tail")
+	mode := flags.String("mode", "", "search mode: hybrid, vector or keyword; empty uses the default")
+	cache := flags.Bool("cache", true, "keep the result and embedding caches of an in-process run")
+	maxP95 := flags.Duration("max-p95", 0, "fail if the p95 latency exceeds this")
+	minQPS := flags.Float64("min-qps", 0, "fail if the throughput is below this many searches per second")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	gen := benchmark.NewGenerator(*seed)
+	if *products > 0 {
+		if err := loadBenchmarkCatalog(ctx, cfg, gen, *catalogID, *products, *batchSize, *loadConcurrency); err != nil {
+			log.Printf("benchmark: %v", err)
+			return 1
+		}
+	}
+
+	var searchTarget benchmark.Target
+	if *target != "" {
+		searchTarget = benchmark.HTTPTarget{
+			BaseURL: *target,
+			APIKey:  *apiKey,
+			Client:  &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}},
+		}
+	} else {
+		searchCfg := searchOnlyConfig(cfg)
+		if !*cache {
+			searchCfg.ResultCacheSize = 0
+			searchCfg.EmbeddingCacheSize = 0
+		}
+		handler, controller, err := api.NewHandler(searchCfg)
+		if err != nil {
+			log.Printf("benchmark: failed to set up the API: %v", err)
+			return 1
+		}
+		defer controller.Close()
+		searchTarget = benchmark.HandlerTarget{Handler: handler}
+	}
+
+	opts := benchmark.LoadOptions{
+		Queries:     gen.Queries(*queryCount),
+		Request:     models.SearchRequest{Mode: models.SearchMode(*mode), CatalogID: *catalogID},
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Requests:    *requests,
+		Seed:        *seed,
+	}
+	log.Printf("benchmark: running %d workers over %d queries", opts.Concurrency, len(opts.Queries))
+	report, err := benchmark.Run(ctx, searchTarget, opts)
+	if err != nil {
+		log.Printf("benchmark: %v", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Printf("benchmark: %v", err)
+			return 1
+		}
+	} else {
+		fmt.Println(report)
+	}
+
+	failed := false
+	if *maxP95 > 0 && report.Latency.P95 > float64(*maxP95)/float64(time.Millisecond) {
+		log.Printf("benchmark: p95 latency %.1fms exceeds %s", report.Latency.P95, *maxP95)
+		failed = true
+	}
+	if *minQPS > 0 && report.Throughput < *minQPS {
+		log.Printf("benchmark: throughput %.1f qps is below %.1f", report.Throughput, *minQPS)
+		failed = true
+	}
+	if report.Requests > 0 && report.Errors == report.Requests {
+		log.Printf("benchmark: every search failed, statuses %v", report.StatusCodes)
+		failed = true
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// loadBenchmarkCatalog writes n synthetic products to the configured
+// Spanner database, embedding them with the configured models (local
+// hashing embeddings in DEV_MODE)
+func loadBenchmarkCatalog(ctx context.Context, cfg *config.Config, gen *benchmark.Generator, catalogID string, n, batchSize, concurrency int) error {
+	spannerSvc, err := openProductStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer spannerSvc.Close()
+
+	start := time.Now()
+	if err := benchmark.LoadCatalog(ctx, spannerSvc, gen, catalogID, n, batchSize, concurrency); err != nil {
+		return fmt.Errorf("failed to load the synthetic catalog: %w", err)
+	}
+	log.Printf("benchmark: loaded %d products in %s", n, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"psearch/serving/internal/api"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// runEvaluate scores ranking configurations against a labeled judgment set
+// in-process, against the configured Spanner database (or emulator) and
+// Vertex AI models, and prints a comparison report. It returns the process
+// exit code.
+func runEvaluate(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("evaluate", flag.ExitOnError)
+	judgmentsFile := flags.String("judgments", "", "JSON file holding an evaluation request: judgments and, optionally, configs and k")
+	k := flags.Int("k", 0, "rank cutoff of every metric, overriding the file's")
+	asJSON := flags.Bool("json", false, "print the full report as JSON instead of a table")
+	flags.Parse(args)
+
+	if *judgmentsFile == "" {
+		log.Printf("evaluate: -judgments is required")
+		return 2
+	}
+	data, err := os.ReadFile(*judgmentsFile)
+	if err != nil {
+		log.Printf("evaluate: %v", err)
+		return 1
+	}
+	var req models.EvaluationRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Printf("evaluate: invalid judgments file %s: %v", *judgmentsFile, err)
+		return 1
+	}
+	if *k > 0 {
+		req.K = *k
+	}
+
+	_, controller, err := api.NewHandler(searchOnlyConfig(cfg))
+	if err != nil {
+		log.Printf("evaluate: failed to set up the API: %v", err)
+		return 1
+	}
+	defer controller.Close()
+
+	report, err := controller.RunEvaluation(context.Background(), &req)
+	if err != nil {
+		log.Printf("evaluate: %v", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Printf("evaluate: %v", err)
+			return 1
+		}
+		return 0
+	}
+	printEvaluationReport(report)
+	return 0
+}
+
+// printEvaluationReport prints a table of each configuration's metrics and
+// their difference from the first configuration's
+func printEvaluationReport(report *models.EvaluationReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "config\tNDCG@%d\trecall@%d\tMRR@%d\tfailed\n", report.K, report.K, report.K)
+	baseline := report.Configs[0]
+	for i, evaluation := range report.Configs {
+		if i == 0 {
+			fmt.Fprintf(w, "%s\t%.4f\t%.4f\t%.4f\t%d\n", evaluation.Name, evaluation.NDCG, evaluation.Recall, evaluation.MRR, evaluation.Failed)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%.4f (%+.4f)\t%.4f (%+.4f)\t%.4f (%+.4f)\t%d\n", evaluation.Name,
+			evaluation.NDCG, evaluation.NDCG-baseline.NDCG,
+			evaluation.Recall, evaluation.Recall-baseline.Recall,
+			evaluation.MRR, evaluation.MRR-baseline.MRR,
+			evaluation.Failed)
+	}
+	w.Flush()
+	fmt.Printf("%d judged queries\n", report.Judgments)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/lifecycle"
+	"psearch/serving/internal/services"
+)
+
+// runIndexWorker applies product change events from INDEXING_SUBSCRIPTION
+// until it is signalled to stop. It serves /healthz and /metrics on PORT so
+// it can run as a Cloud Run or GKE service alongside the API. It returns
+// the process exit code.
+func runIndexWorker(cfg *config.Config) int {
+	if cfg.IndexingSubscription == "" {
+		log.Printf("index-worker: INDEXING_SUBSCRIPTION is required")
+		return 2
+	}
+
+	ctx := context.Background()
+	embeddingSvc, err := services.NewEmbeddingService(ctx, cfg)
+	if err != nil {
+		log.Printf("index-worker: %v", err)
+		return 1
+	}
+	spannerSvc, err := services.NewSpannerService(ctx, cfg, embeddingSvc)
+	if err != nil {
+		log.Printf("index-worker: %v", err)
+		return 1
+	}
+	if err := services.RegisterEmbeddingVersions(ctx, cfg, spannerSvc); err != nil {
+		spannerSvc.Close()
+		log.Printf("index-worker: %v", err)
+		return 1
+	}
+	pubsubSvc, err := services.NewPubSubService(ctx, cfg)
+	if err != nil {
+		spannerSvc.Close()
+		log.Printf("index-worker: %v", err)
+		return 1
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("GET /metrics", promhttp.Handler())
+	server := &http.Server{
+		Addr:        fmt.Sprintf(":%d", cfg.Port),
+		Handler:     mux,
+		ReadTimeout: 15 * time.Second,
+	}
+
+	workerCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		services.NewIndexingWorker(cfg, spannerSvc, pubsubSvc).Run(workerCtx)
+	}()
+
+	// The worker finishes its batch in progress before Spanner is closed
+	manager := lifecycle.NewManager(server, cfg.ShutdownDrainTimeout)
+	manager.OnShutdown("spanner", func(context.Context) error {
+		spannerSvc.Close()
+		return nil
+	})
+	manager.OnShutdown("worker", func(ctx context.Context) error {
+		stop()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("batch in progress not finished: %w", ctx.Err())
+		}
+	})
+
+	log.Printf("Indexing worker pulling from %s, serving health checks on port %d", cfg.IndexingSubscription, cfg.Port)
+	if err := manager.Run(); err != nil {
+		log.Printf("index-worker: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -17,18 +17,19 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"psearch/serving-go/internal/api"
-	"psearch/serving-go/internal/config"
+	"psearch/serving/internal/api"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/lifecycle"
+	"psearch/serving/internal/services"
+	"psearch/serving/internal/telemetry"
 )
 
 func main() {
@@ -38,45 +39,114 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Set Gin mode
-	if cfg.Environment == "production" {
-		gin.SetMode(gin.ReleaseMode)
+	// "server selftest" runs a synthetic query suite against the configured
+	// environment and exits non-zero on failure, for use as a deploy gate
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		os.Exit(runSelfTest(cfg, os.Args[2:]))
 	}
 
-	// Create router and setup routes
-	router := gin.Default()
-	api.SetupRouter(router, cfg)
+	// "server evaluate" scores ranking configurations against a labeled
+	// judgment set, before alpha or the embedding model is changed
+	if len(os.Args) > 1 && os.Args[1] == "evaluate" {
+		os.Exit(runEvaluate(cfg, os.Args[2:]))
+	}
+
+	// "server benchmark" loads a synthetic catalog and measures search
+	// throughput and latency percentiles under concurrent load
+	if len(os.Args) > 1 && os.Args[1] == "benchmark" {
+		os.Exit(runBenchmark(cfg, os.Args[2:]))
+	}
+
+	// "server retail-export" and "server retail-import" move products
+	// between Spanner and the Retail API's Product JSON, for migrating to or
+	// from Vertex AI Search for commerce
+	if len(os.Args) > 1 && os.Args[1] == "retail-export" {
+		os.Exit(runRetailExport(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "retail-import" {
+		os.Exit(runRetailImport(cfg, os.Args[2:]))
+	}
+
+	// "server migrate" creates or evolves the Spanner schema, so new
+	// environments need no hand-run DDL
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, os.Args[2:]))
+	}
+
+	// "server fts-ddl" prints the DDL adding the token columns FTS_FIELDS
+	// searches, for gcloud spanner databases ddl update --ddl-file
+	if len(os.Args) > 1 && os.Args[1] == "fts-ddl" {
+		for _, stmt := range services.FTSSchemaDDL(cfg.FTSFields) {
+			fmt.Printf("%s;\n", stmt)
+		}
+		return
+	}
+
+	// "server ann-ddl" prints the DDL of the vector index that
+	// ANN_DISTANCE_METRIC=dot_product searches use
+	if len(os.Args) > 1 && os.Args[1] == "ann-ddl" {
+		fmt.Printf("%s;\n", services.DotProductIndexDDL)
+		return
+	}
+
+	// "server reembed-ddl" prints the DDL adding the REEMBED_COLUMN shadow
+	// column re-embedding jobs write to, sized to REEMBED_DIMENSION
+	if len(os.Args) > 1 && os.Args[1] == "reembed-ddl" {
+		statements, err := services.ReembedColumnDDL(cfg.ReembedColumn, cmp.Or(cfg.ReembedDimension, cfg.EmbeddingDimension))
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		for _, stmt := range statements {
+			fmt.Printf("%s;\n", stmt)
+		}
+		return
+	}
+
+	// "server search-log-ddl" prints the BigQuery DDL of the
+	// SEARCH_LOG_TABLE search logs are streamed to, for bq query
+	if len(os.Args) > 1 && os.Args[1] == "search-log-ddl" {
+		fmt.Printf("%s;\n", services.SearchLogTableDDL(cfg.SearchLogTable))
+		return
+	}
+
+	// "server index-worker" applies product change events from the
+	// INDEXING_SUBSCRIPTION Pub/Sub subscription instead of serving the API
+	if len(os.Args) > 1 && os.Args[1] == "index-worker" {
+		os.Exit(runIndexWorker(cfg))
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := telemetry.InitTracing(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
+	// Create the API handler and its controller
+	handler, controller, err := api.NewHandler(cfg)
+	if err != nil {
+		log.Fatalf("Failed to setup router: %v", err)
+	}
 
 	// Configure server
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      router,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// Start server in goroutine to allow graceful shutdown
-	go func() {
-		log.Printf("Server starting on port %d in %s mode", cfg.Port, cfg.Environment)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
-		}
-	}()
+	// Hooks run in reverse order: the controller (and its Spanner client) is
+	// closed before the final trace flush
+	manager := lifecycle.NewManager(server, cfg.ShutdownDrainTimeout)
+	manager.OnShutdown("tracing", shutdownTracing)
+	manager.OnShutdown("controller", func(context.Context) error {
+		controller.Close()
+		return nil
+	})
 
-	// Setup graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down server...")
-
-	// Create a deadline for shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	log.Printf("Server starting on port %d in %s mode", cfg.Port, cfg.Environment)
+	if err := manager.Run(); err != nil {
+		log.Fatalf("%v", err)
 	}
-
-	log.Println("Server gracefully stopped")
 }
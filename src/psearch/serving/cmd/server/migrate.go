@@ -0,0 +1,85 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/services"
+)
+
+// runMigrate applies the pending schema migrations to the configured
+// database, printing each as it runs. It returns the process exit code.
+func runMigrate(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the pending migrations and their DDL without applying them")
+	baseline := flags.Int64("baseline", 0, "record migrations up to this version as applied without running them, for databases created before migrations were tracked")
+	flags.Parse(args)
+	if *dryRun && *baseline > 0 {
+		log.Printf("migrate: -baseline records migrations and cannot be combined with -dry-run")
+		return 2
+	}
+
+	ctx := context.Background()
+	migrator, err := services.NewSchemaMigrator(ctx, cfg)
+	if err != nil {
+		log.Printf("migrate: %v", err)
+		return 1
+	}
+	defer migrator.Close()
+
+	if *baseline > 0 {
+		recorded, err := migrator.Baseline(ctx, *baseline)
+		for _, migration := range recorded {
+			fmt.Printf("BASELINE %d %s\n", migration.Version, migration.Description)
+		}
+		if err != nil {
+			log.Printf("migrate: %v", err)
+			return 1
+		}
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		log.Printf("migrate: %v", err)
+		return 1
+	}
+	if len(pending) == 0 {
+		fmt.Println("schema is up to date")
+		return 0
+	}
+
+	for _, migration := range pending {
+		if *dryRun {
+			fmt.Printf("PENDING %d %s\n", migration.Version, migration.Description)
+			for _, stmt := range migration.Statements {
+				fmt.Printf("  %s;\n", stmt)
+			}
+			continue
+		}
+		fmt.Printf("APPLY %d %s\n", migration.Version, migration.Description)
+		if err := migrator.Apply(ctx, migration); err != nil {
+			log.Printf("migrate: %v", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/retail"
+	"psearch/serving/internal/services"
+)
+
+// maxRetailProductLine bounds one line of a Retail product file; Retail
+// itself caps products well below it
+const maxRetailProductLine = 16 << 20
+
+// runRetailExport writes the live products of the configured Spanner
+// database as newline-delimited Retail API Product JSON, the format
+// Retail imports from Cloud Storage. Products that cannot be converted
+// are logged and skipped. It returns the process exit code.
+func runRetailExport(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("retail-export", flag.ExitOnError)
+	out := flags.String("out", "-", "file to write, or - for stdout")
+	catalogID := flags.String("catalog-id", "", "catalog to export; empty exports every catalog")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	spannerSvc, err := openProductStore(ctx, cfg)
+	if err != nil {
+		log.Printf("retail-export: %v", err)
+		return 1
+	}
+	defer spannerSvc.Close()
+
+	w := io.Writer(os.Stdout)
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Printf("retail-export: %v", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	exported, skipped := 0, 0
+	err = spannerSvc.ScanProducts(ctx, *catalogID, func(productID string, productData map[string]interface{}) error {
+		product, err := retail.ToProduct(productID, productData)
+		if err != nil {
+			log.Printf("retail-export: skipping product: %v", err)
+			skipped++
+			return nil
+		}
+		exported++
+		return encoder.Encode(product)
+	})
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		log.Printf("retail-export: %v", err)
+		return 1
+	}
+	log.Printf("retail-export: exported %d products, skipped %d", exported, skipped)
+	return 0
+}
+
+// runRetailImport reads newline-delimited Retail API Product JSON and
+// writes the products to the configured Spanner database, embedding them
+// with the configured models. Lines that cannot be converted are logged
+// and skipped. It returns the process exit code.
+func runRetailImport(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("retail-import", flag.ExitOnError)
+	in := flags.String("in", "", "file to read, or - for stdin")
+	catalogID := flags.String("catalog-id", "", "catalog to import the products into")
+	batchSize := flags.Int("batch-size", 500, "products written per Spanner commit")
+	flags.Parse(args)
+
+	if *in == "" {
+		log.Printf("retail-import: -in is required")
+		return 2
+	}
+	r := io.Reader(os.Stdin)
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Printf("retail-import: %v", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx := context.Background()
+	spannerSvc, err := openProductStore(ctx, cfg)
+	if err != nil {
+		log.Printf("retail-import: %v", err)
+		return 1
+	}
+	defer spannerSvc.Close()
+
+	imported, skipped := 0, 0
+	batch := make(map[string]map[string]interface{}, *batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := spannerSvc.WriteProducts(ctx, *catalogID, batch); err != nil {
+			return err
+		}
+		imported += len(batch)
+		log.Printf("retail-import: imported %d products", imported)
+		clear(batch)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxRetailProductLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var product retail.Product
+		if err := json.Unmarshal(scanner.Bytes(), &product); err != nil {
+			log.Printf("retail-import: skipping line %d: %v", line, err)
+			skipped++
+			continue
+		}
+		productID, productData, err := retail.FromProduct(&product)
+		if err != nil {
+			log.Printf("retail-import: skipping line %d: %v", line, err)
+			skipped++
+			continue
+		}
+		batch[productID] = productData
+		if len(batch) >= *batchSize {
+			if err := flush(); err != nil {
+				log.Printf("retail-import: %v", err)
+				return 1
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("a product is longer than %d bytes", maxRetailProductLine)
+		}
+		log.Printf("retail-import: %v", err)
+		return 1
+	}
+	if err := flush(); err != nil {
+		log.Printf("retail-import: %v", err)
+		return 1
+	}
+	log.Printf("retail-import: imported %d products, skipped %d", imported, skipped)
+	return 0
+}
+
+// openProductStore connects to the configured Spanner database with the
+// embedding versions registered, for commands that read or write products
+// outside the API
+func openProductStore(ctx context.Context, cfg *config.Config) (*services.SpannerService, error) {
+	embeddingSvc, err := services.NewEmbeddingService(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	spannerSvc, err := services.NewSpannerService(ctx, cfg, embeddingSvc)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.RegisterEmbeddingVersions(ctx, cfg, spannerSvc); err != nil {
+		spannerSvc.Close()
+		return nil, err
+	}
+	return spannerSvc, nil
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"psearch/serving/internal/api"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// selfTestCase is a synthetic search and the expectations its response
+// must meet
+type selfTestCase struct {
+	Name    string               `json:"name"`
+	Request models.SearchRequest `json:"request"`
+	// MinResults is the fewest results the search may return
+	MinResults int `json:"min_results"`
+	// MaxLatencyMS overrides the suite's latency bound for this case
+	MaxLatencyMS int `json:"max_latency_ms,omitempty"`
+}
+
+// defaultSelfTestSuite exercises every search mode and both response
+// shapes with queries any apparel catalog should match
+var defaultSelfTestSuite = []selfTestCase{
+	{Name: "hybrid", Request: models.SearchRequest{Query: "running shoes"}, MinResults: 1},
+	{Name: "keyword", Request: models.SearchRequest{Query: "shirt", Mode: models.SearchModeKeyword}, MinResults: 1},
+	{Name: "vector", Request: models.SearchRequest{Query: "something warm to wear in winter", Mode: models.SearchModeVector}, MinResults: 1},
+	{Name: "ids_only", Request: models.SearchRequest{Query: "jacket", Hydrate: ptr(false)}, MinResults: 1},
+}
+
+// ptr returns a pointer to v, for optional request fields
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// runSelfTest runs the self-test suite in-process against the configured
+// Spanner database and Vertex AI models, printing a line per case. It
+// returns the process exit code: 0 if every case passed, 1 otherwise.
+func runSelfTest(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	suiteFile := flags.String("suite", "", "JSON file of test cases replacing the built-in suite")
+	maxLatency := flags.Duration("max-latency", 2*time.Second, "latency bound for cases that do not set max_latency_ms")
+	flags.Parse(args)
+
+	suite := defaultSelfTestSuite
+	if *suiteFile != "" {
+		data, err := os.ReadFile(*suiteFile)
+		if err != nil {
+			log.Printf("selftest: %v", err)
+			return 1
+		}
+		if err := json.Unmarshal(data, &suite); err != nil {
+			log.Printf("selftest: invalid suite %s: %v", *suiteFile, err)
+			return 1
+		}
+	}
+
+	handler, controller, err := api.NewHandler(searchOnlyConfig(cfg))
+	if err != nil {
+		log.Printf("selftest: failed to set up the API: %v", err)
+		return 1
+	}
+	defer controller.Close()
+
+	failed := 0
+	for _, tc := range suite {
+		bound := *maxLatency
+		if tc.MaxLatencyMS > 0 {
+			bound = time.Duration(tc.MaxLatencyMS) * time.Millisecond
+		}
+		count, elapsed, problems := runSelfTestCase(handler, tc, bound)
+		if len(problems) > 0 {
+			failed++
+			fmt.Printf("FAIL %s (%s): %s\n", tc.Name, elapsed.Round(time.Millisecond), strings.Join(problems, "; "))
+			continue
+		}
+		fmt.Printf("PASS %s (%d results, %s)\n", tc.Name, count, elapsed.Round(time.Millisecond))
+	}
+
+	fmt.Printf("%d/%d self-test cases passed\n", len(suite)-failed, len(suite))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// searchOnlyConfig returns a copy of cfg for commands that only exercise
+// the search path in-process: authentication is skipped and the background
+// jobs are kept from starting
+func searchOnlyConfig(cfg *config.Config) *config.Config {
+	searchCfg := *cfg
+	searchCfg.AuthMethods = nil
+	searchCfg.HeadQueryPrecomputeEnabled = false
+	searchCfg.RecallMonitorEnabled = false
+	searchCfg.TailSamplingEnabled = false
+	searchCfg.RegressionDetectionEnabled = false
+	searchCfg.AnalyticsEnabled = false
+	searchCfg.SearchLogsEnabled = false
+	searchCfg.WarmupEnabled = false
+	searchCfg.SavedSearchEvaluationInterval = 0
+	return &searchCfg
+}
+
+// runSelfTestCase sends one search through handler and checks the response
+// against the case's expectations, returning the result count, latency and
+// any failed expectations
+func runSelfTestCase(handler http.Handler, tc selfTestCase, maxLatency time.Duration) (int, time.Duration, []string) {
+	body, err := json.Marshal(tc.Request)
+	if err != nil {
+		return 0, 0, []string{err.Error()}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(recorder, req)
+	elapsed := time.Since(start)
+
+	if recorder.Code != http.StatusOK {
+		return 0, elapsed, []string{fmt.Sprintf("status %d: %s", recorder.Code, strings.TrimSpace(recorder.Body.String()))}
+	}
+	var resp models.SearchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		return 0, elapsed, []string{fmt.Sprintf("invalid response body: %v", err)}
+	}
+
+	var problems []string
+	if elapsed > maxLatency {
+		problems = append(problems, fmt.Sprintf("took longer than %s", maxLatency))
+	}
+	if resp.Fallback != "" {
+		problems = append(problems, fmt.Sprintf("served in fallback mode %s", resp.Fallback))
+	}
+	count := len(resp.Results)
+	if tc.Request.Hydrate != nil && !*tc.Request.Hydrate {
+		count = len(resp.Hits)
+		for i, hit := range resp.Hits {
+			if hit.ID == "" {
+				problems = append(problems, fmt.Sprintf("hits[%d] has no id", i))
+			}
+		}
+	} else {
+		for i, result := range resp.Results {
+			problems = append(problems, resultSchemaProblems(fmt.Sprintf("results[%d]", i), result)...)
+		}
+	}
+	if count < tc.MinResults {
+		problems = append(problems, fmt.Sprintf("expected at least %d results, got %d", tc.MinResults, count))
+	}
+	return count, elapsed, problems
+}
+
+// resultSchemaProblems reports the fields a hydrated search result is
+// missing
+func resultSchemaProblems(name string, result models.SearchResult) []string {
+	var problems []string
+	if result.ID == "" {
+		problems = append(problems, name+" has no id")
+	}
+	if result.Name == "" && result.Title == "" {
+		problems = append(problems, name+" has no name or title")
+	}
+	if _, ok := result.Score["hybrid"]; !ok {
+		problems = append(problems, name+" has no hybrid score")
+	}
+	if result.PriceInfo.CurrencyCode == "" {
+		problems = append(problems, name+" has no currency code")
+	}
+	return problems
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/models"
+)
+
+// cacheLayers returns every cache layer managed by the admin API
+func (c *Controller) cacheLayers() []cache.Layer {
+	var layers []cache.Layer
+	for _, source := range c.caches {
+		layers = append(layers, source.CacheLayers()...)
+	}
+	if c.queryTemplates != nil {
+		layers = append(layers, c.queryTemplates.CacheLayers()...)
+	}
+	if c.refinements != nil {
+		layers = append(layers, c.refinements.CacheLayers()...)
+	}
+	if c.sessions != nil {
+		layers = append(layers, c.sessions.CacheLayers()...)
+	}
+	return layers
+}
+
+// CacheStats handles the cache stats endpoint
+func (c *Controller) CacheStats(w http.ResponseWriter, r *http.Request) {
+	layers := c.cacheLayers()
+	stats := make([]cache.Stats, 0, len(layers))
+	for _, layer := range layers {
+		stats = append(stats, layer.Stats())
+	}
+	writeJSON(w, http.StatusOK, H{"caches": stats})
+}
+
+// InvalidateCache handles the cache invalidation endpoint. Entries can be
+// selected by key pattern, query or product ID, or all entries can be
+// purged, optionally restricted to some layers.
+func (c *Controller) InvalidateCache(w http.ResponseWriter, r *http.Request) {
+	var req models.CacheInvalidationRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.KeyPattern == "" && req.Query == "" && req.ProductID == "" && !req.All {
+		writeError(w, http.StatusBadRequest, "one of key_pattern, query, product_id or all is required")
+		return
+	}
+
+	selected := make(map[string]bool, len(req.Layers))
+	for _, name := range req.Layers {
+		selected[name] = true
+	}
+
+	response := models.CacheInvalidationResponse{Invalidated: make(map[string]int)}
+	for _, layer := range c.cacheLayers() {
+		if len(selected) > 0 && !selected[layer.Name()] {
+			continue
+		}
+
+		removed := 0
+		if req.All {
+			removed = layer.Purge()
+		}
+		if req.KeyPattern != "" {
+			n, err := layer.InvalidateKeys(req.KeyPattern)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid key_pattern: "+err.Error())
+				return
+			}
+			removed += n
+		}
+		if req.Query != "" {
+			removed += layer.InvalidateTag(cache.QueryTag(req.Query))
+		}
+		if req.ProductID != "" {
+			removed += layer.InvalidateTag(cache.ProductTag(req.ProductID))
+		}
+
+		response.Invalidated[layer.Name()] = removed
+		response.Total += removed
+	}
+
+	log.Printf("Cache invalidation (pattern=%q query=%q product=%q all=%t) removed %d entries",
+		req.KeyPattern, req.Query, req.ProductID, req.All, response.Total)
+	writeJSON(w, http.StatusOK, response)
+}
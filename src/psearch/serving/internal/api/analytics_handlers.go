@@ -0,0 +1,62 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"psearch/serving/internal/models"
+)
+
+// QueryAnalytics handles reporting search volume, zero-result rate,
+// latency, and the top and trending queries of a recent period. Any
+// instance can report the totals written by the instances aggregating
+// them.
+func (c *Controller) QueryAnalytics(w http.ResponseWriter, r *http.Request) {
+	if c.analyticsStore == nil {
+		writeError(w, http.StatusConflict, "Query analytics are not available")
+		return
+	}
+
+	var req models.QueryAnalyticsRequest
+	if err := bindQuery(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	hours := req.Hours
+	if hours == 0 {
+		hours = 24
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = 20
+	}
+
+	// Periods end with the current, partial hour
+	until := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+	since := until.Add(-time.Duration(hours) * time.Hour)
+	report, err := c.analyticsStore.QueryAnalyticsReport(r.Context(), since, until, limit, c.config.AnalyticsTrendingMinSearches)
+	if err != nil {
+		log.Printf("Failed to read query analytics: %v", err)
+		writeServiceError(w, err, "Failed to read query analytics")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
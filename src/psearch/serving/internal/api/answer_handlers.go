@@ -0,0 +1,75 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+)
+
+// Answer handles answering a shopper's question from the top hybrid search
+// results for it, returning the answer with the results it is grounded in
+func (c *Controller) Answer(w http.ResponseWriter, r *http.Request) {
+	if c.answers == nil {
+		writeError(w, http.StatusConflict, "Answers are not enabled")
+		return
+	}
+
+	var req models.AnswerRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	localeFromHeaders(r, &req.Currency, &req.Locale)
+
+	topK := c.config.AnswerTopK
+	if req.TopK != nil {
+		topK = *req.TopK
+	}
+	search := models.SearchRequest{
+		Query:     req.Question,
+		Mode:      models.SearchModeHybrid,
+		Limit:     &topK,
+		Filter:    req.Filter,
+		MinPrice:  req.MinPrice,
+		MaxPrice:  req.MaxPrice,
+		CatalogID: req.CatalogID,
+		UserID:    req.UserID,
+		SessionID: req.SessionID,
+		Currency:  req.Currency,
+		Locale:    req.Locale,
+	}
+	response, err := c.RunSearch(r.Context(), &search)
+	if err != nil {
+		writeServiceError(w, err, "Search failed")
+		return
+	}
+
+	// Without results there is nothing to ground an answer in
+	answer := &models.AnswerResponse{Citations: []string{}, Results: response.Results}
+	if len(response.Results) > 0 {
+		answer.Answer, answer.Citations, err = c.answers.Answer(r.Context(), req.Question, response.Results)
+		if err != nil {
+			log.Printf("Answer generation error: %v", err)
+			writeServiceError(w, err, "Answer generation failed")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, answer)
+}
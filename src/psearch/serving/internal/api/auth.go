@@ -0,0 +1,273 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/auth"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/idtoken"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+)
+
+// Authentication methods accepted in AUTH_METHODS
+const (
+	AuthMethodAPIKey        = "api_key"
+	AuthMethodGoogleIDToken = "google_id_token"
+	AuthMethodFirebase      = "firebase"
+)
+
+// errUnauthenticated is returned when no accepted credential was presented
+var errUnauthenticated = errors.New("missing or invalid credentials")
+
+// Principal identifies the caller of an authenticated request
+type Principal struct {
+	// Method is the authentication method that accepted the credential
+	Method string
+	// ID is the API key name, service account email or Firebase UID
+	ID string
+}
+
+// String formats the principal for logs
+func (p Principal) String() string {
+	return p.Method + ":" + p.ID
+}
+
+// metricsClient is the client label recorded for the principal. Firebase
+// users are aggregated to keep label cardinality bounded.
+func (p Principal) metricsClient() string {
+	if p.Method == AuthMethodFirebase {
+		return "user"
+	}
+	return p.ID
+}
+
+// Authenticator verifies the credentials of API requests
+type Authenticator struct {
+	apiKeys         map[string]string
+	googleIDTokens  bool
+	audience        string
+	serviceAccounts map[string]bool
+	firebase        *auth.Client
+}
+
+// NewAuthenticator creates an authenticator for the configured methods. It
+// returns nil when authentication is disabled.
+func NewAuthenticator(ctx context.Context, cfg *config.Config) (*Authenticator, error) {
+	if len(cfg.AuthMethods) == 0 {
+		return nil, nil
+	}
+
+	a := &Authenticator{}
+	for _, method := range cfg.AuthMethods {
+		switch method {
+		case AuthMethodAPIKey:
+			if len(cfg.APIKeys) == 0 {
+				return nil, fmt.Errorf("auth method %s requires API_KEYS", method)
+			}
+			a.apiKeys = cfg.APIKeys
+		case AuthMethodGoogleIDToken:
+			if cfg.AuthAudience == "" {
+				return nil, fmt.Errorf("auth method %s requires AUTH_AUDIENCE", method)
+			}
+			a.googleIDTokens = true
+			a.audience = cfg.AuthAudience
+			a.serviceAccounts = make(map[string]bool)
+			for _, email := range cfg.AuthAllowedServiceAccounts {
+				a.serviceAccounts[strings.TrimSpace(email)] = true
+			}
+		case AuthMethodFirebase:
+			app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: cfg.FirebaseProjectID})
+			if err != nil {
+				return nil, fmt.Errorf("failed to create Firebase app: %v", err)
+			}
+			client, err := app.Auth(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create Firebase auth client: %v", err)
+			}
+			a.firebase = client
+		default:
+			return nil, fmt.Errorf("unknown auth method %q", method)
+		}
+	}
+	return a, nil
+}
+
+// Authenticate checks the request's X-API-Key header or bearer token
+// against each enabled method
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" && a.apiKeys != nil {
+		// Compare against every key so timing does not reveal which matched
+		matched := ""
+		for name, expected := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(expected)) == 1 {
+				matched = name
+			}
+		}
+		if matched != "" {
+			return Principal{Method: AuthMethodAPIKey, ID: matched}, nil
+		}
+		return Principal{Method: AuthMethodAPIKey}, errUnauthenticated
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return Principal{}, errUnauthenticated
+	}
+
+	// Google ID tokens and Firebase tokens are both JWTs; try each verifier
+	if principal, err := a.verifyGoogleIDToken(r.Context(), token); err != errUnauthenticated {
+		return principal, err
+	}
+	if a.firebase != nil {
+		if verified, err := a.firebase.VerifyIDToken(r.Context(), token); err == nil {
+			return Principal{Method: AuthMethodFirebase, ID: verified.UID}, nil
+		}
+	}
+	return Principal{}, errUnauthenticated
+}
+
+// verifyGoogleIDToken checks a bearer token as a Google ID token for the
+// configured audience, issued to an allowed service account. It returns
+// errUnauthenticated when the token is not one, or Google ID tokens are
+// not accepted.
+func (a *Authenticator) verifyGoogleIDToken(ctx context.Context, token string) (Principal, error) {
+	if a == nil || !a.googleIDTokens {
+		return Principal{}, errUnauthenticated
+	}
+	payload, err := idtoken.Validate(ctx, token, a.audience)
+	if err != nil {
+		return Principal{}, errUnauthenticated
+	}
+	email, _ := payload.Claims["email"].(string)
+	if email == "" {
+		email = payload.Subject
+	}
+	principal := Principal{Method: AuthMethodGoogleIDToken, ID: email}
+	if len(a.serviceAccounts) > 0 && !a.serviceAccounts[email] {
+		return principal, fmt.Errorf("service account %s is not allowed", email)
+	}
+	return principal, nil
+}
+
+// acceptsServiceIdentities reports whether backend callers can
+// authenticate with Google ID tokens
+func (a *Authenticator) acceptsServiceIdentities() bool {
+	return a != nil && a.googleIDTokens
+}
+
+// ServiceAuthMiddleware admits only backend callers, such as the ingestion
+// pipeline: a Google ID token AuthMiddleware would accept, or the admin API
+// key. Shopper API keys and Firebase users are refused.
+func ServiceAuthMiddleware(a *Authenticator, adminAPIKey string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var principal Principal
+			err := errUnauthenticated
+			if key := r.Header.Get("X-API-Key"); key != "" {
+				principal.Method = AuthMethodAPIKey
+				if adminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(adminAPIKey)) == 1 {
+					principal.ID, err = "admin", nil
+				}
+			} else if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+				principal, err = a.verifyGoogleIDToken(r.Context(), token)
+			}
+
+			method := principal.Method
+			if method == "" {
+				method = "none"
+			}
+			if err != nil {
+				metrics.AuthRequests.WithLabelValues(method, "", "denied").Inc()
+				writeError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			metrics.AuthRequests.WithLabelValues(method, principal.metricsClient(), "ok").Inc()
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.String("enduser.id", principal.ID),
+				attribute.String("enduser.auth_method", principal.Method),
+			)
+			r, state := withRequestState(r)
+			state.principal = &principal
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AuthMiddleware rejects requests without valid credentials and records the
+// caller for logs, metrics and traces. A nil authenticator allows all
+// requests.
+func AuthMiddleware(a *Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := a.Authenticate(r)
+			method := principal.Method
+			if method == "" {
+				method = "none"
+			}
+			if err != nil {
+				metrics.AuthRequests.WithLabelValues(method, "", "denied").Inc()
+				writeError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			metrics.AuthRequests.WithLabelValues(method, principal.metricsClient(), "ok").Inc()
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.String("enduser.id", principal.ID),
+				attribute.String("enduser.auth_method", principal.Method),
+			)
+			r, state := withRequestState(r)
+			state.principal = &principal
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// principalName is the authenticated caller as method:id, or "" when
+// authentication is disabled. Saved searches, user profiles and sessions
+// belong to it.
+func principalName(ctx context.Context) string {
+	principal, ok := principalFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return principal.String()
+}
+
+// principalFromContext returns the authenticated caller, if any
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	state, ok := ctx.Value(requestStateKey{}).(*requestState)
+	if !ok || state.principal == nil {
+		return Principal{}, false
+	}
+	return *state.principal, true
+}
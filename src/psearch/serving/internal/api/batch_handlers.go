@@ -0,0 +1,206 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"psearch/serving/internal/models"
+)
+
+// defaultRetryAfterSeconds is the retry hint given for transient failures
+const defaultRetryAfterSeconds = 1
+
+// BatchSearch handles the batch search endpoint. Each sub-request succeeds or
+// fails on its own; the call only fails as a whole if the batch is malformed.
+func (c *Controller) BatchSearch(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchSearchRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(req.Requests) > c.config.MaxBatchSearchSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("batch contains %d requests, maximum is %d", len(req.Requests), c.config.MaxBatchSearchSize))
+		return
+	}
+
+	items := make([]models.BatchSearchItem, len(req.Requests))
+	sem := make(chan struct{}, c.config.BatchSearchConcurrency)
+	var wg sync.WaitGroup
+
+	for i := range req.Requests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			item := models.BatchSearchItem{Index: i}
+			response, err := c.RunSearch(r.Context(), &req.Requests[i])
+			if err != nil {
+				log.Printf("Batch search item %d failed: %v", i, err)
+				item.Status = models.BatchItemStatusError
+				item.Error = batchItemError(err)
+			} else {
+				item.Status = models.BatchItemStatusOK
+				item.Response = response
+			}
+			items[i] = item
+		}(i)
+	}
+	wg.Wait()
+
+	summary := models.BatchSummary{}
+	for _, item := range items {
+		summarizeBatchItem(&summary, item.Index, item.Status, item.Error)
+	}
+	finalizeBatchSummary(&summary)
+
+	writeJSON(w, http.StatusOK, models.BatchSearchResponse{
+		Results: items,
+		Summary: summary,
+	})
+}
+
+// BatchGetProducts handles the batch get endpoint, returning the products
+// found keyed by ID and the IDs that do not exist
+func (c *Controller) BatchGetProducts(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchGetRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(req.IDs) > c.config.MaxBatchGetSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("batch contains %d ids, maximum is %d", len(req.IDs), c.config.MaxBatchGetSize))
+		return
+	}
+
+	mask, err := newFieldMask(req.Fields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	localeFromHeaders(r, &req.Currency, &req.Locale)
+	currency, err := c.checkCurrency(req.Currency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	staleness, err := c.readStaleness(req.StalenessSeconds)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	catalogID, err := c.resolveCatalog(r.Context(), req.CatalogID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	products, err := c.products.GetProductsBatch(r.Context(), catalogID, req.IDs, staleness)
+	if err != nil {
+		// The lookup itself failed, so no product can be reported
+		log.Printf("Batch get failed: %v", err)
+		writeServiceError(w, err, "Batch get failed")
+		return
+	}
+
+	response := models.BatchGetResponse{
+		Products: make(map[string]interface{}, len(products)),
+		Missing:  []string{},
+	}
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		productData, found := products[id]
+		if !found {
+			response.Missing = append(response.Missing, id)
+			continue
+		}
+
+		product, err := c.products.TransformProduct(id, productData)
+		var masked interface{}
+		if err == nil {
+			product = c.localizeResults([]models.SearchResult{product}, currency, req.Locale)[0]
+			masked, err = mask.apply(product)
+		}
+		if err == nil {
+			response.Products[id] = masked
+		} else {
+			log.Printf("Batch get of product %s failed: %v", id, err)
+			if response.Errors == nil {
+				response.Errors = make(map[string]*models.BatchItemError)
+			}
+			response.Errors[id] = batchItemError(err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// batchItemError converts an item failure into its response payload with a
+// status code and retry hint
+func batchItemError(err error) *models.BatchItemError {
+	mapped := mapError(err, "internal error")
+	itemErr := &models.BatchItemError{
+		Code:    mapped.status,
+		Message: mapped.message,
+	}
+	if mapped.retryable() {
+		retryAfter := defaultRetryAfterSeconds
+		itemErr.Retryable = true
+		itemErr.RetryAfterSeconds = &retryAfter
+	}
+	return itemErr
+}
+
+// summarizeBatchItem folds one item outcome into the batch summary. Missing
+// products are a successful lookup, not a failure.
+func summarizeBatchItem(summary *models.BatchSummary, index int, status string, itemErr *models.BatchItemError) {
+	if status == models.BatchItemStatusError {
+		summary.Failed++
+		if itemErr != nil && itemErr.Retryable {
+			summary.RetryableIndexes = append(summary.RetryableIndexes, index)
+		}
+		return
+	}
+	summary.Succeeded++
+}
+
+// finalizeBatchSummary sets the overall status from the item counts
+func finalizeBatchSummary(summary *models.BatchSummary) {
+	switch {
+	case summary.Failed == 0:
+		summary.Status = models.BatchStatusOK
+	case summary.Succeeded == 0:
+		summary.Status = models.BatchStatusFailed
+	default:
+		summary.Status = models.BatchStatusPartial
+	}
+}
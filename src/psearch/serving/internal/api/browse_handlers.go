@@ -0,0 +1,103 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// BrowseCategory handles listing the products in a category without a query
+func (c *Controller) BrowseCategory(w http.ResponseWriter, r *http.Request) {
+	var req models.BrowseRequest
+	if err := bindQuery(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := c.validator.Browse(&req); err != nil {
+		writeErrorDetails(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	localeFromHeaders(r, &req.Currency, &req.Locale)
+	currency, err := c.checkCurrency(req.Currency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	catalogID, err := c.resolveCatalog(r.Context(), req.CatalogID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := services.BrowseOptions{
+		Category:  r.PathValue("category"),
+		CatalogID: catalogID,
+		Sort:      req.Sort,
+		Limit:     c.settings().DefaultLimit,
+		Staleness: c.config.SpannerStaleness,
+	}
+	if opts.Sort == "" {
+		opts.Sort = models.BrowseSortPopularity
+	}
+	if req.Limit != nil {
+		opts.Limit = *req.Limit
+	}
+	if req.Offset != nil {
+		opts.Offset = *req.Offset
+	}
+
+	filterNode, err := filter.Parse(req.Filter, c.filters)
+	if err != nil {
+		var filterErr *filter.Error
+		if errors.As(err, &filterErr) {
+			writeErrorDetails(w, http.StatusBadRequest, err.Error(), filterErr)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Filter = filterNode
+
+	output, err := c.searcher.BrowseByCategory(r.Context(), opts)
+	if err != nil {
+		log.Printf("Browse error: %v", err)
+		writeServiceError(w, err, "Browse failed")
+		return
+	}
+
+	response := &models.BrowseResponse{
+		Results:    c.localizeResults(output.Results, currency, req.Locale),
+		TotalFound: len(output.Results),
+		Category:   opts.Category,
+		Sort:       opts.Sort,
+	}
+	if response.Results == nil {
+		response.Results = []models.SearchResult{}
+	}
+	if output.HasMore {
+		next := opts.Offset + opts.Limit
+		response.NextOffset = &next
+	}
+	writeJSON(w, http.StatusOK, response)
+}
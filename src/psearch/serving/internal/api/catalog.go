@@ -0,0 +1,49 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import "context"
+
+// resolveCatalog returns the catalog a request is scoped to, see
+// config.ResolveCatalog. The resolved catalog is recorded as the request's
+// tenant for SLI metrics.
+func (c *Controller) resolveCatalog(ctx context.Context, requested string) (string, error) {
+	catalogID, err := c.config.ResolveCatalog(requested)
+	if err != nil {
+		return "", &badRequestError{message: err.Error()}
+	}
+	recordTenant(ctx, catalogID)
+	return catalogID, nil
+}
+
+// recordTenant notes catalogID as the tenant of the request in ctx. A
+// batch spanning several catalogs is attributed to "multiple".
+func recordTenant(ctx context.Context, catalogID string) {
+	state, ok := ctx.Value(requestStateKey{}).(*requestState)
+	if !ok {
+		return
+	}
+	if catalogID == "" {
+		catalogID = defaultTenant
+	}
+	switch state.tenant {
+	case "", catalogID:
+		state.tenant = catalogID
+	default:
+		state.tenant = multipleTenants
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+)
+
+// ListCatalogVersions handles listing the current catalog versions
+func (c *Controller) ListCatalogVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := c.catalogVersions.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list catalog versions: %v", err)
+		writeServiceError(w, err, "Failed to list catalog versions")
+		return
+	}
+	if versions == nil {
+		versions = []models.CatalogVersion{}
+	}
+
+	writeJSON(w, http.StatusOK, models.CatalogVersionListResponse{Versions: versions})
+}
+
+// BumpCatalogVersion handles recording a new catalog version, which stops
+// cached results of the previous version from being served. Import jobs
+// that cannot write to Spanner call it when they finish.
+func (c *Controller) BumpCatalogVersion(w http.ResponseWriter, r *http.Request) {
+	var req models.CatalogVersionRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	catalogID, err := c.resolveCatalog(r.Context(), req.CatalogID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.CatalogID = catalogID
+
+	version, err := c.catalogVersions.Bump(r.Context(), req)
+	if err != nil {
+		log.Printf("Failed to save catalog version: %v", err)
+		writeServiceError(w, err, "Failed to save catalog version")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, version)
+}
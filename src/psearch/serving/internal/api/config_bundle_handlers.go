@@ -0,0 +1,68 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// ExportConfig handles exporting the admin-managed configuration as a
+// bundle
+func (c *Controller) ExportConfig(w http.ResponseWriter, r *http.Request) {
+	bundle, err := c.configBundles.Export(r.Context())
+	if err != nil {
+		log.Printf("Failed to export configuration: %v", err)
+		writeServiceError(w, err, "Failed to export configuration")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, bundle)
+}
+
+// ImportConfig handles importing a configuration bundle exported by another
+// environment
+func (c *Controller) ImportConfig(w http.ResponseWriter, r *http.Request) {
+	var opts models.ConfigImportOptions
+	if err := bindQuery(r, &opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var bundle models.ConfigBundle
+	if err := bindJSON(r, &bundle); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := c.configBundles.Import(r.Context(), bundle, opts.Prune, opts.DryRun)
+	if errors.Is(err, services.ErrInvalidConfigBundle) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to import configuration: %v", err)
+		writeServiceError(w, err, "Failed to import configuration")
+		return
+	}
+
+	log.Printf("Imported configuration bundle exported at %s: %+v", bundle.ExportedAt, *result)
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// encodeConsistencyToken turns a Spanner read timestamp into an opaque token
+func encodeConsistencyToken(readTimestamp time.Time) string {
+	if readTimestamp.IsZero() {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(readTimestamp.UTC().Format(time.RFC3339Nano)))
+}
+
+// decodeConsistencyToken parses a token issued by encodeConsistencyToken and
+// rejects tokens older than the TTL, since Spanner can no longer read at them
+func decodeConsistencyToken(token string, ttl time.Duration) (time.Time, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid consistency_token")
+	}
+
+	readTimestamp, err := time.Parse(time.RFC3339Nano, string(raw))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid consistency_token")
+	}
+
+	if ttl > 0 && time.Since(readTimestamp) > ttl {
+		return time.Time{}, fmt.Errorf("consistency_token has expired, restart pagination without it")
+	}
+
+	return readTimestamp, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+)
+
+// currencyReportSampleSize is how many product IDs the currency report
+// lists per currency
+const currencyReportSampleSize = 20
+
+// ScoreProductQuality scores ingested products for data quality. The
+// ingestion stream calls it with the IDs it wrote.
+func (c *Controller) ScoreProductQuality(w http.ResponseWriter, r *http.Request) {
+	if c.qualityScorer == nil {
+		writeError(w, http.StatusConflict, "Data quality scoring is not available")
+		return
+	}
+
+	req, err := bindIngestedProducts(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	catalogID, err := c.resolveCatalog(r.Context(), req.CatalogID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	scored, lowQuality, err := c.qualityScorer.ScoreProducts(r.Context(), catalogID, req.ProductIDs)
+	if err != nil {
+		log.Printf("Failed to score product quality: %v", err)
+		writeServiceError(w, err, "Failed to score product quality")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.ScoreQualityResponse{
+		Scored:     scored,
+		LowQuality: lowQuality,
+	})
+}
+
+// DataQualityReport handles the aggregate data quality report endpoint
+func (c *Controller) DataQualityReport(w http.ResponseWriter, r *http.Request) {
+	report, err := c.dataQuality.QualityReport(r.Context())
+	if err != nil {
+		log.Printf("Data quality report error: %v", err)
+		writeServiceError(w, err, "Failed to build data quality report")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// CurrencyReport handles the currency data quality report endpoint
+func (c *Controller) CurrencyReport(w http.ResponseWriter, r *http.Request) {
+	report, err := c.dataQuality.CurrencyReport(r.Context(), currencyReportSampleSize)
+	if err != nil {
+		log.Printf("Currency report error: %v", err)
+		writeServiceError(w, err, "Failed to build currency report")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// errorCodes maps the HTTP statuses handlers respond with to their error
+// codes
+var errorCodes = map[int]models.ErrorCode{
+	http.StatusBadRequest:            models.ErrorInvalidArgument,
+	http.StatusUnauthorized:          models.ErrorUnauthenticated,
+	http.StatusForbidden:             models.ErrorPermissionDenied,
+	http.StatusNotFound:              models.ErrorNotFound,
+	http.StatusConflict:              models.ErrorConflict,
+	http.StatusRequestEntityTooLarge: models.ErrorPayloadTooLarge,
+	http.StatusTooManyRequests:       models.ErrorResourceExhausted,
+	http.StatusServiceUnavailable:    models.ErrorUnavailable,
+	http.StatusGatewayTimeout:        models.ErrorDeadlineExceeded,
+}
+
+// errorCode returns the error code of an HTTP status
+func errorCode(status int) models.ErrorCode {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	if status < http.StatusInternalServerError {
+		return models.ErrorInvalidArgument
+	}
+	return models.ErrorInternal
+}
+
+// writeError writes an error response with the status's error code
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeErrorDetails(w, status, message, nil)
+}
+
+// writeErrorDetails writes an error response with structured details. The
+// request ID is read back from the X-Request-Id header RequestIDMiddleware
+// set on the response.
+func writeErrorDetails(w http.ResponseWriter, status int, message string, details interface{}) {
+	writeJSON(w, status, &models.ErrorResponse{
+		Code:      errorCode(status),
+		Message:   message,
+		Details:   details,
+		RequestID: w.Header().Get(requestIDHeader),
+	})
+}
+
+// httpError is a failure mapped to the response clients see
+type httpError struct {
+	status  int
+	message string
+	details interface{}
+}
+
+// mapError translates a failure into its HTTP status and message. Request
+// validation failures are 400s with their details, missing Spanner rows
+// 404s, exhausted Spanner and Vertex AI quotas 429s, other transient
+// backend failures 503s and exhausted deadlines 504s. Anything else is a
+// 500 with the fallback message, so internal errors are not exposed.
+func mapError(err error, fallback string) httpError {
+	var badRequest *badRequestError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &badRequest):
+		return httpError{status: http.StatusBadRequest, message: badRequest.message, details: badRequest.details}
+	case errors.As(err, &tooLarge):
+		return httpError{status: http.StatusRequestEntityTooLarge, message: "request body too large"}
+	case services.IsDeadlineExceeded(err):
+		return httpError{status: http.StatusGatewayTimeout, message: "deadline exceeded"}
+	case services.IsNotFound(err):
+		return httpError{status: http.StatusNotFound, message: "not found"}
+	case services.IsQuotaExceeded(err):
+		return httpError{status: http.StatusTooManyRequests, message: "quota exceeded, retry later"}
+	case services.IsRetryable(err):
+		return httpError{status: http.StatusServiceUnavailable, message: "temporarily unavailable"}
+	}
+	return httpError{status: http.StatusInternalServerError, message: fallback}
+}
+
+// retryable reports whether the request may succeed if retried with backoff
+func (e httpError) retryable() bool {
+	switch e.status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// writeServiceError responds to a failed request with the status mapError
+// gives err. Retryable failures carry a Retry-After hint.
+func writeServiceError(w http.ResponseWriter, err error, fallback string) {
+	mapped := mapError(err, fallback)
+	if mapped.retryable() {
+		w.Header().Set("Retry-After", strconv.Itoa(defaultRetryAfterSeconds))
+	}
+	writeErrorDetails(w, mapped.status, mapped.message, mapped.details)
+}
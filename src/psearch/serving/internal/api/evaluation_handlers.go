@@ -0,0 +1,142 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// defaultEvaluationK is the rank cutoff of evaluations that set none
+const defaultEvaluationK = 10
+
+// evaluationKey marks the context of searches run by an evaluation, which
+// are kept out of query analytics and search logs so they do not skew the
+// head queries or traffic reports
+type evaluationKey struct{}
+
+// isEvaluation reports whether ctx belongs to an evaluation's search
+func isEvaluation(ctx context.Context) bool {
+	return ctx.Value(evaluationKey{}) != nil
+}
+
+// Evaluate handles scoring ranking configurations against a labeled
+// judgment set
+func (c *Controller) Evaluate(w http.ResponseWriter, r *http.Request) {
+	var req models.EvaluationRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := c.RunEvaluation(r.Context(), &req)
+	if err != nil {
+		log.Printf("Failed to run evaluation: %v", err)
+		writeServiceError(w, err, "Evaluation failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// RunEvaluation searches every judged query with every ranking
+// configuration and scores the results with NDCG, recall and MRR at the
+// request's cutoff. A failed search scores zero and is reported with its
+// query rather than failing the evaluation. It is shared by the endpoint
+// and the evaluate command.
+func (c *Controller) RunEvaluation(ctx context.Context, req *models.EvaluationRequest) (*models.EvaluationReport, error) {
+	if err := validate.Struct(req); err != nil {
+		return nil, &badRequestError{message: err.Error()}
+	}
+	configs := req.Configs
+	if len(configs) == 0 {
+		configs = []models.RankingConfig{{Name: "default"}}
+	}
+	names := make(map[string]bool, len(configs))
+	for _, ranking := range configs {
+		if names[ranking.Name] {
+			return nil, &badRequestError{message: fmt.Sprintf("configs has more than one config named %q", ranking.Name)}
+		}
+		names[ranking.Name] = true
+	}
+
+	k := cmp.Or(req.K, defaultEvaluationK)
+	ctx = context.WithValue(ctx, evaluationKey{}, true)
+	report := &models.EvaluationReport{K: k, Judgments: len(req.Judgments)}
+	for _, ranking := range configs {
+		queries := make([]models.QueryEvaluation, len(req.Judgments))
+		sem := make(chan struct{}, c.config.BatchSearchConcurrency)
+		var wg sync.WaitGroup
+
+		for i, judgment := range req.Judgments {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				ranked, err := c.evaluationSearch(ctx, ranking, judgment, k, req.CatalogID)
+				queries[i] = services.JudgedQuery(judgment, ranked, k)
+				if err != nil {
+					queries[i].Error = err.Error()
+				}
+			}()
+		}
+		wg.Wait()
+
+		report.Configs = append(report.Configs, services.SummarizeEvaluation(ranking.Name, queries))
+	}
+	return report, nil
+}
+
+// evaluationSearch runs a judged query with a ranking configuration and
+// returns the IDs of its top k results. Only reranked searches hydrate
+// their results, since reranking needs the product text.
+func (c *Controller) evaluationSearch(ctx context.Context, ranking models.RankingConfig, judgment models.Judgment, k int, catalogID string) ([]string, error) {
+	hydrate := ranking.Rerank
+	response, err := c.RunSearch(ctx, &models.SearchRequest{
+		Query:            judgment.Query,
+		Filter:           judgment.Filter,
+		Limit:            &k,
+		Mode:             ranking.Mode,
+		Alpha:            ranking.Alpha,
+		Rerank:           ranking.Rerank,
+		EmbeddingVersion: ranking.EmbeddingVersion,
+		FeatureFlags:     ranking.FeatureFlags,
+		CatalogID:        catalogID,
+		Hydrate:          &hydrate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(response.Hits)+len(response.Results))
+	for _, hit := range response.Hits {
+		ids = append(ids, hit.ID)
+	}
+	for _, result := range response.Results {
+		ids = append(ids, result.ID)
+	}
+	return ids, nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+)
+
+// RecordSearchEvents handles recording a batch of impression, click,
+// add-to-cart and purchase events
+func (c *Controller) RecordSearchEvents(w http.ResponseWriter, r *http.Request) {
+	var req models.SearchEventsRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Events) > c.config.MaxEventBatchSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d events are allowed per request", c.config.MaxEventBatchSize))
+		return
+	}
+	for i := range req.Events {
+		catalogID, err := c.resolveCatalog(r.Context(), req.Events[i].CatalogID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("events[%d]: %v", i, err))
+			return
+		}
+		req.Events[i].CatalogID = catalogID
+
+		// Clicks update the user's profile, which is bound to the caller
+		if req.Events[i].UserID != "" {
+			userID, ok := profileUser(r.Context(), req.Events[i].UserID)
+			if !ok {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("events[%d]: user_id is not the authenticated caller", i))
+				return
+			}
+			req.Events[i].UserID = userID
+		}
+
+		// Events the client did not tag get the arm the shopper's searches
+		// are assigned to now
+		if req.Events[i].Experiment == nil {
+			if experiment, _, ok := c.experiments.Assign(req.Events[i].UserID, req.Events[i].SessionID); ok {
+				req.Events[i].Experiment = &experiment
+			}
+		}
+	}
+
+	if err := c.searchEvents.Record(r.Context(), principalName(r.Context()), req.Events); err != nil {
+		log.Printf("Failed to record search events: %v", err)
+		writeServiceError(w, err, "Failed to record search events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.SearchEventsResponse{Accepted: len(req.Events)})
+}
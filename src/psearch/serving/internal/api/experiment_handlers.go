@@ -0,0 +1,123 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// PutExperiment handles creating or replacing a ranking experiment
+func (c *Controller) PutExperiment(w http.ResponseWriter, r *http.Request) {
+	var req models.ExperimentRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	experiment, err := c.experiments.Put(r.Context(), r.PathValue("id"), req)
+	if errors.Is(err, services.ErrInvalidExperiment) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save experiment: %v", err)
+		writeServiceError(w, err, "Failed to save experiment")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, experiment)
+}
+
+// ListExperiments handles listing ranking experiments
+func (c *Controller) ListExperiments(w http.ResponseWriter, r *http.Request) {
+	experiments, err := c.experiments.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list experiments: %v", err)
+		writeServiceError(w, err, "Failed to list experiments")
+		return
+	}
+	if experiments == nil {
+		experiments = []models.Experiment{}
+	}
+
+	writeJSON(w, http.StatusOK, models.ExperimentListResponse{Experiments: experiments})
+}
+
+// GetExperiment handles fetching a single ranking experiment
+func (c *Controller) GetExperiment(w http.ResponseWriter, r *http.Request) {
+	experiment, err := c.experiments.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrExperimentNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get experiment: %v", err)
+		writeServiceError(w, err, "Failed to get experiment")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, experiment)
+}
+
+// DeleteExperiment handles deleting a ranking experiment
+func (c *Controller) DeleteExperiment(w http.ResponseWriter, r *http.Request) {
+	err := c.experiments.Delete(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrExperimentNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete experiment: %v", err)
+		writeServiceError(w, err, "Failed to delete experiment")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExperimentResults handles reporting the search events of each arm of an
+// experiment
+func (c *Controller) ExperimentResults(w http.ResponseWriter, r *http.Request) {
+	var req models.ExperimentResultsOptions
+	if err := bindQuery(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var since time.Time
+	if req.Days > 0 {
+		since = time.Now().UTC().AddDate(0, 0, -req.Days)
+	}
+
+	results, err := c.experiments.Results(r.Context(), r.PathValue("id"), since)
+	if errors.Is(err, services.ErrExperimentNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read experiment results: %v", err)
+		writeServiceError(w, err, "Failed to read experiment results")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
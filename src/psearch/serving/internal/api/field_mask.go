@@ -0,0 +1,154 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"psearch/serving/internal/models"
+)
+
+// fieldMask limits the product fields in a response to the requested JSON
+// paths, e.g. "title" or "priceInfo.price". The product ID is always kept.
+// A nil mask keeps every field.
+type fieldMask map[string]fieldMask
+
+// newFieldMask parses the fields of a request, rejecting paths that are not
+// SearchResult fields
+func newFieldMask(fields []string) (fieldMask, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	mask := fieldMask{"id": nil}
+	for _, field := range fields {
+		path := strings.Split(strings.TrimSpace(field), ".")
+		if !validFieldPath(reflect.TypeOf(models.SearchResult{}), path) {
+			return nil, &badRequestError{message: fmt.Sprintf("unknown field %q in fields", field)}
+		}
+		node := mask
+		for i, name := range path {
+			child, seen := node[name]
+			if seen && child == nil {
+				// An ancestor of this path is already kept whole
+				break
+			}
+			if i == len(path)-1 {
+				node[name] = nil
+				break
+			}
+			if child == nil {
+				child = fieldMask{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return mask, nil
+}
+
+// validFieldPath reports whether path names a JSON field of t, descending
+// through pointers and slices
+func validFieldPath(t reflect.Type, path []string) bool {
+	for _, name := range path {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || name == "" {
+			return false
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if tag == name {
+				t, found = t.Field(i).Type, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the product limited to the mask's fields, or the product
+// itself when the mask is nil
+func (m fieldMask) apply(product models.SearchResult) (interface{}, error) {
+	if m == nil {
+		return product, nil
+	}
+	encoded, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, err
+	}
+	return m.prune(data), nil
+}
+
+// prune drops the fields of value outside the mask. Lists are pruned item
+// by item.
+func (m fieldMask) prune(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, child := range v {
+			sub, ok := m[name]
+			switch {
+			case !ok:
+				delete(v, name)
+			case sub != nil:
+				v[name] = sub.prune(child)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = m.prune(item)
+		}
+	}
+	return value
+}
+
+// maskSearchResponse limits the results of a search response to the mask's
+// fields, leaving the rest of the response as is
+func maskSearchResponse(response *models.SearchResponse, mask fieldMask) (interface{}, error) {
+	if mask == nil || len(response.Results) == 0 {
+		return response, nil
+	}
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &body); err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, len(response.Results))
+	for i, result := range response.Results {
+		if results[i], err = mask.apply(result); err != nil {
+			return nil, err
+		}
+	}
+	if body["results"], err = json.Marshal(results); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
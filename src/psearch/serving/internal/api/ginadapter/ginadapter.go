@@ -0,0 +1,83 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ginadapter serves the search API from a Gin engine, for servers
+// that already use Gin. The API itself only depends on net/http.
+package ginadapter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"psearch/serving/internal/api"
+	"psearch/serving/internal/config"
+)
+
+// SetupRouter registers every API route on router and returns the
+// controller so the caller can close it on shutdown
+func SetupRouter(router *gin.Engine, cfg *config.Config) (*api.Controller, error) {
+	controller, err := api.NewController(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := api.Routes(cfg, controller)
+	if err != nil {
+		controller.Close()
+		return nil, err
+	}
+
+	// Preflight requests are answered by the CORS middleware, so every
+	// path also accepts OPTIONS
+	cors := api.CORSMiddleware(cfg)
+	preflight := make(map[string]bool)
+	for _, route := range routes {
+		path := ginPath(route.Path)
+		router.Handle(route.Method, path, wrap(cors(route.Handler)))
+		if !preflight[path] {
+			preflight[path] = true
+			router.OPTIONS(path, wrap(cors(http.NotFoundHandler())))
+		}
+	}
+
+	return controller, nil
+}
+
+// ginPath converts a net/http route pattern to Gin syntax: {name}
+// parameters become :name and literal colons are escaped
+func ginPath(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = ":" + strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+			continue
+		}
+		segments[i] = strings.ReplaceAll(segment, ":", "\\:")
+	}
+	return strings.Join(segments, "/")
+}
+
+// wrap adapts an API handler to Gin, copying Gin's path parameters to the
+// request so handlers can read them with PathValue
+func wrap(h http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, param := range c.Params {
+			c.Request.SetPathValue(param.Key, param.Value)
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
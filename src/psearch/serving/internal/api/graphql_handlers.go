@@ -0,0 +1,196 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"psearch/serving/internal/graphql"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// productArgs are the arguments of the product query
+type productArgs struct {
+	ID               string   `json:"id" binding:"required"`
+	CatalogID        string   `json:"catalog_id,omitempty"`
+	StalenessSeconds *float64 `json:"staleness_seconds,omitempty"`
+	Currency         string   `json:"currency,omitempty" binding:"omitempty,len=3"`
+	Locale           string   `json:"locale,omitempty"`
+}
+
+// similarProductsArgs are the arguments of the similarProducts query
+type similarProductsArgs struct {
+	ID string `json:"id" binding:"required"`
+	models.SimilarProductsRequest
+}
+
+// newGraphQLSchema returns the root query fields served on /graphql. Their
+// arguments and result fields use the JSON names of the REST API.
+func (c *Controller) newGraphQLSchema() *graphql.Schema {
+	return &graphql.Schema{Query: map[string]graphql.ResolverFunc{
+		"search":          c.resolveSearch,
+		"product":         c.resolveProduct,
+		"similarProducts": c.resolveSimilarProducts,
+	}}
+}
+
+// GraphQL handles the GraphQL endpoint, accepting the query as a JSON body
+// or, for cacheable GETs, as query parameters
+func (c *Controller) GraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if raw := query.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				writeJSON(w, http.StatusBadRequest, graphql.Response{Errors: []*graphql.Error{{Message: "variables must be a JSON object"}}})
+				return
+			}
+		}
+	} else if err := bindJSON(r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, graphql.Response{Errors: []*graphql.Error{{Message: err.Error()}}})
+		return
+	}
+	if req.Query == "" {
+		writeJSON(w, http.StatusBadRequest, graphql.Response{Errors: []*graphql.Error{{Message: "query is required"}}})
+		return
+	}
+
+	response := c.graphql.Execute(r.Context(), req)
+	if response.Data == nil {
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// resolveSearch runs a search. When the query selects nothing from the
+// results but their ids and scores, the search skips reading product data,
+// as if hydrate were false.
+func (c *Controller) resolveSearch(ctx context.Context, args map[string]interface{}, sel graphql.Selection) (interface{}, error) {
+	var req models.SearchRequest
+	if err := graphql.DecodeArguments(args, &req); err != nil {
+		return nil, err
+	}
+
+	idsOnly := false
+	if req.Hydrate == nil && !req.Rerank && !sel.Has("hits") && selectsOnly(sel.Field("results"), "id", "score", "__typename") {
+		hydrate := false
+		req.Hydrate = &hydrate
+		idsOnly = true
+	}
+
+	response, err := c.RunSearch(ctx, &req)
+	if err != nil {
+		return nil, graphQLSearchError(err)
+	}
+
+	if idsOnly {
+		response.Results = make([]models.SearchResult, len(response.Hits))
+		for i, hit := range response.Hits {
+			response.Results[i] = models.SearchResult{ID: hit.ID, Score: hit.Score}
+		}
+		response.Hits = nil
+	}
+	return response, nil
+}
+
+// resolveProduct reads a product by id. A missing product resolves to null.
+func (c *Controller) resolveProduct(ctx context.Context, args map[string]interface{}, _ graphql.Selection) (interface{}, error) {
+	var req productArgs
+	if err := graphql.DecodeArguments(args, &req); err != nil {
+		return nil, err
+	}
+	if err := validate.Struct(&req); err != nil {
+		return nil, err
+	}
+
+	product, err := c.product(ctx, req.ID, &models.ProductRequest{
+		CatalogID:        req.CatalogID,
+		StalenessSeconds: req.StalenessSeconds,
+		Currency:         req.Currency,
+		Locale:           req.Locale,
+	})
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		return nil, nil
+	case IsBadRequest(err):
+		return nil, err
+	case err != nil:
+		log.Printf("GraphQL product lookup failed for %s: %v", req.ID, err)
+		return nil, errors.New("product lookup failed")
+	}
+	return &product, nil
+}
+
+// resolveSimilarProducts lists the products most similar to a product, in
+// the shape of the similar products endpoint
+func (c *Controller) resolveSimilarProducts(ctx context.Context, args map[string]interface{}, _ graphql.Selection) (interface{}, error) {
+	var req similarProductsArgs
+	if err := graphql.DecodeArguments(args, &req); err != nil {
+		return nil, err
+	}
+	if err := validate.Struct(&req); err != nil {
+		return nil, err
+	}
+
+	results, err := c.similarProducts(ctx, req.ID, &req.SimilarProductsRequest)
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		return nil, errors.New("product not found")
+	case IsBadRequest(err):
+		return nil, err
+	case err != nil:
+		log.Printf("GraphQL similar products error: %v", err)
+		return nil, errors.New("similar products lookup failed")
+	}
+	return &models.SimilarProductsResponse{
+		ProductID:  req.ID,
+		Results:    results,
+		TotalFound: len(results),
+	}, nil
+}
+
+// graphQLSearchError converts a search failure into the message reported
+// to clients, hiding internal errors as the search endpoint does
+func graphQLSearchError(err error) error {
+	if IsBadRequest(err) {
+		return err
+	}
+	if services.IsDeadlineExceeded(err) {
+		return errors.New("search deadline exceeded")
+	}
+	return errors.New("search failed")
+}
+
+// selectsOnly reports whether the selection contains no fields but the
+// allowed ones
+func selectsOnly(sel graphql.Selection, allowed ...string) bool {
+	for _, name := range sel.Fields() {
+		if !slices.Contains(allowed, name) {
+			return false
+		}
+	}
+	return true
+}
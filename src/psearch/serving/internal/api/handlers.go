@@ -17,93 +17,1366 @@
 package api
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/gin-gonic/gin"
-	"psearch/serving-go/internal/config"
-	"psearch/serving-go/internal/models"
-	"psearch/serving-go/internal/services"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/graphql"
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+	"psearch/serving/internal/telemetry"
+	"psearch/serving/internal/validation"
 )
 
+var tracer = otel.Tracer("psearch/serving/internal/api")
+
 // Controller handles the API endpoints and connects to services
 type Controller struct {
-	config      *config.Config
-	spannerSvc  *services.SpannerService
-	embeddingSvc *services.EmbeddingService
+	config *config.Config
+	// searcher, products, productWriter, imageSearcher and analyticsStore
+	// are the SpannerService in production and in-memory fakes in handler
+	// tests
+	searcher       services.Searcher
+	products       services.ProductStore
+	productWriter  services.ProductWriter
+	imageSearcher  services.ImageSearcher
+	analyticsStore services.AnalyticsReader
+	// caches are the cache layer owners besides the services below
+	caches []services.CacheSource
+	// closeStore releases the Spanner client; nil in test controllers
+	closeStore    func()
+	regressions   *services.RegressionDetector
+	filters       *filter.Registry
+	validator     *validation.Validator
+	runtime       *services.RuntimeConfigService
+	flags         *services.FeatureFlags
+	rerankSvc     *services.RerankService
+	savedSearches *services.SavedSearchService
+	// The ingestion callbacks; nil in test controllers unless set
+	productChanges       services.ProductChangeDetector
+	qualityScorer        services.QualityScorer
+	savedSearchEvaluator services.SavedSearchEvaluator
+	dataQuality          *services.DataQualityService
+	queryTemplates       *services.QueryTemplateService
+	scoringProfiles      *services.ScoringProfileService
+	catalogVersions      *services.CatalogVersionService
+	merchandising        *services.MerchandisingRuleService
+	experiments          *services.ExperimentService
+	configBundles        *services.ConfigBundleService
+	reembed              *services.ReembedService
+	// userProfiles is nil in test controllers unless set
+	userProfiles services.UserProfiles
+	searchEvents *services.SearchEventService
+	pricing      *services.PricingService
+	// queryUnderstanding is nil unless QUERY_UNDERSTANDING_ENABLED is set
+	queryUnderstanding *services.QueryUnderstandingService
+	queryExpansion     *services.QueryExpansionService
+	// answers is nil unless ANSWER_ENABLED is set
+	answers *services.AnswerService
+	// spelling is nil unless SPELL_CORRECTION_ENABLED is set
+	spelling *services.SpellCorrector
+	// headQueries is nil unless HEAD_QUERY_PRECOMPUTE_ENABLED is set
+	headQueries *services.HeadQueryPrecomputer
+	// recall is nil unless RECALL_MONITOR_ENABLED is set
+	recall *services.RecallMonitor
+	// tailSampler is nil unless TAIL_SAMPLING_ENABLED is set
+	tailSampler *services.TailQuerySampler
+	// images is nil unless IMAGE_SEARCH_ENABLED is set
+	images *services.ImageEmbeddingService
+	// analytics is nil unless ANALYTICS_ENABLED is set
+	analytics *services.QueryAnalytics
+	// searchLogs is nil unless SEARCH_LOGS_ENABLED is set
+	searchLogs *services.SearchLogSink
+	// refinements is nil unless REFINEMENT_ENABLED is set
+	refinements *services.RefinementService
+	// sessions is nil unless SESSION_CONTEXT_ENABLED is set
+	sessions *services.SessionService
+	// remoteCache is nil unless REDIS_ADDR is set
+	remoteCache *cache.Remote
+	readiness   *services.ReadinessChecker
+	graphql     *graphql.Schema
+
+	// cancel stops background workers started by the controller
+	cancel context.CancelFunc
 }
 
 // NewController creates a new controller instance
 func NewController(cfg *config.Config) (*Controller, error) {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 
 	// Create the embedding service
 	embeddingSvc, err := services.NewEmbeddingService(ctx, cfg)
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to create embedding service: %v", err)
 	}
 
 	// Create the Spanner service
 	spannerSvc, err := services.NewSpannerService(ctx, cfg, embeddingSvc)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	return &Controller{
-		config:      cfg,
-		spannerSvc:  spannerSvc,
-		embeddingSvc: embeddingSvc,
-	}, nil
+	// Serve the EMBEDDING_VERSIONS alongside the default embedding model
+	if err := services.RegisterEmbeddingVersions(ctx, cfg, spannerSvc); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	refinements := services.NewRefinementService(cfg)
+	sessions := services.NewSessionService(cfg, spannerSvc)
+
+	// Share the embedding and result caches, the result sets searches are
+	// refined from and session context across replicas through Redis
+	var remoteCache *cache.Remote
+	if cfg.RedisAddr != "" {
+		remoteCache = cache.NewRemote(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, cfg.RedisKeyPrefix, cfg.RedisTimeout)
+		embeddingSvc.UseRemoteCache(remoteCache)
+		spannerSvc.UseRemoteCache(remoteCache)
+		if refinements != nil {
+			refinements.UseRemoteCache(remoteCache)
+		}
+		if sessions != nil {
+			sessions.UseRemoteCache(remoteCache)
+		}
+	}
+
+	// Create the rerank service
+	rerankSvc, err := services.NewRerankService(ctx, cfg)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create rerank service: %v", err)
+	}
+
+	// Create the Pub/Sub publisher shared by alerting features
+	publisher, err := services.NewPubSubService(ctx, cfg)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create Pub/Sub service: %v", err)
+	}
+
+	// Create the Gemini client shared by LLM-backed features
+	gemini, err := services.NewGeminiClient(ctx, cfg)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+	}
+
+	filters := filter.NewRegistry(cfg.FilterableAttributes)
+
+	// Apply cache TTLs overridden at runtime to the caches
+	runtime := services.NewRuntimeConfigService(cfg, spannerSvc, func(settings *config.Config) {
+		spannerSvc.SetResultCacheTTL(settings.ResultCacheSoftTTL, settings.ResultCacheTTL)
+		embeddingSvc.SetCacheTTL(settings.EmbeddingCacheTTL)
+	})
+
+	savedSearches := services.NewSavedSearchService(cfg, spannerSvc, embeddingSvc, publisher, filters)
+	dataQuality := services.NewDataQualityService(cfg, spannerSvc)
+	userProfiles := services.NewUserProfileService(cfg, spannerSvc)
+
+	controller := &Controller{
+		config:               cfg,
+		searcher:             spannerSvc,
+		products:             spannerSvc,
+		productWriter:        spannerSvc,
+		imageSearcher:        spannerSvc,
+		analyticsStore:       spannerSvc,
+		caches:               []services.CacheSource{embeddingSvc, spannerSvc, userProfiles},
+		closeStore:           spannerSvc.Close,
+		filters:              filters,
+		validator:            validation.New(runtime.Current, filters),
+		runtime:              runtime,
+		flags:                services.NewFeatureFlags(runtime.Current),
+		rerankSvc:            rerankSvc,
+		savedSearches:        savedSearches,
+		productChanges:       services.NewProductChangeService(cfg, spannerSvc, publisher),
+		qualityScorer:        dataQuality,
+		savedSearchEvaluator: savedSearches,
+		dataQuality:          dataQuality,
+		queryTemplates:       services.NewQueryTemplateService(cfg, spannerSvc, filters),
+		scoringProfiles:      services.NewScoringProfileService(cfg, spannerSvc),
+		merchandising:        services.NewMerchandisingRuleService(cfg, spannerSvc),
+		experiments:          services.NewExperimentService(cfg, spannerSvc),
+		reembed:              services.NewReembedService(cfg, spannerSvc),
+		userProfiles:         userProfiles,
+		queryExpansion:       services.NewQueryExpansionService(cfg, gemini),
+		pricing:              services.NewPricingService(cfg),
+		refinements:          refinements,
+		sessions:             sessions,
+		remoteCache:          remoteCache,
+		cancel:               cancel,
+	}
+
+	// Redis is left out of readiness: the caches degrade to local without it
+	checks := []services.DependencyCheck{
+		{Name: "spanner", Check: spannerSvc.Ping},
+		{Name: "vertex_ai", Check: embeddingSvc.CheckCredentials},
+	}
+
+	// Hold readiness until the warm-up has run, so cold instances get no
+	// traffic before their first search is fast
+	if cfg.WarmupEnabled {
+		warmup := newWarmup(cfg, spannerSvc, embeddingSvc)
+		checks = append(checks, services.DependencyCheck{Name: "warmup", Check: warmup.Check})
+		go warmup.Run(ctx)
+	}
+	controller.readiness = services.NewReadinessChecker(cfg.ReadinessTimeout, checks...)
+
+	controller.graphql = controller.newGraphQLSchema()
+
+	controller.searchEvents = services.NewSearchEventService(cfg, spannerSvc, publisher, userProfiles, sessions)
+	controller.configBundles = services.NewConfigBundleService(spannerSvc, controller.queryTemplates, controller.scoringProfiles, controller.merchandising)
+
+	// Create the query understanding service if enabled
+	if cfg.QueryUnderstandingEnabled {
+		controller.queryUnderstanding = services.NewQueryUnderstandingService(cfg, gemini)
+	}
+
+	// Create the answer service if enabled
+	if cfg.AnswerEnabled {
+		controller.answers = services.NewAnswerService(cfg, gemini)
+	}
+
+	// Keep the runtime config overrides, scoring profiles, merchandising
+	// rules, experiments and exchange rates loaded
+	go controller.runtime.Run(ctx)
+	go controller.scoringProfiles.Run(ctx)
+	go controller.merchandising.Run(ctx)
+	go controller.experiments.Run(ctx)
+	go controller.pricing.Run(ctx)
+
+	// Re-run saved searches on a schedule if enabled
+	if cfg.SavedSearchEvaluationInterval > 0 {
+		go controller.savedSearches.Run(ctx)
+	}
+
+	// Start building the spelling dictionary if enabled
+	if cfg.SpellCorrectionEnabled {
+		controller.spelling = services.NewSpellCorrector(cfg, spannerSvc)
+		go controller.spelling.Run(ctx)
+	}
+
+	// Start head query precomputation if enabled
+	if cfg.HeadQueryPrecomputeEnabled {
+		controller.headQueries = services.NewHeadQueryPrecomputer(cfg, spannerSvc, embeddingSvc)
+		go controller.headQueries.Run(ctx)
+	}
+
+	// Start ANN recall monitoring if enabled
+	if cfg.RecallMonitorEnabled {
+		controller.recall = services.NewRecallMonitor(cfg, spannerSvc, embeddingSvc)
+		go controller.recall.Run(ctx)
+	}
+
+	// Embed shopper images if image search is enabled
+	if cfg.ImageSearchEnabled {
+		images, err := services.NewImageEmbeddingService(ctx, cfg)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to create image embedding service: %v", err)
+		}
+		controller.images = images
+	}
+
+	// Start weekly tail query sampling if enabled
+	if cfg.TailSamplingEnabled {
+		controller.tailSampler = services.NewTailQuerySampler(cfg, spannerSvc)
+		go controller.tailSampler.Run(ctx)
+	}
+
+	// Start aggregating query analytics if enabled
+	if cfg.AnalyticsEnabled {
+		controller.analytics = services.NewQueryAnalytics(cfg, spannerSvc)
+		go controller.analytics.Run(ctx)
+	}
+
+	// Start streaming search logs to BigQuery if enabled
+	if cfg.SearchLogsEnabled {
+		controller.searchLogs, err = services.NewSearchLogSink(ctx, cfg)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to create search log sink: %v", err)
+		}
+		go controller.searchLogs.Run(ctx)
+	}
+
+	// Track catalog versions so imports invalidate cached results. Head
+	// queries are recomputed and recall is rechecked for the new version.
+	controller.catalogVersions = services.NewCatalogVersionService(cfg, spannerSvc, func() {
+		controller.headQueries.Trigger()
+		controller.recall.Trigger()
+	})
+	go controller.catalogVersions.Run(ctx)
+
+	// Create the latency regression detector if enabled
+	if cfg.RegressionDetectionEnabled {
+		controller.regressions = services.NewRegressionDetector(ctx, cfg, spannerSvc, publisher)
+		go controller.regressions.Run(ctx)
+	}
+
+	return controller, nil
 }
 
-// HealthCheck handles the health check endpoint
-func (c *Controller) HealthCheck(ctx *gin.Context) {
-	ctx.JSON(http.StatusOK, models.HealthResponse{
+// newWarmup opens Spanner sessions, fetches a Vertex AI access token, and
+// runs an uncached canary embedding and search
+func newWarmup(cfg *config.Config, spannerSvc *services.SpannerService, embeddingSvc *services.EmbeddingService) *services.Warmup {
+	return services.NewWarmup(cfg.WarmupTimeout,
+		services.WarmupStep{Name: "spanner_sessions", Run: func(ctx context.Context) error {
+			return spannerSvc.WarmSessions(ctx, min(cfg.WarmupSessions, cfg.SpannerMaxSessions))
+		}},
+		services.WarmupStep{Name: "vertex_ai_token", Run: embeddingSvc.CheckCredentials},
+		services.WarmupStep{Name: "canary_embedding", Run: func(ctx context.Context) error {
+			_, err := embeddingSvc.GenerateDocumentEmbedding(ctx, cfg.WarmupQuery)
+			return err
+		}},
+		// Explain bypasses the result cache, which Redis may share with
+		// warm instances
+		services.WarmupStep{Name: "canary_search", Run: func(ctx context.Context) error {
+			_, err := spannerSvc.HybridSearch(ctx, services.SearchOptions{
+				Query:     cfg.WarmupQuery,
+				Limit:     cfg.DefaultLimit,
+				MinScore:  cfg.MinScoreValue,
+				Alpha:     cfg.DefaultAlpha,
+				CatalogID: cfg.DefaultCatalogID,
+				Staleness: cfg.SpannerStaleness,
+				Explain:   true,
+			})
+			return err
+		}},
+	)
+}
+
+// NewTestController creates a controller serving search, browse, product
+// and similar-product requests from searcher and products, without Spanner
+// or Vertex AI clients or background workers. Product edits, image search
+// and analytics are served too when products or searcher implement
+// services.ProductWriter, services.ImageSearcher or
+// services.AnalyticsReader. It is for handler tests with the fakes in
+// services/servicestest; requests needing other services, such as
+// reranking, personalization, LLM query expansion and most admin
+// endpoints, are not supported.
+func NewTestController(cfg *config.Config, searcher services.Searcher, products services.ProductStore) *Controller {
+	filters := filter.NewRegistry(cfg.FilterableAttributes)
+	runtime := services.NewRuntimeConfigService(cfg, nil, nil)
+	productWriter, _ := products.(services.ProductWriter)
+	imageSearcher, _ := searcher.(services.ImageSearcher)
+	analyticsStore, _ := searcher.(services.AnalyticsReader)
+	controller := &Controller{
+		config:          cfg,
+		searcher:        searcher,
+		products:        products,
+		productWriter:   productWriter,
+		imageSearcher:   imageSearcher,
+		analyticsStore:  analyticsStore,
+		filters:         filters,
+		validator:       validation.New(runtime.Current, filters),
+		runtime:         runtime,
+		flags:           services.NewFeatureFlags(runtime.Current),
+		scoringProfiles: services.NewScoringProfileService(cfg, nil),
+		merchandising:   services.NewMerchandisingRuleService(cfg, nil),
+		experiments:     services.NewExperimentService(cfg, nil),
+		queryExpansion:  services.NewQueryExpansionService(cfg, nil),
+		pricing:         services.NewPricingService(cfg),
+		refinements:     services.NewRefinementService(cfg),
+		readiness:       services.NewReadinessChecker(cfg.ReadinessTimeout),
+		cancel:          func() {},
+	}
+	controller.graphql = controller.newGraphQLSchema()
+	return controller
+}
+
+// Close stops background workers and releases the Spanner client. It must
+// only be called once in-flight requests have drained.
+func (c *Controller) Close() {
+	c.cancel()
+	// Write the searches counted since the last flush while Spanner is
+	// still open
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.analytics.Flush(ctx); err != nil {
+		log.Printf("Warning: could not flush query analytics: %v", err)
+	}
+	c.searchLogs.Close()
+	c.reembed.Close()
+	if c.closeStore != nil {
+		c.closeStore()
+	}
+	c.remoteCache.Close()
+}
+
+// HealthCheck handles the liveness endpoint. It only reports that the
+// process is serving requests; dependencies are checked by ReadinessCheck.
+func (c *Controller) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, models.HealthResponse{
 		Status: "healthy",
 	})
 }
 
+// ReadinessCheck handles the readiness endpoint, probing Spanner and Vertex
+// AI. It returns 503 while any dependency is failing so traffic is routed
+// to other instances.
+func (c *Controller) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	ready, dependencies := c.readiness.Check(r.Context())
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, models.ReadinessResponse{Status: "not_ready", Dependencies: dependencies})
+		return
+	}
+	writeJSON(w, http.StatusOK, models.ReadinessResponse{Status: "ready", Dependencies: dependencies})
+}
+
+// paginate returns the page of results at offset with at most limit
+// entries. Out of range offsets and limits give an empty page.
+func paginate(results []models.SearchResult, offset, limit int) []models.SearchResult {
+	if offset < 0 || offset >= len(results) {
+		return []models.SearchResult{}
+	}
+	// Compared as a count rather than offset+limit, which can overflow
+	return results[offset : offset+min(max(limit, 0), len(results)-offset)]
+}
+
+// maxReadStaleness keeps stale reads well inside Spanner's version retention
+const maxReadStaleness = time.Hour
+
+// readStaleness resolves the request's staleness override against the
+// configured default
+func (c *Controller) readStaleness(seconds *float64) (time.Duration, error) {
+	if seconds == nil {
+		return c.config.SpannerStaleness, nil
+	}
+	staleness := time.Duration(*seconds * float64(time.Second))
+	if staleness < 0 || staleness > maxReadStaleness {
+		return 0, &badRequestError{message: "staleness_seconds must be between 0 and 3600"}
+	}
+	return staleness, nil
+}
+
+// stageTimingsMs converts recorded stage durations to milliseconds
+func stageTimingsMs(timings *services.StageTimings) map[string]float64 {
+	snapshot := timings.Snapshot()
+	ms := make(map[string]float64, len(snapshot))
+	for stage, d := range snapshot {
+		ms[stage] = float64(d.Microseconds()) / 1000
+	}
+	return ms
+}
+
+// badRequestError marks request validation failures that map to HTTP 400
+type badRequestError struct {
+	message string
+	// details is optional structured context, such as a filter error position
+	details interface{}
+}
+
+func (e *badRequestError) Error() string {
+	return e.message
+}
+
+// capsError reports a request exceeding the caps the validator enforces as
+// a bad request whose details list each violation
+func capsError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &badRequestError{message: err.Error(), details: err}
+}
+
+// IsBadRequest reports whether err is a request validation failure
+func IsBadRequest(err error) bool {
+	var badRequest *badRequestError
+	return errors.As(err, &badRequest)
+}
+
+// embeddingVersionFromHeader fills in the embedding version a request did
+// not set from its X-Embedding-Version header, so clients and proxies can
+// route traffic to a model version without changing request bodies
+func embeddingVersionFromHeader(r *http.Request, version *string) {
+	if *version == "" {
+		*version = strings.TrimSpace(r.Header.Get("X-Embedding-Version"))
+	}
+}
+
+// featureFlagsFromHeader adds the overrides in the request's
+// X-Feature-Flags header, a comma-separated list of name=bool pairs, for
+// the feature flags the request body leaves out
+func featureFlagsFromHeader(r *http.Request, flags *map[string]bool) error {
+	for _, pair := range strings.Split(r.Header.Get("X-Feature-Flags"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if !ok || err != nil {
+			return fmt.Errorf("X-Feature-Flags entries must be name=bool pairs, got %q", pair)
+		}
+		if *flags == nil {
+			*flags = make(map[string]bool)
+		}
+		if _, set := (*flags)[strings.TrimSpace(name)]; !set {
+			(*flags)[strings.TrimSpace(name)] = enabled
+		}
+	}
+	return nil
+}
+
+// featureFlags resolves the feature flags a search runs with
+func (c *Controller) featureFlags(req *models.SearchRequest) (services.FlagSet, error) {
+	flags, err := c.flags.Resolve(req.FeatureFlags)
+	if err != nil {
+		return nil, &badRequestError{message: err.Error()}
+	}
+	return flags, nil
+}
+
 // Search handles the search endpoint
-func (c *Controller) Search(ctx *gin.Context) {
+func (c *Controller) Search(w http.ResponseWriter, r *http.Request) {
 	// Parse the request body
 	var req models.SearchRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	localeFromHeaders(r, &req.Currency, &req.Locale)
+	embeddingVersionFromHeader(r, &req.EmbeddingVersion)
+	if err := featureFlagsFromHeader(r, &req.FeatureFlags); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mask, err := newFieldMask(req.Fields)
+	if err != nil {
+		writeServiceError(w, err, "Search failed")
 		return
 	}
 
+	response, err := c.RunSearch(r.Context(), &req)
+	if err != nil {
+		writeServiceError(w, err, "Search failed")
+		return
+	}
+
+	// Return the results
+	body, err := maskSearchResponse(response, mask)
+	if err != nil {
+		log.Printf("Failed to apply field mask: %v", err)
+		writeServiceError(w, err, "Search failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// settings returns the configuration with the runtime overrides applied,
+// for the tunable parameters read on every request
+func (c *Controller) settings() *config.Config {
+	return c.runtime.Current()
+}
+
+// searchOptions resolves request defaults and validates the search parameters
+func (c *Controller) searchOptions(ctx context.Context, req *models.SearchRequest) (services.SearchOptions, error) {
+	settings := c.settings()
+
 	// Set default values if not provided
-	limit := c.config.DefaultLimit
+	limit := settings.DefaultLimit
 	if req.Limit != nil {
 		limit = *req.Limit
 	}
 
-	minScore := c.config.MinScoreValue
+	minScore := settings.MinScoreValue
 	if req.MinScore != nil {
 		minScore = *req.MinScore
 	}
 
-	alpha := c.config.DefaultAlpha
+	alpha := settings.DefaultAlpha
 	if req.Alpha != nil {
 		alpha = *req.Alpha
 	}
+	if alpha < 0 || alpha > 1 {
+		return services.SearchOptions{}, &badRequestError{message: "alpha must be between 0.0 and 1.0"}
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = models.SearchModeHybrid
+	}
+
+	offset := 0
+	if req.Offset != nil {
+		offset = *req.Offset
+	}
+	if offset < 0 {
+		return services.SearchOptions{}, &badRequestError{message: "offset must not be negative"}
+	}
+
+	var readTimestamp time.Time
+	if req.ConsistencyToken != "" {
+		ts, err := decodeConsistencyToken(req.ConsistencyToken, c.config.ConsistencyTokenTTL)
+		if err != nil {
+			return services.SearchOptions{}, &badRequestError{message: err.Error()}
+		}
+		readTimestamp = ts
+	}
+
+	staleness, err := c.readStaleness(req.StalenessSeconds)
+	if err != nil {
+		return services.SearchOptions{}, err
+	}
+
+	catalogID, err := c.resolveCatalog(ctx, req.CatalogID)
+	if err != nil {
+		return services.SearchOptions{}, err
+	}
+
+	filterNode, err := filter.Parse(req.Filter, c.filters)
+	if err != nil {
+		var filterErr *filter.Error
+		if errors.As(err, &filterErr) {
+			return services.SearchOptions{}, &badRequestError{message: filterErr.Error(), details: filterErr}
+		}
+		return services.SearchOptions{}, &badRequestError{message: err.Error()}
+	}
+	rangeNode, err := c.rangeFilter(req)
+	if err != nil {
+		return services.SearchOptions{}, &badRequestError{message: err.Error()}
+	}
+	filterNode = filter.Conjoin(filterNode, rangeNode)
+
+	if req.RefineFrom != "" {
+		if c.refinements == nil {
+			return services.SearchOptions{}, &badRequestError{message: "refine_from is not enabled in this deployment"}
+		}
+		ids, ok := c.refinements.Load(req.RefineFrom)
+		if !ok {
+			return services.SearchOptions{}, &badRequestError{message: "refine_from is unknown or has expired, rerun the search it came from"}
+		}
+		filterNode = filter.Conjoin(filterNode, &filter.IDs{IDs: ids})
+	}
+
+	if req.UserID != "" && len(req.UserEmbedding) > 0 {
+		return services.SearchOptions{}, &badRequestError{message: "set user_id or user_embedding, not both"}
+	}
+	if len(req.UserEmbedding) > 0 && len(req.UserEmbedding) != c.config.EmbeddingDimension {
+		return services.SearchOptions{}, &badRequestError{message: fmt.Sprintf("user_embedding must have %d dimensions", c.config.EmbeddingDimension)}
+	}
+	personalizationWeight := c.config.PersonalizationWeight
+	if req.PersonalizationWeight != nil {
+		personalizationWeight = *req.PersonalizationWeight
+	}
+
+	var ann services.ANNParams
+	if req.Advanced != nil {
+		ann = services.ANNParams{
+			NumLeavesToSearch:   req.Advanced.NumLeavesToSearch,
+			CandidateMultiplier: req.Advanced.CandidateMultiplier,
+			DistanceMetric:      req.Advanced.DistanceMetric,
+		}
+		// Only the baseline cosine index and the deployment's own metric's
+		// index are known to exist
+		if ann.DistanceMetric == services.DistanceDotProduct && c.config.ANNDistanceMetric != services.DistanceDotProduct {
+			return services.SearchOptions{}, &badRequestError{message: "distance_metric dot_product is not enabled in this deployment"}
+		}
+	}
+
+	var keyword services.KeywordParams
+	if req.Keyword != nil {
+		if _, err := config.MinimumShouldMatch(req.Keyword.MinimumShouldMatch, 1); err != nil {
+			return services.SearchOptions{}, &badRequestError{message: err.Error()}
+		}
+		keyword = services.KeywordParams{
+			Dialect:            req.Keyword.Dialect,
+			MinimumShouldMatch: req.Keyword.MinimumShouldMatch,
+			PhraseMatching:     req.Keyword.PhraseMatching,
+			EnhanceQuery:       req.Keyword.EnhanceQuery,
+		}
+	}
+
+	language := req.Language
+	if language == "" && settings.LanguageDetectionEnabled {
+		language = services.DetectLanguage(req.Query)
+	}
+
+	embeddingVersion := cmp.Or(req.EmbeddingVersion, c.config.ServingEmbeddingVersion)
+	if _, ok := c.config.EmbeddingVersion(embeddingVersion); !ok {
+		return services.SearchOptions{}, &badRequestError{message: fmt.Sprintf("unknown embedding_version %q", embeddingVersion)}
+	}
+
+	local, err := c.localSearch(req)
+	if err != nil {
+		return services.SearchOptions{}, err
+	}
+
+	idsOnly := req.Hydrate != nil && !*req.Hydrate
+	if idsOnly && req.Rerank {
+		return services.SearchOptions{}, &badRequestError{message: "rerank requires hydrated results"}
+	}
+	if idsOnly && len(req.Boosts) > 0 {
+		return services.SearchOptions{}, &badRequestError{message: "boosts require hydrated results"}
+	}
+
+	// Score adjustments have no effect on results sorted by a field
+	if req.SortBy != "" && req.SortBy != models.SearchSortRelevance {
+		switch {
+		case req.Rerank:
+			return services.SearchOptions{}, &badRequestError{message: "rerank requires sort_by relevance"}
+		case len(req.Boosts) > 0:
+			return services.SearchOptions{}, &badRequestError{message: "boosts require sort_by relevance"}
+		case local != nil && local.Boost:
+			return services.SearchOptions{}, &badRequestError{message: "local_availability boost requires sort_by relevance"}
+		}
+	}
+
+	return services.SearchOptions{
+		Query:         req.Query,
+		Limit:         limit,
+		Offset:        offset,
+		MinScore:      minScore,
+		Alpha:         alpha,
+		RRFK:          settings.RRFK,
+		Mode:          mode,
+		Filter:        filterNode,
+		CatalogID:     catalogID,
+		Rerank:        req.Rerank,
+		ReadTimestamp: readTimestamp,
+		Staleness:     staleness,
+		Explain:       req.Debug,
+
+		UserEmbedding:         req.UserEmbedding,
+		PersonalizationWeight: personalizationWeight,
+		IDsOnly:               idsOnly,
+		Language:              language,
+		ANN:                   ann,
+		Keyword:               keyword,
+		EmbeddingVersion:      embeddingVersion,
+		Local:                 local,
+		Sort:                  req.SortBy,
+	}, nil
+}
+
+// localSearch resolves the request's shopper location or store into a
+// local availability search, or nil when it names neither
+func (c *Controller) localSearch(req *models.SearchRequest) (*services.LocalSearch, error) {
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return nil, &badRequestError{message: "latitude and longitude must be set together"}
+	}
+	if req.Latitude == nil && req.StoreID == "" {
+		if req.RadiusKm != nil || req.LocalAvailability != "" {
+			return nil, &badRequestError{message: "radius_km and local_availability require latitude and longitude or store_id"}
+		}
+		return nil, nil
+	}
+
+	local := &services.LocalSearch{
+		StoreID:  req.StoreID,
+		RadiusKm: c.config.LocalRadiusKm,
+		Boost:    req.LocalAvailability == models.LocalAvailabilityBoost,
+	}
+	if req.Latitude != nil {
+		local.Location = &services.GeoPoint{Latitude: *req.Latitude, Longitude: *req.Longitude}
+	}
+	if req.RadiusKm != nil {
+		local.RadiusKm = *req.RadiusKm
+	}
+	return local, nil
+}
+
+// rangeFilter converts the request's price bounds and numeric ranges into a
+// filter. Ranges are applied in field name order so identical requests bind
+// identical parameters and share result cache entries.
+func (c *Controller) rangeFilter(req *models.SearchRequest) (filter.Node, error) {
+	node, err := filter.NewRange(c.filters, "price", req.MinPrice, req.MaxPrice)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(req.Ranges)) {
+		bounds := req.Ranges[name]
+		rangeNode, err := filter.NewRange(c.filters, name, bounds.Min, bounds.Max)
+		if err != nil {
+			return nil, err
+		}
+		node = filter.Conjoin(node, rangeNode)
+	}
+	return node, nil
+}
+
+// RunSearch executes a single search request. It is shared by the search
+// endpoints and the embeddable Searcher; validation failures are reported
+// as errors for which IsBadRequest is true.
+func (c *Controller) RunSearch(ctx context.Context, req *models.SearchRequest) (*models.SearchResponse, error) {
+	if err := validate.Struct(req); err != nil {
+		return nil, &badRequestError{message: err.Error()}
+	}
+	if err := capsError(c.validator.Search(req)); err != nil {
+		return nil, err
+	}
+	flags, err := c.featureFlags(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Follow-ups like "cheaper ones" search the session's previous query,
+	// narrowed, with its filter and price bounds unless the request sets
+	// its own. Sessions are the caller's, whatever session_id it sends.
+	session := c.sessions.Get(principalName(ctx), req.SessionID)
+	var resolvedQuery string
+	if session != nil && len(session.Queries) > 0 {
+		if followUp, ok := services.ResolveFollowUp(session.Queries[len(session.Queries)-1], req.Query); ok {
+			resolved := *req
+			resolved.Query = followUp.Query
+			resolved.Filter = cmp.Or(req.Filter, followUp.Filter)
+			if req.MinPrice == nil && req.MaxPrice == nil {
+				resolved.MinPrice, resolved.MaxPrice = followUp.MinPrice, followUp.MaxPrice
+			}
+			req, resolvedQuery = &resolved, followUp.Query
+		}
+	}
 
-	log.Printf("Search request: query=%s, limit=%d, minScore=%.2f, alpha=%.2f", 
-		req.Query, limit, minScore, alpha)
+	currency, err := c.checkCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
 
-	// Perform the hybrid search
-	results, err := c.spannerSvc.HybridSearch(ctx, req.Query, limit, minScore, alpha)
+	opts, err := c.searchOptions(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Search request: query=%s, mode=%s, limit=%d, minScore=%.2f, alpha=%.2f",
+		opts.Query, opts.Mode, opts.Limit, opts.MinScore, opts.Alpha)
+
+	reqCtx, span := tracer.Start(ctx, "Controller.Search",
+		trace.WithAttributes(
+			attribute.String("search.query_hash", telemetry.HashQuery(opts.Query)),
+			attribute.String("search.mode", string(opts.Mode)),
+			attribute.Int("search.limit", opts.Limit),
+			attribute.Float64("search.alpha", opts.Alpha),
+		))
+	defer span.End()
+
+	// Record per-stage timings for regression detection
+	timings := services.NewStageTimings()
+	reqCtx = services.ContextWithStageTimings(reqCtx, timings)
+	var cost *services.CostRecorder
+	if req.Debug {
+		cost = services.NewCostRecorder()
+		reqCtx = services.ContextWithCostRecorder(reqCtx, cost)
+	}
+	start := time.Now()
+
+	// SKU-like queries are looked up exactly before anything embeds or
+	// rewrites them. Misses continue as a regular search.
+	if c.settings().SKUDetectionEnabled && services.IsIdentifierQuery(opts.Query, c.config.SKUPattern) {
+		if output := c.identifierSearch(reqCtx, opts); output != nil {
+			results := paginate(output.Results, opts.Offset, opts.Limit)
+			response := &models.SearchResponse{
+				Results:          results,
+				TotalFound:       len(results),
+				ConsistencyToken: encodeConsistencyToken(output.ReadTimestamp),
+				RefinementToken:  c.refinementToken(results),
+				ExactMatch:       true,
+			}
+			if req.Debug {
+				response.Debug = &models.SearchDebug{
+					StageTimingsMs: stageTimingsMs(timings),
+					Cost:           cost.Snapshot(),
+					FeatureFlags:   flags,
+				}
+			}
+			if opts.IDsOnly {
+				response.Results, response.Hits = nil, searchHits(results)
+			} else {
+				response.Results = c.localizeResults(results, currency, req.Locale)
+			}
+			span.SetAttributes(attribute.Bool("search.exact_match", true), attribute.Int("search.result_count", len(results)))
+			if !isEvaluation(ctx) {
+				c.analytics.Record(req.Query, len(results), time.Since(start))
+			}
+			return response, nil
+		}
+	}
+
+	// Degradations are reported to the client rather than hidden
+	var warnings searchWarnings
+
+	// Personalize the vector branch with the user's learned preferences.
+	// Users without a profile yet get unpersonalized results, and callers
+	// cannot search with another user's profile.
+	if req.UserID != "" && c.userProfiles != nil && opts.Mode != models.SearchModeKeyword && opts.PersonalizationWeight > 0 {
+		var embedding []float32
+		userID, ok := profileUser(reqCtx, req.UserID)
+		if !ok {
+			log.Printf("Searching unpersonalized: user_id %q is not the authenticated caller", req.UserID)
+			warnings.add(models.WarningPersonalizationSkipped)
+		} else if embedding, err = c.userProfiles.Embedding(reqCtx, userID); err != nil {
+			log.Printf("Failed to read user profile, searching unpersonalized: %v", err)
+			span.RecordError(err)
+			warnings.add(models.WarningPersonalizationSkipped)
+		}
+		opts.UserEmbedding = embedding
+		span.SetAttributes(attribute.Bool("search.personalized", embedding != nil))
+	}
+
+	// Shoppers without a profile are personalized with what they clicked
+	// earlier in the session
+	if session != nil && len(session.ClickEmbedding) > 0 && opts.UserEmbedding == nil && opts.Mode != models.SearchModeKeyword {
+		weight := c.config.SessionPersonalizationWeight
+		if req.PersonalizationWeight != nil {
+			weight = *req.PersonalizationWeight
+		}
+		if weight > 0 {
+			opts.UserEmbedding, opts.PersonalizationWeight = session.ClickEmbedding, weight
+			span.SetAttributes(attribute.Bool("search.session_personalized", true))
+		}
+	}
+
+	// Apply extracted intent on top of any explicit filter. Failures only
+	// cost the extra latency; the raw query is still searched.
+	var interpretation *models.QueryIntent
+	if c.queryUnderstanding != nil && flags.Enabled(config.FlagQueryRewriting) {
+		intent, err := c.queryUnderstanding.Understand(reqCtx, opts.Query)
+		if err != nil {
+			log.Printf("Query understanding failed, searching raw query: %v", err)
+			span.RecordError(err)
+			warnings.add(models.WarningQueryUnderstandingFailed)
+		} else {
+			interpretation = intent
+			if intent.NormalizedQuery != "" {
+				opts.Query = intent.NormalizedQuery
+			}
+			opts.Filter = filter.Conjoin(opts.Filter, services.IntentFilter(intent, c.filters))
+		}
+	}
+
+	// Category defaults fill in the fusion parameters the request left
+	// unset. An explicit category wins over the detected one.
+	category := req.Category
+	if category == "" && interpretation != nil && len(interpretation.Categories) > 0 {
+		category = interpretation.Categories[0]
+	}
+	var scoringProfile string
+	if profile, ok := c.scoringProfiles.Match(category); ok {
+		applyScoringProfile(&opts, req, profile)
+		scoringProfile = profile.Category
+		span.SetAttributes(attribute.String("search.scoring_profile", scoringProfile))
+	}
+
+	// Experiment arms override the scoring profile, but not what the
+	// request set itself
+	experiment, arm, inExperiment := c.experiments.Assign(req.UserID, req.SessionID)
+	if inExperiment {
+		applyExperimentArm(&opts, req, arm)
+		if _, ok := c.config.EmbeddingVersion(opts.EmbeddingVersion); !ok {
+			log.Printf("Experiment %s arm %s uses unknown embedding version %q, using %s", experiment.ID, experiment.Arm, opts.EmbeddingVersion, c.config.ServingEmbeddingVersion)
+			opts.EmbeddingVersion = c.config.ServingEmbeddingVersion
+		}
+		span.SetAttributes(
+			attribute.String("search.experiment", experiment.ID),
+			attribute.String("search.experiment_arm", experiment.Arm),
+		)
+	}
+	// Whoever asked for reranking, the flag has the last word
+	if !flags.Enabled(config.FlagRerank) {
+		opts.Rerank = false
+	}
+
+	var correctedQuery string
+	if c.spelling != nil {
+		correctedQuery = c.spelling.Correct(reqCtx, opts.Query)
+	}
+
+	// Expansions only help the vector branch
+	if req.ExpandQuery && opts.Mode != models.SearchModeKeyword && flags.Enabled(config.FlagQueryRewriting) {
+		opts.Expansions = c.queryExpansion.Expand(reqCtx, opts.Query)
+		span.SetAttributes(attribute.Int("search.expansion_count", len(opts.Expansions)))
+	}
+
+	// Long queries lose detail in a single embedding, so each of their
+	// phrases is also searched
+	if c.settings().MultiQueryEnabled && opts.Mode != models.SearchModeKeyword {
+		opts.SubQueries = c.queryExpansion.Decompose(opts.Query)
+		span.SetAttributes(attribute.Int("search.sub_query_count", len(opts.SubQueries)))
+	}
+
+	// Merchandising rules match what the shopper typed. They rank results,
+	// so searches sorted by a field skip them.
+	var rules []models.MerchandisingRule
+	if opts.Sort == "" || opts.Sort == models.SearchSortRelevance {
+		rules = c.merchandising.Match(req.Query, category)
+	}
+
+	// Unhydrated results carry no URI or GTIN to deduplicate by, nor
+	// attributes to facet
+	dedupe := c.settings().DedupeResultsEnabled && !opts.IDsOnly
+	facets := req.Facets && !opts.IDsOnly
+	// Nor brands to diversify by; sorted results keep their sort order
+	diversify := flags.Enabled(config.FlagDiversification) && !opts.IDsOnly && (opts.Sort == "" || opts.Sort == models.SearchSortRelevance)
+
+	// When boosting, reranking, applying rules, deduplicating, diversifying
+	// or faceting, retrieve a full candidate pool from the first result so
+	// every page is cut from the same reordered list
+	searchOpts := opts
+	localBoost := opts.Local != nil && opts.Local.Boost
+	reorder := len(req.Boosts) > 0 || opts.Rerank || len(rules) > 0 || dedupe || diversify || facets || localBoost
+	if reorder {
+		searchOpts.Offset = 0
+		searchOpts.Limit = opts.Offset + opts.Limit
+	}
+	if dedupe {
+		searchOpts.Limit *= c.config.DedupeOverfetch
+	}
+	if opts.Rerank {
+		searchOpts.Limit = max(searchOpts.Limit, c.config.RerankTopN)
+	}
+	if facets {
+		searchOpts.Limit = max(searchOpts.Limit, c.config.FacetCandidates)
+	}
+
+	// Perform the search
+	output, err := c.searcher.HybridSearch(reqCtx, searchOpts)
 	if err != nil {
 		log.Printf("Search error: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
-		return
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "search failed")
+		return nil, err
 	}
 
-	// Return the results
-	ctx.JSON(http.StatusOK, models.SearchResponse{
-		Results:    results,
-		TotalFound: len(results),
+	// Typos are the main cause of empty results, so retry with the
+	// correction. Expansions and sub-queries were derived from the
+	// misspelled query.
+	autoCorrected := false
+	if len(output.Results) == 0 && correctedQuery != "" {
+		retryOpts := searchOpts
+		retryOpts.Query, retryOpts.Expansions, retryOpts.SubQueries = correctedQuery, nil, nil
+		corrected, err := c.searcher.HybridSearch(reqCtx, retryOpts)
+		if err != nil {
+			log.Printf("Corrected search error, returning original results: %v", err)
+			span.RecordError(err)
+		} else {
+			output, autoCorrected = corrected, true
+			opts.Query, opts.Expansions, opts.SubQueries = correctedQuery, nil, nil
+		}
+		span.SetAttributes(attribute.Bool("search.auto_corrected", autoCorrected))
+	}
+
+	// Request boosts adjust the fused scores, so a reranker still orders
+	// its top candidates by relevance alone
+	var queryBoosts map[string][]models.AppliedBoost
+	output.Results, queryBoosts = services.ApplyBoosts(output.Results, req.Boosts)
+	if localBoost {
+		var localBoosts map[string][]models.AppliedBoost
+		output.Results, localBoosts = services.ApplyLocalBoost(output.Results, c.config.LocalBoostWeight, opts.Local.RadiusKm)
+		if queryBoosts == nil {
+			queryBoosts = make(map[string][]models.AppliedBoost)
+		}
+		for id, boosts := range localBoosts {
+			queryBoosts[id] = append(queryBoosts[id], boosts...)
+		}
+	}
+
+	if opts.Rerank {
+		reranked, err := c.rerankSvc.Rerank(reqCtx, opts.Query, output.Results)
+		if err != nil {
+			// Fall back to the fused order rather than failing the search
+			log.Printf("Rerank failed, returning fused order: %v", err)
+			span.RecordError(err)
+			warnings.add(models.WarningRerankFailed)
+		} else {
+			output.Results = reranked
+		}
+	}
+
+	// Brands are spread over the relevance order, before pins take their
+	// positions
+	if diversify {
+		output.Results = services.DiversifyResults(output.Results, c.config.DiversificationMaxPerBrand)
+	}
+
+	// Rules apply after fusion and reranking, so pins and boosts are final
+	var ruleTraces []models.RuleTrace
+	if len(rules) > 0 {
+		// A failed fetch only skips the pins of products not retrieved
+		pinned, err := c.pinnedProducts(reqCtx, opts, rules, output.Results)
+		if err != nil {
+			log.Printf("Failed to fetch pinned products, skipping their pins: %v", err)
+			span.RecordError(err)
+			warnings.add(models.WarningPinsSkipped)
+		}
+		output.Results, ruleTraces = services.ApplyRules(output.Results, rules, pinned)
+		span.SetAttributes(attribute.Int("search.rule_count", len(rules)))
+	}
+	// Deduplicate the final order so pinned listings win over their copies
+	if dedupe {
+		retrieved := len(output.Results)
+		output.Results = services.DedupeResults(output.Results)
+		span.SetAttributes(attribute.Int("search.duplicates_dropped", retrieved-len(output.Results)))
+	}
+	// Facets count the whole candidate pool, so every page shows the same
+	var resultFacets []models.Facet
+	if facets {
+		resultFacets = services.ComputeFacets(output.Results, c.config.FacetMaxFacets, c.config.FacetMaxValues, c.config.FacetMinCount)
+	}
+	if reorder {
+		output.Results = paginate(output.Results, opts.Offset, opts.Limit)
+	}
+	span.SetAttributes(attribute.Int("search.result_count", len(output.Results)))
+
+	if c.regressions != nil {
+		c.regressions.Observe(services.QueryClass(opts), time.Since(start), timings)
+	}
+
+	response := &models.SearchResponse{
+		Results:          output.Results,
+		TotalFound:       len(output.Results),
+		ConsistencyToken: encodeConsistencyToken(output.ReadTimestamp),
+		RefinementToken:  c.refinementToken(output.Results),
+		Interpretation:   interpretation,
+		Fallback:         output.Fallback,
+		CorrectedQuery:   correctedQuery,
+		AutoCorrected:    autoCorrected,
+		ResolvedQuery:    resolvedQuery,
+		Language:         opts.Language,
+		Facets:           resultFacets,
+	}
+	if opts.Mode != models.SearchModeKeyword {
+		response.EmbeddingVersion = opts.EmbeddingVersion
+	}
+	warnings.addOutput(output)
+	response.Warnings = warnings
+	if req.IncludeRawScores {
+		response.Results = withRawScores(output.Results, output.RawScores)
+	}
+	if req.Debug {
+		response.Debug = &models.SearchDebug{
+			StageTimingsMs:  stageTimingsMs(timings),
+			Cost:            cost.Snapshot(),
+			QueryExpansions: opts.Expansions,
+			SubQueries:      opts.SubQueries,
+			Scores:          explainScores(output.Results, output.RawScores, queryBoosts, ruleTraces),
+			ScoringProfile:  scoringProfile,
+			Rules:           ruleTraces,
+			SQL:             output.Statement,
+			FeatureFlags:    flags,
+		}
+	}
+	if !isEvaluation(ctx) {
+		c.analytics.Record(req.Query, len(output.Results), time.Since(start))
+		c.searchLogs.Log(searchLog(req, opts, response, start, experiment))
+	}
+	if inExperiment {
+		response.Experiment = &experiment
+		metrics.ExperimentSearches.WithLabelValues(experiment.ID, experiment.Arm, strconv.FormatBool(len(output.Results) > 0)).Inc()
+		metrics.ObserveSince(metrics.ExperimentSearchDuration.WithLabelValues(experiment.ID, experiment.Arm), start)
+	}
+	// Prices are read before they are converted to the requested currency
+	c.sessions.RecordSearch(principalName(ctx), req.SessionID, services.SessionQuery{
+		Query:       req.Query,
+		Filter:      req.Filter,
+		MinPrice:    req.MinPrice,
+		MaxPrice:    req.MaxPrice,
+		MedianPrice: services.MedianPrice(response.Results),
 	})
+	if opts.IDsOnly {
+		response.Results, response.Hits = nil, searchHits(response.Results)
+	} else {
+		response.Results = c.localizeResults(response.Results, currency, req.Locale)
+	}
+	return response, nil
+}
+
+// searchLog records a served search for the search log sink. The
+// experiment is empty when the search was in none.
+func searchLog(req *models.SearchRequest, opts services.SearchOptions, response *models.SearchResponse, start time.Time, experiment models.ExperimentAssignment) services.SearchLog {
+	entry := services.SearchLog{
+		Timestamp:     start.UTC(),
+		Query:         req.Query,
+		Mode:          string(opts.Mode),
+		Filter:        req.Filter,
+		CatalogID:     opts.CatalogID,
+		LatencyMs:     float64(time.Since(start).Microseconds()) / 1000,
+		ResultIDs:     make([]string, len(response.Results)),
+		Scores:        make([]float64, len(response.Results)),
+		Fallback:      response.Fallback,
+		ExperimentID:  experiment.ID,
+		ExperimentArm: experiment.Arm,
+	}
+	for i, result := range response.Results {
+		entry.ResultIDs[i] = result.ID
+		entry.Scores[i] = result.Score["hybrid"]
+	}
+	return entry
+}
+
+// searchHits reduces results to their IDs and scores
+func searchHits(results []models.SearchResult) []models.SearchHit {
+	hits := make([]models.SearchHit, len(results))
+	for i, result := range results {
+		hits[i] = models.SearchHit{ID: result.ID, Score: result.Score}
+	}
+	return hits
+}
+
+// identifierSearch looks a SKU-like query up by exact identifier. It returns
+// nil when nothing matched or the lookup failed, so the search falls back
+// to the hybrid path.
+func (c *Controller) identifierSearch(ctx context.Context, opts services.SearchOptions) *services.SearchOutput {
+	output, err := c.searcher.IdentifierSearch(ctx, opts)
+	switch {
+	case err != nil:
+		log.Printf("Identifier lookup failed, falling back to hybrid search: %v", err)
+		trace.SpanFromContext(ctx).RecordError(err)
+		metrics.IdentifierLookups.WithLabelValues("error").Inc()
+		return nil
+	case len(output.Results) == 0:
+		metrics.IdentifierLookups.WithLabelValues("miss").Inc()
+		return nil
+	default:
+		metrics.IdentifierLookups.WithLabelValues("hit").Inc()
+		return output
+	}
+}
+
+// refinementToken saves the IDs of results for later searches to refine
+// from. It returns "" when refinement is disabled or there are no results.
+func (c *Controller) refinementToken(results []models.SearchResult) string {
+	if c.refinements == nil || len(results) == 0 {
+		return ""
+	}
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return c.refinements.Save(ids)
+}
+
+// pinnedProducts fetches the products the rules pin, for pins of products
+// retrieval did not return
+func (c *Controller) pinnedProducts(ctx context.Context, opts services.SearchOptions, rules []models.MerchandisingRule, results []models.SearchResult) (map[string]models.SearchResult, error) {
+	ids := slices.DeleteFunc(services.PinnedProductIDs(rules), func(id string) bool {
+		return slices.ContainsFunc(results, func(r models.SearchResult) bool { return r.ID == id })
+	})
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	products, err := c.products.GetProductsBatch(ctx, opts.CatalogID, ids, opts.Staleness)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := make(map[string]models.SearchResult, len(products))
+	for id, productData := range products {
+		result, err := c.products.TransformProduct(id, productData)
+		if err != nil {
+			log.Printf("Warning: could not transform pinned product %s: %v", id, err)
+			continue
+		}
+		result.Score = map[string]float64{"pinned": 1}
+		pinned[id] = result
+	}
+	return pinned, nil
+}
+
+// applyScoringProfile sets the profile's defaults on opts for the fusion
+// parameters the request did not set itself
+func applyScoringProfile(opts *services.SearchOptions, req *models.SearchRequest, profile models.ScoringProfile) {
+	if req.Alpha == nil && profile.Alpha != nil {
+		opts.Alpha = *profile.Alpha
+	}
+	if req.MinScore == nil && profile.MinScore != nil {
+		opts.MinScore = *profile.MinScore
+	}
+	if req.Mode == "" && profile.Mode != "" {
+		opts.Mode = profile.Mode
+	}
+}
+
+// applyExperimentArm sets the arm's ranking configuration on opts for the
+// parameters the request did not set itself. Unhydrated searches are never
+// reranked.
+func applyExperimentArm(opts *services.SearchOptions, req *models.SearchRequest, arm models.ExperimentArm) {
+	if req.Alpha == nil && arm.Alpha != nil {
+		opts.Alpha = *arm.Alpha
+	}
+	if !req.Rerank && arm.Rerank != nil {
+		opts.Rerank = *arm.Rerank && !opts.IDsOnly
+	}
+	if arm.RRFK != nil {
+		opts.RRFK = *arm.RRFK
+	}
+	if req.EmbeddingVersion == "" && arm.EmbeddingVersion != nil {
+		opts.EmbeddingVersion = *arm.EmbeddingVersion
+	}
+}
+
+// withRawScores returns copies of the results with the raw branch scores
+// added to each score map. Results may be shared with the result cache, so
+// their maps are never modified in place.
+func withRawScores(results []models.SearchResult, rawScores map[string]models.ResultScores) []models.SearchResult {
+	scored := make([]models.SearchResult, len(results))
+	for i, result := range results {
+		score := make(map[string]float64, len(result.Score)+2)
+		for name, value := range result.Score {
+			score[name] = value
+		}
+		if raw, ok := rawScores[result.ID]; ok {
+			if raw.FTSScore != nil {
+				score["fts"] = *raw.FTSScore
+			}
+			if raw.ANNDistance != nil {
+				score["ann_distance"] = *raw.ANNDistance
+			}
+		}
+		result.Score = score
+		scored[i] = result
+	}
+	return scored
+}
+
+// explainScores lists the raw branch scores of the results in result order,
+// along with the request boosts and merchandising rules that moved each one. Pinned products
+// that retrieval did not return only carry their pin.
+func explainScores(results []models.SearchResult, rawScores map[string]models.ResultScores, queryBoosts map[string][]models.AppliedBoost, traces []models.RuleTrace) []models.ResultScores {
+	ruleBoosts := make(map[string][]models.AppliedBoost)
+	for id, boosts := range queryBoosts {
+		ruleBoosts[id] = slices.Clone(boosts)
+	}
+	for _, trace := range traces {
+		for _, id := range trace.Boosted {
+			ruleBoosts[id] = append(ruleBoosts[id], models.AppliedBoost{Type: models.BoostRuleBoost, RuleID: trace.RuleID})
+		}
+		for _, id := range trace.Buried {
+			ruleBoosts[id] = append(ruleBoosts[id], models.AppliedBoost{Type: models.BoostRuleBury, RuleID: trace.RuleID})
+		}
+		for _, pin := range trace.Pinned {
+			ruleBoosts[pin.ProductID] = append(ruleBoosts[pin.ProductID], models.AppliedBoost{Type: models.BoostRulePin, RuleID: trace.RuleID, Position: pin.Position})
+		}
+	}
+
+	explained := make([]models.ResultScores, 0, len(results))
+	for _, result := range results {
+		raw, ok := rawScores[result.ID]
+		if !ok && ruleBoosts[result.ID] == nil {
+			continue
+		}
+		if !ok {
+			raw = models.ResultScores{ProductID: result.ID}
+		}
+		raw.Boosts = slices.Concat(raw.Boosts, ruleBoosts[result.ID])
+		explained = append(explained, raw)
+	}
+	return explained
 }
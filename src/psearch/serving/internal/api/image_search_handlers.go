@@ -0,0 +1,184 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// ImageSearch handles searching for the products that look most like an
+// image, uploaded or stored in Cloud Storage
+func (c *Controller) ImageSearch(w http.ResponseWriter, r *http.Request) {
+	if c.images == nil || c.imageSearcher == nil {
+		writeError(w, http.StatusConflict, "Image search is not enabled")
+		return
+	}
+
+	var req models.ImageSearchRequest
+	image, err := c.bindImageSearch(w, r, &req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("images are limited to %d bytes", c.config.ImageSearchMaxBytes))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	localeFromHeaders(r, &req.Currency, &req.Locale)
+
+	results, err := c.imageSearch(r.Context(), image, &req)
+	var badRequest *badRequestError
+	if errors.As(err, &badRequest) {
+		writeErrorDetails(w, http.StatusBadRequest, badRequest.message, badRequest.details)
+		return
+	}
+	if err != nil {
+		log.Printf("Image search error: %v", err)
+		writeServiceError(w, err, "Image search failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &models.ImageSearchResponse{
+		Results:    results,
+		TotalFound: len(results),
+	})
+}
+
+// bindImageSearch reads an image search request and its image, from a
+// multipart/form-data upload or a JSON body
+func (c *Controller) bindImageSearch(w http.ResponseWriter, r *http.Request, req *models.ImageSearchRequest) (services.ImageInput, error) {
+	// Base64 inflates images in JSON bodies by a third
+	r.Body = http.MaxBytesReader(w, r.Body, c.config.ImageSearchMaxBytes*4/3+64<<10)
+
+	var image services.ImageInput
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(c.config.ImageSearchMaxBytes); err != nil {
+			return image, err
+		}
+		if err := decodeForm(url.Values(r.MultipartForm.Value), req); err != nil {
+			return image, err
+		}
+		if err := validate.Struct(req); err != nil {
+			return image, err
+		}
+		file, _, err := r.FormFile("image")
+		switch {
+		case err == nil:
+			defer file.Close()
+			if image.Bytes, err = io.ReadAll(file); err != nil {
+				return image, err
+			}
+		case !errors.Is(err, http.ErrMissingFile):
+			return image, err
+		}
+	} else {
+		if err := bindJSON(r, req); err != nil {
+			return image, err
+		}
+		if req.ImageBase64 != "" {
+			data, err := base64.StdEncoding.DecodeString(req.ImageBase64)
+			if err != nil {
+				return image, fmt.Errorf("image_base64 is not valid base64: %v", err)
+			}
+			image.Bytes = data
+		}
+	}
+
+	image.GCSURI = req.GCSURI
+	switch {
+	case len(image.Bytes) > 0 && image.GCSURI != "":
+		return image, fmt.Errorf("send an image or gcs_uri, not both")
+	case len(image.Bytes) == 0 && image.GCSURI == "":
+		return image, fmt.Errorf("an image or gcs_uri is required")
+	case image.GCSURI != "" && !strings.HasPrefix(image.GCSURI, "gs://"):
+		return image, fmt.Errorf("gcs_uri must be a gs:// URI")
+	case int64(len(image.Bytes)) > c.config.ImageSearchMaxBytes:
+		return image, &http.MaxBytesError{Limit: c.config.ImageSearchMaxBytes}
+	}
+	return image, nil
+}
+
+// imageSearch embeds the image and looks up the products with the nearest
+// image embeddings
+func (c *Controller) imageSearch(ctx context.Context, image services.ImageInput, req *models.ImageSearchRequest) ([]models.SearchResult, error) {
+	if err := capsError(c.validator.ImageSearch(req)); err != nil {
+		return nil, err
+	}
+	currency, err := c.checkCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	catalogID, err := c.resolveCatalog(ctx, req.CatalogID)
+	if err != nil {
+		return nil, err
+	}
+
+	filterNode, err := filter.Parse(req.Filter, c.filters)
+	if err != nil {
+		badRequest := &badRequestError{message: err.Error()}
+		var filterErr *filter.Error
+		if errors.As(err, &filterErr) {
+			badRequest.details = filterErr
+		}
+		return nil, badRequest
+	}
+
+	embedding, err := c.images.EmbedImage(ctx, image)
+	if err != nil {
+		// Vertex AI rejects images it cannot decode, and URIs it cannot read
+		var apiErr *services.EmbeddingAPIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+			return nil, &badRequestError{message: "the image could not be embedded: " + apiErr.Message}
+		}
+		return nil, fmt.Errorf("failed to embed image: %w", err)
+	}
+
+	opts := services.ImageSearchOptions{
+		Embedding: embedding,
+		Limit:     c.settings().DefaultLimit,
+		Filter:    filterNode,
+		Staleness: c.config.SpannerStaleness,
+		CatalogID: catalogID,
+	}
+	if req.Limit != nil {
+		opts.Limit = *req.Limit
+	}
+
+	results, err := c.imageSearcher.ImageSearch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+	return c.localizeResults(results, currency, req.Locale), nil
+}
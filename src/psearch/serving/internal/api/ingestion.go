@@ -0,0 +1,58 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"psearch/serving/internal/models"
+)
+
+// pubSubPushEnvelope is the body Pub/Sub push subscriptions deliver
+type pubSubPushEnvelope struct {
+	Message struct {
+		Data []byte `json:"data"`
+	} `json:"message"`
+}
+
+// bindIngestedProducts reads the product IDs written by the ingestion
+// stream. The body is either the request itself or a Pub/Sub push envelope
+// whose message data is the request, so the ingestion topic can push
+// straight to the endpoint.
+func bindIngestedProducts(r *http.Request) (*models.IngestedProductsRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope pubSubPushEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	if len(envelope.Message.Data) > 0 {
+		body = envelope.Message.Data
+	}
+
+	var req models.IngestedProductsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid ingestion message: %v", err)
+	}
+	return &req, nil
+}
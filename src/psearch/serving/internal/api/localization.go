@@ -0,0 +1,82 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// localeFromHeaders fills in the currency and locale a request did not set
+// from its Accept-Currency and Accept-Language headers, taking the first
+// listed value of each
+func localeFromHeaders(r *http.Request, currency, locale *string) {
+	if *currency == "" {
+		*currency = firstHeaderValue(r.Header.Get("Accept-Currency"))
+	}
+	if *locale == "" {
+		*locale = firstHeaderValue(r.Header.Get("Accept-Language"))
+	}
+}
+
+// firstHeaderValue returns the first entry of a list header such as
+// "de-DE,de;q=0.9", without its parameters. The wildcard counts as unset.
+func firstHeaderValue(header string) string {
+	value, _, _ := strings.Cut(header, ",")
+	value, _, _ = strings.Cut(value, ";")
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return ""
+	}
+	return value
+}
+
+// checkCurrency validates a requested currency, returning it upper-cased.
+// An empty currency keeps each product's own.
+func (c *Controller) checkCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(currency)
+	if currency != "" && !c.pricing.Supports(currency) {
+		return "", &badRequestError{message: fmt.Sprintf("unsupported currency %q", currency)}
+	}
+	return currency, nil
+}
+
+// localizeResults prepares results for a response in the requested currency
+// and locale: it swaps in each product's translated text, converts and
+// formats prices, and drops the stored translations. results may be shared
+// with the result cache, so they are copied rather than modified.
+func (c *Controller) localizeResults(results []models.SearchResult, currency, locale string) []models.SearchResult {
+	translated := slices.ContainsFunc(results, func(result models.SearchResult) bool {
+		return result.Localizations != nil
+	})
+	if currency == "" && locale == "" && !translated {
+		return results
+	}
+	results = slices.Clone(results)
+	for i := range results {
+		services.LocalizeProduct(&results[i], locale)
+		if currency != "" || locale != "" {
+			c.pricing.Localize(&results[i].PriceInfo, currency, locale)
+		}
+	}
+	return results
+}
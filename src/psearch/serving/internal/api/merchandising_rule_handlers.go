@@ -0,0 +1,95 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// PutMerchandisingRule handles creating or replacing a merchandising rule
+func (c *Controller) PutMerchandisingRule(w http.ResponseWriter, r *http.Request) {
+	var req models.MerchandisingRuleRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule, err := c.merchandising.Put(r.Context(), r.PathValue("id"), req)
+	if errors.Is(err, services.ErrInvalidMerchandisingRule) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save merchandising rule: %v", err)
+		writeServiceError(w, err, "Failed to save merchandising rule")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// ListMerchandisingRules handles listing merchandising rules
+func (c *Controller) ListMerchandisingRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := c.merchandising.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list merchandising rules: %v", err)
+		writeServiceError(w, err, "Failed to list merchandising rules")
+		return
+	}
+	if rules == nil {
+		rules = []models.MerchandisingRule{}
+	}
+
+	writeJSON(w, http.StatusOK, models.MerchandisingRuleListResponse{Rules: rules})
+}
+
+// GetMerchandisingRule handles fetching a single merchandising rule
+func (c *Controller) GetMerchandisingRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := c.merchandising.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrMerchandisingRuleNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get merchandising rule: %v", err)
+		writeServiceError(w, err, "Failed to get merchandising rule")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// DeleteMerchandisingRule handles deleting a merchandising rule
+func (c *Controller) DeleteMerchandisingRule(w http.ResponseWriter, r *http.Request) {
+	err := c.merchandising.Delete(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrMerchandisingRuleNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete merchandising rule: %v", err)
+		writeServiceError(w, err, "Failed to delete merchandising rule")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -17,32 +17,397 @@
 package api
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"log"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/services"
+	"psearch/serving/internal/telemetry"
 )
 
-// LoggerMiddleware is a Gin middleware that logs the request details
-func LoggerMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Start timer
-		start := time.Now()
-
-		// Process request
-		c.Next()
-
-		// Calculate execution time
-		duration := time.Since(start)
-
-		// Log request details
-		log.Printf(
-			"[%s] %s %s %d %s",
-			c.Request.Method,
-			c.Request.URL.Path,
-			c.ClientIP(),
-			c.Writer.Status(),
-			duration,
-		)
+// Middleware wraps a handler with cross-cutting behavior
+type Middleware func(http.Handler) http.Handler
+
+// chain applies middleware to h so that the first one listed runs first
+func chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// recordStatus wraps w to capture the response status, reusing a recorder
+// installed by an outer middleware
+func recordStatus(w http.ResponseWriter) *statusRecorder {
+	if recorder, ok := w.(*statusRecorder); ok {
+		return recorder
+	}
+	return &statusRecorder{ResponseWriter: w}
+}
+
+// requestStateKey is the context key for requestState
+type requestStateKey struct{}
+
+// requestState carries values set by inner middleware, such as the
+// authenticated caller, back out to the middleware that log them
+type requestState struct {
+	principal *Principal
+	tenant    string
+}
+
+// withRequestState returns r with a requestState attached, reusing one
+// attached by an outer middleware
+func withRequestState(r *http.Request) (*http.Request, *requestState) {
+	if state, ok := r.Context().Value(requestStateKey{}).(*requestState); ok {
+		return r, state
+	}
+	state := &requestState{}
+	return r.WithContext(context.WithValue(r.Context(), requestStateKey{}, state)), state
+}
+
+// RecoveryMiddleware turns a handler panic into a 500 error response, and
+// logs the panic with its stack and the request ID. It must be the
+// outermost middleware so it also covers the others. Responses already
+// under way are cut off, as net/http would.
+func RecoveryMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := recordStatus(w)
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				log.Printf("Panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, w.Header().Get(requestIDHeader), err, debug.Stack())
+				if recorder.status != 0 {
+					panic(http.ErrAbortHandler)
+				}
+				writeError(recorder, http.StatusInternalServerError, "internal server error")
+			}()
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// requestIDHeader carries the request ID, set by the caller or generated
+const requestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds caller-supplied request IDs, which are logged
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware echoes the caller's X-Request-Id, or a generated ID,
+// in the response header, where the logs and error responses read it
+func RequestIDMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if id == "" || len(id) > maxRequestIDLength || strings.ContainsFunc(id, func(c rune) bool { return c <= ' ' || c > '~' }) {
+				id = rand.Text()
+			}
+			w.Header().Set(requestIDHeader, id)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TracingMiddleware starts a server span for each request to route,
+// continuing the caller's trace when one is propagated
+func TracingMiddleware(route string) Middleware {
+	tracer := otel.Tracer(telemetry.ServiceName)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", route),
+					attribute.String("url.path", r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			recorder := recordStatus(w)
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			status := recorder.Status()
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
+
+// LoggerMiddleware logs the request details
+func LoggerMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Start timer
+			start := time.Now()
+
+			// Process request
+			r, _ = withRequestState(r)
+			recorder := recordStatus(w)
+			next.ServeHTTP(recorder, r)
+
+			// Calculate execution time
+			duration := time.Since(start)
+
+			// Identify the caller when the request was authenticated
+			caller := "-"
+			if principal, ok := principalFromContext(r.Context()); ok {
+				caller = principal.String()
+			}
+
+			// Log request details
+			log.Printf(
+				"[%s] %s %s %s %d %s %s",
+				r.Method,
+				r.URL.Path,
+				clientIP(r),
+				caller,
+				recorder.Status(),
+				duration,
+				w.Header().Get(requestIDHeader),
+			)
+		})
+	}
+}
+
+// MetricsMiddleware records request counts and latency for route on
+// /metrics. Routes are labelled by template rather than raw path to bound
+// cardinality.
+func MetricsMiddleware(route string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			recorder := recordStatus(w)
+			next.ServeHTTP(recorder, r)
+
+			metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(recorder.Status())).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// RequestTagMiddleware tags the Spanner requests made while serving route,
+// so query statistics can be broken down by endpoint
+func RequestTagMiddleware(route string) Middleware {
+	tag := "route=" + route
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(services.ContextWithRequestTag(r.Context(), tag)))
+		})
+	}
+}
+
+// Tenant labels for SLI metrics of requests that are not scoped to one
+// catalog from CATALOG_IDS
+const (
+	defaultTenant   = "default"
+	multipleTenants = "multiple"
+)
+
+// SLIMiddleware records availability and latency SLIs for route as
+// good/total counters, the shape Cloud Monitoring request-based SLOs and
+// their burn-rate alerts consume. A request is available unless it fails
+// with a server error, and fast if it completes within threshold; latency
+// is only judged for available requests. Requests are attributed to the
+// catalog their handler resolved.
+func SLIMiddleware(route string, threshold time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r, state := withRequestState(r)
+
+			recorder := recordStatus(w)
+			next.ServeHTTP(recorder, r)
+
+			tenant := state.tenant
+			if tenant == "" {
+				tenant = defaultTenant
+			}
+			available := recorder.Status() < http.StatusInternalServerError
+			metrics.SLIAvailability.WithLabelValues(r.Method, route, tenant, strconv.FormatBool(available)).Inc()
+			if available {
+				fast := time.Since(start) <= threshold
+				metrics.SLILatency.WithLabelValues(r.Method, route, tenant, strconv.FormatBool(fast)).Inc()
+			}
+		})
+	}
+}
+
+// TimeoutMiddleware bounds each request's context by timeout so slow
+// backends cannot hold a request until the client gives up. Zero disables
+// the deadline.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// PriorityClass groups endpoints that share a concurrency pool
+type PriorityClass string
+
+// Endpoint priority classes. Interactive shopper traffic is high priority,
+// admin endpoints medium, and exports and batch jobs low.
+const (
+	PriorityHigh   PriorityClass = "high"
+	PriorityMedium PriorityClass = "medium"
+	PriorityLow    PriorityClass = "low"
+)
+
+// ConcurrencyMiddleware serves at most limit requests of class at once.
+// Requests arriving while the pool is full wait up to wait for a slot and
+// are then rejected with 503. All routes of a class must share one
+// middleware, and zero limit disables it.
+func ConcurrencyMiddleware(class PriorityClass, limit int, wait time.Duration) Middleware {
+	if limit <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	slots := make(chan struct{}, limit)
+	inFlight := metrics.InFlightRequests.WithLabelValues(string(class))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				timer := time.NewTimer(wait)
+				defer timer.Stop()
+				select {
+				case slots <- struct{}{}:
+				case <-timer.C:
+					metrics.ShedRequests.WithLabelValues(string(class)).Inc()
+					w.Header().Set("Retry-After", "1")
+					writeError(w, http.StatusServiceUnavailable, "too many concurrent "+string(class)+" priority requests")
+					return
+				case <-r.Context().Done():
+					writeError(w, http.StatusServiceUnavailable, r.Context().Err().Error())
+					return
+				}
+			}
+			inFlight.Inc()
+			defer func() {
+				<-slots
+				inFlight.Dec()
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsExposeHeaders are the response headers cross-origin callers may read
+const corsExposeHeaders = "Content-Length, Retry-After, X-Request-Id"
+
+// CORSMiddleware applies the configured CORS policy. Requests from allowed
+// origins get the CORS headers, and preflight requests are answered
+// directly, with 403 for origins or methods outside the policy. It must wrap
+// the whole router.
+func CORSMiddleware(cfg *config.Config) Middleware {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			requestMethod := r.Header.Get("Access-Control-Request-Method")
+			preflight := r.Method == http.MethodOptions && requestMethod != ""
+			allowed, anyOrigin := matchOrigin(cfg.AllowedOrigins, origin)
+			if !allowed {
+				if preflight {
+					writeError(w, http.StatusForbidden, "origin not allowed")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Browsers reject credentials with a wildcard origin
+			if anyOrigin {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if preflight {
+				if !slices.Contains(cfg.AllowedMethods, requestMethod) {
+					writeError(w, http.StatusForbidden, "method not allowed")
+					return
+				}
+				header.Set("Access-Control-Allow-Methods", methods)
+				header.Set("Access-Control-Allow-Headers", headers)
+				header.Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			header.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matchOrigin reports whether origin is allowed by the patterns, and
+// whether it is only allowed by "*"
+func matchOrigin(patterns []string, origin string) (allowed bool, anyOrigin bool) {
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*":
+			anyOrigin = true
+		case strings.EqualFold(pattern, origin):
+			return true, false
+		case strings.Contains(pattern, "://*."):
+			scheme, domain, _ := strings.Cut(pattern, "://*.")
+			if strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+domain) {
+				return true, false
+			}
+		}
+	}
+	return anyOrigin, anyOrigin
+}
+
+// AdminAuthMiddleware requires the configured admin API key in X-API-Key
+func AdminAuthMiddleware(apiKey string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := r.Header.Get("X-API-Key")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+				writeError(w, http.StatusUnauthorized, "invalid or missing API key")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
 	}
 }
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"psearch/serving/internal/models"
+)
+
+func TestPaginate(t *testing.T) {
+	results := make([]models.SearchResult, 5)
+	for i := range results {
+		results[i].ID = fmt.Sprint(i)
+	}
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          int
+	}{
+		{"first page", 0, 2, 2},
+		{"last page", 4, 2, 1},
+		{"past the end", 5, 2, 0},
+		{"negative limit", 1, -1, 0},
+		{"negative offset", -1, 2, 0},
+		{"overflowing end", 1, math.MaxInt, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paginate(results, tt.offset, tt.limit); len(got) != tt.want {
+				t.Errorf("paginate(%d, %d) returned %d results, want %d", tt.offset, tt.limit, len(got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+)
+
+// DetectProductChanges compares ingested products with their change history
+// and emits price drop and back-in-stock events. The ingestion stream calls
+// it with the IDs it wrote.
+func (c *Controller) DetectProductChanges(w http.ResponseWriter, r *http.Request) {
+	if c.productChanges == nil {
+		writeError(w, http.StatusConflict, "Product change detection is not available")
+		return
+	}
+
+	req, err := bindIngestedProducts(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	catalogID, err := c.resolveCatalog(r.Context(), req.CatalogID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// New product data can change head query results
+	c.headQueries.Trigger()
+
+	events, err := c.productChanges.DetectChanges(r.Context(), catalogID, req.ProductIDs)
+	if err != nil {
+		log.Printf("Failed to detect product changes: %v", err)
+		writeServiceError(w, err, "Failed to detect product changes")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.DetectProductChangesResponse{
+		Checked: len(req.ProductIDs),
+		Events:  len(events),
+	})
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// GetProduct handles fetching a single product by ID, for product detail
+// pages
+func (c *Controller) GetProduct(w http.ResponseWriter, r *http.Request) {
+	var req models.ProductRequest
+	if err := bindQuery(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	localeFromHeaders(r, &req.Currency, &req.Locale)
+
+	var fields []string
+	if req.Fields != "" {
+		fields = strings.Split(req.Fields, ",")
+	}
+	mask, err := newFieldMask(fields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productID := r.PathValue("id")
+	product, err := c.product(r.Context(), productID, &req)
+	if IsBadRequest(err) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrProductNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Get product %s failed: %v", productID, err)
+		writeServiceError(w, err, "Failed to get product")
+		return
+	}
+
+	body, err := mask.apply(product)
+	if err != nil {
+		log.Printf("Failed to apply field mask to product %s: %v", productID, err)
+		writeServiceError(w, err, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// DeleteProduct handles deleting a product, or soft-deleting it with
+// soft=true so it stops surfacing but can be restored
+func (c *Controller) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	if c.productWriter == nil {
+		writeError(w, http.StatusConflict, "Product edits are not available")
+		return
+	}
+
+	var req models.DeleteProductRequest
+	if err := bindQuery(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	catalogID, err := c.resolveCatalog(r.Context(), req.CatalogID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productID := r.PathValue("id")
+	err = c.productWriter.DeleteProduct(r.Context(), catalogID, productID, req.Soft)
+	if errors.Is(err, services.ErrProductNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete product: %v", err)
+		writeServiceError(w, err, "Failed to delete product")
+		return
+	}
+
+	log.Printf("Deleted product %s (soft=%t)", productID, req.Soft)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateProduct handles partially updating a product with a JSON merge
+// patch of its product data
+func (c *Controller) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	if c.productWriter == nil {
+		writeError(w, http.StatusConflict, "Product edits are not available")
+		return
+	}
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		writeError(w, http.StatusBadRequest, "the body must be a JSON merge patch object")
+		return
+	}
+	catalogID, err := c.resolveCatalog(r.Context(), r.URL.Query().Get("catalog_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	update, err := c.productWriter.UpdateProduct(r.Context(), catalogID, r.PathValue("id"), patch)
+	if errors.Is(err, services.ErrInvalidProductPatch) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrProductNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update product: %v", err)
+		writeServiceError(w, err, "Failed to update product")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.ProductUpdateResponse{
+		Product:    update.Product,
+		Reembedded: update.Reembedded,
+	})
+}
+
+// RestoreProduct handles restoring a soft-deleted product
+func (c *Controller) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	if c.productWriter == nil {
+		writeError(w, http.StatusConflict, "Product edits are not available")
+		return
+	}
+
+	catalogID, err := c.resolveCatalog(r.Context(), r.URL.Query().Get("catalog_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productID := r.PathValue("id")
+	err = c.productWriter.RestoreProduct(r.Context(), catalogID, productID)
+	if errors.Is(err, services.ErrProductNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to restore product: %v", err)
+		writeServiceError(w, err, "Failed to restore product")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// product reads a product by ID in the requested catalog, with its prices
+// localized, returning services.ErrProductNotFound if it does not exist
+// there. It is shared by the REST and GraphQL endpoints; req.Fields is
+// applied by the caller.
+func (c *Controller) product(ctx context.Context, productID string, req *models.ProductRequest) (models.SearchResult, error) {
+	staleness, err := c.readStaleness(req.StalenessSeconds)
+	if err != nil {
+		return models.SearchResult{}, err
+	}
+	currency, err := c.checkCurrency(req.Currency)
+	if err != nil {
+		return models.SearchResult{}, err
+	}
+	catalogID, err := c.resolveCatalog(ctx, req.CatalogID)
+	if err != nil {
+		return models.SearchResult{}, err
+	}
+
+	products, err := c.products.GetProductsBatch(ctx, catalogID, []string{productID}, staleness)
+	if err != nil {
+		return models.SearchResult{}, err
+	}
+	productData, found := products[productID]
+	if !found {
+		return models.SearchResult{}, services.ErrProductNotFound
+	}
+	product, err := c.products.TransformProduct(productID, productData)
+	if err != nil {
+		return models.SearchResult{}, err
+	}
+	return c.localizeResults([]models.SearchResult{product}, currency, req.Locale)[0], nil
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services/servicestest"
+)
+
+// newProductTestController serves products p1 and p2 from catalog us and
+// p3 from catalog eu
+func newProductTestController() (*Controller, *servicestest.Store) {
+	cfg := &config.Config{
+		DefaultLimit:            10,
+		MaxResultLimit:          100,
+		MaxResultOffset:         1000,
+		MaxQueryLength:          1024,
+		MaxFilterConditions:     20,
+		CatalogIDs:              []string{"us", "eu"},
+		DefaultCatalogID:        "us",
+		ServingEmbeddingVersion: config.DefaultEmbeddingVersion,
+	}
+	store := servicestest.NewStore()
+	store.Add("us",
+		models.SearchResult{ID: "p1", Title: "Trail running shoes", Description: "Grippy soles"},
+		models.SearchResult{ID: "p2", Title: "Rain jacket"},
+	)
+	store.Add("eu", models.SearchResult{ID: "p3", Title: "Running socks"})
+	return NewTestController(cfg, store, store), store
+}
+
+// serveProduct runs handler for a request to /products/{id}
+func serveProduct(handler http.HandlerFunc, method, id, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/products/"+id+query, strings.NewReader(body))
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestUpdateProduct(t *testing.T) {
+	c, _ := newProductTestController()
+
+	rec := serveProduct(c.UpdateProduct, http.MethodPatch, "p1", "", `{"description": "Extra grippy soles", "availability": "OUT_OF_STOCK"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp models.ProductUpdateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Product.Description != "Extra grippy soles" || resp.Product.Availability != "OUT_OF_STOCK" || !resp.Reembedded {
+		t.Errorf("response = %+v, want the patched product, re-embedded", resp)
+	}
+
+	rec = serveProduct(c.GetProduct, http.MethodGet, "p1", "", "")
+	if !strings.Contains(rec.Body.String(), "Extra grippy soles") {
+		t.Errorf("GetProduct after update = %s, want the patched description", rec.Body)
+	}
+}
+
+func TestUpdateProductErrors(t *testing.T) {
+	c, _ := newProductTestController()
+
+	tests := []struct {
+		name  string
+		id    string
+		query string
+		body  string
+		want  int
+	}{
+		{name: "not a merge patch", id: "p1", body: `[1]`, want: http.StatusBadRequest},
+		{name: "id change", id: "p1", body: `{"id": "p9"}`, want: http.StatusBadRequest},
+		{name: "missing product", id: "p9", body: `{"title": "x"}`, want: http.StatusNotFound},
+		{name: "other catalog", id: "p3", body: `{"title": "x"}`, want: http.StatusNotFound},
+		{name: "unknown catalog", id: "p1", query: "?catalog_id=jp", body: `{"title": "x"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveProduct(c.UpdateProduct, http.MethodPatch, tt.id, tt.query, tt.body)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestDeleteAndRestoreProduct(t *testing.T) {
+	c, _ := newProductTestController()
+
+	if rec := serveProduct(c.DeleteProduct, http.MethodDelete, "p1", "?soft=true", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("soft delete status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if rec := serveProduct(c.GetProduct, http.MethodGet, "p1", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GetProduct after soft delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := serveProduct(c.RestoreProduct, http.MethodPost, "p1", "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("restore status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if rec := serveProduct(c.GetProduct, http.MethodGet, "p1", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("GetProduct after restore status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if rec := serveProduct(c.DeleteProduct, http.MethodDelete, "p1", "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("hard delete status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if rec := serveProduct(c.RestoreProduct, http.MethodPost, "p1", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("restore after hard delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDeleteProductInOtherCatalog(t *testing.T) {
+	c, _ := newProductTestController()
+
+	if rec := serveProduct(c.DeleteProduct, http.MethodDelete, "p3", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := serveProduct(c.GetProduct, http.MethodGet, "p3", "?catalog_id=eu", ""); rec.Code != http.StatusOK {
+		t.Errorf("GetProduct in its own catalog status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestTestControllerUnsupportedEndpoints(t *testing.T) {
+	c, _ := newProductTestController()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{name: "cache stats", handler: c.CacheStats, want: http.StatusOK},
+		{name: "query analytics", handler: c.QueryAnalytics, want: http.StatusConflict},
+		{name: "relevance samples", handler: c.ListRelevanceSamples, want: http.StatusConflict},
+		{name: "image search", handler: c.ImageSearch, want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
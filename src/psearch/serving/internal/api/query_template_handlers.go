@@ -0,0 +1,154 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// PutQueryTemplate handles creating or replacing a query template
+func (c *Controller) PutQueryTemplate(w http.ResponseWriter, r *http.Request) {
+	var req models.QueryTemplateRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	template, err := c.queryTemplates.Put(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		var filterErr *filter.Error
+		if errors.As(err, &filterErr) {
+			writeErrorDetails(w, http.StatusBadRequest, filterErr.Error(), filterErr)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidQueryTemplate) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("Failed to save query template: %v", err)
+		writeServiceError(w, err, "Failed to save query template")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, template)
+}
+
+// ListQueryTemplates handles listing query templates
+func (c *Controller) ListQueryTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := c.queryTemplates.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list query templates: %v", err)
+		writeServiceError(w, err, "Failed to list query templates")
+		return
+	}
+	if templates == nil {
+		templates = []models.QueryTemplate{}
+	}
+
+	writeJSON(w, http.StatusOK, models.QueryTemplateListResponse{Templates: templates})
+}
+
+// GetQueryTemplate handles fetching a single query template
+func (c *Controller) GetQueryTemplate(w http.ResponseWriter, r *http.Request) {
+	template, err := c.queryTemplates.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrQueryTemplateNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get query template: %v", err)
+		writeServiceError(w, err, "Failed to get query template")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, template)
+}
+
+// DeleteQueryTemplate handles deleting a query template
+func (c *Controller) DeleteQueryTemplate(w http.ResponseWriter, r *http.Request) {
+	err := c.queryTemplates.Delete(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrQueryTemplateNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete query template: %v", err)
+		writeServiceError(w, err, "Failed to delete query template")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SearchQueryTemplate handles running a query template with parameters.
+// Rendered searches go through the regular search path, so identical
+// invocations share the result cache.
+func (c *Controller) SearchQueryTemplate(w http.ResponseWriter, r *http.Request) {
+	// The body is optional when every parameter has a default
+	var req models.QueryTemplateSearchRequest
+	if err := bindJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	template, err := c.queryTemplates.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrQueryTemplateNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get query template: %v", err)
+		writeServiceError(w, err, "Failed to get query template")
+		return
+	}
+
+	search, err := c.queryTemplates.Render(template, req.Params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Limit != nil {
+		search.Limit = req.Limit
+	}
+	if req.Offset != nil {
+		search.Offset = req.Offset
+	}
+	if req.ConsistencyToken != "" {
+		search.ConsistencyToken = req.ConsistencyToken
+	}
+	if req.CatalogID != "" {
+		search.CatalogID = req.CatalogID
+	}
+	if search.Query == "" {
+		writeError(w, http.StatusBadRequest, "rendered query is empty")
+		return
+	}
+
+	response, err := c.RunSearch(r.Context(), search)
+	if err != nil {
+		writeServiceError(w, err, "Search failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// StartReembedJob handles starting a job that re-embeds the catalog into a
+// shadow embedding column. The job runs in the background; its progress is
+// polled with GetReembedJob.
+func (c *Controller) StartReembedJob(w http.ResponseWriter, r *http.Request) {
+	var req models.ReembedRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := c.reembed.Start(r.Context(), req)
+	if errors.Is(err, services.ErrInvalidReembedJob) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrReembedJobRunning) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to start re-embedding job: %v", err)
+		writeServiceError(w, err, "Failed to start re-embedding job")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// ListReembedJobs handles listing re-embedding jobs
+func (c *Controller) ListReembedJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := c.reembed.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list re-embedding jobs: %v", err)
+		writeServiceError(w, err, "Failed to list re-embedding jobs")
+		return
+	}
+	if jobs == nil {
+		jobs = []models.ReembedJob{}
+	}
+
+	writeJSON(w, http.StatusOK, models.ReembedJobListResponse{Jobs: jobs})
+}
+
+// GetReembedJob handles reporting the progress of a re-embedding job
+func (c *Controller) GetReembedJob(w http.ResponseWriter, r *http.Request) {
+	job, err := c.reembed.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrReembedJobNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get re-embedding job: %v", err)
+		writeServiceError(w, err, "Failed to get re-embedding job")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// CancelReembedJob handles stopping a running re-embedding job
+func (c *Controller) CancelReembedJob(w http.ResponseWriter, r *http.Request) {
+	job, err := c.reembed.Cancel(r.Context(), r.PathValue("id"))
+	if errors.Is(err, services.ErrReembedJobNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to cancel re-embedding job: %v", err)
+		writeServiceError(w, err, "Failed to cancel re-embedding job")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
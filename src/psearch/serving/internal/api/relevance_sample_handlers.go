@@ -0,0 +1,76 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// ListRelevanceSamples handles listing a week's sampled tail queries and
+// their results, for relevance review
+func (c *Controller) ListRelevanceSamples(w http.ResponseWriter, r *http.Request) {
+	if c.analyticsStore == nil {
+		writeError(w, http.StatusConflict, "Relevance samples are not available")
+		return
+	}
+
+	var req models.RelevanceSampleListRequest
+	if err := bindQuery(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	week := req.Week
+	if week == "" {
+		week = services.SampleWeek(time.Now())
+	}
+
+	samples, err := c.analyticsStore.ListRelevanceSamples(r.Context(), week)
+	if err != nil {
+		log.Printf("Failed to list relevance samples: %v", err)
+		writeServiceError(w, err, "Failed to list relevance samples")
+		return
+	}
+	if samples == nil {
+		samples = []models.RelevanceSample{}
+	}
+
+	writeJSON(w, http.StatusOK, models.RelevanceSampleListResponse{Week: week, Samples: samples})
+}
+
+// SampleRelevanceQueries handles sampling the current week's tail queries
+// now, replacing samples already taken for the same queries
+func (c *Controller) SampleRelevanceQueries(w http.ResponseWriter, r *http.Request) {
+	if c.tailSampler == nil {
+		writeError(w, http.StatusConflict, "Tail query sampling is not enabled")
+		return
+	}
+
+	week := services.SampleWeek(time.Now())
+	samples, err := c.tailSampler.Sample(r.Context(), week)
+	if err != nil {
+		log.Printf("Failed to sample tail queries: %v", err)
+		writeServiceError(w, err, "Failed to sample tail queries")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.RelevanceSampleListResponse{Week: week, Samples: samples})
+}
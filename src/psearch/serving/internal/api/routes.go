@@ -17,33 +17,178 @@
 package api
 
 import (
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
-	"psearch/serving-go/internal/config"
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"psearch/serving/internal/config"
 )
 
-// SetupRouter configures the Gin router with all routes and middleware
-func SetupRouter(router *gin.Engine, cfg *config.Config) {
-	// Setup CORS middleware
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"}, // For production, restrict this to specific domains
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           86400, // 24 hours
-	}))
-
-	// Setup logging middleware
-	router.Use(LoggerMiddleware())
-
-	// Create controller instance
+// Route is one API endpoint. Paths use net/http pattern syntax, so path
+// parameters such as {id} are read with Request.PathValue and custom
+// methods keep their literal colon.
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.Handler
+}
+
+// Routes returns every API endpoint with its tracing, logging, metrics and
+// auth middleware applied. CORS is left to the router, which is the only
+// place that sees preflight requests.
+func Routes(cfg *config.Config, controller *Controller) ([]Route, error) {
+	authenticator, err := NewAuthenticator(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	add := func(method, path string, handler http.HandlerFunc, middleware ...Middleware) {
+		middleware = append([]Middleware{RecoveryMiddleware(), RequestIDMiddleware(), TracingMiddleware(path), LoggerMiddleware(), MetricsMiddleware(path), RequestTagMiddleware(path)}, middleware...)
+		routes = append(routes, Route{Method: method, Path: path, Handler: chain(handler, middleware...)})
+	}
+
+	// Health and metrics stay open for probes and scrapers. /health is the
+	// original liveness path, kept for existing probes.
+	add(http.MethodGet, "/healthz", controller.HealthCheck)
+	add(http.MethodGet, "/readyz", controller.ReadinessCheck)
+	add(http.MethodGet, "/health", controller.HealthCheck)
+	add(http.MethodGet, "/metrics", promhttp.Handler().ServeHTTP)
+
+	// Register API routes, authenticated when AUTH_METHODS is set. Routes
+	// that serve shoppers are bounded by the request deadline.
+	authenticate := AuthMiddleware(authenticator)
+	deadline := TimeoutMiddleware(cfg.RequestTimeout)
+
+	// Each priority class has its own concurrency pool, so exports and
+	// batch jobs cannot starve interactive search
+	high := ConcurrencyMiddleware(PriorityHigh, cfg.HighPriorityConcurrency, cfg.ConcurrencyQueueTimeout)
+	medium := ConcurrencyMiddleware(PriorityMedium, cfg.MediumPriorityConcurrency, cfg.ConcurrencyQueueTimeout)
+	low := ConcurrencyMiddleware(PriorityLow, cfg.LowPriorityConcurrency, cfg.ConcurrencyQueueTimeout)
+
+	// serve registers a shopper-facing route, which also reports SLIs
+	serve := func(method, path string, handler http.HandlerFunc) {
+		threshold := cfg.SLOLatencyThreshold
+		if override, ok := cfg.SLOLatencyThresholds[path]; ok {
+			threshold = override
+		}
+		add(method, path, handler, SLIMiddleware(path, threshold), authenticate, high, deadline)
+	}
+	serve(http.MethodPost, "/search", controller.Search)
+	serve(http.MethodPost, "/search:batch", controller.BatchSearch)
+	serve(http.MethodPost, "/search:stream", controller.StreamSearch)
+	serve(http.MethodPost, "/products:batchGet", controller.BatchGetProducts)
+	serve(http.MethodGet, "/categories/{category}/products", controller.BrowseCategory)
+	serve(http.MethodGet, "/products/{id}", controller.GetProduct)
+	serve(http.MethodGet, "/products/{id}/similar", controller.SimilarProducts)
+	serve(http.MethodPost, "/search:image", controller.ImageSearch)
+	serve(http.MethodPost, "/answer", controller.Answer)
+	serve(http.MethodPost, "/graphql", controller.GraphQL)
+	serve(http.MethodGet, "/graphql", controller.GraphQL)
+
+	// Saved searches
+	serve(http.MethodPost, "/saved-searches", controller.CreateSavedSearch)
+	serve(http.MethodGet, "/saved-searches", controller.ListSavedSearches)
+	serve(http.MethodGet, "/saved-searches/{id}", controller.GetSavedSearch)
+	serve(http.MethodDelete, "/saved-searches/{id}", controller.DeleteSavedSearch)
+
+	// Clicks teach the user profiles that personalize search; /events
+	// collects the wider shopper funnel for analytics
+	add(http.MethodPost, "/users/{user_id}/clicks", controller.RecordUserClick, authenticate, high, deadline)
+	add(http.MethodPost, "/events", controller.RecordSearchEvents, authenticate, high, deadline)
+
+	// Query templates are managed through the admin API and run by ID
+	serve(http.MethodPost, "/query-templates/{id}/search", controller.SearchQueryTemplate)
+
+	// Ingestion callbacks process whole batches, unbounded by the request
+	// deadline, and are only for the ingestion pipeline. They take a
+	// service account's Google ID token or the admin API key, and are not
+	// served when neither is configured.
+	if authenticator.acceptsServiceIdentities() || cfg.AdminAPIKey != "" {
+		service := ServiceAuthMiddleware(authenticator, cfg.AdminAPIKey)
+		add(http.MethodPost, "/products:detectChanges", controller.DetectProductChanges, service, low)
+		add(http.MethodPost, "/products:scoreQuality", controller.ScoreProductQuality, service, low)
+		add(http.MethodPost, "/saved-searches:evaluate", controller.EvaluateSavedSearches, service, low)
+	}
+
+	// Admin endpoints are only served when an admin API key is configured
+	if cfg.AdminAPIKey != "" {
+		admin := AdminAuthMiddleware(cfg.AdminAPIKey)
+		add(http.MethodGet, "/admin/cache", controller.CacheStats, admin, medium)
+		add(http.MethodPost, "/admin/cache:invalidate", controller.InvalidateCache, admin, medium)
+		add(http.MethodPatch, "/products/{id}", controller.UpdateProduct, admin, medium)
+		add(http.MethodDelete, "/products/{id}", controller.DeleteProduct, admin, medium)
+		add(http.MethodPost, "/products/{id}/restore", controller.RestoreProduct, admin, medium)
+		add(http.MethodGet, "/admin/query-templates", controller.ListQueryTemplates, admin, medium)
+		add(http.MethodGet, "/admin/query-templates/{id}", controller.GetQueryTemplate, admin, medium)
+		add(http.MethodPut, "/admin/query-templates/{id}", controller.PutQueryTemplate, admin, medium)
+		add(http.MethodDelete, "/admin/query-templates/{id}", controller.DeleteQueryTemplate, admin, medium)
+		add(http.MethodGet, "/admin/scoring-profiles", controller.ListScoringProfiles, admin, medium)
+		add(http.MethodPut, "/admin/scoring-profiles/{category}", controller.PutScoringProfile, admin, medium)
+		add(http.MethodDelete, "/admin/scoring-profiles/{category}", controller.DeleteScoringProfile, admin, medium)
+		add(http.MethodGet, "/admin/catalog-versions", controller.ListCatalogVersions, admin, medium)
+		add(http.MethodPost, "/admin/catalog-versions", controller.BumpCatalogVersion, admin, medium)
+		add(http.MethodGet, "/admin/merchandising-rules", controller.ListMerchandisingRules, admin, medium)
+		add(http.MethodGet, "/admin/merchandising-rules/{id}", controller.GetMerchandisingRule, admin, medium)
+		add(http.MethodPut, "/admin/merchandising-rules/{id}", controller.PutMerchandisingRule, admin, medium)
+		add(http.MethodDelete, "/admin/merchandising-rules/{id}", controller.DeleteMerchandisingRule, admin, medium)
+		add(http.MethodGet, "/admin/experiments", controller.ListExperiments, admin, medium)
+		add(http.MethodGet, "/admin/experiments/{id}", controller.GetExperiment, admin, medium)
+		add(http.MethodPut, "/admin/experiments/{id}", controller.PutExperiment, admin, medium)
+		add(http.MethodDelete, "/admin/experiments/{id}", controller.DeleteExperiment, admin, medium)
+		add(http.MethodGet, "/admin/experiments/{id}/results", controller.ExperimentResults, admin, low)
+		add(http.MethodGet, "/admin/config", controller.GetRuntimeConfig, admin, medium)
+		add(http.MethodPut, "/admin/config", controller.PutRuntimeConfig, admin, medium)
+		add(http.MethodGet, "/admin/config:export", controller.ExportConfig, admin, low)
+		add(http.MethodPost, "/admin/config:import", controller.ImportConfig, admin, medium)
+		add(http.MethodGet, "/admin/data-quality", controller.DataQualityReport, admin, low)
+		add(http.MethodGet, "/admin/data-quality/currency", controller.CurrencyReport, admin, low)
+		add(http.MethodGet, "/admin/relevance-samples", controller.ListRelevanceSamples, admin, medium)
+		add(http.MethodPost, "/admin/relevance-samples:sample", controller.SampleRelevanceQueries, admin, low)
+		add(http.MethodPost, "/admin/evaluations", controller.Evaluate, admin, low)
+		add(http.MethodGet, "/admin/analytics/queries", controller.QueryAnalytics, admin, low)
+		add(http.MethodGet, "/admin/reembed-jobs", controller.ListReembedJobs, admin, medium)
+		add(http.MethodPost, "/admin/reembed-jobs", controller.StartReembedJob, admin, medium)
+		add(http.MethodGet, "/admin/reembed-jobs/{id}", controller.GetReembedJob, admin, medium)
+		add(http.MethodPost, "/admin/reembed-jobs/{id}/cancel", controller.CancelReembedJob, admin, medium)
+	}
+
+	return routes, nil
+}
+
+// NewHandler creates the controller and returns the API as a plain
+// net/http handler, ready to serve directly or to mount in an existing
+// server. The caller closes the controller on shutdown.
+func NewHandler(cfg *config.Config) (http.Handler, *Controller, error) {
 	controller, err := NewController(cfg)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
+	}
+
+	handler, err := NewRouter(cfg, controller)
+	if err != nil {
+		controller.Close()
+		return nil, nil, err
+	}
+	return handler, controller, nil
+}
+
+// NewRouter serves the API routes for an existing controller
+func NewRouter(cfg *config.Config, controller *Controller) (http.Handler, error) {
+	routes, err := Routes(cfg, controller)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		mux.Handle(route.Method+" "+route.Path, route.Handler)
 	}
+	// Unknown paths are still logged and counted
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not found")
+	})
+	mux.Handle("/", chain(notFound, RecoveryMiddleware(), RequestIDMiddleware(), LoggerMiddleware(), MetricsMiddleware("unmatched")))
 
-	// Register routes
-	router.GET("/health", controller.HealthCheck)
-	router.POST("/search", controller.Search)
+	return CORSMiddleware(cfg)(mux), nil
 }
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// GetRuntimeConfig handles reading the tunable parameters in effect and
+// the runtime overrides producing them
+func (c *Controller) GetRuntimeConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.runtime.Get())
+}
+
+// PutRuntimeConfig handles replacing the runtime overrides. They apply to
+// the next request; with ?persist=true they are stored for every instance.
+func (c *Controller) PutRuntimeConfig(w http.ResponseWriter, r *http.Request) {
+	var opts models.RuntimeConfigOptions
+	if err := bindQuery(r, &opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var overrides models.RuntimeConfig
+	if err := bindJSON(r, &overrides); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response, err := c.runtime.Set(r.Context(), overrides, opts.Persist)
+	if errors.Is(err, services.ErrInvalidRuntimeConfig) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save runtime config: %v", err)
+		writeServiceError(w, err, "Failed to save runtime config")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// CreateSavedSearch handles registering a saved search
+func (c *Controller) CreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	var req models.SavedSearchRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	catalogID, err := c.resolveCatalog(r.Context(), req.CatalogID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.CatalogID = catalogID
+	req.UserID = savedSearchOwner(r)
+
+	if req.WebhookURL != "" {
+		if err := services.ValidateWebhookURL(req.WebhookURL, c.config.SavedSearchWebhookHosts); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	saved, err := c.savedSearches.Create(r.Context(), req)
+	if err != nil {
+		var filterErr *filter.Error
+		if errors.As(err, &filterErr) {
+			writeErrorDetails(w, http.StatusBadRequest, filterErr.Error(), filterErr)
+			return
+		}
+		log.Printf("Failed to create saved search: %v", err)
+		writeServiceError(w, err, "Failed to create saved search")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, saved)
+}
+
+// savedSearchOwner is the user saved searches are created for and scoped
+// to: the authenticated caller, or nobody when authentication is disabled
+func savedSearchOwner(r *http.Request) string {
+	return principalName(r.Context())
+}
+
+// ListSavedSearches handles listing the caller's saved searches
+func (c *Controller) ListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	catalogID, err := c.resolveCatalog(r.Context(), r.URL.Query().Get("catalog_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	saved, err := c.savedSearches.List(r.Context(), catalogID, savedSearchOwner(r))
+	if err != nil {
+		log.Printf("Failed to list saved searches: %v", err)
+		writeServiceError(w, err, "Failed to list saved searches")
+		return
+	}
+	if saved == nil {
+		saved = []models.SavedSearch{}
+	}
+
+	writeJSON(w, http.StatusOK, models.SavedSearchListResponse{SavedSearches: saved})
+}
+
+// GetSavedSearch handles fetching one of the caller's saved searches.
+// Those of other users or catalogs are not found.
+func (c *Controller) GetSavedSearch(w http.ResponseWriter, r *http.Request) {
+	catalogID, err := c.resolveCatalog(r.Context(), r.URL.Query().Get("catalog_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	saved, err := c.savedSearches.Get(r.Context(), catalogID, savedSearchOwner(r), r.PathValue("id"))
+	if errors.Is(err, services.ErrSavedSearchNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get saved search: %v", err)
+		writeServiceError(w, err, "Failed to get saved search")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// DeleteSavedSearch handles removing one of the caller's saved searches
+func (c *Controller) DeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	catalogID, err := c.resolveCatalog(r.Context(), r.URL.Query().Get("catalog_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = c.savedSearches.Delete(r.Context(), catalogID, savedSearchOwner(r), r.PathValue("id"))
+	if errors.Is(err, services.ErrSavedSearchNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete saved search: %v", err)
+		writeServiceError(w, err, "Failed to delete saved search")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EvaluateSavedSearches checks newly ingested products against saved
+// searches. The ingestion stream calls it with the IDs it wrote.
+func (c *Controller) EvaluateSavedSearches(w http.ResponseWriter, r *http.Request) {
+	if c.savedSearchEvaluator == nil {
+		writeError(w, http.StatusConflict, "Saved search evaluation is not available")
+		return
+	}
+
+	req, err := bindIngestedProducts(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	catalogID, err := c.resolveCatalog(r.Context(), req.CatalogID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	notifications, err := c.savedSearchEvaluator.EvaluateProducts(r.Context(), catalogID, req.ProductIDs)
+	if err != nil {
+		log.Printf("Failed to evaluate saved searches: %v", err)
+		writeServiceError(w, err, "Failed to evaluate saved searches")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.EvaluateSavedSearchesResponse{
+		Evaluated:     len(req.ProductIDs),
+		Notifications: notifications,
+	})
+}
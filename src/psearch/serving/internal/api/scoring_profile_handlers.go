@@ -0,0 +1,80 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// ListScoringProfiles handles listing the per-category scoring profiles
+func (c *Controller) ListScoringProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := c.scoringProfiles.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list scoring profiles: %v", err)
+		writeServiceError(w, err, "Failed to list scoring profiles")
+		return
+	}
+	if profiles == nil {
+		profiles = []models.ScoringProfile{}
+	}
+
+	writeJSON(w, http.StatusOK, models.ScoringProfileListResponse{Profiles: profiles})
+}
+
+// PutScoringProfile handles creating or replacing a category's scoring
+// profile
+func (c *Controller) PutScoringProfile(w http.ResponseWriter, r *http.Request) {
+	var req models.ScoringProfileRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile, err := c.scoringProfiles.Put(r.Context(), r.PathValue("category"), req)
+	if errors.Is(err, services.ErrInvalidScoringProfile) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save scoring profile: %v", err)
+		writeServiceError(w, err, "Failed to save scoring profile")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// DeleteScoringProfile handles deleting a category's scoring profile
+func (c *Controller) DeleteScoringProfile(w http.ResponseWriter, r *http.Request) {
+	err := c.scoringProfiles.Delete(r.Context(), r.PathValue("category"))
+	if errors.Is(err, services.ErrScoringProfileNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete scoring profile: %v", err)
+		writeServiceError(w, err, "Failed to delete scoring profile")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/services"
+)
+
+func TestSessionsAreScopedToCaller(t *testing.T) {
+	c, store := newProductTestController()
+	c.sessions = services.NewSessionService(&config.Config{
+		SessionContextEnabled: true,
+		SessionTTL:            time.Minute,
+		SessionCacheSize:      10,
+		SessionMaxQueries:     5,
+	}, nil)
+	bob := &Principal{Method: AuthMethodFirebase, ID: "bob"}
+
+	searches := []struct {
+		principal *Principal
+		query     string
+		want      string
+	}{
+		{principal: alice, query: "trail running", want: "trail running"},
+		// bob's session s1 has no previous search to follow up on
+		{principal: bob, query: "similar ones", want: "similar ones"},
+		{principal: alice, query: "similar ones", want: "trail running"},
+		{query: "similar ones", want: "similar ones"},
+	}
+	for i, search := range searches {
+		req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query": "`+search.query+`", "session_id": "s1"}`))
+		rec := httptest.NewRecorder()
+		c.Search(rec, withPrincipal(req, search.principal))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("search %d: status = %d, want %d: %s", i, rec.Code, http.StatusOK, rec.Body)
+		}
+		if got := store.Searches()[i].Query; got != search.want {
+			t.Errorf("search %d searched %q, want %q", i, got, search.want)
+		}
+	}
+}
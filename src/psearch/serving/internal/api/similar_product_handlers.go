@@ -0,0 +1,109 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// SimilarProducts handles listing the products most similar to a product,
+// for "you may also like" carousels
+func (c *Controller) SimilarProducts(w http.ResponseWriter, r *http.Request) {
+	var req models.SimilarProductsRequest
+	if err := bindQuery(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	localeFromHeaders(r, &req.Currency, &req.Locale)
+
+	productID := r.PathValue("id")
+	results, err := c.similarProducts(r.Context(), productID, &req)
+	var badRequest *badRequestError
+	if errors.As(err, &badRequest) {
+		writeErrorDetails(w, http.StatusBadRequest, badRequest.message, badRequest.details)
+		return
+	}
+	if errors.Is(err, services.ErrProductNotFound) {
+		writeError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Similar products error: %v", err)
+		writeServiceError(w, err, "Similar products lookup failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &models.SimilarProductsResponse{
+		ProductID:  productID,
+		Results:    results,
+		TotalFound: len(results),
+	})
+}
+
+// similarProducts looks up the products most similar to a product. It is
+// shared by the REST and GraphQL endpoints.
+func (c *Controller) similarProducts(ctx context.Context, productID string, req *models.SimilarProductsRequest) ([]models.SearchResult, error) {
+	if err := capsError(c.validator.SimilarProducts(req)); err != nil {
+		return nil, err
+	}
+	currency, err := c.checkCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	catalogID, err := c.resolveCatalog(ctx, req.CatalogID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := services.SimilarOptions{
+		ProductID:    productID,
+		Limit:        c.settings().DefaultLimit,
+		SameCategory: req.SameCategory,
+		Staleness:    c.config.SpannerStaleness,
+		CatalogID:    catalogID,
+	}
+	if req.Limit != nil {
+		opts.Limit = *req.Limit
+	}
+
+	filterNode, err := filter.Parse(req.Filter, c.filters)
+	if err != nil {
+		badRequest := &badRequestError{message: err.Error()}
+		var filterErr *filter.Error
+		if errors.As(err, &filterErr) {
+			badRequest.details = filterErr
+		}
+		return nil, badRequest
+	}
+	opts.Filter = filterNode
+
+	results, err := c.searcher.SimilarProducts(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+	return c.localizeResults(results, currency, req.Locale), nil
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// Server-sent event names on the streaming search endpoint
+const (
+	streamEventPartial = "partial"
+	streamEventFinal   = "final"
+	streamEventError   = "error"
+)
+
+// streamResult is the outcome of one phase of a streamed search
+type streamResult struct {
+	response *models.SearchResponse
+	err      error
+}
+
+// StreamSearch handles the streaming search endpoint. Hybrid searches first
+// send the keyword branch's results as a "partial" event, as soon as they
+// are available, then the fused (and reranked) results as the "final"
+// event. Other modes only send "final".
+func (c *Controller) StreamSearch(w http.ResponseWriter, r *http.Request) {
+	var req models.SearchRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	localeFromHeaders(r, &req.Currency, &req.Locale)
+	embeddingVersionFromHeader(r, &req.EmbeddingVersion)
+	if err := featureFlagsFromHeader(r, &req.FeatureFlags); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate before committing to an event stream so bad requests still
+	// get a plain 400
+	opts, err := c.searchOptions(r.Context(), &req)
+	if err != nil {
+		writeServiceError(w, err, "Search failed")
+		return
+	}
+	if _, err := c.featureFlags(&req); err != nil {
+		writeServiceError(w, err, "Search failed")
+		return
+	}
+	currency, err := c.checkCurrency(req.Currency)
+	if err != nil {
+		writeServiceError(w, err, "Search failed")
+		return
+	}
+
+	reqCtx := r.Context()
+	final := make(chan streamResult, 1)
+	go func() {
+		response, err := c.RunSearch(reqCtx, &req)
+		final <- streamResult{response: response, err: err}
+	}()
+
+	// A nil channel never receives, so non-hybrid searches skip the preview
+	var partial chan streamResult
+	if opts.Mode == models.SearchModeHybrid {
+		partial = make(chan streamResult, 1)
+		go func() {
+			response, err := c.keywordPreview(reqCtx, opts, currency, req.Locale)
+			partial <- streamResult{response: response, err: err}
+		}()
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for {
+		select {
+		case result := <-partial:
+			partial = nil
+			if result.err != nil {
+				// The final results are still coming
+				log.Printf("Streaming search preview failed: %v", result.err)
+				continue
+			}
+			writeEvent(w, streamEventPartial, result.response)
+			flusher.Flush()
+		case result := <-final:
+			if result.err != nil {
+				writeEvent(w, streamEventError, batchItemError(result.err))
+			} else {
+				writeEvent(w, streamEventFinal, result.response)
+			}
+			flusher.Flush()
+			return
+		case <-reqCtx.Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one server-sent event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(w, "event:%s\ndata:%s\n\n", event, payload)
+}
+
+// keywordPreview runs only the full-text branch of a search, which needs no
+// embedding and returns well before the fused results. Results are
+// localized like the final ones.
+func (c *Controller) keywordPreview(ctx context.Context, opts services.SearchOptions, currency, locale string) (*models.SearchResponse, error) {
+	opts.Mode = models.SearchModeKeyword
+	opts.Rerank = false
+	opts.Expansions = nil
+
+	output, err := c.searcher.HybridSearch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var warnings searchWarnings
+	warnings.addOutput(output)
+	response := &models.SearchResponse{
+		Results:          output.Results,
+		TotalFound:       len(output.Results),
+		ConsistencyToken: encodeConsistencyToken(output.ReadTimestamp),
+		Warnings:         warnings,
+	}
+	if opts.IDsOnly {
+		response.Results, response.Hits = nil, searchHits(output.Results)
+	} else {
+		response.Results = c.localizeResults(response.Results, currency, locale)
+	}
+	return response, nil
+}
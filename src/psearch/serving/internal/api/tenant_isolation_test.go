@@ -0,0 +1,238 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+	"psearch/serving/internal/services/servicestest"
+)
+
+// The tests below run against newProductTestController, which serves p1
+// and p2 in catalog "us", the default, and p3 in catalog "eu"
+
+func TestSearchIsolatesCatalogs(t *testing.T) {
+	c, _ := newProductTestController()
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "default catalog", body: `{"query": "running"}`, want: []string{"p1"}},
+		{name: "us", body: `{"query": "running", "catalog_id": "us"}`, want: []string{"p1"}},
+		{name: "eu", body: `{"query": "running", "catalog_id": "eu"}`, want: []string{"p3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c.Search(rec, httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var resp models.SearchResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			var got []string
+			for _, result := range resp.Results {
+				got = append(got, result.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("results = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	c.Search(rec, httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query": "running", "catalog_id": "ca"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown catalog status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestBatchGetProductsIsolatesCatalogs(t *testing.T) {
+	c, _ := newProductTestController()
+	c.config.MaxBatchGetSize = 10
+
+	tests := []struct {
+		name        string
+		body        string
+		wantFound   []string
+		wantMissing []string
+	}{
+		{name: "default catalog", body: `{"ids": ["p1", "p3"]}`, wantFound: []string{"p1"}, wantMissing: []string{"p3"}},
+		{name: "us", body: `{"ids": ["p1", "p2", "p3"], "catalog_id": "us"}`, wantFound: []string{"p1", "p2"}, wantMissing: []string{"p3"}},
+		{name: "eu", body: `{"ids": ["p1", "p3"], "catalog_id": "eu"}`, wantFound: []string{"p3"}, wantMissing: []string{"p1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c.BatchGetProducts(rec, httptest.NewRequest(http.MethodPost, "/products:batchGet", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var resp models.BatchGetResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			var found []string
+			for id := range resp.Products {
+				found = append(found, id)
+			}
+			sort.Strings(found)
+			if !slices.Equal(found, tt.wantFound) || !slices.Equal(resp.Missing, tt.wantMissing) {
+				t.Errorf("found = %v, missing = %v, want %v and %v", found, resp.Missing, tt.wantFound, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestProductEditsIsolateCatalogs(t *testing.T) {
+	c, store := newProductTestController()
+
+	if rec := serveProduct(c.UpdateProduct, http.MethodPatch, "p3", "?catalog_id=us", `{"title": "Renamed"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("update status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := serveProduct(c.UpdateProduct, http.MethodPatch, "p3", "", `{"title": "Renamed"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("update in the default catalog status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := serveProduct(c.DeleteProduct, http.MethodDelete, "p3", "?catalog_id=us", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	products, err := store.GetProductsBatch(context.Background(), "eu", []string{"p3"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if products["p3"] == nil || products["p3"]["title"] != "Running socks" {
+		t.Errorf("p3 = %v, want it unchanged", products["p3"])
+	}
+}
+
+// ingestionRecorder stands in for the ingestion callback services, reading
+// the products it is called with from the store like they do
+type ingestionRecorder struct {
+	store *servicestest.Store
+	// catalogs and read hold the catalog and the IDs found of each call
+	catalogs []string
+	read     [][]string
+}
+
+func (r *ingestionRecorder) readProducts(ctx context.Context, catalogID string, productIDs []string) (int, error) {
+	products, err := r.store.GetProductsBatch(ctx, catalogID, productIDs, 0)
+	if err != nil {
+		return 0, err
+	}
+	var found []string
+	for _, id := range productIDs {
+		if _, ok := products[id]; ok {
+			found = append(found, id)
+		}
+	}
+	r.catalogs = append(r.catalogs, catalogID)
+	r.read = append(r.read, found)
+	return len(found), nil
+}
+
+func (r *ingestionRecorder) DetectChanges(ctx context.Context, catalogID string, productIDs []string) ([]services.ProductChangeEvent, error) {
+	_, err := r.readProducts(ctx, catalogID, productIDs)
+	return nil, err
+}
+
+func (r *ingestionRecorder) ScoreProducts(ctx context.Context, catalogID string, productIDs []string) (int, int, error) {
+	scored, err := r.readProducts(ctx, catalogID, productIDs)
+	return scored, 0, err
+}
+
+func (r *ingestionRecorder) EvaluateProducts(ctx context.Context, catalogID string, productIDs []string) (int, error) {
+	_, err := r.readProducts(ctx, catalogID, productIDs)
+	return 0, err
+}
+
+func TestIngestionCallbacksIsolateCatalogs(t *testing.T) {
+	callbacks := []struct {
+		name    string
+		handler func(c *Controller) http.HandlerFunc
+	}{
+		{name: "detect changes", handler: func(c *Controller) http.HandlerFunc { return c.DetectProductChanges }},
+		{name: "score quality", handler: func(c *Controller) http.HandlerFunc { return c.ScoreProductQuality }},
+		{name: "evaluate saved searches", handler: func(c *Controller) http.HandlerFunc { return c.EvaluateSavedSearches }},
+	}
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantCatalog string
+		wantRead    []string
+	}{
+		{name: "default catalog", body: `{"product_ids": ["p1", "p3"]}`, wantStatus: http.StatusOK, wantCatalog: "us", wantRead: []string{"p1"}},
+		{name: "us", body: `{"product_ids": ["p1", "p2", "p3"], "catalog_id": "us"}`, wantStatus: http.StatusOK, wantCatalog: "us", wantRead: []string{"p1", "p2"}},
+		{name: "eu", body: `{"product_ids": ["p1", "p3"], "catalog_id": "eu"}`, wantStatus: http.StatusOK, wantCatalog: "eu", wantRead: []string{"p3"}},
+		{name: "unknown catalog", body: `{"product_ids": ["p1"], "catalog_id": "ca"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, callback := range callbacks {
+		for _, tt := range tests {
+			t.Run(callback.name+"/"+tt.name, func(t *testing.T) {
+				c, store := newProductTestController()
+				recorder := &ingestionRecorder{store: store}
+				c.productChanges = recorder
+				c.qualityScorer = recorder
+				c.savedSearchEvaluator = recorder
+
+				rec := httptest.NewRecorder()
+				callback.handler(c)(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+				}
+				if tt.wantStatus != http.StatusOK {
+					if len(recorder.catalogs) != 0 {
+						t.Errorf("callback called with catalogs %v, want no call", recorder.catalogs)
+					}
+					return
+				}
+				if !slices.Equal(recorder.catalogs, []string{tt.wantCatalog}) {
+					t.Fatalf("catalogs = %v, want [%s]", recorder.catalogs, tt.wantCatalog)
+				}
+				if !slices.Equal(recorder.read[0], tt.wantRead) {
+					t.Errorf("read = %v, want %v", recorder.read[0], tt.wantRead)
+				}
+			})
+		}
+	}
+}
+
+func TestTestControllerIngestionCallbacksDisabled(t *testing.T) {
+	c, _ := newProductTestController()
+
+	for _, handler := range []http.HandlerFunc{c.DetectProductChanges, c.ScoreProductQuality, c.EvaluateSavedSearches} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"product_ids": ["p1"]}`)))
+		if rec.Code != http.StatusConflict {
+			t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// maxUserIDLength matches the user_profiles key column
+const maxUserIDLength = 128
+
+// profileUser returns the profile a request for the user_id reads or
+// writes. Like saved searches, profiles of authenticated callers are bound
+// to the caller, who may name itself by its ID or as the principal; other
+// user IDs are refused. Without authentication the user_id is used as is.
+func profileUser(ctx context.Context, userID string) (string, bool) {
+	principal, ok := principalFromContext(ctx)
+	if !ok {
+		return userID, true
+	}
+	if userID != principal.ID && userID != principal.String() {
+		return "", false
+	}
+	return principal.String(), true
+}
+
+// RecordUserClick handles recording a user's click, which updates the
+// preference embedding that personalizes their searches
+func (c *Controller) RecordUserClick(w http.ResponseWriter, r *http.Request) {
+	if c.userProfiles == nil {
+		writeError(w, http.StatusConflict, "User profiles are not available")
+		return
+	}
+
+	userID := r.PathValue("user_id")
+	if len(userID) > maxUserIDLength {
+		writeError(w, http.StatusBadRequest, "user_id must be at most 128 characters")
+		return
+	}
+	userID, ok := profileUser(r.Context(), userID)
+	if !ok {
+		writeError(w, http.StatusForbidden, "user_id is not the authenticated caller")
+		return
+	}
+
+	var req models.UserClickRequest
+	if err := bindJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := c.userProfiles.RecordClick(r.Context(), userID, req.ProductID)
+	if errors.Is(err, services.ErrClickedProductNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record click: %v", err)
+		writeServiceError(w, err, "Failed to record click")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
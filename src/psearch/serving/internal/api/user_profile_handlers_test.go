@@ -0,0 +1,153 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"psearch/serving/internal/models"
+)
+
+// profileRecorder stands in for the user profile service, recording the
+// profiles read and written
+type profileRecorder struct {
+	read    []string
+	clicked []string
+}
+
+func (p *profileRecorder) Embedding(ctx context.Context, userID string) ([]float32, error) {
+	p.read = append(p.read, userID)
+	return []float32{1, 0}, nil
+}
+
+func (p *profileRecorder) RecordClick(ctx context.Context, userID, productID string) error {
+	p.clicked = append(p.clicked, userID)
+	return nil
+}
+
+// withPrincipal authenticates the request as principal, as AuthMiddleware would
+func withPrincipal(r *http.Request, principal *Principal) *http.Request {
+	if principal == nil {
+		return r
+	}
+	r, state := withRequestState(r)
+	state.principal = principal
+	return r
+}
+
+var alice = &Principal{Method: AuthMethodFirebase, ID: "alice"}
+
+func TestRecordUserClickBindsProfileToCaller(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		userID    string
+		want      int
+		wantUser  string
+	}{
+		{name: "unauthenticated", userID: "bob", want: http.StatusNoContent, wantUser: "bob"},
+		{name: "own ID", principal: alice, userID: "alice", want: http.StatusNoContent, wantUser: alice.String()},
+		{name: "own principal", principal: alice, userID: alice.String(), want: http.StatusNoContent, wantUser: alice.String()},
+		{name: "other user", principal: alice, userID: "bob", want: http.StatusForbidden},
+		{name: "other method", principal: alice, userID: "api_key:alice", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newProductTestController()
+			profiles := &profileRecorder{}
+			c.userProfiles = profiles
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+tt.userID+"/clicks", strings.NewReader(`{"product_id": "p1"}`))
+			req.SetPathValue("user_id", tt.userID)
+			rec := httptest.NewRecorder()
+			c.RecordUserClick(rec, withPrincipal(req, tt.principal))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			var want []string
+			if tt.wantUser != "" {
+				want = []string{tt.wantUser}
+			}
+			if !slices.Equal(profiles.clicked, want) {
+				t.Errorf("clicks recorded for %v, want %v", profiles.clicked, want)
+			}
+		})
+	}
+}
+
+func TestSearchIgnoresOtherUsersProfiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		principal   *Principal
+		userID      string
+		wantRead    []string
+		wantWarning bool
+	}{
+		{name: "unauthenticated", userID: "bob", wantRead: []string{"bob"}},
+		{name: "own ID", principal: alice, userID: "alice", wantRead: []string{alice.String()}},
+		{name: "other user", principal: alice, userID: "bob", wantWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newProductTestController()
+			c.config.PersonalizationWeight = 0.5
+			profiles := &profileRecorder{}
+			c.userProfiles = profiles
+
+			req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query": "running", "user_id": "`+tt.userID+`"}`))
+			rec := httptest.NewRecorder()
+			c.Search(rec, withPrincipal(req, tt.principal))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var resp models.SearchResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if !slices.Equal(profiles.read, tt.wantRead) {
+				t.Errorf("profiles read = %v, want %v", profiles.read, tt.wantRead)
+			}
+			warned := slices.ContainsFunc(resp.Warnings, func(w models.Warning) bool {
+				return w.Code == models.WarningPersonalizationSkipped
+			})
+			if warned != tt.wantWarning {
+				t.Errorf("warnings = %+v, want personalization skipped: %t", resp.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestRecordSearchEventsRefusesOtherUsers(t *testing.T) {
+	c, _ := newProductTestController()
+	c.config.MaxEventBatchSize = 10
+
+	body := `{"events": [{"type": "click", "product_id": "p1", "user_id": "alice"}, {"type": "click", "product_id": "p1", "user_id": "bob"}]}`
+	rec := httptest.NewRecorder()
+	c.RecordSearchEvents(rec, withPrincipal(httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body)), alice))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "events[1]") {
+		t.Errorf("body = %s, want the refused event named", rec.Body)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"slices"
+
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// warningMessages describes each warning for display to shoppers or
+// developers
+var warningMessages = map[models.WarningCode]string{
+	models.WarningEmbeddingFallback:        "Semantic search was unavailable, so results only match keywords.",
+	models.WarningStaleCache:               "Results were served from cache and may not reflect the latest catalog changes.",
+	models.WarningQueryUnderstandingFailed: "The query could not be interpreted, so no filters were inferred from it.",
+	models.WarningRerankFailed:             "Results could not be reranked and are in their initial order.",
+	models.WarningPinsSkipped:              "Some pinned products could not be loaded and were left out.",
+	models.WarningPersonalizationSkipped:   "Your preferences could not be loaded, so results are not personalized.",
+}
+
+// searchWarnings collects the degradations applied to a single search
+type searchWarnings []models.Warning
+
+// add records a warning once
+func (w *searchWarnings) add(code models.WarningCode) {
+	if slices.ContainsFunc(*w, func(existing models.Warning) bool { return existing.Code == code }) {
+		return
+	}
+	*w = append(*w, models.Warning{Code: code, Message: warningMessages[code]})
+}
+
+// addOutput records the degradations the search output was read with
+func (w *searchWarnings) addOutput(output *services.SearchOutput) {
+	if output.Fallback != "" {
+		w.add(models.WarningEmbeddingFallback)
+	}
+	if output.Stale {
+		w.add(models.WarningStaleCache)
+	}
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package benchmark generates synthetic product catalogs, loads them into
+// Spanner and drives concurrent search load against the API, reporting
+// throughput and latency percentiles so performance regressions are caught
+// before release.
+package benchmark
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// category is a leaf of the synthetic category tree and the shape of the
+// products filed under it
+type category struct {
+	path      string
+	nouns     []string
+	basePrice float64
+	sizes     []string
+	materials []string
+}
+
+var (
+	apparelSizes = []string{"XS", "S", "M", "L", "XL", "XXL"}
+	shoeSizes    = []string{"6", "7", "8", "9", "10", "11", "12"}
+
+	// categories are ordered from most to least populated
+	categories = []category{
+		{"Apparel > Tops > T-Shirts", []string{"T-Shirt", "Tee", "Crew Neck Tee"}, 24, apparelSizes, []string{"Cotton", "Organic Cotton", "Polyester"}},
+		{"Apparel > Shoes > Running", []string{"Running Shoes", "Trainers", "Road Runners"}, 110, shoeSizes, []string{"Mesh", "Knit"}},
+		{"Apparel > Bottoms > Jeans", []string{"Jeans", "Denim Pants", "Slim Jeans"}, 65, apparelSizes, []string{"Denim", "Stretch Denim"}},
+		{"Apparel > Outerwear > Jackets", []string{"Jacket", "Rain Jacket", "Puffer Jacket"}, 140, apparelSizes, []string{"Nylon", "Down", "Polyester"}},
+		{"Apparel > Tops > Sweaters", []string{"Sweater", "Cardigan", "Pullover"}, 70, apparelSizes, []string{"Wool", "Merino Wool", "Cashmere"}},
+		{"Apparel > Shoes > Boots", []string{"Boots", "Hiking Boots", "Chelsea Boots"}, 150, shoeSizes, []string{"Leather", "Suede"}},
+		{"Apparel > Activewear > Leggings", []string{"Leggings", "Yoga Pants", "Tights"}, 55, apparelSizes, []string{"Spandex", "Nylon"}},
+		{"Accessories > Bags > Backpacks", []string{"Backpack", "Daypack", "Laptop Backpack"}, 80, nil, []string{"Canvas", "Nylon", "Leather"}},
+		{"Accessories > Headwear > Hats", []string{"Cap", "Beanie", "Bucket Hat"}, 28, []string{"S/M", "L/XL"}, []string{"Cotton", "Wool"}},
+		{"Accessories > Watches", []string{"Watch", "Sports Watch", "Chronograph"}, 220, nil, []string{"Stainless Steel", "Titanium"}},
+	}
+
+	// brands are ordered from most to least popular
+	brands = []string{
+		"Northpeak", "Urbanline", "Solstice", "Ironwood", "Bluecrest", "Kestrel",
+		"Meridian", "Fieldhouse", "Lumen", "Cobalt & Co", "Driftwood", "Harbor",
+		"Vantage", "Willowby", "Summit Supply", "Oakridge", "Pioneer", "Alder",
+		"Tidewater", "Granite", "Foxglove", "Redline", "Canopy", "Everstone",
+	}
+
+	// colors pair a color with its color family
+	colors = [][2]string{
+		{"Black", "Black"}, {"White", "White"}, {"Navy", "Blue"}, {"Gray", "Gray"},
+		{"Red", "Red"}, {"Olive", "Green"}, {"Royal Blue", "Blue"}, {"Beige", "Brown"},
+		{"Burgundy", "Red"}, {"Forest Green", "Green"}, {"Pink", "Pink"}, {"Mustard", "Yellow"},
+	}
+
+	adjectives = []string{"Classic", "Lightweight", "Everyday", "Performance", "Vintage", "Essential", "Waterproof", "Relaxed Fit", "Premium", "Breathable"}
+	audiences  = []string{"Men", "Women", "Unisex", "Kids"}
+)
+
+// Generator produces a deterministic synthetic catalog. Product i depends
+// only on the seed and i, so catalogs can be generated concurrently and
+// regenerated identically across runs.
+type Generator struct {
+	seed uint64
+}
+
+// NewGenerator returns a generator for the catalog identified by seed
+func NewGenerator(seed uint64) *Generator {
+	return &Generator{seed: seed}
+}
+
+// ProductID returns the ID of product i
+func ProductID(i int) string {
+	return fmt.Sprintf("bench-%08d", i)
+}
+
+// Product returns product i as Retail-style product_data. Categories and
+// brands follow a Zipf distribution, prices are log-normal around each
+// category's base price, about one product in five is on sale and one in
+// ten is unavailable.
+func (g *Generator) Product(i int) map[string]interface{} {
+	r := rand.New(rand.NewPCG(g.seed, uint64(i)))
+	cat := categories[zipf(r, len(categories))]
+	brand := brands[zipf(r, len(brands))]
+	color := colors[r.IntN(len(colors))]
+	adjective := adjectives[r.IntN(len(adjectives))]
+	audience := audiences[zipf(r, len(audiences))]
+	noun := cat.nouns[r.IntN(len(cat.nouns))]
+	material := cat.materials[r.IntN(len(cat.materials))]
+
+	title := fmt.Sprintf("%s %s %s %s", brand, adjective, color[0], noun)
+	price := roundPrice(cat.basePrice * math.Exp(r.NormFloat64()*0.45))
+	priceInfo := map[string]interface{}{
+		"price":        formatPrice(price),
+		"currencyCode": "USD",
+	}
+	if r.Float64() < 0.2 {
+		priceInfo["originalPrice"] = formatPrice(roundPrice(price * (1.15 + r.Float64()*0.45)))
+	}
+
+	availability := "IN_STOCK"
+	switch roll := r.Float64(); {
+	case roll < 0.07:
+		availability = "OUT_OF_STOCK"
+	case roll < 0.10:
+		availability = "BACKORDER"
+	}
+
+	product := map[string]interface{}{
+		"name":         fmt.Sprintf("projects/benchmark/locations/global/catalogs/default_catalog/branches/0/products/%s", ProductID(i)),
+		"title":        title,
+		"description":  fmt.Sprintf("%s %s from %s in %s, made of %s for %s.", adjective, strings.ToLower(noun), brand, strings.ToLower(color[0]), strings.ToLower(material), strings.ToLower(audience)),
+		"brands":       []interface{}{brand},
+		"categories":   []interface{}{cat.path},
+		"priceInfo":    priceInfo,
+		"availability": availability,
+		"colorInfo": map[string]interface{}{
+			"colors":        []interface{}{color[0]},
+			"colorFamilies": []interface{}{color[1]},
+		},
+		"attributes": []interface{}{
+			textAttribute("material", material),
+			textAttribute("gender", audience),
+		},
+		"images": []interface{}{map[string]interface{}{
+			"uri":    fmt.Sprintf("https://images.example.com/%s.jpg", ProductID(i)),
+			"height": "800",
+			"width":  "800",
+		}},
+		"uri":  fmt.Sprintf("https://shop.example.com/p/%s", ProductID(i)),
+		"gtin": gtin(r),
+	}
+	if len(cat.sizes) > 0 {
+		start := r.IntN(len(cat.sizes))
+		end := start + 1 + r.IntN(len(cat.sizes)-start)
+		sizes := make([]interface{}, 0, end-start)
+		for _, size := range cat.sizes[start:end] {
+			sizes = append(sizes, size)
+		}
+		product["sizes"] = sizes
+	}
+	return product
+}
+
+// Queries returns n distinct queries over the catalog's vocabulary, ordered
+// from head to tail: short category and brand queries first, then longer
+// queries combining colors, audiences and price bounds
+func (g *Generator) Queries(n int) []string {
+	r := rand.New(rand.NewPCG(g.seed, math.MaxUint64))
+	seen := make(map[string]bool, n)
+	queries := make([]string, 0, n)
+	add := func(q string) {
+		q = strings.ToLower(q)
+		if len(queries) < n && !seen[q] {
+			seen[q] = true
+			queries = append(queries, q)
+		}
+	}
+	for _, cat := range categories {
+		add(cat.nouns[0])
+	}
+	for _, brand := range brands[:len(brands)/2] {
+		add(brand + " " + categories[zipf(r, len(categories))].nouns[0])
+	}
+	// The templates run out of combinations well above any sensible pool
+	// size; the attempt bound keeps a huge n from looping forever
+	for attempts := 0; len(queries) < n && attempts < 100*n; attempts++ {
+		cat := categories[zipf(r, len(categories))]
+		noun := cat.nouns[r.IntN(len(cat.nouns))]
+		switch r.IntN(5) {
+		case 0:
+			add(colors[r.IntN(len(colors))][0] + " " + noun)
+		case 1:
+			add(adjectives[r.IntN(len(adjectives))] + " " + noun)
+		case 2:
+			add(noun + " for " + audiences[r.IntN(len(audiences))])
+		case 3:
+			add(fmt.Sprintf("%s under %d", noun, int(cat.basePrice/10+1)*10))
+		default:
+			add(fmt.Sprintf("%s %s %s", brands[zipf(r, len(brands))], colors[r.IntN(len(colors))][0], noun))
+		}
+	}
+	return queries
+}
+
+// zipf draws an index in [0, n) with a Zipf distribution, so lower
+// indexes are drawn much more often
+func zipf(r *rand.Rand, n int) int {
+	return int(rand.NewZipf(r, 1.2, 1, uint64(n-1)).Uint64())
+}
+
+// roundPrice rounds a price to the nearest whole amount less one cent
+func roundPrice(price float64) float64 {
+	return math.Max(1, math.Round(price)) - 0.01
+}
+
+// formatPrice formats a price the way product_data stores it
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+// textAttribute returns a searchable and indexable text attribute
+func textAttribute(key, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"key": key,
+		"value": map[string]interface{}{
+			"text":       []interface{}{value},
+			"indexable":  "true",
+			"searchable": "true",
+		},
+	}
+}
+
+// gtin returns a random GTIN-13 with a valid check digit
+func gtin(r *rand.Rand) string {
+	digits := make([]byte, 13)
+	sum := 0
+	for i := range 12 {
+		d := r.IntN(10)
+		digits[i] = byte('0' + d)
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	digits[12] = byte('0' + (10-sum%10)%10)
+	return string(digits)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package benchmark
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// ProductWriter writes a batch of products keyed by ID.
+// services.SpannerService implements it.
+type ProductWriter interface {
+	WriteProducts(ctx context.Context, catalogID string, products map[string]map[string]interface{}) error
+}
+
+// LoadCatalog writes products 0 to n-1 of gen to catalogID in batches of
+// batchSize, with up to concurrency batches in flight. It stops at the
+// first failed batch and returns its error.
+func LoadCatalog(ctx context.Context, writer ProductWriter, gen *Generator, catalogID string, n, batchSize, concurrency int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		written  atomic.Int64
+	)
+	sem := make(chan struct{}, max(concurrency, 1))
+	for start := 0; start < n; start += batchSize {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		end := min(start+batchSize, n)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			batch := make(map[string]map[string]interface{}, end-start)
+			for i := start; i < end; i++ {
+				batch[ProductID(i)] = gen.Product(i)
+			}
+			if err := writer.WriteProducts(ctx, catalogID, batch); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			if total := written.Add(int64(end - start)); total%10000 < int64(end-start) || total == int64(n) {
+				log.Printf("benchmark: loaded %d/%d products", total, n)
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"psearch/serving/internal/models"
+)
+
+// Target sends one search request body and returns the response status
+type Target interface {
+	Search(ctx context.Context, body []byte) (int, error)
+}
+
+// HandlerTarget serves searches in-process through the API handler, so
+// the measured latency excludes the network
+type HandlerTarget struct {
+	Handler http.Handler
+}
+
+// Search implements Target
+func (t HandlerTarget) Search(ctx context.Context, body []byte) (int, error) {
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/search", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	t.Handler.ServeHTTP(recorder, req)
+	return recorder.Code, nil
+}
+
+// HTTPTarget sends searches to the /search endpoint of a running
+// deployment
+type HTTPTarget struct {
+	// BaseURL is the deployment's URL, e.g. https://search.example.com
+	BaseURL string
+	// APIKey is sent as X-API-Key when set
+	APIKey string
+	Client *http.Client
+}
+
+// Search implements Target
+func (t HTTPTarget) Search(ctx context.Context, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(t.BaseURL, "/")+"/search", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.APIKey != "" {
+		req.Header.Set("X-API-Key", t.APIKey)
+	}
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Reading the whole body makes latency include the transfer and lets
+	// the connection be reused
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+// LoadOptions configures a load run
+type LoadOptions struct {
+	// Queries are drawn with a Zipf distribution, so the first queries are
+	// the head of the traffic and get the most repeats
+	Queries []string
+	// Request is the template every search is sent with; its query is
+	// replaced by the drawn one
+	Request models.SearchRequest
+	// Concurrency is the number of workers sending searches back to back
+	Concurrency int
+	// Duration bounds the run when Requests is 0
+	Duration time.Duration
+	// Requests stops the run after this many searches
+	Requests int
+	// Seed makes the query sequence of each worker reproducible
+	Seed uint64
+}
+
+// Latency summarizes a latency distribution in milliseconds
+type Latency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Report is the outcome of a load run. Latency covers successful searches
+// only; errors are searches that failed or returned a non-200 status.
+type Report struct {
+	Requests       int         `json:"requests"`
+	Errors         int         `json:"errors"`
+	StatusCodes    map[int]int `json:"status_codes"`
+	ElapsedSeconds float64     `json:"elapsed_seconds"`
+	Throughput     float64     `json:"throughput_qps"`
+	Latency        Latency     `json:"latency_ms"`
+}
+
+// Run drives concurrent search load against target until the duration
+// elapses, the request count is reached or ctx is cancelled. Searches cut
+// off by the end of the run are not counted.
+func Run(ctx context.Context, target Target, opts LoadOptions) (*Report, error) {
+	if len(opts.Queries) == 0 {
+		return nil, errors.New("no queries to send")
+	}
+	if opts.Requests <= 0 && opts.Duration <= 0 {
+		return nil, errors.New("either a duration or a request count is required")
+	}
+	if opts.Requests <= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	type workerResult struct {
+		latencies []time.Duration
+		statuses  map[int]int
+		errors    int
+	}
+	var (
+		wg      sync.WaitGroup
+		issued  atomic.Int64
+		results = make([]workerResult, max(opts.Concurrency, 1))
+	)
+	start := time.Now()
+	for w := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewPCG(opts.Seed, uint64(w)))
+			zipf := rand.NewZipf(r, 1.1, 1, uint64(len(opts.Queries)-1))
+			result := workerResult{statuses: make(map[int]int)}
+			for ctx.Err() == nil {
+				if opts.Requests > 0 && issued.Add(1) > int64(opts.Requests) {
+					break
+				}
+				req := opts.Request
+				req.Query = opts.Queries[zipf.Uint64()]
+				body, err := json.Marshal(req)
+				if err != nil {
+					result.errors++
+					continue
+				}
+				sent := time.Now()
+				status, err := target.Search(ctx, body)
+				elapsed := time.Since(sent)
+				if ctx.Err() != nil {
+					break
+				}
+				result.statuses[status]++
+				if err != nil || status != http.StatusOK {
+					result.errors++
+					continue
+				}
+				result.latencies = append(result.latencies, elapsed)
+			}
+			results[w] = result
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := &Report{StatusCodes: make(map[int]int), ElapsedSeconds: elapsed.Seconds()}
+	var latencies []time.Duration
+	for _, result := range results {
+		latencies = append(latencies, result.latencies...)
+		report.Errors += result.errors
+		for status, count := range result.statuses {
+			report.StatusCodes[status] += count
+		}
+	}
+	report.Requests = len(latencies) + report.Errors
+	if elapsed > 0 {
+		report.Throughput = float64(len(latencies)) / elapsed.Seconds()
+	}
+	report.Latency = summarizeLatency(latencies)
+	return report, nil
+}
+
+// summarizeLatency returns the mean, nearest-rank percentiles and maximum
+// of latencies
+func summarizeLatency(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	slices.Sort(latencies)
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	percentile := func(p float64) float64 {
+		rank := int(p*float64(len(latencies))+0.999999) - 1
+		return milliseconds(latencies[min(max(rank, 0), len(latencies)-1)])
+	}
+	return Latency{
+		Mean: milliseconds(total / time.Duration(len(latencies))),
+		P50:  percentile(0.50),
+		P90:  percentile(0.90),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+		Max:  milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// String formats the report as a short human-readable summary
+func (r *Report) String() string {
+	return fmt.Sprintf("%d requests (%d errors) in %.1fs: %.1f qps, latency ms mean %.1f p50 %.1f p90 %.1f p95 %.1f p99 %.1f max %.1f",
+		r.Requests, r.Errors, r.ElapsedSeconds, r.Throughput,
+		r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P95, r.Latency.P99, r.Latency.Max)
+}
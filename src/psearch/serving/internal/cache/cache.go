@@ -0,0 +1,431 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cache provides the in-process caches used by the serving layer.
+//
+// Entries carry tags (see QueryTag and ProductTag) so that operators can
+// invalidate everything derived from a query or a product across layers.
+package cache
+
+import (
+	"container/list"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"psearch/serving/internal/metrics"
+)
+
+// QueryTag tags entries derived from a search query
+func QueryTag(query string) string {
+	return "query:" + NormalizeQuery(query)
+}
+
+// ProductTag tags entries that contain a product
+func ProductTag(productID string) string {
+	return "product:" + productID
+}
+
+// NormalizeQuery folds case and whitespace so equivalent queries share entries
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// Stats describes a cache's size and effectiveness
+type Stats struct {
+	Name       string  `json:"name"`
+	Entries    int     `json:"entries"`
+	MaxEntries int     `json:"max_entries"`
+	TTLSeconds float64 `json:"ttl_seconds"`
+	// SoftTTLSeconds is when entries become stale and are refreshed in the
+	// background; it equals TTLSeconds for caches without revalidation
+	SoftTTLSeconds float64 `json:"soft_ttl_seconds"`
+	Hits           uint64  `json:"hits"`
+	StaleHits      uint64  `json:"stale_hits"`
+	Misses         uint64  `json:"misses"`
+	Evictions      uint64  `json:"evictions"`
+	HitRatio       float64 `json:"hit_ratio"`
+	// Remote is set when the cache is backed by a shared Redis tier; the
+	// counters above are for this replica's in-process tier
+	Remote bool `json:"remote"`
+}
+
+// Layer is the management view of a cache, independent of its value type
+type Layer interface {
+	Name() string
+	Stats() Stats
+	// InvalidateKeys removes entries whose key matches the glob pattern
+	InvalidateKeys(pattern string) (int, error)
+	// InvalidateTag removes entries carrying the tag
+	InvalidateTag(tag string) int
+	// Purge removes every entry
+	Purge() int
+}
+
+type entry[V any] struct {
+	key        string
+	value      V
+	tags       []string
+	staleAt    time.Time
+	expires    time.Time
+	refreshing bool
+}
+
+// remoteEntry is an entry as stored in the remote tier
+type remoteEntry[V any] struct {
+	Value   V         `json:"value"`
+	Tags    []string  `json:"tags,omitempty"`
+	StaleAt time.Time `json:"stale_at"`
+	Expires time.Time `json:"expires"`
+}
+
+// Cache is a size-bounded LRU cache whose entries expire after a TTL.
+//
+// Caches created with NewWithSoftTTL also support stale-while-revalidate:
+// after the soft TTL an entry is still served by GetStale, flagged as stale so
+// the caller can refresh it in the background, until the hard TTL removes it.
+//
+// With SetRemote, local misses fall through to a shared remote tier, and
+// writes and invalidations go to both tiers.
+type Cache[V any] struct {
+	name       string
+	maxEntries int
+	remote     *Remote
+
+	mu        sync.Mutex
+	ttl       time.Duration
+	softTTL   time.Duration
+	items     map[string]*list.Element
+	order     *list.List
+	hits      uint64
+	staleHits uint64
+	misses    uint64
+	evictions uint64
+}
+
+// New creates a cache holding at most maxEntries entries for ttl each
+func New[V any](name string, maxEntries int, ttl time.Duration) *Cache[V] {
+	return NewWithSoftTTL[V](name, maxEntries, ttl, ttl)
+}
+
+// NewWithSoftTTL creates a cache whose entries go stale after softTTL and
+// expire after hardTTL
+func NewWithSoftTTL[V any](name string, maxEntries int, softTTL, hardTTL time.Duration) *Cache[V] {
+	if softTTL <= 0 || softTTL > hardTTL {
+		softTTL = hardTTL
+	}
+	return &Cache[V]{
+		name:       name,
+		maxEntries: maxEntries,
+		ttl:        hardTTL,
+		softTTL:    softTTL,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Name returns the cache name used in metrics and the admin API
+func (c *Cache[V]) Name() string {
+	return c.name
+}
+
+// SetRemote backs the cache with a shared remote tier. It must be called
+// before the cache is used; nil leaves the cache local.
+func (c *Cache[V]) SetRemote(remote *Remote) {
+	c.remote = remote
+}
+
+// Get returns the cached value for key, if present and not expired
+func (c *Cache[V]) Get(key string) (V, bool) {
+	if value, ok := c.getLocal(key); ok || c.remote == nil {
+		return value, ok
+	}
+	value, _, ok := c.getRemote(key)
+	return value, ok
+}
+
+// GetStale returns the cached value for key even if it is past the soft TTL,
+// reporting whether it is stale. Stale callers should refresh the entry,
+// using BeginRefresh so only one of them does.
+func (c *Cache[V]) GetStale(key string) (value V, stale bool, ok bool) {
+	if value, stale, ok = c.getStaleLocal(key); ok || c.remote == nil {
+		return value, stale, ok
+	}
+	return c.getRemote(key)
+}
+
+// getRemote looks key up in the remote tier, copying a hit into the local
+// tier with its remaining lifetime
+func (c *Cache[V]) getRemote(key string) (value V, stale bool, ok bool) {
+	if c.maxEntries <= 0 {
+		return value, false, false
+	}
+	var e remoteEntry[V]
+	if !c.remote.get(c.name, key, &e) {
+		return value, false, false
+	}
+	now := time.Now()
+	if now.After(e.Expires) {
+		return value, false, false
+	}
+	c.setLocal(key, e.Value, e.Tags, e.StaleAt, e.Expires)
+	return e.Value, now.After(e.StaleAt), true
+}
+
+// getLocal looks key up in the local tier
+func (c *Cache[V]) getLocal(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if ok && time.Now().After(elem.Value.(*entry[V]).expires) {
+		c.removeElement(elem)
+		ok = false
+	}
+	metrics.RecordCacheLookup(c.name, ok)
+	if !ok {
+		c.misses++
+		return zero, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*entry[V]).value, true
+}
+
+// getStaleLocal looks key up in the local tier, including stale entries
+func (c *Cache[V]) getStaleLocal(key string) (value V, stale bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	now := time.Now()
+	if ok && now.After(elem.Value.(*entry[V]).expires) {
+		c.removeElement(elem)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		metrics.RecordCacheLookup(c.name, false)
+		return value, false, false
+	}
+
+	e := elem.Value.(*entry[V])
+	c.order.MoveToFront(elem)
+	if now.After(e.staleAt) {
+		c.staleHits++
+		metrics.CacheRequests.WithLabelValues(c.name, "stale").Inc()
+		return e.value, true, true
+	}
+	c.hits++
+	metrics.RecordCacheLookup(c.name, true)
+	return e.value, false, true
+}
+
+// BeginRefresh marks a stale entry as being refreshed. It returns false if
+// the entry is gone or another caller is already refreshing it. The refresh
+// ends with Set, or with EndRefresh if it fails.
+func (c *Cache[V]) BeginRefresh(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok || elem.Value.(*entry[V]).refreshing {
+		return false
+	}
+	elem.Value.(*entry[V]).refreshing = true
+	return true
+}
+
+// EndRefresh clears the refresh mark after a failed refresh so a later
+// caller can retry
+func (c *Cache[V]) EndRefresh(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*entry[V]).refreshing = false
+	}
+}
+
+// Set stores value under key with the given invalidation tags. The remote
+// tier, if any, is written in the background.
+func (c *Cache[V]) Set(key string, value V, tags ...string) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	softTTL, ttl := c.softTTL, c.ttl
+	c.mu.Unlock()
+
+	now := time.Now()
+	staleAt, expires := now.Add(softTTL), now.Add(ttl)
+	c.setLocal(key, value, tags, staleAt, expires)
+	if c.remote != nil {
+		c.remote.set(c.name, key, remoteEntry[V]{Value: value, Tags: tags, StaleAt: staleAt, Expires: expires}, tags, ttl)
+	}
+}
+
+// SetTTL changes the soft and hard TTL of entries stored from now on.
+// Existing entries keep the expiry they were stored with.
+func (c *Cache[V]) SetTTL(softTTL, hardTTL time.Duration) {
+	if softTTL <= 0 || softTTL > hardTTL {
+		softTTL = hardTTL
+	}
+	c.mu.Lock()
+	c.softTTL, c.ttl = softTTL, hardTTL
+	c.mu.Unlock()
+}
+
+// setLocal stores value under key in the local tier
+func (c *Cache[V]) setLocal(key string, value V, tags []string, staleAt, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[V])
+		e.value = value
+		e.tags = tags
+		e.staleAt = staleAt
+		e.expires = expires
+		e.refreshing = false
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[V]{
+		key:     key,
+		value:   value,
+		tags:    tags,
+		staleAt: staleAt,
+		expires: expires,
+	})
+	for c.order.Len() > c.maxEntries {
+		c.removeElement(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Delete removes the entry for key from both tiers, reporting whether it
+// was cached locally
+func (c *Cache[V]) Delete(key string) bool {
+	if c.remote != nil {
+		c.remote.delete(c.name, key)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if ok {
+		c.removeElement(elem)
+	}
+	return ok
+}
+
+// InvalidateKeys removes entries whose key matches the glob pattern from
+// both tiers, returning the number removed locally
+func (c *Cache[V]) InvalidateKeys(pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+	if c.remote != nil {
+		c.remote.invalidateMatching(c.name, pattern)
+	}
+	return c.removeMatching(func(e *entry[V]) bool {
+		matched, _ := path.Match(pattern, e.key)
+		return matched
+	}), nil
+}
+
+// InvalidateTag removes entries carrying the tag from both tiers, returning
+// the number removed locally
+func (c *Cache[V]) InvalidateTag(tag string) int {
+	if c.remote != nil {
+		c.remote.invalidateTag(c.name, tag)
+	}
+	return c.removeMatching(func(e *entry[V]) bool {
+		for _, t := range e.tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Purge removes every entry from both tiers, returning the number removed
+// locally
+func (c *Cache[V]) Purge() int {
+	if c.remote != nil {
+		c.remote.invalidateMatching(c.name, "*")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.order.Len()
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+	return n
+}
+
+// Stats returns the cache's current size and counters
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		Name:           c.name,
+		Entries:        c.order.Len(),
+		MaxEntries:     c.maxEntries,
+		TTLSeconds:     c.ttl.Seconds(),
+		SoftTTLSeconds: c.softTTL.Seconds(),
+		Hits:           c.hits,
+		StaleHits:      c.staleHits,
+		Misses:         c.misses,
+		Evictions:      c.evictions,
+		Remote:         c.remote != nil,
+	}
+	if lookups := c.hits + c.staleHits + c.misses; lookups > 0 {
+		stats.HitRatio = float64(c.hits+c.staleHits) / float64(lookups)
+	}
+	return stats
+}
+
+func (c *Cache[V]) removeMatching(match func(*entry[V]) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		if match(elem.Value.(*entry[V])) {
+			c.removeElement(elem)
+			removed++
+		}
+		elem = next
+	}
+	return removed
+}
+
+func (c *Cache[V]) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*entry[V]).key)
+}
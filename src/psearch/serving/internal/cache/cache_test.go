@@ -0,0 +1,194 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheExpiry(t *testing.T) {
+	c := New[string]("test_expiry", 10, 50*time.Millisecond)
+	c.Set("k", "v")
+	if v, ok := c.Get("k"); !ok || v != "v" {
+		t.Fatalf("Get() = %q, %t, want \"v\", true", v, ok)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if v, ok := c.Get("k"); ok {
+		t.Errorf("Get() after the TTL = %q, want a miss", v)
+	}
+	if _, _, ok := c.GetStale("k"); ok {
+		t.Error("GetStale() after the TTL hit")
+	}
+	stats := c.Stats()
+	if stats.Entries != 0 || stats.Hits != 1 || stats.Misses != 2 || stats.HitRatio != 1.0/3 {
+		t.Errorf("Stats() = %+v, want 0 entries, 1 hit and 2 misses", stats)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	c := NewWithSoftTTL[string]("test_stale", 10, 50*time.Millisecond, 300*time.Millisecond)
+	c.Set("k", "v1")
+	if v, stale, ok := c.GetStale("k"); !ok || stale || v != "v1" {
+		t.Fatalf("GetStale() = %q, %t, %t, want a fresh hit", v, stale, ok)
+	}
+	if c.BeginRefresh("missing") {
+		t.Error("BeginRefresh() of a missing entry = true")
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if v, stale, ok := c.GetStale("k"); !ok || !stale || v != "v1" {
+		t.Fatalf("GetStale() after the soft TTL = %q, %t, %t, want a stale hit", v, stale, ok)
+	}
+	// Only one caller refreshes a stale entry
+	if !c.BeginRefresh("k") {
+		t.Fatal("first BeginRefresh() = false")
+	}
+	if c.BeginRefresh("k") {
+		t.Error("second BeginRefresh() = true while a refresh is running")
+	}
+	// A failed refresh lets the next caller retry
+	c.EndRefresh("k")
+	if !c.BeginRefresh("k") {
+		t.Fatal("BeginRefresh() after EndRefresh() = false")
+	}
+	// A successful one stores a fresh entry and ends the refresh
+	c.Set("k", "v2")
+	if v, stale, ok := c.GetStale("k"); !ok || stale || v != "v2" {
+		t.Errorf("GetStale() after the refresh = %q, %t, %t, want a fresh hit of v2", v, stale, ok)
+	}
+	if !c.BeginRefresh("k") {
+		t.Error("BeginRefresh() after Set() = false")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.StaleHits != 1 || stats.SoftTTLSeconds != 0.05 || stats.TTLSeconds != 0.3 {
+		t.Errorf("Stats() = %+v, want 2 hits, 1 stale hit and TTLs 0.05s and 0.3s", stats)
+	}
+
+	// Stale entries are still removed at the hard TTL
+	c.Set("gone", "v")
+	time.Sleep(350 * time.Millisecond)
+	if _, _, ok := c.GetStale("gone"); ok {
+		t.Error("GetStale() after the hard TTL hit")
+	}
+}
+
+func TestCacheSoftTTLDefaults(t *testing.T) {
+	for _, softTTL := range []time.Duration{0, -time.Second, 2 * time.Hour} {
+		c := NewWithSoftTTL[string]("test_soft_ttl", 10, softTTL, time.Hour)
+		if stats := c.Stats(); stats.SoftTTLSeconds != stats.TTLSeconds {
+			t.Errorf("soft TTL %s: soft TTL %vs, want the hard TTL %vs", softTTL, stats.SoftTTLSeconds, stats.TTLSeconds)
+		}
+	}
+
+	c := New[string]("test_set_ttl", 10, time.Hour)
+	c.Set("old", "v")
+	c.SetTTL(time.Millisecond, 20*time.Millisecond)
+	c.Set("new", "v")
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := c.Get("old"); !ok {
+		t.Error("SetTTL() changed the expiry of an existing entry")
+	}
+	if _, ok := c.Get("new"); ok {
+		t.Error("entry stored after SetTTL() outlived the new TTL")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := New[int]("test_eviction", 2, time.Hour)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("Stats() = %+v, want 2 entries and 1 eviction", stats)
+	}
+
+	disabled := New[int]("test_disabled", 0, time.Hour)
+	disabled.Set("a", 1)
+	if _, ok := disabled.Get("a"); ok {
+		t.Error("cache with no entries stored a value")
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	c := New[int]("test_invalidation", 10, time.Hour)
+	fill := func() {
+		c.Purge()
+		c.Set("search:shoes:1", 1, QueryTag("Shoes"), ProductTag("p1"))
+		c.Set("search:shoes:2", 2, QueryTag("shoes"), ProductTag("p2"))
+		c.Set("search:socks:1", 3, QueryTag("socks"), ProductTag("p1"))
+	}
+	keys := func() []string {
+		var present []string
+		for _, key := range []string{"search:shoes:1", "search:shoes:2", "search:socks:1"} {
+			if _, ok := c.Get(key); ok {
+				present = append(present, key)
+			}
+		}
+		return present
+	}
+
+	tests := []struct {
+		name       string
+		invalidate func() int
+		wantLeft   []string
+	}{
+		{"query tag", func() int { return c.InvalidateTag(QueryTag("  SHOES ")) }, []string{"search:socks:1"}},
+		{"product tag", func() int { return c.InvalidateTag(ProductTag("p1")) }, []string{"search:shoes:2"}},
+		{"unknown tag", func() int { return c.InvalidateTag(ProductTag("p9")) }, []string{"search:shoes:1", "search:shoes:2", "search:socks:1"}},
+		{"key pattern", func() int { n, _ := c.InvalidateKeys("search:*:1"); return n }, []string{"search:shoes:2"}},
+		{"key", func() int { n, _ := c.InvalidateKeys("search:socks:1"); return n }, []string{"search:shoes:1", "search:shoes:2"}},
+		{"delete", func() int {
+			if c.Delete("search:shoes:2") && !c.Delete("search:shoes:2") {
+				return 1
+			}
+			return 0
+		}, []string{"search:shoes:1", "search:socks:1"}},
+		{"purge", c.Purge, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fill()
+			removed := tt.invalidate()
+			left := keys()
+			if removed != 3-len(tt.wantLeft) || len(left) != len(tt.wantLeft) {
+				t.Errorf("removed %d, left %q, want left %q", removed, left, tt.wantLeft)
+			}
+			for i := range left {
+				if left[i] != tt.wantLeft[i] {
+					t.Errorf("left %q, want %q", left, tt.wantLeft)
+					break
+				}
+			}
+		})
+	}
+
+	if _, err := c.InvalidateKeys("search:["); err == nil {
+		t.Error("InvalidateKeys() with a malformed pattern succeeded")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"psearch/serving/internal/metrics"
+)
+
+// errFlightAborted is returned to callers waiting on a call that panicked
+var errFlightAborted = errors.New("cache: coalesced call did not complete")
+
+// flightCall is a call in flight and, once done is closed, its result
+type flightCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Flight coalesces concurrent calls for the same key into one, so a burst
+// of identical cache misses computes the value once instead of stampeding
+// the backends
+type Flight[V any] struct {
+	name  string
+	mu    sync.Mutex
+	calls map[string]*flightCall[V]
+}
+
+// NewFlight returns a Flight whose coalesced calls are counted on /metrics
+// under the cache name
+func NewFlight[V any](name string) *Flight[V] {
+	return &Flight[V]{name: name, calls: make(map[string]*flightCall[V])}
+}
+
+// Do runs fn for key, unless a call for key is already in flight, in which
+// case it waits for that call and returns its result. shared reports
+// whether the result came from another caller's call. Waiting callers give
+// up when their ctx is done; fn itself is not interrupted.
+func (f *Flight[V]) Do(ctx context.Context, key string, fn func() (V, error)) (value V, shared bool, err error) {
+	f.mu.Lock()
+	if c, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		metrics.CacheRequests.WithLabelValues(f.name, "coalesced").Inc()
+		select {
+		case <-c.done:
+			return c.value, true, c.err
+		case <-ctx.Done():
+			return value, true, ctx.Err()
+		}
+	}
+	c := &flightCall[V]{done: make(chan struct{}), err: errFlightAborted}
+	f.calls[key] = c
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+	return c.value, false, c.err
+}
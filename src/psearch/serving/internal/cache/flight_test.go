@@ -0,0 +1,180 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"psearch/serving/internal/metrics"
+)
+
+// coalesced returns how many callers of the named Flight have joined a call
+// in flight so far
+func coalesced(name string) float64 {
+	return testutil.ToFloat64(metrics.CacheRequests.WithLabelValues(name, "coalesced"))
+}
+
+// waitForCoalesced waits until n more callers of the named Flight than
+// since have joined a call in flight
+func waitForCoalesced(t *testing.T, name string, since float64, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for coalesced(name) < since+float64(n) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v callers coalesced, want %d", coalesced(name)-since, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlightCoalescesConcurrentMisses(t *testing.T) {
+	const callers = 10
+	c := New[string]("test_flight_misses", 10, time.Hour)
+	f := NewFlight[string]("test_flight_misses")
+
+	// Callers fill the cache on a miss, as the result cache does. The loader
+	// only returns once every other caller has missed and is waiting on it.
+	var loads, shared atomic.Int32
+	since := coalesced("test_flight_misses")
+	get := func() (string, error) {
+		if v, ok := c.Get("k"); ok {
+			return v, nil
+		}
+		v, coalesced, err := f.Do(context.Background(), "k", func() (string, error) {
+			loads.Add(1)
+			waitForCoalesced(t, "test_flight_misses", since, callers-1)
+			c.Set("k", "loaded")
+			return "loaded", nil
+		})
+		if coalesced {
+			shared.Add(1)
+		}
+		return v, err
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := get(); err != nil || v != "loaded" {
+				t.Errorf("get() = %q, %v, want \"loaded\"", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads.Load() != 1 || shared.Load() != callers-1 {
+		t.Errorf("%d loads with %d shared results, want 1 load shared with %d callers", loads.Load(), shared.Load(), callers-1)
+	}
+	// Later misses run the loader again
+	if _, ok := c.Get("k"); !ok {
+		t.Error("the loaded value was not cached")
+	}
+	c.Delete("k")
+	get()
+	if loads.Load() != 2 {
+		t.Errorf("%d loads after the call completed, want 2", loads.Load())
+	}
+}
+
+func TestFlightSharesErrors(t *testing.T) {
+	f := NewFlight[string]("test_flight_errors")
+	errLoad := errors.New("backend unavailable")
+	since := coalesced("test_flight_errors")
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, shared, err := f.Do(context.Background(), "k", func() (string, error) {
+			<-release
+			return "", errLoad
+		})
+		if shared || !errors.Is(err, errLoad) {
+			t.Errorf("Do() = shared %t, %v, want the loader's error", shared, err)
+		}
+	}()
+	// Wait for the call to be in flight before joining it
+	for {
+		f.mu.Lock()
+		n := len(f.calls)
+		f.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A waiter whose request ends gives up without cancelling the call
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, shared, err := f.Do(ctx, "k", nil); !shared || !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() with a cancelled context = shared %t, %v, want context.Canceled", shared, err)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, shared, err := f.Do(context.Background(), "k", nil); !shared || !errors.Is(err, errLoad) {
+			t.Errorf("waiting Do() = shared %t, %v, want the loader's error", shared, err)
+		}
+	}()
+	waitForCoalesced(t, "test_flight_errors", since, 2)
+	close(release)
+	wg.Wait()
+}
+
+func TestFlightPanic(t *testing.T) {
+	f := NewFlight[string]("test_flight_panic")
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		f.Do(context.Background(), "k", func() (string, error) {
+			close(started)
+			<-release
+			panic("loader failed")
+		})
+	}()
+	<-started
+
+	since := coalesced("test_flight_panic")
+	done := make(chan error)
+	go func() {
+		_, _, err := f.Do(context.Background(), "k", nil)
+		done <- err
+	}()
+	waitForCoalesced(t, "test_flight_panic", since, 1)
+	close(release)
+	if err := <-done; !errors.Is(err, errFlightAborted) {
+		t.Errorf("waiting Do() = %v, want errFlightAborted", err)
+	}
+
+	// The key is free for the next call
+	if v, shared, err := f.Do(context.Background(), "k", func() (string, error) { return "v", nil }); v != "v" || shared || err != nil {
+		t.Errorf("Do() after the panic = %q, %t, %v", v, shared, err)
+	}
+}
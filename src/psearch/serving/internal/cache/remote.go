@@ -0,0 +1,229 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"psearch/serving/internal/metrics"
+)
+
+// remoteCooldown is how long the remote tier is bypassed after an error
+const remoteCooldown = 30 * time.Second
+
+// Remote is a Redis tier, such as Memorystore, shared by every replica
+// behind their in-process caches, so replicas do not each warm their own.
+// Entries are stored as JSON with Redis TTLs, and each tag is a Redis set of
+// the keys carrying it.
+//
+// Redis is an optimization: after an error the tier is bypassed for a
+// cool-down, and the caches keep serving from memory alone.
+type Remote struct {
+	client  *redis.Client
+	prefix  string
+	timeout time.Duration
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// NewRemote connects to Redis at addr. Keys are prefixed with prefix so
+// deployments can share an instance, and every operation is bounded by
+// timeout.
+func NewRemote(addr, password string, db int, prefix string, timeout time.Duration) *Remote {
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	})
+	return &Remote{client: client, prefix: prefix, timeout: timeout}
+}
+
+// Close closes the Redis connections. It is safe to call on a nil Remote.
+func (r *Remote) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.client.Close()
+}
+
+// entryKey is the Redis key of a cache entry
+func (r *Remote) entryKey(cache, key string) string {
+	return r.prefix + "entry:" + cache + ":" + key
+}
+
+// tagKey is the Redis key of the set of entries carrying tag
+func (r *Remote) tagKey(cache, tag string) string {
+	return r.prefix + "tag:" + cache + ":" + tag
+}
+
+// available reports whether the tier is outside its cool-down
+func (r *Remote) available() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Now().After(r.downUntil)
+}
+
+// fail records an error and starts a cool-down, logging only the error
+// that started it
+func (r *Remote) fail(cache, op string, err error) {
+	metrics.CacheRequests.WithLabelValues(cache+"_remote", "error").Inc()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Now().After(r.downUntil) {
+		log.Printf("Warning: Redis %s for cache %s failed, using local caches for %s: %v", op, cache, remoteCooldown, err)
+	}
+	r.downUntil = time.Now().Add(remoteCooldown)
+}
+
+// get decodes the entry for key into value, reporting whether it was found
+func (r *Remote) get(cache, key string, value any) bool {
+	if !r.available() {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	data, err := r.client.Get(ctx, r.entryKey(cache, key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		metrics.RecordCacheLookup(cache+"_remote", false)
+		return false
+	}
+	if err != nil {
+		r.fail(cache, "get", err)
+		return false
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		log.Printf("Warning: dropping undecodable Redis entry %s: %v", key, err)
+		metrics.RecordCacheLookup(cache+"_remote", false)
+		return false
+	}
+	metrics.RecordCacheLookup(cache+"_remote", true)
+	return true
+}
+
+// set stores value under key for ttl and adds key to its tags' sets. The
+// value is encoded before set returns, so callers may go on to modify it,
+// and written in the background.
+func (r *Remote) set(cache, key string, value any, tags []string, ttl time.Duration) {
+	if !r.available() {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Warning: could not encode %s cache entry for Redis: %v", cache, err)
+		return
+	}
+	go r.write(cache, key, data, tags, ttl)
+}
+
+// write stores an encoded entry and adds its key to its tags' sets
+func (r *Remote) write(cache, key string, data []byte, tags []string, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	entryKey := r.entryKey(cache, key)
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, entryKey, data, ttl)
+		for _, tag := range tags {
+			// Tag sets outlive their newest entry; stale members are
+			// harmless when deleted
+			pipe.SAdd(ctx, r.tagKey(cache, tag), entryKey)
+			pipe.Expire(ctx, r.tagKey(cache, tag), ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		r.fail(cache, "set", err)
+	}
+}
+
+// delete removes the entries for keys
+func (r *Remote) delete(cache string, keys ...string) {
+	entryKeys := make([]string, len(keys))
+	for i, key := range keys {
+		entryKeys[i] = r.entryKey(cache, key)
+	}
+	r.del(cache, entryKeys)
+}
+
+// invalidateTag removes the entries carrying tag and the tag's set
+func (r *Remote) invalidateTag(cache, tag string) {
+	if !r.available() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	tagKey := r.tagKey(cache, tag)
+	members, err := r.client.SMembers(ctx, tagKey).Result()
+	if err != nil {
+		r.fail(cache, "invalidate", err)
+		return
+	}
+	r.del(cache, append(members, tagKey))
+}
+
+// invalidateMatching removes the entries whose key matches the glob
+// pattern, or every entry and tag set of the cache for "*"
+func (r *Remote) invalidateMatching(cache, pattern string) {
+	if !r.available() {
+		return
+	}
+	// Scans walk the whole keyspace, so allow them more than one round trip
+	ctx, cancel := context.WithTimeout(context.Background(), 10*r.timeout)
+	defer cancel()
+
+	matches := []string{r.entryKey(cache, pattern)}
+	if pattern == "*" {
+		matches = append(matches, r.tagKey(cache, "*"))
+	}
+	var keys []string
+	for _, match := range matches {
+		iter := r.client.Scan(ctx, 0, match, 1000).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			r.fail(cache, "scan", err)
+			return
+		}
+	}
+	r.del(cache, keys)
+}
+
+// del deletes Redis keys
+func (r *Remote) del(cache string, keys []string) {
+	if len(keys) == 0 || !r.available() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		r.fail(cache, "delete", err)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRemote returns a Remote backed by an in-memory Redis server
+func newTestRemote(t *testing.T) (*Remote, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	remote := NewRemote(server.Addr(), "", 0, "psearch:", time.Second)
+	t.Cleanup(func() { remote.Close() })
+	return remote, server
+}
+
+// newReplicaCache returns a cache on the remote tier, as each replica
+// creates one with the same name
+func newReplicaCache(remote *Remote, softTTL, hardTTL time.Duration) *Cache[[]string] {
+	c := NewWithSoftTTL[[]string]("results", 10, softTTL, hardTTL)
+	c.SetRemote(remote)
+	return c
+}
+
+// waitForKey waits for the background write of a Redis key
+func waitForKey(t *testing.T, server *miniredis.Miniredis, key string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.Exists(key) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Redis key %s was not written", key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRemoteSharesEntriesAcrossReplicas(t *testing.T) {
+	remote, server := newTestRemote(t)
+	a := newReplicaCache(remote, time.Hour, 2*time.Hour)
+	b := newReplicaCache(remote, time.Hour, 2*time.Hour)
+
+	a.Set("k", []string{"p1", "p2"}, ProductTag("p1"))
+	waitForKey(t, server, "psearch:entry:results:k")
+	if ttl := server.TTL("psearch:entry:results:k"); ttl != 2*time.Hour {
+		t.Errorf("Redis entry TTL = %s, want the hard TTL", ttl)
+	}
+	if members, _ := server.Members("psearch:tag:results:product:p1"); len(members) != 1 || members[0] != "psearch:entry:results:k" {
+		t.Errorf("tag set = %q, want the entry key", members)
+	}
+
+	v, ok := b.Get("k")
+	if !ok || len(v) != 2 || v[1] != "p2" {
+		t.Fatalf("Get() on another replica = %q, %t, want the shared entry", v, ok)
+	}
+	// The hit is copied into the local tier
+	server.FlushAll()
+	if _, ok := b.getLocal("k"); !ok {
+		t.Error("remote hit was not copied into the local tier")
+	}
+	if stats := b.Stats(); !stats.Remote {
+		t.Error("Stats().Remote = false")
+	}
+}
+
+func TestRemoteKeepsStaleness(t *testing.T) {
+	remote, server := newTestRemote(t)
+	a := newReplicaCache(remote, 30*time.Millisecond, time.Hour)
+	b := newReplicaCache(remote, 30*time.Millisecond, time.Hour)
+
+	a.Set("k", []string{"p1"})
+	waitForKey(t, server, "psearch:entry:results:k")
+	time.Sleep(50 * time.Millisecond)
+
+	// Entries go stale when they were written, not when another replica
+	// first read them
+	if _, stale, ok := b.GetStale("k"); !ok || !stale {
+		t.Errorf("GetStale() on another replica = stale %t, %t, want a stale hit", stale, ok)
+	}
+	if _, stale, ok := b.GetStale("k"); !ok || !stale {
+		t.Errorf("local GetStale() after the remote hit = stale %t, %t, want a stale hit", stale, ok)
+	}
+}
+
+func TestRemoteInvalidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(c *Cache[[]string])
+		wantLeft   []string
+	}{
+		{"tag", func(c *Cache[[]string]) { c.InvalidateTag(QueryTag("shoes")) }, []string{"psearch:entry:results:socks", "psearch:tag:results:query:socks"}},
+		{"key pattern", func(c *Cache[[]string]) { c.InvalidateKeys("sho*") }, []string{"psearch:entry:results:socks", "psearch:tag:results:query:shoes", "psearch:tag:results:query:socks"}},
+		{"delete", func(c *Cache[[]string]) { c.Delete("socks") }, []string{"psearch:entry:results:shoes", "psearch:tag:results:query:shoes", "psearch:tag:results:query:socks"}},
+		{"purge", func(c *Cache[[]string]) { c.Purge() }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote, server := newTestRemote(t)
+			a := newReplicaCache(remote, time.Hour, time.Hour)
+			b := newReplicaCache(remote, time.Hour, time.Hour)
+
+			a.Set("shoes", []string{"p1"}, QueryTag("shoes"))
+			a.Set("socks", []string{"p2"}, QueryTag("socks"))
+			waitForKey(t, server, "psearch:tag:results:query:shoes")
+			waitForKey(t, server, "psearch:tag:results:query:socks")
+
+			// Invalidating on one replica removes the entries for every
+			// replica that has not cached them locally yet
+			tt.invalidate(b)
+			keys := server.Keys()
+			if len(keys) != len(tt.wantLeft) {
+				t.Fatalf("Redis keys = %q, want %q", keys, tt.wantLeft)
+			}
+			for i := range keys {
+				if keys[i] != tt.wantLeft[i] {
+					t.Fatalf("Redis keys = %q, want %q", keys, tt.wantLeft)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteRejectsUnusableEntries(t *testing.T) {
+	remote, server := newTestRemote(t)
+	c := newReplicaCache(remote, time.Hour, time.Hour)
+
+	// An entry Redis has not expired yet, written with an earlier expiry
+	server.Set("psearch:entry:results:expired", `{"value":["p1"],"stale_at":"2020-01-01T00:00:00Z","expires":"2020-01-01T00:00:00Z"}`)
+	server.Set("psearch:entry:results:garbled", `{"value":`)
+	for _, key := range []string{"expired", "garbled", "missing"} {
+		if v, ok := c.Get(key); ok {
+			t.Errorf("Get(%s) = %q, want a miss", key, v)
+		}
+	}
+	if !remote.available() {
+		t.Error("unusable entries started a cool-down")
+	}
+}
+
+func TestRemoteCooldown(t *testing.T) {
+	remote, server := newTestRemote(t)
+	a := newReplicaCache(remote, time.Hour, time.Hour)
+	b := newReplicaCache(remote, time.Hour, time.Hour)
+	a.Set("k", []string{"p1"})
+	waitForKey(t, server, "psearch:entry:results:k")
+
+	server.SetError("LOADING Redis is loading the dataset in memory")
+	if _, ok := b.Get("k"); ok {
+		t.Error("Get() hit while Redis fails")
+	}
+	if remote.available() {
+		t.Fatal("Redis error did not start a cool-down")
+	}
+
+	// The local tier keeps working, and Redis is bypassed until the
+	// cool-down ends even once it recovers
+	server.SetError("")
+	b.Set("local", []string{"p2"})
+	if v, ok := b.Get("local"); !ok || v[0] != "p2" {
+		t.Errorf("local Get() during the cool-down = %q, %t", v, ok)
+	}
+	if _, ok := b.Get("k"); ok {
+		t.Error("Get() read Redis during the cool-down")
+	}
+	if server.Exists("psearch:entry:results:local") {
+		t.Error("Set() wrote to Redis during the cool-down")
+	}
+
+	remote.mu.Lock()
+	remote.downUntil = time.Now()
+	remote.mu.Unlock()
+	if _, ok := b.Get("k"); !ok {
+		t.Error("Get() after the cool-down missed the Redis entry")
+	}
+}
+
+func TestRemoteNil(t *testing.T) {
+	var remote *Remote
+	if err := remote.Close(); err != nil {
+		t.Errorf("Close() of a nil Remote = %v", err)
+	}
+	c := newReplicaCache(nil, time.Hour, time.Hour)
+	c.Set("k", []string{"p1"})
+	if _, ok := c.Get("k"); !ok || c.Stats().Remote {
+		t.Error("cache with a nil Remote is not a working local cache")
+	}
+}
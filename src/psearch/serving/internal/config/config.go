@@ -17,9 +17,15 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -29,6 +35,8 @@ type Config struct {
 	// Server configuration
 	Port        int
 	Environment string
+	// ShutdownDrainTimeout bounds how long in-flight requests may run after SIGTERM
+	ShutdownDrainTimeout time.Duration
 
 	// Google Cloud configuration
 	ProjectID          string
@@ -37,11 +45,683 @@ type Config struct {
 	SpannerDatabaseID  string
 	GeminiModelName    string
 	EmbeddingDimension int
+	// EmbeddingOutputDimensionality asks Vertex AI for EmbeddingDimension
+	// values (outputDimensionality), so Matryoshka models such as
+	// text-embedding-005 serve shorter vectors directly. Disable it for
+	// models that reject the parameter.
+	EmbeddingOutputDimensionality bool
+	// EmbeddingTruncate cuts embeddings longer than EmbeddingDimension to
+	// size and renormalizes them, for Matryoshka models that ignore
+	// outputDimensionality. Otherwise embeddings of any other dimension
+	// are rejected.
+	EmbeddingTruncate bool
+	// EmbeddingProvider selects the embedding backend: "vertex" for Vertex
+	// AI text embedding models, "tei" for a self-hosted Text Embeddings
+	// Inference (or compatible ONNX) server, or "openai" for an
+	// OpenAI-compatible embeddings API, for deployments that cannot reach
+	// Vertex AI. GeminiModelName is the model vertex and openai embed with.
+	EmbeddingProvider string
+	// EmbeddingEndpoint is the base URL of the tei or openai backend
+	EmbeddingEndpoint string
+	// EmbeddingAPIKey is sent as a bearer token to the tei or openai
+	// backend when set
+	EmbeddingAPIKey string
+	// EmbeddingQueryPrefix and EmbeddingDocumentPrefix are prepended to
+	// query and product text by the tei and openai backends, which take no
+	// task type, for models trained with instructions such as E5's
+	// "query: " and "passage: "
+	EmbeddingQueryPrefix    string
+	EmbeddingDocumentPrefix string
+
+	// EmbeddingVersions are product embedding columns served side by side
+	// with DefaultEmbeddingVersion (the embedding column, embedded by
+	// GeminiModelName), each embedded by its own model, so a new model can
+	// be compared with the current one and cut over without downtime.
+	// Product writes embed every version. Searches use
+	// ServingEmbeddingVersion unless the request or an experiment arm picks
+	// another.
+	EmbeddingVersions       []EmbeddingVersion
+	ServingEmbeddingVersion string
+
+	// DevMode runs the service without GCP credentials: Spanner calls go to
+	// the emulator at SpannerEmulatorHost, query embeddings come from a
+	// deterministic local embedder, and other Google APIs are called
+	// unauthenticated, so features depending on them degrade
+	DevMode             bool
+	SpannerEmulatorHost string
 
 	// Application defaults
 	DefaultAlpha  float64
 	DefaultLimit  int
 	MinScoreValue float64
+	RRFK          int
+
+	// Search execution. "sql" fuses the ANN and FTS branches in a single
+	// statement; "parallel" runs each branch as its own query against a
+	// shared snapshot and fuses them in the service. Parallel branches
+	// retrieve at least ANNCandidateLimit and FTSCandidateLimit candidates.
+	SearchExecution   string
+	ANNCandidateLimit int
+	FTSCandidateLimit int
+	// ANN tuning. ANNNumLeavesToSearch is how many vector index leaves a
+	// lookup searches, ANNCandidateMultiplier scales the candidates the ANN
+	// branch ranks beyond the page, and ANNDistanceMetric is "cosine" or
+	// "dot_product" (which needs its own vector index). Search requests may
+	// override them.
+	ANNNumLeavesToSearch   int
+	ANNCandidateMultiplier float64
+	ANNDistanceMetric      string
+	// FTSFields are the tokenized product fields the full-text branch
+	// searches. A product matches if any field matches, and its text score
+	// is the weighted sum of the fields' scores.
+	FTSFields []FTSField
+	// FTSDialect is the SEARCH dialect of the full-text branch: rquery
+	// parses OR, -exclusions and quoted phrases, words requires every word
+	// and words_phrase requires the words as one phrase.
+	// FTSMinimumShouldMatch is how many of a query's terms a product must
+	// match in the rquery dialect (see MinimumShouldMatch), and with
+	// FTSPhraseMatching quoted parts of the query match as exact phrases.
+	// FTSEnhanceQuery lets Spanner also match synonyms and spelling
+	// variants of the query words. Search requests may override them.
+	FTSDialect            string
+	FTSMinimumShouldMatch string
+	FTSPhraseMatching     bool
+	FTSEnhanceQuery       bool
+
+	// Vertex AI resilience. Embedding calls are retried with jittered
+	// exponential backoff; after CircuitBreakerFailureThreshold consecutive
+	// failures the breaker opens for CircuitBreakerOpenDuration. While
+	// embeddings are unavailable, hybrid searches fall back to keyword-only
+	// search if EmbeddingFallbackToKeyword is set.
+	VertexMaxAttempts              int
+	VertexRetryInitialBackoff      time.Duration
+	VertexRetryMaxBackoff          time.Duration
+	CircuitBreakerFailureThreshold int
+	CircuitBreakerOpenDuration     time.Duration
+	EmbeddingFallbackToKeyword     bool
+	// VertexEndpoint overrides the REGION-aiplatform.googleapis.com host
+	// Vertex AI models are called on, for example with a Private Service
+	// Connect endpoint or another region's host
+	VertexEndpoint string
+
+	// Deadline budgets. RequestTimeout bounds each API request; within it,
+	// query embedding gets EmbeddingBudget (hybrid searches fall back to
+	// keyword-only results when it runs out) and the search query gets
+	// SpannerBudget. Zero disables a budget.
+	RequestTimeout  time.Duration
+	EmbeddingBudget time.Duration
+	SpannerBudget   time.Duration
+
+	// SLO latency thresholds. Shopper-facing requests completing within
+	// SLOLatencyThreshold count as good for the latency SLI;
+	// SLOLatencyThresholds overrides it per route.
+	SLOLatencyThreshold  time.Duration
+	SLOLatencyThresholds map[string]time.Duration
+
+	// Reranking configuration
+	RerankModel    string
+	RerankConfigID string
+	RerankTopN     int
+
+	// DedupeResultsEnabled drops results sharing a canonical URI or GTIN
+	// with a higher-ranked result. Searches retrieve DedupeOverfetch times
+	// the requested results so deduplicated pages stay full.
+	DedupeResultsEnabled bool
+	DedupeOverfetch      int
+
+	// FilterableAttributes lists custom attribute keys that filters may
+	// reference as attributes.<key>
+	FilterableAttributes []string
+
+	// Facet settings for searches that set facets. Facets are derived from
+	// the attributes products mark indexable, counted over the top
+	// FacetCandidates results. Up to FacetMaxFacets attributes are
+	// returned, each with its FacetMaxValues most common values held by at
+	// least FacetMinCount results.
+	FacetCandidates int
+	FacetMaxFacets  int
+	FacetMaxValues  int
+	FacetMinCount   int
+
+	// SortCandidates is how many candidates each retrieval branch ranks for
+	// searches sorted by a field other than relevance. The candidate set
+	// does not depend on the page, so sorted pages stay consistent; pages
+	// beyond it are empty.
+	SortCandidates int
+
+	// Request caps. Searches, browses and similar-product and image
+	// searches asking for fewer than one or more than MaxResultLimit
+	// results or starting past MaxResultOffset, queries longer than
+	// MaxQueryLength characters and filters with more than
+	// MaxFilterConditions conditions (ranges included) are rejected.
+	MaxResultLimit      int
+	MaxResultOffset     int
+	MaxQueryLength      int
+	MaxFilterConditions int
+
+	// Local availability settings for searches by shopper location or
+	// store. Location searches consider the LocalMaxStores nearest stores
+	// within LocalRadiusKm. With local_availability=boost, products in
+	// stock nearby have their fused score scaled by up to
+	// 1 + LocalBoostWeight, tapering to 1 at the edge of the radius.
+	LocalRadiusKm    float64
+	LocalMaxStores   int
+	LocalBoostWeight float64
+
+	// Cache sizes (entries) and TTLs; a size of 0 disables the cache.
+	// Cached search results are served fresh until ResultCacheSoftTTL, then
+	// served stale while a background refresh runs, until ResultCacheTTL.
+	// With ResultCacheCoalesce, identical searches that miss the cache at
+	// the same time share a single execution.
+	EmbeddingCacheSize        int
+	EmbeddingCacheTTL         time.Duration
+	ResultCacheSize           int
+	ResultCacheSoftTTL        time.Duration
+	ResultCacheTTL            time.Duration
+	ResultCacheRefreshTimeout time.Duration
+	ResultCacheCoalesce       bool
+	ProductCacheSize   int
+	ProductCacheTTL    time.Duration
+
+	// Redis (e.g. Memorystore) backs the embedding and result caches when
+	// RedisAddr is set, so replicas share cached entries. Keys are prefixed
+	// with RedisKeyPrefix and each operation is bounded by RedisTimeout;
+	// while Redis fails, replicas fall back to their local caches.
+	RedisAddr      string
+	RedisPassword  string
+	RedisDB        int
+	RedisKeyPrefix string
+	RedisTimeout   time.Duration
+
+	// CatalogCurrencyCode is the ISO 4217 currency of the catalog, used for
+	// products that store no currency and to flag those that store another
+	CatalogCurrencyCode string
+
+	// ExchangeRates converts prices for shoppers asking for another
+	// currency: units of each currency per unit of CatalogCurrencyCode.
+	// When ExchangeRatesURL is set, the feed replaces them every
+	// ExchangeRatesRefreshInterval. DefaultLocale formats prices for
+	// requests that name no locale.
+	ExchangeRates                map[string]float64
+	ExchangeRatesURL             string
+	ExchangeRatesRefreshInterval time.Duration
+	DefaultLocale                string
+
+	// CatalogIDs lists the catalogs (brands, regions) served from the
+	// products table's catalog_id column. Empty means a single-tenant
+	// deployment where requests are not scoped. Requests without a
+	// catalog_id use DefaultCatalogID, if set.
+	CatalogIDs       []string
+	DefaultCatalogID string
+
+	// Product quality scoring. Titles shorter than QualityMinTitleLength
+	// count as an issue, and products scoring below QualityLowScoreThreshold
+	// are low quality. With QualityDemotionEnabled their search score is
+	// multiplied by QualityDemotionFactor.
+	QualityMinTitleLength    int
+	QualityLowScoreThreshold float64
+	QualityDemotionEnabled   bool
+	QualityDemotionFactor    float64
+
+	// Popularity boosts the search score by PopularityWeight times the log
+	// of the product's PopularitySignal count in product_stats, "purchases"
+	// or "clicks". A weight of 0 disables the boost.
+	PopularityWeight float64
+	PopularitySignal string
+
+	// Spell correction suggests corrected_query for misspelled words using a
+	// dictionary of product title terms rebuilt every
+	// SpellDictionaryRefreshInterval, and retries zero-result searches with it
+	SpellCorrectionEnabled         bool
+	SpellDictionaryRefreshInterval time.Duration
+
+	// Head query precomputation pins embeddings for the HeadQueryTopK most
+	// searched queries in the head_queries table, refreshed every
+	// HeadQueryRefreshInterval and when the catalog changes. With
+	// HeadQueryPrecomputeResults their default result sets are also cached.
+	HeadQueryPrecomputeEnabled bool
+	HeadQueryTopK              int
+	HeadQueryRefreshInterval   time.Duration
+	HeadQueryPrecomputeResults bool
+	HeadQueryConcurrency       int
+
+	// Recall monitoring compares the ANN index's top RecallTopK products
+	// with the exact nearest neighbours for RecallSampleSize head queries,
+	// every RecallMonitorInterval and when the catalog changes. Mean recall
+	// below RecallAlertThreshold is logged as a warning.
+	RecallMonitorEnabled  bool
+	RecallMonitorInterval time.Duration
+	RecallSampleSize      int
+	RecallTopK            int
+	RecallAlertThreshold  float64
+
+	// Tail query sampling stores a weekly sample of search_events queries
+	// outside the TailHeadSize most searched, TailSamplePerStratum per
+	// search volume stratum, with their top TailSampleResults results.
+	TailSamplingEnabled  bool
+	TailHeadSize         int
+	TailSamplePerStratum int
+	TailSampleResults    int
+
+	// Query analytics adds each instance's per-query search volume,
+	// zero-result count and latency to hourly totals in query_analytics
+	// every AnalyticsFlushInterval. Queries beyond the
+	// AnalyticsMaxQueries distinct ones of an interval are counted
+	// together. Trending queries need AnalyticsTrendingMinSearches.
+	AnalyticsEnabled             bool
+	AnalyticsFlushInterval       time.Duration
+	AnalyticsMaxQueries          int
+	AnalyticsTrendingMinSearches int
+
+	// Query templates are cached per instance; edits made through another
+	// instance take effect within QueryTemplateCacheTTL
+	QueryTemplateCacheSize int
+	QueryTemplateCacheTTL  time.Duration
+
+	// Scoring profiles are reloaded from Spanner on this interval, so edits
+	// made through another instance take effect within it
+	ScoringProfileRefreshInterval time.Duration
+
+	// Merchandising rules are reloaded from Spanner on this interval, so
+	// edits made through another instance take effect within it
+	MerchandisingRuleRefreshInterval time.Duration
+
+	// Experiments are reloaded from Spanner on this interval, so edits
+	// made through another instance take effect within it
+	ExperimentRefreshInterval time.Duration
+
+	// Runtime config overrides persisted through the admin API are reloaded
+	// from Spanner on this interval, so they reach every instance within it
+	RuntimeConfigRefreshInterval time.Duration
+
+	// Catalog versions are reloaded from Spanner on this interval. A new
+	// version stops cached results of the old one from being served.
+	CatalogVersionRefreshInterval time.Duration
+
+	// Personalization blends a user's preference embedding into the query
+	// embedding with PersonalizationWeight before vector search. Embeddings
+	// learned from clicks move toward each clicked product by
+	// UserProfileLearningRate and are cached per instance.
+	PersonalizationWeight   float64
+	UserProfileLearningRate float64
+	UserProfileCacheSize    int
+	UserProfileCacheTTL     time.Duration
+
+	// Session context settings. Searches and clicks that name a session_id
+	// are remembered for SessionTTL: follow-ups like "cheaper ones" are
+	// resolved against the session's last search, and the products clicked
+	// personalize its searches with SessionPersonalizationWeight when the
+	// shopper has no profile of their own. Sessions live in the local cache
+	// of up to SessionCacheSize sessions, and in Redis when REDIS_ADDR is
+	// set so every replica sees them.
+	SessionContextEnabled        bool
+	SessionTTL                   time.Duration
+	SessionCacheSize             int
+	SessionMaxQueries            int
+	SessionPersonalizationWeight float64
+
+	// AuthMethods lists the accepted credentials for API requests: api_key
+	// (APIKeys, sent in X-API-Key), google_id_token (Google-signed ID tokens
+	// for AuthAudience, e.g. Cloud Run service-to-service calls) and
+	// firebase (Firebase Auth user tokens). Empty disables authentication.
+	AuthMethods []string
+	// APIKeys maps client names, used in logs and metrics, to API keys
+	APIKeys map[string]string
+	// AuthAudience is the audience Google ID tokens must be issued for
+	AuthAudience string
+	// AuthAllowedServiceAccounts restricts Google ID tokens to these emails;
+	// empty accepts any token for AuthAudience
+	AuthAllowedServiceAccounts []string
+	// FirebaseProjectID is the Firebase project issuing user tokens,
+	// defaulting to ProjectID
+	FirebaseProjectID string
+
+	// AdminAPIKey enables the /admin endpoints, which require it in the
+	// X-API-Key header. Admin endpoints are disabled when it is empty.
+	AdminAPIKey string
+
+	// CORS policy for browser clients such as SPA storefronts.
+	// AllowedOrigins lists exact origins, wildcard subdomains such as
+	// https://*.example.com, or "*" for any origin; "none" disables CORS.
+	// Credentials are only allowed for origins that are not "*". Preflight
+	// responses allow AllowedMethods and AllowedHeaders and are cached by
+	// browsers for CORSMaxAge.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	CORSMaxAge     time.Duration
+
+	// ReadinessTimeout bounds each dependency check of the readiness probe
+	ReadinessTimeout time.Duration
+
+	// Startup warm-up. With WarmupEnabled, the instance only reports ready
+	// once it has opened WarmupSessions Spanner sessions, fetched a Vertex
+	// AI access token and run a canary embedding and search for
+	// WarmupQuery, or WarmupTimeout has passed.
+	WarmupEnabled  bool
+	WarmupTimeout  time.Duration
+	WarmupSessions int
+	WarmupQuery    string
+
+	// Concurrency pools. Each priority class of endpoints (interactive
+	// shopper traffic high, admin medium, exports and batch jobs low) serves
+	// at most its limit of requests at once, so low priority work can never
+	// starve search. Requests wait up to ConcurrencyQueueTimeout for a slot
+	// before being rejected with 503. Zero disables a class's limit.
+	HighPriorityConcurrency   int
+	MediumPriorityConcurrency int
+	LowPriorityConcurrency    int
+	ConcurrencyQueueTimeout   time.Duration
+
+	// Batch endpoint limits
+	MaxBatchSearchSize     int
+	BatchSearchConcurrency int
+	MaxBatchGetSize        int
+
+	// ConsistencyTokenTTL bounds how old a pagination snapshot may be; it must
+	// stay within the database's version retention period
+	ConsistencyTokenTTL time.Duration
+
+	// Refinement settings. Searches return a refinement_token naming the
+	// IDs of their results, kept for RefinementTTL in a cache of up to
+	// RefinementCacheSize result sets, which refine_from scopes later
+	// searches to.
+	RefinementEnabled   bool
+	RefinementTTL       time.Duration
+	RefinementCacheSize int
+
+	// SpannerStaleness lets searches and batch gets read slightly stale data
+	// so Spanner can serve them from the nearest replica. Zero means strong
+	// reads. SpannerStalenessMode is "exact" or "max".
+	SpannerStaleness     time.Duration
+	SpannerStalenessMode string
+
+	// Search hedging. With SearchHedgingEnabled, a single-statement search
+	// query that has not returned after the HedgePercentile of recent
+	// search query latencies, and at least HedgeMinDelay, is raced by a
+	// second attempt reading data up to HedgeStaleness old; the first to
+	// respond is served.
+	SearchHedgingEnabled bool
+	HedgePercentile      float64
+	HedgeMinDelay        time.Duration
+	HedgeStaleness       time.Duration
+
+	// Spanner client tuning. The session pool keeps between SpannerMinSessions
+	// and SpannerMaxSessions sessions, creating at most SpannerMaxBurst at a
+	// time. Queries run with SpannerOptimizerVersion and, when set,
+	// SpannerQueryPriority (LOW, MEDIUM or HIGH).
+	SpannerMinSessions      int
+	SpannerMaxSessions      int
+	SpannerMaxBurst         int
+	SpannerOptimizerVersion string
+	SpannerQueryPriority    string
+
+	// Tracing configuration
+	TracingEnabled  bool
+	TraceSampleRate float64
+
+	// Latency regression detection
+	RegressionDetectionEnabled bool
+	RegressionAlertTopic       string
+	RegressionThreshold        float64
+	RegressionMinSamples       int
+	RegressionWindow           time.Duration
+	RegressionAlertCooldown    time.Duration
+
+	// Product change event settings. Price drops smaller than
+	// PriceDropMinPercent are recorded but not emitted.
+	ProductEventsTopic  string
+	PriceDropMinPercent float64
+
+	// Search events (impressions, clicks, add-to-carts and purchases) are
+	// written to the search_events table, or published to
+	// SearchEventsTopic when SearchEventsSink is "pubsub". A request holds
+	// at most MaxEventBatchSize events.
+	SearchEventsSink  string
+	SearchEventsTopic string
+	MaxEventBatchSize int
+
+	// Search logs (query, filter, latency and ranked results of every
+	// search) are streamed to the BigQuery table SearchLogTable, as
+	// "dataset.table" in ProjectID or "project.dataset.table", when
+	// SearchLogsEnabled. Logs are buffered up to SearchLogBufferSize and
+	// dropped beyond it, and written in batches of SearchLogBatchSize at
+	// least every SearchLogFlushInterval.
+	SearchLogsEnabled      bool
+	SearchLogTable         string
+	SearchLogBufferSize    int
+	SearchLogBatchSize     int
+	SearchLogFlushInterval time.Duration
+
+	// Re-embedding jobs write product embeddings from ReembedModel (the
+	// serving model when empty), of ReembedDimension (EmbeddingDimension
+	// when zero), to the products column ReembedColumn. Jobs call Vertex AI
+	// from ReembedConcurrency goroutines at most ReembedRatePerSecond times
+	// a second, to stay within quota alongside serving traffic.
+	ReembedModel         string
+	ReembedDimension     int
+	ReembedColumn        string
+	ReembedRatePerSecond float64
+	ReembedConcurrency   int
+
+	// Image search embeds shopper images with ImageEmbeddingModel, a Vertex
+	// AI multimodal embedding model, and finds the products with the
+	// nearest image_embedding, which re-embedding jobs with source image
+	// fill in from product images. ImageEmbeddingDimension is 128, 256,
+	// 512 or 1408; uploads are limited to ImageSearchMaxBytes.
+	ImageSearchEnabled      bool
+	ImageEmbeddingModel     string
+	ImageEmbeddingDimension int
+	ImageSearchMaxBytes     int64
+
+	// Indexing worker settings ("server index-worker"). The worker pulls
+	// product change events from IndexingSubscription, up to
+	// IndexingMaxMessages at a time, and applies them with
+	// IndexingConcurrency goroutines. Events that are invalid, or still fail
+	// after IndexingMaxAttempts deliveries, are published to
+	// IndexingDeadLetterTopic, or dropped if it is empty.
+	IndexingSubscription    string
+	IndexingDeadLetterTopic string
+	IndexingMaxAttempts     int
+	IndexingConcurrency     int
+	IndexingMaxMessages     int
+
+	// Query understanding settings. Disabled by default because it adds a
+	// Gemini call to every search. The model is also used for LLM query
+	// expansion.
+	QueryUnderstandingEnabled bool
+	QueryUnderstandingModel   string
+	QueryUnderstandingTimeout time.Duration
+
+	// Answer settings for POST /answer, which has AnswerModel answer a
+	// question from the top AnswerTopK hybrid search results. Disabled by
+	// default because every answer is a Gemini call.
+	AnswerEnabled bool
+	AnswerModel   string
+	AnswerTopK    int
+	AnswerTimeout time.Duration
+
+	// LanguageDetectionEnabled detects the language of queries that name
+	// none, so the FTS branch tokenizes them with that language's rules
+	LanguageDetectionEnabled bool
+
+	// Query normalization. QueryNormalization lists the steps applied to
+	// queries before they are embedded, keyword searched and cached: nfc,
+	// lowercase and punctuation rewrite the query itself, while stopwords
+	// and stemming only shape the FTS branch's keywords, using the rules of
+	// the query's language or QueryNormalizationLanguage when it names none.
+	// Stemming ORs each word with its stem, so it only helps if the token
+	// index holds that form too. Disabled by default.
+	QueryNormalization         []string
+	QueryNormalizationLanguage string
+
+	// Query expansion settings for searches that set expand_query.
+	// QueryExpansionMethod is "rules" or "llm".
+	QueryExpansionMethod      string
+	QueryExpansionMaxVariants int
+	QueryExpansionTimeout     time.Duration
+
+	// Multi-query settings. Queries of at least MultiQueryMinWords words are
+	// split into up to MultiQueryMaxSubQueries noun phrases, each searched
+	// with its own ANN branch.
+	MultiQueryEnabled       bool
+	MultiQueryMinWords      int
+	MultiQueryMaxSubQueries int
+
+	// Identifier search settings. Single-token queries that match SKUPattern
+	// and contain a digit are looked up by exact product ID or GTIN, with no
+	// embedding, before falling back to hybrid search.
+	SKUDetectionEnabled bool
+	SKUPattern          *regexp.Regexp
+
+	// Saved searches settings. SavedSearchMaxDistance is the cosine distance
+	// under which a new product counts as a semantic match. Every
+	// SavedSearchEvaluationInterval, each saved search is also re-run and its
+	// top SavedSearchEvaluationLimit results checked for new matches; zero
+	// disables the scheduled evaluation. Webhooks must be https; when
+	// SavedSearchWebhookHosts is set only those hosts are accepted,
+	// otherwise any host resolving to a public address.
+	SavedSearchTopic              string
+	SavedSearchMaxDistance        float64
+	SavedSearchEvaluationInterval time.Duration
+	SavedSearchEvaluationLimit    int
+	SavedSearchWebhookHosts       []string
+
+	// Feature flags gate optional search behaviors, for gradual rollouts.
+	// FeatureFlags holds the state of every flag in FeatureFlagDefaults as
+	// FEATURE_FLAGS sets it; runtime config overrides and, if
+	// FeatureFlagOverridesEnabled, a request's own overrides take
+	// precedence. Diversified results hold at most
+	// DiversificationMaxPerBrand results of a brand until every other
+	// brand's results have had as many places.
+	FeatureFlags                map[string]bool
+	FeatureFlagOverridesEnabled bool
+	DiversificationMaxPerBrand  int
+}
+
+// Feature flag names
+const (
+	// FlagRerank allows searches to be reranked
+	FlagRerank = "rerank"
+	// FlagQueryRewriting allows query understanding and expansion to
+	// rewrite the query with the LLM
+	FlagQueryRewriting = "query_rewriting"
+	// FlagDiversification spreads results across brands
+	FlagDiversification = "diversification"
+)
+
+// FeatureFlagDefaults are the feature flags and their states unless
+// FEATURE_FLAGS sets them
+var FeatureFlagDefaults = map[string]bool{
+	FlagRerank:          true,
+	FlagQueryRewriting:  true,
+	FlagDiversification: false,
+}
+
+// FeatureFlagNames returns the names of the feature flags, sorted
+func FeatureFlagNames() []string {
+	return slices.Sorted(maps.Keys(FeatureFlagDefaults))
+}
+
+// QueryNormalizationSteps are the steps QUERY_NORMALIZATION can list
+var QueryNormalizationSteps = []string{"nfc", "lowercase", "punctuation", "stopwords", "stemming"}
+
+// FTSFieldNames are the product fields full-text search can cover
+var FTSFieldNames = []string{"title", "description", "brands", "attributes"}
+
+// The SEARCH dialects FTS_DIALECT can name
+const (
+	FTSDialectRQuery      = "rquery"
+	FTSDialectWords       = "words"
+	FTSDialectWordsPhrase = "words_phrase"
+)
+
+// MinimumShouldMatch returns how many of a query's terms terms a product
+// must match under spec: a count such as "2", a negative count of terms
+// that may be missing such as "-1", or a percentage of the terms, rounded
+// down, such as "75%" or "-25%". The result is clamped to between 1 and
+// terms, and an empty spec requires every term.
+func MinimumShouldMatch(spec string, terms int) (int, error) {
+	if spec == "" {
+		return terms, nil
+	}
+	number, percent := strings.CutSuffix(spec, "%")
+	n, err := strconv.Atoi(number)
+	if err != nil || (percent && (n < -100 || n > 100)) {
+		return 0, fmt.Errorf("minimum should match must be a count or a percentage between -100%% and 100%%, got %q", spec)
+	}
+	if percent {
+		n = n * terms / 100
+	}
+	if n < 0 || (n == 0 && strings.HasPrefix(number, "-")) {
+		n += terms
+	}
+	return min(max(n, 1), terms), nil
+}
+
+// FTSField is a product field searched by the full-text branch, with the
+// weight of its match score
+type FTSField struct {
+	Name   string
+	Weight float64
+}
+
+// DefaultEmbeddingVersion names the version stored in the products
+// embedding column
+const DefaultEmbeddingVersion = "default"
+
+// EmbeddingColumnPattern restricts the products columns additional
+// embedding versions are stored in
+var EmbeddingColumnPattern = regexp.MustCompile(`^embedding_[a-z0-9_]{1,48}$`)
+
+// embeddingVersionNamePattern restricts embedding version names, which
+// requests and experiment arms refer to
+var embeddingVersionNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// EmbeddingVersion is a products embedding column and the model embedding
+// products and queries for it
+type EmbeddingVersion struct {
+	Name      string
+	Column    string
+	Model     string
+	Dimension int
+}
+
+// EmbeddingVersion returns the named embedding version, which may be
+// DefaultEmbeddingVersion
+func (c *Config) EmbeddingVersion(name string) (EmbeddingVersion, bool) {
+	if name == DefaultEmbeddingVersion {
+		return EmbeddingVersion{Name: name, Column: "embedding", Model: c.GeminiModelName, Dimension: c.EmbeddingDimension}, true
+	}
+	for _, version := range c.EmbeddingVersions {
+		if version.Name == name {
+			return version, true
+		}
+	}
+	return EmbeddingVersion{}, false
+}
+
+// ResolveCatalog returns the catalog a request or event naming requested
+// is scoped to. Without CatalogIDs the deployment is single-tenant and
+// nothing is scoped; otherwise an empty requested falls back to
+// DefaultCatalogID. Errors describe why requested is invalid.
+func (c *Config) ResolveCatalog(requested string) (string, error) {
+	if len(c.CatalogIDs) == 0 {
+		if requested != "" {
+			return "", errors.New("catalog_id is not supported: this deployment serves a single catalog")
+		}
+		return "", nil
+	}
+	if requested == "" {
+		requested = c.DefaultCatalogID
+	}
+	if requested == "" {
+		return "", errors.New("catalog_id is required")
+	}
+	if !slices.Contains(c.CatalogIDs, requested) {
+		return "", fmt.Errorf("unknown catalog_id %q", requested)
+	}
+	return requested, nil
 }
 
 // Load loads configuration from environment variables with fallbacks to defaults
@@ -53,11 +733,200 @@ func Load() (*Config, error) {
 	config := &Config{
 		Port:              8080,
 		Environment:       "development",
+		ShutdownDrainTimeout: 10 * time.Second,
 		GeminiModelName:   "text-multilingual-embedding-002",
 		EmbeddingDimension: 768,
 		DefaultAlpha:      0.5,
 		DefaultLimit:      100,
 		MinScoreValue:     0.0,
+		RRFK:              60,
+		SearchExecution:   "sql",
+
+		ANNNumLeavesToSearch:   10,
+		ANNCandidateMultiplier: 1,
+
+		FTSDialect:            FTSDialectRQuery,
+		FTSMinimumShouldMatch: "100%",
+		FTSPhraseMatching:     true,
+
+		RerankModel:    "semantic-ranker-default@latest",
+		RerankConfigID: "default_ranking_config",
+		RerankTopN:     50,
+
+		DedupeOverfetch: 2,
+
+		FacetCandidates: 200,
+		FacetMaxFacets:  10,
+		FacetMaxValues:  10,
+		FacetMinCount:   1,
+
+		SortCandidates: 200,
+
+		MaxResultLimit:      500,
+		MaxResultOffset:     10000,
+		MaxQueryLength:      1024,
+		MaxFilterConditions: 20,
+
+		LocalRadiusKm:    25,
+		LocalMaxStores:   50,
+		LocalBoostWeight: 0.5,
+
+		VertexMaxAttempts:              3,
+		VertexRetryInitialBackoff:      100 * time.Millisecond,
+		VertexRetryMaxBackoff:          2 * time.Second,
+		CircuitBreakerFailureThreshold: 5,
+		CircuitBreakerOpenDuration:     30 * time.Second,
+		EmbeddingFallbackToKeyword:     true,
+
+		RequestTimeout:  5 * time.Second,
+		EmbeddingBudget: 300 * time.Millisecond,
+		SpannerBudget:   700 * time.Millisecond,
+
+		SLOLatencyThreshold: time.Second,
+
+		EmbeddingCacheSize: 10000,
+		EmbeddingCacheTTL:  24 * time.Hour,
+		ResultCacheSize:    5000,
+		ResultCacheSoftTTL: 30 * time.Second,
+		ResultCacheTTL:     10 * time.Minute,
+		ResultCacheRefreshTimeout: 10 * time.Second,
+		ResultCacheCoalesce:       true,
+		ProductCacheSize:   20000,
+		ProductCacheTTL:    5 * time.Minute,
+
+		RedisKeyPrefix: "psearch:",
+		RedisTimeout:   100 * time.Millisecond,
+
+		CatalogCurrencyCode: "USD",
+
+		ExchangeRatesRefreshInterval: time.Hour,
+		DefaultLocale:                "en-US",
+
+		QualityMinTitleLength:    15,
+		QualityLowScoreThreshold: 0.5,
+		QualityDemotionFactor:    0.5,
+
+		PopularitySignal: "purchases",
+
+		SpellCorrectionEnabled:         true,
+		SpellDictionaryRefreshInterval: time.Hour,
+
+		QueryTemplateCacheSize: 1000,
+		QueryTemplateCacheTTL:  time.Minute,
+
+		ScoringProfileRefreshInterval:    time.Minute,
+		CatalogVersionRefreshInterval:    15 * time.Second,
+		MerchandisingRuleRefreshInterval: time.Minute,
+		ExperimentRefreshInterval:        time.Minute,
+		RuntimeConfigRefreshInterval:     time.Minute,
+
+		PersonalizationWeight:   0.2,
+		UserProfileLearningRate: 0.1,
+		UserProfileCacheSize:    10000,
+		UserProfileCacheTTL:     5 * time.Minute,
+
+		SessionTTL:                   30 * time.Minute,
+		SessionCacheSize:             100000,
+		SessionMaxQueries:            5,
+		SessionPersonalizationWeight: 0.2,
+
+		HeadQueryTopK:            1000,
+		HeadQueryRefreshInterval: time.Hour,
+		HeadQueryConcurrency:     4,
+
+		RecallMonitorInterval: time.Hour,
+		RecallSampleSize:      20,
+		RecallTopK:            10,
+		RecallAlertThreshold:  0.9,
+
+		TailHeadSize:         1000,
+		TailSamplePerStratum: 10,
+		TailSampleResults:    10,
+
+		AnalyticsFlushInterval:       time.Minute,
+		AnalyticsMaxQueries:          10000,
+		AnalyticsTrendingMinSearches: 10,
+
+		MaxBatchSearchSize:     25,
+		BatchSearchConcurrency: 8,
+
+		ReadinessTimeout: 2 * time.Second,
+
+		WarmupEnabled:  true,
+		WarmupTimeout:  30 * time.Second,
+		WarmupSessions: 10,
+		WarmupQuery:    "running shoes",
+
+		HighPriorityConcurrency:   256,
+		MediumPriorityConcurrency: 16,
+		LowPriorityConcurrency:    4,
+		ConcurrencyQueueTimeout:   time.Second,
+		MaxBatchGetSize:        500,
+
+		ConsistencyTokenTTL: 30 * time.Minute,
+
+		RefinementEnabled:   true,
+		RefinementTTL:       10 * time.Minute,
+		RefinementCacheSize: 10000,
+
+		SpannerStalenessMode: "exact",
+
+		HedgePercentile: 0.99,
+		HedgeMinDelay:   50 * time.Millisecond,
+		HedgeStaleness:  15 * time.Second,
+
+		SpannerMinSessions:      100,
+		SpannerMaxSessions:      400,
+		SpannerMaxBurst:         10,
+		SpannerOptimizerVersion: "7",
+
+		TraceSampleRate: 0.1,
+
+		RegressionThreshold:     0.25,
+		RegressionMinSamples:    100,
+		RegressionWindow:        5 * time.Minute,
+		RegressionAlertCooldown: time.Hour,
+
+		SavedSearchMaxDistance:     0.35,
+		SavedSearchEvaluationLimit: 50,
+
+		FeatureFlagOverridesEnabled: true,
+		DiversificationMaxPerBrand:  2,
+
+		PriceDropMinPercent: 1.0,
+
+		SearchEventsSink:  "spanner",
+		MaxEventBatchSize: 500,
+
+		SearchLogBufferSize:    10000,
+		SearchLogBatchSize:     500,
+		SearchLogFlushInterval: 5 * time.Second,
+
+		ReembedColumn:        "embedding_next",
+		ReembedRatePerSecond: 20,
+		ReembedConcurrency:   4,
+
+		ImageEmbeddingModel:     "multimodalembedding@001",
+		ImageEmbeddingDimension: 1408,
+		ImageSearchMaxBytes:     10 << 20,
+
+		IndexingMaxAttempts: 5,
+		IndexingConcurrency: 8,
+		IndexingMaxMessages: 100,
+
+		QueryUnderstandingModel:   "gemini-2.0-flash",
+		QueryUnderstandingTimeout: 800 * time.Millisecond,
+
+		AnswerModel:   "gemini-2.0-flash",
+		AnswerTopK:    10,
+		AnswerTimeout: 4 * time.Second,
+
+		QueryExpansionMethod:      "rules",
+		QueryExpansionMaxVariants: 3,
+		QueryExpansionTimeout:     800 * time.Millisecond,
+
+		MultiQueryMinWords:      8,
+		MultiQueryMaxSubQueries: 4,
 	}
 
 	// Override with environment variables if set
@@ -66,16 +935,95 @@ func Load() (*Config, error) {
 	}
 
 	config.Environment = getEnv("ENVIRONMENT", config.Environment)
-	config.ProjectID = getEnv("PROJECT_ID", "")
+
+	if drain, err := time.ParseDuration(getEnv("SHUTDOWN_DRAIN_TIMEOUT", "10s")); err == nil && drain > 0 {
+		config.ShutdownDrainTimeout = drain
+	}
+
+	if devMode, err := strconv.ParseBool(getEnv("DEV_MODE", "false")); err == nil {
+		config.DevMode = devMode
+	}
+
+	// Development defaults match the emulator's default port and a local
+	// instance created with gcloud spanner instances create
+	defaultProject, defaultInstance, defaultDatabase, defaultEmulator := "", "", "", ""
+	if config.DevMode {
+		defaultProject, defaultInstance, defaultDatabase, defaultEmulator = "psearch-dev", "psearch", "psearch", "localhost:9010"
+	}
+	config.SpannerEmulatorHost = getEnv("SPANNER_EMULATOR_HOST", defaultEmulator)
+
+	config.ProjectID = getEnv("PROJECT_ID", defaultProject)
 	config.Region = getEnv("REGION", "us-central1")
-	config.SpannerInstanceID = getEnv("SPANNER_INSTANCE_ID", "")
-	config.SpannerDatabaseID = getEnv("SPANNER_DATABASE_ID", "")
+	config.SpannerInstanceID = getEnv("SPANNER_INSTANCE_ID", defaultInstance)
+	config.SpannerDatabaseID = getEnv("SPANNER_DATABASE_ID", defaultDatabase)
 	config.GeminiModelName = getEnv("GEMINI_MODEL_NAME", config.GeminiModelName)
 
 	// Parse numeric values with defaults
 	if dim, err := strconv.Atoi(getEnv("EMBEDDING_DIMENSION", "768")); err == nil {
 		config.EmbeddingDimension = dim
 	}
+	if enabled, err := strconv.ParseBool(getEnv("EMBEDDING_OUTPUT_DIMENSIONALITY", "true")); err == nil {
+		config.EmbeddingOutputDimensionality = enabled
+	}
+	if enabled, err := strconv.ParseBool(getEnv("EMBEDDING_TRUNCATE", "false")); err == nil {
+		config.EmbeddingTruncate = enabled
+	}
+
+	config.EmbeddingProvider = getEnv("EMBEDDING_PROVIDER", "vertex")
+	config.EmbeddingEndpoint = strings.TrimSuffix(getEnv("EMBEDDING_ENDPOINT", ""), "/")
+	config.EmbeddingAPIKey = getEnv("EMBEDDING_API_KEY", "")
+	config.EmbeddingQueryPrefix = getEnv("EMBEDDING_QUERY_PREFIX", "")
+	config.EmbeddingDocumentPrefix = getEnv("EMBEDDING_DOCUMENT_PREFIX", "")
+	switch config.EmbeddingProvider {
+	case "vertex":
+	case "openai":
+		if config.EmbeddingEndpoint == "" {
+			config.EmbeddingEndpoint = "https://api.openai.com/v1"
+		}
+	case "tei":
+		if config.EmbeddingEndpoint == "" {
+			return nil, fmt.Errorf("EMBEDDING_PROVIDER tei requires EMBEDDING_ENDPOINT")
+		}
+	default:
+		return nil, fmt.Errorf("EMBEDDING_PROVIDER must be vertex, tei or openai, got %q", config.EmbeddingProvider)
+	}
+
+	// EMBEDDING_VERSIONS is a comma-separated list of
+	// name=column:model[:dimension] entries, e.g.
+	// v2=embedding_v2:text-embedding-005:256. The dimension defaults to
+	// EMBEDDING_DIMENSION.
+	for _, entry := range splitList(getEnv("EMBEDDING_VERSIONS", "")) {
+		name, spec, _ := strings.Cut(entry, "=")
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[1] == "" {
+			return nil, fmt.Errorf("EMBEDDING_VERSIONS entries must be name=column:model[:dimension], got %q", entry)
+		}
+		version := EmbeddingVersion{Name: name, Column: parts[0], Model: parts[1], Dimension: config.EmbeddingDimension}
+		if len(parts) == 3 {
+			dim, err := strconv.Atoi(parts[2])
+			if err != nil || dim <= 0 {
+				return nil, fmt.Errorf("EMBEDDING_VERSIONS dimensions must be positive integers, got %q", entry)
+			}
+			version.Dimension = dim
+		}
+		if !embeddingVersionNamePattern.MatchString(name) || name == DefaultEmbeddingVersion {
+			return nil, fmt.Errorf("EMBEDDING_VERSIONS names must match %s and not be %q, got %q", embeddingVersionNamePattern, DefaultEmbeddingVersion, name)
+		}
+		if !EmbeddingColumnPattern.MatchString(version.Column) {
+			return nil, fmt.Errorf("EMBEDDING_VERSIONS columns must match %s, got %q", EmbeddingColumnPattern, version.Column)
+		}
+		for _, other := range config.EmbeddingVersions {
+			if other.Name == name || other.Column == version.Column {
+				return nil, fmt.Errorf("EMBEDDING_VERSIONS lists %q or its column more than once", name)
+			}
+		}
+		config.EmbeddingVersions = append(config.EmbeddingVersions, version)
+	}
+
+	config.ServingEmbeddingVersion = getEnv("EMBEDDING_SERVING_VERSION", DefaultEmbeddingVersion)
+	if _, ok := config.EmbeddingVersion(config.ServingEmbeddingVersion); !ok {
+		return nil, fmt.Errorf("EMBEDDING_SERVING_VERSION %q is not listed in EMBEDDING_VERSIONS", config.ServingEmbeddingVersion)
+	}
 
 	if alpha, err := strconv.ParseFloat(getEnv("DEFAULT_HYBRID_ALPHA", "0.5"), 64); err == nil {
 		config.DefaultAlpha = alpha
@@ -89,20 +1037,882 @@ func Load() (*Config, error) {
 		config.MinScoreValue = minScore
 	}
 
-	// Validate required configuration
-	if config.ProjectID == "" {
-		return nil, fmt.Errorf("PROJECT_ID environment variable is required")
+	if rrfK, err := strconv.Atoi(getEnv("RRF_K", "60")); err == nil && rrfK > 0 {
+		config.RRFK = rrfK
 	}
 
-	if config.SpannerInstanceID == "" {
-		return nil, fmt.Errorf("SPANNER_INSTANCE_ID environment variable is required")
+	config.SearchExecution = getEnv("SEARCH_EXECUTION", "sql")
+
+	if limit, err := strconv.Atoi(getEnv("ANN_CANDIDATE_LIMIT", "0")); err == nil && limit >= 0 {
+		config.ANNCandidateLimit = limit
 	}
 
-	if config.SpannerDatabaseID == "" {
-		return nil, fmt.Errorf("SPANNER_DATABASE_ID environment variable is required")
+	if limit, err := strconv.Atoi(getEnv("FTS_CANDIDATE_LIMIT", "0")); err == nil && limit >= 0 {
+		config.FTSCandidateLimit = limit
 	}
 
-	return config, nil
+	if leaves, err := strconv.Atoi(getEnv("ANN_NUM_LEAVES_TO_SEARCH", "10")); err == nil && leaves > 0 {
+		config.ANNNumLeavesToSearch = leaves
+	}
+
+	if multiplier, err := strconv.ParseFloat(getEnv("ANN_CANDIDATE_MULTIPLIER", "1"), 64); err == nil && multiplier >= 1 {
+		config.ANNCandidateMultiplier = multiplier
+	}
+
+	config.ANNDistanceMetric = getEnv("ANN_DISTANCE_METRIC", "cosine")
+	if config.ANNDistanceMetric != "cosine" && config.ANNDistanceMetric != "dot_product" {
+		return nil, fmt.Errorf("ANN_DISTANCE_METRIC must be cosine or dot_product, got %q", config.ANNDistanceMetric)
+	}
+
+	// FTS_FIELDS is a comma-separated list of field=weight pairs, e.g.
+	// title=1,brands=0.5,description=0.2. The weight defaults to 1.
+	for _, pair := range splitList(getEnv("FTS_FIELDS", "title=1")) {
+		name, value, hasWeight := strings.Cut(pair, "=")
+		weight := 1.0
+		if hasWeight {
+			var err error
+			if weight, err = strconv.ParseFloat(value, 64); err != nil || weight <= 0 {
+				return nil, fmt.Errorf("FTS_FIELDS weights must be positive numbers, got %q", pair)
+			}
+		}
+		if !slices.Contains(FTSFieldNames, name) {
+			return nil, fmt.Errorf("FTS_FIELDS fields must be one of %s, got %q", strings.Join(FTSFieldNames, ", "), name)
+		}
+		for _, field := range config.FTSFields {
+			if field.Name == name {
+				return nil, fmt.Errorf("FTS_FIELDS lists %q more than once", name)
+			}
+		}
+		config.FTSFields = append(config.FTSFields, FTSField{Name: name, Weight: weight})
+	}
+	if len(config.FTSFields) == 0 {
+		return nil, fmt.Errorf("FTS_FIELDS must list at least one field")
+	}
+
+	config.FTSDialect = getEnv("FTS_DIALECT", config.FTSDialect)
+	if !slices.Contains([]string{FTSDialectRQuery, FTSDialectWords, FTSDialectWordsPhrase}, config.FTSDialect) {
+		return nil, fmt.Errorf("FTS_DIALECT must be rquery, words or words_phrase, got %q", config.FTSDialect)
+	}
+	config.FTSMinimumShouldMatch = getEnv("FTS_MINIMUM_SHOULD_MATCH", config.FTSMinimumShouldMatch)
+	if _, err := MinimumShouldMatch(config.FTSMinimumShouldMatch, 1); err != nil {
+		return nil, fmt.Errorf("FTS_MINIMUM_SHOULD_MATCH: %w", err)
+	}
+	if enabled, err := strconv.ParseBool(getEnv("FTS_PHRASE_MATCHING", "true")); err == nil {
+		config.FTSPhraseMatching = enabled
+	}
+	if enabled, err := strconv.ParseBool(getEnv("FTS_ENHANCE_QUERY", "false")); err == nil {
+		config.FTSEnhanceQuery = enabled
+	}
+
+	config.RerankModel = getEnv("RERANK_MODEL", config.RerankModel)
+	config.RerankConfigID = getEnv("RERANK_CONFIG_ID", config.RerankConfigID)
+
+	if topN, err := strconv.Atoi(getEnv("RERANK_TOP_N", "50")); err == nil && topN > 0 {
+		config.RerankTopN = topN
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("DEDUPE_RESULTS_ENABLED", "false")); err == nil {
+		config.DedupeResultsEnabled = enabled
+	}
+
+	if overfetch, err := strconv.Atoi(getEnv("DEDUPE_OVERFETCH", "2")); err == nil && overfetch >= 1 {
+		config.DedupeOverfetch = overfetch
+	}
+
+	if attrs := getEnv("FILTERABLE_ATTRIBUTES", ""); attrs != "" {
+		config.FilterableAttributes = strings.Split(attrs, ",")
+	}
+
+	if candidates, err := strconv.Atoi(getEnv("FACET_CANDIDATES", "200")); err == nil && candidates > 0 {
+		config.FacetCandidates = candidates
+	}
+
+	if maxFacets, err := strconv.Atoi(getEnv("FACET_MAX_FACETS", "10")); err == nil && maxFacets > 0 {
+		config.FacetMaxFacets = maxFacets
+	}
+
+	if maxValues, err := strconv.Atoi(getEnv("FACET_MAX_VALUES", "10")); err == nil && maxValues > 0 {
+		config.FacetMaxValues = maxValues
+	}
+
+	if minCount, err := strconv.Atoi(getEnv("FACET_MIN_COUNT", "1")); err == nil && minCount > 0 {
+		config.FacetMinCount = minCount
+	}
+
+	if candidates, err := strconv.Atoi(getEnv("SORT_CANDIDATES", "200")); err == nil && candidates > 0 {
+		config.SortCandidates = candidates
+	}
+
+	if maxLimit, err := strconv.Atoi(getEnv("MAX_RESULT_LIMIT", "500")); err == nil && maxLimit > 0 {
+		config.MaxResultLimit = maxLimit
+	}
+
+	if maxOffset, err := strconv.Atoi(getEnv("MAX_RESULT_OFFSET", "10000")); err == nil && maxOffset >= 0 {
+		config.MaxResultOffset = maxOffset
+	}
+
+	if maxLength, err := strconv.Atoi(getEnv("MAX_QUERY_LENGTH", "1024")); err == nil && maxLength > 0 {
+		config.MaxQueryLength = maxLength
+	}
+
+	if maxConditions, err := strconv.Atoi(getEnv("MAX_FILTER_CONDITIONS", "20")); err == nil && maxConditions > 0 {
+		config.MaxFilterConditions = maxConditions
+	}
+	if config.DefaultLimit > config.MaxResultLimit {
+		return nil, fmt.Errorf("DEFAULT_LIMIT %d exceeds MAX_RESULT_LIMIT %d", config.DefaultLimit, config.MaxResultLimit)
+	}
+
+	if radius, err := strconv.ParseFloat(getEnv("LOCAL_RADIUS_KM", "25"), 64); err == nil && radius > 0 {
+		config.LocalRadiusKm = radius
+	}
+
+	// Store IDs are bound as one array parameter of the search statement
+	if stores, err := strconv.Atoi(getEnv("LOCAL_MAX_STORES", "50")); err == nil && stores > 0 && stores <= 1000 {
+		config.LocalMaxStores = stores
+	}
+
+	if weight, err := strconv.ParseFloat(getEnv("LOCAL_BOOST_WEIGHT", "0.5"), 64); err == nil && weight >= 0 {
+		config.LocalBoostWeight = weight
+	}
+
+	if timeout, err := time.ParseDuration(getEnv("READINESS_TIMEOUT", "2s")); err == nil && timeout > 0 {
+		config.ReadinessTimeout = timeout
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("WARMUP_ENABLED", "true")); err == nil {
+		config.WarmupEnabled = enabled
+	}
+
+	if timeout, err := time.ParseDuration(getEnv("WARMUP_TIMEOUT", "30s")); err == nil && timeout > 0 {
+		config.WarmupTimeout = timeout
+	}
+
+	if sessions, err := strconv.Atoi(getEnv("WARMUP_SESSIONS", "10")); err == nil && sessions > 0 {
+		config.WarmupSessions = sessions
+	}
+
+	config.WarmupQuery = getEnv("WARMUP_QUERY", config.WarmupQuery)
+
+	if limit, err := strconv.Atoi(getEnv("HIGH_PRIORITY_CONCURRENCY", "256")); err == nil && limit >= 0 {
+		config.HighPriorityConcurrency = limit
+	}
+
+	if limit, err := strconv.Atoi(getEnv("MEDIUM_PRIORITY_CONCURRENCY", "16")); err == nil && limit >= 0 {
+		config.MediumPriorityConcurrency = limit
+	}
+
+	if limit, err := strconv.Atoi(getEnv("LOW_PRIORITY_CONCURRENCY", "4")); err == nil && limit >= 0 {
+		config.LowPriorityConcurrency = limit
+	}
+
+	if timeout, err := time.ParseDuration(getEnv("CONCURRENCY_QUEUE_TIMEOUT", "1s")); err == nil && timeout >= 0 {
+		config.ConcurrencyQueueTimeout = timeout
+	}
+
+	if size, err := strconv.Atoi(getEnv("MAX_BATCH_SEARCH_SIZE", "25")); err == nil && size > 0 {
+		config.MaxBatchSearchSize = size
+	}
+
+	if concurrency, err := strconv.Atoi(getEnv("BATCH_SEARCH_CONCURRENCY", "8")); err == nil && concurrency > 0 {
+		config.BatchSearchConcurrency = concurrency
+	}
+
+	if size, err := strconv.Atoi(getEnv("MAX_BATCH_GET_SIZE", "500")); err == nil && size > 0 {
+		config.MaxBatchGetSize = size
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("CONSISTENCY_TOKEN_TTL", "30m")); err == nil {
+		config.ConsistencyTokenTTL = ttl
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("REFINEMENT_ENABLED", "true")); err == nil {
+		config.RefinementEnabled = enabled
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("REFINEMENT_TTL", "10m")); err == nil && ttl > 0 {
+		config.RefinementTTL = ttl
+	}
+
+	if size, err := strconv.Atoi(getEnv("REFINEMENT_CACHE_SIZE", "10000")); err == nil && size > 0 {
+		config.RefinementCacheSize = size
+	}
+
+	if attempts, err := strconv.Atoi(getEnv("VERTEX_MAX_ATTEMPTS", "3")); err == nil {
+		config.VertexMaxAttempts = attempts
+	}
+
+	if backoff, err := time.ParseDuration(getEnv("VERTEX_RETRY_INITIAL_BACKOFF", "100ms")); err == nil {
+		config.VertexRetryInitialBackoff = backoff
+	}
+
+	if backoff, err := time.ParseDuration(getEnv("VERTEX_RETRY_MAX_BACKOFF", "2s")); err == nil {
+		config.VertexRetryMaxBackoff = backoff
+	}
+
+	config.VertexEndpoint = strings.TrimSuffix(strings.TrimPrefix(getEnv("VERTEX_ENDPOINT", ""), "https://"), "/")
+
+	if threshold, err := strconv.Atoi(getEnv("CIRCUIT_BREAKER_FAILURE_THRESHOLD", "5")); err == nil {
+		config.CircuitBreakerFailureThreshold = threshold
+	}
+
+	if open, err := time.ParseDuration(getEnv("CIRCUIT_BREAKER_OPEN_DURATION", "30s")); err == nil {
+		config.CircuitBreakerOpenDuration = open
+	}
+
+	if fallback, err := strconv.ParseBool(getEnv("EMBEDDING_FALLBACK_TO_KEYWORD", "true")); err == nil {
+		config.EmbeddingFallbackToKeyword = fallback
+	}
+
+	if timeout, err := time.ParseDuration(getEnv("REQUEST_TIMEOUT", "5s")); err == nil && timeout >= 0 {
+		config.RequestTimeout = timeout
+	}
+
+	if budget, err := time.ParseDuration(getEnv("EMBEDDING_BUDGET", "300ms")); err == nil && budget >= 0 {
+		config.EmbeddingBudget = budget
+	}
+
+	if budget, err := time.ParseDuration(getEnv("SPANNER_BUDGET", "700ms")); err == nil && budget >= 0 {
+		config.SpannerBudget = budget
+	}
+
+	if threshold, err := time.ParseDuration(getEnv("SLO_LATENCY_THRESHOLD", "1s")); err == nil && threshold > 0 {
+		config.SLOLatencyThreshold = threshold
+	}
+
+	// SLO_LATENCY_THRESHOLDS is a comma-separated list of route=duration
+	// pairs, e.g. /search=500ms,/search:batch=3s
+	config.SLOLatencyThresholds = make(map[string]time.Duration)
+	if thresholds := getEnv("SLO_LATENCY_THRESHOLDS", "/search:batch=3s,/search:stream=3s,/answer=5s"); thresholds != "" {
+		for _, pair := range strings.Split(thresholds, ",") {
+			route, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			threshold, err := time.ParseDuration(value)
+			if !ok || route == "" || err != nil || threshold <= 0 {
+				return nil, fmt.Errorf("SLO_LATENCY_THRESHOLDS entries must be route=duration pairs, got %q", pair)
+			}
+			config.SLOLatencyThresholds[route] = threshold
+		}
+	}
+
+	if size, err := strconv.Atoi(getEnv("EMBEDDING_CACHE_SIZE", "10000")); err == nil {
+		config.EmbeddingCacheSize = size
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("EMBEDDING_CACHE_TTL", "24h")); err == nil {
+		config.EmbeddingCacheTTL = ttl
+	}
+
+	if size, err := strconv.Atoi(getEnv("RESULT_CACHE_SIZE", "5000")); err == nil {
+		config.ResultCacheSize = size
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("RESULT_CACHE_SOFT_TTL", "30s")); err == nil {
+		config.ResultCacheSoftTTL = ttl
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("RESULT_CACHE_TTL", "10m")); err == nil {
+		config.ResultCacheTTL = ttl
+	}
+
+	if timeout, err := time.ParseDuration(getEnv("RESULT_CACHE_REFRESH_TIMEOUT", "10s")); err == nil && timeout > 0 {
+		config.ResultCacheRefreshTimeout = timeout
+	}
+
+	config.ResultCacheCoalesce = getEnv("RESULT_CACHE_COALESCE", "true") == "true"
+
+	if size, err := strconv.Atoi(getEnv("PRODUCT_CACHE_SIZE", "20000")); err == nil {
+		config.ProductCacheSize = size
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("PRODUCT_CACHE_TTL", "5m")); err == nil {
+		config.ProductCacheTTL = ttl
+	}
+
+	config.RedisAddr = getEnv("REDIS_ADDR", "")
+	config.RedisPassword = getEnv("REDIS_PASSWORD", "")
+	config.RedisKeyPrefix = getEnv("REDIS_KEY_PREFIX", "psearch:")
+
+	if db, err := strconv.Atoi(getEnv("REDIS_DB", "0")); err == nil && db >= 0 {
+		config.RedisDB = db
+	}
+
+	if timeout, err := time.ParseDuration(getEnv("REDIS_TIMEOUT", "100ms")); err == nil && timeout > 0 {
+		config.RedisTimeout = timeout
+	}
+
+	config.CatalogCurrencyCode = strings.ToUpper(getEnv("CATALOG_CURRENCY_CODE", "USD"))
+
+	// EXCHANGE_RATES is a comma-separated list of CODE=rate pairs, e.g.
+	// EUR=0.92,GBP=0.79, in units per unit of CATALOG_CURRENCY_CODE
+	config.ExchangeRates = make(map[string]float64)
+	for _, pair := range splitList(getEnv("EXCHANGE_RATES", "")) {
+		code, value, _ := strings.Cut(pair, "=")
+		code = strings.ToUpper(strings.TrimSpace(code))
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !isCurrencyCode(code) || err != nil || rate <= 0 {
+			return nil, fmt.Errorf("EXCHANGE_RATES must be CODE=rate pairs with positive rates, got %q", pair)
+		}
+		config.ExchangeRates[code] = rate
+	}
+	config.ExchangeRatesURL = getEnv("EXCHANGE_RATES_URL", "")
+	if interval, err := time.ParseDuration(getEnv("EXCHANGE_RATES_REFRESH_INTERVAL", "1h")); err == nil && interval > 0 {
+		config.ExchangeRatesRefreshInterval = interval
+	}
+	config.DefaultLocale = getEnv("DEFAULT_LOCALE", config.DefaultLocale)
+
+	if catalogs := getEnv("CATALOG_IDS", ""); catalogs != "" {
+		for _, id := range strings.Split(catalogs, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				config.CatalogIDs = append(config.CatalogIDs, id)
+			}
+		}
+	}
+
+	config.DefaultCatalogID = getEnv("DEFAULT_CATALOG_ID", "")
+
+	if length, err := strconv.Atoi(getEnv("QUALITY_MIN_TITLE_LENGTH", "15")); err == nil {
+		config.QualityMinTitleLength = length
+	}
+
+	if threshold, err := strconv.ParseFloat(getEnv("QUALITY_LOW_SCORE_THRESHOLD", "0.5"), 64); err == nil {
+		config.QualityLowScoreThreshold = threshold
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("QUALITY_DEMOTION_ENABLED", "false")); err == nil {
+		config.QualityDemotionEnabled = enabled
+	}
+
+	if factor, err := strconv.ParseFloat(getEnv("QUALITY_DEMOTION_FACTOR", "0.5"), 64); err == nil && factor >= 0 && factor <= 1 {
+		config.QualityDemotionFactor = factor
+	}
+
+	if weight, err := strconv.ParseFloat(getEnv("POPULARITY_WEIGHT", "0"), 64); err == nil && weight >= 0 {
+		config.PopularityWeight = weight
+	}
+
+	config.PopularitySignal = getEnv("POPULARITY_SIGNAL", "purchases")
+
+	if enabled, err := strconv.ParseBool(getEnv("SPELL_CORRECTION_ENABLED", "true")); err == nil {
+		config.SpellCorrectionEnabled = enabled
+	}
+
+	if interval, err := time.ParseDuration(getEnv("SPELL_DICTIONARY_REFRESH_INTERVAL", "1h")); err == nil && interval > 0 {
+		config.SpellDictionaryRefreshInterval = interval
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("HEAD_QUERY_PRECOMPUTE_ENABLED", "false")); err == nil {
+		config.HeadQueryPrecomputeEnabled = enabled
+	}
+
+	if topK, err := strconv.Atoi(getEnv("HEAD_QUERY_TOP_K", "1000")); err == nil {
+		config.HeadQueryTopK = topK
+	}
+
+	if interval, err := time.ParseDuration(getEnv("HEAD_QUERY_REFRESH_INTERVAL", "1h")); err == nil && interval > 0 {
+		config.HeadQueryRefreshInterval = interval
+	}
+
+	if results, err := strconv.ParseBool(getEnv("HEAD_QUERY_PRECOMPUTE_RESULTS", "false")); err == nil {
+		config.HeadQueryPrecomputeResults = results
+	}
+
+	if concurrency, err := strconv.Atoi(getEnv("HEAD_QUERY_CONCURRENCY", "4")); err == nil {
+		config.HeadQueryConcurrency = concurrency
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("RECALL_MONITOR_ENABLED", "false")); err == nil {
+		config.RecallMonitorEnabled = enabled
+	}
+
+	if interval, err := time.ParseDuration(getEnv("RECALL_MONITOR_INTERVAL", "1h")); err == nil && interval > 0 {
+		config.RecallMonitorInterval = interval
+	}
+
+	if size, err := strconv.Atoi(getEnv("RECALL_SAMPLE_SIZE", "20")); err == nil && size > 0 {
+		config.RecallSampleSize = size
+	}
+
+	if topK, err := strconv.Atoi(getEnv("RECALL_TOP_K", "10")); err == nil && topK > 0 {
+		config.RecallTopK = topK
+	}
+
+	if threshold, err := strconv.ParseFloat(getEnv("RECALL_ALERT_THRESHOLD", "0.9"), 64); err == nil {
+		config.RecallAlertThreshold = threshold
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("TAIL_SAMPLING_ENABLED", "false")); err == nil {
+		config.TailSamplingEnabled = enabled
+	}
+
+	if size, err := strconv.Atoi(getEnv("TAIL_HEAD_SIZE", "1000")); err == nil && size >= 0 {
+		config.TailHeadSize = size
+	}
+
+	if size, err := strconv.Atoi(getEnv("TAIL_SAMPLE_PER_STRATUM", "10")); err == nil && size > 0 {
+		config.TailSamplePerStratum = size
+	}
+
+	if results, err := strconv.Atoi(getEnv("TAIL_SAMPLE_RESULTS", "10")); err == nil && results > 0 {
+		config.TailSampleResults = results
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("ANALYTICS_ENABLED", "false")); err == nil {
+		config.AnalyticsEnabled = enabled
+	}
+
+	if interval, err := time.ParseDuration(getEnv("ANALYTICS_FLUSH_INTERVAL", "1m")); err == nil && interval > 0 {
+		config.AnalyticsFlushInterval = interval
+	}
+
+	if size, err := strconv.Atoi(getEnv("ANALYTICS_MAX_QUERIES", "10000")); err == nil && size > 0 {
+		config.AnalyticsMaxQueries = size
+	}
+
+	if searches, err := strconv.Atoi(getEnv("ANALYTICS_TRENDING_MIN_SEARCHES", "10")); err == nil && searches > 0 {
+		config.AnalyticsTrendingMinSearches = searches
+	}
+
+	if size, err := strconv.Atoi(getEnv("QUERY_TEMPLATE_CACHE_SIZE", "1000")); err == nil {
+		config.QueryTemplateCacheSize = size
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("QUERY_TEMPLATE_CACHE_TTL", "1m")); err == nil {
+		config.QueryTemplateCacheTTL = ttl
+	}
+
+	if interval, err := time.ParseDuration(getEnv("SCORING_PROFILE_REFRESH_INTERVAL", "1m")); err == nil && interval > 0 {
+		config.ScoringProfileRefreshInterval = interval
+	}
+
+	if interval, err := time.ParseDuration(getEnv("MERCHANDISING_RULE_REFRESH_INTERVAL", "1m")); err == nil && interval > 0 {
+		config.MerchandisingRuleRefreshInterval = interval
+	}
+
+	if interval, err := time.ParseDuration(getEnv("EXPERIMENT_REFRESH_INTERVAL", "1m")); err == nil && interval > 0 {
+		config.ExperimentRefreshInterval = interval
+	}
+
+	if interval, err := time.ParseDuration(getEnv("RUNTIME_CONFIG_REFRESH_INTERVAL", "1m")); err == nil && interval > 0 {
+		config.RuntimeConfigRefreshInterval = interval
+	}
+
+	if interval, err := time.ParseDuration(getEnv("CATALOG_VERSION_REFRESH_INTERVAL", "15s")); err == nil && interval > 0 {
+		config.CatalogVersionRefreshInterval = interval
+	}
+
+	if weight, err := strconv.ParseFloat(getEnv("PERSONALIZATION_WEIGHT", "0.2"), 64); err == nil && weight >= 0 && weight <= 1 {
+		config.PersonalizationWeight = weight
+	}
+
+	if rate, err := strconv.ParseFloat(getEnv("USER_PROFILE_LEARNING_RATE", "0.1"), 64); err == nil && rate > 0 && rate <= 1 {
+		config.UserProfileLearningRate = rate
+	}
+
+	if size, err := strconv.Atoi(getEnv("USER_PROFILE_CACHE_SIZE", "10000")); err == nil {
+		config.UserProfileCacheSize = size
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("USER_PROFILE_CACHE_TTL", "5m")); err == nil {
+		config.UserProfileCacheTTL = ttl
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("SESSION_CONTEXT_ENABLED", "false")); err == nil {
+		config.SessionContextEnabled = enabled
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("SESSION_TTL", "30m")); err == nil && ttl > 0 {
+		config.SessionTTL = ttl
+	}
+
+	if size, err := strconv.Atoi(getEnv("SESSION_CACHE_SIZE", "100000")); err == nil && size > 0 {
+		config.SessionCacheSize = size
+	}
+
+	if queries, err := strconv.Atoi(getEnv("SESSION_MAX_QUERIES", "5")); err == nil && queries > 0 {
+		config.SessionMaxQueries = queries
+	}
+
+	if weight, err := strconv.ParseFloat(getEnv("SESSION_PERSONALIZATION_WEIGHT", "0.2"), 64); err == nil && weight >= 0 && weight <= 1 {
+		config.SessionPersonalizationWeight = weight
+	}
+
+	if methods := getEnv("AUTH_METHODS", ""); methods != "" {
+		for _, method := range strings.Split(methods, ",") {
+			config.AuthMethods = append(config.AuthMethods, strings.TrimSpace(method))
+		}
+	}
+
+	// API_KEYS is a comma-separated list of name=key pairs
+	if keys := getEnv("API_KEYS", ""); keys != "" {
+		config.APIKeys = make(map[string]string)
+		for _, pair := range strings.Split(keys, ",") {
+			name, key, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || name == "" || key == "" {
+				return nil, fmt.Errorf("API_KEYS entries must be name=key pairs")
+			}
+			config.APIKeys[name] = key
+		}
+	}
+
+	config.AuthAudience = getEnv("AUTH_AUDIENCE", "")
+
+	if accounts := getEnv("AUTH_ALLOWED_SERVICE_ACCOUNTS", ""); accounts != "" {
+		config.AuthAllowedServiceAccounts = strings.Split(accounts, ",")
+	}
+
+	config.FirebaseProjectID = getEnv("FIREBASE_PROJECT_ID", config.ProjectID)
+
+	config.AdminAPIKey = getEnv("ADMIN_API_KEY", "")
+
+	config.AllowedOrigins = splitList(getEnv("ALLOWED_ORIGINS", "*"))
+	config.AllowedMethods = splitList(getEnv("ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"))
+	config.AllowedHeaders = splitList(getEnv("ALLOWED_HEADERS", "Origin,Content-Type,Accept,Authorization,X-API-Key"))
+
+	if maxAge, err := time.ParseDuration(getEnv("CORS_MAX_AGE", "24h")); err == nil && maxAge >= 0 {
+		config.CORSMaxAge = maxAge
+	}
+
+	if staleness, err := strconv.ParseFloat(getEnv("SPANNER_STALENESS_SECONDS", "0"), 64); err == nil && staleness >= 0 {
+		config.SpannerStaleness = time.Duration(staleness * float64(time.Second))
+	}
+
+	if mode := getEnv("SPANNER_STALENESS_MODE", "exact"); mode == "exact" || mode == "max" {
+		config.SpannerStalenessMode = mode
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("SEARCH_HEDGING_ENABLED", "false")); err == nil {
+		config.SearchHedgingEnabled = enabled
+	}
+
+	if p, err := strconv.ParseFloat(getEnv("HEDGE_PERCENTILE", "0.99"), 64); err == nil && p > 0 && p < 1 {
+		config.HedgePercentile = p
+	}
+
+	if delay, err := time.ParseDuration(getEnv("HEDGE_MIN_DELAY", "50ms")); err == nil && delay > 0 {
+		config.HedgeMinDelay = delay
+	}
+
+	if staleness, err := strconv.ParseFloat(getEnv("HEDGE_STALENESS_SECONDS", "15"), 64); err == nil && staleness > 0 {
+		config.HedgeStaleness = time.Duration(staleness * float64(time.Second))
+	}
+
+	if sessions, err := strconv.Atoi(getEnv("SPANNER_MIN_SESSIONS", "100")); err == nil && sessions >= 0 {
+		config.SpannerMinSessions = sessions
+	}
+
+	if sessions, err := strconv.Atoi(getEnv("SPANNER_MAX_SESSIONS", "400")); err == nil && sessions > 0 {
+		config.SpannerMaxSessions = sessions
+	}
+
+	if burst, err := strconv.Atoi(getEnv("SPANNER_MAX_BURST", "10")); err == nil && burst > 0 {
+		config.SpannerMaxBurst = burst
+	}
+
+	config.SpannerOptimizerVersion = getEnv("SPANNER_OPTIMIZER_VERSION", "7")
+	config.SpannerQueryPriority = strings.ToUpper(getEnv("SPANNER_QUERY_PRIORITY", ""))
+
+	if enabled, err := strconv.ParseBool(getEnv("ENABLE_TRACING", "false")); err == nil {
+		config.TracingEnabled = enabled
+	}
+
+	if rate, err := strconv.ParseFloat(getEnv("TRACE_SAMPLE_RATE", "0.1"), 64); err == nil {
+		config.TraceSampleRate = rate
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("REGRESSION_DETECTION_ENABLED", "false")); err == nil {
+		config.RegressionDetectionEnabled = enabled
+	}
+
+	config.RegressionAlertTopic = getEnv("REGRESSION_ALERT_TOPIC", "")
+
+	if threshold, err := strconv.ParseFloat(getEnv("REGRESSION_THRESHOLD", "0.25"), 64); err == nil {
+		config.RegressionThreshold = threshold
+	}
+
+	if minSamples, err := strconv.Atoi(getEnv("REGRESSION_MIN_SAMPLES", "100")); err == nil {
+		config.RegressionMinSamples = minSamples
+	}
+
+	if window, err := time.ParseDuration(getEnv("REGRESSION_WINDOW", "5m")); err == nil && window > 0 {
+		config.RegressionWindow = window
+	}
+
+	if cooldown, err := time.ParseDuration(getEnv("REGRESSION_ALERT_COOLDOWN", "1h")); err == nil {
+		config.RegressionAlertCooldown = cooldown
+	}
+
+	config.ProductEventsTopic = getEnv("PRODUCT_EVENTS_TOPIC", "")
+
+	if minPercent, err := strconv.ParseFloat(getEnv("PRICE_DROP_MIN_PERCENT", "1.0"), 64); err == nil {
+		config.PriceDropMinPercent = minPercent
+	}
+
+	config.SearchEventsSink = getEnv("SEARCH_EVENTS_SINK", "spanner")
+	config.SearchEventsTopic = getEnv("SEARCH_EVENTS_TOPIC", "")
+
+	if size, err := strconv.Atoi(getEnv("MAX_EVENT_BATCH_SIZE", "500")); err == nil && size > 0 {
+		config.MaxEventBatchSize = size
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("SEARCH_LOGS_ENABLED", "false")); err == nil {
+		config.SearchLogsEnabled = enabled
+	}
+
+	config.SearchLogTable = getEnv("SEARCH_LOG_TABLE", "")
+
+	if size, err := strconv.Atoi(getEnv("SEARCH_LOG_BUFFER_SIZE", "10000")); err == nil && size > 0 {
+		config.SearchLogBufferSize = size
+	}
+
+	if size, err := strconv.Atoi(getEnv("SEARCH_LOG_BATCH_SIZE", "500")); err == nil && size > 0 {
+		config.SearchLogBatchSize = size
+	}
+
+	if interval, err := time.ParseDuration(getEnv("SEARCH_LOG_FLUSH_INTERVAL", "5s")); err == nil && interval > 0 {
+		config.SearchLogFlushInterval = interval
+	}
+
+	config.ReembedModel = getEnv("REEMBED_MODEL", "")
+
+	if dim, err := strconv.Atoi(getEnv("REEMBED_DIMENSION", "0")); err == nil && dim > 0 {
+		config.ReembedDimension = dim
+	}
+
+	config.ReembedColumn = getEnv("REEMBED_COLUMN", config.ReembedColumn)
+
+	if rate, err := strconv.ParseFloat(getEnv("REEMBED_RATE_PER_SECOND", "20"), 64); err == nil && rate > 0 {
+		config.ReembedRatePerSecond = rate
+	}
+
+	if concurrency, err := strconv.Atoi(getEnv("REEMBED_CONCURRENCY", "4")); err == nil && concurrency > 0 {
+		config.ReembedConcurrency = concurrency
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("IMAGE_SEARCH_ENABLED", "false")); err == nil {
+		config.ImageSearchEnabled = enabled
+	}
+
+	config.ImageEmbeddingModel = getEnv("IMAGE_EMBEDDING_MODEL", config.ImageEmbeddingModel)
+
+	if dim, err := strconv.Atoi(getEnv("IMAGE_EMBEDDING_DIMENSION", "1408")); err == nil {
+		config.ImageEmbeddingDimension = dim
+	}
+	switch config.ImageEmbeddingDimension {
+	case 128, 256, 512, 1408:
+	default:
+		return nil, fmt.Errorf("IMAGE_EMBEDDING_DIMENSION must be 128, 256, 512 or 1408, got %d", config.ImageEmbeddingDimension)
+	}
+
+	if maxBytes, err := strconv.ParseInt(getEnv("IMAGE_SEARCH_MAX_BYTES", "10485760"), 10, 64); err == nil && maxBytes > 0 {
+		config.ImageSearchMaxBytes = maxBytes
+	}
+
+	config.IndexingSubscription = getEnv("INDEXING_SUBSCRIPTION", "")
+	config.IndexingDeadLetterTopic = getEnv("INDEXING_DEAD_LETTER_TOPIC", "")
+
+	if attempts, err := strconv.Atoi(getEnv("INDEXING_MAX_ATTEMPTS", "5")); err == nil && attempts > 0 {
+		config.IndexingMaxAttempts = attempts
+	}
+
+	if concurrency, err := strconv.Atoi(getEnv("INDEXING_CONCURRENCY", "8")); err == nil && concurrency > 0 {
+		config.IndexingConcurrency = concurrency
+	}
+
+	// Pub/Sub returns at most 1000 messages per pull
+	if size, err := strconv.Atoi(getEnv("INDEXING_MAX_MESSAGES", "100")); err == nil && size > 0 && size <= 1000 {
+		config.IndexingMaxMessages = size
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("QUERY_UNDERSTANDING_ENABLED", "false")); err == nil {
+		config.QueryUnderstandingEnabled = enabled
+	}
+
+	config.QueryUnderstandingModel = getEnv("QUERY_UNDERSTANDING_MODEL", config.QueryUnderstandingModel)
+
+	if timeout, err := time.ParseDuration(getEnv("QUERY_UNDERSTANDING_TIMEOUT", "800ms")); err == nil && timeout > 0 {
+		config.QueryUnderstandingTimeout = timeout
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("ANSWER_ENABLED", "false")); err == nil {
+		config.AnswerEnabled = enabled
+	}
+
+	config.AnswerModel = getEnv("ANSWER_MODEL", config.AnswerModel)
+
+	if topK, err := strconv.Atoi(getEnv("ANSWER_TOP_K", "10")); err == nil && topK > 0 && topK <= 50 {
+		config.AnswerTopK = topK
+	}
+
+	if timeout, err := time.ParseDuration(getEnv("ANSWER_TIMEOUT", "4s")); err == nil && timeout > 0 {
+		config.AnswerTimeout = timeout
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("LANGUAGE_DETECTION_ENABLED", "false")); err == nil {
+		config.LanguageDetectionEnabled = enabled
+	}
+
+	config.QueryNormalization = splitList(getEnv("QUERY_NORMALIZATION", ""))
+	for _, step := range config.QueryNormalization {
+		if !slices.Contains(QueryNormalizationSteps, step) {
+			return nil, fmt.Errorf("QUERY_NORMALIZATION steps must be among %s, got %q", strings.Join(QueryNormalizationSteps, ", "), step)
+		}
+	}
+	config.QueryNormalizationLanguage = strings.ToLower(getEnv("QUERY_NORMALIZATION_LANGUAGE", "en"))
+
+	if method := getEnv("QUERY_EXPANSION_METHOD", "rules"); method == "rules" || method == "llm" {
+		config.QueryExpansionMethod = method
+	}
+
+	if variants, err := strconv.Atoi(getEnv("QUERY_EXPANSION_MAX_VARIANTS", "3")); err == nil && variants >= 0 {
+		config.QueryExpansionMaxVariants = variants
+	}
+
+	if timeout, err := time.ParseDuration(getEnv("QUERY_EXPANSION_TIMEOUT", "800ms")); err == nil && timeout > 0 {
+		config.QueryExpansionTimeout = timeout
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("MULTI_QUERY_ENABLED", "false")); err == nil {
+		config.MultiQueryEnabled = enabled
+	}
+
+	if words, err := strconv.Atoi(getEnv("MULTI_QUERY_MIN_WORDS", "8")); err == nil && words > 0 {
+		config.MultiQueryMinWords = words
+	}
+
+	if subQueries, err := strconv.Atoi(getEnv("MULTI_QUERY_MAX_SUB_QUERIES", "4")); err == nil && subQueries > 0 {
+		config.MultiQueryMaxSubQueries = subQueries
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("SKU_DETECTION_ENABLED", "true")); err == nil {
+		config.SKUDetectionEnabled = enabled
+	}
+
+	skuPattern, err := regexp.Compile(getEnv("SKU_PATTERN", `^[A-Za-z0-9][A-Za-z0-9._/-]{3,63}$`))
+	if err != nil {
+		return nil, fmt.Errorf("SKU_PATTERN is not a valid regular expression: %v", err)
+	}
+	config.SKUPattern = skuPattern
+
+	config.SavedSearchTopic = getEnv("SAVED_SEARCH_TOPIC", "")
+
+	if distance, err := strconv.ParseFloat(getEnv("SAVED_SEARCH_MAX_DISTANCE", "0.35"), 64); err == nil {
+		config.SavedSearchMaxDistance = distance
+	}
+
+	if interval, err := time.ParseDuration(getEnv("SAVED_SEARCH_EVALUATION_INTERVAL", "0")); err == nil && interval >= 0 {
+		config.SavedSearchEvaluationInterval = interval
+	}
+
+	if limit, err := strconv.Atoi(getEnv("SAVED_SEARCH_EVALUATION_LIMIT", "50")); err == nil && limit > 0 {
+		config.SavedSearchEvaluationLimit = limit
+	}
+
+	config.SavedSearchWebhookHosts = splitList(getEnv("SAVED_SEARCH_WEBHOOK_HOSTS", ""))
+
+	// FEATURE_FLAGS is a comma-separated list of name=bool pairs, e.g.
+	// diversification=true,rerank=false
+	config.FeatureFlags = maps.Clone(FeatureFlagDefaults)
+	for _, pair := range splitList(getEnv("FEATURE_FLAGS", "")) {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if _, known := FeatureFlagDefaults[name]; !ok || !known || err != nil {
+			return nil, fmt.Errorf("FEATURE_FLAGS entries must be name=bool pairs naming one of %s, got %q", strings.Join(FeatureFlagNames(), ", "), pair)
+		}
+		config.FeatureFlags[name] = enabled
+	}
+
+	if enabled, err := strconv.ParseBool(getEnv("FEATURE_FLAG_OVERRIDES_ENABLED", "true")); err == nil {
+		config.FeatureFlagOverridesEnabled = enabled
+	}
+
+	if perBrand, err := strconv.Atoi(getEnv("DIVERSIFICATION_MAX_PER_BRAND", "2")); err == nil && perBrand > 0 {
+		config.DiversificationMaxPerBrand = perBrand
+	}
+
+	// Validate required configuration
+	if config.ProjectID == "" {
+		return nil, fmt.Errorf("PROJECT_ID environment variable is required")
+	}
+
+	if config.SpannerInstanceID == "" {
+		return nil, fmt.Errorf("SPANNER_INSTANCE_ID environment variable is required")
+	}
+
+	if config.SpannerDatabaseID == "" {
+		return nil, fmt.Errorf("SPANNER_DATABASE_ID environment variable is required")
+	}
+
+	if !isCurrencyCode(config.CatalogCurrencyCode) {
+		return nil, fmt.Errorf("CATALOG_CURRENCY_CODE must be a three-letter ISO 4217 code, got %q", config.CatalogCurrencyCode)
+	}
+
+	if config.DevMode && config.Environment == "production" {
+		return nil, fmt.Errorf("DEV_MODE cannot be enabled in production")
+	}
+	if config.SearchExecution != "sql" && config.SearchExecution != "parallel" {
+		return nil, fmt.Errorf("SEARCH_EXECUTION must be sql or parallel, got %q", config.SearchExecution)
+	}
+	switch config.SpannerQueryPriority {
+	case "", "LOW", "MEDIUM", "HIGH":
+	default:
+		return nil, fmt.Errorf("SPANNER_QUERY_PRIORITY must be LOW, MEDIUM or HIGH, got %q", config.SpannerQueryPriority)
+	}
+	if config.SpannerMinSessions > config.SpannerMaxSessions {
+		return nil, fmt.Errorf("SPANNER_MIN_SESSIONS (%d) must not exceed SPANNER_MAX_SESSIONS (%d)", config.SpannerMinSessions, config.SpannerMaxSessions)
+	}
+
+	if config.PopularitySignal != "purchases" && config.PopularitySignal != "clicks" {
+		return nil, fmt.Errorf("POPULARITY_SIGNAL must be purchases or clicks, got %q", config.PopularitySignal)
+	}
+
+	switch config.SearchEventsSink {
+	case "spanner":
+	case "pubsub":
+		if config.SearchEventsTopic == "" {
+			return nil, fmt.Errorf("SEARCH_EVENTS_TOPIC is required when SEARCH_EVENTS_SINK is pubsub")
+		}
+	default:
+		return nil, fmt.Errorf("SEARCH_EVENTS_SINK must be spanner or pubsub, got %q", config.SearchEventsSink)
+	}
+	if config.SearchLogsEnabled {
+		if parts := strings.Split(config.SearchLogTable, "."); len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("SEARCH_LOG_TABLE must be dataset.table or project.dataset.table when SEARCH_LOGS_ENABLED is set, got %q", config.SearchLogTable)
+		}
+	}
+	if config.TailSamplingEnabled && config.SearchEventsSink != "spanner" {
+		return nil, fmt.Errorf("TAIL_SAMPLING_ENABLED samples queries from search_events and requires SEARCH_EVENTS_SINK=spanner")
+	}
+
+	if config.DefaultCatalogID != "" && !slices.Contains(config.CatalogIDs, config.DefaultCatalogID) {
+		return nil, fmt.Errorf("DEFAULT_CATALOG_ID %q is not listed in CATALOG_IDS", config.DefaultCatalogID)
+	}
+
+	return config, nil
+}
+
+// isCurrencyCode reports whether code has the shape of an ISO 4217 code
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// splitList splits a comma-separated list, dropping blank entries. "none"
+// yields an empty list.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" && item != "none" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
 
 // getEnv gets an environment variable or returns a default value
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import "testing"
+
+func TestResolveCatalog(t *testing.T) {
+	single := &Config{}
+	multi := &Config{CatalogIDs: []string{"us", "eu"}}
+	withDefault := &Config{CatalogIDs: []string{"us", "eu"}, DefaultCatalogID: "us"}
+
+	tests := []struct {
+		name      string
+		config    *Config
+		requested string
+		want      string
+		wantErr   string
+	}{
+		{name: "single tenant", config: single, requested: "", want: ""},
+		{name: "single tenant with a catalog", config: single, requested: "us", wantErr: "catalog_id is not supported: this deployment serves a single catalog"},
+		{name: "listed", config: multi, requested: "eu", want: "eu"},
+		{name: "unlisted", config: multi, requested: "jp", wantErr: `unknown catalog_id "jp"`},
+		{name: "missing without a default", config: multi, requested: "", wantErr: "catalog_id is required"},
+		{name: "missing with a default", config: withDefault, requested: "", want: "us"},
+		{name: "default overridden", config: withDefault, requested: "eu", want: "eu"},
+	}
+	for _, tt := range tests {
+		got, err := tt.config.ResolveCatalog(tt.requested)
+		switch {
+		case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+			t.Errorf("%s: ResolveCatalog(%q) error = %v, want %q", tt.name, tt.requested, err, tt.wantErr)
+		case tt.wantErr == "" && (err != nil || got != tt.want):
+			t.Errorf("%s: ResolveCatalog(%q) = %q, %v, want %q", tt.name, tt.requested, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import "fmt"
+
+// IDs matches the products whose ID is one of IDs. It is not part of the
+// filter syntax: searches refined from an earlier search's results are
+// scoped with it.
+type IDs struct {
+	IDs []string
+}
+
+func (*IDs) node() {}
+
+func (c *compiler) compileIDs(n *IDs) string {
+	return fmt.Sprintf("product_id IN UNNEST(%s)", c.bind(n.IDs))
+}
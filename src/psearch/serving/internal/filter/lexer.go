@@ -0,0 +1,182 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package filter parses search filter expressions such as
+//
+//	brands: ANY("Nike", "Adidas") AND price < 100 AND NOT availability = "OUT_OF_STOCK"
+//
+// into a typed AST, validates field names and value types against a
+// Registry, and compiles the result into a parameterized Spanner predicate.
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind identifies the lexical class of a token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenColon
+	tokenOperator
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenAny
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of filter"
+	case tokenIdent:
+		return "field name"
+	case tokenString:
+		return "string"
+	case tokenNumber:
+		return "number"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	case tokenComma:
+		return "','"
+	case tokenColon:
+		return "':'"
+	case tokenOperator:
+		return "comparison operator"
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	case tokenAny:
+		return "ANY"
+	}
+	return "token"
+}
+
+// token is a lexeme with its byte offset in the filter string
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// keywords are matched case-insensitively
+var keywords = map[string]tokenKind{
+	"AND": tokenAnd,
+	"OR":  tokenOr,
+	"NOT": tokenNot,
+	"ANY": tokenAny,
+}
+
+// lex splits the filter string into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case c == ':':
+			tokens = append(tokens, token{tokenColon, ":", i})
+			i++
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			start := i
+			i++
+			if i < len(input) && input[i] == '=' {
+				i++
+			}
+			op := input[start:i]
+			if op == "!" {
+				return nil, &Error{Pos: start, Message: "unexpected '!'", Suggestion: "use '!=' for not-equal"}
+			}
+			tokens = append(tokens, token{tokenOperator, op, start})
+		case c == '"' || c == '\'':
+			text, end, err := lexString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, text, i})
+			i = end
+		case c == '-' || c == '.' || unicode.IsDigit(c):
+			start := i
+			i++
+			for i < len(input) && (unicode.IsDigit(rune(input[i])) || input[i] == '.' || input[i] == 'e' || input[i] == 'E') {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, input[start:i], start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(input) && (input[i] == '_' || input[i] == '.' || unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i]))) {
+				i++
+			}
+			word := input[start:i]
+			if kind, ok := keywords[strings.ToUpper(word)]; ok {
+				tokens = append(tokens, token{kind, word, start})
+			} else {
+				tokens = append(tokens, token{tokenIdent, word, start})
+			}
+		default:
+			return nil, &Error{Pos: i, Message: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", len(input)})
+	return tokens, nil
+}
+
+// lexString reads a quoted string starting at start, handling backslash
+// escapes, and returns the unquoted text and the offset after the closing quote
+func lexString(input string, start int) (string, int, error) {
+	quote := input[start]
+	var b strings.Builder
+	i := start + 1
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == '\\' && i+1 < len(input):
+			b.WriteByte(input[i+1])
+			i += 2
+		case c == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, &Error{Pos: start, Message: "unterminated string", Suggestion: fmt.Sprintf("add a closing %c", quote)}
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Matched returns the conditions of the filter that productData satisfies,
+// in filter syntax, to explain which parts of a filter a result matched.
+// Conditions under NOT are reported negated when the product does not
+// satisfy them.
+func Matched(node Node, productData map[string]interface{}) []string {
+	var matched []string
+	var walk func(node Node, negated bool)
+	walk = func(node Node, negated bool) {
+		switch n := node.(type) {
+		case *And:
+			walk(n.Left, negated)
+			walk(n.Right, negated)
+		case *Or:
+			walk(n.Left, negated)
+			walk(n.Right, negated)
+		case *Not:
+			walk(n.Operand, !negated)
+		default:
+			if matches(node, productData) == negated {
+				return
+			}
+			if negated {
+				matched = append(matched, "NOT "+format(node))
+			} else {
+				matched = append(matched, format(node))
+			}
+		}
+	}
+	if node != nil {
+		walk(node, false)
+	}
+	return matched
+}
+
+// Matches reports whether productData satisfies the whole filter, for
+// callers that evaluate filters in memory rather than in SQL. A nil filter
+// matches every product.
+func Matches(node Node, productData map[string]interface{}) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *And:
+		return Matches(n.Left, productData) && Matches(n.Right, productData)
+	case *Or:
+		return Matches(n.Left, productData) || Matches(n.Right, productData)
+	case *Not:
+		return !Matches(n.Operand, productData)
+	}
+	return matches(node, productData)
+}
+
+// matches evaluates a single condition against product data the way its
+// compiled SQL does
+func matches(node Node, productData map[string]interface{}) bool {
+	switch n := node.(type) {
+	case *Comparison:
+		return matchesComparison(n, productData)
+	case *AnyOf:
+		return matchesAnyOf(n, productData)
+	case *Range:
+		inRange := func(v float64) bool {
+			return (n.Min == nil || v >= *n.Min) && (n.Max == nil || v <= *n.Max)
+		}
+		if n.Field.Type == FieldAttribute {
+			return slices.ContainsFunc(attributeNumbers(n.Field, productData), inRange)
+		}
+		v, ok := toNumber(lookupPath(productData, n.Field.JSONPath))
+		return ok && inRange(v)
+	case *IDs:
+		id, ok := productData["id"].(string)
+		return ok && slices.Contains(n.IDs, id)
+	}
+	return false
+}
+
+func matchesComparison(n *Comparison, productData map[string]interface{}) bool {
+	switch n.Field.Type {
+	case FieldNumber:
+		v, ok := toNumber(lookupPath(productData, n.Field.JSONPath))
+		return ok && compareNumbers(v, n.Operator, n.Value.Number)
+	case FieldString:
+		v, ok := toText(lookupPath(productData, n.Field.JSONPath))
+		if !ok {
+			return false
+		}
+		return (v == n.Value.Text) == (n.Operator == "=")
+	case FieldStringList:
+		contains := slices.Contains(toTexts(lookupPath(productData, n.Field.JSONPath)), n.Value.Text)
+		return contains == (n.Operator == "=")
+	case FieldAttribute:
+		if n.Value.IsNumber {
+			return slices.ContainsFunc(attributeNumbers(n.Field, productData), func(v float64) bool {
+				return compareNumbers(v, n.Operator, n.Value.Number)
+			})
+		}
+		contains := slices.Contains(attributeTexts(n.Field, productData), n.Value.Text)
+		return contains == (n.Operator == "=")
+	}
+	return false
+}
+
+func matchesAnyOf(n *AnyOf, productData map[string]interface{}) bool {
+	switch n.Field.Type {
+	case FieldString:
+		v, ok := toText(lookupPath(productData, n.Field.JSONPath))
+		return ok && slices.ContainsFunc(n.Values, func(value Value) bool { return value.Text == v })
+	case FieldStringList:
+		texts := toTexts(lookupPath(productData, n.Field.JSONPath))
+		return slices.ContainsFunc(n.Values, func(value Value) bool { return slices.Contains(texts, value.Text) })
+	case FieldAttribute:
+		texts := attributeTexts(n.Field, productData)
+		numbers := attributeNumbers(n.Field, productData)
+		return slices.ContainsFunc(n.Values, func(value Value) bool {
+			if value.IsNumber {
+				return slices.Contains(numbers, value.Number)
+			}
+			return slices.Contains(texts, value.Text)
+		})
+	}
+	return false
+}
+
+func compareNumbers(a float64, op string, b float64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// lookupPath returns the value at a $.a.b style JSONPath
+func lookupPath(data map[string]interface{}, path string) interface{} {
+	var value interface{} = data
+	for _, key := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// attributeValues returns the value object of each attribute entry with
+// the field's key
+func attributeValues(field Field, productData map[string]interface{}) []map[string]interface{} {
+	entries, _ := lookupPath(productData, field.JSONPath).([]interface{})
+	var values []map[string]interface{}
+	for _, entry := range entries {
+		attribute, ok := entry.(map[string]interface{})
+		if !ok || attribute["key"] != field.AttributeKey {
+			continue
+		}
+		if value, ok := attribute["value"].(map[string]interface{}); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func attributeTexts(field Field, productData map[string]interface{}) []string {
+	var texts []string
+	for _, value := range attributeValues(field, productData) {
+		texts = append(texts, toTexts(value["text"])...)
+	}
+	return texts
+}
+
+func attributeNumbers(field Field, productData map[string]interface{}) []float64 {
+	var numbers []float64
+	for _, value := range attributeValues(field, productData) {
+		items, _ := value["numbers"].([]interface{})
+		for _, item := range items {
+			if n, ok := toNumber(item); ok {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	return numbers
+}
+
+// toText converts a scalar JSON value to text, as JSON_VALUE does
+func toText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func toTexts(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var texts []string
+	for _, item := range items {
+		if text, ok := toText(item); ok {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// toNumber converts a JSON number or numeric string, as SAFE_CAST does
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// format renders a condition in filter syntax
+func format(node Node) string {
+	switch n := node.(type) {
+	case *Comparison:
+		return fmt.Sprintf("%s %s %s", n.Field.Name, n.Operator, formatValue(n.Value))
+	case *AnyOf:
+		values := make([]string, len(n.Values))
+		for i, value := range n.Values {
+			values[i] = formatValue(value)
+		}
+		return fmt.Sprintf("%s: ANY(%s)", n.Field.Name, strings.Join(values, ", "))
+	case *Range:
+		var bounds []string
+		if n.Min != nil {
+			bounds = append(bounds, fmt.Sprintf("%s >= %g", n.Field.Name, *n.Min))
+		}
+		if n.Max != nil {
+			bounds = append(bounds, fmt.Sprintf("%s <= %g", n.Field.Name, *n.Max))
+		}
+		return strings.Join(bounds, " AND ")
+	case *IDs:
+		return fmt.Sprintf("id: ANY(%d refined products)", len(n.IDs))
+	}
+	return ""
+}
+
+func formatValue(value Value) string {
+	if value.IsNumber {
+		return strconv.FormatFloat(value.Number, 'g', -1, 64)
+	}
+	return strconv.Quote(value.Text)
+}
@@ -0,0 +1,350 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Error is a filter syntax or validation error with its byte position
+type Error struct {
+	Pos        int    `json:"position"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("filter error at position %d: %s, %s", e.Pos, e.Message, e.Suggestion)
+	}
+	return fmt.Sprintf("filter error at position %d: %s", e.Pos, e.Message)
+}
+
+// Node is a node of the filter AST
+type Node interface {
+	node()
+}
+
+// And matches when both sides match
+type And struct {
+	Left, Right Node
+}
+
+// Or matches when either side matches
+type Or struct {
+	Left, Right Node
+}
+
+// Not negates its operand
+type Not struct {
+	Operand Node
+}
+
+// Comparison compares a field against a single value with =, !=, <, <=, > or >=
+type Comparison struct {
+	Field    Field
+	Operator string
+	Value    Value
+}
+
+// AnyOf matches when the field has any of the values (field: ANY(...))
+type AnyOf struct {
+	Field  Field
+	Values []Value
+}
+
+func (*And) node()        {}
+func (*Or) node()         {}
+func (*Not) node()        {}
+func (*Comparison) node() {}
+func (*AnyOf) node()      {}
+
+// Value is a literal string or number
+type Value struct {
+	Text     string
+	Number   float64
+	IsNumber bool
+}
+
+// Parse parses the filter expression and validates it against the registry.
+// An empty expression yields a nil Node.
+func Parse(input string, registry *Registry) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return nil, nil
+	}
+
+	p := &parser{tokens: tokens, registry: registry}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &Error{Pos: tok.pos, Message: fmt.Sprintf("unexpected %s %q", tok.kind, tok.text), Suggestion: "combine conditions with AND or OR"}
+	}
+	return node, nil
+}
+
+// parser is a recursive-descent parser over the token stream:
+//
+//	or         := and ("OR" and)*
+//	and        := unary ("AND" unary)*
+//	unary      := "NOT" unary | primary
+//	primary    := "(" or ")" | comparison
+//	comparison := field ":" "ANY" "(" value ("," value)* ")"
+//	            | field operator value
+type parser struct {
+	tokens   []token
+	pos      int
+	registry *Registry
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(kind tokenKind, context string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, &Error{Pos: tok.pos, Message: fmt.Sprintf("expected %s %s, found %s", kind, context, describe(tok))}
+	}
+	return tok, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	if p.peek().kind == tokenLParen {
+		open := p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokenRParen {
+			return nil, &Error{Pos: tok.pos, Message: fmt.Sprintf("expected ')' to close '(' at position %d, found %s", open.pos, describe(tok))}
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	fieldTok, err := p.expect(tokenIdent, "at start of condition")
+	if err != nil {
+		return nil, err
+	}
+	field, err := p.resolveField(fieldTok)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := p.next(); tok.kind {
+	case tokenColon:
+		return p.parseAnyOf(field)
+	case tokenOperator:
+		valueTok := p.next()
+		value, err := p.parseValue(valueTok)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkComparison(field, tok, value, valueTok.pos); err != nil {
+			return nil, err
+		}
+		return &Comparison{Field: field, Operator: tok.text, Value: value}, nil
+	default:
+		return nil, &Error{Pos: tok.pos, Message: fmt.Sprintf("expected ':' or comparison operator after %q, found %s", field.Name, describe(tok))}
+	}
+}
+
+func (p *parser) parseAnyOf(field Field) (Node, error) {
+	if field.Type == FieldNumber {
+		return nil, &Error{Pos: p.peek().pos, Message: fmt.Sprintf("ANY is not supported for number field %q", field.Name), Suggestion: "use a comparison such as >= or <"}
+	}
+	if _, err := p.expect(tokenAny, "after ':'"); err != nil {
+		err.(*Error).Suggestion = fmt.Sprintf("write %s: ANY(\"value\")", field.Name)
+		return nil, err
+	}
+	if _, err := p.expect(tokenLParen, "after ANY"); err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for {
+		valueTok := p.next()
+		value, err := p.parseValue(valueTok)
+		if err != nil {
+			return nil, err
+		}
+		if value.IsNumber && field.Type != FieldAttribute {
+			return nil, &Error{Pos: valueTok.pos, Message: fmt.Sprintf("field %q expects string values", field.Name), Suggestion: fmt.Sprintf("quote the value: \"%s\"", valueTok.text)}
+		}
+		values = append(values, value)
+
+		tok := p.next()
+		if tok.kind == tokenRParen {
+			break
+		}
+		if tok.kind != tokenComma {
+			return nil, &Error{Pos: tok.pos, Message: fmt.Sprintf("expected ',' or ')' in ANY list, found %s", describe(tok))}
+		}
+	}
+	return &AnyOf{Field: field, Values: values}, nil
+}
+
+func (p *parser) parseValue(tok token) (Value, error) {
+	switch tok.kind {
+	case tokenString:
+		return Value{Text: tok.text}, nil
+	case tokenNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return Value{}, &Error{Pos: tok.pos, Message: fmt.Sprintf("invalid number %q", tok.text)}
+		}
+		return Value{Number: n, IsNumber: true, Text: tok.text}, nil
+	case tokenIdent:
+		return Value{}, &Error{Pos: tok.pos, Message: fmt.Sprintf("expected a value, found unquoted word %q", tok.text), Suggestion: fmt.Sprintf("quote it: \"%s\"", tok.text)}
+	default:
+		return Value{}, &Error{Pos: tok.pos, Message: fmt.Sprintf("expected a value, found %s", describe(tok))}
+	}
+}
+
+// resolveField looks up the field in the registry, suggesting the closest
+// known field for typos
+func (p *parser) resolveField(tok token) (Field, error) {
+	if field, ok := p.registry.Lookup(tok.text); ok {
+		return field, nil
+	}
+
+	err := &Error{Pos: tok.pos, Message: fmt.Sprintf("unknown field '%s'", tok.text)}
+	if suggestion := p.registry.Suggest(tok.text); suggestion != "" {
+		err.Suggestion = fmt.Sprintf("did you mean '%s'?", suggestion)
+	}
+	return Field{}, err
+}
+
+// checkComparison validates the operator and value type for the field
+func checkComparison(field Field, op token, value Value, valuePos int) error {
+	ordered := op.text == "<" || op.text == "<=" || op.text == ">" || op.text == ">="
+
+	switch field.Type {
+	case FieldNumber:
+		if !value.IsNumber {
+			return &Error{Pos: valuePos, Message: fmt.Sprintf("field %q expects a number", field.Name)}
+		}
+	case FieldString, FieldStringList:
+		if value.IsNumber {
+			return &Error{Pos: valuePos, Message: fmt.Sprintf("field %q expects a string", field.Name), Suggestion: fmt.Sprintf("quote the value: \"%s\"", value.Text)}
+		}
+		if ordered {
+			return &Error{Pos: op.pos, Message: fmt.Sprintf("operator %s is not supported for %s field %q", op.text, field.Type, field.Name), Suggestion: "use = or !="}
+		}
+	case FieldAttribute:
+		if ordered && !value.IsNumber {
+			return &Error{Pos: valuePos, Message: fmt.Sprintf("operator %s requires a number", op.text)}
+		}
+	}
+	return nil
+}
+
+// describe renders a token for error messages
+func describe(tok token) string {
+	if tok.kind == tokenEOF {
+		return tok.kind.String()
+	}
+	return fmt.Sprintf("%q", tok.text)
+}
+
+// Conjoin combines two optional filters with AND. Either side may be nil.
+func Conjoin(left, right Node) Node {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	return &And{Left: left, Right: right}
+}
+
+// Conditions counts the comparisons, ANY(...) matches and ranges in a
+// filter. A nil filter has none.
+func Conditions(node Node) int {
+	switch n := node.(type) {
+	case *And:
+		return Conditions(n.Left) + Conditions(n.Right)
+	case *Or:
+		return Conditions(n.Left) + Conditions(n.Right)
+	case *Not:
+		return Conditions(n.Operand)
+	case *Comparison, *AnyOf, *Range:
+		return 1
+	}
+	return 0
+}
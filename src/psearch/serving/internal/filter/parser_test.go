@@ -0,0 +1,170 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tree renders a filter with its grouping made explicit
+func tree(node Node) string {
+	switch n := node.(type) {
+	case nil:
+		return "<nil>"
+	case *And:
+		return fmt.Sprintf("(%s AND %s)", tree(n.Left), tree(n.Right))
+	case *Or:
+		return fmt.Sprintf("(%s OR %s)", tree(n.Left), tree(n.Right))
+	case *Not:
+		return "NOT " + tree(n.Operand)
+	}
+	return format(node)
+}
+
+func TestParse(t *testing.T) {
+	registry := NewRegistry([]string{"material", "weight"})
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: "<nil>"},
+		{input: "  \t ", want: "<nil>"},
+		{input: "price < 100", want: "price < 100"},
+		{input: "price>=-1.5", want: "price >= -1.5"},
+		{input: "price < .5", want: "price < 0.5"},
+		{input: "price < 1e3", want: "price < 1000"},
+		{input: `availability != "OUT_OF_STOCK"`, want: `availability != "OUT_OF_STOCK"`},
+		{input: `brands: ANY("Nike", 'Adidas')`, want: `brands: ANY("Nike", "Adidas")`},
+		{input: `tags = "say \"hi\""`, want: `tags = "say \"hi\""`},
+		{input: `attributes.material: ANY("wool", 3)`, want: `attributes.material: ANY("wool", 3)`},
+		{input: "attributes.weight > 2.5", want: "attributes.weight > 2.5"},
+		// AND binds tighter than OR, and NOT tighter than both
+		{input: `brands = "a" AND price < 1 OR price > 9`, want: `((brands = "a" AND price < 1) OR price > 9)`},
+		{input: `brands = "a" OR price < 1 AND price > 9`, want: `(brands = "a" OR (price < 1 AND price > 9))`},
+		{input: `NOT brands = "a" AND price < 1`, want: `(NOT brands = "a" AND price < 1)`},
+		{input: `NOT NOT brands = "a"`, want: `NOT NOT brands = "a"`},
+		{input: `price < 1 AND (brands = "a" OR brands = "b")`, want: `(price < 1 AND (brands = "a" OR brands = "b"))`},
+		{input: `price < 1 and not (sizes = "M" or sizes = "L")`, want: `(price < 1 AND NOT (sizes = "M" OR sizes = "L"))`},
+		{input: `price < 1 AND price < 2 AND price < 3`, want: `((price < 1 AND price < 2) AND price < 3)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input, registry)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.input, err)
+			}
+			if got := tree(node); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	registry := NewRegistry([]string{"material"})
+
+	tests := []struct {
+		input      string
+		pos        int
+		message    string
+		suggestion string
+	}{
+		// Lexing
+		{input: "price ! 5", pos: 6, message: "unexpected '!'", suggestion: "use '!=' for not-equal"},
+		{input: `brands = "Nike`, pos: 9, message: "unterminated string", suggestion: `add a closing "`},
+		{input: `brands = 'Nike`, pos: 9, message: "unterminated string", suggestion: "add a closing '"},
+		{input: "price < 100 #", pos: 12, message: "unexpected character '#'"},
+		// Structure
+		{input: "price < 100 AND", pos: 15, message: "expected field name at start of condition, found end of filter"},
+		{input: "price < 1 price > 2", pos: 10, message: `unexpected field name "price"`, suggestion: "combine conditions with AND or OR"},
+		{input: "(price < 1", pos: 10, message: "expected ')' to close '(' at position 0, found end of filter"},
+		{input: "price 5", pos: 6, message: `expected ':' or comparison operator after "price", found "5"`},
+		{input: "price <", pos: 7, message: "expected a value, found end of filter"},
+		{input: "price < 1.2.3", pos: 8, message: `invalid number "1.2.3"`},
+		{input: "brands = Nike", pos: 9, message: `expected a value, found unquoted word "Nike"`, suggestion: `quote it: "Nike"`},
+		// Fields
+		{input: `brnads = "x"`, pos: 0, message: "unknown field 'brnads'", suggestion: "did you mean 'brands'?"},
+		{input: `price < 1 AND attributes.materail = "x"`, pos: 14, message: "unknown field 'attributes.materail'", suggestion: "did you mean 'attributes.material'?"},
+		{input: `zzzzzzzzzz = "x"`, pos: 0, message: "unknown field 'zzzzzzzzzz'"},
+		// Types and operators
+		{input: `price < "cheap"`, pos: 8, message: `field "price" expects a number`},
+		{input: `brands < "a"`, pos: 7, message: `operator < is not supported for string list field "brands"`, suggestion: "use = or !="},
+		{input: `availability >= "a"`, pos: 13, message: `operator >= is not supported for string field "availability"`, suggestion: "use = or !="},
+		{input: "brands = 5", pos: 9, message: `field "brands" expects a string`, suggestion: `quote the value: "5"`},
+		{input: `attributes.material < "x"`, pos: 22, message: "operator < requires a number"},
+		// ANY lists
+		{input: "price: ANY(1)", pos: 7, message: `ANY is not supported for number field "price"`, suggestion: "use a comparison such as >= or <"},
+		{input: `brands: "Nike"`, pos: 8, message: `expected ANY after ':', found "Nike"`, suggestion: `write brands: ANY("value")`},
+		{input: `brands: ANY "a"`, pos: 12, message: `expected '(' after ANY, found "a"`},
+		{input: `brands: ANY("a" "b")`, pos: 16, message: `expected ',' or ')' in ANY list, found "b"`},
+		{input: `brands: ANY("a",`, pos: 16, message: "expected a value, found end of filter"},
+		{input: "brands: ANY(5)", pos: 12, message: `field "brands" expects string values`, suggestion: `quote the value: "5"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input, registry)
+			var ferr *Error
+			if !errors.As(err, &ferr) {
+				t.Fatalf("Parse(%q) = %v, want *Error", tt.input, err)
+			}
+			if ferr.Pos != tt.pos || ferr.Message != tt.message || ferr.Suggestion != tt.suggestion {
+				t.Errorf("Parse(%q) = {%d %q %q}, want {%d %q %q}", tt.input, ferr.Pos, ferr.Message, ferr.Suggestion, tt.pos, tt.message, tt.suggestion)
+			}
+		})
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	err := &Error{Pos: 3, Message: "unknown field 'prcie'", Suggestion: "did you mean 'price'?"}
+	if got, want := err.Error(), "filter error at position 3: unknown field 'prcie', did you mean 'price'?"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	err.Suggestion = ""
+	if got := err.Error(); strings.Contains(got, ", ") {
+		t.Errorf("Error() = %q, want no suggestion", got)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	registry := NewRegistry(nil)
+	node, err := Parse(`price < 1 AND (brands: ANY("a", "b") OR NOT tags = "c")`, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Conditions(node); got != 3 {
+		t.Errorf("Conditions() = %d, want 3", got)
+	}
+	if got := Conditions(nil); got != 0 {
+		t.Errorf("Conditions(nil) = %d, want 0", got)
+	}
+
+	max := 10.0
+	price, err := NewRange(registry, "price", nil, &max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Conditions(Conjoin(node, price)); got != 4 {
+		t.Errorf("Conditions() with a range = %d, want 4", got)
+	}
+	if Conjoin(nil, price) != price || Conjoin(price, nil) != price {
+		t.Error("Conjoin() with a nil side should return the other side")
+	}
+}
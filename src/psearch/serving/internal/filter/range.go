@@ -0,0 +1,51 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import "fmt"
+
+// Range matches numeric values between Min and Max, inclusive. Either bound
+// may be nil. On attributes, both bounds apply to the same value, unlike two
+// separate comparisons that could each match a different value.
+type Range struct {
+	Field    Field
+	Min, Max *float64
+}
+
+func (*Range) node() {}
+
+// NewRange validates a numeric range on the named field. It returns a nil
+// Node when neither bound is set.
+func NewRange(registry *Registry, name string, min, max *float64) (Node, error) {
+	field, ok := registry.Lookup(name)
+	if !ok {
+		if suggestion := registry.Suggest(name); suggestion != "" {
+			return nil, fmt.Errorf("unknown range field %q, did you mean %q?", name, suggestion)
+		}
+		return nil, fmt.Errorf("unknown range field %q", name)
+	}
+	if field.Type != FieldNumber && field.Type != FieldAttribute {
+		return nil, fmt.Errorf("range field %q is a %s, not a number", name, field.Type)
+	}
+	if min != nil && max != nil && *min > *max {
+		return nil, fmt.Errorf("range on %q has min %g greater than max %g", name, *min, *max)
+	}
+	if min == nil && max == nil {
+		return nil, nil
+	}
+	return &Range{Field: field, Min: min, Max: max}, nil
+}
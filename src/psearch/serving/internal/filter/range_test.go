@@ -0,0 +1,48 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import "testing"
+
+func TestNewRange(t *testing.T) {
+	registry := NewRegistry([]string{"weight"})
+	low, high := 1.0, 2.0
+
+	if node, err := NewRange(registry, "price", nil, nil); node != nil || err != nil {
+		t.Errorf("NewRange() without bounds = %v, %v, want nil, nil", node, err)
+	}
+	if _, err := NewRange(registry, "attributes.weight", &low, &high); err != nil {
+		t.Errorf("NewRange() on an attribute: %v", err)
+	}
+
+	errors := []struct {
+		name     string
+		min, max *float64
+		want     string
+	}{
+		{name: "prcie", min: &low, want: `unknown range field "prcie", did you mean "price"?`},
+		{name: "manufacturer", min: &low, want: `unknown range field "manufacturer"`},
+		{name: "brands", min: &low, want: `range field "brands" is a string list, not a number`},
+		{name: "price", min: &high, max: &low, want: `range on "price" has min 2 greater than max 1`},
+	}
+	for _, tt := range errors {
+		_, err := NewRange(registry, tt.name, tt.min, tt.max)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("NewRange(%q) error = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
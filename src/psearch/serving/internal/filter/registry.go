@@ -0,0 +1,164 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"sort"
+	"strings"
+)
+
+// FieldType is the value type of a filterable field
+type FieldType int
+
+const (
+	// FieldString is a single text value
+	FieldString FieldType = iota
+	// FieldStringList is a repeated text value, matched if any element matches
+	FieldStringList
+	// FieldNumber is a single numeric value
+	FieldNumber
+	// FieldAttribute is a custom product attribute with text and numeric values
+	FieldAttribute
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldString:
+		return "string"
+	case FieldStringList:
+		return "string list"
+	case FieldNumber:
+		return "number"
+	case FieldAttribute:
+		return "attribute"
+	}
+	return "unknown"
+}
+
+// Field describes a filterable field and where it lives in product_data
+type Field struct {
+	Name string
+	Type FieldType
+	// JSONPath locates the value in the product_data JSON column
+	JSONPath string
+	// Column names a denormalized column of products holding the same
+	// value, which comparisons use instead of extracting JSONPath
+	Column string
+	// AttributeKey is the attributes[].key matched for FieldAttribute fields
+	AttributeKey string
+}
+
+// attributePrefix namespaces custom product attributes in filters
+const attributePrefix = "attributes."
+
+// Registry is the set of fields that filters may reference
+type Registry struct {
+	fields map[string]Field
+}
+
+// NewRegistry creates a registry with the built-in product fields and the
+// given custom attribute keys (addressed as attributes.<key>)
+func NewRegistry(attributeKeys []string) *Registry {
+	r := &Registry{fields: make(map[string]Field)}
+
+	r.add(Field{Name: "brands", Type: FieldStringList, JSONPath: "$.brands"})
+	r.add(Field{Name: "categories", Type: FieldStringList, JSONPath: "$.categories"})
+	r.add(Field{Name: "sizes", Type: FieldStringList, JSONPath: "$.sizes"})
+	r.add(Field{Name: "colors", Type: FieldStringList, JSONPath: "$.colorInfo.colors"})
+	r.add(Field{Name: "colorFamilies", Type: FieldStringList, JSONPath: "$.colorInfo.colorFamilies"})
+	r.add(Field{Name: "tags", Type: FieldStringList, JSONPath: "$.tags"})
+	r.add(Field{Name: "availability", Type: FieldString, JSONPath: "$.availability"})
+	r.add(Field{Name: "price", Type: FieldNumber, JSONPath: "$.priceInfo.price", Column: "price"})
+	r.add(Field{Name: "originalPrice", Type: FieldNumber, JSONPath: "$.priceInfo.originalPrice"})
+
+	for _, key := range attributeKeys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		r.add(Field{Name: attributePrefix + key, Type: FieldAttribute, JSONPath: "$.attributes", AttributeKey: key})
+	}
+
+	return r
+}
+
+func (r *Registry) add(f Field) {
+	r.fields[f.Name] = f
+}
+
+// Lookup returns the field with the given name
+func (r *Registry) Lookup(name string) (Field, bool) {
+	f, ok := r.fields[name]
+	return f, ok
+}
+
+// Names returns the registered field names in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.fields))
+	for name := range r.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Suggest returns the registered field name closest to name, or "" when
+// nothing is close enough to be a plausible typo
+func (r *Registry) Suggest(name string) string {
+	best := ""
+	bestDistance := -1
+	for _, candidate := range r.Names() {
+		d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	// Allow roughly one edit per three characters
+	if bestDistance < 0 || bestDistance > len(name)/3+1 {
+		return ""
+	}
+	return best
+}
+
+// editDistance computes the Damerau-Levenshtein (optimal string alignment)
+// distance, so transpositions like "brnad" -> "brand" count as one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := 0; j <= len(rb); j++ {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
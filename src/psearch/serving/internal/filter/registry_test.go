@@ -0,0 +1,65 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import "testing"
+
+func TestSuggest(t *testing.T) {
+	registry := NewRegistry([]string{"material"})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "brnads", want: "brands"},
+		{name: "prcie", want: "price"},
+		{name: "PRICE", want: "price"},
+		{name: "colour", want: "colors"},
+		{name: "avialability", want: "availability"},
+		{name: "attributes.materal", want: "attributes.material"},
+		{name: "xyz", want: ""},
+		{name: "manufacturer", want: ""},
+	}
+	for _, tt := range tests {
+		if got := registry.Suggest(tt.name); got != tt.want {
+			t.Errorf("Suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "abc", want: 3},
+		{a: "price", b: "price", want: 0},
+		{a: "brnad", b: "brand", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+		// Optimal string alignment edits no substring twice
+		{a: "ca", b: "abc", want: 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
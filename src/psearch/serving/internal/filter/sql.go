@@ -0,0 +1,170 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompileSQL compiles the filter AST into a Spanner predicate over the
+// product_data JSON column and the denormalized columns of products. Values are bound as parameters named with the
+// given prefix, which are returned alongside the SQL.
+func CompileSQL(node Node, paramPrefix string) (string, map[string]interface{}) {
+	c := &compiler{prefix: paramPrefix, params: make(map[string]interface{})}
+	return c.compile(node), c.params
+}
+
+type compiler struct {
+	prefix string
+	params map[string]interface{}
+}
+
+// bind registers a parameter and returns its @name
+func (c *compiler) bind(value interface{}) string {
+	name := fmt.Sprintf("%s%d", c.prefix, len(c.params))
+	c.params[name] = value
+	return "@" + name
+}
+
+func (c *compiler) compile(node Node) string {
+	switch n := node.(type) {
+	case *And:
+		return fmt.Sprintf("(%s AND %s)", c.compile(n.Left), c.compile(n.Right))
+	case *Or:
+		return fmt.Sprintf("(%s OR %s)", c.compile(n.Left), c.compile(n.Right))
+	case *Not:
+		return fmt.Sprintf("(NOT %s)", c.compile(n.Operand))
+	case *AnyOf:
+		return c.compileAnyOf(n)
+	case *Comparison:
+		return c.compileComparison(n)
+	case *Range:
+		return c.compileRange(n)
+	case *IDs:
+		return c.compileIDs(n)
+	}
+	return "TRUE"
+}
+
+func (c *compiler) compileAnyOf(n *AnyOf) string {
+	if n.Field.Type == FieldAttribute {
+		var texts []string
+		var numbers []float64
+		for _, v := range n.Values {
+			if v.IsNumber {
+				numbers = append(numbers, v.Number)
+			} else {
+				texts = append(texts, v.Text)
+			}
+		}
+
+		var conditions []string
+		if len(texts) > 0 {
+			conditions = append(conditions, fmt.Sprintf(
+				"EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(a, '$.value.text')) AS t WHERE t IN UNNEST(%s))", c.bind(texts)))
+		}
+		if len(numbers) > 0 {
+			conditions = append(conditions, fmt.Sprintf(
+				"EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(a, '$.value.numbers')) AS n WHERE SAFE_CAST(n AS FLOAT64) IN UNNEST(%s))", c.bind(numbers)))
+		}
+		condition := conditions[0]
+		if len(conditions) == 2 {
+			condition = fmt.Sprintf("(%s OR %s)", conditions[0], conditions[1])
+		}
+		return c.attributeExists(n.Field, condition)
+	}
+
+	texts := make([]string, 0, len(n.Values))
+	for _, v := range n.Values {
+		texts = append(texts, v.Text)
+	}
+	param := c.bind(texts)
+
+	if n.Field.Type == FieldString {
+		return fmt.Sprintf("JSON_VALUE(product_data, '%s') IN UNNEST(%s)", n.Field.JSONPath, param)
+	}
+	return fmt.Sprintf("EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(product_data, '%s')) AS v WHERE v IN UNNEST(%s))",
+		n.Field.JSONPath, param)
+}
+
+func (c *compiler) compileComparison(n *Comparison) string {
+	op := n.Operator
+	if op == "!=" {
+		op = "<>"
+	}
+
+	switch n.Field.Type {
+	case FieldNumber:
+		return fmt.Sprintf("%s %s %s", numberExpr(n.Field), op, c.bind(n.Value.Number))
+	case FieldString:
+		return fmt.Sprintf("JSON_VALUE(product_data, '%s') %s %s", n.Field.JSONPath, op, c.bind(n.Value.Text))
+	case FieldStringList:
+		contains := fmt.Sprintf("%s IN UNNEST(JSON_VALUE_ARRAY(product_data, '%s'))", c.bind(n.Value.Text), n.Field.JSONPath)
+		if op == "<>" {
+			return fmt.Sprintf("(NOT %s)", contains)
+		}
+		return contains
+	case FieldAttribute:
+		if n.Value.IsNumber {
+			return c.attributeExists(n.Field, fmt.Sprintf(
+				"EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(a, '$.value.numbers')) AS n WHERE SAFE_CAST(n AS FLOAT64) %s %s)", op, c.bind(n.Value.Number)))
+		}
+		contains := c.attributeExists(n.Field, fmt.Sprintf(
+			"%s IN UNNEST(JSON_VALUE_ARRAY(a, '$.value.text'))", c.bind(n.Value.Text)))
+		if op == "<>" {
+			return fmt.Sprintf("(NOT %s)", contains)
+		}
+		return contains
+	}
+	return "TRUE"
+}
+
+func (c *compiler) compileRange(n *Range) string {
+	bounds := func(value string) string {
+		var conditions []string
+		if n.Min != nil {
+			conditions = append(conditions, fmt.Sprintf("%s >= %s", value, c.bind(*n.Min)))
+		}
+		if n.Max != nil {
+			conditions = append(conditions, fmt.Sprintf("%s <= %s", value, c.bind(*n.Max)))
+		}
+		return strings.Join(conditions, " AND ")
+	}
+
+	if n.Field.Type == FieldAttribute {
+		return c.attributeExists(n.Field, fmt.Sprintf(
+			"EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(a, '$.value.numbers')) AS n WHERE %s)", bounds("SAFE_CAST(n AS FLOAT64)")))
+	}
+	return "(" + bounds(numberExpr(n.Field)) + ")"
+}
+
+// numberExpr returns the SQL expression of a numeric field, preferring its
+// denormalized column over extracting it from product_data
+func numberExpr(field Field) string {
+	if field.Column != "" {
+		return field.Column
+	}
+	return fmt.Sprintf("SAFE_CAST(JSON_VALUE(product_data, '%s') AS FLOAT64)", field.JSONPath)
+}
+
+// attributeExists wraps a condition on attribute alias a so that it applies to
+// the attribute entry with the field's key
+func (c *compiler) attributeExists(field Field, condition string) string {
+	return fmt.Sprintf("EXISTS(SELECT 1 FROM UNNEST(JSON_QUERY_ARRAY(product_data, '$.attributes')) AS a WHERE JSON_VALUE(a, '$.key') = %s AND %s)",
+		c.bind(field.AttributeKey), condition)
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompileSQL(t *testing.T) {
+	registry := NewRegistry([]string{"material"})
+
+	// Parameters are named by position, so filters differing only in an
+	// operator or field bind the same parameters and differ in SQL alone
+	tests := []struct {
+		input  string
+		sql    string
+		params map[string]interface{}
+	}{
+		// Numbers on a denormalized column, and on product_data
+		{input: "price = 10", sql: "price = @filter_0", params: map[string]interface{}{"filter_0": 10.0}},
+		{input: "price != 10", sql: "price <> @filter_0", params: map[string]interface{}{"filter_0": 10.0}},
+		{input: "price < 10", sql: "price < @filter_0", params: map[string]interface{}{"filter_0": 10.0}},
+		{input: "price <= 10", sql: "price <= @filter_0", params: map[string]interface{}{"filter_0": 10.0}},
+		{input: "price > 10", sql: "price > @filter_0", params: map[string]interface{}{"filter_0": 10.0}},
+		{input: "price >= 10", sql: "price >= @filter_0", params: map[string]interface{}{"filter_0": 10.0}},
+		{
+			input:  "originalPrice > 10",
+			sql:    "SAFE_CAST(JSON_VALUE(product_data, '$.priceInfo.originalPrice') AS FLOAT64) > @filter_0",
+			params: map[string]interface{}{"filter_0": 10.0},
+		},
+		// Strings
+		{
+			input:  `availability = "IN_STOCK"`,
+			sql:    "JSON_VALUE(product_data, '$.availability') = @filter_0",
+			params: map[string]interface{}{"filter_0": "IN_STOCK"},
+		},
+		{
+			input:  `availability != "IN_STOCK"`,
+			sql:    "JSON_VALUE(product_data, '$.availability') <> @filter_0",
+			params: map[string]interface{}{"filter_0": "IN_STOCK"},
+		},
+		{
+			input:  `availability: ANY("IN_STOCK", "PREORDER")`,
+			sql:    "JSON_VALUE(product_data, '$.availability') IN UNNEST(@filter_0)",
+			params: map[string]interface{}{"filter_0": []string{"IN_STOCK", "PREORDER"}},
+		},
+		// String lists
+		{
+			input:  `brands = "Nike"`,
+			sql:    "@filter_0 IN UNNEST(JSON_VALUE_ARRAY(product_data, '$.brands'))",
+			params: map[string]interface{}{"filter_0": "Nike"},
+		},
+		{
+			input:  `brands != "Nike"`,
+			sql:    "(NOT @filter_0 IN UNNEST(JSON_VALUE_ARRAY(product_data, '$.brands')))",
+			params: map[string]interface{}{"filter_0": "Nike"},
+		},
+		{
+			input:  `colors: ANY("red", "blue")`,
+			sql:    "EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(product_data, '$.colorInfo.colors')) AS v WHERE v IN UNNEST(@filter_0))",
+			params: map[string]interface{}{"filter_0": []string{"red", "blue"}},
+		},
+		// Attributes
+		{
+			input:  `attributes.material = "wool"`,
+			sql:    "EXISTS(SELECT 1 FROM UNNEST(JSON_QUERY_ARRAY(product_data, '$.attributes')) AS a WHERE JSON_VALUE(a, '$.key') = @filter_1 AND @filter_0 IN UNNEST(JSON_VALUE_ARRAY(a, '$.value.text')))",
+			params: map[string]interface{}{"filter_0": "wool", "filter_1": "material"},
+		},
+		{
+			input:  `attributes.material != "wool"`,
+			sql:    "(NOT EXISTS(SELECT 1 FROM UNNEST(JSON_QUERY_ARRAY(product_data, '$.attributes')) AS a WHERE JSON_VALUE(a, '$.key') = @filter_1 AND @filter_0 IN UNNEST(JSON_VALUE_ARRAY(a, '$.value.text'))))",
+			params: map[string]interface{}{"filter_0": "wool", "filter_1": "material"},
+		},
+		{
+			input:  "attributes.material >= 3",
+			sql:    "EXISTS(SELECT 1 FROM UNNEST(JSON_QUERY_ARRAY(product_data, '$.attributes')) AS a WHERE JSON_VALUE(a, '$.key') = @filter_1 AND EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(a, '$.value.numbers')) AS n WHERE SAFE_CAST(n AS FLOAT64) >= @filter_0))",
+			params: map[string]interface{}{"filter_0": 3.0, "filter_1": "material"},
+		},
+		{
+			input:  `attributes.material: ANY("wool", 3)`,
+			sql:    "EXISTS(SELECT 1 FROM UNNEST(JSON_QUERY_ARRAY(product_data, '$.attributes')) AS a WHERE JSON_VALUE(a, '$.key') = @filter_2 AND (EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(a, '$.value.text')) AS t WHERE t IN UNNEST(@filter_0)) OR EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(a, '$.value.numbers')) AS n WHERE SAFE_CAST(n AS FLOAT64) IN UNNEST(@filter_1))))",
+			params: map[string]interface{}{"filter_0": []string{"wool"}, "filter_1": []float64{3}, "filter_2": "material"},
+		},
+		// Boolean operators
+		{
+			input:  `price < 10 AND (tags = "sale" OR NOT sizes = "XL")`,
+			sql:    "(price < @filter_0 AND (@filter_1 IN UNNEST(JSON_VALUE_ARRAY(product_data, '$.tags')) OR (NOT @filter_2 IN UNNEST(JSON_VALUE_ARRAY(product_data, '$.sizes')))))",
+			params: map[string]interface{}{"filter_0": 10.0, "filter_1": "sale", "filter_2": "XL"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input, registry)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			sql, params := CompileSQL(node, "filter_")
+			if sql != tt.sql {
+				t.Errorf("SQL = %s\nwant  %s", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("params = %v, want %v", params, tt.params)
+			}
+		})
+	}
+}
+
+func TestCompileSQLRangeAndIDs(t *testing.T) {
+	registry := NewRegistry([]string{"weight"})
+	low, high := 1.0, 2.0
+
+	tests := []struct {
+		name   string
+		node   func() (Node, error)
+		sql    string
+		params map[string]interface{}
+	}{
+		{
+			name:   "column range",
+			node:   func() (Node, error) { return NewRange(registry, "price", &low, &high) },
+			sql:    "(price >= @p0 AND price <= @p1)",
+			params: map[string]interface{}{"p0": 1.0, "p1": 2.0},
+		},
+		{
+			name:   "open range",
+			node:   func() (Node, error) { return NewRange(registry, "originalPrice", nil, &high) },
+			sql:    "(SAFE_CAST(JSON_VALUE(product_data, '$.priceInfo.originalPrice') AS FLOAT64) <= @p0)",
+			params: map[string]interface{}{"p0": 2.0},
+		},
+		{
+			// Both bounds apply to the same attribute value
+			name:   "attribute range",
+			node:   func() (Node, error) { return NewRange(registry, "attributes.weight", &low, &high) },
+			sql:    "EXISTS(SELECT 1 FROM UNNEST(JSON_QUERY_ARRAY(product_data, '$.attributes')) AS a WHERE JSON_VALUE(a, '$.key') = @p2 AND EXISTS(SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(a, '$.value.numbers')) AS n WHERE SAFE_CAST(n AS FLOAT64) >= @p0 AND SAFE_CAST(n AS FLOAT64) <= @p1))",
+			params: map[string]interface{}{"p0": 1.0, "p1": 2.0, "p2": "weight"},
+		},
+		{
+			name:   "ids",
+			node:   func() (Node, error) { return &IDs{IDs: []string{"a", "b"}}, nil },
+			sql:    "product_id IN UNNEST(@p0)",
+			params: map[string]interface{}{"p0": []string{"a", "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := tt.node()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sql, params := CompileSQL(node, "p")
+			if sql != tt.sql {
+				t.Errorf("SQL = %s\nwant  %s", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("params = %v, want %v", params, tt.params)
+			}
+		})
+	}
+}
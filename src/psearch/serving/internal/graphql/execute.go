@@ -0,0 +1,651 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Request is a GraphQL request, as POSTed by clients or sent as GET query
+// parameters
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is a GraphQL response. Data is nil when the request failed
+// before execution started, such as on a syntax error.
+type Response struct {
+	Data   *Object  `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error with the document location and the response
+// path of the field that caused it
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+	// Pos is the byte offset of the cause in the document
+	Pos int `json:"-"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Location is a 1-based line and column in the document
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// ResolverFunc resolves a root query field from its arguments. The
+// selection lets resolvers skip work for fields the query does not ask for.
+// The result is projected onto the selection by its JSON field names.
+type ResolverFunc func(ctx context.Context, args map[string]interface{}, sel Selection) (interface{}, error)
+
+// Schema maps the root query field names to their resolvers
+type Schema struct {
+	Query map[string]ResolverFunc
+}
+
+// Execute parses the request and runs the selected query operation. Root
+// fields are resolved concurrently; a failing field is null in the data
+// and reported in the errors.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return errorResponse(req.Query, err)
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return errorResponse(req.Query, err)
+	}
+	if op.kind != "query" {
+		return errorResponse(req.Query, &Error{Message: fmt.Sprintf("%s operations are not supported", op.kind), Pos: op.pos})
+	}
+	variables, err := coerceVariables(op, req.Variables)
+	if err != nil {
+		return errorResponse(req.Query, err)
+	}
+
+	ex := &execution{doc: doc, variables: variables, query: req.Query}
+	root, err := ex.collect(op.selections, "Query")
+	if err != nil {
+		return errorResponse(req.Query, err)
+	}
+
+	results := make([]interface{}, len(root))
+	var wg sync.WaitGroup
+	for i, cf := range root {
+		path := []interface{}{cf.key}
+		if cf.name == "__typename" {
+			results[i] = "Query"
+			continue
+		}
+		resolver, ok := s.Query[cf.name]
+		if !ok {
+			ex.fail(&Error{Message: fmt.Sprintf("cannot query field %q on type \"Query\"", cf.name), Pos: cf.pos(), Path: path})
+			continue
+		}
+		args, err := ex.arguments(cf.fields[0])
+		if err != nil {
+			ex.fail(withPath(err, path))
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, cf *collectedField) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("GraphQL resolver %s panicked: %v", cf.name, r)
+					ex.fail(&Error{Message: "internal error", Pos: cf.pos(), Path: path})
+				}
+			}()
+
+			result, err := resolver(ctx, args, ex.selection(cf, ""))
+			if err != nil {
+				ex.fail(withPath(&Error{Message: err.Error(), Pos: cf.pos()}, path))
+				return
+			}
+			results[i] = ex.complete(reflect.ValueOf(result), cf, path)
+		}(i, cf)
+	}
+	wg.Wait()
+
+	data := &Object{}
+	for i, cf := range root {
+		data.set(cf.key, results[i])
+	}
+	return &Response{Data: data, Errors: ex.locate()}
+}
+
+// DecodeArguments decodes resolver arguments into the struct dst points to
+// by its JSON field names, rejecting unknown arguments
+func DecodeArguments(args map[string]interface{}, dst interface{}) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return fmt.Errorf("invalid arguments: %v", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// errorResponse reports a request that failed before execution
+func errorResponse(query string, err error) *Response {
+	gqlErr, ok := err.(*Error)
+	if !ok {
+		gqlErr = &Error{Message: err.Error()}
+	}
+	gqlErr.Locations = []Location{location(query, gqlErr.Pos)}
+	return &Response{Errors: []*Error{gqlErr}}
+}
+
+// withPath attaches a response path to an execution error
+func withPath(err error, path []interface{}) *Error {
+	gqlErr, ok := err.(*Error)
+	if !ok {
+		gqlErr = &Error{Message: err.Error()}
+	}
+	gqlErr.Path = path
+	return gqlErr
+}
+
+// location converts a byte offset in the document to a line and column
+func location(query string, pos int) Location {
+	if pos > len(query) {
+		pos = len(query)
+	}
+	line := 1 + strings.Count(query[:pos], "\n")
+	column := pos - strings.LastIndex(query[:pos], "\n")
+	return Location{Line: line, Column: column}
+}
+
+// selectOperation picks the operation to run: the named one, or the only
+// one in the document
+func selectOperation(doc *document, name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, &Error{Message: "operationName is required for documents with several operations"}
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("unknown operation %q", name)}
+}
+
+// coerceVariables applies the declared defaults to the provided variables
+// and checks that non-null variables are set. Variables that are declared
+// but not provided resolve to null.
+func coerceVariables(op *operation, provided map[string]interface{}) (map[string]interface{}, error) {
+	variables := make(map[string]interface{}, len(op.variables))
+	for _, def := range op.variables {
+		if provided, ok := provided[def.name]; ok {
+			if provided == nil && def.nonNull {
+				return nil, &Error{Message: fmt.Sprintf("variable $%s of non-null type must not be null", def.name), Pos: def.pos}
+			}
+			variables[def.name] = provided
+			continue
+		}
+		if def.defaultValue != nil {
+			resolved, err := def.defaultValue.resolve(nil)
+			if err != nil {
+				return nil, err
+			}
+			variables[def.name] = resolved
+			continue
+		}
+		if def.nonNull {
+			return nil, &Error{Message: fmt.Sprintf("variable $%s of non-null type was not provided", def.name), Pos: def.pos}
+		}
+		variables[def.name] = nil
+	}
+	return variables, nil
+}
+
+// execution holds the state of one operation
+type execution struct {
+	doc       *document
+	variables map[string]interface{}
+	query     string
+
+	mu     sync.Mutex
+	errors []*Error
+}
+
+// fail records a field error. An error repeated for every item of a list
+// is only reported for the first.
+func (ex *execution) fail(err *Error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	for _, existing := range ex.errors {
+		if existing.Message == err.Message && existing.Pos == err.Pos {
+			return
+		}
+	}
+	ex.errors = append(ex.errors, err)
+}
+
+// locate returns the recorded errors with their document locations
+func (ex *execution) locate() []*Error {
+	for _, err := range ex.errors {
+		err.Locations = []Location{location(ex.query, err.Pos)}
+	}
+	return ex.errors
+}
+
+// collectedField is the fields of a selection set sharing a response key,
+// merged after fragments are expanded
+type collectedField struct {
+	key    string
+	name   string
+	fields []*field
+}
+
+func (cf *collectedField) pos() int {
+	return cf.fields[0].pos
+}
+
+// selections returns the merged sub-selections of the fields
+func (cf *collectedField) selections() []selection {
+	var selections []selection
+	for _, f := range cf.fields {
+		selections = append(selections, f.selections...)
+	}
+	return selections
+}
+
+// collect expands fragments and applies directives, grouping fields by
+// response key in query order. Fragments whose type condition names
+// another type are skipped; an empty typeName matches every fragment.
+func (ex *execution) collect(selections []selection, typeName string) ([]*collectedField, error) {
+	var collected []*collectedField
+	if err := ex.collectInto(&collected, selections, typeName, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return collected, nil
+}
+
+func (ex *execution) collectInto(collected *[]*collectedField, selections []selection, typeName string, spreading map[string]bool) error {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			include, err := ex.include(sel.directives)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+			key := sel.responseKey()
+			merged := false
+			for _, cf := range *collected {
+				if cf.key != key {
+					continue
+				}
+				if cf.name != sel.name {
+					return &Error{Message: fmt.Sprintf("fields %q and %q conflict because they share the response key %q", cf.name, sel.name, key), Pos: sel.pos}
+				}
+				cf.fields = append(cf.fields, sel)
+				merged = true
+			}
+			if !merged {
+				*collected = append(*collected, &collectedField{key: key, name: sel.name, fields: []*field{sel}})
+			}
+		case *fragmentSpread:
+			include, err := ex.include(sel.directives)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+			frag, ok := ex.doc.fragments[sel.name]
+			if !ok {
+				return &Error{Message: fmt.Sprintf("unknown fragment %q", sel.name), Pos: sel.pos}
+			}
+			if spreading[sel.name] {
+				return &Error{Message: fmt.Sprintf("fragment %q spreads itself", sel.name), Pos: sel.pos}
+			}
+			if !typeMatches(frag.typeCondition, typeName) {
+				continue
+			}
+			spreading[sel.name] = true
+			err = ex.collectInto(collected, frag.selections, typeName, spreading)
+			delete(spreading, sel.name)
+			if err != nil {
+				return err
+			}
+		case *inlineFragment:
+			include, err := ex.include(sel.directives)
+			if err != nil {
+				return err
+			}
+			if !include || !typeMatches(sel.typeCondition, typeName) {
+				continue
+			}
+			if err := ex.collectInto(collected, sel.selections, typeName, spreading); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// typeMatches reports whether a fragment with the type condition applies
+// to a value of the type
+func typeMatches(typeCondition, typeName string) bool {
+	return typeCondition == "" || typeName == "" || typeCondition == typeName
+}
+
+// include evaluates the @skip and @include directives
+func (ex *execution) include(directives []directive) (bool, error) {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			return false, &Error{Message: fmt.Sprintf("unknown directive @%s", d.name), Pos: d.pos}
+		}
+		if len(d.arguments) != 1 || d.arguments[0].name != "if" {
+			return false, &Error{Message: fmt.Sprintf("directive @%s takes a single \"if\" argument", d.name), Pos: d.pos}
+		}
+		resolved, err := d.arguments[0].value.resolve(ex.variables)
+		if err != nil {
+			return false, err
+		}
+		condition, ok := resolved.(bool)
+		if !ok {
+			return false, &Error{Message: fmt.Sprintf("argument \"if\" of @%s must be a boolean", d.name), Pos: d.pos}
+		}
+		if condition == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// arguments resolves the arguments of a field
+func (ex *execution) arguments(f *field) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(f.arguments))
+	for _, arg := range f.arguments {
+		resolved, err := arg.value.resolve(ex.variables)
+		if err != nil {
+			return nil, err
+		}
+		args[arg.name] = resolved
+	}
+	return args, nil
+}
+
+// complete projects a resolved value onto the field's selection: objects
+// keep only the selected fields, lists are completed item by item, and
+// everything else is a leaf serialized as JSON
+func (ex *execution) complete(v reflect.Value, cf *collectedField, path []interface{}) interface{} {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	hasSelections := false
+	for _, f := range cf.fields {
+		hasSelections = hasSelections || len(f.selections) > 0
+	}
+
+	if isLeaf(v.Type()) {
+		if hasSelections {
+			ex.fail(&Error{Message: fmt.Sprintf("field %q of type %s has no subfields", cf.name, typeName(v.Type())), Pos: cf.pos(), Path: path})
+			return nil
+		}
+		return v.Interface()
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if !hasSelections {
+			ex.fail(&Error{Message: fmt.Sprintf("field %q of type [%s] must have a selection of subfields", cf.name, typeName(elemType(v.Type()))), Pos: cf.pos(), Path: path})
+			return nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = ex.complete(v.Index(i), cf, append(path[:len(path):len(path)], i))
+		}
+		return items
+	}
+
+	name := typeName(v.Type())
+	if !hasSelections {
+		ex.fail(&Error{Message: fmt.Sprintf("field %q of type %s must have a selection of subfields", cf.name, name), Pos: cf.pos(), Path: path})
+		return nil
+	}
+	fields, err := ex.collect(cf.selections(), name)
+	if err != nil {
+		ex.fail(withPath(err, path))
+		return nil
+	}
+
+	object := &Object{}
+	jsonFields := fieldsOf(v.Type())
+	for _, sub := range fields {
+		subPath := append(path[:len(path):len(path)], sub.key)
+		if sub.name == "__typename" {
+			object.set(sub.key, name)
+			continue
+		}
+		if len(sub.fields[0].arguments) > 0 {
+			ex.fail(&Error{Message: fmt.Sprintf("field %q on type %s takes no arguments", sub.name, name), Pos: sub.pos(), Path: subPath})
+			object.set(sub.key, nil)
+			continue
+		}
+		index, ok := jsonFields[sub.name]
+		if !ok {
+			ex.fail(&Error{Message: fmt.Sprintf("cannot query field %q on type %s", sub.name, name), Pos: sub.pos(), Path: subPath})
+			object.set(sub.key, nil)
+			continue
+		}
+		fieldValue, err := v.FieldByIndexErr(index)
+		if err != nil {
+			// A nil embedded pointer leaves its promoted fields null
+			object.set(sub.key, nil)
+			continue
+		}
+		object.set(sub.key, ex.complete(fieldValue, sub, subPath))
+	}
+	return object
+}
+
+// selection returns the public view of a field's selection
+func (ex *execution) selection(cf *collectedField, typeName string) Selection {
+	fields, err := ex.collect(cf.selections(), typeName)
+	if err != nil {
+		// The error is reported when the result is completed
+		return Selection{}
+	}
+	return Selection{ex: ex, fields: fields}
+}
+
+// Selection is the set of fields a query selects on a resolver's result,
+// after fragments and directives are applied
+type Selection struct {
+	ex     *execution
+	fields []*collectedField
+}
+
+// Fields returns the names of the selected fields, in query order
+func (s Selection) Fields() []string {
+	var names []string
+	for _, cf := range s.fields {
+		names = append(names, cf.name)
+	}
+	return names
+}
+
+// Has reports whether the field is selected
+func (s Selection) Has(name string) bool {
+	for _, cf := range s.fields {
+		if cf.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Field returns the selection on a field, merged across its aliases. It is
+// empty when the field is not selected.
+func (s Selection) Field(name string) Selection {
+	merged := &collectedField{name: name}
+	for _, cf := range s.fields {
+		if cf.name == name {
+			merged.fields = append(merged.fields, cf.fields...)
+		}
+	}
+	if len(merged.fields) == 0 {
+		return Selection{}
+	}
+	return s.ex.selection(merged, "")
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	fieldCache    sync.Map
+)
+
+// isLeaf reports whether values of the type are serialized whole rather
+// than projected: scalars, maps, dynamic values, JSON marshalers and lists
+// of them
+func isLeaf(t reflect.Type) bool {
+	if t.Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(jsonMarshaler) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return false
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return isLeaf(t.Elem())
+	}
+	return true
+}
+
+// elemType returns the innermost element type of a list type
+func elemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
+
+// typeName is the GraphQL type name of a Go type
+func typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.Kind().String()
+}
+
+// fieldsOf maps the JSON names of a struct's fields, including promoted
+// ones, to their indexes
+func fieldsOf(t reflect.Type) map[string][]int {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, exists := fields[name]; !exists || len(f.Index) < len(fields[name]) {
+			fields[name] = f.Index
+		}
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// Object is a JSON object that keeps its keys in selection order, as
+// GraphQL responses require
+type Object struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *Object) set(key string, value interface{}) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+// Get returns the value of a key
+func (o *Object) Get(key string) (interface{}, bool) {
+	for i, k := range o.keys {
+		if k == key {
+			return o.values[i], true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON encodes the object with its keys in order
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(encodedKey)
+		b.WriteByte(':')
+		encodedValue, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(encodedValue)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
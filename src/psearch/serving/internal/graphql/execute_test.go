@@ -0,0 +1,443 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPrice struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+type testBase struct {
+	ID string `json:"id"`
+}
+
+type testProduct struct {
+	testBase
+	Title      string                 `json:"title"`
+	Price      *testPrice             `json:"price,omitempty"`
+	Tags       []string               `json:"tags"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Related    []testProduct          `json:"related"`
+	Updated    time.Time              `json:"updated"`
+	Secret     string                 `json:"-"`
+}
+
+var testProducts = []testProduct{
+	{
+		testBase:   testBase{ID: "p1"},
+		Title:      "Trail shoes",
+		Price:      &testPrice{Amount: 89.5, Currency: "USD"},
+		Tags:       []string{"running", "trail"},
+		Attributes: map[string]interface{}{"color": "red"},
+		Related:    []testProduct{{testBase: testBase{ID: "p2"}, Title: "Socks"}},
+		Updated:    time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Secret:     "hidden",
+	},
+	{testBase: testBase{ID: "p2"}, Title: "Socks"},
+}
+
+// testSchema serves the test products, echoes its arguments back as a
+// leaf, and has fields that fail and panic
+func testSchema() *Schema {
+	return &Schema{Query: map[string]ResolverFunc{
+		"product": func(ctx context.Context, args map[string]interface{}, sel Selection) (interface{}, error) {
+			for _, p := range testProducts {
+				if p.ID == args["id"] {
+					return &p, nil
+				}
+			}
+			return nil, nil
+		},
+		"products": func(ctx context.Context, args map[string]interface{}, sel Selection) (interface{}, error) {
+			return testProducts, nil
+		},
+		"echo": func(ctx context.Context, args map[string]interface{}, sel Selection) (interface{}, error) {
+			return args, nil
+		},
+		"fail": func(ctx context.Context, args map[string]interface{}, sel Selection) (interface{}, error) {
+			return nil, errors.New("lookup failed")
+		},
+		"crash": func(ctx context.Context, args map[string]interface{}, sel Selection) (interface{}, error) {
+			panic("crash")
+		},
+	}}
+}
+
+// execute runs the request on the test schema and returns the response as
+// JSON
+func execute(t *testing.T, req Request) string {
+	t.Helper()
+	data, err := json.Marshal(testSchema().Execute(context.Background(), req))
+	if err != nil {
+		t.Fatalf("marshaling response: %v", err)
+	}
+	return string(data)
+}
+
+func TestExecuteSelection(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "fields in query order",
+			query: `{ product(id: "p1") { title id price { currency amount } } }`,
+			want:  `{"data":{"product":{"title":"Trail shoes","id":"p1","price":{"currency":"USD","amount":89.5}}}}`,
+		},
+		{
+			name:  "shorthand query keyword",
+			query: `query { product(id: "p2") { id } }`,
+			want:  `{"data":{"product":{"id":"p2"}}}`,
+		},
+		{
+			name:  "aliases",
+			query: `{ first: product(id: "p1") { name: title } second: product(id: "p2") { name: title } }`,
+			want:  `{"data":{"first":{"name":"Trail shoes"},"second":{"name":"Socks"}}}`,
+		},
+		{
+			name:  "lists of objects and leaves",
+			query: `{ products { id tags related { id } } }`,
+			want:  `{"data":{"products":[{"id":"p1","tags":["running","trail"],"related":[{"id":"p2"}]},{"id":"p2","tags":null,"related":null}]}}`,
+		},
+		{
+			name:  "nil pointers and results are null",
+			query: `{ product(id: "p2") { price { amount } } missing: product(id: "p9") { id } }`,
+			want:  `{"data":{"product":{"price":null},"missing":null}}`,
+		},
+		{
+			name:  "maps and marshalers are leaves",
+			query: `{ product(id: "p1") { attributes updated } }`,
+			want:  `{"data":{"product":{"attributes":{"color":"red"},"updated":"2025-01-02T03:04:05Z"}}}`,
+		},
+		{
+			name:  "repeated fields are merged",
+			query: `{ product(id: "p1") { price { amount } price { currency } } }`,
+			want:  `{"data":{"product":{"price":{"amount":89.5,"currency":"USD"}}}}`,
+		},
+		{
+			name:  "typename",
+			query: `{ __typename product(id: "p1") { __typename price { __typename } } }`,
+			want:  `{"data":{"__typename":"Query","product":{"__typename":"testProduct","price":{"__typename":"testPrice"}}}}`,
+		},
+		{
+			name:  "named and inline fragments",
+			query: `{ product(id: "p1") { ...names ... on testProduct { price { amount } } ... on Other { tags } } } fragment names on testProduct { id title }`,
+			want:  `{"data":{"product":{"id":"p1","title":"Trail shoes","price":{"amount":89.5}}}}`,
+		},
+		{
+			name:  "untyped inline fragment",
+			query: `{ product(id: "p1") { ... { id } } }`,
+			want:  `{"data":{"product":{"id":"p1"}}}`,
+		},
+		{
+			name:  "skip and include",
+			query: `{ product(id: "p1") { id @skip(if: true) title @include(if: true) tags @include(if: false) ... @skip(if: false) { price { currency } } } }`,
+			want:  `{"data":{"product":{"title":"Trail shoes","price":{"currency":"USD"}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execute(t, Request{Query: tt.query}); got != tt.want {
+				t.Errorf("response = %s\nwant       %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		want      string
+	}{
+		{
+			name:  "literals",
+			query: `{ echo(int: -3, float: 1.5e2, string: "a\"bé", yes: true, no: false, nothing: null, enum: PRICE_ASC) }`,
+			want:  `{"data":{"echo":{"enum":"PRICE_ASC","float":150,"int":-3,"no":false,"nothing":null,"string":"a\"bé","yes":true}}}`,
+		},
+		{
+			name:  "lists and objects",
+			query: `{ echo(list: [1, "two", [3]], object: {a: 1, b: {c: [true]}}, empty: []) }`,
+			want:  `{"data":{"echo":{"empty":[],"list":[1,"two",[3]],"object":{"a":1,"b":{"c":[true]}}}}}`,
+		},
+		{
+			name:      "variables",
+			query:     `query Q($id: ID!, $limit: Int = 10, $filter: String, $tags: [String!]) { echo(id: $id, limit: $limit, filter: $filter, nested: {tags: $tags}) }`,
+			variables: map[string]interface{}{"id": "p1", "tags": []interface{}{"a"}},
+			want:      `{"data":{"echo":{"filter":null,"id":"p1","limit":10,"nested":{"tags":["a"]}}}}`,
+		},
+		{
+			name:      "provided variables override defaults",
+			query:     `query ($limit: Int = 10) { echo(limit: $limit) }`,
+			variables: map[string]interface{}{"limit": 3},
+			want:      `{"data":{"echo":{"limit":3}}}`,
+		},
+		{
+			name:      "variables in directives",
+			query:     `query ($full: Boolean!) { product(id: "p1") { id title @include(if: $full) } }`,
+			variables: map[string]interface{}{"full": false},
+			want:      `{"data":{"product":{"id":"p1"}}}`,
+		},
+		{
+			name:      "operation name",
+			query:     `query A { echo(op: "a") } query B { echo(op: "b") }`,
+			variables: nil,
+			want:      `{"data":{"echo":{"op":"a"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := Request{Query: tt.query, Variables: tt.variables}
+			if tt.name == "operation name" {
+				req.OperationName = "A"
+			}
+			if got := execute(t, req); got != tt.want {
+				t.Errorf("response = %s\nwant       %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteRequestErrors(t *testing.T) {
+	// Requests that fail before execution have no data
+	tests := []struct {
+		name      string
+		req       Request
+		wantError string
+	}{
+		{
+			name:      "syntax error",
+			req:       Request{Query: "{\n  product(id: \"p1\") {\n    id\n  }"},
+			wantError: `{"message":"expected name for field, found end of document","locations":[{"line":4,"column":4}]}`,
+		},
+		{
+			name:      "mutation",
+			req:       Request{Query: `mutation { echo }`},
+			wantError: `{"message":"mutation operations are not supported","locations":[{"line":1,"column":1}]}`,
+		},
+		{
+			name:      "operation name required",
+			req:       Request{Query: `query A { echo } query B { echo }`},
+			wantError: `{"message":"operationName is required for documents with several operations","locations":[{"line":1,"column":1}]}`,
+		},
+		{
+			name:      "unknown operation",
+			req:       Request{Query: `query A { echo }`, OperationName: "B"},
+			wantError: `{"message":"unknown operation \"B\"","locations":[{"line":1,"column":1}]}`,
+		},
+		{
+			name:      "non-null variable not provided",
+			req:       Request{Query: `query ($id: ID!) { product(id: $id) { id } }`},
+			wantError: `{"message":"variable $id of non-null type was not provided","locations":[{"line":1,"column":8}]}`,
+		},
+		{
+			name:      "non-null variable null",
+			req:       Request{Query: `query ($id: ID!) { product(id: $id) { id } }`, Variables: map[string]interface{}{"id": nil}},
+			wantError: `{"message":"variable $id of non-null type must not be null","locations":[{"line":1,"column":8}]}`,
+		},
+		{
+			name:      "unknown fragment",
+			req:       Request{Query: `{ ...missing }`},
+			wantError: `{"message":"unknown fragment \"missing\"","locations":[{"line":1,"column":3}]}`,
+		},
+		{
+			name:      "fragment cycle",
+			req:       Request{Query: `{ ...a } fragment a on Query { ...b } fragment b on Query { ...a }`},
+			wantError: `{"message":"fragment \"a\" spreads itself","locations":[{"line":1,"column":61}]}`,
+		},
+		{
+			name:      "conflicting aliases",
+			req:       Request{Query: `{ x: echo x: fail }`},
+			wantError: `{"message":"fields \"echo\" and \"fail\" conflict because they share the response key \"x\"","locations":[{"line":1,"column":11}]}`,
+		},
+		{
+			name:      "unknown directive",
+			req:       Request{Query: `{ echo @defer }`},
+			wantError: `{"message":"unknown directive @defer","locations":[{"line":1,"column":8}]}`,
+		},
+		{
+			name:      "directive without if",
+			req:       Request{Query: `{ echo @skip(when: true) }`},
+			wantError: `{"message":"directive @skip takes a single \"if\" argument","locations":[{"line":1,"column":8}]}`,
+		},
+		{
+			name:      "directive with a non-boolean",
+			req:       Request{Query: `{ echo @include(if: "yes") }`},
+			wantError: `{"message":"argument \"if\" of @include must be a boolean","locations":[{"line":1,"column":8}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := `{"errors":[` + tt.wantError + `]}`
+			if got := execute(t, tt.req); got != want {
+				t.Errorf("response = %s\nwant       %s", got, want)
+			}
+		})
+	}
+}
+
+func TestExecuteFieldErrors(t *testing.T) {
+	// Failing fields are null, and the rest of the data is still returned
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "unknown root field",
+			query: `{ echo(a: 1) nope }`,
+			want:  `{"data":{"echo":{"a":1},"nope":null},"errors":[{"message":"cannot query field \"nope\" on type \"Query\"","locations":[{"line":1,"column":14}],"path":["nope"]}]}`,
+		},
+		{
+			name:  "resolver error",
+			query: `{ echo(a: 1) failed: fail }`,
+			want:  `{"data":{"echo":{"a":1},"failed":null},"errors":[{"message":"lookup failed","locations":[{"line":1,"column":14}],"path":["failed"]}]}`,
+		},
+		{
+			name:  "resolver panic",
+			query: `{ echo(a: 1) crash }`,
+			want:  `{"data":{"echo":{"a":1},"crash":null},"errors":[{"message":"internal error","locations":[{"line":1,"column":14}],"path":["crash"]}]}`,
+		},
+		{
+			name:  "undefined variable",
+			query: `{ echo(a: $nope) }`,
+			want:  `{"data":{"echo":null},"errors":[{"message":"variable $nope is not defined","locations":[{"line":1,"column":11}],"path":["echo"]}]}`,
+		},
+		{
+			name:  "unknown subfield",
+			query: `{ product(id: "p1") { id secret } }`,
+			want:  `{"data":{"product":{"id":"p1","secret":null}},"errors":[{"message":"cannot query field \"secret\" on type testProduct","locations":[{"line":1,"column":26}],"path":["product","secret"]}]}`,
+		},
+		{
+			name:  "subfield arguments",
+			query: `{ product(id: "p1") { title(lang: "fr") } }`,
+			want:  `{"data":{"product":{"title":null}},"errors":[{"message":"field \"title\" on type testProduct takes no arguments","locations":[{"line":1,"column":23}],"path":["product","title"]}]}`,
+		},
+		{
+			name:  "selection on a leaf",
+			query: `{ product(id: "p1") { title { length } } }`,
+			want:  `{"data":{"product":{"title":null}},"errors":[{"message":"field \"title\" of type string has no subfields","locations":[{"line":1,"column":23}],"path":["product","title"]}]}`,
+		},
+		{
+			name:  "object without a selection",
+			query: `{ product(id: "p1") }`,
+			want:  `{"data":{"product":null},"errors":[{"message":"field \"product\" of type testProduct must have a selection of subfields","locations":[{"line":1,"column":3}],"path":["product"]}]}`,
+		},
+		{
+			name:  "list without a selection",
+			query: `{ products }`,
+			want:  `{"data":{"products":null},"errors":[{"message":"field \"products\" of type [testProduct] must have a selection of subfields","locations":[{"line":1,"column":3}],"path":["products"]}]}`,
+		},
+		{
+			// Errors repeated for every list item are reported once, with
+			// the path of the first
+			name:  "errors in lists",
+			query: "{\n  products {\n    id\n    nope\n  }\n}",
+			want:  `{"data":{"products":[{"id":"p1","nope":null},{"id":"p2","nope":null}]},"errors":[{"message":"cannot query field \"nope\" on type testProduct","locations":[{"line":4,"column":5}],"path":["products",0,"nope"]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execute(t, Request{Query: tt.query}); got != tt.want {
+				t.Errorf("response = %s\nwant       %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelection(t *testing.T) {
+	var sel Selection
+	schema := &Schema{Query: map[string]ResolverFunc{
+		"product": func(ctx context.Context, args map[string]interface{}, s Selection) (interface{}, error) {
+			sel = s
+			return &testProducts[0], nil
+		},
+	}}
+	query := `{ product { id tags @skip(if: true) ... on testProduct { price { amount } } cost: price { currency } } }`
+	if resp := schema.Execute(context.Background(), Request{Query: query}); len(resp.Errors) > 0 {
+		t.Fatalf("Execute() errors: %v", resp.Errors[0].Message)
+	}
+
+	if got, want := sel.Fields(), []string{"id", "price", "price"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %q, want %q", got, want)
+	}
+	if !sel.Has("price") || sel.Has("tags") {
+		t.Errorf("Has(price), Has(tags) = %t, %t, want true, false", sel.Has("price"), sel.Has("tags"))
+	}
+	// Subselections of a field are merged across its aliases
+	if got, want := sel.Field("price").Fields(), []string{"amount", "currency"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Field(price).Fields() = %q, want %q", got, want)
+	}
+	if got := sel.Field("title").Fields(); len(got) != 0 {
+		t.Errorf("Field(title).Fields() = %q, want none", got)
+	}
+}
+
+func TestDecodeArguments(t *testing.T) {
+	var dst struct {
+		Query string   `json:"query"`
+		Limit int      `json:"limit"`
+		Tags  []string `json:"tags"`
+	}
+	args := map[string]interface{}{"query": "shoes", "limit": int64(5), "tags": []interface{}{"a"}}
+	if err := DecodeArguments(args, &dst); err != nil {
+		t.Fatalf("DecodeArguments() error: %v", err)
+	}
+	if dst.Query != "shoes" || dst.Limit != 5 || !reflect.DeepEqual(dst.Tags, []string{"a"}) {
+		t.Errorf("decoded %+v", dst)
+	}
+
+	err := DecodeArguments(map[string]interface{}{"qeury": "shoes"}, &dst)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "qeury"`) {
+		t.Errorf("DecodeArguments() with an unknown argument = %v", err)
+	}
+	err = DecodeArguments(map[string]interface{}{"limit": "five"}, &dst)
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid arguments: ") {
+		t.Errorf("DecodeArguments() with a mistyped argument = %v", err)
+	}
+}
+
+func TestObject(t *testing.T) {
+	o := &Object{}
+	o.set("b", 1)
+	o.set("a", []interface{}{"x"})
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"b":1,"a":["x"]}`; got != want {
+		t.Errorf("MarshalJSON() = %s, want %s", got, want)
+	}
+	if v, ok := o.Get("b"); !ok || v != 1 {
+		t.Errorf("Get(b) = %v, %t", v, ok)
+	}
+	if _, ok := o.Get("c"); ok {
+		t.Error("Get(c) found a missing key")
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package graphql executes the subset of GraphQL served on /graphql: query
+// operations with variables, aliases, arguments, named and inline fragments,
+// and the @include and @skip directives. Object types are the API's Go
+// models, and a field's GraphQL name is its JSON name, so a query selects
+// from exactly the shape the REST endpoints return.
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind identifies the lexical class of a token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenString
+	tokenInt
+	tokenFloat
+	tokenPunct
+	tokenSpread
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of document"
+	case tokenName:
+		return "name"
+	case tokenString:
+		return "string"
+	case tokenInt:
+		return "integer"
+	case tokenFloat:
+		return "float"
+	case tokenPunct:
+		return "punctuator"
+	case tokenSpread:
+		return "'...'"
+	}
+	return "token"
+}
+
+// token is a lexeme with its byte offset in the document
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// punctuators are the single-character tokens of the grammar
+const punctuators = "{}()[]:!$=@"
+
+// lex splits the document into tokens. Whitespace, commas and comments are
+// insignificant.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+		case strings.IndexByte(punctuators, c) >= 0:
+			tokens = append(tokens, token{tokenPunct, string(c), i})
+			i++
+		case c == '.':
+			if !strings.HasPrefix(input[i:], "...") {
+				return nil, &Error{Message: "unexpected '.'", Pos: i}
+			}
+			tokens = append(tokens, token{tokenSpread, "...", i})
+			i += 3
+		case c == '"':
+			text, end, err := lexString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, text, i})
+			i = end
+		case c == '-' || isDigit(c):
+			start := i
+			kind := tokenInt
+			i++
+			for i < len(input) && (isDigit(input[i]) || input[i] == '.' || input[i] == 'e' || input[i] == 'E' ||
+				((input[i] == '+' || input[i] == '-') && (input[i-1] == 'e' || input[i-1] == 'E'))) {
+				if !isDigit(input[i]) {
+					kind = tokenFloat
+				}
+				i++
+			}
+			tokens = append(tokens, token{kind, input[start:i], start})
+		case isNameStart(c):
+			start := i
+			for i < len(input) && (isNameStart(input[i]) || isDigit(input[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenName, input[start:i], start})
+		default:
+			return nil, &Error{Message: fmt.Sprintf("unexpected character %q", c), Pos: i}
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", len(input)})
+	return tokens, nil
+}
+
+// lexString reads a double-quoted string starting at start, decoding
+// escapes, and returns the text and the offset after the closing quote
+func lexString(input string, start int) (string, int, error) {
+	var b strings.Builder
+	i := start + 1
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == '\\' && i+1 < len(input):
+			switch esc := input[i+1]; esc {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if i+6 > len(input) {
+					return "", 0, &Error{Message: "invalid unicode escape", Pos: i}
+				}
+				r, err := strconv.ParseUint(input[i+2:i+6], 16, 16)
+				if err != nil {
+					return "", 0, &Error{Message: "invalid unicode escape", Pos: i}
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			default:
+				b.WriteByte(esc)
+			}
+			i += 2
+		case c == '"':
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, &Error{Message: "unterminated string", Pos: start}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, &Error{Message: "unterminated string", Pos: start}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,586 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// document is a parsed GraphQL document
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation is a query, mutation or subscription definition
+type operation struct {
+	kind       string
+	name       string
+	variables  []variableDefinition
+	directives []directive
+	selections []selection
+	pos        int
+}
+
+// variableDefinition declares an operation variable
+type variableDefinition struct {
+	name         string
+	nonNull      bool
+	defaultValue *value
+	pos          int
+}
+
+// fragment is a named fragment definition
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []directive
+	selections    []selection
+}
+
+// selection is a field, fragment spread or inline fragment
+type selection interface {
+	selectionNode()
+}
+
+type field struct {
+	alias      string
+	name       string
+	arguments  []argument
+	directives []directive
+	selections []selection
+	pos        int
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []directive
+	pos        int
+}
+
+type inlineFragment struct {
+	typeCondition string
+	directives    []directive
+	selections    []selection
+}
+
+func (*field) selectionNode()          {}
+func (*fragmentSpread) selectionNode() {}
+func (*inlineFragment) selectionNode() {}
+
+// responseKey is the alias of the field, or its name without one
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type directive struct {
+	name      string
+	arguments []argument
+	pos       int
+}
+
+type argument struct {
+	name  string
+	value value
+}
+
+// valueKind identifies the kind of an input value literal
+type valueKind int
+
+const (
+	valueVariable valueKind = iota
+	valueInt
+	valueFloat
+	valueString
+	valueBoolean
+	valueNull
+	valueEnum
+	valueList
+	valueObject
+)
+
+// value is an input value literal
+type value struct {
+	kind   valueKind
+	text   string
+	list   []value
+	fields []argument
+	pos    int
+}
+
+// resolve converts the literal to a Go value, substituting variables.
+// Integers become int64, floats float64, enums their name as a string,
+// lists []interface{} and objects map[string]interface{}.
+func (v value) resolve(variables map[string]interface{}) (interface{}, error) {
+	switch v.kind {
+	case valueVariable:
+		resolved, ok := variables[v.text]
+		if !ok {
+			return nil, &Error{Message: fmt.Sprintf("variable $%s is not defined", v.text), Pos: v.pos}
+		}
+		return resolved, nil
+	case valueInt:
+		n, err := strconv.ParseInt(v.text, 10, 64)
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("invalid integer %s", v.text), Pos: v.pos}
+		}
+		return n, nil
+	case valueFloat:
+		f, err := strconv.ParseFloat(v.text, 64)
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("invalid float %s", v.text), Pos: v.pos}
+		}
+		return f, nil
+	case valueString, valueEnum:
+		return v.text, nil
+	case valueBoolean:
+		return v.text == "true", nil
+	case valueNull:
+		return nil, nil
+	case valueList:
+		items := make([]interface{}, len(v.list))
+		for i, item := range v.list {
+			resolved, err := item.resolve(variables)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = resolved
+		}
+		return items, nil
+	case valueObject:
+		fields := make(map[string]interface{}, len(v.fields))
+		for _, f := range v.fields {
+			resolved, err := f.value.resolve(variables)
+			if err != nil {
+				return nil, err
+			}
+			fields[f.name] = resolved
+		}
+		return fields, nil
+	}
+	return nil, &Error{Message: "invalid value", Pos: v.pos}
+}
+
+// parse parses a GraphQL document
+func parse(input string) (*document, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.peek().kind != tokenEOF {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokenPunct && tok.text == "{":
+			selections, err := p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: selections, pos: tok.pos})
+		case tok.kind == tokenName && (tok.text == "query" || tok.text == "mutation" || tok.text == "subscription"):
+			op, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case tok.kind == tokenName && tok.text == "fragment":
+			frag, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := doc.fragments[frag.name]; exists {
+				return nil, &Error{Message: fmt.Sprintf("fragment %q is defined more than once", frag.name), Pos: tok.pos}
+			}
+			doc.fragments[frag.name] = frag
+		default:
+			return nil, &Error{Message: fmt.Sprintf("unexpected %s, expected an operation or fragment definition", describe(tok)), Pos: tok.pos}
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, &Error{Message: "document contains no operations"}
+	}
+	return doc, nil
+}
+
+// parser is a recursive-descent parser over the token stream:
+//
+//	document     := (operation | fragment)+
+//	operation    := selectionSet
+//	              | ("query" | "mutation" | "subscription") name? variables? directives? selectionSet
+//	variables    := "(" ("$" name ":" type ("=" value)?)+ ")"
+//	type         := (name | "[" type "]") "!"?
+//	fragment     := "fragment" name "on" name directives? selectionSet
+//	selectionSet := "{" selection+ "}"
+//	selection    := field | "..." name directives? | "..." ("on" name)? directives? selectionSet
+//	field        := (name ":")? name arguments? directives? selectionSet?
+//	arguments    := "(" (name ":" value)+ ")"
+//	directives   := ("@" name arguments?)+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// peekPunct reports whether the next token is the punctuator text
+func (p *parser) peekPunct(text string) bool {
+	tok := p.peek()
+	return tok.kind == tokenPunct && tok.text == text
+}
+
+func (p *parser) expectPunct(text, context string) error {
+	tok := p.next()
+	if tok.kind != tokenPunct || tok.text != text {
+		return &Error{Message: fmt.Sprintf("expected '%s' %s, found %s", text, context, describe(tok)), Pos: tok.pos}
+	}
+	return nil
+}
+
+func (p *parser) expectName(context string) (token, error) {
+	tok := p.next()
+	if tok.kind != tokenName {
+		return tok, &Error{Message: fmt.Sprintf("expected name %s, found %s", context, describe(tok)), Pos: tok.pos}
+	}
+	return tok, nil
+}
+
+func (p *parser) parseOperation() (*operation, error) {
+	kind := p.next()
+	op := &operation{kind: kind.text, pos: kind.pos}
+	if p.peek().kind == tokenName {
+		op.name = p.next().text
+	}
+	if p.peekPunct("(") {
+		p.next()
+		for !p.peekPunct(")") {
+			def, err := p.parseVariableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, def)
+		}
+		p.next()
+	}
+	directives, err := p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+	op.directives = directives
+	op.selections, err = p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) parseVariableDefinition() (variableDefinition, error) {
+	start := p.peek()
+	if err := p.expectPunct("$", "before variable name"); err != nil {
+		return variableDefinition{}, err
+	}
+	name, err := p.expectName("after '$'")
+	if err != nil {
+		return variableDefinition{}, err
+	}
+	if err := p.expectPunct(":", "after variable name"); err != nil {
+		return variableDefinition{}, err
+	}
+	nonNull, err := p.parseType()
+	if err != nil {
+		return variableDefinition{}, err
+	}
+	def := variableDefinition{name: name.text, nonNull: nonNull, pos: start.pos}
+	if p.peekPunct("=") {
+		p.next()
+		defaultValue, err := p.parseValue(true)
+		if err != nil {
+			return variableDefinition{}, err
+		}
+		def.defaultValue = &defaultValue
+	}
+	return def, nil
+}
+
+// parseType skips a type reference and reports whether it is non-null.
+// Input values are checked by the resolvers, so only nullability matters.
+func (p *parser) parseType() (bool, error) {
+	if p.peekPunct("[") {
+		p.next()
+		if _, err := p.parseType(); err != nil {
+			return false, err
+		}
+		if err := p.expectPunct("]", "to close list type"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.expectName("for variable type"); err != nil {
+		return false, err
+	}
+	if p.peekPunct("!") {
+		p.next()
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *parser) parseFragment() (*fragment, error) {
+	p.next()
+	name, err := p.expectName("for fragment")
+	if err != nil {
+		return nil, err
+	}
+	if name.text == "on" {
+		return nil, &Error{Message: "fragment cannot be named \"on\"", Pos: name.pos}
+	}
+	on := p.next()
+	if on.kind != tokenName || on.text != "on" {
+		return nil, &Error{Message: fmt.Sprintf("expected \"on\" after fragment name, found %s", describe(on)), Pos: on.pos}
+	}
+	typeCondition, err := p.expectName("for fragment type condition")
+	if err != nil {
+		return nil, err
+	}
+	frag := &fragment{name: name.text, typeCondition: typeCondition.text}
+	if frag.directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if frag.selections, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+func (p *parser) parseSelectionSet() ([]selection, error) {
+	if err := p.expectPunct("{", "to open selection set"); err != nil {
+		return nil, err
+	}
+	var selections []selection
+	for !p.peekPunct("}") {
+		sel, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, &Error{Message: "selection set is empty", Pos: p.tokens[p.pos-1].pos}
+	}
+	return selections, nil
+}
+
+func (p *parser) parseSelection() (selection, error) {
+	if p.peek().kind != tokenSpread {
+		return p.parseField()
+	}
+
+	spread := p.next()
+	if tok := p.peek(); tok.kind == tokenName && tok.text != "on" {
+		p.next()
+		directives, err := p.parseDirectives()
+		if err != nil {
+			return nil, err
+		}
+		return &fragmentSpread{name: tok.text, directives: directives, pos: spread.pos}, nil
+	}
+
+	inline := &inlineFragment{}
+	if tok := p.peek(); tok.kind == tokenName && tok.text == "on" {
+		p.next()
+		typeCondition, err := p.expectName("for inline fragment type condition")
+		if err != nil {
+			return nil, err
+		}
+		inline.typeCondition = typeCondition.text
+	}
+	var err error
+	if inline.directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if inline.selections, err = p.parseSelectionSet(); err != nil {
+		return nil, err
+	}
+	return inline, nil
+}
+
+func (p *parser) parseField() (*field, error) {
+	name, err := p.expectName("for field")
+	if err != nil {
+		return nil, err
+	}
+	f := &field{name: name.text, pos: name.pos}
+	if p.peekPunct(":") {
+		p.next()
+		actual, err := p.expectName("after alias")
+		if err != nil {
+			return nil, err
+		}
+		f.alias, f.name = f.name, actual.text
+	}
+	if p.peekPunct("(") {
+		if f.arguments, err = p.parseArguments(false); err != nil {
+			return nil, err
+		}
+	}
+	if f.directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if p.peekPunct("{") {
+		if f.selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) parseArguments(constant bool) ([]argument, error) {
+	p.next()
+	var arguments []argument
+	for !p.peekPunct(")") {
+		name, err := p.expectName("for argument")
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range arguments {
+			if existing.name == name.text {
+				return nil, &Error{Message: fmt.Sprintf("argument %q is given more than once", name.text), Pos: name.pos}
+			}
+		}
+		if err := p.expectPunct(":", "after argument name"); err != nil {
+			return nil, err
+		}
+		val, err := p.parseValue(constant)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument{name: name.text, value: val})
+	}
+	p.next()
+	if len(arguments) == 0 {
+		return nil, &Error{Message: "argument list is empty", Pos: p.tokens[p.pos-1].pos}
+	}
+	return arguments, nil
+}
+
+func (p *parser) parseDirectives() ([]directive, error) {
+	var directives []directive
+	for p.peekPunct("@") {
+		at := p.next()
+		name, err := p.expectName("after '@'")
+		if err != nil {
+			return nil, err
+		}
+		d := directive{name: name.text, pos: at.pos}
+		if p.peekPunct("(") {
+			if d.arguments, err = p.parseArguments(false); err != nil {
+				return nil, err
+			}
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+// parseValue parses an input value. Constant values, such as variable
+// defaults, cannot reference variables.
+func (p *parser) parseValue(constant bool) (value, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenInt:
+		return value{kind: valueInt, text: tok.text, pos: tok.pos}, nil
+	case tokenFloat:
+		return value{kind: valueFloat, text: tok.text, pos: tok.pos}, nil
+	case tokenString:
+		return value{kind: valueString, text: tok.text, pos: tok.pos}, nil
+	case tokenName:
+		switch tok.text {
+		case "true", "false":
+			return value{kind: valueBoolean, text: tok.text, pos: tok.pos}, nil
+		case "null":
+			return value{kind: valueNull, pos: tok.pos}, nil
+		}
+		return value{kind: valueEnum, text: tok.text, pos: tok.pos}, nil
+	case tokenPunct:
+		switch tok.text {
+		case "$":
+			if constant {
+				return value{}, &Error{Message: "variables are not allowed in constant values", Pos: tok.pos}
+			}
+			name, err := p.expectName("after '$'")
+			if err != nil {
+				return value{}, err
+			}
+			return value{kind: valueVariable, text: name.text, pos: tok.pos}, nil
+		case "[":
+			list := value{kind: valueList, list: []value{}, pos: tok.pos}
+			for !p.peekPunct("]") {
+				if p.peek().kind == tokenEOF {
+					return value{}, &Error{Message: "unterminated list", Pos: tok.pos}
+				}
+				item, err := p.parseValue(constant)
+				if err != nil {
+					return value{}, err
+				}
+				list.list = append(list.list, item)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			object := value{kind: valueObject, pos: tok.pos}
+			for !p.peekPunct("}") {
+				name, err := p.expectName("for object field")
+				if err != nil {
+					return value{}, err
+				}
+				if err := p.expectPunct(":", "after object field name"); err != nil {
+					return value{}, err
+				}
+				fieldValue, err := p.parseValue(constant)
+				if err != nil {
+					return value{}, err
+				}
+				object.fields = append(object.fields, argument{name: name.text, value: fieldValue})
+			}
+			p.next()
+			return object, nil
+		}
+	}
+	return value{}, &Error{Message: fmt.Sprintf("expected a value, found %s", describe(tok)), Pos: tok.pos}
+}
+
+// describe renders a token for error messages
+func describe(tok token) string {
+	if tok.kind == tokenEOF {
+		return tok.kind.String()
+	}
+	return fmt.Sprintf("%q", tok.text)
+}
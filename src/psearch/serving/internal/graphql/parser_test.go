@@ -0,0 +1,195 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []token
+	}{
+		{
+			input: "{ a(b: 1, c: -2.5e3) }",
+			want: []token{
+				{tokenPunct, "{", 0}, {tokenName, "a", 2}, {tokenPunct, "(", 3}, {tokenName, "b", 4}, {tokenPunct, ":", 5},
+				{tokenInt, "1", 7}, {tokenName, "c", 10}, {tokenPunct, ":", 11}, {tokenFloat, "-2.5e3", 13},
+				{tokenPunct, ")", 19}, {tokenPunct, "}", 21}, {tokenEOF, "", 22},
+			},
+		},
+		{
+			input: "# comment\n...on_1 $x! 1e+2",
+			want: []token{
+				{tokenSpread, "...", 10}, {tokenName, "on_1", 13}, {tokenPunct, "$", 18}, {tokenName, "x", 19},
+				{tokenPunct, "!", 20}, {tokenFloat, "1e+2", 22}, {tokenEOF, "", 26},
+			},
+		},
+		{
+			input: `"a\"b\\c\n\té\/" "é"`,
+			want:  []token{{tokenString, "a\"b\\c\n\té/", 0}, {tokenString, "é", 18}, {tokenEOF, "", 22}},
+		},
+		{
+			input: `"\u00e9\u0041"`,
+			want:  []token{{tokenString, "éA", 0}, {tokenEOF, "", 14}},
+		},
+		{
+			input: " ,\t\r\n",
+			want:  []token{{tokenEOF, "", 5}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := lex(tt.input)
+		if err != nil {
+			t.Errorf("lex(%q) error: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lex(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc, err := parse(`
+		query Search($q: String!, $limit: Int = 10, $tags: [String!]!) @skip(if: false) {
+			search(query: $q, limit: $limit) { id hits: total }
+		}
+		fragment names on Product @include(if: true) { title }
+		{ ...names ... on Product { id } ... { id } }
+	`)
+	if err != nil {
+		t.Fatalf("parse() error: %v", err)
+	}
+
+	if len(doc.operations) != 2 {
+		t.Fatalf("parse() = %d operations, want 2", len(doc.operations))
+	}
+	op := doc.operations[0]
+	if op.kind != "query" || op.name != "Search" || len(op.directives) != 1 {
+		t.Errorf("operation = %s %q with %d directives, want query \"Search\" with 1", op.kind, op.name, len(op.directives))
+	}
+	var vars []string
+	for _, v := range op.variables {
+		vars = append(vars, v.name)
+		if v.nonNull != (v.name != "limit") {
+			t.Errorf("variable $%s nonNull = %t", v.name, v.nonNull)
+		}
+	}
+	if want := []string{"q", "limit", "tags"}; !reflect.DeepEqual(vars, want) {
+		t.Errorf("variables = %q, want %q", vars, want)
+	}
+	if d := op.variables[1].defaultValue; d == nil || d.kind != valueInt || d.text != "10" {
+		t.Errorf("$limit default = %+v, want 10", d)
+	}
+
+	search := op.selections[0].(*field)
+	if search.name != "search" || len(search.arguments) != 2 || search.arguments[0].value.kind != valueVariable {
+		t.Errorf("search field = %+v", search)
+	}
+	hits := search.selections[1].(*field)
+	if hits.alias != "hits" || hits.name != "total" || hits.responseKey() != "hits" {
+		t.Errorf("aliased field = %q: %q", hits.alias, hits.name)
+	}
+
+	frag := doc.fragments["names"]
+	if frag == nil || frag.typeCondition != "Product" || len(frag.directives) != 1 || len(frag.selections) != 1 {
+		t.Errorf("fragment names = %+v", frag)
+	}
+
+	anonymous := doc.operations[1]
+	if anonymous.kind != "query" || anonymous.name != "" || len(anonymous.selections) != 3 {
+		t.Fatalf("anonymous operation = %+v", anonymous)
+	}
+	if spread, ok := anonymous.selections[0].(*fragmentSpread); !ok || spread.name != "names" {
+		t.Errorf("selection 0 = %+v, want a spread of names", anonymous.selections[0])
+	}
+	if inline, ok := anonymous.selections[1].(*inlineFragment); !ok || inline.typeCondition != "Product" {
+		t.Errorf("selection 1 = %+v, want an inline fragment on Product", anonymous.selections[1])
+	}
+	if inline, ok := anonymous.selections[2].(*inlineFragment); !ok || inline.typeCondition != "" {
+		t.Errorf("selection 2 = %+v, want an untyped inline fragment", anonymous.selections[2])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		pos     int
+	}{
+		{"{ a.b }", "unexpected '.'", 3},
+		{"{ a % }", `unexpected character '%'`, 4},
+		{`{ a(b: "\u00g1") }`, "invalid unicode escape", 8},
+		{`{ a(b: "\u12") }`, "invalid unicode escape", 8},
+		{`{ a(b: "abc) }`, "unterminated string", 7},
+		{"{ a(b: \"ab\nc\") }", "unterminated string", 7},
+		{"", "document contains no operations", 0},
+		{"# only a comment", "document contains no operations", 0},
+		{"fragment f on Q { a }", "document contains no operations", 0},
+		{"{ a } }", `unexpected "}", expected an operation or fragment definition`, 6},
+		{"{ a } fragment f on Q { a } fragment f on Q { b }", `fragment "f" is defined more than once`, 28},
+		{"{ a ", "expected name for field, found end of document", 4},
+		{"{ }", "selection set is empty", 2},
+		{"query Q", "expected '{' to open selection set, found end of document", 7},
+		{"{ a: }", `expected name after alias, found "}"`, 5},
+		{"{ a(b: 1 b: 2) }", `argument "b" is given more than once`, 9},
+		{"{ a() }", "argument list is empty", 4},
+		{"{ a(b 1) }", `expected ':' after argument name, found "1"`, 6},
+		{"{ a(b: ) }", `expected a value, found ")"`, 7},
+		{"{ a(b: [1, 2 }", `expected a value, found "}"`, 13},
+		{"{ a(b: [1, 2", "unterminated list", 7},
+		{"query ($x: Int = $y) { a }", "variables are not allowed in constant values", 17},
+		{"query ($x Int) { a }", `expected ':' after variable name, found "Int"`, 10},
+		{"query ($x: [Int) { a }", `expected ']' to close list type, found ")"`, 15},
+		{"{ a @ }", `expected name after '@', found "}"`, 6},
+		{"fragment on on Q { a }", `fragment cannot be named "on"`, 9},
+		{"fragment f Q { a }", `expected "on" after fragment name, found "Q"`, 11},
+		{"{ ... on { a } }", `expected name for inline fragment type condition, found "{"`, 9},
+	}
+	for _, tt := range tests {
+		_, err := parse(tt.input)
+		gqlErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("parse(%q) error = %v, want an *Error", tt.input, err)
+			continue
+		}
+		if gqlErr.Message != tt.message || gqlErr.Pos != tt.pos {
+			t.Errorf("parse(%q) error = %q at %d, want %q at %d", tt.input, gqlErr.Message, gqlErr.Pos, tt.message, tt.pos)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	query := "{\n  a\n\tb }"
+	tests := []struct {
+		pos  int
+		want Location
+	}{
+		{0, Location{Line: 1, Column: 1}},
+		{4, Location{Line: 2, Column: 3}},
+		{7, Location{Line: 3, Column: 2}},
+		{len(query), Location{Line: 3, Column: 5}},
+	}
+	for _, tt := range tests {
+		if got := location(query, tt.pos); got != tt.want {
+			t.Errorf("location(%d) = %+v, want %+v", tt.pos, got, tt.want)
+		}
+	}
+}
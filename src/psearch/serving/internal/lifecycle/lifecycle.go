@@ -0,0 +1,136 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lifecycle runs the HTTP server and coordinates graceful shutdown
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// shutdownHook is a named cleanup step run after the server has drained
+type shutdownHook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Manager starts the HTTP server, traps SIGTERM/SIGINT and shuts down in
+// order: stop accepting connections, drain in-flight requests, then run the
+// registered hooks (closing clients, flushing telemetry)
+type Manager struct {
+	server       *http.Server
+	drainTimeout time.Duration
+
+	mu    sync.Mutex
+	hooks []shutdownHook
+}
+
+// NewManager creates a lifecycle manager for the server
+func NewManager(server *http.Server, drainTimeout time.Duration) *Manager {
+	return &Manager{
+		server:       server,
+		drainTimeout: drainTimeout,
+	}
+}
+
+// OnShutdown registers a hook to run after in-flight requests have drained.
+// Hooks run in reverse registration order, so dependencies registered first
+// are closed last.
+func (m *Manager) OnShutdown(name string, fn func(context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Run serves until a termination signal arrives or the server fails, then
+// performs the graceful shutdown sequence
+func (m *Manager) Run() error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := m.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case sig := <-quit:
+		log.Printf("Received %s, shutting down server...", sig)
+	case err, ok := <-serveErr:
+		if ok && err != nil {
+			m.runHooks()
+			return fmt.Errorf("server failed: %v", err)
+		}
+	}
+
+	return m.shutdown()
+}
+
+// shutdown drains in-flight requests within the drain timeout and then runs
+// the shutdown hooks
+func (m *Manager) shutdown() error {
+	// Shutdown closes the listeners immediately and waits for active
+	// handlers to return, so new requests are refused while searches finish
+	ctx, cancel := context.WithTimeout(context.Background(), m.drainTimeout)
+	defer cancel()
+
+	start := time.Now()
+	drainErr := m.server.Shutdown(ctx)
+	if drainErr != nil {
+		log.Printf("Drain timeout of %s exceeded, closing remaining connections: %v", m.drainTimeout, drainErr)
+		m.server.Close()
+	} else {
+		log.Printf("In-flight requests drained in %s", time.Since(start))
+	}
+
+	m.runHooks()
+
+	if drainErr != nil {
+		return fmt.Errorf("server forced to shutdown: %v", drainErr)
+	}
+	log.Println("Server gracefully stopped")
+	return nil
+}
+
+// runHooks runs the shutdown hooks in reverse order, each with its own
+// timeout so a slow hook cannot block the others
+func (m *Manager) runHooks() {
+	m.mu.Lock()
+	hooks := append([]shutdownHook(nil), m.hooks...)
+	m.mu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := hook.fn(ctx); err != nil {
+			log.Printf("Shutdown hook %s failed: %v", hook.name, err)
+		}
+		cancel()
+	}
+}
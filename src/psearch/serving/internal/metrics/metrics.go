@@ -0,0 +1,256 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics defines the Prometheus metrics exported on /metrics. Cloud
+// Monitoring ingests them through Managed Service for Prometheus.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "psearch"
+
+var (
+	// HTTPRequests counts requests by route and response status
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration measures request latency by route
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route"})
+
+	// SLIAvailability counts requests to shopper-facing routes by tenant
+	// and whether they avoided a server error. Cloud Monitoring SLOs take
+	// good="true" over the total as their availability ratio.
+	SLIAvailability = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sli_availability_total",
+		Help:      "Requests to SLO-covered routes by method, route, tenant and whether they were served without a server error.",
+	}, []string{"method", "route", "tenant", "good"})
+
+	// SLILatency counts successfully served requests to shopper-facing
+	// routes by tenant and whether they met the route's latency threshold
+	SLILatency = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sli_latency_total",
+		Help:      "Served requests to SLO-covered routes by method, route, tenant and whether they met the latency threshold.",
+	}, []string{"method", "route", "tenant", "good"})
+
+	// InFlightRequests tracks requests holding a slot in each priority
+	// class's concurrency pool
+	InFlightRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "in_flight_requests",
+		Help:      "Requests being served by priority class.",
+	}, []string{"class"})
+
+	// ShedRequests counts requests rejected because their priority class's
+	// concurrency pool stayed full
+	ShedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shed_requests_total",
+		Help:      "Requests rejected with 503 because their priority class was at its concurrency limit.",
+	}, []string{"class"})
+
+	// HedgedSearches counts search queries raced by a hedged stale read,
+	// by which attempt responded first
+	HedgedSearches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hedged_searches_total",
+		Help:      "Search queries that fired a hedged attempt, by the attempt that won (primary or hedge).",
+	}, []string{"winner"})
+
+	// EmbeddingDuration measures Vertex AI embedding latency
+	EmbeddingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "embedding_duration_seconds",
+		Help:      "Latency of embedding generation calls by outcome.",
+		Buckets:   []float64{.01, .025, .05, .1, .2, .3, .5, 1, 2.5},
+	}, []string{"outcome"})
+
+	// SpannerQueryDuration measures Spanner query latency by operation
+	SpannerQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "spanner_query_duration_seconds",
+		Help:      "Latency of Spanner queries by operation and outcome.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "outcome"})
+
+	// CacheRequests counts cache lookups by cache name and result
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	// RemoteCallRetries counts retries of remote calls by operation
+	RemoteCallRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "remote_call_retries_total",
+		Help:      "Retries of remote calls after transient failures, by operation.",
+	}, []string{"operation"})
+
+	// CircuitBreakerState reports each circuit breaker's state
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state: 0 closed, 1 open, 2 half-open.",
+	}, []string{"breaker"})
+
+	// SearchFallbacks counts searches served in a degraded mode
+	SearchFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "search_fallbacks_total",
+		Help:      "Searches served in a degraded mode, by fallback and reason.",
+	}, []string{"fallback", "reason"})
+
+	// IdentifierLookups counts SKU-like queries looked up by exact
+	// identifier, by outcome. Misses fall back to hybrid search.
+	IdentifierLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "identifier_lookups_total",
+		Help:      "SKU-like queries looked up by exact identifier, by outcome (hit, miss, error).",
+	}, []string{"outcome"})
+
+	// SearchEvents counts recorded search events by type
+	SearchEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "search_events_total",
+		Help:      "Recorded search events by type (impression, click, add_to_cart, purchase).",
+	}, []string{"type"})
+
+	// SearchLogRows counts search logs by whether they were written to
+	// BigQuery, dropped because the buffer was full, or failed to write
+	SearchLogRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "search_log_rows_total",
+		Help:      "Search logs by outcome (written, dropped, failed).",
+	}, []string{"outcome"})
+
+	// IndexingEvents counts product change events handled by the indexing
+	// worker, by operation and outcome
+	IndexingEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "indexing_events_total",
+		Help:      "Product change events by operation (upsert, delete) and outcome (applied, retried, dead_lettered).",
+	}, []string{"op", "outcome"})
+
+	// IndexingDuration measures how long applying a product change event
+	// takes, including embedding
+	IndexingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "indexing_duration_seconds",
+		Help:      "Time to apply a product change event, by operation.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"op"})
+
+	// ExperimentSearches counts searches served by each experiment arm and
+	// whether they found results
+	ExperimentSearches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "experiment_searches_total",
+		Help:      "Searches by experiment, arm and whether they returned results.",
+	}, []string{"experiment", "arm", "has_results"})
+
+	// ExperimentSearchDuration measures search latency by experiment arm
+	ExperimentSearchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "experiment_search_duration_seconds",
+		Help:      "Search latency by experiment and arm.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"experiment", "arm"})
+
+	// ExperimentEvents counts recorded search events by experiment arm, for
+	// click-through and conversion rates per arm
+	ExperimentEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "experiment_events_total",
+		Help:      "Recorded search events by experiment, arm and type.",
+	}, []string{"experiment", "arm", "type"})
+
+	// AuthRequests counts authentication attempts by credential method,
+	// client and outcome. Firebase users share a single client label.
+	AuthRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_requests_total",
+		Help:      "Authentication attempts by method, client and outcome.",
+	}, []string{"method", "client", "outcome"})
+
+	// ANNRecall reports the mean recall@k of the ANN index over the queries
+	// sampled by the last recall check
+	ANNRecall = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ann_recall",
+		Help:      "Mean share of the exact nearest neighbours the ANN index returned in the last recall check.",
+	})
+
+	// ANNQueryRecall tracks the recall@k of each sampled query
+	ANNQueryRecall = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ann_query_recall",
+		Help:      "Share of the exact nearest neighbours the ANN index returned, per sampled query.",
+		Buckets:   []float64{.5, .6, .7, .8, .85, .9, .95, .99, 1},
+	})
+
+	// ProductsMissingEmbedding reports how many products the vector index
+	// cannot return because they have no embedding
+	ProductsMissingEmbedding = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "products_missing_embedding",
+		Help:      "Products without an embedding as of the last recall check.",
+	})
+
+	// SearchResultCount tracks how many results searches return
+	SearchResultCount = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "search_result_count",
+		Help:      "Number of results returned per search by mode.",
+		Buckets:   []float64{0, 1, 5, 10, 25, 50, 100, 250, 500},
+	}, []string{"mode"})
+)
+
+// Outcome returns the outcome label for an operation result
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// ObserveSince records the time elapsed since start on the histogram
+func ObserveSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// RecordCacheLookup counts a cache hit or miss
+func RecordCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheRequests.WithLabelValues(cache, result).Inc()
+}
@@ -16,18 +16,727 @@
 
 package models
 
+import "time"
+
+// SearchMode selects which retrieval branches a search runs
+type SearchMode string
+
+const (
+	// SearchModeHybrid fuses vector and keyword results
+	SearchModeHybrid SearchMode = "hybrid"
+	// SearchModeVector runs only the vector (ANN) branch
+	SearchModeVector SearchMode = "vector"
+	// SearchModeKeyword runs only the full-text branch and skips embedding generation
+	SearchModeKeyword SearchMode = "keyword"
+)
+
+// BrowseSort selects the order of category browse results
+type BrowseSort string
+
+const (
+	// BrowseSortPopularity lists the most rated products first
+	BrowseSortPopularity BrowseSort = "popularity"
+	// BrowseSortPriceAsc lists the cheapest products first
+	BrowseSortPriceAsc BrowseSort = "price_asc"
+	// BrowseSortPriceDesc lists the most expensive products first
+	BrowseSortPriceDesc BrowseSort = "price_desc"
+	// BrowseSortNewest lists the most recently published products first
+	BrowseSortNewest BrowseSort = "newest"
+)
+
+// SearchSort selects the order of search results
+type SearchSort string
+
+const (
+	// SearchSortRelevance orders results by fused score
+	SearchSortRelevance SearchSort = "relevance"
+	// SearchSortPriceAsc lists the cheapest matching products first
+	SearchSortPriceAsc SearchSort = "price_asc"
+	// SearchSortPriceDesc lists the most expensive matching products first
+	SearchSortPriceDesc SearchSort = "price_desc"
+	// SearchSortNewest lists the most recently published matching products first
+	SearchSortNewest SearchSort = "newest"
+	// SearchSortRating lists the best rated matching products first
+	SearchSortRating SearchSort = "rating"
+)
+
+// LocalAvailabilityMode selects how a search uses local store availability
+type LocalAvailabilityMode string
+
+const (
+	// LocalAvailabilityFilter only returns products in stock nearby
+	LocalAvailabilityFilter LocalAvailabilityMode = "filter"
+	// LocalAvailabilityBoost ranks products in stock nearby first
+	LocalAvailabilityBoost LocalAvailabilityMode = "boost"
+)
+
 // SearchRequest represents a search query request
 type SearchRequest struct {
-	Query     string   `json:"query" binding:"required"`
-	Limit     *int     `json:"limit,omitempty"`
-	MinScore  *float64 `json:"min_score,omitempty"`
-	Alpha     *float64 `json:"alpha,omitempty"`
+	Query     string     `json:"query" binding:"required"`
+	Limit     *int       `json:"limit,omitempty"`
+	MinScore  *float64   `json:"min_score,omitempty"`
+	Alpha     *float64   `json:"alpha,omitempty"`
+	Mode      SearchMode `json:"mode,omitempty" binding:"omitempty,oneof=hybrid vector keyword"`
+	Offset    *int       `json:"offset,omitempty"`
+	// Filter is a filter expression, e.g. brands: ANY("Nike") AND price < 100
+	Filter    string     `json:"filter,omitempty"`
+	// MinPrice and MaxPrice bound the price, inclusive. Like Ranges, they
+	// are combined with Filter using AND.
+	MinPrice *float64 `json:"min_price,omitempty"`
+	MaxPrice *float64 `json:"max_price,omitempty"`
+	// Ranges bounds numeric fields by filter field name, e.g.
+	// originalPrice or attributes.weight_kg
+	Ranges map[string]NumericRange `json:"ranges,omitempty"`
+	// Rerank reorders the fused candidates with the semantic ranking API
+	Rerank    bool       `json:"rerank,omitempty"`
+	// ConsistencyToken from a previous page pins this request to the same snapshot
+	ConsistencyToken string `json:"consistency_token,omitempty"`
+	// RefineFrom is the refinement_token of a previous search; only the
+	// products that search returned are searched
+	RefineFrom string `json:"refine_from,omitempty" binding:"omitempty,max=64"`
+	// ExpandQuery also searches with paraphrases of the query, each embedded
+	// and retrieved separately, then fused with the original
+	ExpandQuery bool `json:"expand_query,omitempty"`
+	// Debug adds stage timings, cost estimates, per-result score
+	// breakdowns and the executed SQL to the response
+	Debug bool `json:"debug,omitempty"`
+	// StalenessSeconds overrides SPANNER_STALENESS_SECONDS; 0 forces a strong read
+	StalenessSeconds *float64 `json:"staleness_seconds,omitempty"`
+	// IncludeRawScores adds the FTS SCORE() and ANN cosine distance behind
+	// each result to its score map as "fts" and "ann_distance"
+	IncludeRawScores bool `json:"include_raw_scores,omitempty"`
+	// Category selects the scoring profile whose defaults apply when alpha,
+	// min_score or mode are not set. It does not filter results; without
+	// it, the category detected by query understanding is used.
+	Category string `json:"category,omitempty"`
+	// CatalogID selects the catalog to search in multi-catalog deployments
+	CatalogID string `json:"catalog_id,omitempty"`
+	// UserID personalizes vector search with the preference embedding
+	// learned from the user's clicks
+	UserID string `json:"user_id,omitempty" binding:"omitempty,max=128"`
+	// SessionID assigns anonymous shoppers to experiment arms; user_id
+	// takes precedence when both are set. With session context enabled,
+	// follow-ups are resolved against the session's previous search.
+	SessionID string `json:"session_id,omitempty" binding:"omitempty,max=128"`
+	// UserEmbedding personalizes vector search with a caller-supplied
+	// preference embedding instead of a learned one
+	UserEmbedding []float32 `json:"user_embedding,omitempty"`
+	// PersonalizationWeight overrides PERSONALIZATION_WEIGHT, the share of
+	// the user embedding in the blended query embedding
+	PersonalizationWeight *float64 `json:"personalization_weight,omitempty" binding:"omitempty,min=0,max=1"`
+	// EmbeddingVersion names the embedding model version the vector branch
+	// searches, one of EMBEDDING_VERSIONS or "default"; empty uses
+	// EMBEDDING_SERVING_VERSION. The X-Embedding-Version header sets it
+	// too.
+	EmbeddingVersion string `json:"embedding_version,omitempty" binding:"omitempty,max=32"`
+	// Hydrate set to false returns only product IDs and scores in Hits,
+	// for callers that hydrate product data from their own cache
+	Hydrate *bool `json:"hydrate,omitempty"`
+	// Fields limits each result to these fields, as JSON paths such as
+	// "title" or "priceInfo.price"; id is always returned. Empty returns
+	// every field. Only POST /search applies it.
+	Fields []string `json:"fields,omitempty"`
+	// Currency converts prices to this ISO 4217 currency; the
+	// Accept-Currency header is used when it is not set
+	Currency string `json:"currency,omitempty" binding:"omitempty,len=3"`
+	// Locale selects the products' translated text and formats prices,
+	// e.g. de-DE; the Accept-Language header is used when it is not set
+	Locale string `json:"locale,omitempty"`
+	// Language is the BCP 47 language of the query, e.g. "de", used to
+	// tokenize it for keyword matching. It is detected when not set and
+	// LANGUAGE_DETECTION_ENABLED is on.
+	Language string `json:"language,omitempty" binding:"omitempty,bcp47_language_tag"`
+	// Advanced tunes the vector search, overriding the deployment's
+	// settings
+	Advanced *AdvancedSearchOptions `json:"advanced,omitempty"`
+	// Keyword tunes how the keyword branch matches the query, overriding
+	// the deployment's settings
+	Keyword *KeywordSearchOptions `json:"keyword,omitempty"`
+	// Boosts scale the fused score of matching products, for campaign
+	// searches that should not wait for a merchandising rule
+	Boosts []Boost `json:"boosts,omitempty" binding:"omitempty,max=20,dive"`
+	// Facets adds counts of the values of the products' indexable
+	// attributes to the response. It is ignored when hydrate is false.
+	Facets bool `json:"facets,omitempty"`
+	// Latitude and Longitude locate the shopper for pickup searches, which
+	// consider the stores within RadiusKm, defaulting to LOCAL_RADIUS_KM.
+	// StoreID considers one store instead.
+	Latitude  *float64 `json:"latitude,omitempty" binding:"omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude,omitempty" binding:"omitempty,min=-180,max=180"`
+	RadiusKm  *float64 `json:"radius_km,omitempty" binding:"omitempty,gt=0,max=500"`
+	StoreID   string   `json:"store_id,omitempty" binding:"omitempty,max=64"`
+	// LocalAvailability selects whether products not in stock at those
+	// stores are dropped (filter, the default) or ranked after those that
+	// are (boost)
+	LocalAvailability LocalAvailabilityMode `json:"local_availability,omitempty" binding:"omitempty,oneof=filter boost"`
+	// SortBy orders the matching products by a field instead of
+	// relevance. Sorted searches match the top SORT_CANDIDATES candidates
+	// of each retrieval branch.
+	SortBy SearchSort `json:"sort_by,omitempty" binding:"omitempty,oneof=relevance price_asc price_desc newest rating"`
+	// FeatureFlags overrides the deployment's feature flags for this
+	// search, for canary testing. The X-Feature-Flags header sets the
+	// flags it leaves out, as name=bool pairs.
+	FeatureFlags map[string]bool `json:"feature_flags,omitempty" binding:"omitempty,max=10"`
+}
+
+// Fields a Boost can match
+const (
+	BoostFieldCategory = "category"
+	BoostFieldBrand    = "brand"
+)
+
+// Boost multiplies the fused score of the products whose category or brand
+// is Value by Factor. Factors below 1 demote them.
+type Boost struct {
+	Field  string  `json:"field" binding:"required,oneof=category brand"`
+	Value  string  `json:"value" binding:"required"`
+	Factor float64 `json:"factor" binding:"gt=0,lte=10"`
+}
+
+// AdvancedSearchOptions trade vector search recall for latency. Unset
+// fields use the deployment's ANN_* settings.
+type AdvancedSearchOptions struct {
+	// NumLeavesToSearch is how many vector index leaves each lookup
+	// searches; more raise recall and latency
+	NumLeavesToSearch int `json:"num_leaves_to_search,omitempty" binding:"omitempty,min=1,max=1000"`
+	// CandidateMultiplier scales how many candidates the vector branch
+	// ranks beyond the requested page before fusion
+	CandidateMultiplier float64 `json:"candidate_multiplier,omitempty" binding:"omitempty,min=1,max=10"`
+	// DistanceMetric is "cosine" or "dot_product"
+	DistanceMetric string `json:"distance_metric,omitempty" binding:"omitempty,oneof=cosine dot_product"`
+}
+
+// KeywordSearchOptions tune how the keyword branch matches the query.
+// Unset fields use the deployment's FTS_* settings.
+type KeywordSearchOptions struct {
+	// Dialect is the SEARCH dialect: "rquery", "words" or "words_phrase"
+	Dialect string `json:"dialect,omitempty" binding:"omitempty,oneof=rquery words words_phrase"`
+	// MinimumShouldMatch is how many of the query's terms a product must
+	// match in the rquery dialect: a count such as "2", a count of terms
+	// that may be missing such as "-1", or a percentage such as "75%"
+	MinimumShouldMatch string `json:"minimum_should_match,omitempty" binding:"omitempty,max=8"`
+	// PhraseMatching matches quoted parts of the query as exact phrases;
+	// false searches their words separately
+	PhraseMatching *bool `json:"phrase_matching,omitempty"`
+	// EnhanceQuery also matches synonyms and spelling variants of the
+	// query words
+	EnhanceQuery *bool `json:"enhance_query,omitempty"`
+}
+
+// NumericRange bounds a numeric field, inclusive. Either end may be omitted.
+type NumericRange struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// QueryIntent is the structured intent extracted from a free-text query
+type QueryIntent struct {
+	NormalizedQuery string   `json:"normalized_query"`
+	Brands          []string `json:"brands,omitempty"`
+	Colors          []string `json:"colors,omitempty"`
+	Categories      []string `json:"categories,omitempty"`
+	MinPrice        *float64 `json:"min_price,omitempty"`
+	MaxPrice        *float64 `json:"max_price,omitempty"`
 }
 
 // SearchResponse represents the response to a search query
 type SearchResponse struct {
 	Results    []SearchResult `json:"results"`
 	TotalFound int            `json:"total_found"`
+	// ConsistencyToken identifies the snapshot these results were read at
+	ConsistencyToken string `json:"consistency_token,omitempty"`
+	// RefinementToken scopes a later search to these results when sent as
+	// its refine_from. Only the returned page is covered, so searches meant
+	// to be refined should ask for a larger limit.
+	RefinementToken string `json:"refinement_token,omitempty"`
+	// Fallback names the degraded mode the search was served in, such as
+	// keyword_only when embeddings were unavailable
+	Fallback string `json:"fallback,omitempty"`
+	// Debug is only populated when the request sets debug
+	Debug *SearchDebug `json:"debug,omitempty"`
+	// Interpretation is the intent applied to the query when query
+	// understanding is enabled
+	Interpretation *QueryIntent `json:"interpretation,omitempty"`
+	// CorrectedQuery is the spelling-corrected query, suggested when the
+	// query contains words missing from the catalog vocabulary
+	CorrectedQuery string `json:"corrected_query,omitempty"`
+	// AutoCorrected is set when the original query found nothing and the
+	// results are for CorrectedQuery instead
+	AutoCorrected bool `json:"auto_corrected,omitempty"`
+	// ResolvedQuery is the query searched when the request was a follow-up
+	// to its session's previous search, such as "cheaper ones"
+	ResolvedQuery string `json:"resolved_query,omitempty"`
+	// Language is the query language the search was run in, requested or
+	// detected; empty when neither
+	Language string `json:"language,omitempty"`
+	// EmbeddingVersion is the embedding model version the vector branch
+	// searched; empty for keyword searches
+	EmbeddingVersion string `json:"embedding_version,omitempty"`
+	// ExactMatch is set when the query looked like a SKU or product
+	// identifier and the results are exact matches for it
+	ExactMatch bool `json:"exact_match,omitempty"`
+	// Warnings report degradations applied to the search
+	Warnings []Warning `json:"warnings,omitempty"`
+	// Experiment is the experiment arm whose ranking configuration served
+	// the search, to be echoed on the search events it leads to
+	Experiment *ExperimentAssignment `json:"experiment,omitempty"`
+	// Hits replaces Results for requests that set hydrate to false
+	Hits []SearchHit `json:"hits,omitempty"`
+	// Facets are only populated when the request sets facets
+	Facets []Facet `json:"facets,omitempty"`
+}
+
+// Facet counts the results holding each value of an indexable attribute.
+// Text values are listed most common first; numeric attributes report the
+// range of their values instead.
+type Facet struct {
+	Key string `json:"key"`
+	// Count is the number of results with the attribute
+	Count  int          `json:"count"`
+	Values []FacetValue `json:"values,omitempty"`
+	Min    *float64     `json:"min,omitempty"`
+	Max    *float64     `json:"max,omitempty"`
+}
+
+// FacetValue is a facet value and the number of results holding it
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// SearchHit is an unhydrated search result
+type SearchHit struct {
+	ID    string             `json:"id"`
+	Score map[string]float64 `json:"score"`
+}
+
+// Warning reports a degradation applied to a search, so clients can adjust
+// their UX instead of showing degraded results as if they were complete
+type Warning struct {
+	Code    WarningCode `json:"code"`
+	Message string      `json:"message"`
+}
+
+// WarningCode identifies the kind of degradation a warning reports
+type WarningCode string
+
+const (
+	// WarningEmbeddingFallback means semantic matching was unavailable and
+	// the results are keyword matches only
+	WarningEmbeddingFallback WarningCode = "embedding_fallback"
+	// WarningStaleCache means the results came from an expired cache entry
+	// while it is refreshed
+	WarningStaleCache WarningCode = "stale_cache"
+	// WarningQueryUnderstandingFailed means no intent was extracted, so the
+	// raw query was searched without intent filters
+	WarningQueryUnderstandingFailed WarningCode = "query_understanding_failed"
+	// WarningRerankFailed means semantic reranking failed and the results
+	// are in fused order
+	WarningRerankFailed WarningCode = "rerank_failed"
+	// WarningPinsSkipped means pinned products could not be fetched, so
+	// merchandising pins were not applied
+	WarningPinsSkipped WarningCode = "pins_skipped"
+	// WarningPersonalizationSkipped means the user's profile could not be
+	// read or is not the caller's, so the results are not personalized
+	WarningPersonalizationSkipped WarningCode = "personalization_skipped"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Details is optional structured context, such as a filter error
+	// position or the request caps a request exceeds
+	Details interface{} `json:"details,omitempty"`
+	// RequestID identifies the request in the server logs; it is echoed in
+	// the X-Request-Id response header
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ErrorCode classifies an error response, so clients can handle errors
+// without parsing messages. Each code maps to one HTTP status.
+type ErrorCode string
+
+const (
+	// ErrorInvalidArgument means the request is malformed or exceeds a cap
+	ErrorInvalidArgument ErrorCode = "invalid_argument"
+	// ErrorUnauthenticated means the request carries no valid credentials
+	ErrorUnauthenticated ErrorCode = "unauthenticated"
+	// ErrorPermissionDenied means the caller may not make the request
+	ErrorPermissionDenied ErrorCode = "permission_denied"
+	// ErrorNotFound means the addressed resource does not exist
+	ErrorNotFound ErrorCode = "not_found"
+	// ErrorConflict means the request conflicts with the service state,
+	// such as a feature that is not enabled
+	ErrorConflict ErrorCode = "conflict"
+	// ErrorPayloadTooLarge means the request body exceeds its size limit
+	ErrorPayloadTooLarge ErrorCode = "payload_too_large"
+	// ErrorResourceExhausted means a backend quota was exhausted; retry
+	// with backoff
+	ErrorResourceExhausted ErrorCode = "resource_exhausted"
+	// ErrorUnavailable means the service or a backend is temporarily
+	// unavailable; retry with backoff
+	ErrorUnavailable ErrorCode = "unavailable"
+	// ErrorDeadlineExceeded means the request did not complete in time
+	ErrorDeadlineExceeded ErrorCode = "deadline_exceeded"
+	// ErrorInternal means the request failed unexpectedly
+	ErrorInternal ErrorCode = "internal"
+)
+
+// BrowseRequest holds the query parameters of a category browse request
+type BrowseRequest struct {
+	Sort   BrowseSort `form:"sort" binding:"omitempty,oneof=popularity price_asc price_desc newest"`
+	Limit  *int       `form:"limit" binding:"omitempty,min=1"`
+	Offset *int       `form:"offset" binding:"omitempty,min=0"`
+	Filter string     `form:"filter"`
+	// CatalogID selects the catalog to browse in multi-catalog deployments
+	CatalogID string `form:"catalog_id"`
+	// Currency and Locale localize prices like SearchRequest's
+	Currency string `form:"currency" binding:"omitempty,len=3"`
+	Locale   string `form:"locale"`
+}
+
+// BrowseResponse represents a page of products in a category
+type BrowseResponse struct {
+	Results    []SearchResult `json:"results"`
+	TotalFound int            `json:"total_found"`
+	Category   string         `json:"category"`
+	Sort       BrowseSort     `json:"sort"`
+	// NextOffset is the offset of the next page, absent on the last page
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// RelevanceSample is a sampled tail query with the top results it returned,
+// for human relevance review
+type RelevanceSample struct {
+	// Week is the ISO week the query was sampled for, such as 2025-W07
+	Week  string `json:"week"`
+	Query string `json:"query"`
+	// Stratum is the search volume range the query was sampled from
+	Stratum   string                  `json:"stratum"`
+	Searches  int64                   `json:"searches"`
+	Results   []RelevanceSampleResult `json:"results"`
+	SampledAt time.Time               `json:"sampled_at"`
+}
+
+// RelevanceSampleResult is one result of a sampled query, in rank order
+type RelevanceSampleResult struct {
+	ProductID string  `json:"product_id"`
+	Title     string  `json:"title"`
+	Score     float64 `json:"score"`
+}
+
+// RelevanceSampleListRequest selects the week of relevance samples to list
+type RelevanceSampleListRequest struct {
+	// Week defaults to the current ISO week
+	Week string `form:"week"`
+}
+
+// RelevanceSampleListResponse lists a week's relevance samples
+type RelevanceSampleListResponse struct {
+	Week    string            `json:"week"`
+	Samples []RelevanceSample `json:"samples"`
+}
+
+// Judgment labels the products relevant to a query. Grades give graded
+// relevance for NDCG, higher being more relevant; relevant products
+// without a grade have grade 1.
+type Judgment struct {
+	Query    string         `json:"query" binding:"required"`
+	Relevant []string       `json:"relevant" binding:"required,min=1"`
+	Grades   map[string]int `json:"grades,omitempty"`
+	// Filter restricts the search, as in SearchRequest
+	Filter string `json:"filter,omitempty"`
+}
+
+// RankingConfig is a ranking configuration to evaluate. Unset fields keep
+// the deployment's settings.
+type RankingConfig struct {
+	Name             string          `json:"name" binding:"required,max=64"`
+	Mode             SearchMode      `json:"mode,omitempty" binding:"omitempty,oneof=hybrid vector keyword"`
+	Alpha            *float64        `json:"alpha,omitempty" binding:"omitempty,min=0,max=1"`
+	Rerank           bool            `json:"rerank,omitempty"`
+	EmbeddingVersion string          `json:"embedding_version,omitempty" binding:"omitempty,max=32"`
+	FeatureFlags     map[string]bool `json:"feature_flags,omitempty"`
+}
+
+// EvaluationRequest evaluates ranking configurations against a judgment
+// set
+type EvaluationRequest struct {
+	Judgments []Judgment `json:"judgments" binding:"required,min=1,max=1000,dive"`
+	// Configs defaults to a single "default" configuration with the
+	// deployment's settings
+	Configs []RankingConfig `json:"configs,omitempty" binding:"omitempty,max=10,dive"`
+	// K is the rank cutoff of every metric, 10 by default
+	K         int    `json:"k,omitempty" binding:"omitempty,min=1,max=100"`
+	CatalogID string `json:"catalog_id,omitempty"`
+}
+
+// EvaluationReport compares the ranking configurations of an evaluation,
+// in request order
+type EvaluationReport struct {
+	K         int                `json:"k"`
+	Judgments int                `json:"judgments"`
+	Configs   []ConfigEvaluation `json:"configs"`
+}
+
+// ConfigEvaluation holds a ranking configuration's metrics, averaged over
+// the judgment set. Queries whose search failed score zero.
+type ConfigEvaluation struct {
+	Name    string            `json:"name"`
+	NDCG    float64           `json:"ndcg"`
+	Recall  float64           `json:"recall"`
+	MRR     float64           `json:"mrr"`
+	Failed  int               `json:"failed"`
+	Queries []QueryEvaluation `json:"queries"`
+}
+
+// QueryEvaluation holds the metrics of one judged query
+type QueryEvaluation struct {
+	Query          string  `json:"query"`
+	NDCG           float64 `json:"ndcg"`
+	Recall         float64 `json:"recall"`
+	ReciprocalRank float64 `json:"reciprocal_rank"`
+	// Error is why the search failed, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// QueryAnalyticsRequest holds the query parameters of a query analytics
+// request
+type QueryAnalyticsRequest struct {
+	// Hours is the length of the reported period ending now, defaulting
+	// to 24. Trending queries compare it with the period before.
+	Hours int `form:"hours" binding:"omitempty,min=1,max=720"`
+	// Limit is how many top and trending queries to list, defaulting to 20
+	Limit int `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
+
+// QueryStats summarizes the searches for a query
+type QueryStats struct {
+	Query          string  `json:"query"`
+	Searches       int64   `json:"searches"`
+	ZeroResultRate float64 `json:"zero_result_rate"`
+	AvgLatencyMs   float64 `json:"avg_latency_ms"`
+}
+
+// TrendingQuery is a query searched more than in the previous period
+type TrendingQuery struct {
+	Query            string `json:"query"`
+	Searches         int64  `json:"searches"`
+	PreviousSearches int64  `json:"previous_searches"`
+	// Growth is the relative increase in searches; queries not searched
+	// in the previous period grow by their search count
+	Growth float64 `json:"growth"`
+}
+
+// QueryAnalyticsResponse reports search volume and quality over a period.
+// Its totals include queries counted together beyond ANALYTICS_MAX_QUERIES.
+type QueryAnalyticsResponse struct {
+	Since          time.Time       `json:"since"`
+	Until          time.Time       `json:"until"`
+	Searches       int64           `json:"searches"`
+	ZeroResultRate float64         `json:"zero_result_rate"`
+	AvgLatencyMs   float64         `json:"avg_latency_ms"`
+	TopQueries     []QueryStats    `json:"top_queries"`
+	Trending       []TrendingQuery `json:"trending"`
+}
+
+// SimilarProductsRequest holds the query parameters of a similar products
+// request
+type SimilarProductsRequest struct {
+	Limit *int `json:"limit,omitempty" form:"limit" binding:"omitempty,min=1"`
+	// SameCategory only returns products sharing a category with the seed
+	SameCategory bool   `json:"same_category,omitempty" form:"same_category"`
+	Filter       string `json:"filter,omitempty" form:"filter"`
+	// CatalogID selects the catalog in multi-catalog deployments
+	CatalogID string `json:"catalog_id,omitempty" form:"catalog_id"`
+	// Currency and Locale localize prices like SearchRequest's
+	Currency string `json:"currency,omitempty" form:"currency" binding:"omitempty,len=3"`
+	Locale   string `json:"locale,omitempty" form:"locale"`
+}
+
+// ProductRequest holds the query parameters of a single product fetch
+type ProductRequest struct {
+	// StalenessSeconds overrides SPANNER_STALENESS_SECONDS; 0 forces a strong read
+	StalenessSeconds *float64 `json:"staleness_seconds,omitempty" form:"staleness_seconds"`
+	// CatalogID selects the catalog in multi-catalog deployments
+	CatalogID string `json:"catalog_id,omitempty" form:"catalog_id"`
+	// Fields is a comma-separated list of the fields to return, like
+	// SearchRequest.Fields
+	Fields string `json:"fields,omitempty" form:"fields"`
+	// Currency and Locale localize prices like SearchRequest's
+	Currency string `json:"currency,omitempty" form:"currency" binding:"omitempty,len=3"`
+	Locale   string `json:"locale,omitempty" form:"locale"`
+}
+
+// DeleteProductRequest holds the query parameters of a product deletion
+type DeleteProductRequest struct {
+	// Soft hides the product from search and product reads but keeps its
+	// row, so it can be restored
+	Soft bool `json:"soft,omitempty" form:"soft"`
+	// CatalogID selects the catalog in multi-catalog deployments
+	CatalogID string `json:"catalog_id,omitempty" form:"catalog_id"`
+}
+
+// ProductUpdateResponse is the product after a partial update
+type ProductUpdateResponse struct {
+	Product SearchResult `json:"product"`
+	// Reembedded is set when the update changed the title or description
+	// and the product's embedding was regenerated
+	Reembedded bool `json:"reembedded"`
+}
+
+// SimilarProductsResponse lists the products most similar to a product
+type SimilarProductsResponse struct {
+	ProductID  string         `json:"product_id"`
+	Results    []SearchResult `json:"results"`
+	TotalFound int            `json:"total_found"`
+}
+
+// ImageSearchRequest holds the parameters of an image search. The image is
+// uploaded as the image part of a multipart/form-data request, whose other
+// parts set these fields, or sent in a JSON request as ImageBase64 or
+// named by GCSURI.
+type ImageSearchRequest struct {
+	ImageBase64 string `json:"image_base64,omitempty" form:"-"`
+	// GCSURI is the gs:// URI of an image Vertex AI can read
+	GCSURI string `json:"gcs_uri,omitempty" form:"gcs_uri"`
+	Limit  *int   `json:"limit,omitempty" form:"limit" binding:"omitempty,min=1"`
+	Filter string `json:"filter,omitempty" form:"filter"`
+	// CatalogID selects the catalog in multi-catalog deployments
+	CatalogID string `json:"catalog_id,omitempty" form:"catalog_id"`
+	// Currency and Locale localize prices like SearchRequest's
+	Currency string `json:"currency,omitempty" form:"currency" binding:"omitempty,len=3"`
+	Locale   string `json:"locale,omitempty" form:"locale"`
+}
+
+// ImageSearchResponse lists the products whose images look most like the
+// query image
+type ImageSearchResponse struct {
+	Results    []SearchResult `json:"results"`
+	TotalFound int            `json:"total_found"`
+}
+
+// AnswerRequest asks a question about the catalog, answered from the top
+// hybrid search results for it
+type AnswerRequest struct {
+	Question string `json:"question" binding:"required,max=1000"`
+	// TopK is how many search results ground the answer, defaulting to
+	// ANSWER_TOP_K
+	TopK *int `json:"top_k,omitempty" binding:"omitempty,min=1,max=50"`
+	// Filter, MinPrice, MaxPrice and CatalogID narrow the search like
+	// SearchRequest's
+	Filter    string   `json:"filter,omitempty"`
+	MinPrice  *float64 `json:"min_price,omitempty"`
+	MaxPrice  *float64 `json:"max_price,omitempty"`
+	CatalogID string   `json:"catalog_id,omitempty"`
+	UserID    string   `json:"user_id,omitempty" binding:"omitempty,max=128"`
+	SessionID string   `json:"session_id,omitempty" binding:"omitempty,max=128"`
+	// Currency and Locale localize prices like SearchRequest's. The
+	// answer is written in the language of the question.
+	Currency string `json:"currency,omitempty" binding:"omitempty,len=3"`
+	Locale   string `json:"locale,omitempty"`
+}
+
+// AnswerResponse is a generated answer and the search results it was
+// grounded in
+type AnswerResponse struct {
+	// Answer cites the products it mentions by ID in square brackets,
+	// e.g. "The Alpine Shell [P123] is waterproof"
+	Answer string `json:"answer"`
+	// Citations are the IDs of the results the answer cites, in order of
+	// first mention
+	Citations []string       `json:"citations"`
+	Results   []SearchResult `json:"results"`
+}
+
+// SearchDebug carries diagnostics for debug requests
+type SearchDebug struct {
+	StageTimingsMs  map[string]float64 `json:"stage_timings_ms"`
+	Cost            *CostEstimate      `json:"cost"`
+	QueryExpansions []string           `json:"query_expansions,omitempty"`
+	// SubQueries are the phrases a long query was split into
+	SubQueries []string `json:"sub_queries,omitempty"`
+	// Scores explains each result's fused score, in result order
+	Scores []ResultScores `json:"scores,omitempty"`
+	// ScoringProfile is the category of the scoring profile applied, if any
+	ScoringProfile string `json:"scoring_profile,omitempty"`
+	// Rules traces the merchandising rules that matched the search
+	Rules []RuleTrace `json:"rules,omitempty"`
+	// SQL is the search statement that ran, with parameter values redacted
+	SQL *SQLStatement `json:"sql,omitempty"`
+	// FeatureFlags are the states of the feature flags the search ran with
+	FeatureFlags map[string]bool `json:"feature_flags,omitempty"`
+}
+
+// SQLStatement is an executed statement. Params maps each parameter name
+// to the type of its value; the values themselves are redacted.
+type SQLStatement struct {
+	SQL    string            `json:"sql"`
+	Params map[string]string `json:"params"`
+}
+
+// ResultScores breaks a result's fused score down into the rank and raw
+// score it had in each retrieval branch. Branch fields are absent when the
+// branch did not retrieve the product.
+type ResultScores struct {
+	ProductID string  `json:"product_id"`
+	Fused     float64 `json:"fused"`
+	// ANNRank and ANNDistance are the best across the query and expansions
+	ANNRank     *int64   `json:"ann_rank,omitempty"`
+	ANNDistance *float64 `json:"ann_distance,omitempty"`
+	FTSRank     *int64   `json:"fts_rank,omitempty"`
+	FTSScore    *float64 `json:"fts_score,omitempty"`
+	// ANNContribution and FTSContribution are each side's share of the
+	// reciprocal rank fusion score, before boosts apply
+	ANNContribution *float64 `json:"ann_contribution,omitempty"`
+	FTSContribution *float64 `json:"fts_contribution,omitempty"`
+	// Boosts are the adjustments applied to the result after fusion
+	Boosts []AppliedBoost `json:"boosts,omitempty"`
+	// FilterMatches are the filter conditions the product satisfied
+	FilterMatches []string `json:"filter_matches,omitempty"`
+}
+
+// AppliedBoost is an adjustment made to a result after fusion: a quality
+// demotion or request boost, which scales the fused score by Factor, or a
+// merchandising rule that boosted, buried or pinned it. Request boosts
+// also name the Field and Value they matched.
+type AppliedBoost struct {
+	Type     BoostType `json:"type"`
+	RuleID   string    `json:"rule_id,omitempty"`
+	Factor   float64   `json:"factor,omitempty"`
+	Position int       `json:"position,omitempty"`
+	Field    string    `json:"field,omitempty"`
+	Value    string    `json:"value,omitempty"`
+}
+
+// BoostType identifies the kind of adjustment an AppliedBoost made
+type BoostType string
+
+const (
+	BoostQualityDemotion BoostType = "quality_demotion"
+	BoostPopularity      BoostType = "popularity"
+	BoostRuleBoost       BoostType = "boost"
+	BoostRuleBury        BoostType = "bury"
+	BoostRulePin         BoostType = "pin"
+	BoostQuery           BoostType = "query_boost"
+	BoostLocal           BoostType = "local_availability"
+)
+
+// CostEstimate lists the downstream cost drivers of a single request, for
+// modelling the cost of relevance changes
+type CostEstimate struct {
+	EmbeddingCalls      int    `json:"embedding_calls"`
+	EmbeddingTokens     int    `json:"embedding_tokens"`
+	LLMCalls            int    `json:"llm_calls"`
+	RerankRecords       int    `json:"rerank_records"`
+	SpannerQueries      int    `json:"spanner_queries"`
+	SpannerRowsScanned  int64  `json:"spanner_rows_scanned"`
+	SpannerRowsReturned int64  `json:"spanner_rows_returned"`
+	SpannerCPUTime      string `json:"spanner_cpu_time,omitempty"`
+	RetrievalBranches   int    `json:"retrieval_branches"`
+	// CandidatesRequested is the candidate limit summed over branches
+	CandidatesRequested int `json:"candidates_requested"`
 }
 
 // SearchResult represents a single product search result
@@ -35,6 +744,7 @@ type SearchResult struct {
 	ID               string        `json:"id"`
 	Name             string        `json:"name"`
 	Title            string        `json:"title"`
+	Description      string        `json:"description,omitempty"`
 	Brands           []string      `json:"brands"`
 	Categories       []string      `json:"categories"`
 	PriceInfo        PriceInfo     `json:"priceInfo"`
@@ -47,7 +757,32 @@ type SearchResult struct {
 	RetrievableFields string       `json:"retrievableFields"`
 	Attributes       []Attribute   `json:"attributes"`
 	URI              string        `json:"uri"`
+	GTIN             string        `json:"gtin,omitempty"`
 	Score            map[string]float64 `json:"score"`
+	// LocalAvailability is the nearest store the product is in stock at,
+	// for searches by location or store
+	LocalAvailability *LocalAvailability `json:"localAvailability,omitempty"`
+	// Localizations holds the product's translated text keyed by lower-case
+	// locale, e.g. "de-de". The API swaps in the variant for the request's
+	// locale and never returns them.
+	Localizations map[string]LocalizedText `json:"localizations,omitempty"`
+}
+
+// LocalAvailability is a store a product can be picked up from
+type LocalAvailability struct {
+	StoreID   string `json:"storeId"`
+	StoreName string `json:"storeName,omitempty"`
+	Quantity  int64  `json:"quantity"`
+	// DistanceKm is the store's distance from the shopper, when the search
+	// gave their location
+	DistanceKm *float64 `json:"distanceKm,omitempty"`
+}
+
+// LocalizedText is a product's title and description in one locale. Empty
+// fields fall back to the product's own.
+type LocalizedText struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
 }
 
 // Image represents a product image
@@ -65,6 +800,11 @@ type PriceInfo struct {
 	Price            string `json:"price"`
 	PriceEffectiveTime string `json:"priceEffectiveTime"`
 	PriceExpireTime  string `json:"priceExpireTime"`
+	// FormattedPrice and FormattedOriginalPrice are the prices written for
+	// the requested locale, e.g. "1.234,50 €". They are only set when the
+	// request names a currency or locale.
+	FormattedPrice         string `json:"formattedPrice,omitempty"`
+	FormattedOriginalPrice string `json:"formattedOriginalPrice,omitempty"`
 }
 
 // ColorInfo represents product color information
@@ -87,7 +827,586 @@ type Attribute struct {
 	Value AttributeValue `json:"value"`
 }
 
+// Batch item and summary statuses
+const (
+	BatchItemStatusOK       = "OK"
+	BatchItemStatusNotFound = "NOT_FOUND"
+	BatchItemStatusError    = "ERROR"
+
+	BatchStatusOK      = "OK"
+	BatchStatusPartial = "PARTIAL"
+	BatchStatusFailed  = "FAILED"
+)
+
+// BatchItemError describes why a single batch item failed and whether the
+// caller should retry it
+type BatchItemError struct {
+	Code              int    `json:"code"`
+	Message           string `json:"message"`
+	Retryable         bool   `json:"retryable"`
+	RetryAfterSeconds *int   `json:"retry_after_seconds,omitempty"`
+}
+
+// BatchSummary reports the overall outcome of a batch call
+type BatchSummary struct {
+	Status    string `json:"status"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	// RetryableIndexes lists the items worth resubmitting
+	RetryableIndexes []int `json:"retryable_indexes,omitempty"`
+}
+
+// BatchSearchRequest represents several independent search requests
+type BatchSearchRequest struct {
+	Requests []SearchRequest `json:"requests" binding:"required,min=1,dive"`
+}
+
+// BatchSearchItem is the outcome of one search within a batch
+type BatchSearchItem struct {
+	Index    int             `json:"index"`
+	Status   string          `json:"status"`
+	Response *SearchResponse `json:"response,omitempty"`
+	Error    *BatchItemError `json:"error,omitempty"`
+}
+
+// BatchSearchResponse represents the response to a batch search
+type BatchSearchResponse struct {
+	Results []BatchSearchItem `json:"results"`
+	Summary BatchSummary      `json:"summary"`
+}
+
+// BatchGetRequest represents a request for several products by ID
+type BatchGetRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1"`
+	// StalenessSeconds overrides SPANNER_STALENESS_SECONDS; 0 forces a strong read
+	StalenessSeconds *float64 `json:"staleness_seconds,omitempty"`
+	// CatalogID restricts the lookup to one catalog in multi-catalog
+	// deployments; products of other catalogs are reported as not found
+	CatalogID string `json:"catalog_id,omitempty"`
+	// Fields limits each product to these fields, like SearchRequest.Fields
+	Fields []string `json:"fields,omitempty"`
+	// Currency and Locale localize prices like SearchRequest's
+	Currency string `json:"currency,omitempty" binding:"omitempty,len=3"`
+	Locale   string `json:"locale,omitempty"`
+}
+
+// BatchGetResponse represents the response to a batch get
+type BatchGetResponse struct {
+	// Products holds the products found, keyed by ID, limited to the
+	// requested fields
+	Products map[string]interface{} `json:"products"`
+	// Missing lists the requested IDs that do not exist, in request order
+	Missing []string `json:"missing"`
+	// Errors holds the products that exist but could not be read, by ID
+	Errors map[string]*BatchItemError `json:"errors,omitempty"`
+}
+
+// SavedSearchRequest represents a request to register a saved search
+type SavedSearchRequest struct {
+	Name        string `json:"name"`
+	Query       string `json:"query" binding:"required"`
+	Filter      string `json:"filter,omitempty"`
+	WebhookURL  string `json:"webhook_url,omitempty" binding:"omitempty,https_url"`
+	PubSubTopic string `json:"pubsub_topic,omitempty"`
+	// CatalogID is the catalog whose new products are matched
+	CatalogID string `json:"catalog_id,omitempty"`
+	// UserID is the caller the saved search belongs to, set from the
+	// authenticated principal rather than the request body
+	UserID string `json:"-"`
+}
+
+// SavedSearch represents a stored saved search
+type SavedSearch struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Query       string    `json:"query"`
+	Filter      string    `json:"filter,omitempty"`
+	WebhookURL  string    `json:"webhook_url,omitempty"`
+	PubSubTopic string    `json:"pubsub_topic,omitempty"`
+	CatalogID   string    `json:"catalog_id,omitempty"`
+	UserID      string    `json:"user_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// LastEvaluatedAt is when the scheduled evaluation last re-ran the
+	// search
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+}
+
+// SavedSearchListResponse represents the list of saved searches
+type SavedSearchListResponse struct {
+	SavedSearches []SavedSearch `json:"saved_searches"`
+}
+
+// QueryTemplateParameter declares a parameter referenced as {{name}} in a
+// query template's query or filter
+type QueryTemplateParameter struct {
+	Name     string `json:"name" binding:"required"`
+	Type     string `json:"type" binding:"required,oneof=string number"`
+	Required bool   `json:"required,omitempty"`
+	// Default is used when an optional parameter is omitted
+	Default interface{} `json:"default,omitempty"`
+}
+
+// QueryTemplateRequest represents a request to create or replace a query
+// template
+type QueryTemplateRequest struct {
+	Description string `json:"description,omitempty"`
+	// Search is the templated search; its query and filter may contain
+	// {{name}} placeholders
+	Search     SearchRequest            `json:"search" binding:"required"`
+	Parameters []QueryTemplateParameter `json:"parameters,omitempty" binding:"dive"`
+}
+
+// QueryTemplate represents a stored, named search that callers run by ID
+type QueryTemplate struct {
+	ID          string                   `json:"id"`
+	Description string                   `json:"description,omitempty"`
+	Search      SearchRequest            `json:"search"`
+	Parameters  []QueryTemplateParameter `json:"parameters,omitempty"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+}
+
+// QueryTemplateListResponse represents the list of query templates
+type QueryTemplateListResponse struct {
+	Templates []QueryTemplate `json:"templates"`
+}
+
+// QueryTemplateSearchRequest runs a query template with parameter values.
+// Paging fields override the template's.
+type QueryTemplateSearchRequest struct {
+	Params           map[string]interface{} `json:"params,omitempty"`
+	Limit            *int                   `json:"limit,omitempty"`
+	Offset           *int                   `json:"offset,omitempty"`
+	ConsistencyToken string                 `json:"consistency_token,omitempty"`
+	CatalogID        string                 `json:"catalog_id,omitempty"`
+}
+
+// ScoringProfile holds the fusion defaults for searches in a category and
+// its subcategories
+type ScoringProfile struct {
+	Category  string     `json:"category"`
+	Alpha     *float64   `json:"alpha,omitempty"`
+	MinScore  *float64   `json:"min_score,omitempty"`
+	Mode      SearchMode `json:"mode,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ScoringProfileRequest creates or replaces a scoring profile. Unset fields
+// keep the server defaults.
+type ScoringProfileRequest struct {
+	Alpha    *float64   `json:"alpha,omitempty" binding:"omitempty,min=0,max=1"`
+	MinScore *float64   `json:"min_score,omitempty"`
+	Mode     SearchMode `json:"mode,omitempty" binding:"omitempty,oneof=hybrid vector keyword"`
+}
+
+// ScoringProfileListResponse lists the scoring profiles
+type ScoringProfileListResponse struct {
+	Profiles []ScoringProfile `json:"profiles"`
+}
+
+// RuntimeConfig holds the tunable parameters that can be changed without a
+// redeploy. As overrides, unset fields keep the value from the environment.
+type RuntimeConfig struct {
+	DefaultAlpha   *float64 `json:"default_alpha,omitempty" binding:"omitempty,min=0,max=1"`
+	MinScore       *float64 `json:"min_score,omitempty"`
+	RRFK           *int     `json:"rrf_k,omitempty" binding:"omitempty,min=1"`
+	DefaultLimit   *int     `json:"default_limit,omitempty" binding:"omitempty,min=1"`
+	MaxResultLimit *int     `json:"max_result_limit,omitempty" binding:"omitempty,min=1"`
+	MaxQueryLength *int     `json:"max_query_length,omitempty" binding:"omitempty,min=1"`
+	// MaxFilterConditions counts ranges and price bounds too
+	MaxFilterConditions *int `json:"max_filter_conditions,omitempty" binding:"omitempty,min=1"`
+	// Cache TTLs apply to entries stored after the change
+	ResultCacheTTLSeconds     *float64 `json:"result_cache_ttl_seconds,omitempty" binding:"omitempty,gt=0"`
+	ResultCacheSoftTTLSeconds *float64 `json:"result_cache_soft_ttl_seconds,omitempty" binding:"omitempty,gt=0"`
+	EmbeddingCacheTTLSeconds  *float64 `json:"embedding_cache_ttl_seconds,omitempty" binding:"omitempty,gt=0"`
+
+	SKUDetectionEnabled      *bool `json:"sku_detection_enabled,omitempty"`
+	MultiQueryEnabled        *bool `json:"multi_query_enabled,omitempty"`
+	DedupeResultsEnabled     *bool `json:"dedupe_results_enabled,omitempty"`
+	LanguageDetectionEnabled *bool `json:"language_detection_enabled,omitempty"`
+	// FeatureFlags sets the state of the flags it names
+	FeatureFlags map[string]bool `json:"feature_flags,omitempty"`
+}
+
+// RuntimeConfigOptions holds the query parameters of a runtime config
+// update
+type RuntimeConfigOptions struct {
+	// Persist stores the overrides in Spanner, applying them to every
+	// instance and across restarts
+	Persist bool `form:"persist"`
+}
+
+// RuntimeConfigResponse reports the tunable parameters in effect and the
+// overrides applied on top of the environment to get them
+type RuntimeConfigResponse struct {
+	Effective RuntimeConfig `json:"effective"`
+	Overrides RuntimeConfig `json:"overrides"`
+	// UpdatedAt is when the overrides were last changed; absent when there
+	// have been none since startup
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Persisted reports whether the overrides are the ones stored in
+	// Spanner, which every instance loads and which survive restarts
+	Persisted bool `json:"persisted"`
+}
+
+// ExperimentArm is one ranking configuration of an experiment. Unset
+// fields keep what the request, scoring profile or server default chose.
+type ExperimentArm struct {
+	Name string `json:"name" binding:"required,max=64"`
+	// Weight is the arm's share of the experiment's traffic relative to
+	// the other arms
+	Weight int      `json:"weight" binding:"min=1,max=1000"`
+	Alpha  *float64 `json:"alpha,omitempty" binding:"omitempty,min=0,max=1"`
+	Rerank *bool    `json:"rerank,omitempty"`
+	// RRFK is the reciprocal rank fusion constant, overriding RRF_K
+	RRFK *int `json:"rrf_k,omitempty" binding:"omitempty,min=1,max=1000"`
+	// EmbeddingVersion names the embedding model version the arm's vector
+	// searches use, for comparing a new model against the serving one
+	EmbeddingVersion *string `json:"embedding_version,omitempty" binding:"omitempty,max=32"`
+}
+
+// ExperimentRequest creates or replaces an experiment
+type ExperimentRequest struct {
+	Description string `json:"description,omitempty"`
+	// Enabled experiments assign searches to their arms
+	Enabled bool            `json:"enabled"`
+	Arms    []ExperimentArm `json:"arms" binding:"required,min=2,max=10,dive"`
+}
+
+// Experiment splits searches between ranking configurations to compare
+// their relevance
+type Experiment struct {
+	ID          string          `json:"id"`
+	Description string          `json:"description,omitempty"`
+	Enabled     bool            `json:"enabled"`
+	Arms        []ExperimentArm `json:"arms"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ExperimentListResponse lists the experiments
+type ExperimentListResponse struct {
+	Experiments []Experiment `json:"experiments"`
+}
+
+// ExperimentAssignment identifies the experiment arm a request was
+// assigned to
+type ExperimentAssignment struct {
+	ID  string `json:"id" binding:"required,max=64"`
+	Arm string `json:"arm" binding:"required,max=64"`
+}
+
+// ExperimentArmResults counts the search events attributed to an arm
+type ExperimentArmResults struct {
+	Arm         string `json:"arm"`
+	Impressions int64  `json:"impressions"`
+	Clicks      int64  `json:"clicks"`
+	AddToCarts  int64  `json:"add_to_carts"`
+	Purchases   int64  `json:"purchases"`
+	// ClickThroughRate is clicks per impression; zero without impressions
+	ClickThroughRate float64 `json:"click_through_rate"`
+	// ConversionRate is purchases per click; zero without clicks
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// ExperimentResults reports an experiment's arm-level event counts
+type ExperimentResults struct {
+	ID string `json:"id"`
+	// Since is the start of the counted period; unset counts every event
+	Since *time.Time             `json:"since,omitempty"`
+	Arms  []ExperimentArmResults `json:"arms"`
+}
+
+// ExperimentResultsOptions holds the query parameters of an experiment
+// results request
+type ExperimentResultsOptions struct {
+	// Days only counts events of the last days; 0 counts every event
+	Days int `form:"days" binding:"omitempty,min=1,max=365"`
+}
+
+// RulePin places a product at a fixed position of the first result page
+type RulePin struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Position  int    `json:"position" binding:"min=1,max=3"`
+}
+
+// MerchandisingRuleRequest represents a request to create or replace a
+// merchandising rule. A rule needs a query pattern, a category or both;
+// when both are set, both must match.
+type MerchandisingRuleRequest struct {
+	Name string `json:"name,omitempty"`
+	// QueryPattern is a case-insensitive regular expression matched
+	// against the query
+	QueryPattern string `json:"query_pattern,omitempty"`
+	// Category matches searches in the category or its subcategories
+	Category        string    `json:"category,omitempty"`
+	BoostProductIDs []string  `json:"boost_product_ids,omitempty"`
+	BuryProductIDs  []string  `json:"bury_product_ids,omitempty"`
+	Pins            []RulePin `json:"pins,omitempty" binding:"dive"`
+}
+
+// MerchandisingRule is a stored rule that reorders search results after
+// fusion
+type MerchandisingRule struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name,omitempty"`
+	QueryPattern    string    `json:"query_pattern,omitempty"`
+	Category        string    `json:"category,omitempty"`
+	BoostProductIDs []string  `json:"boost_product_ids,omitempty"`
+	BuryProductIDs  []string  `json:"bury_product_ids,omitempty"`
+	Pins            []RulePin `json:"pins,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// MerchandisingRuleListResponse lists the merchandising rules
+type MerchandisingRuleListResponse struct {
+	Rules []MerchandisingRule `json:"rules"`
+}
+
+// RuleTrace reports what a matched merchandising rule did to a search.
+// Product lists only hold the products the rule actually moved.
+type RuleTrace struct {
+	RuleID  string    `json:"rule_id"`
+	Name    string    `json:"name,omitempty"`
+	Boosted []string  `json:"boosted,omitempty"`
+	Buried  []string  `json:"buried,omitempty"`
+	Pinned  []RulePin `json:"pinned,omitempty"`
+}
+
+// SearchEventType is the kind of shopper interaction a search event reports
+type SearchEventType string
+
+const (
+	SearchEventImpression SearchEventType = "impression"
+	SearchEventClick      SearchEventType = "click"
+	SearchEventAddToCart  SearchEventType = "add_to_cart"
+	SearchEventPurchase   SearchEventType = "purchase"
+)
+
+// SearchEvent reports a shopper's interaction with a search result, for
+// popularity signals and relevance evaluation
+type SearchEvent struct {
+	Type      SearchEventType `json:"type" binding:"required,oneof=impression click add_to_cart purchase"`
+	Query     string          `json:"query,omitempty"`
+	ProductID string          `json:"product_id" binding:"required"`
+	// Position is the 1-based position the product was shown at
+	Position  *int   `json:"position,omitempty" binding:"omitempty,min=1"`
+	SessionID string `json:"session_id,omitempty"`
+	// UserID also attributes clicks to the user's personalization profile
+	UserID    string `json:"user_id,omitempty" binding:"omitempty,max=128"`
+	CatalogID string `json:"catalog_id,omitempty"`
+	// Experiment is the arm of the search response that led to the event.
+	// Events without one are assigned by user_id or session_id.
+	Experiment *ExperimentAssignment `json:"experiment,omitempty"`
+	// OccurredAt is when the interaction happened, defaulting to when the
+	// event was received
+	OccurredAt *time.Time `json:"occurred_at,omitempty"`
+}
+
+// SearchEventsRequest carries a batch of search events
+type SearchEventsRequest struct {
+	Events []SearchEvent `json:"events" binding:"required,min=1,dive"`
+}
+
+// SearchEventsResponse reports how many events were recorded
+type SearchEventsResponse struct {
+	Accepted int `json:"accepted"`
+}
+
+// UserClickRequest records a user's click on a search result
+type UserClickRequest struct {
+	ProductID string `json:"product_id" binding:"required"`
+}
+
+// ConfigBundleVersion is the format version of exported configuration
+// bundles. It changes when a bundle from an older release can no longer be
+// imported as is.
+const ConfigBundleVersion = 1
+
+// ConfigBundle holds all admin-managed relevance configuration, for
+// promoting it from one environment to another
+type ConfigBundle struct {
+	Version            int                 `json:"version"`
+	ExportedAt         time.Time           `json:"exported_at"`
+	QueryTemplates     []QueryTemplate     `json:"query_templates"`
+	ScoringProfiles    []ScoringProfile    `json:"scoring_profiles"`
+	MerchandisingRules []MerchandisingRule `json:"merchandising_rules"`
+}
+
+// ConfigImportOptions holds the query parameters of a bundle import
+type ConfigImportOptions struct {
+	// Prune deletes stored entries that the bundle does not contain
+	Prune bool `form:"prune"`
+	// DryRun validates the bundle without writing it
+	DryRun bool `form:"dry_run"`
+}
+
+// ConfigImportResult reports what importing a bundle changed, or would
+// change for a dry run
+type ConfigImportResult struct {
+	DryRun             bool `json:"dry_run"`
+	QueryTemplates     int  `json:"query_templates"`
+	ScoringProfiles    int  `json:"scoring_profiles"`
+	MerchandisingRules int  `json:"merchandising_rules"`
+	// Pruned counts existing entries deleted because the bundle lacks them
+	Pruned int `json:"pruned"`
+}
+
+// CatalogVersion identifies the current contents of a catalog. Bumping it
+// invalidates the catalog's cached search results.
+type CatalogVersion struct {
+	CatalogID string    `json:"catalog_id"`
+	Version   string    `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CatalogVersionRequest records a new catalog version, e.g. after an import
+// or branch switch. CatalogID is empty in single-catalog deployments.
+type CatalogVersionRequest struct {
+	CatalogID string `json:"catalog_id"`
+	Version   string `json:"version" binding:"required"`
+}
+
+// CatalogVersionListResponse lists the catalog versions
+type CatalogVersionListResponse struct {
+	Versions []CatalogVersion `json:"versions"`
+}
+
+// ReembedRequest starts a job re-embedding the catalog into a shadow
+// embedding column. Unset fields default to the REEMBED_* settings, or for
+// image jobs to the IMAGE_EMBEDDING_* settings.
+type ReembedRequest struct {
+	// Source is text, the default, to embed product text, or image to
+	// embed each product's first image into image_embedding for image
+	// search
+	Source    string `json:"source,omitempty" binding:"omitempty,oneof=text image"`
+	Model     string `json:"model,omitempty"`
+	Dimension int    `json:"dimension,omitempty" binding:"omitempty,min=1,max=3072"`
+	Column    string `json:"column,omitempty"`
+	// RatePerSecond caps the Vertex AI calls the job makes
+	RatePerSecond float64 `json:"rate_per_second,omitempty" binding:"omitempty,gt=0"`
+	// Overwrite re-embeds products whose shadow column is already set,
+	// instead of resuming where an earlier job stopped
+	Overwrite bool `json:"overwrite,omitempty"`
+}
+
+// ReembedJob reports the progress of a re-embedding job. Status is
+// running, cancelling, completed, cancelled, failed, or interrupted for a
+// job whose instance stopped reporting progress.
+type ReembedJob struct {
+	ID        string `json:"id"`
+	Source    string `json:"source"`
+	Model     string `json:"model"`
+	Dimension int    `json:"dimension"`
+	Column    string `json:"column"`
+	Status    string `json:"status"`
+	// Total is the number of products the job set out to embed
+	Total     int64 `json:"total"`
+	Processed int64 `json:"processed"`
+	// Skipped counts products without text or an image to embed, or
+	// deleted during the job
+	Skipped    int64      `json:"skipped"`
+	Failed     int64      `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ReembedJobListResponse lists re-embedding jobs, newest first
+type ReembedJobListResponse struct {
+	Jobs []ReembedJob `json:"jobs"`
+}
+
+// IngestedProductsRequest lists products written by the ingestion stream
+type IngestedProductsRequest struct {
+	ProductIDs []string `json:"product_ids"`
+	// CatalogID is the catalog the products were written to
+	CatalogID string `json:"catalog_id,omitempty"`
+}
+
+// EvaluateSavedSearchesResponse reports how many notifications were sent
+type EvaluateSavedSearchesResponse struct {
+	Evaluated     int `json:"evaluated"`
+	Notifications int `json:"notifications"`
+}
+
+// DetectProductChangesResponse reports the change events emitted for
+// ingested products
+type DetectProductChangesResponse struct {
+	Checked int `json:"checked"`
+	Events  int `json:"events"`
+}
+
+// CacheInvalidationRequest selects cache entries to remove
+type CacheInvalidationRequest struct {
+	// Layers restricts invalidation to the named caches; empty means all
+	Layers []string `json:"layers,omitempty"`
+	// KeyPattern is a glob matched against cache keys
+	KeyPattern string `json:"key_pattern,omitempty"`
+	Query      string `json:"query,omitempty"`
+	ProductID  string `json:"product_id,omitempty"`
+	All        bool   `json:"all,omitempty"`
+}
+
+// CacheInvalidationResponse reports how many entries each cache removed
+type CacheInvalidationResponse struct {
+	Invalidated map[string]int `json:"invalidated"`
+	Total       int            `json:"total"`
+}
+
+// ScoreQualityResponse reports the quality scoring of ingested products
+type ScoreQualityResponse struct {
+	Scored     int `json:"scored"`
+	LowQuality int `json:"low_quality"`
+}
+
+// DataQualityReport aggregates product quality scores across the catalog
+type DataQualityReport struct {
+	ScoredProducts int64 `json:"scored_products"`
+	// UnscoredProducts have not been through ingestion scoring yet
+	UnscoredProducts  int64   `json:"unscored_products"`
+	AverageScore      float64 `json:"average_score"`
+	LowScoreThreshold float64 `json:"low_score_threshold"`
+	LowQuality        int64   `json:"low_quality"`
+	// Issues counts the products affected by each issue
+	Issues              map[string]int64 `json:"issues"`
+	LowQualitySampleIDs []string         `json:"low_quality_sample_ids,omitempty"`
+}
+
+// CurrencyReport lists products whose currency disagrees with the catalog
+type CurrencyReport struct {
+	CatalogCurrency string `json:"catalog_currency"`
+	TotalProducts   int64  `json:"total_products"`
+	// Mismatched counts products stored in another currency
+	Mismatched int64 `json:"mismatched"`
+	// ByCurrency breaks Mismatched down by stored currency
+	ByCurrency          map[string]int64 `json:"by_currency"`
+	MismatchedSampleIDs []string         `json:"mismatched_sample_ids,omitempty"`
+	// MissingCurrency counts products served with the catalog currency
+	// because they store none
+	MissingCurrency  int64    `json:"missing_currency"`
+	MissingSampleIDs []string `json:"missing_sample_ids,omitempty"`
+}
+
 // HealthResponse represents the response from the health check endpoint
 type HealthResponse struct {
 	Status string `json:"status"`
 }
+
+// ReadinessResponse reports whether the instance can serve traffic and the
+// status of each dependency checked
+type ReadinessResponse struct {
+	// Status is ready when every dependency check passed, else not_ready
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// DependencyStatus is the outcome of one dependency check
+type DependencyStatus struct {
+	Name string `json:"name"`
+	// Status is ok or error
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	// LastSuccess is when the check last passed on this instance, if ever
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
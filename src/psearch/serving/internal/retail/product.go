@@ -0,0 +1,513 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package retail converts between product_data, the JSON the products
+// table stores, and the Product resource of the Retail API (Vertex AI
+// Search for commerce) in its proto3 JSON form, so catalogs can move
+// between this service and Retail in either direction.
+//
+// product_data follows the Retail BigQuery export: attributes are a list
+// of key/value pairs, and prices, image dimensions and attribute flags are
+// strings. The Retail API keys attributes by name and types those fields
+// as numbers and booleans. Fields of product_data with no Retail
+// counterpart, such as localizations, are not exported.
+package retail
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidProduct is returned for products that cannot be converted,
+// such as ones without a title or with an unparseable price
+var ErrInvalidProduct = errors.New("invalid product")
+
+// Product is a Retail API Product in proto3 JSON
+type Product struct {
+	Name                string                     `json:"name,omitempty"`
+	ID                  string                     `json:"id"`
+	Type                string                     `json:"type,omitempty"`
+	PrimaryProductID    string                     `json:"primaryProductId,omitempty"`
+	CollectionMemberIDs []string                   `json:"collectionMemberIds,omitempty"`
+	GTIN                string                     `json:"gtin,omitempty"`
+	Categories          []string                   `json:"categories,omitempty"`
+	Title               string                     `json:"title"`
+	Brands              []string                   `json:"brands,omitempty"`
+	Description         string                     `json:"description,omitempty"`
+	LanguageCode        string                     `json:"languageCode,omitempty"`
+	Attributes          map[string]CustomAttribute `json:"attributes,omitempty"`
+	Tags                []string                   `json:"tags,omitempty"`
+	PriceInfo           *PriceInfo                 `json:"priceInfo,omitempty"`
+	Rating              *Rating                    `json:"rating,omitempty"`
+	AvailableTime       string                     `json:"availableTime,omitempty"`
+	Availability        string                     `json:"availability,omitempty"`
+	AvailableQuantity   *int32                     `json:"availableQuantity,omitempty"`
+	URI                 string                     `json:"uri,omitempty"`
+	Images              []Image                    `json:"images,omitempty"`
+	Audience            *Audience                  `json:"audience,omitempty"`
+	ColorInfo           *ColorInfo                 `json:"colorInfo,omitempty"`
+	Sizes               []string                   `json:"sizes,omitempty"`
+	Materials           []string                   `json:"materials,omitempty"`
+	Patterns            []string                   `json:"patterns,omitempty"`
+	Conditions          []string                   `json:"conditions,omitempty"`
+	PublishTime         string                     `json:"publishTime,omitempty"`
+}
+
+// CustomAttribute is a Retail custom attribute; it holds either text or
+// numbers
+type CustomAttribute struct {
+	Text       []string  `json:"text,omitempty"`
+	Numbers    []float64 `json:"numbers,omitempty"`
+	Searchable *bool     `json:"searchable,omitempty"`
+	Indexable  *bool     `json:"indexable,omitempty"`
+}
+
+// PriceInfo is a Retail product's pricing
+type PriceInfo struct {
+	CurrencyCode       string   `json:"currencyCode,omitempty"`
+	Price              float64  `json:"price"`
+	OriginalPrice      *float64 `json:"originalPrice,omitempty"`
+	Cost               *float64 `json:"cost,omitempty"`
+	PriceEffectiveTime string   `json:"priceEffectiveTime,omitempty"`
+	PriceExpireTime    string   `json:"priceExpireTime,omitempty"`
+}
+
+// Rating is a Retail product's rating summary
+type Rating struct {
+	RatingCount     int32   `json:"ratingCount,omitempty"`
+	AverageRating   float64 `json:"averageRating,omitempty"`
+	RatingHistogram []int32 `json:"ratingHistogram,omitempty"`
+}
+
+// Image is a Retail product image
+type Image struct {
+	URI    string `json:"uri"`
+	Height int32  `json:"height,omitempty"`
+	Width  int32  `json:"width,omitempty"`
+}
+
+// Audience is the Retail product audience
+type Audience struct {
+	Genders   []string `json:"genders,omitempty"`
+	AgeGroups []string `json:"ageGroups,omitempty"`
+}
+
+// ColorInfo is a Retail product's colors
+type ColorInfo struct {
+	ColorFamilies []string `json:"colorFamilies,omitempty"`
+	Colors        []string `json:"colors,omitempty"`
+}
+
+// availabilities are the values of the Retail Availability enum besides
+// AVAILABILITY_UNSPECIFIED
+var availabilities = []string{"IN_STOCK", "OUT_OF_STOCK", "PREORDER", "BACKORDER"}
+
+// ToProduct converts a product's product_data to a Retail Product
+func ToProduct(productID string, productData map[string]interface{}) (*Product, error) {
+	p := &Product{
+		Name:                stringField(productData, "name"),
+		ID:                  productID,
+		Type:                stringField(productData, "type"),
+		PrimaryProductID:    stringField(productData, "primaryProductId"),
+		CollectionMemberIDs: stringList(productData, "collectionMemberIds"),
+		GTIN:                stringField(productData, "gtin"),
+		Categories:          stringList(productData, "categories"),
+		Title:               stringField(productData, "title"),
+		Brands:              stringList(productData, "brands"),
+		Description:         stringField(productData, "description"),
+		LanguageCode:        stringField(productData, "languageCode"),
+		Tags:                stringList(productData, "tags"),
+		AvailableTime:       stringField(productData, "availableTime"),
+		URI:                 stringField(productData, "uri"),
+		Sizes:               stringList(productData, "sizes"),
+		Materials:           stringList(productData, "materials"),
+		Patterns:            stringList(productData, "patterns"),
+		Conditions:          stringList(productData, "conditions"),
+		PublishTime:         stringField(productData, "publishTime"),
+	}
+	if p.Title == "" {
+		return nil, fmt.Errorf("%w: product %s has no title", ErrInvalidProduct, productID)
+	}
+
+	if availability := strings.ToUpper(stringField(productData, "availability")); availability != "" {
+		if !slices.Contains(availabilities, availability) {
+			return nil, fmt.Errorf("%w: product %s has unknown availability %q", ErrInvalidProduct, productID, availability)
+		}
+		p.Availability = availability
+	}
+	if quantity, ok, err := numberField(productData, "availableQuantity"); err != nil {
+		return nil, fmt.Errorf("%w: product %s: %v", ErrInvalidProduct, productID, err)
+	} else if ok {
+		p.AvailableQuantity = ptr(int32(quantity))
+	}
+
+	if data, ok := productData["priceInfo"].(map[string]interface{}); ok {
+		priceInfo, err := toPriceInfo(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: product %s: %v", ErrInvalidProduct, productID, err)
+		}
+		p.PriceInfo = priceInfo
+	}
+
+	if data, ok := productData["rating"].(map[string]interface{}); ok {
+		count, _, err := numberField(data, "ratingCount")
+		if err != nil {
+			return nil, fmt.Errorf("%w: product %s: %v", ErrInvalidProduct, productID, err)
+		}
+		average, _, err := numberField(data, "averageRating")
+		if err != nil {
+			return nil, fmt.Errorf("%w: product %s: %v", ErrInvalidProduct, productID, err)
+		}
+		p.Rating = &Rating{RatingCount: int32(count), AverageRating: average}
+		if histogram, ok := data["ratingHistogram"].([]interface{}); ok {
+			for _, bucket := range histogram {
+				n, err := number(bucket)
+				if err != nil {
+					return nil, fmt.Errorf("%w: product %s: ratingHistogram: %v", ErrInvalidProduct, productID, err)
+				}
+				p.Rating.RatingHistogram = append(p.Rating.RatingHistogram, int32(n))
+			}
+		}
+	}
+
+	if images, ok := productData["images"].([]interface{}); ok {
+		for _, image := range images {
+			data, ok := image.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// Unparseable dimensions are dropped rather than failing the
+			// product, since Retail treats them as optional hints
+			height, _, _ := numberField(data, "height")
+			width, _, _ := numberField(data, "width")
+			if uri := stringField(data, "uri"); uri != "" {
+				p.Images = append(p.Images, Image{URI: uri, Height: int32(height), Width: int32(width)})
+			}
+		}
+	}
+
+	if data, ok := productData["audience"].(map[string]interface{}); ok {
+		p.Audience = &Audience{Genders: stringList(data, "genders"), AgeGroups: stringList(data, "ageGroups")}
+	}
+	if data, ok := productData["colorInfo"].(map[string]interface{}); ok {
+		p.ColorInfo = &ColorInfo{ColorFamilies: stringList(data, "colorFamilies"), Colors: stringList(data, "colors")}
+	}
+
+	if attributes, ok := productData["attributes"].([]interface{}); ok {
+		for _, attr := range attributes {
+			data, ok := attr.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := stringField(data, "key")
+			value, ok := data["value"].(map[string]interface{})
+			if key == "" || !ok {
+				continue
+			}
+			attribute, err := toCustomAttribute(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: product %s: attribute %s: %v", ErrInvalidProduct, productID, key, err)
+			}
+			if p.Attributes == nil {
+				p.Attributes = make(map[string]CustomAttribute)
+			}
+			p.Attributes[key] = attribute
+		}
+	}
+	return p, nil
+}
+
+// toPriceInfo converts a product_data priceInfo, whose amounts are
+// usually strings
+func toPriceInfo(data map[string]interface{}) (*PriceInfo, error) {
+	price, _, err := numberField(data, "price")
+	if err != nil {
+		return nil, err
+	}
+	priceInfo := &PriceInfo{
+		CurrencyCode:       stringField(data, "currencyCode"),
+		Price:              price,
+		PriceEffectiveTime: stringField(data, "priceEffectiveTime"),
+		PriceExpireTime:    stringField(data, "priceExpireTime"),
+	}
+	if originalPrice, ok, err := numberField(data, "originalPrice"); err != nil {
+		return nil, err
+	} else if ok {
+		priceInfo.OriginalPrice = &originalPrice
+	}
+	if cost, ok, err := numberField(data, "cost"); err != nil {
+		return nil, err
+	} else if ok {
+		priceInfo.Cost = &cost
+	}
+	return priceInfo, nil
+}
+
+// toCustomAttribute converts a product_data attribute value, whose flags
+// are usually the strings "true" and "false"
+func toCustomAttribute(value map[string]interface{}) (CustomAttribute, error) {
+	attribute := CustomAttribute{Text: stringList(value, "text")}
+	if numbers, ok := value["numbers"].([]interface{}); ok {
+		for _, n := range numbers {
+			f, err := number(n)
+			if err != nil {
+				return attribute, err
+			}
+			attribute.Numbers = append(attribute.Numbers, f)
+		}
+	}
+	for name, flag := range map[string]**bool{"searchable": &attribute.Searchable, "indexable": &attribute.Indexable} {
+		switch v := value[name].(type) {
+		case bool:
+			*flag = ptr(v)
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return attribute, fmt.Errorf("%s: %v", name, err)
+			}
+			*flag = ptr(b)
+		}
+	}
+	return attribute, nil
+}
+
+// FromProduct converts a Retail Product to product_data in the layout the
+// products table stores, returning the product ID along with it
+func FromProduct(p *Product) (string, map[string]interface{}, error) {
+	productID := p.ID
+	if productID == "" {
+		// Products exported by the Retail API may only carry their
+		// resource name, which ends with the ID
+		if i := strings.LastIndex(p.Name, "/products/"); i >= 0 {
+			productID = p.Name[i+len("/products/"):]
+		}
+	}
+	if productID == "" {
+		return "", nil, fmt.Errorf("%w: product has no id", ErrInvalidProduct)
+	}
+	if p.Title == "" {
+		return "", nil, fmt.Errorf("%w: product %s has no title", ErrInvalidProduct, productID)
+	}
+
+	data := map[string]interface{}{
+		"id":    productID,
+		"title": p.Title,
+	}
+	setString := func(key, value string) {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	setList := func(key string, values []string) {
+		if len(values) > 0 {
+			data[key] = stringValues(values)
+		}
+	}
+	setString("name", p.Name)
+	setString("type", p.Type)
+	setString("primaryProductId", p.PrimaryProductID)
+	setList("collectionMemberIds", p.CollectionMemberIDs)
+	setString("gtin", p.GTIN)
+	setList("categories", p.Categories)
+	setList("brands", p.Brands)
+	setString("description", p.Description)
+	setString("languageCode", p.LanguageCode)
+	setList("tags", p.Tags)
+	setString("availableTime", p.AvailableTime)
+	setString("availability", p.Availability)
+	setString("uri", p.URI)
+	setList("sizes", p.Sizes)
+	setList("materials", p.Materials)
+	setList("patterns", p.Patterns)
+	setList("conditions", p.Conditions)
+	setString("publishTime", p.PublishTime)
+	if p.AvailableQuantity != nil {
+		data["availableQuantity"] = float64(*p.AvailableQuantity)
+	}
+
+	if p.PriceInfo != nil {
+		priceInfo := map[string]interface{}{"price": formatNumber(p.PriceInfo.Price)}
+		if p.PriceInfo.CurrencyCode != "" {
+			priceInfo["currencyCode"] = p.PriceInfo.CurrencyCode
+		}
+		if p.PriceInfo.OriginalPrice != nil {
+			priceInfo["originalPrice"] = formatNumber(*p.PriceInfo.OriginalPrice)
+		}
+		if p.PriceInfo.Cost != nil {
+			priceInfo["cost"] = formatNumber(*p.PriceInfo.Cost)
+		}
+		if p.PriceInfo.PriceEffectiveTime != "" {
+			priceInfo["priceEffectiveTime"] = p.PriceInfo.PriceEffectiveTime
+		}
+		if p.PriceInfo.PriceExpireTime != "" {
+			priceInfo["priceExpireTime"] = p.PriceInfo.PriceExpireTime
+		}
+		data["priceInfo"] = priceInfo
+	}
+
+	if p.Rating != nil {
+		rating := map[string]interface{}{
+			"ratingCount":   float64(p.Rating.RatingCount),
+			"averageRating": p.Rating.AverageRating,
+		}
+		if len(p.Rating.RatingHistogram) > 0 {
+			histogram := make([]interface{}, 0, len(p.Rating.RatingHistogram))
+			for _, bucket := range p.Rating.RatingHistogram {
+				histogram = append(histogram, float64(bucket))
+			}
+			rating["ratingHistogram"] = histogram
+		}
+		data["rating"] = rating
+	}
+
+	if len(p.Images) > 0 {
+		images := make([]interface{}, 0, len(p.Images))
+		for _, image := range p.Images {
+			images = append(images, map[string]interface{}{
+				"uri":    image.URI,
+				"height": strconv.Itoa(int(image.Height)),
+				"width":  strconv.Itoa(int(image.Width)),
+			})
+		}
+		data["images"] = images
+	}
+
+	if p.Audience != nil {
+		audience := map[string]interface{}{}
+		if len(p.Audience.Genders) > 0 {
+			audience["genders"] = stringValues(p.Audience.Genders)
+		}
+		if len(p.Audience.AgeGroups) > 0 {
+			audience["ageGroups"] = stringValues(p.Audience.AgeGroups)
+		}
+		data["audience"] = audience
+	}
+	if p.ColorInfo != nil {
+		colorInfo := map[string]interface{}{}
+		if len(p.ColorInfo.ColorFamilies) > 0 {
+			colorInfo["colorFamilies"] = stringValues(p.ColorInfo.ColorFamilies)
+		}
+		if len(p.ColorInfo.Colors) > 0 {
+			colorInfo["colors"] = stringValues(p.ColorInfo.Colors)
+		}
+		data["colorInfo"] = colorInfo
+	}
+
+	if len(p.Attributes) > 0 {
+		// Sorted so the same product always produces the same product_data
+		keys := make([]string, 0, len(p.Attributes))
+		for key := range p.Attributes {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		attributes := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			attribute := p.Attributes[key]
+			value := map[string]interface{}{}
+			if len(attribute.Text) > 0 {
+				value["text"] = stringValues(attribute.Text)
+			}
+			if len(attribute.Numbers) > 0 {
+				numbers := make([]interface{}, 0, len(attribute.Numbers))
+				for _, n := range attribute.Numbers {
+					numbers = append(numbers, n)
+				}
+				value["numbers"] = numbers
+			}
+			if attribute.Searchable != nil {
+				value["searchable"] = strconv.FormatBool(*attribute.Searchable)
+			}
+			if attribute.Indexable != nil {
+				value["indexable"] = strconv.FormatBool(*attribute.Indexable)
+			}
+			attributes = append(attributes, map[string]interface{}{"key": key, "value": value})
+		}
+		data["attributes"] = attributes
+	}
+	return productID, data, nil
+}
+
+// stringField returns the string at key, or "" if it is missing or not a
+// string
+func stringField(data map[string]interface{}, key string) string {
+	s, _ := data[key].(string)
+	return s
+}
+
+// stringList returns the strings of the list at key. Numbers, such as
+// numeric sizes, are formatted as strings.
+func stringList(data map[string]interface{}, key string) []string {
+	items, _ := data[key].([]interface{})
+	var values []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			values = append(values, v)
+		case float64:
+			values = append(values, formatNumber(v))
+		}
+	}
+	return values
+}
+
+// stringValues converts strings to the []interface{} JSON decoding produces
+func stringValues(values []string) []interface{} {
+	items := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		items = append(items, v)
+	}
+	return items
+}
+
+// numberField returns the number at key, which may be a JSON number or a
+// numeric string, and whether it was set
+func numberField(data map[string]interface{}, key string) (float64, bool, error) {
+	value, ok := data[key]
+	if !ok || value == nil || value == "" {
+		return 0, false, nil
+	}
+	n, err := number(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %v", key, err)
+	}
+	return n, true, nil
+}
+
+// number parses a JSON number or a numeric string
+func number(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+}
+
+// formatNumber formats a number without trailing zeros, as product_data
+// stores prices
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// ptr returns a pointer to v
+func ptr[T any](v T) *T {
+	return &v
+}
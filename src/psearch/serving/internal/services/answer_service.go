@@ -0,0 +1,202 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// answerPrompt grounds the model in the search results for the question
+const answerPrompt = `You are a shopping assistant answering a shopper's question about a store's products.
+Answer only from the products listed below, in a few sentences, in the language of the question.
+Cite each product you mention by putting its id in square brackets right after it, e.g. "the Alpine Shell [P123]".
+Do not invent products, prices or features that the product data does not state.
+If none of the products answer the question, say so without citing any product.
+Question: %s
+Products, one JSON object per line:
+%s`
+
+// answerSchema constrains Gemini's output to the answer text
+var answerSchema = map[string]interface{}{
+	"type": "OBJECT",
+	"properties": map[string]interface{}{
+		"answer": map[string]interface{}{"type": "STRING"},
+	},
+	"required": []string{"answer"},
+}
+
+// answerDescriptionRunes bounds the description sent per product, keeping
+// the prompt small when product descriptions are long
+const answerDescriptionRunes = 500
+
+// citationPattern matches a bracketed product ID cited in an answer
+var citationPattern = regexp.MustCompile(`\s?\[([^\[\]\s]+)\]`)
+
+// AnswerService calls Gemini to answer shoppers' questions from search
+// results
+type AnswerService struct {
+	config *config.Config
+	gemini *GeminiClient
+}
+
+// NewAnswerService creates a new answer service
+func NewAnswerService(cfg *config.Config, gemini *GeminiClient) *AnswerService {
+	return &AnswerService{
+		config: cfg,
+		gemini: gemini,
+	}
+}
+
+// Answer generates an answer to the question grounded in results, and
+// returns it with the IDs of the results it cites. Citations of products
+// that are not among the results are removed from the answer.
+func (s *AnswerService) Answer(ctx context.Context, question string, results []models.SearchResult) (answer string, citations []string, err error) {
+	ctx, span := tracer.Start(ctx, "AnswerService.Answer",
+		trace.WithAttributes(
+			attribute.String("answer.model", s.config.AnswerModel),
+			attribute.String("search.query_hash", telemetry.HashQuery(question)),
+			attribute.Int("answer.result_count", len(results)),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "answer generation failed")
+		}
+		span.End()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AnswerTimeout)
+	defer cancel()
+
+	products, err := answerContext(results)
+	if err != nil {
+		return "", nil, err
+	}
+	var response struct {
+		Answer string `json:"answer"`
+	}
+	if err := s.gemini.GenerateJSON(ctx, s.config.AnswerModel, fmt.Sprintf(answerPrompt, question, products), answerSchema, &response); err != nil {
+		return "", nil, err
+	}
+
+	answer, citations = resolveCitations(strings.TrimSpace(response.Answer), results)
+	span.SetAttributes(attribute.Int("answer.citation_count", len(citations)))
+	return answer, citations, nil
+}
+
+// answerContext writes the product data the model answers from, one JSON
+// object per result
+func answerContext(results []models.SearchResult) (string, error) {
+	type answerProduct struct {
+		ID           string              `json:"id"`
+		Title        string              `json:"title"`
+		Brands       []string            `json:"brands,omitempty"`
+		Categories   []string            `json:"categories,omitempty"`
+		Price        string              `json:"price,omitempty"`
+		Currency     string              `json:"currency,omitempty"`
+		Availability string              `json:"availability,omitempty"`
+		Colors       []string            `json:"colors,omitempty"`
+		Sizes        []string            `json:"sizes,omitempty"`
+		Attributes   map[string][]string `json:"attributes,omitempty"`
+		Description  string              `json:"description,omitempty"`
+	}
+
+	var b strings.Builder
+	for _, result := range results {
+		product := answerProduct{
+			ID:           result.ID,
+			Title:        result.Title,
+			Brands:       result.Brands,
+			Categories:   result.Categories,
+			Price:        result.PriceInfo.Price,
+			Currency:     result.PriceInfo.CurrencyCode,
+			Availability: result.Availability,
+			Sizes:        result.Sizes,
+			Description:  truncateRunes(result.Description, answerDescriptionRunes),
+		}
+		if result.ColorInfo != nil {
+			product.Colors = result.ColorInfo.Colors
+		}
+		for _, attr := range result.Attributes {
+			values := append([]string(nil), attr.Value.Text...)
+			for _, n := range attr.Value.Numbers {
+				values = append(values, fmt.Sprint(n))
+			}
+			if len(values) == 0 {
+				continue
+			}
+			if product.Attributes == nil {
+				product.Attributes = make(map[string][]string)
+			}
+			product.Attributes[attr.Key] = values
+		}
+		line, err := json.Marshal(product)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal product %s for the answer prompt: %v", result.ID, err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// resolveCitations returns the answer without citations of products that
+// are not among results, and the IDs it cites in order of first mention
+func resolveCitations(answer string, results []models.SearchResult) (string, []string) {
+	known := make(map[string]bool, len(results))
+	for _, result := range results {
+		known[result.ID] = true
+	}
+	citations := []string{}
+	cited := make(map[string]bool)
+	answer = citationPattern.ReplaceAllStringFunc(answer, func(match string) string {
+		id := citationPattern.FindStringSubmatch(match)[1]
+		if !known[id] {
+			return ""
+		}
+		if !cited[id] {
+			cited[id] = true
+			citations = append(citations, id)
+		}
+		return match
+	})
+	return answer, citations
+}
+
+// truncateRunes shortens s to at most n runes
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
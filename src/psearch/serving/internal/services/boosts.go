@@ -0,0 +1,87 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"slices"
+	"strings"
+
+	"psearch/serving/internal/models"
+)
+
+// ApplyBoosts scales the fused score of the results each boost matches by
+// its factor and re-sorts them by the adjusted score. The factors of
+// several matching boosts multiply. It returns the reordered results and
+// the boosts applied to each product, for debug responses. results itself
+// is not modified, since it may be shared with the result cache.
+func ApplyBoosts(results []models.SearchResult, boosts []models.Boost) ([]models.SearchResult, map[string][]models.AppliedBoost) {
+	if len(boosts) == 0 {
+		return results, nil
+	}
+
+	boosted := slices.Clone(results)
+	applied := make(map[string][]models.AppliedBoost)
+	for i := range boosted {
+		factor := 1.0
+		for _, boost := range boosts {
+			if !boostMatches(boosted[i], boost) {
+				continue
+			}
+			factor *= boost.Factor
+			applied[boosted[i].ID] = append(applied[boosted[i].ID], models.AppliedBoost{
+				Type:   models.BoostQuery,
+				Factor: boost.Factor,
+				Field:  boost.Field,
+				Value:  boost.Value,
+			})
+		}
+		if factor != 1 {
+			boosted[i].Score = withScore(boosted[i].Score, "hybrid", boosted[i].Score["hybrid"]*factor)
+		}
+	}
+
+	// Stable sort keeps the fused order between equally scored products
+	slices.SortStableFunc(boosted, func(a, b models.SearchResult) int {
+		switch {
+		case a.Score["hybrid"] > b.Score["hybrid"]:
+			return -1
+		case a.Score["hybrid"] < b.Score["hybrid"]:
+			return 1
+		}
+		return 0
+	})
+	return boosted, applied
+}
+
+// boostMatches reports whether a boost applies to a product. Brands match
+// whole, ignoring case; categories match a whole category or any level of
+// a "Apparel > Shoes" category path.
+func boostMatches(result models.SearchResult, boost models.Boost) bool {
+	switch boost.Field {
+	case models.BoostFieldBrand:
+		return slices.ContainsFunc(result.Brands, func(brand string) bool {
+			return strings.EqualFold(strings.TrimSpace(brand), boost.Value)
+		})
+	case models.BoostFieldCategory:
+		return slices.ContainsFunc(result.Categories, func(category string) bool {
+			return slices.ContainsFunc(strings.Split(category, ">"), func(level string) bool {
+				return strings.EqualFold(strings.TrimSpace(level), boost.Value)
+			}) || strings.EqualFold(strings.TrimSpace(category), boost.Value)
+		})
+	}
+	return false
+}
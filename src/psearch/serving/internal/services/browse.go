@@ -0,0 +1,167 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/models"
+)
+
+// browseSQL lists the products in a category or any of its subcategories.
+// Categories use the "Parent > Child" path format. Soft-deleted products
+// are left out.
+const browseSQL = `SELECT product_id, product_data
+		FROM products
+		WHERE deleted_at IS NULL AND EXISTS (
+			SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(product_data, '$.categories')) AS category
+			WHERE category = @category OR STARTS_WITH(category, CONCAT(@category, ' > ')))%s
+		ORDER BY %s, product_id
+		LIMIT @limit OFFSET @offset`
+
+// browseOrderBy maps each sort order to its ORDER BY expression. Products
+// missing the sort field are listed last.
+var browseOrderBy = map[models.BrowseSort]string{
+	models.BrowseSortPriceAsc:   "SAFE_CAST(JSON_VALUE(product_data, '$.priceInfo.price') AS FLOAT64) ASC NULLS LAST",
+	models.BrowseSortPriceDesc:  "SAFE_CAST(JSON_VALUE(product_data, '$.priceInfo.price') AS FLOAT64) DESC NULLS LAST",
+	models.BrowseSortNewest:     "SAFE_CAST(JSON_VALUE(product_data, '$.publishTime') AS TIMESTAMP) DESC NULLS LAST",
+	models.BrowseSortPopularity: "SAFE_CAST(JSON_VALUE(product_data, '$.rating.ratingCount') AS INT64) DESC NULLS LAST",
+}
+
+// BrowseOptions holds the parameters for BrowseByCategory
+type BrowseOptions struct {
+	Category string
+	Sort     models.BrowseSort
+	Limit    int
+	Offset   int
+	// Filter further restricts the listed products; nil means no filter
+	Filter    filter.Node
+	Staleness time.Duration
+	// CatalogID restricts the listing to one catalog; empty lists all
+	CatalogID string
+}
+
+// BrowseOutput holds a page of browse results
+type BrowseOutput struct {
+	Results []models.SearchResult
+	// HasMore is set when products exist past this page
+	HasMore bool
+}
+
+// BrowseByCategory lists the products in a category in the given sort
+// order. Unlike HybridSearch it needs no query text or embedding.
+func (s *SpannerService) BrowseByCategory(ctx context.Context, opts BrowseOptions) (output *BrowseOutput, err error) {
+	startTime := time.Now()
+
+	orderBy, ok := browseOrderBy[opts.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unsupported browse sort: %q", opts.Sort)
+	}
+
+	ctx, span := tracer.Start(ctx, "SpannerService.BrowseByCategory",
+		trace.WithAttributes(
+			attribute.String("browse.category", opts.Category),
+			attribute.String("browse.sort", string(opts.Sort)),
+			attribute.Int("browse.limit", opts.Limit),
+			attribute.Int("browse.offset", opts.Offset),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "browse failed")
+		}
+		span.End()
+	}()
+
+	// Read one extra row to tell whether there is a next page
+	params := map[string]interface{}{
+		"category": opts.Category,
+		"limit":    opts.Limit + 1,
+		"offset":   opts.Offset,
+	}
+
+	var filterSQL string
+	if opts.Filter != nil {
+		var filterParams map[string]interface{}
+		filterSQL, filterParams = filter.CompileSQL(opts.Filter, "filter_")
+		filterSQL = " AND " + filterSQL
+		for name, value := range filterParams {
+			params[name] = value
+		}
+	}
+	filterSQL += andClause(catalogClause("catalog_id", opts.CatalogID, params))
+
+	stmt := spanner.Statement{
+		SQL:    fmt.Sprintf(browseSQL, filterSQL, orderBy),
+		Params: params,
+	}
+
+	iter := s.singleRead(time.Time{}, opts.Staleness).QueryWithOptions(ctx, stmt, queryOptions(ctx))
+	defer iter.Stop()
+
+	output = &BrowseOutput{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			metrics.ObserveSince(metrics.SpannerQueryDuration.WithLabelValues("browse", metrics.Outcome(err)), startTime)
+			return nil, fmt.Errorf("error iterating through browse results: %w", err)
+		}
+
+		if len(output.Results) == opts.Limit {
+			output.HasMore = true
+			break
+		}
+
+		var productID string
+		var productDataJSON spanner.NullJSON
+		if err := row.Columns(&productID, &productDataJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan browse result: %v", err)
+		}
+
+		productData, ok := productDataJSON.Value.(map[string]interface{})
+		if !productDataJSON.Valid || !ok {
+			continue
+		}
+
+		result, err := s.TransformProduct(productID, productData)
+		if err != nil {
+			log.Printf("Warning: could not transform product %s: %v", productID, err)
+			continue
+		}
+		output.Results = append(output.Results, result)
+	}
+
+	elapsed := time.Since(startTime)
+	metrics.SpannerQueryDuration.WithLabelValues("browse", metrics.Outcome(nil)).Observe(elapsed.Seconds())
+	span.SetAttributes(attribute.Int("browse.result_count", len(output.Results)))
+	log.Printf("Browse of category %q completed in %s, found %d results", opts.Category, elapsed, len(output.Results))
+
+	return output, nil
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import "cloud.google.com/go/spanner"
+
+// Catalogs share the products table and are told apart by its catalog_id
+// column, so product IDs must be unique across catalogs. An empty catalog
+// ID means the deployment is single-tenant and nothing is scoped.
+
+// catalogClause returns a predicate restricting column to catalogID and
+// binds its parameter, or "" when catalogID is empty
+func catalogClause(column, catalogID string, params map[string]interface{}) string {
+	if catalogID == "" {
+		return ""
+	}
+	params["catalog_id"] = catalogID
+	return column + " = @catalog_id"
+}
+
+// inCatalog reports whether a product whose catalog_id column is
+// productCatalog is in catalogID. Every product is in the empty catalog.
+func inCatalog(catalogID string, productCatalog spanner.NullString) bool {
+	return catalogID == "" || productCatalog.StringVal == catalogID
+}
+
+// andClause prefixes a non-empty predicate with AND for appending to a
+// WHERE clause
+func andClause(predicate string) string {
+	if predicate == "" {
+		return ""
+	}
+	return " AND " + predicate
+}
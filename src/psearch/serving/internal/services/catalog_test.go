@@ -0,0 +1,133 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+)
+
+func TestSearchSQLScopedToCatalog(t *testing.T) {
+	fields := []config.FTSField{{Name: "title", Weight: 1}}
+	ann := ANNParams{NumLeavesToSearch: 10, DistanceMetric: DistanceCosine, Column: "embedding"}
+	inStock, err := filter.Parse(`availability = "IN_STOCK"`, filter.NewRegistry(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []models.SearchMode{models.SearchModeHybrid, models.SearchModeVector, models.SearchModeKeyword} {
+		for _, annBranches := range []int{1, 3} {
+			for _, sort := range []models.SearchSort{models.SearchSortRelevance, models.SearchSortPriceAsc} {
+				for _, opts := range []SearchOptions{{CatalogID: "us"}, {CatalogID: "us", Filter: inStock}} {
+					name := fmt.Sprintf("%s/%d branches/%s/filtered %t", mode, annBranches, sort, opts.Filter != nil)
+					params := map[string]interface{}{}
+					filterSQL := searchFilterSQL(opts, params)
+					if params["catalog_id"] != "us" {
+						t.Errorf("%s: catalog_id = %v, want us", name, params["catalog_id"])
+					}
+
+					// Every retrieval branch, fused in one statement or
+					// run in parallel, reads only the catalog
+					wantBranches := 0
+					var branchSQL []string
+					if usesANN(mode) {
+						wantBranches += annBranches
+						for i := 0; i < annBranches; i++ {
+							branchSQL = append(branchSQL, buildBranchSQL(true, i, filterSQL, fields, false, KeywordParams{}, ann, false, "", true))
+						}
+					}
+					if usesFTS(mode) {
+						wantBranches++
+						branchSQL = append(branchSQL, buildBranchSQL(false, 0, filterSQL, fields, false, KeywordParams{}, ann, false, "", true))
+					}
+					sql := buildSearchSQL(mode, filterSQL, fields, false, KeywordParams{}, annBranches, ann, false, "", sort, true)
+					if got := strings.Count(sql, "AND catalog_id = @catalog_id"); got != wantBranches {
+						t.Errorf("%s: statement scopes %d branches to the catalog, want %d:\n%s", name, got, wantBranches, sql)
+					}
+					for _, sql := range branchSQL {
+						if !strings.Contains(sql, "AND catalog_id = @catalog_id") {
+							t.Errorf("%s: branch statement is not scoped to the catalog:\n%s", name, sql)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSearchFilterSQL(t *testing.T) {
+	inStock, err := filter.Parse(`availability = "IN_STOCK"`, filter.NewRegistry(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		opts       SearchOptions
+		want       string
+		wantParams int
+	}{
+		{name: "unscoped", opts: SearchOptions{}, want: "", wantParams: 0},
+		{name: "catalog", opts: SearchOptions{CatalogID: "us"}, want: "catalog_id = @catalog_id", wantParams: 1},
+		{name: "filter", opts: SearchOptions{Filter: inStock}, want: "JSON_VALUE(product_data, '$.availability') = @filter_0", wantParams: 1},
+		{name: "catalog and filter", opts: SearchOptions{CatalogID: "us", Filter: inStock}, want: "catalog_id = @catalog_id AND JSON_VALUE(product_data, '$.availability') = @filter_0", wantParams: 2},
+	}
+	for _, tt := range tests {
+		params := map[string]interface{}{}
+		if got := searchFilterSQL(tt.opts, params); got != tt.want || len(params) != tt.wantParams {
+			t.Errorf("%s: searchFilterSQL() = %q with %d params, want %q with %d", tt.name, got, len(params), tt.want, tt.wantParams)
+		}
+	}
+}
+
+func TestProductsBatchStatementScopedToCatalog(t *testing.T) {
+	stmt := productsBatchStatement("us", []string{"p1", "p2"})
+	if !strings.Contains(stmt.SQL, "AND deleted_at IS NULL AND catalog_id = @catalog_id") || stmt.Params["catalog_id"] != "us" {
+		t.Errorf("statement is not scoped to the catalog: %s %v", stmt.SQL, stmt.Params)
+	}
+
+	stmt = productsBatchStatement("", []string{"p1"})
+	if strings.Contains(stmt.SQL, "catalog_id") || len(stmt.Params) != 1 {
+		t.Errorf("unscoped statement refers to a catalog: %s %v", stmt.SQL, stmt.Params)
+	}
+}
+
+func TestInCatalog(t *testing.T) {
+	// Product writes, patches and similar-product reads check the product
+	// row's catalog_id with inCatalog
+	tests := []struct {
+		catalogID      string
+		productCatalog spanner.NullString
+		want           bool
+	}{
+		{catalogID: "us", productCatalog: spanner.NullString{StringVal: "us", Valid: true}, want: true},
+		{catalogID: "us", productCatalog: spanner.NullString{StringVal: "eu", Valid: true}, want: false},
+		{catalogID: "us", productCatalog: spanner.NullString{}, want: false},
+		{catalogID: "", productCatalog: spanner.NullString{StringVal: "eu", Valid: true}, want: true},
+		{catalogID: "", productCatalog: spanner.NullString{}, want: true},
+	}
+	for _, tt := range tests {
+		if got := inCatalog(tt.catalogID, tt.productCatalog); got != tt.want {
+			t.Errorf("inCatalog(%q, %v) = %t, want %t", tt.catalogID, tt.productCatalog, got, tt.want)
+		}
+	}
+}
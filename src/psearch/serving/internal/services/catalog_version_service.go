@@ -0,0 +1,190 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// catalogVersions holds the last seen version of each catalog. Versions are
+// part of result cache keys, so bumping a catalog's version after an import
+// or branch switch orphans its cached results without a flush; they age out
+// of the LRU like any other entry.
+type catalogVersions struct {
+	mu       sync.RWMutex
+	versions map[string]string
+}
+
+// get returns the cache key component for a catalog, "" when it has no
+// version yet
+func (v *catalogVersions) get(catalogID string) string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.versions[catalogID]
+}
+
+// replace swaps in the loaded versions and reports whether any changed
+func (v *catalogVersions) replace(versions map[string]string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	changed := v.versions != nil && !maps.Equal(v.versions, versions)
+	v.versions = versions
+	return changed
+}
+
+// set records a single catalog's version
+func (v *catalogVersions) set(catalogID, version string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.versions == nil {
+		v.versions = make(map[string]string)
+	}
+	v.versions[catalogID] = version
+}
+
+// versionKey combines the version label with its commit timestamp, so
+// re-importing under the same label still invalidates
+func versionKey(version models.CatalogVersion) string {
+	return fmt.Sprintf("%s@%d", version.Version, version.UpdatedAt.UnixNano())
+}
+
+// CatalogVersionService tracks the catalog_versions table. Import jobs and
+// branch switches upsert their catalog's row when they finish; every
+// replica picks the change up on its next refresh.
+type CatalogVersionService struct {
+	config  *config.Config
+	spanner *SpannerService
+	// onChange is called after a refresh finds a changed version
+	onChange func()
+}
+
+// NewCatalogVersionService creates a new catalog version service. onChange
+// may be nil.
+func NewCatalogVersionService(cfg *config.Config, spannerSvc *SpannerService, onChange func()) *CatalogVersionService {
+	return &CatalogVersionService{
+		config:   cfg,
+		spanner:  spannerSvc,
+		onChange: onChange,
+	}
+}
+
+// Run loads the versions at startup and on every refresh interval until ctx
+// is done
+func (s *CatalogVersionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CatalogVersionRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("Warning: could not load catalog versions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh replaces the known versions with the stored ones
+func (s *CatalogVersionService) Refresh(ctx context.Context) error {
+	stored, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[string]string, len(stored))
+	for _, version := range stored {
+		versions[version.CatalogID] = versionKey(version)
+	}
+
+	if s.spanner.versions.replace(versions) {
+		log.Printf("Catalog version changed, cached results of the catalog are no longer served")
+		if s.onChange != nil {
+			s.onChange()
+		}
+	}
+	return nil
+}
+
+// Bump records a new version for a catalog. It applies to this replica
+// immediately and to the others on their next refresh.
+func (s *CatalogVersionService) Bump(ctx context.Context, req models.CatalogVersionRequest) (*models.CatalogVersion, error) {
+	version := &models.CatalogVersion{
+		CatalogID: req.CatalogID,
+		Version:   strings.TrimSpace(req.Version),
+	}
+
+	mutation := spanner.InsertOrUpdateMap("catalog_versions", map[string]interface{}{
+		"catalog_id": version.CatalogID,
+		"version":    version.Version,
+		"updated_at": spanner.CommitTimestamp,
+	})
+
+	commitTimestamp, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save catalog version: %w", err)
+	}
+	version.UpdatedAt = commitTimestamp
+
+	s.spanner.versions.set(version.CatalogID, versionKey(*version))
+	if s.onChange != nil {
+		s.onChange()
+	}
+	return version, nil
+}
+
+// List returns the stored catalog versions
+func (s *CatalogVersionService) List(ctx context.Context) ([]models.CatalogVersion, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT catalog_id, version, updated_at
+              FROM catalog_versions
+              ORDER BY catalog_id`,
+	}
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var versions []models.CatalogVersion
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through catalog versions: %w", err)
+		}
+
+		var version models.CatalogVersion
+		if err := row.Columns(&version.CatalogID, &version.Version, &version.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan catalog version: %v", err)
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
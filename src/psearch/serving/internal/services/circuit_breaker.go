@@ -0,0 +1,125 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"psearch/serving/internal/metrics"
+)
+
+// ErrCircuitOpen is returned without calling the backend while a circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Circuit breaker states, also exported as the circuit_breaker_state gauge
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreaker stops calling a failing backend after consecutive failures.
+// Once openDuration has passed, a single probe call is let through; its
+// outcome closes the breaker or opens it again.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openDuration     time.Duration
+
+	mu          sync.Mutex
+	state       int
+	failures    int
+	openedAt    time.Time
+	probeActive bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker. A failure threshold
+// below 1 disables the breaker.
+func NewCircuitBreaker(name string, failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	metrics.CircuitBreakerState.WithLabelValues(name).Set(circuitClosed)
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+	}
+}
+
+// Allow returns ErrCircuitOpen if the call should not be made
+func (b *CircuitBreaker) Allow() error {
+	if b.failureThreshold < 1 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return ErrCircuitOpen
+		}
+		b.setState(circuitHalfOpen)
+		b.probeActive = true
+		return nil
+	case circuitHalfOpen:
+		if b.probeActive {
+			return ErrCircuitOpen
+		}
+		b.probeActive = true
+	}
+	return nil
+}
+
+// Record reports the outcome of an allowed call
+func (b *CircuitBreaker) Record(err error) {
+	if b.failureThreshold < 1 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probeActive = false
+	if err == nil {
+		b.failures = 0
+		if b.state != circuitClosed {
+			log.Printf("Circuit breaker %s closed", b.name)
+			b.setState(circuitClosed)
+		}
+		return
+	}
+
+	// Only failures of the backend count; bad input says nothing about its health
+	if !IsRetryable(err) {
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.failureThreshold {
+		log.Printf("Circuit breaker %s opened after %d consecutive failures: %v", b.name, b.failures, err)
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state int) {
+	b.state = state
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"psearch/serving/internal/models"
+)
+
+// ErrInvalidConfigBundle is wrapped by errors in an imported bundle
+var ErrInvalidConfigBundle = errors.New("invalid config bundle")
+
+// ConfigBundleService exports the admin-managed configuration as a single
+// bundle and imports bundles exported by another environment
+type ConfigBundleService struct {
+	spanner   *SpannerService
+	templates *QueryTemplateService
+	profiles  *ScoringProfileService
+	rules     *MerchandisingRuleService
+}
+
+// NewConfigBundleService creates a new config bundle service
+func NewConfigBundleService(spannerSvc *SpannerService, templates *QueryTemplateService, profiles *ScoringProfileService, rules *MerchandisingRuleService) *ConfigBundleService {
+	return &ConfigBundleService{
+		spanner:   spannerSvc,
+		templates: templates,
+		profiles:  profiles,
+		rules:     rules,
+	}
+}
+
+// Export returns the stored configuration
+func (s *ConfigBundleService) Export(ctx context.Context) (*models.ConfigBundle, error) {
+	templates, err := s.templates.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := s.profiles.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.rules.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &models.ConfigBundle{
+		Version:            models.ConfigBundleVersion,
+		ExportedAt:         time.Now().UTC(),
+		QueryTemplates:     templates,
+		ScoringProfiles:    profiles,
+		MerchandisingRules: rules,
+	}
+	if bundle.QueryTemplates == nil {
+		bundle.QueryTemplates = []models.QueryTemplate{}
+	}
+	if bundle.ScoringProfiles == nil {
+		bundle.ScoringProfiles = []models.ScoringProfile{}
+	}
+	if bundle.MerchandisingRules == nil {
+		bundle.MerchandisingRules = []models.MerchandisingRule{}
+	}
+	return bundle, nil
+}
+
+// Import validates every entry of the bundle and then writes all of them in
+// a single transaction, so a bad entry leaves the configuration untouched.
+// With prune, stored entries missing from the bundle are deleted, making
+// this environment's configuration match the exporting one's. A dry run
+// only validates and reports what would change.
+func (s *ConfigBundleService) Import(ctx context.Context, bundle models.ConfigBundle, prune, dryRun bool) (*models.ConfigImportResult, error) {
+	if bundle.Version != models.ConfigBundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d, expected %d", ErrInvalidConfigBundle, bundle.Version, models.ConfigBundleVersion)
+	}
+
+	result := &models.ConfigImportResult{DryRun: dryRun}
+	var mutations []*spanner.Mutation
+
+	templateIDs := make(map[string]bool, len(bundle.QueryTemplates))
+	for _, template := range bundle.QueryTemplates {
+		if templateIDs[template.ID] {
+			return nil, fmt.Errorf("%w: query template %q appears twice", ErrInvalidConfigBundle, template.ID)
+		}
+		templateIDs[template.ID] = true
+		mutation, err := s.templates.putMutation(template.ID, models.QueryTemplateRequest{
+			Description: template.Description,
+			Search:      template.Search,
+			Parameters:  template.Parameters,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: query template %q: %v", ErrInvalidConfigBundle, template.ID, err)
+		}
+		mutations = append(mutations, mutation)
+		result.QueryTemplates++
+	}
+
+	categories := make(map[string]bool, len(bundle.ScoringProfiles))
+	for _, profile := range bundle.ScoringProfiles {
+		category := strings.TrimSpace(profile.Category)
+		if categories[category] {
+			return nil, fmt.Errorf("%w: scoring profile %q appears twice", ErrInvalidConfigBundle, category)
+		}
+		categories[category] = true
+		mutation, err := s.profiles.putMutation(category, models.ScoringProfileRequest{
+			Alpha:    profile.Alpha,
+			MinScore: profile.MinScore,
+			Mode:     profile.Mode,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: scoring profile %q: %v", ErrInvalidConfigBundle, category, err)
+		}
+		mutations = append(mutations, mutation)
+		result.ScoringProfiles++
+	}
+
+	ruleIDs := make(map[string]bool, len(bundle.MerchandisingRules))
+	for _, rule := range bundle.MerchandisingRules {
+		if ruleIDs[rule.ID] {
+			return nil, fmt.Errorf("%w: merchandising rule %q appears twice", ErrInvalidConfigBundle, rule.ID)
+		}
+		ruleIDs[rule.ID] = true
+		_, mutation, err := prepareRule(rule.ID, models.MerchandisingRuleRequest{
+			Name:            rule.Name,
+			QueryPattern:    rule.QueryPattern,
+			Category:        rule.Category,
+			BoostProductIDs: rule.BoostProductIDs,
+			BuryProductIDs:  rule.BuryProductIDs,
+			Pins:            rule.Pins,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: merchandising rule %q: %v", ErrInvalidConfigBundle, rule.ID, err)
+		}
+		mutations = append(mutations, mutation)
+		result.MerchandisingRules++
+	}
+
+	if prune {
+		deletes, err := s.pruneMutations(ctx, templateIDs, categories, ruleIDs)
+		if err != nil {
+			return nil, err
+		}
+		mutations = append(mutations, deletes...)
+		result.Pruned = len(deletes)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if _, err := s.spanner.client.Apply(ctx, mutations); err != nil {
+		return nil, fmt.Errorf("failed to import config bundle: %w", err)
+	}
+
+	// Other instances pick the changes up on their next refresh or when
+	// cached templates expire
+	s.templates.templates.Purge()
+	if err := s.profiles.Refresh(ctx); err != nil {
+		log.Printf("Warning: failed to reload scoring profiles after import: %v", err)
+	}
+	if err := s.rules.Refresh(ctx); err != nil {
+		log.Printf("Warning: failed to reload merchandising rules after import: %v", err)
+	}
+	return result, nil
+}
+
+// pruneMutations returns deletes for the stored entries that are not being
+// imported
+func (s *ConfigBundleService) pruneMutations(ctx context.Context, templateIDs, categories, ruleIDs map[string]bool) ([]*spanner.Mutation, error) {
+	existing, err := s.Export(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var deletes []*spanner.Mutation
+	for _, template := range existing.QueryTemplates {
+		if !templateIDs[template.ID] {
+			deletes = append(deletes, spanner.Delete("query_templates", spanner.Key{template.ID}))
+		}
+	}
+	for _, profile := range existing.ScoringProfiles {
+		if !categories[profile.Category] {
+			deletes = append(deletes, spanner.Delete("scoring_profiles", spanner.Key{profile.Category}))
+		}
+	}
+	for _, rule := range existing.MerchandisingRules {
+		if !ruleIDs[rule.ID] {
+			deletes = append(deletes, spanner.Delete("merchandising_rules", spanner.Key{rule.ID}))
+		}
+	}
+	return deletes, nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"psearch/serving/internal/models"
+)
+
+// CostRecorder accumulates the downstream cost drivers of a request. Like
+// StageTimings it is nil-safe, so services record unconditionally and only
+// debug requests pay for collecting the numbers.
+type CostRecorder struct {
+	mu       sync.Mutex
+	estimate models.CostEstimate
+}
+
+// NewCostRecorder creates an empty cost recorder
+func NewCostRecorder() *CostRecorder {
+	return &CostRecorder{}
+}
+
+// RecordEmbedding records one embedding call and its billed tokens
+func (r *CostRecorder) RecordEmbedding(tokens int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.estimate.EmbeddingCalls++
+	r.estimate.EmbeddingTokens += tokens
+}
+
+// RecordLLMCall records one generative model call
+func (r *CostRecorder) RecordLLMCall() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.estimate.LLMCalls++
+}
+
+// RecordRerank records the number of records sent to the ranking API
+func (r *CostRecorder) RecordRerank(records int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.estimate.RerankRecords += records
+}
+
+// RecordSpannerQuery records one Spanner query, its retrieval branches and
+// per-branch candidate limit, and the execution statistics Spanner returned
+func (r *CostRecorder) RecordSpannerQuery(branches, candidateLimit int, rowsReturned int64, stats map[string]interface{}) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.estimate.SpannerQueries++
+	r.estimate.RetrievalBranches += branches
+	r.estimate.CandidatesRequested += branches * candidateLimit
+	r.estimate.SpannerRowsReturned += rowsReturned
+	r.estimate.SpannerRowsScanned += queryStat(stats, "rows_scanned")
+	if cpu, ok := stats["cpu_time"]; ok {
+		r.estimate.SpannerCPUTime = fmt.Sprint(cpu)
+	}
+}
+
+// Snapshot returns a copy of the recorded cost drivers
+func (r *CostRecorder) Snapshot() *models.CostEstimate {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	estimate := r.estimate
+	return &estimate
+}
+
+// queryStat parses an integer statistic from Spanner query stats, which are
+// reported as strings
+func queryStat(stats map[string]interface{}, name string) int64 {
+	value, ok := stats[name]
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+type costRecorderKey struct{}
+
+// ContextWithCostRecorder attaches a cost recorder to the context
+func ContextWithCostRecorder(ctx context.Context, r *CostRecorder) context.Context {
+	return context.WithValue(ctx, costRecorderKey{}, r)
+}
+
+// CostRecorderFromContext returns the recorder attached to the context, or nil
+func CostRecorderFromContext(ctx context.Context) *CostRecorder {
+	r, _ := ctx.Value(costRecorderKey{}).(*CostRecorder)
+	return r
+}
@@ -0,0 +1,342 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// currencyCountSQL counts products by stored currency; an empty currency
+// means the product falls back to the catalog currency
+const currencyCountSQL = `SELECT IFNULL(JSON_VALUE(product_data, '$.priceInfo.currencyCode'), '') AS currency_code,
+                     COUNT(*) AS product_count
+              FROM products
+              GROUP BY currency_code`
+
+// currencySampleSQL lists a few products stored in the given currency
+const currencySampleSQL = `SELECT product_id
+              FROM products
+              WHERE IFNULL(JSON_VALUE(product_data, '$.priceInfo.currencyCode'), '') = @currency_code
+              LIMIT @sample_size`
+
+// Data quality issues recorded for a product
+const (
+	QualityIssueMissingImage     = "missing_image"
+	QualityIssueShortTitle       = "short_title"
+	QualityIssueMissingPrice     = "missing_price"
+	QualityIssueMissingEmbedding = "missing_embedding"
+)
+
+// qualityIssueWeights is how much each issue lowers a product's score from
+// 1. Products missing every field score 0.
+var qualityIssueWeights = map[string]float64{
+	QualityIssueMissingImage:     0.3,
+	QualityIssueShortTitle:       0.2,
+	QualityIssueMissingPrice:     0.3,
+	QualityIssueMissingEmbedding: 0.2,
+}
+
+// qualityReportSampleSize is how many low-quality product IDs the report lists
+const qualityReportSampleSize = 20
+
+// DataQualityService reports catalog data problems that degrade search
+type DataQualityService struct {
+	config *config.Config
+	client *spanner.Client
+}
+
+// NewDataQualityService creates a new data quality service
+func NewDataQualityService(cfg *config.Config, spannerSvc *SpannerService) *DataQualityService {
+	return &DataQualityService{
+		config: cfg,
+		client: spannerSvc.client,
+	}
+}
+
+// CurrencyReport finds products whose stored currency differs from the
+// catalog currency, and products with no currency at all
+func (s *DataQualityService) CurrencyReport(ctx context.Context, sampleSize int) (*models.CurrencyReport, error) {
+	// All reads share one snapshot so samples agree with the counts
+	txn := s.client.ReadOnlyTransaction()
+	defer txn.Close()
+
+	iter := txn.Query(ctx, spanner.Statement{SQL: currencyCountSQL})
+	defer iter.Stop()
+
+	report := &models.CurrencyReport{
+		CatalogCurrency: s.config.CatalogCurrencyCode,
+		ByCurrency:      make(map[string]int64),
+	}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through currency counts: %w", err)
+		}
+
+		var currencyCode string
+		var count int64
+		if err := row.Columns(&currencyCode, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan currency count: %v", err)
+		}
+
+		report.TotalProducts += count
+		switch currencyCode {
+		case s.config.CatalogCurrencyCode:
+		case "":
+			report.MissingCurrency = count
+		default:
+			report.Mismatched += count
+			report.ByCurrency[currencyCode] = count
+		}
+	}
+
+	for currencyCode := range report.ByCurrency {
+		sampleIDs, err := s.sampleProducts(ctx, txn, currencyCode, sampleSize)
+		if err != nil {
+			return nil, err
+		}
+		report.MismatchedSampleIDs = append(report.MismatchedSampleIDs, sampleIDs...)
+	}
+	if report.MissingCurrency > 0 {
+		sampleIDs, err := s.sampleProducts(ctx, txn, "", sampleSize)
+		if err != nil {
+			return nil, err
+		}
+		report.MissingSampleIDs = sampleIDs
+	}
+
+	return report, nil
+}
+
+// sampleProducts returns up to sampleSize IDs of products stored in the
+// given currency, or with no currency when it is empty
+func (s *DataQualityService) sampleProducts(ctx context.Context, txn *spanner.ReadOnlyTransaction, currencyCode string, sampleSize int) ([]string, error) {
+	stmt := spanner.Statement{
+		SQL: currencySampleSQL,
+		Params: map[string]interface{}{
+			"currency_code": currencyCode,
+			"sample_size":   int64(sampleSize),
+		},
+	}
+
+	iter := txn.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var productIDs []string
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error sampling products in currency %q: %w", currencyCode, err)
+		}
+		var productID string
+		if err := row.Columns(&productID); err != nil {
+			return nil, fmt.Errorf("failed to scan product ID: %v", err)
+		}
+		productIDs = append(productIDs, productID)
+	}
+	return productIDs, nil
+}
+
+// ScoreProducts computes the quality score of each product and stores it in
+// product_quality. It returns the number of products scored and how many
+// fell below the low-quality threshold. A catalog ID leaves out products of
+// other catalogs.
+func (s *DataQualityService) ScoreProducts(ctx context.Context, catalogID string, productIDs []string) (scored int, lowQuality int, err error) {
+	if len(productIDs) == 0 {
+		return 0, 0, nil
+	}
+
+	params := map[string]interface{}{"product_ids": productIDs}
+	stmt := spanner.Statement{
+		SQL: `SELECT product_id, product_data, embedding IS NOT NULL
+              FROM products
+              WHERE product_id IN UNNEST(@product_ids)` + andClause(catalogClause("catalog_id", catalogID, params)),
+		Params: params,
+	}
+
+	iter := s.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var mutations []*spanner.Mutation
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("error iterating through products to score: %w", err)
+		}
+
+		var productID string
+		var productDataJSON spanner.NullJSON
+		var hasEmbedding bool
+		if err := row.Columns(&productID, &productDataJSON, &hasEmbedding); err != nil {
+			return 0, 0, fmt.Errorf("failed to scan product to score: %v", err)
+		}
+
+		productData, _ := productDataJSON.Value.(map[string]interface{})
+		score, issues := scoreProduct(productData, hasEmbedding, s.config.QualityMinTitleLength)
+		if score < s.config.QualityLowScoreThreshold {
+			lowQuality++
+		}
+		mutations = append(mutations, spanner.InsertOrUpdate("product_quality",
+			[]string{"product_id", "score", "issues", "scored_at"},
+			[]interface{}{productID, score, issues, spanner.CommitTimestamp}))
+	}
+
+	if len(mutations) > 0 {
+		if _, err := s.client.Apply(ctx, mutations); err != nil {
+			return 0, 0, fmt.Errorf("failed to save quality scores: %v", err)
+		}
+	}
+	return len(mutations), lowQuality, nil
+}
+
+// scoreProduct returns a quality score between 0 and 1 and the issues that
+// lowered it
+func scoreProduct(productData map[string]interface{}, hasEmbedding bool, minTitleLength int) (float64, []string) {
+	issues := []string{}
+
+	hasImage := false
+	if images, ok := productData["images"].([]interface{}); ok {
+		for _, img := range images {
+			if imgMap, ok := img.(map[string]interface{}); ok {
+				if uri, _ := imgMap["uri"].(string); uri != "" {
+					hasImage = true
+					break
+				}
+			}
+		}
+	}
+	if !hasImage {
+		issues = append(issues, QualityIssueMissingImage)
+	}
+
+	title, _ := productData["title"].(string)
+	if len([]rune(strings.TrimSpace(title))) < minTitleLength {
+		issues = append(issues, QualityIssueShortTitle)
+	}
+
+	// Prices are stored as strings, as in the Retail API product schema
+	hasPrice := false
+	if priceInfo, ok := productData["priceInfo"].(map[string]interface{}); ok {
+		if price, ok := priceInfo["price"].(string); ok {
+			if value, err := strconv.ParseFloat(price, 64); err == nil && value > 0 {
+				hasPrice = true
+			}
+		}
+	}
+	if !hasPrice {
+		issues = append(issues, QualityIssueMissingPrice)
+	}
+
+	if !hasEmbedding {
+		issues = append(issues, QualityIssueMissingEmbedding)
+	}
+
+	score := 1.0
+	for _, issue := range issues {
+		score -= qualityIssueWeights[issue]
+	}
+	return max(score, 0), issues
+}
+
+// QualityReport aggregates the stored quality scores
+func (s *DataQualityService) QualityReport(ctx context.Context) (*models.DataQualityReport, error) {
+	// All reads share one snapshot so the sections agree with each other
+	txn := s.client.ReadOnlyTransaction()
+	defer txn.Close()
+
+	report := &models.DataQualityReport{
+		LowScoreThreshold: s.config.QualityLowScoreThreshold,
+		Issues:            make(map[string]int64),
+	}
+
+	summary := spanner.Statement{
+		SQL: `SELECT (SELECT COUNT(*) FROM products),
+                     COUNT(*),
+                     IFNULL(AVG(score), 0),
+                     COUNTIF(score < @threshold)
+              FROM product_quality`,
+		Params: map[string]interface{}{"threshold": s.config.QualityLowScoreThreshold},
+	}
+	var totalProducts int64
+	err := txn.Query(ctx, summary).Do(func(row *spanner.Row) error {
+		return row.Columns(&totalProducts, &report.ScoredProducts, &report.AverageScore, &report.LowQuality)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quality summary: %v", err)
+	}
+	report.UnscoredProducts = max(totalProducts-report.ScoredProducts, 0)
+
+	issues := spanner.Statement{
+		SQL: `SELECT issue, COUNT(*)
+              FROM product_quality, UNNEST(issues) AS issue
+              GROUP BY issue`,
+	}
+	err = txn.Query(ctx, issues).Do(func(row *spanner.Row) error {
+		var issue string
+		var count int64
+		if err := row.Columns(&issue, &count); err != nil {
+			return err
+		}
+		report.Issues[issue] = count
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quality issue counts: %v", err)
+	}
+
+	samples := spanner.Statement{
+		SQL: `SELECT product_id
+              FROM product_quality
+              WHERE score < @threshold
+              ORDER BY score
+              LIMIT @sample_size`,
+		Params: map[string]interface{}{
+			"threshold":   s.config.QualityLowScoreThreshold,
+			"sample_size": int64(qualityReportSampleSize),
+		},
+	}
+	err = txn.Query(ctx, samples).Do(func(row *spanner.Row) error {
+		var productID string
+		if err := row.Columns(&productID); err != nil {
+			return err
+		}
+		report.LowQualitySampleIDs = append(report.LowQualitySampleIDs, productID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample low-quality products: %v", err)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"psearch/serving/internal/models"
+)
+
+// DedupeResults drops results that share a canonical URI or GTIN with a
+// result ranked above them, as happens when feeds list an item twice. The
+// kept result gains the sizes and colors of its duplicates. Deduplication
+// keeps the first occurrence, so deduplicating a longer list never changes
+// the order of the shorter list's survivors. results itself is not
+// modified, since it may be shared with the result cache.
+func DedupeResults(results []models.SearchResult) []models.SearchResult {
+	deduped := make([]models.SearchResult, 0, len(results))
+	kept := make(map[string]int)
+	for _, result := range results {
+		keys := dedupeKeys(result)
+		i, duplicate := -1, false
+		for _, key := range keys {
+			if i, duplicate = kept[key]; duplicate {
+				break
+			}
+		}
+		if !duplicate {
+			i = len(deduped)
+			deduped = append(deduped, result)
+		} else {
+			deduped[i] = mergeVariants(deduped[i], result)
+		}
+		// A duplicate by URI may carry a GTIN the kept result lacked
+		for _, key := range keys {
+			if _, ok := kept[key]; !ok {
+				kept[key] = i
+			}
+		}
+	}
+	return deduped
+}
+
+// dedupeKeys returns the identities a result is deduplicated by
+func dedupeKeys(result models.SearchResult) []string {
+	var keys []string
+	if uri := canonicalURI(result.URI); uri != "" {
+		keys = append(keys, "uri:"+uri)
+	}
+	if result.GTIN != "" {
+		keys = append(keys, "gtin:"+result.GTIN)
+	}
+	return keys
+}
+
+// canonicalURI normalizes a product URI so listings of the same page
+// compare equal: the scheme and host are lowercased and the query,
+// fragment and any trailing slash are dropped, since they typically only
+// select a variant
+func canonicalURI(uri string) string {
+	uri = strings.TrimSpace(uri)
+	if uri == "" {
+		return ""
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" {
+		return strings.ToLower(uri)
+	}
+	return strings.ToLower(parsed.Scheme) + "://" + strings.ToLower(parsed.Host) + strings.TrimSuffix(parsed.EscapedPath(), "/")
+}
+
+// mergeVariants returns kept with the sizes and colors of duplicate added.
+// New slices are allocated so kept's cached slices are never modified.
+func mergeVariants(kept, duplicate models.SearchResult) models.SearchResult {
+	kept.Sizes = mergeStrings(kept.Sizes, duplicate.Sizes)
+	if duplicate.ColorInfo != nil {
+		colors := models.ColorInfo{}
+		if kept.ColorInfo != nil {
+			colors = *kept.ColorInfo
+		}
+		colors.Colors = mergeStrings(colors.Colors, duplicate.ColorInfo.Colors)
+		colors.ColorFamilies = mergeStrings(colors.ColorFamilies, duplicate.ColorInfo.ColorFamilies)
+		kept.ColorInfo = &colors
+	}
+	return kept
+}
+
+// mergeStrings returns the values of a followed by those of b not in a
+func mergeStrings(a, b []string) []string {
+	merged := slices.Clone(a)
+	for _, value := range b {
+		if !slices.Contains(merged, value) {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"slices"
+	"strings"
+
+	"psearch/serving/internal/models"
+)
+
+// DiversifyResults reorders results so no brand takes more than
+// maxPerBrand places before every other brand has had the same chance:
+// each brand's first maxPerBrand results keep their relative order, then
+// come the brands' next maxPerBrand, and so on. Results without a brand
+// are never held back. results itself is not modified, since it may be
+// shared with the result cache.
+func DiversifyResults(results []models.SearchResult, maxPerBrand int) []models.SearchResult {
+	if maxPerBrand <= 0 || len(results) == 0 {
+		return results
+	}
+
+	// rounds[i] is how many times result i's brand had used up its places
+	// when the result was reached
+	rounds := make([]int, len(results))
+	seen := make(map[string]int)
+	for i, result := range results {
+		brand := resultBrand(result)
+		if brand == "" {
+			continue
+		}
+		rounds[i] = seen[brand] / maxPerBrand
+		seen[brand]++
+	}
+
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return rounds[a] - rounds[b]
+	})
+
+	diversified := make([]models.SearchResult, len(results))
+	for i, j := range order {
+		diversified[i] = results[j]
+	}
+	return diversified
+}
+
+// resultBrand returns the normalized first brand of a result
+func resultBrand(result models.SearchResult) string {
+	if len(result.Brands) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(result.Brands[0]))
+}
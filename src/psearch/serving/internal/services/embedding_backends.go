@@ -0,0 +1,146 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// instructed prepends EMBEDDING_QUERY_PREFIX or EMBEDDING_DOCUMENT_PREFIX
+// to text, standing in for the Vertex AI task type on backends without
+// one
+func (s *EmbeddingService) instructed(text, taskType string) string {
+	if taskType == "RETRIEVAL_DOCUMENT" {
+		return s.config.EmbeddingDocumentPrefix + text
+	}
+	return s.config.EmbeddingQueryPrefix + text
+}
+
+// predictTEI embeds text with the /embed endpoint of a Text Embeddings
+// Inference server. TEI does not report token counts.
+func (s *EmbeddingService) predictTEI(ctx context.Context, text string) (*embeddingPrediction, error) {
+	request := struct {
+		Inputs   string `json:"inputs"`
+		Truncate bool   `json:"truncate"`
+	}{Inputs: text, Truncate: true}
+
+	var response [][]float32
+	if err := s.postEmbeddingRequest(ctx, s.config.EmbeddingEndpoint+"/embed", request, &response); err != nil {
+		return nil, err
+	}
+	if len(response) == 0 || len(response[0]) == 0 {
+		return nil, fmt.Errorf("no embeddings returned from TEI")
+	}
+	return &embeddingPrediction{values: response[0]}, nil
+}
+
+// predictOpenAI embeds text with the /embeddings endpoint of an
+// OpenAI-compatible API. Dimensions asks models that support it for
+// EMBEDDING_DIMENSION values, as outputDimensionality does on Vertex AI.
+func (s *EmbeddingService) predictOpenAI(ctx context.Context, text string) (*embeddingPrediction, error) {
+	request := struct {
+		Model          string `json:"model"`
+		Input          string `json:"input"`
+		EncodingFormat string `json:"encoding_format"`
+		Dimensions     int    `json:"dimensions,omitempty"`
+	}{Model: s.config.GeminiModelName, Input: text, EncodingFormat: "float"}
+	if s.config.EmbeddingOutputDimensionality {
+		request.Dimensions = s.config.EmbeddingDimension
+	}
+
+	var response struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Usage struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
+	}
+	if err := s.postEmbeddingRequest(ctx, s.config.EmbeddingEndpoint+"/embeddings", request, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) == 0 || len(response.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("no embeddings returned from %s", s.config.EmbeddingEndpoint)
+	}
+	return &embeddingPrediction{values: response.Data[0].Embedding, tokenCount: response.Usage.PromptTokens}, nil
+}
+
+// postEmbeddingRequest posts a JSON request to a tei or openai backend and
+// decodes its response into out. Failed requests return an
+// EmbeddingAPIError, so they are retried like Vertex AI failures.
+func (s *EmbeddingService) postEmbeddingRequest(ctx context.Context, url string, request, out interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create embedding request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.EmbeddingAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.EmbeddingAPIKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute embedding request: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read embedding response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &EmbeddingAPIError{
+			StatusCode: resp.StatusCode,
+			Status:     http.StatusText(resp.StatusCode),
+			Message:    embeddingErrorMessage(responseBody),
+		}
+	}
+	if err := json.Unmarshal(responseBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal embedding response: %v", err)
+	}
+	return nil
+}
+
+// embeddingErrorMessage extracts the message of an error response, which
+// OpenAI-compatible APIs nest in an error object and TEI sends as the
+// error string
+func embeddingErrorMessage(body []byte) string {
+	var nested struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &nested) == nil && nested.Error.Message != "" {
+		return nested.Error.Message
+	}
+	var flat struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &flat) == nil {
+		return flat.Error
+	}
+	return ""
+}
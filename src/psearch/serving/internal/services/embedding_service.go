@@ -20,64 +20,273 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
-	"psearch/serving-go/internal/config"
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/telemetry"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
+// ErrEmbeddingDimension is returned when the model returns embeddings of a
+// dimension other than EMBEDDING_DIMENSION that cannot be truncated to it
+var ErrEmbeddingDimension = errors.New("embedding dimension mismatch")
+
 // EmbeddingService handles the generation of embeddings via REST API
 type EmbeddingService struct {
 	config     *config.Config
 	httpClient *http.Client // Added httpClient
+	// tokens authorizes httpClient's requests; readiness checks fetch
+	// tokens from it directly. It is nil in DEV_MODE, which embeds locally,
+	// and for backends other than Vertex AI.
+	tokens oauth2.TokenSource
+	// cache holds query embeddings keyed by query text
+	cache *cache.Cache[[]float32]
+
+	retryPolicy RetryPolicy
+	breaker     *CircuitBreaker
+
+	// pinned holds precomputed head query embeddings keyed by normalized
+	// query; it is replaced wholesale and never evicted
+	pinnedMu sync.RWMutex
+	pinned   map[string][]float32
 }
 
 // NewEmbeddingService creates a new embedding service using REST
 func NewEmbeddingService(ctx context.Context, cfg *config.Config) (*EmbeddingService, error) {
 	// Create an authenticated HTTP client using Application Default Credentials
 	// Scopes needed for Vertex AI prediction endpoint
-	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create default google client for REST API: %v", err)
+	var tokens oauth2.TokenSource
+	if cfg.EmbeddingProvider == "vertex" && !cfg.DevMode {
+		source, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create default google client for REST API: %v", err)
+		}
+		tokens = newTokenPrefetcher(ctx, source)
 	}
 
 	return &EmbeddingService{
 		config:     cfg,
-		httpClient: client,
+		httpClient: newModelHTTPClient(tokens),
+		tokens:     tokens,
+		cache:      cache.New[[]float32]("embedding", cfg.EmbeddingCacheSize, cfg.EmbeddingCacheTTL),
+		retryPolicy: RetryPolicy{
+			MaxAttempts:    cfg.VertexMaxAttempts,
+			InitialBackoff: cfg.VertexRetryInitialBackoff,
+			MaxBackoff:     cfg.VertexRetryMaxBackoff,
+		},
+		breaker: NewCircuitBreaker("embedding", cfg.CircuitBreakerFailureThreshold, cfg.CircuitBreakerOpenDuration),
 	}, nil
 }
 
+// CheckCredentials verifies that an access token for Vertex AI can be
+// acquired. Tokens are cached until they near expiry, so this is cheap.
+func (s *EmbeddingService) CheckCredentials(ctx context.Context) error {
+	if s.tokens == nil {
+		return ctx.Err()
+	}
+	if _, err := s.tokens.Token(); err != nil {
+		return fmt.Errorf("failed to acquire Vertex AI access token: %w", err)
+	}
+	return ctx.Err()
+}
+
+// UseRemoteCache backs the query embedding cache with a shared remote tier
+func (s *EmbeddingService) UseRemoteCache(remote *cache.Remote) {
+	s.cache.SetRemote(remote)
+}
+
+// SetCacheTTL changes how long embeddings are cached from now on
+func (s *EmbeddingService) SetCacheTTL(ttl time.Duration) {
+	s.cache.SetTTL(ttl, ttl)
+}
+
+// CacheLayers returns the caches owned by the embedding service
+func (s *EmbeddingService) CacheLayers() []cache.Layer {
+	return []cache.Layer{s.cache}
+}
+
+// PinEmbeddings replaces the pinned embeddings, keyed by normalized query
+func (s *EmbeddingService) PinEmbeddings(pinned map[string][]float32) {
+	s.pinnedMu.Lock()
+	defer s.pinnedMu.Unlock()
+	s.pinned = pinned
+}
+
+// PinnedEmbedding returns the pinned embedding for the query, if any
+func (s *EmbeddingService) PinnedEmbedding(text string) ([]float32, bool) {
+	s.pinnedMu.RLock()
+	defer s.pinnedMu.RUnlock()
+	embedding, ok := s.pinned[cache.NormalizeQuery(text)]
+	return embedding, ok
+}
+
 // GenerateEmbedding generates an embedding vector for the provided text using the REST API
-func (s *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+func (s *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) (embedding []float32, err error) {
+	if pinned, ok := s.PinnedEmbedding(text); ok {
+		return pinned, nil
+	}
+	if cached, ok := s.cache.Get(text); ok {
+		return cached, nil
+	}
+
 	startTime := time.Now()
 
-	// Construct the API endpoint URL
-	url := fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1/projects/%s/locations/%s/publishers/google/models/%s:predict",
-		s.config.Region,
-		s.config.ProjectID,
-		s.config.Region,
-		s.config.GeminiModelName, // This needs to be the embedding model ID
+	ctx, span := tracer.Start(ctx, "EmbeddingService.GenerateEmbedding",
+		trace.WithAttributes(
+			attribute.String("embedding.provider", s.config.EmbeddingProvider),
+			attribute.String("embedding.model", s.config.GeminiModelName),
+			attribute.String("search.query_hash", telemetry.HashQuery(text)),
+			attribute.String("search.language", queryLanguage(ctx)),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "embedding generation failed")
+		}
+		span.End()
+		metrics.ObserveSince(metrics.EmbeddingDuration.WithLabelValues(metrics.Outcome(err)), startTime)
+	}()
+
+	if err := s.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	// Retry transient Vertex AI failures; the breaker sees one outcome per call
+	var prediction *embeddingPrediction
+	err = retry(ctx, s.retryPolicy, "embedding", func() error {
+		var predictErr error
+		prediction, predictErr = s.predict(ctx, text, "RETRIEVAL_QUERY")
+		return predictErr
+	})
+	s.breaker.Record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	embedding = prediction.values
+	CostRecorderFromContext(ctx).RecordEmbedding(prediction.tokenCount)
+	s.cache.Set(text, embedding, cache.QueryTag(text))
+	span.SetAttributes(
+		attribute.Int("embedding.dimension", len(embedding)),
+		attribute.Int("embedding.token_count", prediction.tokenCount),
 	)
 
+	// Log the time taken
+	elapsed := time.Since(startTime)
+	log.Printf("Generated embedding via REST in %s (dimension: %d)", elapsed, len(embedding))
+
+	return embedding, nil
+}
+
+// GenerateDocumentEmbedding embeds product text for storage in the
+// products table, using the document task type. Unlike query embeddings,
+// the results are not cached.
+func (s *EmbeddingService) GenerateDocumentEmbedding(ctx context.Context, text string) (embedding []float32, err error) {
+	startTime := time.Now()
+
+	ctx, span := tracer.Start(ctx, "EmbeddingService.GenerateDocumentEmbedding",
+		trace.WithAttributes(
+			attribute.String("embedding.provider", s.config.EmbeddingProvider),
+			attribute.String("embedding.model", s.config.GeminiModelName),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "embedding generation failed")
+		}
+		span.End()
+		metrics.ObserveSince(metrics.EmbeddingDuration.WithLabelValues(metrics.Outcome(err)), startTime)
+	}()
+
+	if err := s.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	var prediction *embeddingPrediction
+	err = retry(ctx, s.retryPolicy, "embedding", func() error {
+		var predictErr error
+		prediction, predictErr = s.predict(ctx, text, "RETRIEVAL_DOCUMENT")
+		return predictErr
+	})
+	s.breaker.Record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("embedding.dimension", len(prediction.values)))
+	return prediction.values, nil
+}
+
+// embeddingPrediction is a single embedding returned by the prediction endpoint
+type embeddingPrediction struct {
+	values     []float32
+	tokenCount int
+}
+
+// predict makes one call to the EMBEDDING_PROVIDER backend with the given
+// task type and checks the dimension of the embedding it returns
+func (s *EmbeddingService) predict(ctx context.Context, text, taskType string) (*embeddingPrediction, error) {
+	var prediction *embeddingPrediction
+	var err error
+	switch s.config.EmbeddingProvider {
+	case "tei":
+		prediction, err = s.predictTEI(ctx, s.instructed(text, taskType))
+	case "openai":
+		prediction, err = s.predictOpenAI(ctx, s.instructed(text, taskType))
+	default:
+		prediction, err = s.predictVertex(ctx, text, taskType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prediction.values, err = s.fitDimension(prediction.values); err != nil {
+		return nil, err
+	}
+	return prediction, nil
+}
+
+// predictVertex makes one call to the Vertex AI prediction endpoint with
+// the given task type, or embeds the text locally in DEV_MODE
+func (s *EmbeddingService) predictVertex(ctx context.Context, text, taskType string) (*embeddingPrediction, error) {
+	if s.config.DevMode {
+		values, tokenCount := localEmbedding(text, s.config.EmbeddingDimension)
+		return &embeddingPrediction{values: values, tokenCount: tokenCount}, nil
+	}
+
+	// Construct the API endpoint URL
+	url := vertexModelURL(s.config, s.config.GeminiModelName, "predict")
+
 	// Construct the request body structure matching the REST API
 	requestPayload := struct {
 		Instances []struct {
 			Content  string `json:"content"`
 			TaskType string `json:"task_type"` // Note: snake_case in REST API
 		} `json:"instances"`
+		Parameters *embeddingParameters `json:"parameters,omitempty"`
 	}{
 		Instances: []struct {
 			Content  string `json:"content"`
 			TaskType string `json:"task_type"`
 		}{
-			{Content: text, TaskType: "RETRIEVAL_QUERY"}, // Use appropriate task type
+			{Content: text, TaskType: taskType},
 		},
 	}
+	if s.config.EmbeddingOutputDimensionality {
+		requestPayload.Parameters = &embeddingParameters{OutputDimensionality: s.config.EmbeddingDimension}
+	}
 
 	// Marshal the request payload to JSON
 	jsonBody, err := json.Marshal(requestPayload)
@@ -97,7 +306,7 @@ func (s *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) (
 	log.Printf("DEBUG: Sending embedding request to %s", url)
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute REST http request: %v", err)
+		return nil, fmt.Errorf("failed to execute REST http request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -119,10 +328,14 @@ func (s *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) (
 			} `json:"error"`
 		}
 		if json.Unmarshal(responseBodyBytes, &apiError) == nil && apiError.Error.Message != "" {
-			return nil, fmt.Errorf("embedding API error: %s (code %d, status %s)", apiError.Error.Message, apiError.Error.Code, apiError.Error.Status)
+			return nil, &EmbeddingAPIError{
+				StatusCode: resp.StatusCode,
+				Status:     apiError.Error.Status,
+				Message:    apiError.Error.Message,
+			}
 		}
 		// Fallback error
-		return nil, fmt.Errorf("embedding API request failed with status %d", resp.StatusCode)
+		return nil, &EmbeddingAPIError{StatusCode: resp.StatusCode}
 	}
 
 	// Define the expected response structure
@@ -150,11 +363,31 @@ func (s *EmbeddingService) GenerateEmbedding(ctx context.Context, text string) (
 		log.Printf("WARN: Embedding response contained no predictions or empty values: %+v", responsePayload)
 		return nil, fmt.Errorf("no embeddings returned from REST API")
 	}
-	embedding := responsePayload.Predictions[0].Embeddings.Values
+	return &embeddingPrediction{
+		values:     responsePayload.Predictions[0].Embeddings.Values,
+		tokenCount: responsePayload.Predictions[0].Embeddings.Statistics.TokenCount,
+	}, nil
+}
 
-	// Log the time taken
-	elapsed := time.Since(startTime)
-	log.Printf("Generated embedding via REST in %s (dimension: %d)", elapsed, len(embedding))
+// embeddingParameters are the prediction request parameters
+type embeddingParameters struct {
+	// OutputDimensionality truncates the embedding server-side, for models
+	// trained with Matryoshka representation learning
+	OutputDimensionality int `json:"outputDimensionality,omitempty"`
+}
 
-	return embedding, nil
+// fitDimension checks an embedding against EMBEDDING_DIMENSION. With
+// EMBEDDING_TRUNCATE, longer embeddings are cut to size and renormalized:
+// Matryoshka models front-load information, so the prefix is itself a
+// usable embedding, but only at unit length for cosine distance.
+func (s *EmbeddingService) fitDimension(values []float32) ([]float32, error) {
+	want := s.config.EmbeddingDimension
+	switch {
+	case len(values) == want:
+		return values, nil
+	case len(values) > want && s.config.EmbeddingTruncate:
+		return normalizeEmbedding(values[:want]), nil
+	default:
+		return nil, fmt.Errorf("%w: %s returned %d dimensions, want %d", ErrEmbeddingDimension, s.config.GeminiModelName, len(values), want)
+	}
 }
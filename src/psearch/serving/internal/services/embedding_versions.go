@@ -0,0 +1,96 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"psearch/serving/internal/config"
+)
+
+// ErrUnknownEmbeddingVersion is returned for searches naming an embedding
+// version the deployment does not serve
+var ErrUnknownEmbeddingVersion = errors.New("unknown embedding version")
+
+// embeddingVersion is a products embedding column and the embedder of the
+// products and queries stored in and searched against it
+type embeddingVersion struct {
+	name     string
+	column   string
+	embedder Embedder
+}
+
+// AddEmbeddingVersion serves an additional embedding version stored in
+// column. It must be called before the service is used.
+func (s *SpannerService) AddEmbeddingVersion(name, column string, embedder Embedder) {
+	s.embeddingVersions = append(s.embeddingVersions, embeddingVersion{name: name, column: column, embedder: embedder})
+}
+
+// RegisterEmbeddingVersions adds the EMBEDDING_VERSIONS to spannerSvc,
+// each with a Vertex AI embedder for its model
+func RegisterEmbeddingVersions(ctx context.Context, cfg *config.Config, spannerSvc *SpannerService) error {
+	for _, version := range cfg.EmbeddingVersions {
+		versionCfg := *cfg
+		versionCfg.GeminiModelName = version.Model
+		versionCfg.EmbeddingDimension = version.Dimension
+		embedder, err := NewEmbeddingService(ctx, &versionCfg)
+		if err != nil {
+			return fmt.Errorf("failed to create the embedder of embedding version %s: %w", version.Name, err)
+		}
+		spannerSvc.AddEmbeddingVersion(version.Name, version.Column, embedder)
+	}
+	return nil
+}
+
+// embeddingVersion returns the named embedding version, or the serving
+// version when name is empty
+func (s *SpannerService) embeddingVersion(name string) (embeddingVersion, error) {
+	if name == "" {
+		name = s.config.ServingEmbeddingVersion
+	}
+	for _, version := range s.embeddingVersions {
+		if version.name == name {
+			return version, nil
+		}
+	}
+	return embeddingVersion{}, fmt.Errorf("%w: %q", ErrUnknownEmbeddingVersion, name)
+}
+
+// documentEmbeddings embeds product text with every embedding version,
+// returning the columns to write and their values. embedded holds the
+// embeddings already generated, by column and text, so transaction
+// retries do not embed the same text again.
+func (s *SpannerService) documentEmbeddings(ctx context.Context, text string, embedded map[string][]float32) ([]string, []interface{}, error) {
+	var columns []string
+	var values []interface{}
+	for _, version := range s.embeddingVersions {
+		key := version.column + "\x00" + text
+		embedding, ok := embedded[key]
+		if !ok {
+			var err error
+			if embedding, err = version.embedder.GenerateDocumentEmbedding(ctx, text); err != nil {
+				return nil, nil, fmt.Errorf("failed to embed product for embedding version %s: %w", version.name, err)
+			}
+			embedded[key] = embedding
+		}
+		columns = append(columns, version.column)
+		values = append(values, embedding)
+	}
+	return columns, values, nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+)
+
+// EmbeddingAPIError is returned when the Vertex AI prediction endpoint, or
+// another EMBEDDING_PROVIDER backend, responds with a non-200 status
+type EmbeddingAPIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *EmbeddingAPIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("embedding API error: %s (code %d, status %s)", e.Message, e.StatusCode, e.Status)
+	}
+	return fmt.Sprintf("embedding API request failed with status %d", e.StatusCode)
+}
+
+// IsRetryable reports whether err is a transient failure that is likely to
+// succeed if the caller retries
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	var apiErr *EmbeddingAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	switch spanner.ErrCode(err) {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// IsDeadlineExceeded reports whether err was caused by a context deadline,
+// either directly or as reported by Spanner
+func IsDeadlineExceeded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || spanner.ErrCode(err) == codes.DeadlineExceeded
+}
+
+// IsNotFound reports whether err is Spanner reporting a missing row or
+// table
+func IsNotFound(err error) bool {
+	return spanner.ErrCode(err) == codes.NotFound
+}
+
+// IsQuotaExceeded reports whether err is a Spanner or Vertex AI quota
+// rejection. Quota errors are also retryable, with backoff.
+func IsQuotaExceeded(err error) bool {
+	var apiErr *EmbeddingAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	return spanner.ErrCode(err) == codes.ResourceExhausted
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"math"
+	"slices"
+
+	"psearch/serving/internal/models"
+)
+
+// JudgedQuery scores one ranked result list against a query's judgment
+// with NDCG, recall and reciprocal rank, all cut off at rank k
+func JudgedQuery(judgment models.Judgment, ranked []string, k int) models.QueryEvaluation {
+	grades := judgmentGrades(judgment)
+	ranked = ranked[:min(len(ranked), k)]
+
+	evaluation := models.QueryEvaluation{Query: judgment.Query}
+	var dcg float64
+	found := 0
+	for i, id := range ranked {
+		grade := grades[id]
+		if grade <= 0 {
+			continue
+		}
+		dcg += gain(grade, i)
+		found++
+		if evaluation.ReciprocalRank == 0 {
+			evaluation.ReciprocalRank = 1 / float64(i+1)
+		}
+	}
+
+	// The ideal ranking lists the relevant products by grade
+	ideal := make([]int, 0, len(grades))
+	for _, grade := range grades {
+		if grade > 0 {
+			ideal = append(ideal, grade)
+		}
+	}
+	slices.SortFunc(ideal, func(a, b int) int { return b - a })
+	var idcg float64
+	for i, grade := range ideal[:min(len(ideal), k)] {
+		idcg += gain(grade, i)
+	}
+
+	if idcg > 0 {
+		evaluation.NDCG = dcg / idcg
+	}
+	if len(ideal) > 0 {
+		evaluation.Recall = float64(found) / float64(len(ideal))
+	}
+	return evaluation
+}
+
+// SummarizeEvaluation averages the metrics of a configuration's queries
+func SummarizeEvaluation(name string, queries []models.QueryEvaluation) models.ConfigEvaluation {
+	summary := models.ConfigEvaluation{Name: name, Queries: queries}
+	if len(queries) == 0 {
+		return summary
+	}
+	for _, query := range queries {
+		summary.NDCG += query.NDCG
+		summary.Recall += query.Recall
+		summary.MRR += query.ReciprocalRank
+		if query.Error != "" {
+			summary.Failed++
+		}
+	}
+	n := float64(len(queries))
+	summary.NDCG /= n
+	summary.Recall /= n
+	summary.MRR /= n
+	return summary
+}
+
+// judgmentGrades returns the grade of each product judged for a query.
+// Products listed as relevant without a grade have grade 1.
+func judgmentGrades(judgment models.Judgment) map[string]int {
+	grades := make(map[string]int, len(judgment.Relevant)+len(judgment.Grades))
+	for _, id := range judgment.Relevant {
+		grades[id] = 1
+	}
+	for id, grade := range judgment.Grades {
+		grades[id] = grade
+	}
+	return grades
+}
+
+// gain is the discounted gain of a product of the given grade at a
+// 0-based rank, with exponential gain so highly relevant products count
+// for more
+func gain(grade, rank int) float64 {
+	return (math.Pow(2, float64(grade)) - 1) / math.Log2(float64(rank+2))
+}
@@ -0,0 +1,380 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// ErrExperimentNotFound is returned when an experiment does not exist
+var ErrExperimentNotFound = errors.New("experiment not found")
+
+// ErrInvalidExperiment is wrapped by errors in an experiment definition
+var ErrInvalidExperiment = errors.New("invalid experiment")
+
+// ExperimentService assigns searches to the arms of ranking experiments.
+// Shoppers are assigned by hashing their user ID, or their session ID when
+// anonymous, so they see the same arm on every search. Experiments are
+// consulted on every search, so all of them are kept in memory and
+// reloaded on an interval.
+type ExperimentService struct {
+	config  *config.Config
+	spanner *SpannerService
+
+	mu sync.RWMutex
+	// enabled holds the enabled experiments, ordered by ID
+	enabled []models.Experiment
+}
+
+// NewExperimentService creates a new experiment service
+func NewExperimentService(cfg *config.Config, spannerSvc *SpannerService) *ExperimentService {
+	return &ExperimentService{
+		config:  cfg,
+		spanner: spannerSvc,
+	}
+}
+
+// Run loads the experiments at startup and on every refresh interval until
+// ctx is done
+func (s *ExperimentService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ExperimentRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("Warning: could not load experiments: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh replaces the in-memory experiments with the stored ones
+func (s *ExperimentService) Refresh(ctx context.Context) error {
+	stored, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	enabled := slices.DeleteFunc(stored, func(e models.Experiment) bool { return !e.Enabled })
+
+	s.mu.Lock()
+	s.enabled = enabled
+	s.mu.Unlock()
+	return nil
+}
+
+// Assign returns the experiment arm of the shopper identified by userID or,
+// without one, sessionID. Shoppers are split evenly between concurrently
+// enabled experiments, so each search is in at most one of them. It
+// reports false when neither ID is set or no experiment is enabled.
+func (s *ExperimentService) Assign(userID, sessionID string) (models.ExperimentAssignment, models.ExperimentArm, bool) {
+	unit := userID
+	if unit == "" {
+		unit = sessionID
+	}
+	if unit == "" {
+		return models.ExperimentAssignment{}, models.ExperimentArm{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.enabled) == 0 {
+		return models.ExperimentAssignment{}, models.ExperimentArm{}, false
+	}
+	experiment := s.enabled[assignmentHash(unit)%uint64(len(s.enabled))]
+
+	// Arms are drawn with a per-experiment hash, so a new experiment does
+	// not inherit the split of the previous one
+	total := 0
+	for _, arm := range experiment.Arms {
+		total += arm.Weight
+	}
+	bucket := int(assignmentHash(experiment.ID+"/"+unit) % uint64(total))
+	for _, arm := range experiment.Arms {
+		if bucket < arm.Weight {
+			return models.ExperimentAssignment{ID: experiment.ID, Arm: arm.Name}, arm, true
+		}
+		bucket -= arm.Weight
+	}
+	// Unreachable: bucket is below the total weight
+	return models.ExperimentAssignment{}, models.ExperimentArm{}, false
+}
+
+// assignmentHash hashes an assignment unit. Sequential IDs must spread
+// evenly over every bit, which rules out FNV.
+func assignmentHash(unit string) uint64 {
+	sum := sha256.Sum256([]byte(unit))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// Put validates and creates or replaces the experiment with the given ID.
+// Changing the arms of a running experiment reassigns shoppers, so arms
+// should be fixed while results are collected.
+func (s *ExperimentService) Put(ctx context.Context, id string, req models.ExperimentRequest) (*models.Experiment, error) {
+	experiment, mutation, err := prepareExperiment(s.config, id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	commitTimestamp, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save experiment: %w", err)
+	}
+	experiment.UpdatedAt = commitTimestamp
+
+	s.mu.Lock()
+	s.enabled = removeExperiment(s.enabled, id)
+	if experiment.Enabled {
+		s.enabled = append(s.enabled, experiment)
+		slices.SortFunc(s.enabled, func(a, b models.Experiment) int { return strings.Compare(a.ID, b.ID) })
+	}
+	s.mu.Unlock()
+
+	return &experiment, nil
+}
+
+// prepareExperiment validates the experiment and returns the mutation that
+// stores it under id
+func prepareExperiment(cfg *config.Config, id string, req models.ExperimentRequest) (models.Experiment, *spanner.Mutation, error) {
+	if !templateIDPattern.MatchString(id) {
+		return models.Experiment{}, nil, fmt.Errorf("%w: id must be 1-64 letters, digits, '_' or '-'", ErrInvalidExperiment)
+	}
+	if len(req.Arms) < 2 {
+		return models.Experiment{}, nil, fmt.Errorf("%w: at least two arms are required", ErrInvalidExperiment)
+	}
+
+	names := make(map[string]bool, len(req.Arms))
+	for _, arm := range req.Arms {
+		switch {
+		case !templateIDPattern.MatchString(arm.Name):
+			return models.Experiment{}, nil, fmt.Errorf("%w: arm names must be 1-64 letters, digits, '_' or '-'", ErrInvalidExperiment)
+		case names[arm.Name]:
+			return models.Experiment{}, nil, fmt.Errorf("%w: arm %q is defined twice", ErrInvalidExperiment, arm.Name)
+		case arm.Weight < 1:
+			return models.Experiment{}, nil, fmt.Errorf("%w: arm %q needs a positive weight", ErrInvalidExperiment, arm.Name)
+		case arm.Alpha != nil && (*arm.Alpha < 0 || *arm.Alpha > 1):
+			return models.Experiment{}, nil, fmt.Errorf("%w: arm %q: alpha must be between 0.0 and 1.0", ErrInvalidExperiment, arm.Name)
+		case arm.RRFK != nil && *arm.RRFK < 1:
+			return models.Experiment{}, nil, fmt.Errorf("%w: arm %q: rrf_k must be positive", ErrInvalidExperiment, arm.Name)
+		}
+		if arm.EmbeddingVersion != nil {
+			if _, ok := cfg.EmbeddingVersion(*arm.EmbeddingVersion); !ok {
+				return models.Experiment{}, nil, fmt.Errorf("%w: arm %q: unknown embedding version %q", ErrInvalidExperiment, arm.Name, *arm.EmbeddingVersion)
+			}
+		}
+		names[arm.Name] = true
+	}
+
+	experiment := models.Experiment{
+		ID:          id,
+		Description: req.Description,
+		Enabled:     req.Enabled,
+		Arms:        req.Arms,
+	}
+	mutation := spanner.InsertOrUpdateMap("experiments", map[string]interface{}{
+		"experiment_id": id,
+		"description":   spanner.NullString{StringVal: req.Description, Valid: req.Description != ""},
+		"enabled":       req.Enabled,
+		"arms":          spanner.NullJSON{Value: req.Arms, Valid: true},
+		"updated_at":    spanner.CommitTimestamp,
+	})
+	return experiment, mutation, nil
+}
+
+// removeExperiment returns experiments without the one with the given ID.
+// It does not modify experiments, which concurrent readers may hold.
+func removeExperiment(experiments []models.Experiment, id string) []models.Experiment {
+	kept := make([]models.Experiment, 0, len(experiments))
+	for _, experiment := range experiments {
+		if experiment.ID != id {
+			kept = append(kept, experiment)
+		}
+	}
+	return kept
+}
+
+// Get returns a single experiment
+func (s *ExperimentService) Get(ctx context.Context, id string) (*models.Experiment, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT experiment_id, description, enabled, arms, updated_at
+              FROM experiments
+              WHERE experiment_id = @id`,
+		Params: map[string]interface{}{"id": id},
+	}
+	experiments, err := s.query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(experiments) == 0 {
+		return nil, ErrExperimentNotFound
+	}
+	return &experiments[0], nil
+}
+
+// List returns all experiments
+func (s *ExperimentService) List(ctx context.Context) ([]models.Experiment, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT experiment_id, description, enabled, arms, updated_at
+              FROM experiments
+              ORDER BY experiment_id`,
+	}
+	return s.query(ctx, stmt)
+}
+
+// Delete removes an experiment. Its recorded events are kept.
+func (s *ExperimentService) Delete(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+
+	mutation := spanner.Delete("experiments", spanner.Key{id})
+	if _, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation}); err != nil {
+		return fmt.Errorf("failed to delete experiment: %w", err)
+	}
+
+	s.mu.Lock()
+	s.enabled = removeExperiment(s.enabled, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// query runs an experiment listing statement
+func (s *ExperimentService) query(ctx context.Context, stmt spanner.Statement) ([]models.Experiment, error) {
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var experiments []models.Experiment
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through experiments: %w", err)
+		}
+
+		var experiment models.Experiment
+		var description spanner.NullString
+		var armsJSON spanner.NullJSON
+		if err := row.Columns(&experiment.ID, &description, &experiment.Enabled, &armsJSON, &experiment.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan experiment: %v", err)
+		}
+		experiment.Description = description.StringVal
+		if err := decodeJSONColumn(armsJSON, &experiment.Arms); err != nil {
+			return nil, fmt.Errorf("failed to decode arms of experiment %s: %v", experiment.ID, err)
+		}
+
+		experiments = append(experiments, experiment)
+	}
+	return experiments, nil
+}
+
+// Results counts the search events attributed to each arm of an
+// experiment, from since on when it is not zero. Arms that were removed
+// from the experiment are listed after its current ones.
+func (s *ExperimentService) Results(ctx context.Context, id string, since time.Time) (*models.ExperimentResults, error) {
+	experiment, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := spanner.Statement{
+		SQL: `SELECT experiment_arm, event_type, COUNT(*)
+              FROM search_events@{FORCE_INDEX=search_events_by_experiment}
+              WHERE experiment_id = @id AND occurred_at >= @since
+              GROUP BY experiment_arm, event_type`,
+		Params: map[string]interface{}{"id": id, "since": since},
+	}
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	counts := make(map[string]*models.ExperimentArmResults)
+	arms := make([]*models.ExperimentArmResults, 0, len(experiment.Arms))
+	for _, arm := range experiment.Arms {
+		counts[arm.Name] = &models.ExperimentArmResults{Arm: arm.Name}
+		arms = append(arms, counts[arm.Name])
+	}
+	var removed []*models.ExperimentArmResults
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through experiment events: %w", err)
+		}
+
+		var arm spanner.NullString
+		var eventType string
+		var count int64
+		if err := row.Columns(&arm, &eventType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan experiment events: %v", err)
+		}
+		result, ok := counts[arm.StringVal]
+		if !ok {
+			result = &models.ExperimentArmResults{Arm: arm.StringVal}
+			counts[arm.StringVal] = result
+			removed = append(removed, result)
+		}
+		switch models.SearchEventType(eventType) {
+		case models.SearchEventImpression:
+			result.Impressions += count
+		case models.SearchEventClick:
+			result.Clicks += count
+		case models.SearchEventAddToCart:
+			result.AddToCarts += count
+		case models.SearchEventPurchase:
+			result.Purchases += count
+		}
+	}
+	slices.SortFunc(removed, func(a, b *models.ExperimentArmResults) int { return strings.Compare(a.Arm, b.Arm) })
+
+	results := &models.ExperimentResults{ID: id, Arms: make([]models.ExperimentArmResults, 0, len(counts))}
+	if !since.IsZero() {
+		results.Since = &since
+	}
+	for _, arm := range append(arms, removed...) {
+		if arm.Impressions > 0 {
+			arm.ClickThroughRate = float64(arm.Clicks) / float64(arm.Impressions)
+		}
+		if arm.Clicks > 0 {
+			arm.ConversionRate = float64(arm.Purchases) / float64(arm.Clicks)
+		}
+		results.Arms = append(results.Arms, *arm)
+	}
+	return results, nil
+}
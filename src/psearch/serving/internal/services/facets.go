@@ -0,0 +1,113 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"psearch/serving/internal/models"
+)
+
+// facetCounts accumulates one attribute's facet over the results
+type facetCounts struct {
+	key      string
+	count    int
+	values   map[string]int
+	min, max *float64
+}
+
+// ComputeFacets derives facets from the attributes the results mark
+// indexable, so new attributes become facets without configuration.
+// Attributes held by the most results come first, up to maxFacets; each
+// lists its maxValues most common values held by at least minCount
+// results. Ties are broken by name so facets are stable across pages.
+func ComputeFacets(results []models.SearchResult, maxFacets, maxValues, minCount int) []models.Facet {
+	byKey := make(map[string]*facetCounts)
+	for _, result := range results {
+		// A product listing a value twice still counts once
+		seen := make(map[string]bool)
+		for _, attr := range result.Attributes {
+			if !isIndexable(attr.Value) || attr.Key == "" {
+				continue
+			}
+			counts, ok := byKey[attr.Key]
+			if !ok {
+				counts = &facetCounts{key: attr.Key, values: make(map[string]int)}
+				byKey[attr.Key] = counts
+			}
+			held := false
+			for _, value := range attr.Value.Text {
+				value = strings.TrimSpace(value)
+				if value == "" || seen[attr.Key+"\x00"+value] {
+					continue
+				}
+				seen[attr.Key+"\x00"+value] = true
+				counts.values[value]++
+				held = true
+			}
+			for _, n := range attr.Value.Numbers {
+				n := n
+				if counts.min == nil || n < *counts.min {
+					counts.min = &n
+				}
+				if counts.max == nil || n > *counts.max {
+					counts.max = &n
+				}
+				held = true
+			}
+			if held && !seen[attr.Key] {
+				seen[attr.Key] = true
+				counts.count++
+			}
+		}
+	}
+
+	var facets []models.Facet
+	for _, counts := range byKey {
+		facet := models.Facet{Key: counts.key, Count: counts.count, Min: counts.min, Max: counts.max}
+		for value, count := range counts.values {
+			if count >= minCount {
+				facet.Values = append(facet.Values, models.FacetValue{Value: value, Count: count})
+			}
+		}
+		if len(facet.Values) == 0 && facet.Min == nil {
+			continue
+		}
+		slices.SortFunc(facet.Values, func(a, b models.FacetValue) int {
+			return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Value, b.Value))
+		})
+		if len(facet.Values) > maxValues {
+			facet.Values = facet.Values[:maxValues]
+		}
+		facets = append(facets, facet)
+	}
+	slices.SortFunc(facets, func(a, b models.Facet) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Key, b.Key))
+	})
+	if len(facets) > maxFacets {
+		facets = facets[:maxFacets]
+	}
+	return facets
+}
+
+// isIndexable reports whether product_data marks the attribute value
+// indexable="true"
+func isIndexable(value models.AttributeValue) bool {
+	return value.Indexable != nil && strings.EqualFold(strings.TrimSpace(*value.Indexable), "true")
+}
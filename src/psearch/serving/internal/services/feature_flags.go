@@ -0,0 +1,71 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"psearch/serving/internal/config"
+)
+
+// ErrInvalidFeatureFlags is wrapped by errors in a request's feature flag
+// overrides
+var ErrInvalidFeatureFlags = errors.New("invalid feature flags")
+
+// FeatureFlags resolves the feature flags a search runs with. The states
+// come from FEATURE_FLAGS, then the runtime config, which is persisted in
+// Spanner, then the request's own overrides.
+type FeatureFlags struct {
+	settings func() *config.Config
+}
+
+// NewFeatureFlags creates feature flags reading their configured states
+// from the configuration settings returns
+func NewFeatureFlags(settings func() *config.Config) *FeatureFlags {
+	return &FeatureFlags{settings: settings}
+}
+
+// FlagSet holds the state of every feature flag for one search
+type FlagSet map[string]bool
+
+// Enabled reports whether the named flag is on
+func (s FlagSet) Enabled(name string) bool {
+	return s[name]
+}
+
+// Resolve returns the flag states for a search with the given overrides
+func (f *FeatureFlags) Resolve(overrides map[string]bool) (FlagSet, error) {
+	settings := f.settings()
+	if len(overrides) == 0 {
+		return FlagSet(settings.FeatureFlags), nil
+	}
+	if !settings.FeatureFlagOverridesEnabled {
+		return nil, fmt.Errorf("%w: feature flag overrides are not enabled in this deployment", ErrInvalidFeatureFlags)
+	}
+
+	flags := maps.Clone(settings.FeatureFlags)
+	for name, enabled := range overrides {
+		if _, ok := flags[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown feature flag %q, expected one of %s", ErrInvalidFeatureFlags, name, strings.Join(config.FeatureFlagNames(), ", "))
+		}
+		flags[name] = enabled
+	}
+	return FlagSet(flags), nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"fmt"
+
+	"psearch/serving/internal/config"
+)
+
+// ftsColumnDDL defines the TOKENLIST column of each FTS field. Columns are
+// generated from the product data the ingestion pipeline already writes, so
+// enabling a field needs no re-ingestion.
+var ftsColumnDDL = map[string]string{
+	"title":       "title_tokens TOKENLIST AS (TOKENIZE_FULLTEXT(title)) HIDDEN",
+	"description": "description_tokens TOKENLIST AS (TOKENIZE_FULLTEXT(JSON_VALUE(product_data, '$.description'))) HIDDEN",
+	"brands":      "brand_tokens TOKENLIST AS (TOKENIZE_FULLTEXT(JSON_VALUE_ARRAY(product_data, '$.brands'))) HIDDEN",
+	"attributes":  "attribute_tokens TOKENLIST AS (TOKENIZE_FULLTEXT(TO_JSON_STRING(JSON_QUERY(product_data, '$.attributes')))) HIDDEN",
+}
+
+// ftsSearchIndex is the search index holding the token columns. A query
+// searching several columns needs them all in one index.
+const ftsSearchIndex = "products_by_title"
+
+// FTSSchemaDDL returns the statements adding the token columns of fields to
+// the products table and its search index. title_tokens is part of the base
+// schema and needs none.
+func FTSSchemaDDL(fields []config.FTSField) []string {
+	var ddl []string
+	for _, field := range fields {
+		if field.Name == "title" {
+			continue
+		}
+		ddl = append(ddl,
+			"ALTER TABLE products ADD COLUMN "+ftsColumnDDL[field.Name],
+			fmt.Sprintf("ALTER SEARCH INDEX %s ADD COLUMN %s", ftsSearchIndex, ftsColumns[field.Name]),
+		)
+	}
+	return ddl
+}
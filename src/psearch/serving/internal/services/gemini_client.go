@@ -0,0 +1,121 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"psearch/serving/internal/config"
+)
+
+// GeminiClient calls the Vertex AI generateContent endpoint for structured
+// (JSON) generation
+type GeminiClient struct {
+	config     *config.Config
+	httpClient *http.Client
+}
+
+// NewGeminiClient creates a new Gemini client using REST
+func NewGeminiClient(ctx context.Context, cfg *config.Config) (*GeminiClient, error) {
+	client, err := googleClient(ctx, cfg, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create default google client for Gemini: %v", err)
+	}
+
+	return &GeminiClient{
+		config:     cfg,
+		httpClient: client,
+	}, nil
+}
+
+// GenerateJSON sends the prompt to the model and unmarshals the response,
+// constrained by the response schema, into out
+func (c *GeminiClient) GenerateJSON(ctx context.Context, model, prompt string, schema map[string]interface{}, out interface{}) error {
+	url := vertexModelURL(c.config, model, "generateContent")
+
+	type part struct {
+		Text string `json:"text"`
+	}
+	type content struct {
+		Role  string `json:"role"`
+		Parts []part `json:"parts"`
+	}
+	requestPayload := struct {
+		Contents         []content              `json:"contents"`
+		GenerationConfig map[string]interface{} `json:"generationConfig"`
+	}{
+		Contents: []content{{Role: "user", Parts: []part{{Text: prompt}}}},
+		GenerationConfig: map[string]interface{}{
+			"temperature":      0,
+			"responseMimeType": "application/json",
+			"responseSchema":   schema,
+		},
+	}
+
+	jsonBody, err := json.Marshal(requestPayload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal generateContent request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create generateContent request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	CostRecorderFromContext(ctx).RecordLLMCall()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute generateContent request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read generateContent response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("ERROR: generateContent request to %s failed with status %d: %s", model, resp.StatusCode, string(responseBodyBytes))
+		return fmt.Errorf("generateContent returned status %d", resp.StatusCode)
+	}
+
+	var responsePayload struct {
+		Candidates []struct {
+			Content struct {
+				Parts []part `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+	}
+	if err := json.Unmarshal(responseBodyBytes, &responsePayload); err != nil {
+		return fmt.Errorf("failed to unmarshal generateContent response: %v", err)
+	}
+	if len(responsePayload.Candidates) == 0 || len(responsePayload.Candidates[0].Content.Parts) == 0 {
+		return fmt.Errorf("no candidates returned from generateContent")
+	}
+
+	if err := json.Unmarshal([]byte(responsePayload.Candidates[0].Content.Parts[0].Text), out); err != nil {
+		return fmt.Errorf("failed to parse generated JSON: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// HeadQueryPrecomputer keeps embeddings for the most frequent queries pinned
+// in memory so head traffic never waits on Vertex AI. The head queries come
+// from the head_queries table maintained by the analytics pipeline.
+type HeadQueryPrecomputer struct {
+	config     *config.Config
+	spanner    *SpannerService
+	embeddings *EmbeddingService
+	trigger    chan struct{}
+}
+
+// NewHeadQueryPrecomputer creates a new head query precomputer
+func NewHeadQueryPrecomputer(cfg *config.Config, spannerSvc *SpannerService, embeddings *EmbeddingService) *HeadQueryPrecomputer {
+	return &HeadQueryPrecomputer{
+		config:     cfg,
+		spanner:    spannerSvc,
+		embeddings: embeddings,
+		trigger:    make(chan struct{}, 1),
+	}
+}
+
+// Run refreshes the pinned embeddings at startup, on every refresh interval
+// and whenever Trigger is called, until ctx is done
+func (p *HeadQueryPrecomputer) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.config.HeadQueryRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		p.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.trigger:
+		}
+	}
+}
+
+// Trigger requests a refresh, for example after the catalog changed. It
+// never blocks; requests made while one is pending are coalesced.
+func (p *HeadQueryPrecomputer) Trigger() {
+	if p == nil {
+		return
+	}
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// refresh reloads the head queries, embeds the ones not pinned yet and, if
+// configured, re-runs their default searches to warm the result cache
+func (p *HeadQueryPrecomputer) refresh(ctx context.Context) {
+	startTime := time.Now()
+
+	queries, err := p.spanner.LoadHeadQueries(ctx, p.config.HeadQueryTopK)
+	if err != nil {
+		log.Printf("Warning: could not load head queries: %v", err)
+		return
+	}
+
+	// Embeddings depend only on the query text, so existing pins are reused
+	pinned := make(map[string][]float32, len(queries))
+	var missing []string
+	for _, query := range queries {
+		if embedding, ok := p.embeddings.PinnedEmbedding(query); ok {
+			pinned[cache.NormalizeQuery(query)] = embedding
+		} else {
+			missing = append(missing, query)
+		}
+	}
+
+	var mu sync.Mutex
+	failed := 0
+	p.forEach(ctx, missing, func(query string) {
+		embedding, err := p.embeddings.GenerateEmbedding(ctx, query)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed++
+			return
+		}
+		pinned[cache.NormalizeQuery(query)] = embedding
+	})
+	p.embeddings.PinEmbeddings(pinned)
+
+	if p.config.HeadQueryPrecomputeResults {
+		refreshCtx := context.WithValue(ctx, cacheRefreshKey{}, true)
+		p.forEach(ctx, queries, func(query string) {
+			if _, err := p.spanner.HybridSearch(refreshCtx, defaultSearchOptions(p.config, query)); err != nil {
+				log.Printf("Warning: could not precompute results for head query: %v", err)
+			}
+		})
+	}
+
+	log.Printf("Pinned embeddings for %d head queries (%d new, %d failed) in %s",
+		len(pinned), len(missing)-failed, failed, time.Since(startTime))
+}
+
+// forEach runs fn for each query with bounded concurrency
+func (p *HeadQueryPrecomputer) forEach(ctx context.Context, queries []string, fn func(query string)) {
+	sem := make(chan struct{}, max(p.config.HeadQueryConcurrency, 1))
+	var wg sync.WaitGroup
+	for _, query := range queries {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(query string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(query)
+		}(query)
+	}
+	wg.Wait()
+}
+
+// defaultSearchOptions returns the options of a search request that only
+// sets the query, so precomputed results match the result cache key of such
+// requests
+func defaultSearchOptions(cfg *config.Config, query string) SearchOptions {
+	return SearchOptions{
+		Query:     query,
+		Limit:     cfg.DefaultLimit,
+		MinScore:  cfg.MinScoreValue,
+		Alpha:     cfg.DefaultAlpha,
+		Mode:      models.SearchModeHybrid,
+		Staleness: cfg.SpannerStaleness,
+		CatalogID: cfg.DefaultCatalogID,
+	}
+}
+
+// LoadHeadQueries returns the most searched queries, most frequent first
+func (s *SpannerService) LoadHeadQueries(ctx context.Context, limit int) ([]string, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT query
+              FROM head_queries
+              ORDER BY search_count DESC
+              LIMIT @limit`,
+		Params: map[string]interface{}{"limit": limit},
+	}
+
+	iter := s.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var queries []string
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through head queries: %w", err)
+		}
+		var query string
+		if err := row.Columns(&query); err != nil {
+			return nil, fmt.Errorf("failed to scan head query: %v", err)
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+)
+
+// hedgeWindow is how many recent search query latencies the hedge delay is
+// computed from
+const hedgeWindow = 1000
+
+// hedgeMinSamples is how many latencies must be observed before queries are
+// hedged, so cold instances do not hedge on a noisy estimate. The delay is
+// recomputed every hedgeMinSamples observations.
+const hedgeMinSamples = 100
+
+// searchHedger tracks recent search query latencies and races queries
+// slower than their percentile with a second attempt
+type searchHedger struct {
+	percentile float64
+	minDelay   time.Duration
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	// next is the ring buffer position of the next observation
+	next     int
+	observed int
+	delay    time.Duration
+}
+
+func newSearchHedger(cfg *config.Config) *searchHedger {
+	return &searchHedger{
+		percentile: cfg.HedgePercentile,
+		minDelay:   cfg.HedgeMinDelay,
+		latencies:  make([]time.Duration, 0, hedgeWindow),
+	}
+}
+
+// observe records the latency of a search query
+func (h *searchHedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeWindow {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.next] = latency
+		h.next = (h.next + 1) % hedgeWindow
+	}
+	h.observed++
+	if h.observed%hedgeMinSamples == 0 {
+		h.delay = max(percentile(h.latencies, h.percentile), h.minDelay)
+	}
+}
+
+// hedgeDelay returns how long a query may run before it is hedged, and
+// false until enough latencies have been observed
+func (h *searchHedger) hedgeDelay() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay, h.delay > 0
+}
+
+// searchAttempt is the outcome of one execution of a search statement
+type searchAttempt struct {
+	rows  []searchRow
+	txn   *spanner.ReadOnlyTransaction
+	err   error
+	hedge bool
+}
+
+// hedgedSearchRows runs a statement built by buildSearchSQL in a single
+// read. With hedging enabled, a read still running after the hedge delay is
+// raced by the same statement reading data up to HedgeStaleness old, and
+// the first attempt to succeed is returned along with its transaction; the
+// other is cancelled. Reads pinned to a timestamp are hedged at the same
+// timestamp.
+func (s *SpannerService) hedgedSearchRows(ctx context.Context, opts SearchOptions, stmt spanner.Statement, branches, candidateLimit int) ([]searchRow, *spanner.ReadOnlyTransaction, error) {
+	attempt := func(ctx context.Context, txn *spanner.ReadOnlyTransaction) searchAttempt {
+		rows, err := s.searchRows(ctx, txn, stmt, branches, candidateLimit)
+		return searchAttempt{rows: rows, txn: txn, err: err}
+	}
+	primary := s.singleRead(opts.ReadTimestamp, opts.Staleness)
+
+	delay, ok := time.Duration(0), false
+	if s.hedger != nil {
+		delay, ok = s.hedger.hedgeDelay()
+	}
+	start := time.Now()
+	if !ok {
+		result := attempt(ctx, primary)
+		if result.err == nil && s.hedger != nil {
+			s.hedger.observe(time.Since(start))
+		}
+		return result.rows, result.txn, result.err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Buffered so the cancelled attempt never blocks
+	results := make(chan searchAttempt, 2)
+	go func() { results <- attempt(ctx, primary) }()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		if result.err == nil {
+			s.hedger.observe(time.Since(start))
+		}
+		return result.rows, result.txn, result.err
+	case <-timer.C:
+	}
+
+	hedge := s.singleRead(opts.ReadTimestamp, max(opts.Staleness, s.config.HedgeStaleness))
+	go func() {
+		result := attempt(ctx, hedge)
+		result.hedge = true
+		results <- result
+	}()
+
+	// Serve the first success, or the primary's error if both fail
+	result := <-results
+	if result.err != nil {
+		other := <-results
+		if other.err == nil || result.hedge {
+			result = other
+		}
+	}
+	if result.err != nil {
+		return nil, nil, result.err
+	}
+
+	// When the hedge wins, the primary took at least this long
+	s.hedger.observe(time.Since(start))
+	winner := "primary"
+	if result.hedge {
+		winner = "hedge"
+	}
+	metrics.HedgedSearches.WithLabelValues(winner).Inc()
+	return result.rows, result.txn, nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"cloud.google.com/go/spanner"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/telemetry"
+)
+
+// identifierSQL looks products up by primary key or by the gtin column
+// generated from product_data, both of which are indexed
+const identifierSQL = `SELECT product_id, product_data
+		FROM products
+		WHERE (product_id IN UNNEST(@identifiers) OR gtin IN UNNEST(@identifiers)) AND deleted_at IS NULL%s
+		ORDER BY product_id
+		LIMIT @limit`
+
+// IsIdentifierQuery reports whether query looks like a SKU, part number or
+// GTIN rather than words: a single token matching pattern that contains a
+// digit. Embeddings and full-text scoring handle such tokens poorly.
+func IsIdentifierQuery(query string, pattern *regexp.Regexp) bool {
+	query = strings.TrimSpace(query)
+	if pattern == nil || !pattern.MatchString(query) {
+		return false
+	}
+	return strings.IndexFunc(query, unicode.IsDigit) >= 0
+}
+
+// identifierCandidates returns the spellings of query to look up. Catalogs
+// usually store identifiers upper-case while shoppers type them in either.
+func identifierCandidates(query string) []string {
+	query = strings.TrimSpace(query)
+	if upper := strings.ToUpper(query); upper != query {
+		return []string{query, upper}
+	}
+	return []string{query}
+}
+
+// IdentifierSearch looks the query up as an exact product ID or GTIN. It
+// needs no embedding, so it is cheap enough to try before HybridSearch for
+// SKU-like queries. It returns every match up to the end of the requested
+// page, so callers paginate and later pages stay exact matches too. An
+// empty result means the caller should fall back.
+func (s *SpannerService) IdentifierSearch(ctx context.Context, opts SearchOptions) (output *SearchOutput, err error) {
+	startTime := time.Now()
+
+	ctx, span := tracer.Start(ctx, "SpannerService.IdentifierSearch",
+		trace.WithAttributes(
+			attribute.String("search.query_hash", telemetry.HashQuery(opts.Query)),
+			attribute.Int("search.limit", opts.Limit),
+			attribute.Int("search.offset", opts.Offset),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "identifier lookup failed")
+		}
+		span.End()
+	}()
+
+	params := map[string]interface{}{
+		"identifiers": identifierCandidates(opts.Query),
+		"limit":       opts.Limit + opts.Offset,
+	}
+
+	var filterSQL string
+	if opts.Filter != nil {
+		var filterParams map[string]interface{}
+		filterSQL, filterParams = filter.CompileSQL(opts.Filter, "filter_")
+		filterSQL = " AND " + filterSQL
+		for name, value := range filterParams {
+			params[name] = value
+		}
+	}
+	filterSQL += andClause(catalogClause("catalog_id", opts.CatalogID, params))
+
+	ctx, cancel := withBudget(ctx, s.config.SpannerBudget)
+	defer cancel()
+	stmt := spanner.Statement{
+		SQL:    fmt.Sprintf(identifierSQL, filterSQL),
+		Params: params,
+	}
+	txn := s.singleRead(opts.ReadTimestamp, opts.Staleness)
+	iter := txn.QueryWithOptions(ctx, stmt, queryOptions(ctx))
+	defer iter.Stop()
+
+	output = &SearchOutput{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			metrics.ObserveSince(metrics.SpannerQueryDuration.WithLabelValues("identifier", metrics.Outcome(err)), startTime)
+			return nil, fmt.Errorf("error iterating through identifier results: %w", err)
+		}
+
+		var productID string
+		var productDataJSON spanner.NullJSON
+		if err := row.Columns(&productID, &productDataJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan identifier result: %v", err)
+		}
+
+		productData, ok := productDataJSON.Value.(map[string]interface{})
+		if !productDataJSON.Valid || !ok {
+			continue
+		}
+
+		result, err := s.TransformProduct(productID, productData)
+		if err != nil {
+			log.Printf("Warning: could not transform product %s: %v", productID, err)
+			continue
+		}
+		result.Score = map[string]float64{"exact": 1}
+		output.Results = append(output.Results, result)
+	}
+
+	if readTimestamp, err := txn.Timestamp(); err == nil {
+		output.ReadTimestamp = readTimestamp
+	}
+
+	elapsed := time.Since(startTime)
+	recordStage(ctx, StageSpannerQuery, startTime)
+	metrics.SpannerQueryDuration.WithLabelValues("identifier", metrics.Outcome(nil)).Observe(elapsed.Seconds())
+	span.SetAttributes(attribute.Int("search.result_count", len(output.Results)))
+	log.Printf("Identifier lookup completed in %s, found %d results", elapsed, len(output.Results))
+
+	return output, nil
+}
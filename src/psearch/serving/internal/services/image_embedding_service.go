@@ -0,0 +1,217 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+)
+
+// ImageInput is an image to embed: its encoded bytes, or the gs:// URI
+// Vertex AI reads it from
+type ImageInput struct {
+	Bytes  []byte
+	GCSURI string
+}
+
+// ImageEmbeddingService embeds images with a Vertex AI multimodal
+// embedding model, into the space of the products' image_embedding column
+type ImageEmbeddingService struct {
+	config     *config.Config
+	httpClient *http.Client
+
+	retryPolicy RetryPolicy
+	breaker     *CircuitBreaker
+}
+
+// NewImageEmbeddingService creates a new image embedding service
+func NewImageEmbeddingService(ctx context.Context, cfg *config.Config) (*ImageEmbeddingService, error) {
+	var tokens oauth2.TokenSource
+	if !cfg.DevMode {
+		source, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create default google client for image embeddings: %v", err)
+		}
+		tokens = newTokenPrefetcher(ctx, source)
+	}
+
+	return &ImageEmbeddingService{
+		config:     cfg,
+		httpClient: newModelHTTPClient(tokens),
+		retryPolicy: RetryPolicy{
+			MaxAttempts:    cfg.VertexMaxAttempts,
+			InitialBackoff: cfg.VertexRetryInitialBackoff,
+			MaxBackoff:     cfg.VertexRetryMaxBackoff,
+		},
+		breaker: NewCircuitBreaker("image_embedding", cfg.CircuitBreakerFailureThreshold, cfg.CircuitBreakerOpenDuration),
+	}, nil
+}
+
+// EmbedImage embeds an image. Like text embeddings, the result must have
+// IMAGE_EMBEDDING_DIMENSION values.
+func (s *ImageEmbeddingService) EmbedImage(ctx context.Context, image ImageInput) (embedding []float32, err error) {
+	startTime := time.Now()
+
+	ctx, span := tracer.Start(ctx, "ImageEmbeddingService.EmbedImage",
+		trace.WithAttributes(
+			attribute.String("embedding.model", s.config.ImageEmbeddingModel),
+			attribute.Int("image.bytes", len(image.Bytes)),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "image embedding failed")
+		}
+		span.End()
+		metrics.ObserveSince(metrics.EmbeddingDuration.WithLabelValues(metrics.Outcome(err)), startTime)
+	}()
+
+	if err := s.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	err = retry(ctx, s.retryPolicy, "image_embedding", func() error {
+		var predictErr error
+		embedding, predictErr = s.predict(ctx, image)
+		return predictErr
+	})
+	s.breaker.Record(err)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedding) != s.config.ImageEmbeddingDimension {
+		return nil, fmt.Errorf("%w: %s returned %d dimensions, want %d", ErrEmbeddingDimension, s.config.ImageEmbeddingModel, len(embedding), s.config.ImageEmbeddingDimension)
+	}
+	return embedding, nil
+}
+
+// EmbedImageURI embeds the image at a product image URI. gs:// URIs, and
+// their https://storage.googleapis.com/ form, are read by Vertex AI; other
+// URLs are downloaded first, up to IMAGE_SEARCH_MAX_BYTES.
+func (s *ImageEmbeddingService) EmbedImageURI(ctx context.Context, uri string) ([]float32, error) {
+	if object, ok := strings.CutPrefix(uri, "https://storage.googleapis.com/"); ok {
+		uri = "gs://" + object
+	}
+	if strings.HasPrefix(uri, "gs://") {
+		return s.EmbedImage(ctx, ImageInput{GCSURI: uri})
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image URI %q: %v", uri, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download image %s: status %d", uri, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, s.config.ImageSearchMaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image %s: %w", uri, err)
+	}
+	if int64(len(data)) > s.config.ImageSearchMaxBytes {
+		return nil, fmt.Errorf("image %s is larger than %d bytes", uri, s.config.ImageSearchMaxBytes)
+	}
+	return s.EmbedImage(ctx, ImageInput{Bytes: data})
+}
+
+// predict makes one call to the multimodal embedding model, or embeds the
+// image's bytes or URI locally in DEV_MODE
+func (s *ImageEmbeddingService) predict(ctx context.Context, image ImageInput) ([]float32, error) {
+	if s.config.DevMode {
+		values, _ := localEmbedding(image.GCSURI+string(image.Bytes), s.config.ImageEmbeddingDimension)
+		return values, nil
+	}
+
+	type imageContent struct {
+		BytesBase64Encoded string `json:"bytesBase64Encoded,omitempty"`
+		GCSURI             string `json:"gcsUri,omitempty"`
+	}
+	type instance struct {
+		Image imageContent `json:"image"`
+	}
+	type parameters struct {
+		Dimension int `json:"dimension"`
+	}
+	request := struct {
+		Instances  []instance `json:"instances"`
+		Parameters parameters `json:"parameters"`
+	}{
+		Instances:  []instance{{Image: imageContent{GCSURI: image.GCSURI}}},
+		Parameters: parameters{Dimension: s.config.ImageEmbeddingDimension},
+	}
+	if len(image.Bytes) > 0 {
+		request.Instances[0].Image.BytesBase64Encoded = base64.StdEncoding.EncodeToString(image.Bytes)
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal image embedding request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, vertexModelURL(s.config, s.config.ImageEmbeddingModel, "predict"), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image embedding request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute image embedding request: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image embedding response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &EmbeddingAPIError{
+			StatusCode: resp.StatusCode,
+			Status:     http.StatusText(resp.StatusCode),
+			Message:    embeddingErrorMessage(responseBody),
+		}
+	}
+
+	var response struct {
+		Predictions []struct {
+			ImageEmbedding []float32 `json:"imageEmbedding"`
+		} `json:"predictions"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal image embedding response: %v", err)
+	}
+	if len(response.Predictions) == 0 || len(response.Predictions[0].ImageEmbedding) == 0 {
+		return nil, fmt.Errorf("no image embedding returned from %s", s.config.ImageEmbeddingModel)
+	}
+	return response.Predictions[0].ImageEmbedding, nil
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+)
+
+// ImageEmbeddingColumn is the products column holding product image
+// embeddings, searched by image search
+const ImageEmbeddingColumn = "image_embedding"
+
+// ImageSearchOptions holds the parameters for ImageSearch
+type ImageSearchOptions struct {
+	// Embedding is the query image's embedding
+	Embedding []float32
+	Limit     int
+	// Filter restricts the results; nil means no filter
+	Filter    filter.Node
+	Staleness time.Duration
+	// CatalogID restricts the results to one catalog; empty means all
+	// products
+	CatalogID string
+}
+
+// ImageSearch returns the products whose images are nearest to the query
+// image, closest first. Products without an image embedding are never
+// returned.
+func (s *SpannerService) ImageSearch(ctx context.Context, opts ImageSearchOptions) (results []models.SearchResult, err error) {
+	startTime := time.Now()
+
+	ctx, span := tracer.Start(ctx, "SpannerService.ImageSearch",
+		trace.WithAttributes(attribute.Int("image_search.limit", opts.Limit)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, "image search failed")
+		}
+		span.End()
+	}()
+
+	txn := s.client.Single()
+	if opts.Staleness > 0 {
+		txn = txn.WithTimestampBound(spanner.ExactStaleness(opts.Staleness))
+	}
+	defer txn.Close()
+
+	params := map[string]interface{}{"candidate_limit": opts.Limit}
+	filterSQL := "TRUE"
+	if opts.Filter != nil {
+		compiled, filterParams := filter.CompileSQL(opts.Filter, "filter_")
+		filterSQL = compiled
+		for name, value := range filterParams {
+			params[name] = value
+		}
+	}
+	filterSQL += andClause(catalogClause("catalog_id", opts.CatalogID, params))
+
+	ann := DefaultANNParams(s.config)
+	ann.Column, ann.DistanceMetric = ImageEmbeddingColumn, DistanceCosine
+	results, err = s.nearestProducts(ctx, txn, "image", opts.Embedding, ann, filterSQL, params)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("image_search.result_count", len(results)))
+	log.Printf("Image search completed in %s, found %d results", time.Since(startTime), len(results))
+	return results, nil
+}
+
+// productImageURI returns the URI of a product's first image, or "" if it
+// has none
+func productImageURI(productData map[string]interface{}) string {
+	images, _ := productData["images"].([]interface{})
+	for _, image := range images {
+		if imageMap, ok := image.(map[string]interface{}); ok {
+			if uri, ok := imageMap["uri"].(string); ok && uri != "" {
+				return uri
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,319 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+)
+
+// ErrInvalidIndexingEvent is returned for product change events that can
+// never be applied, such as malformed messages. They are dead-lettered
+// without being retried.
+var ErrInvalidIndexingEvent = errors.New("invalid indexing event")
+
+// Product change event operations
+const (
+	IndexingOpUpsert = "upsert"
+	IndexingOpDelete = "delete"
+)
+
+// indexingPullRetryPolicy backs off between failed pulls
+var indexingPullRetryPolicy = RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// IndexingEvent is a product change event on the indexing subscription.
+// Upserts carry the product's full product data, deletes only its ID.
+type IndexingEvent struct {
+	Op        string                 `json:"op"`
+	ProductID string                 `json:"product_id"`
+	CatalogID string                 `json:"catalog_id,omitempty"`
+	Product   map[string]interface{} `json:"product,omitempty"`
+	// Soft deletes set the product's tombstone instead of removing its row
+	Soft bool `json:"soft,omitempty"`
+}
+
+// IndexingWorker applies product change events from a Pub/Sub subscription
+// to the products table, embedding upserted products. Events for the same
+// product are applied one at a time in the order they were received, so
+// the subscription should have message ordering enabled with the product
+// ID as ordering key.
+type IndexingWorker struct {
+	config  *config.Config
+	spanner *SpannerService
+	pubsub  *PubSubService
+
+	mu sync.Mutex
+	// attempts counts the deliveries of failed messages when Pub/Sub does
+	// not, on subscriptions without a dead-letter policy. The count is per
+	// process, so it is only exact with a single worker.
+	attempts map[string]int
+}
+
+// indexingMessage is a pulled message and the event it carries
+type indexingMessage struct {
+	received ReceivedMessage
+	event    IndexingEvent
+	// err is set if the message is not a valid event
+	err error
+}
+
+// key returns the key the message is ordered by: its ordering key, or the
+// product ID of its event
+func (m indexingMessage) key() string {
+	if m.received.Message.OrderingKey != "" {
+		return m.received.Message.OrderingKey
+	}
+	return m.event.ProductID
+}
+
+// NewIndexingWorker creates a worker for the configured subscription
+func NewIndexingWorker(cfg *config.Config, spannerSvc *SpannerService, pubsub *PubSubService) *IndexingWorker {
+	return &IndexingWorker{
+		config:   cfg,
+		spanner:  spannerSvc,
+		pubsub:   pubsub,
+		attempts: make(map[string]int),
+	}
+}
+
+// Run pulls and applies events until ctx is done. A pulled batch is settled
+// before the next pull, and the batch in progress when ctx is done is
+// finished, so the subscription's ack deadline must cover applying a
+// batch.
+func (w *IndexingWorker) Run(ctx context.Context) {
+	failures := 0
+	for ctx.Err() == nil {
+		messages, err := w.pubsub.Pull(ctx, w.config.IndexingSubscription, w.config.IndexingMaxMessages)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failures++
+			delay := indexingPullRetryPolicy.backoff(failures)
+			log.Printf("Indexing worker: pull failed (backoff %s): %v", delay, err)
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+		failures = 0
+		w.processBatch(context.WithoutCancel(ctx), messages)
+	}
+}
+
+// processBatch applies a batch of messages in IndexingConcurrency lanes,
+// chosen by ordering key, then acknowledges the applied and dead-lettered
+// messages and negatively acknowledges the rest. Once a message fails, the
+// later messages for its key are not applied, so they are redelivered
+// after it and stay in order.
+func (w *IndexingWorker) processBatch(ctx context.Context, received []ReceivedMessage) {
+	lanes := make([][]indexingMessage, w.config.IndexingConcurrency)
+	for _, r := range received {
+		message := indexingMessage{received: r}
+		message.event, message.err = decodeIndexingEvent(r.Message.Data)
+		lane := laneFor(message.key(), len(lanes))
+		lanes[lane] = append(lanes[lane], message)
+	}
+
+	acks := make([][]string, len(lanes))
+	nacks := make([][]string, len(lanes))
+	var wg sync.WaitGroup
+	for i, lane := range lanes {
+		if len(lane) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			failedKeys := make(map[string]bool)
+			for _, message := range lane {
+				key := message.key()
+				if failedKeys[key] {
+					nacks[i] = append(nacks[i], message.received.AckID)
+					continue
+				}
+				if w.handle(ctx, message) {
+					acks[i] = append(acks[i], message.received.AckID)
+				} else {
+					nacks[i] = append(nacks[i], message.received.AckID)
+					failedKeys[key] = true
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := w.pubsub.Acknowledge(ctx, w.config.IndexingSubscription, slices.Concat(acks...)); err != nil {
+		log.Printf("Indexing worker: acknowledge failed, messages will be redelivered: %v", err)
+	}
+	if err := w.pubsub.ModifyAckDeadline(ctx, w.config.IndexingSubscription, slices.Concat(nacks...), 0); err != nil {
+		log.Printf("Indexing worker: nack failed, messages will be redelivered when their ack deadline expires: %v", err)
+	}
+}
+
+// handle applies a message, or dead-letters it if it is invalid or has run
+// out of attempts. It reports whether the message is settled and should be
+// acknowledged.
+func (w *IndexingWorker) handle(ctx context.Context, message indexingMessage) bool {
+	op := message.event.Op
+	err := message.err
+	if err == nil {
+		start := time.Now()
+		err = w.apply(ctx, message.event)
+		metrics.IndexingDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	}
+	if !slices.Contains([]string{IndexingOpUpsert, IndexingOpDelete}, op) {
+		op = "unknown"
+	}
+
+	messageID := message.received.Message.MessageID
+	if err == nil {
+		w.forgetAttempts(messageID)
+		metrics.IndexingEvents.WithLabelValues(op, "applied").Inc()
+		return true
+	}
+
+	attempt := w.attempt(message.received)
+	if !errors.Is(err, ErrInvalidIndexingEvent) && attempt < w.config.IndexingMaxAttempts {
+		log.Printf("Indexing worker: attempt %d for message %s (product %s) failed, retrying: %v", attempt, messageID, message.event.ProductID, err)
+		metrics.IndexingEvents.WithLabelValues(op, "retried").Inc()
+		return false
+	}
+
+	if deadLetterErr := w.deadLetter(ctx, message.received, attempt, err); deadLetterErr != nil {
+		log.Printf("Indexing worker: failed to dead-letter message %s, retrying: %v", messageID, deadLetterErr)
+		metrics.IndexingEvents.WithLabelValues(op, "retried").Inc()
+		return false
+	}
+	w.forgetAttempts(messageID)
+	metrics.IndexingEvents.WithLabelValues(op, "dead_lettered").Inc()
+	return true
+}
+
+// apply writes an event to the products table. Deleting a product that is
+// not in the catalog succeeds, so redelivered deletes are harmless.
+func (w *IndexingWorker) apply(ctx context.Context, event IndexingEvent) error {
+	catalogID, err := w.resolveCatalog(event.CatalogID)
+	if err != nil {
+		return err
+	}
+	switch event.Op {
+	case IndexingOpUpsert:
+		_, err := w.spanner.UpsertProduct(ctx, catalogID, event.ProductID, event.Product)
+		if errors.Is(err, ErrInvalidProductPatch) {
+			return fmt.Errorf("%w: %v", ErrInvalidIndexingEvent, err)
+		}
+		return err
+	case IndexingOpDelete:
+		err := w.spanner.DeleteProduct(ctx, catalogID, event.ProductID, event.Soft)
+		if errors.Is(err, ErrProductNotFound) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("%w: unknown op %q", ErrInvalidIndexingEvent, event.Op)
+}
+
+// resolveCatalog returns the catalog an event applies to, following the
+// API's rules, see config.ResolveCatalog
+func (w *IndexingWorker) resolveCatalog(requested string) (string, error) {
+	catalogID, err := w.config.ResolveCatalog(requested)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidIndexingEvent, err)
+	}
+	return catalogID, nil
+}
+
+// deadLetter publishes a message that could not be applied to the
+// dead-letter topic, with its attributes and the reason it failed. Without
+// a dead-letter topic the message is logged and dropped.
+func (w *IndexingWorker) deadLetter(ctx context.Context, received ReceivedMessage, attempt int, cause error) error {
+	if w.config.IndexingDeadLetterTopic == "" {
+		log.Printf("Indexing worker: dropping message %s after %d attempts: %v", received.Message.MessageID, attempt, cause)
+		return nil
+	}
+	attributes := make(map[string]string, len(received.Message.Attributes)+3)
+	for name, value := range received.Message.Attributes {
+		attributes[name] = value
+	}
+	attributes["error"] = cause.Error()
+	attributes["source_message_id"] = received.Message.MessageID
+	attributes["delivery_attempts"] = strconv.Itoa(attempt)
+	log.Printf("Indexing worker: dead-lettering message %s after %d attempts: %v", received.Message.MessageID, attempt, cause)
+	return w.pubsub.Publish(ctx, w.config.IndexingDeadLetterTopic, received.Message.Data, attributes)
+}
+
+// attempt returns the delivery attempt of a failed message, counting
+// deliveries itself when Pub/Sub does not
+func (w *IndexingWorker) attempt(received ReceivedMessage) int {
+	if received.DeliveryAttempt > 0 {
+		return received.DeliveryAttempt
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.attempts[received.Message.MessageID]++
+	return w.attempts[received.Message.MessageID]
+}
+
+// forgetAttempts drops the delivery count of a settled message
+func (w *IndexingWorker) forgetAttempts(messageID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.attempts, messageID)
+}
+
+// decodeIndexingEvent parses and validates a message's event
+func decodeIndexingEvent(data []byte) (IndexingEvent, error) {
+	var event IndexingEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return event, fmt.Errorf("%w: %v", ErrInvalidIndexingEvent, err)
+	}
+	switch {
+	case event.ProductID == "":
+		return event, fmt.Errorf("%w: product_id is required", ErrInvalidIndexingEvent)
+	case event.Op == IndexingOpUpsert && event.Product == nil:
+		return event, fmt.Errorf("%w: upserts require product", ErrInvalidIndexingEvent)
+	case event.Op != IndexingOpUpsert && event.Op != IndexingOpDelete:
+		return event, fmt.Errorf("%w: op must be upsert or delete, got %q", ErrInvalidIndexingEvent, event.Op)
+	}
+	return event, nil
+}
+
+// laneFor returns the lane that applies the messages for key
+func laneFor(key string, lanes int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(lanes))
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"time"
+
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/models"
+)
+
+// Searcher ranks products for search, browse and similar-product requests.
+// SpannerService is the production implementation; servicestest has an
+// in-memory one for tests.
+type Searcher interface {
+	HybridSearch(ctx context.Context, opts SearchOptions) (*SearchOutput, error)
+	IdentifierSearch(ctx context.Context, opts SearchOptions) (*SearchOutput, error)
+	BrowseByCategory(ctx context.Context, opts BrowseOptions) (*BrowseOutput, error)
+	SimilarProducts(ctx context.Context, opts SimilarOptions) ([]models.SearchResult, error)
+}
+
+// ProductStore reads products by ID. GetProductsBatch returns the raw
+// product_data of the products found, keyed by ID; TransformProduct turns
+// one of them into a search result.
+type ProductStore interface {
+	GetProductsBatch(ctx context.Context, catalogID string, productIDs []string, staleness time.Duration) (map[string]map[string]interface{}, error)
+	TransformProduct(productID string, productData map[string]interface{}) (models.SearchResult, error)
+}
+
+// ProductWriter applies admin edits to single products. Each method
+// returns ErrProductNotFound when the product is not in the catalog;
+// UpdateProduct returns ErrInvalidProductPatch for patches it cannot apply.
+type ProductWriter interface {
+	UpdateProduct(ctx context.Context, catalogID, productID string, patch map[string]interface{}) (*ProductUpdate, error)
+	DeleteProduct(ctx context.Context, catalogID, productID string, soft bool) error
+	RestoreProduct(ctx context.Context, catalogID, productID string) error
+}
+
+// ImageSearcher ranks products by the similarity of their images to a query
+// image's embedding
+type ImageSearcher interface {
+	ImageSearch(ctx context.Context, opts ImageSearchOptions) ([]models.SearchResult, error)
+}
+
+// AnalyticsReader reads the aggregates that query analytics and tail query
+// sampling write
+type AnalyticsReader interface {
+	QueryAnalyticsReport(ctx context.Context, since, until time.Time, limit, minTrendingSearches int) (*models.QueryAnalyticsResponse, error)
+	ListRelevanceSamples(ctx context.Context, week string) ([]models.RelevanceSample, error)
+}
+
+// The ingestion callbacks hand the IDs of the products the ingestion stream
+// wrote to these, scoped to the catalog they were written to. Products of
+// other catalogs are never read or written.
+type (
+	// ProductChangeDetector emits price drop and back-in-stock events
+	ProductChangeDetector interface {
+		DetectChanges(ctx context.Context, catalogID string, productIDs []string) ([]ProductChangeEvent, error)
+	}
+	// QualityScorer scores products for data quality
+	QualityScorer interface {
+		ScoreProducts(ctx context.Context, catalogID string, productIDs []string) (scored int, lowQuality int, err error)
+	}
+	// SavedSearchEvaluator matches products against saved searches
+	SavedSearchEvaluator interface {
+		EvaluateProducts(ctx context.Context, catalogID string, productIDs []string) (int, error)
+	}
+)
+
+// UserProfiles reads and learns the preference embeddings that personalize
+// searches. UserProfileService is the Spanner implementation.
+type UserProfiles interface {
+	Embedding(ctx context.Context, userID string) ([]float32, error)
+	RecordClick(ctx context.Context, userID, productID string) error
+}
+
+// CacheSource owns cache layers the admin API reports on and invalidates
+type CacheSource interface {
+	CacheLayers() []cache.Layer
+}
+
+// Embedder embeds query text, and product text for storage, into the
+// product embedding space. EmbeddingService is the Vertex AI implementation.
+type Embedder interface {
+	GenerateEmbedding(ctx context.Context, text string) ([]float32, error)
+	GenerateDocumentEmbedding(ctx context.Context, text string) ([]float32, error)
+}
+
+var (
+	_ Searcher              = (*SpannerService)(nil)
+	_ ProductStore          = (*SpannerService)(nil)
+	_ ProductWriter         = (*SpannerService)(nil)
+	_ ImageSearcher         = (*SpannerService)(nil)
+	_ AnalyticsReader       = (*SpannerService)(nil)
+	_ CacheSource           = (*SpannerService)(nil)
+	_ Embedder              = (*EmbeddingService)(nil)
+	_ CacheSource           = (*EmbeddingService)(nil)
+	_ ProductChangeDetector = (*ProductChangeService)(nil)
+	_ QualityScorer         = (*DataQualityService)(nil)
+	_ SavedSearchEvaluator  = (*SavedSearchService)(nil)
+	_ UserProfiles          = (*UserProfileService)(nil)
+	_ CacheSource           = (*UserProfileService)(nil)
+)
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"psearch/serving/internal/config"
+)
+
+// maxKeywordClauses bounds the clauses a minimum-should-match query is
+// expanded to. Queries needing more require every term instead.
+const maxKeywordClauses = 128
+
+// KeywordParams tune how the FTS branch matches the query. Unset fields
+// use the deployment's FTS_* settings.
+type KeywordParams struct {
+	// Dialect is config.FTSDialectRQuery, FTSDialectWords or
+	// FTSDialectWordsPhrase
+	Dialect string
+	// MinimumShouldMatch is how many of the query's terms a product must
+	// match in the rquery dialect, see config.MinimumShouldMatch
+	MinimumShouldMatch string
+	// PhraseMatching keeps quoted parts of the query as phrases
+	PhraseMatching *bool
+	// EnhanceQuery lets Spanner match synonyms and spelling variants
+	EnhanceQuery *bool
+}
+
+// withDefaults fills in the parameters left unset from the deployment's
+func (p KeywordParams) withDefaults(cfg *config.Config) KeywordParams {
+	if p.Dialect == "" {
+		p.Dialect = cfg.FTSDialect
+	}
+	if p.MinimumShouldMatch == "" {
+		p.MinimumShouldMatch = cfg.FTSMinimumShouldMatch
+	}
+	if p.PhraseMatching == nil {
+		p.PhraseMatching = &cfg.FTSPhraseMatching
+	}
+	if p.EnhanceQuery == nil {
+		p.EnhanceQuery = &cfg.FTSEnhanceQuery
+	}
+	return p
+}
+
+// cacheKey distinguishes result cache entries of searches matching
+// keywords differently
+func (p KeywordParams) cacheKey() string {
+	return fmt.Sprintf("%s/%s/%t/%t", p.Dialect, p.MinimumShouldMatch, p.PhraseMatching != nil && *p.PhraseMatching, p.EnhanceQuery != nil && *p.EnhanceQuery)
+}
+
+// searchArgs returns the arguments SEARCH() and SCORE() take after the
+// token column. Settings matching Spanner's defaults are left out, so the
+// statement only changes when they are used.
+func (p KeywordParams) searchArgs(language bool) string {
+	args := "@query_text"
+	if p.Dialect != "" && p.Dialect != config.FTSDialectRQuery {
+		args += ", dialect=>'" + p.Dialect + "'"
+	}
+	if p.EnhanceQuery != nil && *p.EnhanceQuery {
+		args += ", enhance_query=>TRUE"
+	}
+	if language {
+		args += ", language_tag=>@query_language"
+	}
+	return args
+}
+
+// keywordQuery rewrites keywords, the normalized rquery of the FTS branch,
+// for p. In the rquery dialect, a query whose terms need not all match is
+// expanded to the conjunction of every group of terms one larger than the
+// number that may be missing, each group ORed: "a OR b a OR c b OR c"
+// matches any two of a, b and c, relying on OR binding tighter than the
+// implicit AND. Exclusions (-term) always apply. The words dialects take no
+// operators, so only the first alternative of each term is kept.
+func keywordQuery(keywords string, p KeywordParams) string {
+	terms, exclusions := keywordTerms(keywords, p.PhraseMatching == nil || *p.PhraseMatching)
+	if len(terms) == 0 {
+		return keywords
+	}
+
+	if p.Dialect != "" && p.Dialect != config.FTSDialectRQuery {
+		words := make([]string, 0, len(terms))
+		for _, term := range terms {
+			words = append(words, strings.Trim(term[0], `"`))
+		}
+		return strings.Join(words, " ")
+	}
+
+	required, err := config.MinimumShouldMatch(p.MinimumShouldMatch, len(terms))
+	if err != nil || combinations(len(terms), len(terms)-required+1) > maxKeywordClauses {
+		required = len(terms)
+	}
+	var clauses []string
+	eachCombination(len(terms), len(terms)-required+1, func(indexes []int) {
+		var alternatives []string
+		for _, i := range indexes {
+			alternatives = append(alternatives, terms[i]...)
+		}
+		clauses = append(clauses, strings.Join(alternatives, " OR "))
+	})
+	return strings.Join(append(clauses, exclusions...), " ")
+}
+
+// keywordTerms splits an rquery into its terms, each a word or quoted
+// phrase with its OR alternatives, and its -exclusions. Without phrases,
+// quotes are dropped and phrases become words; an unclosed quote is
+// always dropped.
+func keywordTerms(query string, phrases bool) (terms [][]string, exclusions []string) {
+	if !phrases {
+		query = strings.ReplaceAll(query, `"`, " ")
+	}
+	tokens := strings.Fields(query)
+	var units []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if strings.HasPrefix(token, `"`) && !(len(token) > 1 && strings.HasSuffix(token, `"`)) {
+			end := i + 1
+			for end < len(tokens) && !strings.HasSuffix(tokens[end], `"`) {
+				end++
+			}
+			if end == len(tokens) {
+				// Unclosed: search the rest as words
+				for _, word := range tokens[i:] {
+					if word = strings.Trim(word, `"`); word != "" {
+						units = append(units, word)
+					}
+				}
+				break
+			}
+			units = append(units, strings.Join(tokens[i:end+1], " "))
+			i = end
+			continue
+		}
+		units = append(units, token)
+	}
+
+	for i := 0; i < len(units); i++ {
+		unit := units[i]
+		switch {
+		case unit == "OR" && len(terms) > 0 && i+1 < len(units):
+			i++
+			terms[len(terms)-1] = append(terms[len(terms)-1], units[i])
+		case unit == "OR":
+		case strings.HasPrefix(unit, "-") && len(unit) > 1:
+			exclusions = append(exclusions, unit)
+		default:
+			terms = append(terms, []string{unit})
+		}
+	}
+	return terms, exclusions
+}
+
+// combinations returns n choose k
+func combinations(n, k int) int {
+	result := 1
+	for i := 1; i <= k; i++ {
+		result = result * (n - k + i) / i
+	}
+	return result
+}
+
+// eachCombination calls fn with every k-element combination of 0..n-1, in
+// lexicographic order
+func eachCombination(n, k int, fn func([]int)) {
+	indexes := make([]int, k)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	for {
+		fn(indexes)
+		i := k - 1
+		for i >= 0 && indexes[i] == n-k+i {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		indexes[i]++
+		for j := i + 1; j < k; j++ {
+			indexes[j] = indexes[j-1] + 1
+		}
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"psearch/serving/internal/config"
+)
+
+func TestKeywordQuery(t *testing.T) {
+	no := false
+	tests := []struct {
+		name     string
+		keywords string
+		params   KeywordParams
+		want     string
+	}{
+		{name: "every term by default", keywords: "red trail shoes", want: "red trail shoes"},
+		{name: "count", keywords: "a b c", params: KeywordParams{MinimumShouldMatch: "2"}, want: "a OR b a OR c b OR c"},
+		{name: "missing count", keywords: "a b c d", params: KeywordParams{MinimumShouldMatch: "-1"}, want: "a OR b a OR c a OR d b OR c b OR d c OR d"},
+		{name: "percentage", keywords: "a b c d", params: KeywordParams{MinimumShouldMatch: "75%"}, want: "a OR b a OR c a OR d b OR c b OR d c OR d"},
+		{name: "zero matches any term", keywords: "a b c", params: KeywordParams{MinimumShouldMatch: "0"}, want: "a OR b OR c"},
+		{name: "more than the terms requires every term", keywords: "a b c", params: KeywordParams{MinimumShouldMatch: "5"}, want: "a b c"},
+		{name: "invalid requires every term", keywords: "a b c", params: KeywordParams{MinimumShouldMatch: "most"}, want: "a b c"},
+		{name: "single term", keywords: "shoes", params: KeywordParams{MinimumShouldMatch: "0"}, want: "shoes"},
+		{
+			name:     "alternatives stay in their term's clauses",
+			keywords: "sneaker OR trainer red",
+			params:   KeywordParams{MinimumShouldMatch: "1"},
+			want:     "sneaker OR trainer OR red",
+		},
+		{
+			name:     "exclusions always apply",
+			keywords: "a -b c",
+			params:   KeywordParams{MinimumShouldMatch: "1"},
+			want:     "a OR c -b",
+		},
+		{
+			name:     "phrases are terms",
+			keywords: `"trail running" shoes`,
+			params:   KeywordParams{MinimumShouldMatch: "1"},
+			want:     `"trail running" OR shoes`,
+		},
+		{
+			name:     "phrases split without phrase matching",
+			keywords: `"trail running" shoes`,
+			params:   KeywordParams{MinimumShouldMatch: "1", PhraseMatching: &no},
+			want:     "trail OR running OR shoes",
+		},
+		{name: "unclosed quotes are dropped", keywords: `shoes "trail running`, want: "shoes trail running"},
+		{name: "dangling OR is dropped", keywords: "OR shoes OR", want: "shoes"},
+		{name: "only exclusions", keywords: "-shoes", want: "-shoes"},
+		{
+			name:     "words dialect keeps first alternatives",
+			keywords: `"trail running" OR jogging shoes -socks`,
+			params:   KeywordParams{Dialect: config.FTSDialectWords, MinimumShouldMatch: "1"},
+			want:     "trail running shoes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keywordQuery(tt.keywords, tt.params); got != tt.want {
+				t.Errorf("keywordQuery(%q) = %q, want %q", tt.keywords, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeywordQueryClauseLimit(t *testing.T) {
+	terms := func(n int) string {
+		words := make([]string, n)
+		for i := range words {
+			words[i] = string(rune('a' + i))
+		}
+		return strings.Join(words, " ")
+	}
+	tests := []struct {
+		terms       int
+		msm         string
+		wantClauses int
+	}{
+		// 9 choose 5 = 126 clauses fit
+		{terms: 9, msm: "-4", wantClauses: 126},
+		// 10 choose 5 = 252 do not, so every term is required
+		{terms: 10, msm: "-4", wantClauses: 10},
+		{terms: 20, msm: "1", wantClauses: 1},
+		{terms: 20, msm: "2", wantClauses: 20},
+	}
+	for _, tt := range tests {
+		got := strings.Fields(keywordQuery(terms(tt.terms), KeywordParams{MinimumShouldMatch: tt.msm}))
+		clauses := len(got) - strings.Count(strings.Join(got, " "), " OR ")*2
+		if clauses != tt.wantClauses {
+			t.Errorf("keywordQuery(%d terms, msm %s) has %d clauses, want %d", tt.terms, tt.msm, clauses, tt.wantClauses)
+		}
+	}
+}
+
+func TestEachCombination(t *testing.T) {
+	var got [][]int
+	eachCombination(4, 2, func(indexes []int) {
+		got = append(got, append([]int(nil), indexes...))
+	})
+	want := [][]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("eachCombination(4, 2) = %v, want %v", got, want)
+	}
+
+	for _, tt := range []struct{ n, k int }{{1, 1}, {5, 5}, {6, 1}, {9, 5}, {10, 3}} {
+		calls := 0
+		eachCombination(tt.n, tt.k, func([]int) { calls++ })
+		if want := combinations(tt.n, tt.k); calls != want {
+			t.Errorf("eachCombination(%d, %d) made %d calls, want %d", tt.n, tt.k, calls, want)
+		}
+	}
+	if got := combinations(10, 5); got != 252 {
+		t.Errorf("combinations(10, 5) = %d, want 252", got)
+	}
+}
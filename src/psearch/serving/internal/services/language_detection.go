@@ -0,0 +1,143 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// scriptLanguages maps scripts used by a single search language to it.
+// Han is checked after Hiragana and Katakana, which mark Japanese.
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// languageWords are common function words and shopping terms of the
+// Latin-script languages, which short product queries are most likely to
+// contain
+var languageWords = map[string][]string{
+	"en": {"the", "and", "for", "with", "without", "women", "womens", "men", "mens", "kids", "shoes", "dress", "jacket", "pants", "shirt", "size"},
+	"de": {"der", "die", "das", "und", "für", "fur", "mit", "ohne", "damen", "herren", "kinder", "schuhe", "kleid", "jacke", "hose", "hemd", "größe", "grösse", "schwarz", "weiß", "rot", "blau"},
+	"fr": {"le", "la", "les", "et", "pour", "avec", "sans", "femme", "homme", "enfant", "chaussures", "robe", "veste", "pantalon", "chemise", "taille", "noir", "blanc", "rouge", "bleu"},
+	"es": {"el", "los", "las", "y", "para", "con", "sin", "mujer", "hombre", "niños", "zapatos", "zapatillas", "vestido", "chaqueta", "pantalón", "camisa", "talla", "negro", "blanco", "rojo", "azul"},
+	"it": {"il", "gli", "e", "per", "senza", "donna", "uomo", "bambini", "scarpe", "vestito", "giacca", "pantaloni", "camicia", "taglia", "nero", "bianco", "rosso", "blu"},
+	"nl": {"het", "een", "en", "voor", "met", "zonder", "dames", "heren", "kinderen", "schoenen", "jurk", "jas", "broek", "overhemd", "maat", "zwart", "wit", "rood", "blauw"},
+	"pt": {"os", "as", "e", "para", "com", "sem", "mulher", "homem", "crianças", "sapatos", "tênis", "vestido", "jaqueta", "calça", "camisa", "tamanho", "preto", "branco", "vermelho", "azul"},
+}
+
+// languageLetters are letters that, among the Latin-script languages
+// above, mostly occur in one of them
+var languageLetters = map[rune]string{
+	'ß': "de", 'ä': "de", 'ö': "de", 'ü': "de",
+	'ñ': "es", '¿': "es", '¡': "es",
+	'ã': "pt", 'õ': "pt",
+	'œ': "fr", 'è': "fr", 'ë': "fr", 'î': "fr", 'ï': "fr",
+	'ò': "it", 'ì': "it",
+}
+
+// wordLanguages indexes languageWords by word, listing every language a
+// word belongs to
+var wordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for language, words := range languageWords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// DetectLanguage guesses the language of a search query, returning its ISO
+// 639-1 code, or "" when the query gives no clear signal. Queries in
+// non-Latin scripts are identified by their script; Latin-script queries
+// by letters and words characteristic of English, German, French,
+// Spanish, Italian, Dutch or Portuguese. Brand names and model numbers
+// carry no signal, so many short queries are undetected.
+func DetectLanguage(query string) string {
+	query = strings.ToLower(query)
+	for _, r := range query {
+		for _, entry := range scriptLanguages {
+			if unicode.Is(entry.script, r) {
+				return entry.language
+			}
+		}
+	}
+
+	// A characteristic letter counts more than a word a language shares
+	// with others
+	scores := make(map[string]float64)
+	for _, r := range query {
+		if language, ok := languageLetters[r]; ok {
+			scores[language] += 2
+		}
+	}
+	for _, word := range strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		languages := wordLanguages[word]
+		for _, language := range languages {
+			scores[language] += 1 / float64(len(languages))
+		}
+	}
+
+	best, bestScore, tied := "", 0.0, false
+	for language, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = language, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+	if bestScore < 1 || tied {
+		return ""
+	}
+	return best
+}
+
+// queryLanguageKey carries the language of the query being searched
+type queryLanguageKey struct{}
+
+// ContextWithQueryLanguage records the language of the query searched with
+// ctx. The Vertex AI embedding endpoint takes no language parameter, as its
+// multilingual models infer it, so embedding spans only record it.
+func ContextWithQueryLanguage(ctx context.Context, language string) context.Context {
+	if language == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, queryLanguageKey{}, language)
+}
+
+// queryLanguage returns the query language set on ctx, if any
+func queryLanguage(ctx context.Context) string {
+	language, _ := ctx.Value(queryLanguageKey{}).(string)
+	return language
+}
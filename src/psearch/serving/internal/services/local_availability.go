@@ -0,0 +1,253 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/spanner"
+
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/models"
+)
+
+// GeoPoint is a location in degrees of latitude and longitude
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// LocalSearch restricts a search to the products in stock for pickup at
+// StoreID, or at the stores within RadiusKm of Location. With Boost, other
+// products are kept and the results in stock nearby are only annotated,
+// for ApplyLocalBoost to rank first.
+type LocalSearch struct {
+	StoreID  string
+	Location *GeoPoint
+	RadiusKm float64
+	Boost    bool
+}
+
+// cacheKey identifies the local search in result cache keys
+func (l *LocalSearch) cacheKey() string {
+	if l == nil {
+		return ""
+	}
+	if l.Location == nil {
+		return fmt.Sprintf("%s|%t", l.StoreID, l.Boost)
+	}
+	return fmt.Sprintf("%s|%g,%g|%g|%t", l.StoreID, l.Location.Latitude, l.Location.Longitude, l.RadiusKm, l.Boost)
+}
+
+// localStore is a store a local search covers
+type localStore struct {
+	id   string
+	name string
+	// distanceKm is the distance from the shopper; nil when the search
+	// gave no location
+	distanceKm *float64
+}
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// kmPerDegreeLatitude is the length of a degree of latitude
+const kmPerDegreeLatitude = 111.32
+
+// distanceKm returns the great-circle distance between two points
+func distanceKm(a, b GeoPoint) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// localStores returns the stores a local search covers, nearest first. A
+// store ID is looked up on its own; a location reads the stores in the
+// bounding box of the radius, then keeps the LOCAL_MAX_STORES nearest
+// within it. An unknown store ID covers no stores.
+func (s *SpannerService) localStores(ctx context.Context, txn *spanner.ReadOnlyTransaction, local *LocalSearch) ([]localStore, error) {
+	startTime := time.Now()
+	stmt := spanner.Statement{
+		SQL:    "SELECT store_id, name, latitude, longitude FROM stores WHERE store_id = @store_id",
+		Params: map[string]interface{}{"store_id": local.StoreID},
+	}
+	if local.StoreID == "" {
+		dLat := local.RadiusKm / kmPerDegreeLatitude
+		stmt = spanner.Statement{
+			SQL: "SELECT store_id, name, latitude, longitude FROM stores WHERE latitude BETWEEN @min_latitude AND @max_latitude",
+			Params: map[string]interface{}{
+				"min_latitude": local.Location.Latitude - dLat,
+				"max_latitude": local.Location.Latitude + dLat,
+			},
+		}
+		// Near the poles and the antimeridian the longitude range wraps, so
+		// only latitude narrows the read
+		dLng := 180.0
+		if cos := math.Cos(local.Location.Latitude * math.Pi / 180); cos > 0 {
+			dLng = local.RadiusKm / (kmPerDegreeLatitude * cos)
+		}
+		if local.Location.Longitude-dLng >= -180 && local.Location.Longitude+dLng <= 180 {
+			stmt.SQL += " AND longitude BETWEEN @min_longitude AND @max_longitude"
+			stmt.Params["min_longitude"] = local.Location.Longitude - dLng
+			stmt.Params["max_longitude"] = local.Location.Longitude + dLng
+		}
+	}
+
+	var stores []localStore
+	iter := txn.QueryWithOptions(ctx, stmt, queryOptions(ctx))
+	err := iter.Do(func(row *spanner.Row) error {
+		var store localStore
+		var name spanner.NullString
+		var location GeoPoint
+		if err := row.Columns(&store.id, &name, &location.Latitude, &location.Longitude); err != nil {
+			return err
+		}
+		store.name = name.StringVal
+		if local.Location != nil {
+			distance := distanceKm(*local.Location, location)
+			if local.StoreID == "" && distance > local.RadiusKm {
+				return nil
+			}
+			store.distanceKm = &distance
+		}
+		stores = append(stores, store)
+		return nil
+	})
+	metrics.ObserveSince(metrics.SpannerQueryDuration.WithLabelValues("local_stores", metrics.Outcome(err)), startTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stores: %w", err)
+	}
+
+	if local.Location != nil {
+		slices.SortFunc(stores, func(a, b localStore) int {
+			return cmp.Compare(*a.distanceKm, *b.distanceKm)
+		})
+	}
+	if len(stores) > s.config.LocalMaxStores {
+		stores = stores[:s.config.LocalMaxStores]
+	}
+	return stores, nil
+}
+
+// localClause returns the predicate keeping the products in stock at the
+// stores, binding their IDs to @local_store_ids
+func localClause(stores []localStore, params map[string]interface{}) string {
+	ids := make([]string, len(stores))
+	for i, store := range stores {
+		ids[i] = store.id
+	}
+	params["local_store_ids"] = ids
+	return "EXISTS (SELECT 1 FROM product_store_availability AS availability WHERE availability.product_id = products.product_id AND availability.store_id IN UNNEST(@local_store_ids) AND availability.quantity > 0)"
+}
+
+// annotateLocalAvailability sets the LocalAvailability of each result in
+// stock at the stores to the nearest store holding it
+func (s *SpannerService) annotateLocalAvailability(ctx context.Context, txn *spanner.ReadOnlyTransaction, results []models.SearchResult, stores []localStore) error {
+	if len(results) == 0 || len(stores) == 0 {
+		return nil
+	}
+	startTime := time.Now()
+	productIDs := make([]string, len(results))
+	for i, result := range results {
+		productIDs[i] = result.ID
+	}
+	storeIDs := make([]string, len(stores))
+	nearness := make(map[string]int, len(stores))
+	for i, store := range stores {
+		storeIDs[i] = store.id
+		nearness[store.id] = i
+	}
+
+	stmt := spanner.Statement{
+		SQL: `SELECT product_id, store_id, quantity FROM product_store_availability
+			WHERE product_id IN UNNEST(@product_ids) AND store_id IN UNNEST(@store_ids) AND quantity > 0`,
+		Params: map[string]interface{}{"product_ids": productIDs, "store_ids": storeIDs},
+	}
+	nearest := make(map[string]int)
+	quantities := make(map[string]int64)
+	iter := txn.QueryWithOptions(ctx, stmt, queryOptions(ctx))
+	err := iter.Do(func(row *spanner.Row) error {
+		var productID, storeID string
+		var quantity int64
+		if err := row.Columns(&productID, &storeID, &quantity); err != nil {
+			return err
+		}
+		if i, ok := nearest[productID]; !ok || nearness[storeID] < i {
+			nearest[productID] = nearness[storeID]
+			quantities[productID] = quantity
+		}
+		return nil
+	})
+	metrics.ObserveSince(metrics.SpannerQueryDuration.WithLabelValues("local_availability", metrics.Outcome(err)), startTime)
+	if err != nil {
+		return fmt.Errorf("failed to read local availability: %w", err)
+	}
+
+	for i := range results {
+		storeIndex, ok := nearest[results[i].ID]
+		if !ok {
+			continue
+		}
+		store := stores[storeIndex]
+		results[i].LocalAvailability = &models.LocalAvailability{
+			StoreID:    store.id,
+			StoreName:  store.name,
+			Quantity:   quantities[results[i].ID],
+			DistanceKm: store.distanceKm,
+		}
+	}
+	return nil
+}
+
+// ApplyLocalBoost scales the fused score of the results in stock nearby by
+// 1 + weight, tapering linearly to 1 at radiusKm when the store's distance
+// is known, and re-sorts them by the adjusted score. It returns the
+// reordered results and the boost applied to each product, for debug
+// responses. results itself is not modified, since it may be shared with
+// the result cache.
+func ApplyLocalBoost(results []models.SearchResult, weight, radiusKm float64) ([]models.SearchResult, map[string][]models.AppliedBoost) {
+	boosted := slices.Clone(results)
+	applied := make(map[string][]models.AppliedBoost)
+	for i := range boosted {
+		local := boosted[i].LocalAvailability
+		if local == nil {
+			continue
+		}
+		factor := 1 + weight
+		if local.DistanceKm != nil && radiusKm > 0 {
+			factor = 1 + weight*math.Max(0, 1-*local.DistanceKm/radiusKm)
+		}
+		if factor == 1 {
+			continue
+		}
+		boosted[i].Score = withScore(boosted[i].Score, "hybrid", boosted[i].Score["hybrid"]*factor)
+		applied[boosted[i].ID] = append(applied[boosted[i].ID], models.AppliedBoost{Type: models.BoostLocal, Factor: factor, Value: local.StoreID})
+	}
+
+	// Stable sort keeps the fused order between equally scored products
+	slices.SortStableFunc(boosted, func(a, b models.SearchResult) int {
+		return cmp.Compare(b.Score["hybrid"], a.Score["hybrid"])
+	})
+	return boosted, applied
+}
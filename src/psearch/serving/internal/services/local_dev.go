@@ -0,0 +1,99 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"psearch/serving/internal/config"
+)
+
+// googleClient returns an HTTP client authorized with Application Default
+// Credentials for scope. DEV_MODE runs without credentials, so it gets an
+// unauthenticated client whose calls to Google APIs fail.
+func googleClient(ctx context.Context, cfg *config.Config, scope string) (*http.Client, error) {
+	if cfg.DevMode {
+		return &http.Client{}, nil
+	}
+	return google.DefaultClient(ctx, scope)
+}
+
+// spannerClientOptions points Spanner clients at the emulator when one is
+// configured. The emulator serves plaintext gRPC and takes no credentials.
+func spannerClientOptions(cfg *config.Config) []option.ClientOption {
+	if cfg.SpannerEmulatorHost == "" {
+		return nil
+	}
+	return []option.ClientOption{
+		option.WithEndpoint(cfg.SpannerEmulatorHost),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+}
+
+// localEmbedding computes a deterministic embedding for DEV_MODE by feature
+// hashing the text's words and their character trigrams into a unit vector.
+// Texts sharing words or word fragments are close, which is enough to
+// exercise vector search locally; it carries no semantics.
+func localEmbedding(text string, dimension int) ([]float32, int) {
+	vector := make([]float64, dimension)
+	add := func(feature string, weight float64) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%uint64(dimension)] += weight
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		add("w:"+word, 1)
+		padded := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(padded); i++ {
+			add("t:"+string(padded[i:i+3]), 0.5)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	embedding := make([]float32, dimension)
+	if norm == 0 {
+		// Cosine distance is undefined for the zero vector
+		embedding[0] = 1
+		return embedding, len(words)
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range vector {
+		embedding[i] = float32(v / norm)
+	}
+	return embedding, len(words)
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"strings"
+
+	"psearch/serving/internal/models"
+)
+
+// productLocalizations reads the translated text stored in product data
+// under "localizations", an object keyed by locale:
+//
+//	"localizations": {"de-DE": {"title": "...", "description": "..."}}
+//
+// Keys are normalized with normalizeLocale. It returns nil for products
+// without translations.
+func productLocalizations(productData map[string]interface{}) map[string]models.LocalizedText {
+	data, ok := productData["localizations"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var localizations map[string]models.LocalizedText
+	for locale, value := range data {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var text models.LocalizedText
+		text.Title, _ = fields["title"].(string)
+		text.Description, _ = fields["description"].(string)
+		if text == (models.LocalizedText{}) {
+			continue
+		}
+		if localizations == nil {
+			localizations = make(map[string]models.LocalizedText)
+		}
+		localizations[normalizeLocale(locale)] = text
+	}
+	return localizations
+}
+
+// normalizeLocale lower-cases a locale and separates its subtags with
+// hyphens, so "de_DE" and "de-de" match
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// LocalizeProduct replaces the result's title and description with its
+// translation for locale. The fallback chain is the exact locale, then its
+// language alone ("de" for "de-AT"), then the language in another region
+// ("de-de"), in locale order; without a match the product's own text is
+// kept. Localizations are cleared either way.
+func LocalizeProduct(result *models.SearchResult, locale string) {
+	localizations := result.Localizations
+	result.Localizations = nil
+	if len(localizations) == 0 || locale == "" {
+		return
+	}
+
+	text, ok := localizedText(localizations, normalizeLocale(locale))
+	if !ok {
+		return
+	}
+	if text.Title != "" {
+		result.Title = text.Title
+	}
+	if text.Description != "" {
+		result.Description = text.Description
+	}
+}
+
+// localizedText finds the translation for a normalized locale following
+// LocalizeProduct's fallback chain
+func localizedText(localizations map[string]models.LocalizedText, locale string) (models.LocalizedText, bool) {
+	if text, ok := localizations[locale]; ok {
+		return text, true
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	if text, ok := localizations[language]; ok {
+		return text, true
+	}
+
+	var best string
+	for key := range localizations {
+		if strings.HasPrefix(key, language+"-") && (best == "" || key < best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return models.LocalizedText{}, false
+	}
+	return localizations[best], true
+}
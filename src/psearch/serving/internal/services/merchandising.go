@@ -0,0 +1,122 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"slices"
+
+	"psearch/serving/internal/models"
+)
+
+// maxPinPosition is the last result position a rule may pin a product to
+const maxPinPosition = 3
+
+// PinnedProductIDs returns the products the rules pin, so callers can fetch
+// the ones retrieval did not return
+func PinnedProductIDs(rules []models.MerchandisingRule) []string {
+	var ids []string
+	for _, rule := range rules {
+		for _, pin := range rule.Pins {
+			if !slices.Contains(ids, pin.ProductID) {
+				ids = append(ids, pin.ProductID)
+			}
+		}
+	}
+	return ids
+}
+
+// ApplyRules reorders fused results by the matched rules: buried products
+// move to the end, boosted products to the front and pinned products to
+// their position. Pins outrank boosts, which outrank buries, and between
+// rules the first one to claim a product or position wins. Boosted and
+// buried products keep their relative order.
+//
+// pinned supplies pinned products missing from results; pins of products
+// found in neither are skipped. results itself is not modified, since it
+// may be shared with the result cache.
+func ApplyRules(results []models.SearchResult, rules []models.MerchandisingRule, pinned map[string]models.SearchResult) ([]models.SearchResult, []models.RuleTrace) {
+	traces := make([]models.RuleTrace, len(rules))
+	for i, rule := range rules {
+		traces[i] = models.RuleTrace{RuleID: rule.ID, Name: rule.Name}
+	}
+
+	byID := make(map[string]models.SearchResult, len(results))
+	for _, result := range results {
+		byID[result.ID] = result
+	}
+
+	pinAt := make(map[int]models.SearchResult)
+	pinnedIDs := make(map[string]bool)
+	for i, rule := range rules {
+		for _, pin := range rule.Pins {
+			if _, taken := pinAt[pin.Position]; taken || pinnedIDs[pin.ProductID] {
+				continue
+			}
+			result, ok := byID[pin.ProductID]
+			if !ok {
+				result, ok = pinned[pin.ProductID]
+			}
+			if !ok {
+				continue
+			}
+			pinAt[pin.Position] = result
+			pinnedIDs[pin.ProductID] = true
+			traces[i].Pinned = append(traces[i].Pinned, pin)
+		}
+	}
+
+	// Boosts and buries only move products that were retrieved
+	boosted := make(map[string]bool)
+	for i, rule := range rules {
+		for _, id := range rule.BoostProductIDs {
+			if _, ok := byID[id]; ok && !pinnedIDs[id] && !boosted[id] {
+				boosted[id] = true
+				traces[i].Boosted = append(traces[i].Boosted, id)
+			}
+		}
+	}
+	buried := make(map[string]bool)
+	for i, rule := range rules {
+		for _, id := range rule.BuryProductIDs {
+			if _, ok := byID[id]; ok && !pinnedIDs[id] && !boosted[id] && !buried[id] {
+				buried[id] = true
+				traces[i].Buried = append(traces[i].Buried, id)
+			}
+		}
+	}
+
+	var front, middle, back []models.SearchResult
+	for _, result := range results {
+		switch {
+		case pinnedIDs[result.ID]:
+		case boosted[result.ID]:
+			front = append(front, result)
+		case buried[result.ID]:
+			back = append(back, result)
+		default:
+			middle = append(middle, result)
+		}
+	}
+	ordered := slices.Concat(front, middle, back)
+
+	for position := 1; position <= maxPinPosition; position++ {
+		if result, ok := pinAt[position]; ok {
+			ordered = slices.Insert(ordered, min(position-1, len(ordered)), result)
+		}
+	}
+	return ordered, traces
+}
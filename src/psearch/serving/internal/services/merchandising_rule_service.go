@@ -0,0 +1,312 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// ErrMerchandisingRuleNotFound is returned when a merchandising rule does
+// not exist
+var ErrMerchandisingRuleNotFound = errors.New("merchandising rule not found")
+
+// ErrInvalidMerchandisingRule is wrapped by errors in a rule definition
+var ErrInvalidMerchandisingRule = errors.New("invalid merchandising rule")
+
+// compiledRule is a stored rule with its query pattern compiled
+type compiledRule struct {
+	rule models.MerchandisingRule
+	// pattern is nil when the rule only matches on category
+	pattern *regexp.Regexp
+}
+
+// MerchandisingRuleService stores boost, bury and pin rules and matches
+// them against searches. Rules are evaluated on every search, so all of
+// them are kept in memory and reloaded on an interval.
+type MerchandisingRuleService struct {
+	config  *config.Config
+	spanner *SpannerService
+
+	mu sync.RWMutex
+	// rules are ordered by ID, which is also the order they apply in
+	rules []compiledRule
+}
+
+// NewMerchandisingRuleService creates a new merchandising rule service
+func NewMerchandisingRuleService(cfg *config.Config, spannerSvc *SpannerService) *MerchandisingRuleService {
+	return &MerchandisingRuleService{
+		config:  cfg,
+		spanner: spannerSvc,
+	}
+}
+
+// Run loads the rules at startup and on every refresh interval until ctx is
+// done
+func (s *MerchandisingRuleService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.MerchandisingRuleRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("Warning: could not load merchandising rules: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh replaces the in-memory rules with the stored ones
+func (s *MerchandisingRuleService) Refresh(ctx context.Context) error {
+	stored, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules := make([]compiledRule, 0, len(stored))
+	for _, rule := range stored {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			log.Printf("Warning: skipping merchandising rule %s: %v", rule.ID, err)
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+	return nil
+}
+
+// compileRule compiles the rule's query pattern, case-insensitively
+func compileRule(rule models.MerchandisingRule) (compiledRule, error) {
+	compiled := compiledRule{rule: rule}
+	if rule.QueryPattern != "" {
+		pattern, err := regexp.Compile("(?i)" + rule.QueryPattern)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("%w: query_pattern: %v", ErrInvalidMerchandisingRule, err)
+		}
+		compiled.pattern = pattern
+	}
+	return compiled, nil
+}
+
+// Match returns the rules that apply to a search for query in category, in
+// the order they apply. category may be empty.
+func (s *MerchandisingRuleService) Match(query, category string) []models.MerchandisingRule {
+	query = strings.TrimSpace(query)
+	category = strings.ToLower(strings.TrimSpace(category))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []models.MerchandisingRule
+	for _, compiled := range s.rules {
+		if compiled.pattern != nil && !compiled.pattern.MatchString(query) {
+			continue
+		}
+		if compiled.rule.Category != "" && !inCategory(category, strings.ToLower(compiled.rule.Category)) {
+			continue
+		}
+		matched = append(matched, compiled.rule)
+	}
+	return matched
+}
+
+// inCategory reports whether category is parent or one of its
+// subcategories
+func inCategory(category, parent string) bool {
+	return category == parent || strings.HasPrefix(category, parent+categorySeparator)
+}
+
+// Put validates and creates or replaces the rule with the given ID
+func (s *MerchandisingRuleService) Put(ctx context.Context, id string, req models.MerchandisingRuleRequest) (*models.MerchandisingRule, error) {
+	compiled, mutation, err := prepareRule(id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	commitTimestamp, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save merchandising rule: %w", err)
+	}
+	compiled.rule.UpdatedAt = commitTimestamp
+
+	s.mu.Lock()
+	s.rules = append(removeRule(s.rules, id), compiled)
+	sort.Slice(s.rules, func(i, j int) bool { return s.rules[i].rule.ID < s.rules[j].rule.ID })
+	s.mu.Unlock()
+
+	return &compiled.rule, nil
+}
+
+// prepareRule validates and compiles the rule and returns the mutation
+// that stores it under id
+func prepareRule(id string, req models.MerchandisingRuleRequest) (compiledRule, *spanner.Mutation, error) {
+	if !templateIDPattern.MatchString(id) {
+		return compiledRule{}, nil, fmt.Errorf("%w: id must be 1-64 letters, digits, '_' or '-'", ErrInvalidMerchandisingRule)
+	}
+
+	rule := models.MerchandisingRule{
+		ID:              id,
+		Name:            req.Name,
+		QueryPattern:    strings.TrimSpace(req.QueryPattern),
+		Category:        strings.TrimSpace(req.Category),
+		BoostProductIDs: req.BoostProductIDs,
+		BuryProductIDs:  req.BuryProductIDs,
+		Pins:            req.Pins,
+	}
+	if rule.QueryPattern == "" && rule.Category == "" {
+		return compiledRule{}, nil, fmt.Errorf("%w: set query_pattern, category or both", ErrInvalidMerchandisingRule)
+	}
+	if len(rule.BoostProductIDs) == 0 && len(rule.BuryProductIDs) == 0 && len(rule.Pins) == 0 {
+		return compiledRule{}, nil, fmt.Errorf("%w: set boost_product_ids, bury_product_ids or pins", ErrInvalidMerchandisingRule)
+	}
+	positions := make(map[int]bool, len(rule.Pins))
+	for _, pin := range rule.Pins {
+		if pin.Position < 1 || pin.Position > maxPinPosition {
+			return compiledRule{}, nil, fmt.Errorf("%w: pin position must be between 1 and %d", ErrInvalidMerchandisingRule, maxPinPosition)
+		}
+		if positions[pin.Position] {
+			return compiledRule{}, nil, fmt.Errorf("%w: position %d is pinned twice", ErrInvalidMerchandisingRule, pin.Position)
+		}
+		positions[pin.Position] = true
+	}
+	compiled, err := compileRule(rule)
+	if err != nil {
+		return compiledRule{}, nil, err
+	}
+
+	mutation := spanner.InsertOrUpdateMap("merchandising_rules", map[string]interface{}{
+		"rule_id":           id,
+		"name":              rule.Name,
+		"query_pattern":     spanner.NullString{StringVal: rule.QueryPattern, Valid: rule.QueryPattern != ""},
+		"category":          spanner.NullString{StringVal: rule.Category, Valid: rule.Category != ""},
+		"boost_product_ids": rule.BoostProductIDs,
+		"bury_product_ids":  rule.BuryProductIDs,
+		"pins":              spanner.NullJSON{Value: rule.Pins, Valid: true},
+		"updated_at":        spanner.CommitTimestamp,
+	})
+	return compiled, mutation, nil
+}
+
+// removeRule returns rules without the one with the given ID. It does not
+// modify rules, which concurrent readers may hold.
+func removeRule(rules []compiledRule, id string) []compiledRule {
+	kept := make([]compiledRule, 0, len(rules))
+	for _, compiled := range rules {
+		if compiled.rule.ID != id {
+			kept = append(kept, compiled)
+		}
+	}
+	return kept
+}
+
+// Get returns a single merchandising rule
+func (s *MerchandisingRuleService) Get(ctx context.Context, id string) (*models.MerchandisingRule, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT rule_id, name, query_pattern, category, boost_product_ids, bury_product_ids, pins, updated_at
+              FROM merchandising_rules
+              WHERE rule_id = @id`,
+		Params: map[string]interface{}{"id": id},
+	}
+	rules, err := s.query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, ErrMerchandisingRuleNotFound
+	}
+	return &rules[0], nil
+}
+
+// List returns all merchandising rules
+func (s *MerchandisingRuleService) List(ctx context.Context) ([]models.MerchandisingRule, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT rule_id, name, query_pattern, category, boost_product_ids, bury_product_ids, pins, updated_at
+              FROM merchandising_rules
+              ORDER BY rule_id`,
+	}
+	return s.query(ctx, stmt)
+}
+
+// Delete removes a merchandising rule
+func (s *MerchandisingRuleService) Delete(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+
+	mutation := spanner.Delete("merchandising_rules", spanner.Key{id})
+	if _, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation}); err != nil {
+		return fmt.Errorf("failed to delete merchandising rule: %w", err)
+	}
+
+	s.mu.Lock()
+	s.rules = removeRule(s.rules, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// query runs a merchandising rule listing statement
+func (s *MerchandisingRuleService) query(ctx context.Context, stmt spanner.Statement) ([]models.MerchandisingRule, error) {
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var results []models.MerchandisingRule
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through merchandising rules: %w", err)
+		}
+
+		var rule models.MerchandisingRule
+		var name, queryPattern, category spanner.NullString
+		var pinsJSON spanner.NullJSON
+		if err := row.Columns(&rule.ID, &name, &queryPattern, &category, &rule.BoostProductIDs, &rule.BuryProductIDs, &pinsJSON, &rule.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan merchandising rule: %v", err)
+		}
+		rule.Name = name.StringVal
+		rule.QueryPattern = queryPattern.StringVal
+		rule.Category = category.StringVal
+		if err := decodeJSONColumn(pinsJSON, &rule.Pins); err != nil {
+			return nil, fmt.Errorf("failed to decode pins of merchandising rule %s: %v", rule.ID, err)
+		}
+
+		results = append(results, rule)
+	}
+	return results, nil
+}
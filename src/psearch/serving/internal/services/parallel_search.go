@@ -0,0 +1,211 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+)
+
+// branchRow is one candidate ranked by a retrieval branch
+type branchRow struct {
+	rank             int64
+	productID        string
+	productData      spanner.NullJSON
+	raw              float64
+	qualityFactor    float64
+	popularityFactor float64
+}
+
+// branchResult is the ranked output of one retrieval branch and its fusion
+// weight
+type branchResult struct {
+	ann    bool
+	weight float64
+	rows   []branchRow
+}
+
+// parallelSearchRows runs each retrieval branch as its own query, all
+// concurrently against txn's snapshot, and fuses them with the same
+// weighted reciprocal rank fusion as buildSearchSQL. ANN and FTS branches
+// rank at least ANNCandidateLimit and FTSCandidateLimit candidates
+// respectively. The returned statement combines the branch statements for
+// debug responses.
+func (s *SpannerService) parallelSearchRows(ctx context.Context, txn *spanner.ReadOnlyTransaction, opts SearchOptions, params map[string]interface{}, filterSQL string, annBranches int, demoteLowQuality bool, popularityColumn string) ([]searchRow, spanner.Statement, error) {
+	type branch struct {
+		ann        bool
+		index      int
+		candidates int
+		weight     float64
+	}
+	pageEnd := opts.Limit + opts.Offset
+	var branches []branch
+	if usesANN(opts.Mode) {
+		for i := 0; i < max(annBranches, 1); i++ {
+			branches = append(branches, branch{ann: true, index: i, candidates: max(opts.ANN.candidates(pageEnd), s.config.ANNCandidateLimit), weight: params["ann_weight"].(float64)})
+		}
+	}
+	if usesFTS(opts.Mode) {
+		branches = append(branches, branch{candidates: max(pageEnd, s.config.FTSCandidateLimit), weight: params["fts_weight"].(float64)})
+	}
+
+	// The first branch to fail cancels the others
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var firstErr error
+
+	stmts := make([]spanner.Statement, len(branches))
+	results := make([]branchResult, len(branches))
+	var wg sync.WaitGroup
+	for i, b := range branches {
+		branchParams := make(map[string]interface{}, len(params))
+		for name, value := range params {
+			branchParams[name] = value
+		}
+		branchParams["candidate_limit"] = b.candidates
+		stmts[i] = spanner.Statement{SQL: buildBranchSQL(b.ann, b.index, filterSQL, s.config.FTSFields, opts.Language != "", opts.Keyword, opts.ANN, demoteLowQuality, popularityColumn, !opts.IDsOnly), Params: branchParams}
+		results[i] = branchResult{ann: b.ann, weight: b.weight}
+
+		wg.Add(1)
+		go func(i int, b branch) {
+			defer wg.Done()
+			rows, err := s.branchRows(ctx, txn, stmts[i], b.candidates)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i].rows = rows
+		}(i, b)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, spanner.Statement{}, firstErr
+	}
+
+	return fuseBranches(results, opts.RRFK, opts.Limit, opts.Offset), combineStatements(stmts), nil
+}
+
+// branchRows runs a statement built by buildBranchSQL and scans its rows
+func (s *SpannerService) branchRows(ctx context.Context, txn *spanner.ReadOnlyTransaction, stmt spanner.Statement, candidateLimit int) ([]branchRow, error) {
+	iter := txn.QueryWithOptions(ctx, stmt, searchQueryOptions(ctx))
+	defer iter.Stop()
+
+	var rows []branchRow
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through branch results: %w", err)
+		}
+
+		var r branchRow
+		if err := row.Columns(&r.rank, &r.productID, &r.productData, &r.raw, &r.qualityFactor, &r.popularityFactor); err != nil {
+			return nil, fmt.Errorf("failed to scan branch result: %v", err)
+		}
+		rows = append(rows, r)
+	}
+
+	CostRecorderFromContext(ctx).RecordSpannerQuery(1, candidateLimit, iter.RowCount, iter.QueryStats)
+	return rows, nil
+}
+
+// fuseBranches fuses branch rankings into the page of results from offset,
+// matching buildSearchSQL: each product scores the weighted sum of
+// 1/(rrfK+rank) over the branches that retrieved it, times its quality and
+// popularity factors. Products only retrieved by zero-weight branches are
+// dropped. Ties are broken by product ID.
+func fuseBranches(branches []branchResult, rrfK, limit, offset int) []searchRow {
+	fused := make(map[string]*searchRow)
+	for _, b := range branches {
+		for _, r := range b.rows {
+			row, ok := fused[r.productID]
+			if !ok {
+				row = &searchRow{productID: r.productID, qualityFactor: r.qualityFactor, popularityFactor: r.popularityFactor}
+				fused[r.productID] = row
+			}
+			if !row.productData.Valid {
+				row.productData = r.productData
+			}
+
+			contribution := b.weight / float64(rrfK+int(r.rank))
+			row.score += contribution
+			if b.ann {
+				row.annContribution += contribution
+				if !row.annRank.Valid || r.rank < row.annRank.Int64 {
+					row.annRank = spanner.NullInt64{Int64: r.rank, Valid: true}
+				}
+				if !row.annDistance.Valid || r.raw < row.annDistance.Float64 {
+					row.annDistance = spanner.NullFloat64{Float64: r.raw, Valid: true}
+				}
+			} else {
+				row.ftsContribution += contribution
+				if !row.ftsRank.Valid || r.rank < row.ftsRank.Int64 {
+					row.ftsRank = spanner.NullInt64{Int64: r.rank, Valid: true}
+				}
+				if !row.ftsScore.Valid || r.raw > row.ftsScore.Float64 {
+					row.ftsScore = spanner.NullFloat64{Float64: r.raw, Valid: true}
+				}
+			}
+		}
+	}
+
+	rows := make([]searchRow, 0, len(fused))
+	for _, row := range fused {
+		if row.score <= 0 {
+			continue
+		}
+		row.score *= row.qualityFactor * row.popularityFactor
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].score != rows[j].score {
+			return rows[i].score > rows[j].score
+		}
+		return rows[i].productID < rows[j].productID
+	})
+
+	if offset >= len(rows) {
+		return nil
+	}
+	return rows[offset:min(offset+limit, len(rows))]
+}
+
+// combineStatements describes concurrently executed statements as one, for
+// debug responses
+func combineStatements(stmts []spanner.Statement) spanner.Statement {
+	sqls := make([]string, len(stmts))
+	params := make(map[string]interface{})
+	for i, stmt := range stmts {
+		sqls[i] = strings.TrimSpace(stmt.SQL)
+		for name, value := range stmt.Params {
+			params[name] = value
+		}
+	}
+	return spanner.Statement{SQL: strings.Join(sqls, "\n\n"), Params: params}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"psearch/serving/internal/models"
+)
+
+// rankedRows returns branch rows ranking productIDs in order, with neutral
+// quality and popularity factors
+func rankedRows(productIDs ...string) []branchRow {
+	rows := make([]branchRow, len(productIDs))
+	for i, id := range productIDs {
+		rows[i] = branchRow{rank: int64(i + 1), productID: id, qualityFactor: 1, popularityFactor: 1}
+	}
+	return rows
+}
+
+func fusedIDs(rows []searchRow) []string {
+	var ids []string
+	for _, row := range rows {
+		ids = append(ids, row.productID)
+	}
+	return ids
+}
+
+func TestFuseBranchesScores(t *testing.T) {
+	const rrfK = 60
+	p1Data := spanner.NullJSON{Value: map[string]interface{}{"id": "p1"}, Valid: true}
+	branches := []branchResult{
+		{ann: true, weight: 0.75, rows: []branchRow{
+			{rank: 1, productID: "p1", raw: 0.2, qualityFactor: 1, popularityFactor: 1},
+			{rank: 2, productID: "p2", raw: 0.3, qualityFactor: 1, popularityFactor: 1},
+		}},
+		// A second ANN branch, such as another embedding index partition
+		{ann: true, weight: 0.75, rows: []branchRow{
+			{rank: 3, productID: "p1", raw: 0.1, productData: p1Data, qualityFactor: 1, popularityFactor: 1},
+		}},
+		{weight: 0.25, rows: []branchRow{
+			{rank: 1, productID: "p3", raw: 4, qualityFactor: 0.5, popularityFactor: 2},
+			{rank: 2, productID: "p2", raw: 3, qualityFactor: 1, popularityFactor: 1},
+		}},
+	}
+
+	got := fuseBranches(branches, rrfK, 10, 0)
+
+	type fused struct {
+		score, ann, fts  float64
+		annRank, ftsRank spanner.NullInt64
+	}
+	rank := func(r int64) spanner.NullInt64 { return spanner.NullInt64{Int64: r, Valid: true} }
+	want := map[string]fused{
+		"p1": {score: 0.75/61 + 0.75/63, ann: 0.75/61 + 0.75/63, annRank: rank(1)},
+		"p2": {score: 0.75/62 + 0.25/62, ann: 0.75 / 62, fts: 0.25 / 62, annRank: rank(2), ftsRank: rank(2)},
+		"p3": {score: 0.25 / 61 * 0.5 * 2, fts: 0.25 / 61, ftsRank: rank(1)},
+	}
+	if ids, wantIDs := fusedIDs(got), []string{"p1", "p2", "p3"}; !reflect.DeepEqual(ids, wantIDs) {
+		t.Fatalf("fuseBranches() = %q, want %q", ids, wantIDs)
+	}
+	for _, row := range got {
+		w := want[row.productID]
+		if math.Abs(row.score-w.score) > 1e-12 || math.Abs(row.annContribution-w.ann) > 1e-12 || math.Abs(row.ftsContribution-w.fts) > 1e-12 {
+			t.Errorf("%s: score %v (ann %v, fts %v), want %v (ann %v, fts %v)", row.productID, row.score, row.annContribution, row.ftsContribution, w.score, w.ann, w.fts)
+		}
+		if row.annRank != w.annRank || row.ftsRank != w.ftsRank {
+			t.Errorf("%s: ranks ann %v fts %v, want ann %v fts %v", row.productID, row.annRank, row.ftsRank, w.annRank, w.ftsRank)
+		}
+	}
+
+	// The best rank, closest distance and best keyword score across
+	// branches are reported, with the first product data found
+	p1, p2 := got[0], got[1]
+	if p1.annDistance != (spanner.NullFloat64{Float64: 0.1, Valid: true}) || p1.ftsScore.Valid {
+		t.Errorf("p1: ann distance %v, fts score %v, want 0.1 and null", p1.annDistance, p1.ftsScore)
+	}
+	if !reflect.DeepEqual(p1.productData, p1Data) {
+		t.Errorf("p1: product data %v, want %v", p1.productData, p1Data)
+	}
+	if p2.annDistance.Float64 != 0.3 || p2.ftsScore != (spanner.NullFloat64{Float64: 3, Valid: true}) {
+		t.Errorf("p2: ann distance %v, fts score %v, want 0.3 and 3", p2.annDistance, p2.ftsScore)
+	}
+}
+
+func TestFuseBranchesWeights(t *testing.T) {
+	// Branch weights come from rrfWeights, as in buildSearchSQL, so products
+	// only retrieved by a branch the mode or alpha turns off are dropped
+	tests := []struct {
+		mode  models.SearchMode
+		alpha float64
+		want  []string
+	}{
+		{mode: models.SearchModeHybrid, alpha: 0.5, want: []string{"both", "ann", "fts"}},
+		{mode: models.SearchModeHybrid, alpha: 0.8, want: []string{"both", "ann", "fts"}},
+		{mode: models.SearchModeHybrid, alpha: 0.2, want: []string{"both", "fts", "ann"}},
+		{mode: models.SearchModeHybrid, alpha: 1, want: []string{"ann", "both"}},
+		{mode: models.SearchModeHybrid, alpha: 0, want: []string{"fts", "both"}},
+		{mode: models.SearchModeVector, alpha: 0.5, want: []string{"ann", "both"}},
+		{mode: models.SearchModeKeyword, alpha: 0.5, want: []string{"fts", "both"}},
+	}
+	for _, tt := range tests {
+		annWeight, ftsWeight := rrfWeights(tt.mode, tt.alpha)
+		branches := []branchResult{
+			{ann: true, weight: annWeight, rows: rankedRows("ann", "both")},
+			{weight: ftsWeight, rows: rankedRows("fts", "both")},
+		}
+		if got := fusedIDs(fuseBranches(branches, 60, 10, 0)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s alpha %v: fuseBranches() = %q, want %q", tt.mode, tt.alpha, got, tt.want)
+		}
+	}
+}
+
+func TestFuseBranchesTiesAndPaging(t *testing.T) {
+	// Equal scores are ordered by product ID, whichever branch ranked them
+	branches := []branchResult{
+		{ann: true, weight: 0.5, rows: rankedRows("d", "b")},
+		{weight: 0.5, rows: rankedRows("c", "a")},
+	}
+	if got, want := fusedIDs(fuseBranches(branches, 60, 10, 0)), []string{"c", "d", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fuseBranches() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		limit, offset int
+		want          []string
+	}{
+		{limit: 2, offset: 0, want: []string{"c", "d"}},
+		{limit: 2, offset: 1, want: []string{"d", "a"}},
+		{limit: 10, offset: 3, want: []string{"b"}},
+		{limit: 10, offset: 4, want: nil},
+	}
+	for _, tt := range tests {
+		if got := fusedIDs(fuseBranches(branches, 60, tt.limit, tt.offset)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("fuseBranches(limit %d, offset %d) = %q, want %q", tt.limit, tt.offset, got, tt.want)
+		}
+	}
+
+	if got := fuseBranches(nil, 60, 10, 0); len(got) != 0 {
+		t.Errorf("fuseBranches(no branches) = %q, want none", fusedIDs(got))
+	}
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// ErrUnsupportedCurrency is returned when a shopper asks for prices in a
+// currency without an exchange rate
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// PricingService converts product prices into the shopper's currency and
+// formats them for their locale. Rates come from EXCHANGE_RATES, replaced
+// by the EXCHANGE_RATES_URL feed when one is configured.
+type PricingService struct {
+	config     *config.Config
+	httpClient *http.Client
+
+	mu sync.RWMutex
+	// rates holds units of each currency per unit of the catalog currency
+	rates map[string]float64
+}
+
+// NewPricingService creates a pricing service seeded with the configured
+// exchange rates
+func NewPricingService(cfg *config.Config) *PricingService {
+	rates := map[string]float64{cfg.CatalogCurrencyCode: 1}
+	for code, rate := range cfg.ExchangeRates {
+		rates[code] = rate
+	}
+	return &PricingService{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		rates:      rates,
+	}
+}
+
+// Run refreshes the rates from the feed at startup and on every refresh
+// interval until ctx is done. It returns at once when no feed is configured.
+func (s *PricingService) Run(ctx context.Context) {
+	if s.config.ExchangeRatesURL == "" {
+		return
+	}
+	ticker := time.NewTicker(s.config.ExchangeRatesRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("Warning: could not refresh exchange rates, keeping the previous ones: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// exchangeRateFeed is the body EXCHANGE_RATES_URL serves: units of each
+// currency per unit of base
+type exchangeRateFeed struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Refresh replaces the rates with the feed's, rebased onto the catalog
+// currency
+func (s *PricingService) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.ExchangeRatesURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("exchange rate feed returned status %d", resp.StatusCode)
+	}
+
+	var feed exchangeRateFeed
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return fmt.Errorf("invalid exchange rate feed: %v", err)
+	}
+	if feed.Rates == nil {
+		return fmt.Errorf("exchange rate feed has no rates")
+	}
+	feed.Rates[strings.ToUpper(feed.Base)] = 1
+	catalogRate, ok := feed.Rates[s.config.CatalogCurrencyCode]
+	if !ok || catalogRate <= 0 {
+		return fmt.Errorf("exchange rate feed has no rate for %s", s.config.CatalogCurrencyCode)
+	}
+
+	rates := make(map[string]float64, len(feed.Rates))
+	for code, rate := range feed.Rates {
+		if rate > 0 {
+			rates[strings.ToUpper(code)] = rate / catalogRate
+		}
+	}
+
+	s.mu.Lock()
+	s.rates = rates
+	s.mu.Unlock()
+	log.Printf("Loaded %d exchange rates", len(rates))
+	return nil
+}
+
+// Supports reports whether prices can be converted to currency
+func (s *PricingService) Supports(currency string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.rates[currency]
+	return ok
+}
+
+// Convert converts an amount between currencies
+func (s *PricingService) Convert(amount float64, from, to string) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+	s.mu.RLock()
+	fromRate, fromOK := s.rates[from]
+	toRate, toOK := s.rates[to]
+	s.mu.RUnlock()
+	if !fromOK {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, from)
+	}
+	if !toOK {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, to)
+	}
+	return amount / fromRate * toRate, nil
+}
+
+// Localize converts a product's prices to currency, when set, and fills in
+// their display strings for locale. Prices whose currency has no exchange
+// rate are left in their own currency.
+func (s *PricingService) Localize(price *models.PriceInfo, currency, locale string) {
+	from := price.CurrencyCode
+	if from == "" {
+		from = s.config.CatalogCurrencyCode
+	}
+	if currency == "" {
+		currency = from
+	}
+	if locale == "" {
+		locale = s.config.DefaultLocale
+	}
+
+	if currency != from {
+		if _, err := s.Convert(0, from, currency); err == nil {
+			for _, amount := range []*string{&price.Price, &price.OriginalPrice, &price.Cost} {
+				if value, err := strconv.ParseFloat(*amount, 64); err == nil {
+					converted, _ := s.Convert(value, from, currency)
+					*amount = strconv.FormatFloat(roundToMinorUnit(converted, currency), 'f', currencyDigits(currency), 64)
+				}
+			}
+			price.CurrencyCode = currency
+		}
+	}
+
+	if value, err := strconv.ParseFloat(price.Price, 64); err == nil {
+		price.FormattedPrice = FormatPrice(value, price.CurrencyCode, locale)
+	}
+	if value, err := strconv.ParseFloat(price.OriginalPrice, 64); err == nil {
+		price.FormattedOriginalPrice = FormatPrice(value, price.CurrencyCode, locale)
+	}
+}
+
+// numberFormat is how a locale writes amounts of money
+type numberFormat struct {
+	decimal, group string
+	// symbolAfter places the currency symbol after the amount, separated
+	// by a space
+	symbolAfter bool
+}
+
+// localeFormats maps languages to their number format. Unlisted languages
+// use English conventions.
+var localeFormats = map[string]numberFormat{
+	"en": {decimal: ".", group: ","},
+	"ja": {decimal: ".", group: ","},
+	"ko": {decimal: ".", group: ","},
+	"zh": {decimal: ".", group: ","},
+	"de": {decimal: ",", group: ".", symbolAfter: true},
+	"es": {decimal: ",", group: ".", symbolAfter: true},
+	"it": {decimal: ",", group: ".", symbolAfter: true},
+	"nl": {decimal: ",", group: ".", symbolAfter: true},
+	"pt": {decimal: ",", group: ".", symbolAfter: true},
+	"fr": {decimal: ",", group: " ", symbolAfter: true},
+	"pl": {decimal: ",", group: " ", symbolAfter: true},
+	"sv": {decimal: ",", group: " ", symbolAfter: true},
+}
+
+// currencySymbols maps currencies to their display symbol. Others are
+// shown by code.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "CN¥",
+	"KRW": "₩",
+	"INR": "₹",
+	"CAD": "CA$",
+	"AUD": "A$",
+	"BRL": "R$",
+}
+
+// zeroDecimalCurrencies have no minor unit
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true, "KRW": true, "VND": true, "CLP": true, "ISK": true,
+}
+
+// currencyDigits returns the number of decimal places of a currency
+func currencyDigits(currency string) int {
+	if zeroDecimalCurrencies[currency] {
+		return 0
+	}
+	return 2
+}
+
+// roundToMinorUnit rounds an amount to the currency's smallest unit
+func roundToMinorUnit(amount float64, currency string) float64 {
+	scale := math.Pow10(currencyDigits(currency))
+	return math.Round(amount*scale) / scale
+}
+
+// FormatPrice formats an amount of a currency for display in a locale such
+// as "en-US" or "de_DE", e.g. "$1,234.50" or "1.234,50 €"
+func FormatPrice(amount float64, currency, locale string) string {
+	language, _, _ := strings.Cut(strings.ReplaceAll(strings.ToLower(locale), "_", "-"), "-")
+	format, ok := localeFormats[language]
+	if !ok {
+		format = localeFormats["en"]
+	}
+
+	digits := currencyDigits(currency)
+	text := strconv.FormatFloat(math.Abs(roundToMinorUnit(amount, currency)), 'f', digits, 64)
+	integer, fraction, _ := strings.Cut(text, ".")
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteString(format.group)
+		}
+		grouped.WriteRune(digit)
+	}
+	number := grouped.String()
+	if fraction != "" {
+		number += format.decimal + fraction
+	}
+	if amount < 0 {
+		number = "-" + number
+	}
+
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+		if !format.symbolAfter {
+			symbol += " "
+		}
+	}
+	if format.symbolAfter {
+		return number + " " + symbol
+	}
+	return symbol + number
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+)
+
+// Product change event types
+const (
+	ProductEventPriceDrop   = "PRICE_DROP"
+	ProductEventBackInStock = "BACK_IN_STOCK"
+)
+
+// inStock is the availability value of purchasable products
+const inStock = "IN_STOCK"
+
+// ProductState is the tracked part of a product at one point in its history
+type ProductState struct {
+	Price        spanner.NullFloat64 `json:"-"`
+	CurrencyCode string              `json:"currency_code,omitempty"`
+	Availability string              `json:"availability,omitempty"`
+}
+
+// MarshalJSON renders the price as a plain number, or omits it when unknown
+func (p ProductState) MarshalJSON() ([]byte, error) {
+	type state ProductState
+	out := struct {
+		Price *float64 `json:"price,omitempty"`
+		state
+	}{state: state(p)}
+	if p.Price.Valid {
+		out.Price = &p.Price.Float64
+	}
+	return json.Marshal(out)
+}
+
+// ProductChangeEvent is emitted when an ingested product's price drops or it
+// comes back in stock
+type ProductChangeEvent struct {
+	EventType        string       `json:"event_type"`
+	ProductID        string       `json:"product_id"`
+	CatalogID        string       `json:"catalog_id,omitempty"`
+	Previous         ProductState `json:"previous"`
+	Current          ProductState `json:"current"`
+	PriceDropPercent float64      `json:"price_drop_percent,omitempty"`
+	DetectedAt       time.Time    `json:"detected_at"`
+}
+
+// ProductChangeService compares ingested products with their change history
+// and emits price drop and back-in-stock events
+type ProductChangeService struct {
+	config    *config.Config
+	spanner   *SpannerService
+	publisher *PubSubService
+}
+
+// NewProductChangeService creates a new product change service
+func NewProductChangeService(cfg *config.Config, spannerSvc *SpannerService, publisher *PubSubService) *ProductChangeService {
+	return &ProductChangeService{
+		config:    cfg,
+		spanner:   spannerSvc,
+		publisher: publisher,
+	}
+}
+
+// DetectChanges records the current price and availability of the products
+// in product_change_history and returns the events for transitions since the
+// previous entry. Products seen for the first time only get a history entry.
+// A catalog ID leaves out products of other catalogs.
+func (s *ProductChangeService) DetectChanges(ctx context.Context, catalogID string, productIDs []string) ([]ProductChangeEvent, error) {
+	if len(productIDs) == 0 {
+		return nil, nil
+	}
+
+	current, err := s.currentStates(ctx, catalogID, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.latestHistory(ctx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var events []ProductChangeEvent
+	var mutations []*spanner.Mutation
+	for productID, state := range current {
+		prev, seen := previous[productID]
+		if seen && prev == state {
+			continue
+		}
+		mutations = append(mutations, spanner.Insert("product_change_history",
+			[]string{"product_id", "changed_at", "price", "currency_code", "availability"},
+			[]interface{}{productID, spanner.CommitTimestamp, state.Price, state.CurrencyCode, state.Availability}))
+		if !seen {
+			continue
+		}
+
+		if drop := priceDropPercent(prev, state); drop >= s.config.PriceDropMinPercent {
+			events = append(events, ProductChangeEvent{
+				EventType:        ProductEventPriceDrop,
+				ProductID:        productID,
+				CatalogID:        catalogID,
+				Previous:         prev,
+				Current:          state,
+				PriceDropPercent: drop,
+				DetectedAt:       now,
+			})
+		}
+		if prev.Availability != inStock && state.Availability == inStock {
+			events = append(events, ProductChangeEvent{
+				EventType:  ProductEventBackInStock,
+				ProductID:  productID,
+				CatalogID:  catalogID,
+				Previous:   prev,
+				Current:    state,
+				DetectedAt: now,
+			})
+		}
+	}
+
+	// Publish before recording history so failed deliveries are detected
+	// again on the next ingestion of the product
+	for _, event := range events {
+		if err := s.publish(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(mutations) > 0 {
+		if _, err := s.spanner.client.Apply(ctx, mutations); err != nil {
+			return nil, fmt.Errorf("failed to record product change history: %w", err)
+		}
+	}
+
+	log.Printf("Detected %d product change events across %d products", len(events), len(productIDs))
+	return events, nil
+}
+
+// priceDropPercent returns how far the price fell, or 0 if it did not fall
+// or cannot be compared
+func priceDropPercent(prev, current ProductState) float64 {
+	if !prev.Price.Valid || !current.Price.Valid || prev.Price.Float64 <= 0 {
+		return 0
+	}
+	if prev.CurrencyCode != current.CurrencyCode || current.Price.Float64 >= prev.Price.Float64 {
+		return 0
+	}
+	return (prev.Price.Float64 - current.Price.Float64) / prev.Price.Float64 * 100
+}
+
+// publish emits the event to the configured topic, or logs it when no topic
+// is configured
+func (s *ProductChangeService) publish(ctx context.Context, event ProductChangeEvent) error {
+	if s.config.ProductEventsTopic == "" || s.publisher == nil {
+		payload, _ := json.Marshal(event)
+		log.Printf("Product change event: %s", payload)
+		return nil
+	}
+
+	attributes := map[string]string{
+		"event_type": event.EventType,
+		"product_id": event.ProductID,
+	}
+	if event.CatalogID != "" {
+		attributes["catalog_id"] = event.CatalogID
+	}
+	return s.publisher.PublishJSON(ctx, s.config.ProductEventsTopic, event, attributes)
+}
+
+// currentStates reads the tracked fields of the products as ingested
+func (s *ProductChangeService) currentStates(ctx context.Context, catalogID string, productIDs []string) (map[string]ProductState, error) {
+	params := map[string]interface{}{"product_ids": productIDs}
+	stmt := spanner.Statement{
+		SQL: `SELECT product_id,
+                     SAFE_CAST(JSON_VALUE(product_data, '$.priceInfo.price') AS FLOAT64),
+                     JSON_VALUE(product_data, '$.priceInfo.currencyCode'),
+                     JSON_VALUE(product_data, '$.availability')
+              FROM products
+              WHERE product_id IN UNNEST(@product_ids)` + andClause(catalogClause("catalog_id", catalogID, params)),
+		Params: params,
+	}
+	return s.readStates(ctx, stmt)
+}
+
+// latestHistory reads the most recent history entry of each product
+func (s *ProductChangeService) latestHistory(ctx context.Context, productIDs []string) (map[string]ProductState, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT h.product_id, h.price, h.currency_code, h.availability
+              FROM product_change_history h
+              WHERE h.product_id IN UNNEST(@product_ids)
+                AND h.changed_at = (
+                  SELECT MAX(l.changed_at) FROM product_change_history l WHERE l.product_id = h.product_id)`,
+		Params: map[string]interface{}{"product_ids": productIDs},
+	}
+	return s.readStates(ctx, stmt)
+}
+
+// readStates scans (product_id, price, currency_code, availability) rows
+func (s *ProductChangeService) readStates(ctx context.Context, stmt spanner.Statement) (map[string]ProductState, error) {
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	states := make(map[string]ProductState)
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through product states: %w", err)
+		}
+
+		var productID string
+		var price spanner.NullFloat64
+		var currencyCode, availability spanner.NullString
+		if err := row.Columns(&productID, &price, &currencyCode, &availability); err != nil {
+			return nil, fmt.Errorf("failed to scan product state: %v", err)
+		}
+
+		state := ProductState{
+			Price:        price,
+			CurrencyCode: currencyCode.StringVal,
+			Availability: availability.StringVal,
+		}
+		// Products without an availability are served as in stock
+		if state.Availability == "" {
+			state.Availability = inStock
+		}
+		states[productID] = state
+	}
+	return states, nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/cache"
+)
+
+// DeleteProduct deletes a product from the catalog, returning
+// ErrProductNotFound if it does not exist there. A hard delete removes the
+// row and the rows interleaved in it. A soft delete keeps the row but sets
+// its deleted_at tombstone, which hides it from search, browse, similar
+// products and product reads until RestoreProduct clears it.
+func (s *SpannerService) DeleteProduct(ctx context.Context, catalogID, productID string, soft bool) error {
+	mutation := spanner.Delete("products", spanner.Key{productID})
+	if soft {
+		mutation = spanner.Update("products", []string{"product_id", "deleted_at"}, []interface{}{productID, spanner.CommitTimestamp})
+	}
+	if err := s.writeProduct(ctx, catalogID, productID, mutation); err != nil {
+		return fmt.Errorf("failed to delete product %s: %w", productID, err)
+	}
+	return nil
+}
+
+// RestoreProduct clears the tombstone of a soft-deleted product so it is
+// served again. Restoring a product that is not deleted does nothing.
+func (s *SpannerService) RestoreProduct(ctx context.Context, catalogID, productID string) error {
+	mutation := spanner.Update("products", []string{"product_id", "deleted_at"}, []interface{}{productID, nil})
+	if err := s.writeProduct(ctx, catalogID, productID, mutation); err != nil {
+		return fmt.Errorf("failed to restore product %s: %w", productID, err)
+	}
+	return nil
+}
+
+// writeProduct applies a mutation to a product once it is confirmed to be
+// in the catalog, then invalidates its cache entries
+func (s *SpannerService) writeProduct(ctx context.Context, catalogID, productID string, mutation *spanner.Mutation) error {
+	_, err := s.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		row, err := txn.ReadRow(ctx, "products", spanner.Key{productID}, []string{"catalog_id"})
+		if spanner.ErrCode(err) == codes.NotFound {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var productCatalog spanner.NullString
+		if err := row.Columns(&productCatalog); err != nil {
+			return err
+		}
+		if !inCatalog(catalogID, productCatalog) {
+			return ErrProductNotFound
+		}
+		return txn.BufferWrite([]*spanner.Mutation{mutation})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateProduct(productID)
+	return nil
+}
+
+// invalidateProduct drops the cached product and the cached results that
+// contain it after a write. Other replicas' local caches catch up when
+// their entries expire; the shared Redis cache is invalidated immediately.
+func (s *SpannerService) invalidateProduct(productID string) {
+	s.products.InvalidateTag(cache.ProductTag(productID))
+	s.results.InvalidateTag(cache.ProductTag(productID))
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+)
+
+// ScanProducts calls fn with the product_data of every live product in
+// catalogID, or in all catalogs when catalogID is empty, in product ID
+// order. It stops at the first error fn returns. The scan reads a single
+// snapshot, so products changed while it runs are seen as of its start.
+func (s *SpannerService) ScanProducts(ctx context.Context, catalogID string, fn func(productID string, productData map[string]interface{}) error) error {
+	params := make(map[string]interface{})
+	stmt := spanner.Statement{
+		SQL: `SELECT product_id, product_data
+              FROM products
+              WHERE deleted_at IS NULL` + andClause(catalogClause("catalog_id", catalogID, params)) + `
+              ORDER BY product_id`,
+		Params: params,
+	}
+
+	iter := s.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error iterating through products: %w", err)
+		}
+		var productID string
+		var productDataJSON spanner.NullJSON
+		if err := row.Columns(&productID, &productDataJSON); err != nil {
+			return fmt.Errorf("failed to scan product: %v", err)
+		}
+		productData, _ := productDataJSON.Value.(map[string]interface{})
+		if productData == nil {
+			continue
+		}
+		if err := fn(productID, productData); err != nil {
+			return err
+		}
+	}
+}
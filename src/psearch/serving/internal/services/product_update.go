@@ -0,0 +1,259 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/models"
+)
+
+// ErrInvalidProductPatch is returned for patches that cannot be applied,
+// such as ones changing the product ID
+var ErrInvalidProductPatch = errors.New("invalid product patch")
+
+// ProductUpdate is the outcome of UpdateProduct
+type ProductUpdate struct {
+	Product models.SearchResult
+	// Reembedded is set when the patch changed the embedded text and the
+	// embedding was regenerated
+	Reembedded bool
+}
+
+// UpdateProduct merges a JSON merge patch (RFC 7396) into a product's
+// product_data: objects are merged recursively, null removes a field and
+// any other value replaces it. The embeddings, one per served embedding
+// version, are only regenerated when the patch changes the title or
+// description, so price and inventory updates never wait on Vertex AI. It returns ErrProductNotFound if the product is
+// not in the catalog.
+func (s *SpannerService) UpdateProduct(ctx context.Context, catalogID, productID string, patch map[string]interface{}) (*ProductUpdate, error) {
+	if id, ok := patch["id"]; ok && id != productID {
+		return nil, fmt.Errorf("%w: id cannot be changed", ErrInvalidProductPatch)
+	}
+
+	// Embeddings are kept across transaction retries so an aborted commit
+	// does not embed the same text again
+	embeddings := make(map[string][]float32)
+	var update ProductUpdate
+	var merged map[string]interface{}
+	_, err := s.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		update = ProductUpdate{}
+		row, err := txn.ReadRow(ctx, "products", spanner.Key{productID}, []string{"catalog_id", "product_data"})
+		if spanner.ErrCode(err) == codes.NotFound {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var productCatalog spanner.NullString
+		var productDataJSON spanner.NullJSON
+		if err := row.Columns(&productCatalog, &productDataJSON); err != nil {
+			return err
+		}
+		if !inCatalog(catalogID, productCatalog) {
+			return ErrProductNotFound
+		}
+
+		current, _ := productDataJSON.Value.(map[string]interface{})
+		if current == nil {
+			current = map[string]interface{}{}
+		}
+		before := productEmbeddingText(current)
+		merged = mergePatch(current, patch).(map[string]interface{})
+
+		columns := []string{"product_id", "product_data", "title"}
+		values := []interface{}{productID, spanner.NullJSON{Value: merged, Valid: true}, productTitle(merged)}
+		if text := productEmbeddingText(merged); text != before {
+			embeddingColumns, embeddingValues, err := s.documentEmbeddings(ctx, text, embeddings)
+			if err != nil {
+				return err
+			}
+			columns = append(columns, embeddingColumns...)
+			values = append(values, embeddingValues...)
+			update.Reembedded = true
+		}
+		return txn.BufferWrite([]*spanner.Mutation{spanner.Update("products", columns, values)})
+	})
+	if err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update product %s: %w", productID, err)
+	}
+
+	s.invalidateProduct(productID)
+	log.Printf("Updated product %s (reembedded=%t)", productID, update.Reembedded)
+
+	update.Product, err = s.TransformProduct(productID, merged)
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// UpsertProduct writes a product's full product_data, inserting the product
+// if it is new and clearing any soft-delete tombstone. As with
+// UpdateProduct, the embedding is only regenerated when the embedded text
+// changed or the product has none. It returns ErrInvalidProductPatch if
+// the product data names another product ID or the product belongs to
+// another catalog.
+func (s *SpannerService) UpsertProduct(ctx context.Context, catalogID, productID string, productData map[string]interface{}) (*ProductUpdate, error) {
+	if id, ok := productData["id"]; ok && id != productID {
+		return nil, fmt.Errorf("%w: product data id %v does not match %s", ErrInvalidProductPatch, id, productID)
+	}
+	productData["id"] = productID
+
+	embeddings := make(map[string][]float32)
+	var update ProductUpdate
+	_, err := s.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		update = ProductUpdate{}
+		before, embedded := "", false
+		row, err := txn.ReadRow(ctx, "products", spanner.Key{productID}, []string{"catalog_id", "product_data", "embedding"})
+		switch {
+		case spanner.ErrCode(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			var productCatalog spanner.NullString
+			var productDataJSON spanner.NullJSON
+			var embedding []float32
+			if err := row.Columns(&productCatalog, &productDataJSON, &embedding); err != nil {
+				return err
+			}
+			if catalogID != "" && productCatalog.Valid && productCatalog.StringVal != catalogID {
+				return fmt.Errorf("%w: product %s belongs to catalog %s", ErrInvalidProductPatch, productID, productCatalog.StringVal)
+			}
+			current, _ := productDataJSON.Value.(map[string]interface{})
+			before, embedded = productEmbeddingText(current), len(embedding) > 0
+		}
+
+		columns := []string{"product_id", "product_data", "title", "deleted_at"}
+		values := []interface{}{productID, spanner.NullJSON{Value: productData, Valid: true}, productTitle(productData), nil}
+		if catalogID != "" {
+			columns = append(columns, "catalog_id")
+			values = append(values, catalogID)
+		}
+		if text := productEmbeddingText(productData); text != before || !embedded {
+			embeddingColumns, embeddingValues, err := s.documentEmbeddings(ctx, text, embeddings)
+			if err != nil {
+				return err
+			}
+			columns = append(columns, embeddingColumns...)
+			values = append(values, embeddingValues...)
+			update.Reembedded = true
+		}
+		return txn.BufferWrite([]*spanner.Mutation{spanner.InsertOrUpdate("products", columns, values)})
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidProductPatch) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to upsert product %s: %w", productID, err)
+	}
+
+	s.invalidateProduct(productID)
+	log.Printf("Upserted product %s (reembedded=%t)", productID, update.Reembedded)
+
+	update.Product, err = s.TransformProduct(productID, productData)
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// mergePatch applies a JSON merge patch to target, returning the result.
+// Objects in target are modified in place.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// productTitle returns the value of the products.title column for product
+// data: its title, or its name when it has none
+func productTitle(productData map[string]interface{}) string {
+	if title, _ := productData["title"].(string); title != "" {
+		return title
+	}
+	name, _ := productData["name"].(string)
+	return name
+}
+
+// productEmbeddingText returns the product text the embedding is generated
+// from: the title and description
+func productEmbeddingText(productData map[string]interface{}) string {
+	description, _ := productData["description"].(string)
+	var parts []string
+	for _, part := range []string{productTitle(productData), description} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// WriteProducts writes products, keyed by ID, in a single commit without
+// reading them first, so every product is embedded with each served
+// embedding version whether or not its text changed. It is meant for
+// loading whole catalogs, such as benchmark fixtures; keep batches within
+// Spanner's mutation limit.
+func (s *SpannerService) WriteProducts(ctx context.Context, catalogID string, products map[string]map[string]interface{}) error {
+	embeddings := make(map[string][]float32)
+	mutations := make([]*spanner.Mutation, 0, len(products))
+	for productID, productData := range products {
+		productData["id"] = productID
+		columns := []string{"product_id", "product_data", "title", "deleted_at"}
+		values := []interface{}{productID, spanner.NullJSON{Value: productData, Valid: true}, productTitle(productData), nil}
+		if catalogID != "" {
+			columns = append(columns, "catalog_id")
+			values = append(values, catalogID)
+		}
+		embeddingColumns, embeddingValues, err := s.documentEmbeddings(ctx, productEmbeddingText(productData), embeddings)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, embeddingColumns...)
+		values = append(values, embeddingValues...)
+		mutations = append(mutations, spanner.InsertOrUpdate("products", columns, values))
+	}
+	if _, err := s.client.Apply(ctx, mutations); err != nil {
+		return fmt.Errorf("failed to write %d products: %w", len(products), err)
+	}
+	for productID := range products {
+		s.invalidateProduct(productID)
+	}
+	return nil
+}
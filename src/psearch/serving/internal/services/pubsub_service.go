@@ -0,0 +1,214 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"psearch/serving/internal/config"
+)
+
+// PubSubService publishes messages to Pub/Sub topics via the REST API
+type PubSubService struct {
+	config     *config.Config
+	httpClient *http.Client
+}
+
+// NewPubSubService creates a new Pub/Sub publisher using REST
+func NewPubSubService(ctx context.Context, cfg *config.Config) (*PubSubService, error) {
+	client, err := googleClient(ctx, cfg, "https://www.googleapis.com/auth/pubsub")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create default google client for Pub/Sub: %v", err)
+	}
+
+	return &PubSubService{
+		config:     cfg,
+		httpClient: client,
+	}, nil
+}
+
+// pubsubMessage is a message in a Pub/Sub publish request
+type pubsubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Publish sends a single message to the topic. The topic may be a short name
+// in the configured project or a full projects/{project}/topics/{topic} path.
+func (s *PubSubService) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) error {
+	return s.publish(ctx, topic, []pubsubMessage{{Data: data, Attributes: attributes}})
+}
+
+// publish sends messages to the topic in a single request
+func (s *PubSubService) publish(ctx context.Context, topic string, messages []pubsubMessage) error {
+	topicPath := topic
+	if !strings.HasPrefix(topic, "projects/") {
+		topicPath = fmt.Sprintf("projects/%s/topics/%s", s.config.ProjectID, topic)
+	}
+	url := fmt.Sprintf("https://pubsub.googleapis.com/v1/%s:publish", topicPath)
+
+	requestPayload := struct {
+		Messages []pubsubMessage `json:"messages"`
+	}{
+		Messages: messages,
+	}
+
+	jsonBody, err := json.Marshal(requestPayload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal publish request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create publish request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %v", topicPath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("publish to %s failed with status %d: %s", topicPath, resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// PublishJSON marshals the event and publishes it to the topic
+func (s *PubSubService) PublishJSON(ctx context.Context, topic string, event interface{}, attributes map[string]string) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	return s.Publish(ctx, topic, data, attributes)
+}
+
+// PublishJSONBatch marshals each event into its own message and publishes
+// them to the topic in a single request. attributes returns the attributes
+// of the i-th message and may be nil.
+func (s *PubSubService) PublishJSONBatch(ctx context.Context, topic string, events []interface{}, attributes func(i int) map[string]string) error {
+	messages := make([]pubsubMessage, len(events))
+	for i, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %v", err)
+		}
+		messages[i].Data = data
+		if attributes != nil {
+			messages[i].Attributes = attributes(i)
+		}
+	}
+	return s.publish(ctx, topic, messages)
+}
+
+// ReceivedMessage is a message pulled from a subscription
+type ReceivedMessage struct {
+	AckID   string `json:"ackId"`
+	Message struct {
+		Data        []byte            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageID   string            `json:"messageId"`
+		OrderingKey string            `json:"orderingKey"`
+	} `json:"message"`
+	// DeliveryAttempt counts deliveries of the message. Pub/Sub only sets
+	// it on subscriptions with a dead-letter policy.
+	DeliveryAttempt int `json:"deliveryAttempt"`
+}
+
+// Pull receives up to maxMessages messages from the subscription, which may
+// be a short name in the configured project or a full
+// projects/{project}/subscriptions/{subscription} path. It returns once
+// messages are available or the server's pull timeout elapses, with no
+// messages.
+func (s *PubSubService) Pull(ctx context.Context, subscription string, maxMessages int) ([]ReceivedMessage, error) {
+	var resp struct {
+		ReceivedMessages []ReceivedMessage `json:"receivedMessages"`
+	}
+	payload := map[string]interface{}{"maxMessages": maxMessages}
+	if err := s.subscriptionCall(ctx, subscription, "pull", payload, &resp); err != nil {
+		return nil, err
+	}
+	return resp.ReceivedMessages, nil
+}
+
+// Acknowledge acknowledges messages so they are not redelivered
+func (s *PubSubService) Acknowledge(ctx context.Context, subscription string, ackIDs []string) error {
+	if len(ackIDs) == 0 {
+		return nil
+	}
+	return s.subscriptionCall(ctx, subscription, "acknowledge", map[string]interface{}{"ackIds": ackIDs}, nil)
+}
+
+// ModifyAckDeadline sets the ack deadline of messages. A zero deadline
+// negatively acknowledges them, so they are redelivered.
+func (s *PubSubService) ModifyAckDeadline(ctx context.Context, subscription string, ackIDs []string, deadline time.Duration) error {
+	if len(ackIDs) == 0 {
+		return nil
+	}
+	payload := map[string]interface{}{"ackIds": ackIDs, "ackDeadlineSeconds": int(deadline.Seconds())}
+	return s.subscriptionCall(ctx, subscription, "modifyAckDeadline", payload, nil)
+}
+
+// subscriptionCall posts payload to a subscription method and decodes the
+// response into result, if it is not nil
+func (s *PubSubService) subscriptionCall(ctx context.Context, subscription, method string, payload interface{}, result interface{}) error {
+	subscriptionPath := subscription
+	if !strings.HasPrefix(subscription, "projects/") {
+		subscriptionPath = fmt.Sprintf("projects/%s/subscriptions/%s", s.config.ProjectID, subscription)
+	}
+	url := fmt.Sprintf("https://pubsub.googleapis.com/v1/%s:%s", subscriptionPath, method)
+
+	jsonBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %v", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %v", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to %s %s: %w", method, subscriptionPath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s on %s failed with status %d: %s", method, subscriptionPath, resp.StatusCode, string(body))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode %s response: %v", method, err)
+	}
+	return nil
+}
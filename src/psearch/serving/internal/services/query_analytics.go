@@ -0,0 +1,320 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// otherQueries is the query_analytics key under which queries beyond
+// ANALYTICS_MAX_QUERIES are counted. Normalized queries are never empty.
+const otherQueries = ""
+
+// queryAnalyticsFlushBatch bounds the rows updated per transaction
+const queryAnalyticsFlushBatch = 1000
+
+// queryTotals are the searches for a query in one hour
+type queryTotals struct {
+	searches    int64
+	zeroResults int64
+	latencyMs   float64
+}
+
+// add adds other to t
+func (t *queryTotals) add(other queryTotals) {
+	t.searches += other.searches
+	t.zeroResults += other.zeroResults
+	t.latencyMs += other.latencyMs
+}
+
+// queryAnalyticsKey identifies a row of query_analytics
+type queryAnalyticsKey struct {
+	hour  time.Time
+	query string
+}
+
+// QueryAnalytics aggregates search volume, zero-result counts and latency
+// per normalized query in memory, and adds them to the hourly totals in
+// query_analytics on every flush interval. Every instance adds its own
+// counts, so the table holds the totals of the whole deployment.
+type QueryAnalytics struct {
+	config  *config.Config
+	spanner *SpannerService
+
+	mu      sync.Mutex
+	pending map[queryAnalyticsKey]*queryTotals
+	// queries counts the distinct queries pending per hour
+	queries map[time.Time]int
+}
+
+// NewQueryAnalytics creates a new query analytics aggregator
+func NewQueryAnalytics(cfg *config.Config, spannerSvc *SpannerService) *QueryAnalytics {
+	return &QueryAnalytics{
+		config:  cfg,
+		spanner: spannerSvc,
+		pending: make(map[queryAnalyticsKey]*queryTotals),
+		queries: make(map[time.Time]int),
+	}
+}
+
+// Run flushes the aggregated searches on every flush interval until ctx is
+// done
+func (a *QueryAnalytics) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.config.AnalyticsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := a.Flush(ctx); err != nil {
+			log.Printf("Warning: could not flush query analytics: %v", err)
+		}
+	}
+}
+
+// Record counts a search for query that returned results results in
+// latency. It does nothing on a nil QueryAnalytics, so callers need not
+// check whether analytics are enabled.
+func (a *QueryAnalytics) Record(query string, results int, latency time.Duration) {
+	if a == nil {
+		return
+	}
+	search := queryTotals{searches: 1, latencyMs: float64(latency.Microseconds()) / 1000}
+	if results == 0 {
+		search.zeroResults = 1
+	}
+	key := queryAnalyticsKey{hour: time.Now().UTC().Truncate(time.Hour), query: cache.NormalizeQuery(query)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.addLocked(key, search)
+}
+
+// addLocked adds totals to the pending totals of key, counting a new query
+// with the other queries once the hour has ANALYTICS_MAX_QUERIES. a.mu must
+// be held.
+func (a *QueryAnalytics) addLocked(key queryAnalyticsKey, totals queryTotals) {
+	if key.query == "" {
+		key.query = otherQueries
+	}
+	pending, ok := a.pending[key]
+	if !ok && key.query != otherQueries && a.queries[key.hour] >= a.config.AnalyticsMaxQueries {
+		key.query = otherQueries
+		pending, ok = a.pending[key]
+	}
+	if !ok {
+		pending = &queryTotals{}
+		a.pending[key] = pending
+		if key.query != otherQueries {
+			a.queries[key.hour]++
+		}
+	}
+	pending.add(totals)
+}
+
+// Flush adds the pending totals to query_analytics. Totals that could not
+// be written are kept for the next flush. It does nothing on a nil
+// QueryAnalytics.
+func (a *QueryAnalytics) Flush(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[queryAnalyticsKey]*queryTotals)
+	a.queries = make(map[time.Time]int)
+	a.mu.Unlock()
+
+	keys := make([]queryAnalyticsKey, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	for batch := range slices.Chunk(keys, queryAnalyticsFlushBatch) {
+		if err := a.flushBatch(ctx, batch, pending); err != nil {
+			a.mu.Lock()
+			for key, totals := range pending {
+				a.addLocked(key, *totals)
+			}
+			a.mu.Unlock()
+			return err
+		}
+		for _, key := range batch {
+			delete(pending, key)
+		}
+	}
+	return nil
+}
+
+// flushBatch adds the pending totals of keys to their stored rows in one
+// transaction
+func (a *QueryAnalytics) flushBatch(ctx context.Context, keys []queryAnalyticsKey, pending map[queryAnalyticsKey]*queryTotals) error {
+	keySets := make([]spanner.KeySet, len(keys))
+	for i, key := range keys {
+		keySets[i] = spanner.Key{key.hour, key.query}
+	}
+
+	_, err := a.spanner.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		stored := make(map[queryAnalyticsKey]queryTotals, len(keys))
+		iter := txn.Read(ctx, "query_analytics", spanner.KeySets(keySets...), []string{"hour", "query", "searches", "zero_results", "latency_ms_sum"})
+		err := iter.Do(func(row *spanner.Row) error {
+			var key queryAnalyticsKey
+			var totals queryTotals
+			if err := row.Columns(&key.hour, &key.query, &totals.searches, &totals.zeroResults, &totals.latencyMs); err != nil {
+				return err
+			}
+			stored[key] = totals
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		mutations := make([]*spanner.Mutation, len(keys))
+		for i, key := range keys {
+			totals := stored[key]
+			totals.add(*pending[key])
+			mutations[i] = spanner.InsertOrUpdateMap("query_analytics", map[string]interface{}{
+				"hour":           key.hour,
+				"query":          key.query,
+				"searches":       totals.searches,
+				"zero_results":   totals.zeroResults,
+				"latency_ms_sum": totals.latencyMs,
+				"updated_at":     spanner.CommitTimestamp,
+			})
+		}
+		return txn.BufferWrite(mutations)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write query analytics: %w", err)
+	}
+	return nil
+}
+
+// QueryAnalyticsReport summarizes the searches of the hours from since
+// until until, listing the limit most searched queries and the limit
+// queries that grew most over the preceding period of the same length.
+// Trending queries need at least minTrendingSearches searches.
+func (s *SpannerService) QueryAnalyticsReport(ctx context.Context, since, until time.Time, limit, minTrendingSearches int) (*models.QueryAnalyticsResponse, error) {
+	current, err := s.queryAnalyticsTotals(ctx, since, until)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.queryAnalyticsTotals(ctx, since.Add(-until.Sub(since)), since)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.QueryAnalyticsResponse{
+		Since:      since,
+		Until:      until,
+		TopQueries: []models.QueryStats{},
+		Trending:   []models.TrendingQuery{},
+	}
+	var all queryTotals
+	for query, totals := range current {
+		all.add(totals)
+		if query == otherQueries {
+			continue
+		}
+		report.TopQueries = append(report.TopQueries, queryStats(query, totals))
+		if totals.searches < int64(minTrendingSearches) {
+			continue
+		}
+		before := previous[query].searches
+		if growth := float64(totals.searches-before) / float64(max(before, 1)); growth > 0 {
+			report.Trending = append(report.Trending, models.TrendingQuery{
+				Query:            query,
+				Searches:         totals.searches,
+				PreviousSearches: before,
+				Growth:           growth,
+			})
+		}
+	}
+	overall := queryStats("", all)
+	report.Searches, report.ZeroResultRate, report.AvgLatencyMs = overall.Searches, overall.ZeroResultRate, overall.AvgLatencyMs
+
+	// Ties are broken by query so reports are stable
+	slices.SortFunc(report.TopQueries, func(a, b models.QueryStats) int {
+		return cmp.Or(cmp.Compare(b.Searches, a.Searches), strings.Compare(a.Query, b.Query))
+	})
+	slices.SortFunc(report.Trending, func(a, b models.TrendingQuery) int {
+		return cmp.Or(cmp.Compare(b.Growth, a.Growth), strings.Compare(a.Query, b.Query))
+	})
+	report.TopQueries = report.TopQueries[:min(limit, len(report.TopQueries))]
+	report.Trending = report.Trending[:min(limit, len(report.Trending))]
+	return report, nil
+}
+
+// queryAnalyticsTotals sums the hourly totals of each query from since
+// until until
+func (s *SpannerService) queryAnalyticsTotals(ctx context.Context, since, until time.Time) (map[string]queryTotals, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT query, SUM(searches), SUM(zero_results), SUM(latency_ms_sum)
+              FROM query_analytics
+              WHERE hour >= @since AND hour < @until
+              GROUP BY query`,
+		Params: map[string]interface{}{"since": since, "until": until},
+	}
+	iter := s.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	totals := make(map[string]queryTotals)
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through query analytics: %w", err)
+		}
+		var query string
+		var t queryTotals
+		if err := row.Columns(&query, &t.searches, &t.zeroResults, &t.latencyMs); err != nil {
+			return nil, fmt.Errorf("failed to scan query analytics: %v", err)
+		}
+		totals[query] = t
+	}
+	return totals, nil
+}
+
+// queryStats converts a query's totals into its reported stats
+func queryStats(query string, totals queryTotals) models.QueryStats {
+	stats := models.QueryStats{Query: query, Searches: totals.searches}
+	if totals.searches > 0 {
+		stats.ZeroResultRate = float64(totals.zeroResults) / float64(totals.searches)
+		stats.AvgLatencyMs = totals.latencyMs / float64(totals.searches)
+	}
+	return stats
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"strings"
+
+	"psearch/serving/internal/cache"
+)
+
+// phraseBreaks are words that separate noun phrases in a shopper's query:
+// function words, and verbs and generic shopping words that describe the
+// request rather than the product
+var phraseBreaks = toSet(
+	"a", "an", "the", "and", "or", "but", "nor", "plus", "also", "either", "neither",
+	"for", "with", "without", "to", "of", "in", "on", "at", "by", "from", "into",
+	"under", "over", "about", "around", "between", "than", "as", "like", "near",
+	"who", "whom", "whose", "that", "which", "what", "when", "where", "while",
+	"is", "are", "was", "were", "be", "been", "being", "has", "have", "had",
+	"do", "does", "did", "can", "could", "will", "would", "should", "might",
+	"i", "me", "my", "we", "our", "you", "your", "he", "him", "his", "she", "her",
+	"they", "them", "their", "it", "its", "this", "these", "those", "some", "any",
+	"someone", "somebody", "something", "anyone", "everyone", "all", "every",
+	"love", "loves", "likes", "enjoy", "enjoys", "want", "wants", "need",
+	"needs", "looking", "find", "show", "buy", "get", "gets", "going",
+	"gift", "gifts", "idea", "ideas", "guide", "best", "good", "great", "perfect",
+	"nice", "cool", "really", "very", "just", "not", "no", "so",
+)
+
+// Decompose splits a long query into its noun phrases, so each can be
+// embedded and searched on its own. Short queries, and queries with fewer
+// than two phrases, return nil: a single embedding already captures them.
+func (s *QueryExpansionService) Decompose(query string) []string {
+	normalized := cache.NormalizeQuery(query)
+	if len(splitWords(normalized)) < s.config.MultiQueryMinWords {
+		return nil
+	}
+
+	seen := map[string]bool{normalized: true}
+	var phrases []string
+	for _, phrase := range nounPhrases(normalized) {
+		if seen[phrase] {
+			continue
+		}
+		seen[phrase] = true
+		phrases = append(phrases, phrase)
+		if len(phrases) == s.config.MultiQueryMaxSubQueries {
+			break
+		}
+	}
+	if len(phrases) < 2 {
+		return nil
+	}
+	return phrases
+}
+
+// nounPhrases returns the runs of content words in text, in order.
+// Punctuation, break words and words with digits (prices, sizes) end a
+// phrase.
+func nounPhrases(text string) []string {
+	var phrases []string
+	clauses := strings.FieldsFunc(text, func(r rune) bool {
+		return strings.ContainsRune(",;:.!?()/&+", r)
+	})
+	for _, clause := range clauses {
+		var current []string
+		flush := func() {
+			if len(current) > 0 {
+				phrases = append(phrases, strings.Join(current, " "))
+				current = nil
+			}
+		}
+		for _, word := range splitWords(clause) {
+			if phraseBreaks[word] || hasDigit(word) {
+				flush()
+				continue
+			}
+			current = append(current, word)
+		}
+		flush()
+	}
+	return phrases
+}
+
+// toSet builds a membership set from words
+func toSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+)
+
+// StageQueryExpansion is the time spent generating query paraphrases
+const StageQueryExpansion = "query_expansion"
+
+// Query expansion methods
+const (
+	QueryExpansionRules = "rules"
+	QueryExpansionLLM   = "llm"
+)
+
+// queryExpansionPrompt asks the model for alternative phrasings of a query
+const queryExpansionPrompt = `Rewrite this e-commerce search query in %d different ways a shopper might phrase it.
+Keep the same meaning and product type; use common synonyms and plain product names.
+Query: %s`
+
+// queryExpansionSchema constrains Gemini's output to a list of paraphrases
+var queryExpansionSchema = map[string]interface{}{
+	"type": "OBJECT",
+	"properties": map[string]interface{}{
+		"paraphrases": map[string]interface{}{"type": "ARRAY", "items": map[string]interface{}{"type": "STRING"}},
+	},
+	"required": []string{"paraphrases"},
+}
+
+// fillerPhrases are conversational prefixes that carry no product meaning
+var fillerPhrases = []string{
+	"i am looking for", "i'm looking for", "looking for", "i want", "i need",
+	"show me", "find me", "search for", "where can i buy", "buy",
+}
+
+// QueryExpansionService generates paraphrases of a query so each can be
+// embedded and searched, improving recall for unusual phrasings
+type QueryExpansionService struct {
+	config *config.Config
+	gemini *GeminiClient
+}
+
+// NewQueryExpansionService creates a new query expansion service
+func NewQueryExpansionService(cfg *config.Config, gemini *GeminiClient) *QueryExpansionService {
+	return &QueryExpansionService{
+		config: cfg,
+		gemini: gemini,
+	}
+}
+
+// Expand returns up to QueryExpansionMaxVariants paraphrases of the query,
+// excluding the query itself. LLM expansion falls back to rules on failure.
+func (s *QueryExpansionService) Expand(ctx context.Context, query string) []string {
+	defer recordStage(ctx, StageQueryExpansion, time.Now())
+
+	var variants []string
+	if s.config.QueryExpansionMethod == QueryExpansionLLM {
+		llmVariants, err := s.llmParaphrases(ctx, query)
+		if err != nil {
+			log.Printf("LLM query expansion failed, using rules: %v", err)
+		}
+		variants = llmVariants
+	}
+	if len(variants) == 0 {
+		variants = ruleParaphrases(query)
+	}
+
+	// Drop duplicates and variants equivalent to the query
+	seen := map[string]bool{cache.NormalizeQuery(query): true}
+	var expansions []string
+	for _, v := range variants {
+		key := cache.NormalizeQuery(v)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		expansions = append(expansions, strings.TrimSpace(v))
+		if len(expansions) == s.config.QueryExpansionMaxVariants {
+			break
+		}
+	}
+	return expansions
+}
+
+// llmParaphrases asks Gemini for paraphrases within the expansion timeout
+func (s *QueryExpansionService) llmParaphrases(ctx context.Context, query string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.QueryExpansionTimeout)
+	defer cancel()
+
+	var response struct {
+		Paraphrases []string `json:"paraphrases"`
+	}
+	prompt := fmt.Sprintf(queryExpansionPrompt, s.config.QueryExpansionMaxVariants, query)
+	if err := s.gemini.GenerateJSON(ctx, s.config.QueryUnderstandingModel, prompt, queryExpansionSchema, &response); err != nil {
+		return nil, err
+	}
+	return response.Paraphrases, nil
+}
+
+// ruleParaphrases derives paraphrases without a model call: the query
+// without conversational filler, and with its last word's number flipped
+func ruleParaphrases(query string) []string {
+	normalized := cache.NormalizeQuery(query)
+	var variants []string
+
+	stripped := normalized
+	for _, filler := range fillerPhrases {
+		if strings.HasPrefix(stripped, filler+" ") {
+			stripped = strings.TrimPrefix(stripped, filler+" ")
+			break
+		}
+	}
+	stripped = strings.TrimPrefix(stripped, "a ")
+	stripped = strings.TrimPrefix(stripped, "some ")
+	variants = append(variants, stripped)
+
+	words := strings.Fields(stripped)
+	if len(words) > 0 {
+		last := len(words) - 1
+		words[last] = flipNumber(words[last])
+		variants = append(variants, strings.Join(words, " "))
+	}
+	return variants
+}
+
+// flipNumber turns a plural English noun into its singular and vice versa,
+// using common suffix rules
+func flipNumber(word string) string {
+	switch {
+	case len(word) < 3:
+		return word
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "sses"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"):
+		return word + "es"
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	case strings.HasSuffix(word, "y") && !strings.ContainsRune("aeiou", rune(word[len(word)-2])):
+		return strings.TrimSuffix(word, "y") + "ies"
+	case strings.HasSuffix(word, "ch"), strings.HasSuffix(word, "sh"), strings.HasSuffix(word, "x"):
+		return word + "es"
+	}
+	return word + "s"
+}
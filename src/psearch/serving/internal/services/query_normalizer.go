@@ -0,0 +1,257 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"psearch/serving/internal/config"
+)
+
+// queryJoiners are the punctuation marks the punctuation step keeps between
+// two letters or digits, as in t-shirt, 2.5, 1/2, o'neill and h&m
+const queryJoiners = "-./'&+"
+
+// normalizationRules are a language's stopwords and plural stemmer. Stem is
+// nil for languages whose plurals are not reliably stripped by suffix.
+type normalizationRules struct {
+	stopwords map[string]bool
+	stem      func(word string) string
+}
+
+// stopwordSet builds a stopword lookup from a list
+func stopwordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+// languageNormalization holds the rules of the languages the stopwords and
+// stemming steps support. Stopwords are function words only, never terms a
+// shopper could mean to match.
+var languageNormalization = map[string]normalizationRules{
+	"en": {stopwords: stopwordSet("a", "an", "the", "and", "or", "of", "for", "with", "in", "on", "to", "at", "by", "from", "is", "are", "my", "your", "some"), stem: stemEnglish},
+	"de": {stopwords: stopwordSet("der", "die", "das", "den", "dem", "des", "ein", "eine", "einen", "und", "oder", "für", "mit", "von", "zu", "im", "in", "am", "auf")},
+	"fr": {stopwords: stopwordSet("le", "la", "les", "l", "un", "une", "des", "du", "de", "d", "et", "ou", "pour", "avec", "en", "au", "aux", "à"), stem: stemFrench},
+	"es": {stopwords: stopwordSet("el", "la", "los", "las", "un", "una", "unos", "unas", "de", "del", "y", "o", "para", "con", "en", "al", "a"), stem: stemSpanish},
+	"it": {stopwords: stopwordSet("il", "lo", "la", "i", "gli", "le", "un", "uno", "una", "di", "del", "della", "e", "o", "per", "con", "in", "a", "da")},
+	"nl": {stopwords: stopwordSet("de", "het", "een", "en", "of", "voor", "met", "van", "in", "op", "te", "aan")},
+	"pt": {stopwords: stopwordSet("o", "a", "os", "as", "um", "uma", "de", "do", "da", "dos", "das", "e", "ou", "para", "com", "em", "no", "na"), stem: stemPortuguese},
+}
+
+// QueryNormalizer applies the QUERY_NORMALIZATION steps to search queries,
+// so that queries differing only in case, Unicode composition or
+// punctuation share cache entries and keyword matches
+type QueryNormalizer struct {
+	nfc, lowercase, punctuation bool
+	stopwords, stemming         bool
+	// language is the rules used for queries that name no language
+	language string
+}
+
+// NormalizedQuery is a search query after normalization
+type NormalizedQuery struct {
+	// Text is the query embedded, cached and shown in logs
+	Text string
+	// Keywords is the FTS branch's SEARCH query: Text without stopwords,
+	// with stemmed words ORed with their stems
+	Keywords string
+}
+
+// NewQueryNormalizer creates a normalizer running the configured steps. It
+// returns nil, which normalizes nothing, when no steps are configured.
+func NewQueryNormalizer(cfg *config.Config) *QueryNormalizer {
+	if len(cfg.QueryNormalization) == 0 {
+		return nil
+	}
+	return &QueryNormalizer{
+		nfc:         slices.Contains(cfg.QueryNormalization, "nfc"),
+		lowercase:   slices.Contains(cfg.QueryNormalization, "lowercase"),
+		punctuation: slices.Contains(cfg.QueryNormalization, "punctuation"),
+		stopwords:   slices.Contains(cfg.QueryNormalization, "stopwords"),
+		stemming:    slices.Contains(cfg.QueryNormalization, "stemming"),
+		language:    cfg.QueryNormalizationLanguage,
+	}
+}
+
+// Normalize applies the configured steps to query, using the stopwords and
+// stemmer of language, an ISO 639-1 code or BCP 47 tag. The steps run in a
+// fixed order regardless of configuration, and normalizing a normalized
+// query changes nothing.
+func (n *QueryNormalizer) Normalize(query, language string) NormalizedQuery {
+	if n == nil {
+		return NormalizedQuery{Text: query, Keywords: query}
+	}
+
+	text := query
+	if n.nfc {
+		text = norm.NFC.String(text)
+	}
+	if n.lowercase {
+		text = strings.ToLower(text)
+	}
+	if n.punctuation {
+		text = stripQueryPunctuation(text)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	result := NormalizedQuery{Text: text, Keywords: text}
+	if !n.stopwords && !n.stemming {
+		return result
+	}
+	language, _, _ = strings.Cut(strings.ToLower(language), "-")
+	rules, ok := languageNormalization[language]
+	if !ok {
+		rules, ok = languageNormalization[n.language]
+	}
+	if !ok {
+		return result
+	}
+
+	var keywords []string
+	inPhrase := false
+	for _, word := range strings.Fields(text) {
+		// The words of a quoted phrase are kept as typed, so the phrase
+		// still matches exactly
+		quoted := inPhrase || strings.HasPrefix(word, `"`)
+		if strings.Count(word, `"`)%2 == 1 {
+			inPhrase = !inPhrase
+		}
+		if quoted {
+			keywords = append(keywords, word)
+			continue
+		}
+		lower := strings.ToLower(word)
+		if n.stopwords && rules.stopwords[lower] {
+			continue
+		}
+		// Words with digits or joiners, like t-shirts or women's, are
+		// left alone rather than stemmed into non-words
+		if n.stemming && rules.stem != nil && isLetters(lower) {
+			if stem := rules.stem(lower); stem != lower {
+				keywords = append(keywords, word+" OR "+stem)
+				continue
+			}
+		}
+		keywords = append(keywords, word)
+	}
+	// A query of nothing but stopwords is searched as typed
+	if len(keywords) > 0 {
+		result.Keywords = strings.Join(keywords, " ")
+	}
+	return result
+}
+
+// stripQueryPunctuation replaces punctuation and symbols with spaces,
+// keeping queryJoiners between two letters or digits and the double quotes
+// that delimit phrases
+func stripQueryPunctuation(text string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	b.Grow(len(text))
+	for i, r := range runes {
+		if r == '"' || (!unicode.IsPunct(r) && !unicode.IsSymbol(r)) {
+			b.WriteRune(r)
+			continue
+		}
+		if strings.ContainsRune(queryJoiners, r) && i > 0 && i < len(runes)-1 &&
+			isQueryWordRune(runes[i-1]) && isQueryWordRune(runes[i+1]) {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// isQueryWordRune reports whether r is a letter, digit or combining mark
+func isQueryWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// isLetters reports whether word is made of letters only
+func isLetters(word string) bool {
+	return strings.IndexFunc(word, func(r rune) bool { return !unicode.IsLetter(r) }) < 0
+}
+
+// isVowelBefore reports whether the letter before the last n bytes of word
+// is a vowel
+func isVowelBefore(word string, n int) bool {
+	r, _ := utf8.DecodeLastRuneInString(word[:len(word)-n])
+	return strings.ContainsRune("aeiouáéíóúâêôãõàèìòù", r)
+}
+
+// stemEnglish strips English plural endings: dresses, watches and boxes
+// lose "es", accessories becomes accessory and shoes becomes shoe
+func stemEnglish(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 4 && (strings.HasSuffix(word, "sses") || strings.HasSuffix(word, "ches") ||
+		strings.HasSuffix(word, "shes") || strings.HasSuffix(word, "xes") || strings.HasSuffix(word, "zes")):
+		return word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// stemSpanish strips Spanish plural endings: zapatos becomes zapato,
+// pantalones pantalon and luces luz
+func stemSpanish(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ces"):
+		return word[:len(word)-3] + "z"
+	case len(word) > 4 && strings.HasSuffix(word, "es") && !isVowelBefore(word, 2):
+		return word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && isVowelBefore(word, 1):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// stemFrench strips French plural endings: chaussures becomes chaussure
+// and chapeaux chapeau
+func stemFrench(word string) string {
+	if len(word) > 3 && (strings.HasSuffix(word, "s") || strings.HasSuffix(word, "x")) &&
+		!strings.HasSuffix(word, "ss") {
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// stemPortuguese strips Portuguese plural endings: sapatos becomes sapato,
+// botões botão and bolsas bolsa
+func stemPortuguese(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ões"):
+		return strings.TrimSuffix(word, "ões") + "ão"
+	case len(word) > 3 && strings.HasSuffix(word, "ns"):
+		return word[:len(word)-2] + "m"
+	case len(word) > 3 && strings.HasSuffix(word, "s") && isVowelBefore(word, 1):
+		return word[:len(word)-1]
+	}
+	return word
+}
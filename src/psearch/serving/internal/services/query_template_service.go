@@ -0,0 +1,335 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+)
+
+// ErrQueryTemplateNotFound is returned when a query template does not exist
+var ErrQueryTemplateNotFound = errors.New("query template not found")
+
+// ErrInvalidQueryTemplate is wrapped by errors in a template definition or
+// in the parameters a template is run with
+var ErrInvalidQueryTemplate = errors.New("invalid query template")
+
+// Query template parameter types
+const (
+	TemplateParamString = "string"
+	TemplateParamNumber = "number"
+)
+
+// templatePlaceholder matches {{name}} placeholders
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// templateIDPattern restricts template IDs to URL-safe names
+var templateIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// QueryTemplateService stores named, parameterized searches so widget
+// queries are defined once server-side and invoked by ID
+type QueryTemplateService struct {
+	config  *config.Config
+	spanner *SpannerService
+	filters *filter.Registry
+	// templates caches stored templates by ID. Changes made through another
+	// instance are picked up when entries expire.
+	templates *cache.Cache[*models.QueryTemplate]
+}
+
+// NewQueryTemplateService creates a new query template service
+func NewQueryTemplateService(cfg *config.Config, spannerSvc *SpannerService, filters *filter.Registry) *QueryTemplateService {
+	return &QueryTemplateService{
+		config:    cfg,
+		spanner:   spannerSvc,
+		filters:   filters,
+		templates: cache.New[*models.QueryTemplate]("query_template", cfg.QueryTemplateCacheSize, cfg.QueryTemplateCacheTTL),
+	}
+}
+
+// CacheLayers returns the caches owned by the query template service
+func (s *QueryTemplateService) CacheLayers() []cache.Layer {
+	return []cache.Layer{s.templates}
+}
+
+// Put validates and creates or replaces the template with the given ID
+func (s *QueryTemplateService) Put(ctx context.Context, id string, req models.QueryTemplateRequest) (*models.QueryTemplate, error) {
+	mutation, err := s.putMutation(id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &models.QueryTemplate{
+		ID:          id,
+		Description: req.Description,
+		Search:      req.Search,
+		Parameters:  req.Parameters,
+	}
+
+	commitTimestamp, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save query template: %w", err)
+	}
+	template.UpdatedAt = commitTimestamp
+	s.templates.Delete(id)
+
+	return template, nil
+}
+
+// putMutation validates the template and returns the mutation that stores
+// it under id
+func (s *QueryTemplateService) putMutation(id string, req models.QueryTemplateRequest) (*spanner.Mutation, error) {
+	if !templateIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w: id must be 1-64 letters, digits, '_' or '-'", ErrInvalidQueryTemplate)
+	}
+	if err := s.validate(req); err != nil {
+		return nil, err
+	}
+
+	return spanner.InsertOrUpdateMap("query_templates", map[string]interface{}{
+		"template_id": id,
+		"description": req.Description,
+		"search":      spanner.NullJSON{Value: req.Search, Valid: true},
+		"parameters":  spanner.NullJSON{Value: req.Parameters, Valid: true},
+		"updated_at":  spanner.CommitTimestamp,
+	}), nil
+}
+
+// validate checks that every placeholder is declared, defaults match their
+// type and the filter parses once placeholders are filled in
+func (s *QueryTemplateService) validate(req models.QueryTemplateRequest) error {
+	declared := make(map[string]models.QueryTemplateParameter, len(req.Parameters))
+	sample := make(map[string]interface{}, len(req.Parameters))
+	for _, param := range req.Parameters {
+		if _, dup := declared[param.Name]; dup {
+			return fmt.Errorf("%w: parameter %q is declared twice", ErrInvalidQueryTemplate, param.Name)
+		}
+		declared[param.Name] = param
+		if !param.Required && param.Default == nil {
+			return fmt.Errorf("%w: optional parameter %q needs a default", ErrInvalidQueryTemplate, param.Name)
+		}
+		if param.Default != nil {
+			if err := checkParamType(param, param.Default); err != nil {
+				return err
+			}
+		}
+		if param.Type == TemplateParamNumber {
+			sample[param.Name] = float64(0)
+		} else {
+			sample[param.Name] = "x"
+		}
+	}
+
+	for _, text := range []string{req.Search.Query, req.Search.Filter} {
+		for _, match := range templatePlaceholder.FindAllStringSubmatch(text, -1) {
+			if _, ok := declared[match[1]]; !ok {
+				return fmt.Errorf("%w: placeholder {{%s}} is not a declared parameter", ErrInvalidQueryTemplate, match[1])
+			}
+		}
+	}
+
+	rendered, err := renderTemplate(req.Search, req.Parameters, sample)
+	if err != nil {
+		return err
+	}
+	if _, err := filter.Parse(rendered.Filter, s.filters); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Get returns a single query template
+func (s *QueryTemplateService) Get(ctx context.Context, id string) (*models.QueryTemplate, error) {
+	if template, ok := s.templates.Get(id); ok {
+		return template, nil
+	}
+
+	stmt := spanner.Statement{
+		SQL: `SELECT template_id, description, search, parameters, updated_at
+              FROM query_templates
+              WHERE template_id = @id`,
+		Params: map[string]interface{}{"id": id},
+	}
+	templates, err := s.query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, ErrQueryTemplateNotFound
+	}
+	s.templates.Set(id, &templates[0])
+	return &templates[0], nil
+}
+
+// List returns all query templates
+func (s *QueryTemplateService) List(ctx context.Context) ([]models.QueryTemplate, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT template_id, description, search, parameters, updated_at
+              FROM query_templates
+              ORDER BY template_id`,
+	}
+	return s.query(ctx, stmt)
+}
+
+// Delete removes a query template
+func (s *QueryTemplateService) Delete(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+
+	mutation := spanner.Delete("query_templates", spanner.Key{id})
+	if _, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation}); err != nil {
+		return fmt.Errorf("failed to delete query template: %w", err)
+	}
+	s.templates.Delete(id)
+	return nil
+}
+
+// query runs a query template listing statement
+func (s *QueryTemplateService) query(ctx context.Context, stmt spanner.Statement) ([]models.QueryTemplate, error) {
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var results []models.QueryTemplate
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through query templates: %w", err)
+		}
+
+		var template models.QueryTemplate
+		var description spanner.NullString
+		var searchJSON, parametersJSON spanner.NullJSON
+		if err := row.Columns(&template.ID, &description, &searchJSON, &parametersJSON, &template.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan query template: %v", err)
+		}
+		template.Description = description.StringVal
+		if err := decodeJSONColumn(searchJSON, &template.Search); err != nil {
+			return nil, fmt.Errorf("failed to decode search of query template %s: %v", template.ID, err)
+		}
+		if err := decodeJSONColumn(parametersJSON, &template.Parameters); err != nil {
+			return nil, fmt.Errorf("failed to decode parameters of query template %s: %v", template.ID, err)
+		}
+
+		results = append(results, template)
+	}
+	return results, nil
+}
+
+// decodeJSONColumn converts a JSON column value into a typed struct
+func decodeJSONColumn(column spanner.NullJSON, out interface{}) error {
+	if !column.Valid {
+		return nil
+	}
+	data, err := json.Marshal(column.Value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Render fills the template's placeholders with the given parameter values,
+// falling back to defaults, and returns the search to run
+func (s *QueryTemplateService) Render(template *models.QueryTemplate, params map[string]interface{}) (*models.SearchRequest, error) {
+	declared := make(map[string]bool, len(template.Parameters))
+	for _, param := range template.Parameters {
+		declared[param.Name] = true
+	}
+	for name := range params {
+		if !declared[name] {
+			return nil, fmt.Errorf("%w: unknown parameter %q", ErrInvalidQueryTemplate, name)
+		}
+	}
+	return renderTemplate(template.Search, template.Parameters, params)
+}
+
+// renderTemplate substitutes parameter values into the query and filter.
+// Filter values are written as literals, so string values are quoted and
+// cannot change the structure of the expression.
+func renderTemplate(search models.SearchRequest, parameters []models.QueryTemplateParameter, params map[string]interface{}) (*models.SearchRequest, error) {
+	queryValues := make(map[string]string, len(parameters))
+	filterValues := make(map[string]string, len(parameters))
+	for _, param := range parameters {
+		value, ok := params[param.Name]
+		if !ok || value == nil {
+			value = param.Default
+		}
+		if value == nil {
+			return nil, fmt.Errorf("%w: missing required parameter %q", ErrInvalidQueryTemplate, param.Name)
+		}
+		if err := checkParamType(param, value); err != nil {
+			return nil, err
+		}
+
+		switch v := value.(type) {
+		case float64:
+			text := strconv.FormatFloat(v, 'f', -1, 64)
+			queryValues[param.Name], filterValues[param.Name] = text, text
+		case string:
+			queryValues[param.Name], filterValues[param.Name] = v, quoteFilterString(v)
+		}
+	}
+
+	rendered := search
+	rendered.Query = substitute(search.Query, queryValues)
+	rendered.Filter = substitute(search.Filter, filterValues)
+	return &rendered, nil
+}
+
+// checkParamType reports whether value has the parameter's declared type
+func checkParamType(param models.QueryTemplateParameter, value interface{}) error {
+	switch value.(type) {
+	case string:
+		if param.Type == TemplateParamString {
+			return nil
+		}
+	case float64:
+		if param.Type == TemplateParamNumber {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: parameter %q must be a %s", ErrInvalidQueryTemplate, param.Name, param.Type)
+}
+
+// substitute replaces each {{name}} placeholder with its value
+func substitute(text string, values map[string]string) string {
+	return templatePlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := templatePlaceholder.FindStringSubmatch(placeholder)[1]
+		return values[name]
+	})
+}
+
+// quoteFilterString writes s as a double-quoted filter string literal
+func quoteFilterString(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(s) + `"`
+}
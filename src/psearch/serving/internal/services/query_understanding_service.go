@@ -0,0 +1,149 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StageQueryUnderstanding is the time spent extracting intent from the query
+const StageQueryUnderstanding = "query_understanding"
+
+// queryUnderstandingPrompt instructs the model to extract shopping intent
+const queryUnderstandingPrompt = `You extract structured shopping intent from an e-commerce search query.
+Return the product being searched for as normalized_query, without brand, color or price words.
+Only fill brands, colors, categories, min_price and max_price when the query states them explicitly.
+Use the brand's usual capitalization and a basic color family name such as "Red" or "Blue".
+Query: %s`
+
+// queryIntentSchema constrains Gemini's JSON output to models.QueryIntent
+var queryIntentSchema = map[string]interface{}{
+	"type": "OBJECT",
+	"properties": map[string]interface{}{
+		"normalized_query": map[string]interface{}{"type": "STRING"},
+		"brands":           map[string]interface{}{"type": "ARRAY", "items": map[string]interface{}{"type": "STRING"}},
+		"colors":           map[string]interface{}{"type": "ARRAY", "items": map[string]interface{}{"type": "STRING"}},
+		"categories":       map[string]interface{}{"type": "ARRAY", "items": map[string]interface{}{"type": "STRING"}},
+		"min_price":        map[string]interface{}{"type": "NUMBER", "nullable": true},
+		"max_price":        map[string]interface{}{"type": "NUMBER", "nullable": true},
+	},
+	"required": []string{"normalized_query"},
+}
+
+// QueryUnderstandingService calls Gemini to turn free-text queries into a
+// normalized query plus structured filters
+type QueryUnderstandingService struct {
+	config *config.Config
+	gemini *GeminiClient
+}
+
+// NewQueryUnderstandingService creates a new query understanding service
+func NewQueryUnderstandingService(cfg *config.Config, gemini *GeminiClient) *QueryUnderstandingService {
+	return &QueryUnderstandingService{
+		config: cfg,
+		gemini: gemini,
+	}
+}
+
+// Understand extracts the intent of the query. Calls are bounded by the
+// configured timeout because they sit on the search latency path.
+func (s *QueryUnderstandingService) Understand(ctx context.Context, query string) (intent *models.QueryIntent, err error) {
+	defer recordStage(ctx, StageQueryUnderstanding, time.Now())
+
+	ctx, span := tracer.Start(ctx, "QueryUnderstandingService.Understand",
+		trace.WithAttributes(
+			attribute.String("query_understanding.model", s.config.QueryUnderstandingModel),
+			attribute.String("search.query_hash", telemetry.HashQuery(query)),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "query understanding failed")
+		}
+		span.End()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.QueryUnderstandingTimeout)
+	defer cancel()
+
+	intent = &models.QueryIntent{}
+	if err := s.gemini.GenerateJSON(ctx, s.config.QueryUnderstandingModel, fmt.Sprintf(queryUnderstandingPrompt, query), queryIntentSchema, intent); err != nil {
+		return nil, err
+	}
+	intent.NormalizedQuery = strings.TrimSpace(intent.NormalizedQuery)
+
+	span.SetAttributes(
+		attribute.Int("query_understanding.brand_count", len(intent.Brands)),
+		attribute.Int("query_understanding.color_count", len(intent.Colors)),
+		attribute.Int("query_understanding.category_count", len(intent.Categories)),
+		attribute.Bool("query_understanding.price_range", intent.MinPrice != nil || intent.MaxPrice != nil),
+	)
+
+	return intent, nil
+}
+
+// IntentFilter converts the extracted intent into a filter over the
+// registry's fields. It returns nil when the intent carries no constraints.
+func IntentFilter(i *models.QueryIntent, registry *filter.Registry) filter.Node {
+	var nodes []filter.Node
+
+	addAnyOf := func(fieldName string, values []string) {
+		field, ok := registry.Lookup(fieldName)
+		if !ok {
+			return
+		}
+		var filterValues []filter.Value
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				filterValues = append(filterValues, filter.Value{Text: v})
+			}
+		}
+		if len(filterValues) > 0 {
+			nodes = append(nodes, &filter.AnyOf{Field: field, Values: filterValues})
+		}
+	}
+	addAnyOf("brands", i.Brands)
+	addAnyOf("colorFamilies", i.Colors)
+	addAnyOf("categories", i.Categories)
+
+	if field, ok := registry.Lookup("price"); ok {
+		if i.MinPrice != nil {
+			nodes = append(nodes, &filter.Comparison{Field: field, Operator: ">=", Value: filter.Value{Number: *i.MinPrice, IsNumber: true}})
+		}
+		if i.MaxPrice != nil {
+			nodes = append(nodes, &filter.Comparison{Field: field, Operator: "<=", Value: filter.Value{Number: *i.MaxPrice, IsNumber: true}})
+		}
+	}
+
+	var node filter.Node
+	for _, n := range nodes {
+		node = filter.Conjoin(node, n)
+	}
+	return node
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"psearch/serving/internal/models"
+)
+
+// DependencyCheck probes one dependency the instance needs to serve traffic
+type DependencyCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// ReadinessChecker runs the dependency checks behind the readiness probe and
+// remembers when each last passed
+type ReadinessChecker struct {
+	checks  []DependencyCheck
+	timeout time.Duration
+
+	mu          sync.Mutex
+	lastSuccess map[string]time.Time
+}
+
+// NewReadinessChecker creates a checker running checks, each bounded by
+// timeout
+func NewReadinessChecker(timeout time.Duration, checks ...DependencyCheck) *ReadinessChecker {
+	return &ReadinessChecker{checks: checks, timeout: timeout, lastSuccess: make(map[string]time.Time)}
+}
+
+// Check runs every dependency check concurrently and reports whether all of
+// them passed, with each check's status in registration order
+func (r *ReadinessChecker) Check(ctx context.Context) (bool, []models.DependencyStatus) {
+	statuses := make([]models.DependencyStatus, len(r.checks))
+	var wg sync.WaitGroup
+	for i, check := range r.checks {
+		wg.Add(1)
+		go func(i int, check DependencyCheck) {
+			defer wg.Done()
+			statuses[i] = r.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, status := range statuses {
+		ready = ready && status.Status == "ok"
+	}
+	return ready, statuses
+}
+
+// run runs one check within the timeout and records its outcome
+func (r *ReadinessChecker) run(ctx context.Context, check DependencyCheck) models.DependencyStatus {
+	ctx, cancel := withBudget(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	status := models.DependencyStatus{
+		Name:      check.Name,
+		Status:    "ok",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		status.Status = "error"
+		status.Error = err.Error()
+	} else {
+		r.lastSuccess[check.Name] = start
+	}
+	if last, ok := r.lastSuccess[check.Name]; ok {
+		status.LastSuccess = &last
+	}
+	return status
+}
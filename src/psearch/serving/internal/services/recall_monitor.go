@@ -0,0 +1,260 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+)
+
+// RecallMonitor measures how many of the exact nearest neighbours of sampled
+// head queries the ANN index returns. Recall degrades when large imports
+// leave the index's leaves out of step with the data, which otherwise goes
+// unnoticed until shoppers complain.
+type RecallMonitor struct {
+	config     *config.Config
+	spanner    *SpannerService
+	embeddings Embedder
+	trigger    chan struct{}
+}
+
+// NewRecallMonitor creates a new recall monitor
+func NewRecallMonitor(cfg *config.Config, spannerSvc *SpannerService, embeddings Embedder) *RecallMonitor {
+	return &RecallMonitor{
+		config:     cfg,
+		spanner:    spannerSvc,
+		embeddings: embeddings,
+		trigger:    make(chan struct{}, 1),
+	}
+}
+
+// Run checks recall at startup, on every monitor interval and whenever
+// Trigger is called, until ctx is done
+func (m *RecallMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.RecallMonitorInterval)
+	defer ticker.Stop()
+
+	for {
+		m.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.trigger:
+		}
+	}
+}
+
+// Trigger requests a check, for example after an import. It never blocks;
+// requests made while one is pending are coalesced.
+func (m *RecallMonitor) Trigger() {
+	if m == nil {
+		return
+	}
+	select {
+	case m.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// check samples head queries and records the ANN index's recall@k for
+// them, along with how many products have no embedding. Queries run
+// sequentially since exact search scans every embedding.
+func (m *RecallMonitor) check(ctx context.Context) {
+	startTime := time.Now()
+
+	missing, err := m.spanner.CountMissingEmbeddings(ctx)
+	if err != nil {
+		log.Printf("Warning: could not count products missing embeddings: %v", err)
+	} else {
+		metrics.ProductsMissingEmbedding.Set(float64(missing))
+	}
+
+	queries, err := m.spanner.SampleHeadQueries(ctx, m.config.RecallSampleSize)
+	if err != nil {
+		log.Printf("Warning: could not sample queries for recall check: %v", err)
+		return
+	}
+
+	var total float64
+	checked := 0
+	for _, query := range queries {
+		if ctx.Err() != nil {
+			return
+		}
+		recall, ok, err := m.queryRecall(ctx, query)
+		if err != nil {
+			log.Printf("Warning: could not check recall for sampled query: %v", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		metrics.ANNQueryRecall.Observe(recall)
+		total += recall
+		checked++
+	}
+	if checked == 0 {
+		return
+	}
+
+	mean := total / float64(checked)
+	metrics.ANNRecall.Set(mean)
+	if mean < m.config.RecallAlertThreshold {
+		log.Printf("Warning: ANN recall@%d is %.3f over %d queries, below %.3f; the vector index may need rebuilding",
+			m.config.RecallTopK, mean, checked, m.config.RecallAlertThreshold)
+	}
+	log.Printf("Checked ANN recall@%d over %d queries in %s: %.3f", m.config.RecallTopK, checked, time.Since(startTime), mean)
+}
+
+// queryRecall returns the share of the query's exact nearest neighbours
+// found by the ANN index. ok is false when no product has an embedding.
+func (m *RecallMonitor) queryRecall(ctx context.Context, query string) (recall float64, ok bool, err error) {
+	embedding, err := m.embeddings.GenerateEmbedding(ctx, query)
+	if err != nil {
+		return 0, false, err
+	}
+
+	approximate, readTimestamp, err := m.spanner.NearestNeighbors(ctx, embedding, m.config.RecallTopK, true, time.Time{})
+	if err != nil {
+		return 0, false, err
+	}
+	// Read the exact neighbours at the same snapshot so concurrent writes
+	// don't count as misses
+	exact, _, err := m.spanner.NearestNeighbors(ctx, embedding, m.config.RecallTopK, false, readTimestamp)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(exact) == 0 {
+		return 0, false, nil
+	}
+
+	found := make(map[string]bool, len(approximate))
+	for _, id := range approximate {
+		found[id] = true
+	}
+	hits := 0
+	for _, id := range exact {
+		if found[id] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(exact)), true, nil
+}
+
+// SampleHeadQueries returns a random sample of the head queries
+func (s *SpannerService) SampleHeadQueries(ctx context.Context, size int) ([]string, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT query
+              FROM head_queries TABLESAMPLE RESERVOIR (@size ROWS)`,
+		Params: map[string]interface{}{"size": size},
+	}
+
+	iter := s.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var queries []string
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through sampled queries: %w", err)
+		}
+		var query string
+		if err := row.Columns(&query); err != nil {
+			return nil, fmt.Errorf("failed to scan sampled query: %v", err)
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+// NearestNeighbors returns the IDs of the k products closest to embedding,
+// closest first. Approximate search uses the same vector index query as the
+// search ANN branch; exact search computes every cosine distance. A zero
+// readTimestamp reads strongly; the timestamp read at is returned. Only the
+// default embedding version is searched.
+func (s *SpannerService) NearestNeighbors(ctx context.Context, embedding []float32, k int, approximate bool, readTimestamp time.Time) ([]string, time.Time, error) {
+	sql := `SELECT product_id
+		FROM products
+		WHERE embedding IS NOT NULL
+		ORDER BY COSINE_DISTANCE(embedding, @query_embedding)
+		LIMIT @candidate_limit`
+	if approximate {
+		ann := DefaultANNParams(s.config)
+		ann.Column = "embedding"
+		sql = "WITH " + annBranch(annBranchName(0), "", queryEmbeddingParam(0), false, ann, "candidate_limit") + `
+		SELECT product_id FROM ann ORDER BY rank`
+	}
+	stmt := spanner.Statement{
+		SQL: sql,
+		Params: map[string]interface{}{
+			"query_embedding": embedding,
+			"candidate_limit": k,
+		},
+	}
+
+	txn := s.singleRead(readTimestamp, 0)
+	iter := txn.Query(ctx, stmt)
+	defer iter.Stop()
+
+	var ids []string
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("error iterating through nearest neighbors: %w", err)
+		}
+		var id string
+		if err := row.Columns(&id); err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to scan nearest neighbor: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	timestamp, err := txn.Timestamp()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read nearest neighbors timestamp: %v", err)
+	}
+	return ids, timestamp, nil
+}
+
+// CountMissingEmbeddings returns how many products have no embedding
+func (s *SpannerService) CountMissingEmbeddings(ctx context.Context) (int64, error) {
+	stmt := spanner.Statement{SQL: `SELECT COUNT(*) FROM products WHERE embedding IS NULL`}
+
+	var count int64
+	err := s.client.Single().Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		return row.Columns(&count)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count products missing embeddings: %v", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,582 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// ErrReembedJobNotFound is returned when a re-embedding job does not exist
+var ErrReembedJobNotFound = errors.New("re-embedding job not found")
+
+// ErrInvalidReembedJob is wrapped by errors in a re-embedding request
+var ErrInvalidReembedJob = errors.New("invalid re-embedding job")
+
+// ErrReembedJobRunning is returned when a job is started while another is
+// running
+var ErrReembedJobRunning = errors.New("a re-embedding job is already running")
+
+// Re-embedding job statuses
+const (
+	ReembedRunning     = "running"
+	ReembedCancelling  = "cancelling"
+	ReembedCompleted   = "completed"
+	ReembedCancelled   = "cancelled"
+	ReembedFailed      = "failed"
+	ReembedInterrupted = "interrupted"
+)
+
+// Re-embedding job sources: the product text a job embeds, or the
+// product's first image
+const (
+	ReembedSourceText  = "text"
+	ReembedSourceImage = "image"
+)
+
+const (
+	// reembedProgressInterval is how often a running job records its
+	// progress and checks whether it was cancelled
+	reembedProgressInterval = 10 * time.Second
+	// reembedStaleAfter is how long a running job may go without recording
+	// progress before it is reported as interrupted
+	reembedStaleAfter = 5 * reembedProgressInterval
+	// reembedWriteBatch is the number of embeddings written per commit
+	reembedWriteBatch = 100
+)
+
+// ReembedService runs jobs that regenerate every product's embedding, for
+// example with a new model or dimension, into a shadow column of products,
+// leaving the serving embedding untouched until the cutover. Image jobs
+// likewise fill in the image_embedding column image search uses. Products
+// are scanned with partitioned queries. A job skips products whose shadow
+// column is already set unless it overwrites, so starting a new job
+// resumes an interrupted one.
+//
+// Jobs run in the background on the instance that started them, so that
+// instance must keep CPU allocated outside requests until the job ends.
+// Their progress is stored in the reembed_jobs table, where any instance
+// can report or cancel it.
+type ReembedService struct {
+	config  *config.Config
+	spanner *SpannerService
+
+	mu sync.Mutex
+	// running is the job running on this instance, if any
+	running *reembedJob
+}
+
+// reembedJob is a job running on this instance
+type reembedJob struct {
+	models.ReembedJob
+	overwrite bool
+	rate      float64
+
+	processed, skipped, failed atomic.Int64
+	cancel                     context.CancelFunc
+	done                       chan struct{}
+}
+
+// NewReembedService creates a new re-embedding service
+func NewReembedService(cfg *config.Config, spannerSvc *SpannerService) *ReembedService {
+	return &ReembedService{
+		config:  cfg,
+		spanner: spannerSvc,
+	}
+}
+
+// ReembedColumnDDL returns the DDL adding a shadow embedding column of the
+// given dimension to products, with a cosine vector index to search it
+// once it is cut over
+func ReembedColumnDDL(column string, dimension int) ([]string, error) {
+	if !config.EmbeddingColumnPattern.MatchString(column) {
+		return nil, fmt.Errorf("%w: column must match %s, got %q", ErrInvalidReembedJob, config.EmbeddingColumnPattern, column)
+	}
+	return []string{
+		fmt.Sprintf("ALTER TABLE products ADD COLUMN %s ARRAY<FLOAT32>(vector_length=>%d)", column, dimension),
+		fmt.Sprintf("CREATE VECTOR INDEX products_by_%s ON products(%s) STORING (price) WHERE %s IS NOT NULL OPTIONS(distance_type=\"COSINE\", num_leaves=1000)", column, column, column),
+	}, nil
+}
+
+// Start records a new job and runs it in the background. It returns
+// ErrReembedJobRunning if a job is running on any instance.
+func (s *ReembedService) Start(ctx context.Context, req models.ReembedRequest) (*models.ReembedJob, error) {
+	job := &reembedJob{
+		ReembedJob: models.ReembedJob{
+			ID:        newID(),
+			Source:    cmp.Or(req.Source, ReembedSourceText),
+			Model:     cmp.Or(req.Model, s.config.ReembedModel, s.config.GeminiModelName),
+			Dimension: cmp.Or(req.Dimension, s.config.ReembedDimension, s.config.EmbeddingDimension),
+			Column:    cmp.Or(req.Column, s.config.ReembedColumn),
+			Status:    ReembedRunning,
+			StartedAt: time.Now().UTC(),
+		},
+		overwrite: req.Overwrite,
+		rate:      cmp.Or(req.RatePerSecond, s.config.ReembedRatePerSecond),
+		done:      make(chan struct{}),
+	}
+	switch {
+	case job.Source == ReembedSourceImage:
+		// Image embeddings have their own column, sized when it was created
+		if req.Column != "" && req.Column != ImageEmbeddingColumn {
+			return nil, fmt.Errorf("%w: image jobs write to %s", ErrInvalidReembedJob, ImageEmbeddingColumn)
+		}
+		if req.Dimension != 0 && req.Dimension != s.config.ImageEmbeddingDimension {
+			return nil, fmt.Errorf("%w: image jobs embed %d dimensions", ErrInvalidReembedJob, s.config.ImageEmbeddingDimension)
+		}
+		job.Model = cmp.Or(req.Model, s.config.ImageEmbeddingModel)
+		job.Dimension = s.config.ImageEmbeddingDimension
+		job.Column = ImageEmbeddingColumn
+	case job.Source != ReembedSourceText:
+		return nil, fmt.Errorf("%w: source must be %s or %s, got %q", ErrInvalidReembedJob, ReembedSourceText, ReembedSourceImage, job.Source)
+	case !config.EmbeddingColumnPattern.MatchString(job.Column):
+		return nil, fmt.Errorf("%w: column must match %s, got %q", ErrInvalidReembedJob, config.EmbeddingColumnPattern, job.Column)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil {
+		return nil, ErrReembedJobRunning
+	}
+	jobs, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range jobs {
+		if other.Status == ReembedRunning || other.Status == ReembedCancelling {
+			return nil, fmt.Errorf("%w: %s", ErrReembedJobRunning, other.ID)
+		}
+	}
+
+	total, err := s.count(ctx, job.Column, job.overwrite)
+	if err != nil {
+		return nil, err
+	}
+	job.Total = total
+	if err := s.save(ctx, job, true); err != nil {
+		return nil, err
+	}
+
+	// The job outlives the request that started it
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job.cancel = cancel
+	s.running = job
+	go s.run(jobCtx, job)
+
+	log.Printf("Started re-embedding job %s: %d product %ss with %s (%d dimensions) into %s",
+		job.ID, job.Total, job.Source, job.Model, job.Dimension, job.Column)
+	return &job.ReembedJob, nil
+}
+
+// Get returns a job
+func (s *ReembedService) Get(ctx context.Context, id string) (*models.ReembedJob, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT job_id, source, model, dimension, column_name, status, total, processed, skipped, failed, error, started_at, updated_at, finished_at
+              FROM reembed_jobs
+              WHERE job_id = @id`,
+		Params: map[string]interface{}{"id": id},
+	}
+	jobs, err := s.query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, ErrReembedJobNotFound
+	}
+	return &jobs[0], nil
+}
+
+// List returns all jobs, newest first
+func (s *ReembedService) List(ctx context.Context) ([]models.ReembedJob, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT job_id, source, model, dimension, column_name, status, total, processed, skipped, failed, error, started_at, updated_at, finished_at
+              FROM reembed_jobs
+              ORDER BY started_at DESC`,
+	}
+	return s.query(ctx, stmt)
+}
+
+// Cancel asks a running job to stop. The instance running it stops within
+// reembedProgressInterval; products already embedded keep their shadow
+// embeddings.
+func (s *ReembedService) Cancel(ctx context.Context, id string) (*models.ReembedJob, error) {
+	s.mu.Lock()
+	if s.running != nil && s.running.ID == id {
+		s.running.cancel()
+	}
+	s.mu.Unlock()
+
+	_, err := s.spanner.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		row, err := txn.ReadRow(ctx, "reembed_jobs", spanner.Key{id}, []string{"status"})
+		if spanner.ErrCode(err) == codes.NotFound {
+			return ErrReembedJobNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var status string
+		if err := row.Columns(&status); err != nil {
+			return err
+		}
+		if status != ReembedRunning {
+			return nil
+		}
+		return txn.BufferWrite([]*spanner.Mutation{spanner.Update("reembed_jobs",
+			[]string{"job_id", "status", "updated_at"}, []interface{}{id, ReembedCancelling, spanner.CommitTimestamp})})
+	})
+	if err != nil {
+		if errors.Is(err, ErrReembedJobNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to cancel re-embedding job: %w", err)
+	}
+	return s.Get(ctx, id)
+}
+
+// Close stops the job running on this instance, if any, and waits for it
+// to record where it stopped. It is nil-safe.
+func (s *ReembedService) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	job := s.running
+	s.mu.Unlock()
+	if job == nil {
+		return
+	}
+	job.cancel()
+	<-job.done
+}
+
+// run embeds the job's products, partition by partition, and records the
+// outcome
+func (s *ReembedService) run(ctx context.Context, job *reembedJob) {
+	defer close(job.done)
+	defer func() {
+		s.mu.Lock()
+		s.running = nil
+		s.mu.Unlock()
+	}()
+
+	progressDone := make(chan struct{})
+	go s.trackProgress(ctx, job, progressDone)
+
+	err := s.embedAll(ctx, job)
+	close(progressDone)
+
+	switch {
+	case err == nil:
+		job.Status = ReembedCompleted
+	case ctx.Err() != nil:
+		// Cancelled through the API, or this instance is shutting down
+		job.Status = ReembedCancelled
+	default:
+		job.Status = ReembedFailed
+		job.Error = err.Error()
+	}
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := s.save(saveCtx, job, false); err != nil {
+		log.Printf("Warning: could not record the end of re-embedding job %s: %v", job.ID, err)
+	}
+	log.Printf("Re-embedding job %s %s: %d embedded, %d skipped, %d failed",
+		job.ID, job.Status, job.processed.Load(), job.skipped.Load(), job.failed.Load())
+}
+
+// trackProgress records the job's progress every reembedProgressInterval
+// until done is closed, cancelling the job if it was cancelled on another
+// instance
+func (s *ReembedService) trackProgress(ctx context.Context, job *reembedJob, done <-chan struct{}) {
+	ticker := time.NewTicker(reembedProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		stored, err := s.Get(ctx, job.ID)
+		if err == nil && stored.Status == ReembedCancelling {
+			job.cancel()
+			return
+		}
+		if err := s.save(ctx, job, false); err != nil {
+			log.Printf("Warning: could not record progress of re-embedding job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// embedAll partitions the products to embed and embeds the partitions
+// concurrently, at most job.rate products a second overall
+func (s *ReembedService) embedAll(ctx context.Context, job *reembedJob) error {
+	jobCfg := *s.config
+	var embed documentEmbedder
+	switch job.Source {
+	case ReembedSourceImage:
+		jobCfg.ImageEmbeddingModel = job.Model
+		images, err := NewImageEmbeddingService(ctx, &jobCfg)
+		if err != nil {
+			return err
+		}
+		embed = documentEmbedder{document: productImageURI, embed: images.EmbedImageURI}
+	default:
+		jobCfg.GeminiModelName = job.Model
+		jobCfg.EmbeddingDimension = job.Dimension
+		embeddings, err := NewEmbeddingService(ctx, &jobCfg)
+		if err != nil {
+			return err
+		}
+		embed = documentEmbedder{document: productEmbeddingText, embed: embeddings.GenerateDocumentEmbedding}
+	}
+
+	txn, err := s.spanner.client.BatchReadOnlyTransaction(ctx, spanner.StrongRead())
+	if err != nil {
+		return fmt.Errorf("failed to start the partitioned read: %w", err)
+	}
+	defer txn.Close()
+	partitions, err := txn.PartitionQuery(ctx, reembedStatement("product_id, product_data", job.Column, job.overwrite), spanner.PartitionOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to partition products: %w", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / job.rate))
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	work := make(chan *spanner.Partition)
+	var wg sync.WaitGroup
+	for range s.config.ReembedConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partition := range work {
+				if err := s.embedPartition(ctx, job, embed, txn.Execute(ctx, partition), ticker.C); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}()
+	}
+dispatch:
+	for _, partition := range partitions {
+		select {
+		case work <- partition:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// documentEmbedder embeds the part of a product a job's source names
+type documentEmbedder struct {
+	// document returns the product text or image URI to embed, or "" if
+	// the product has none
+	document func(productData map[string]interface{}) string
+	embed    func(ctx context.Context, document string) ([]float32, error)
+}
+
+// embedPartition embeds and writes the products of one partition. Failing
+// products are counted and skipped; it only returns an error when the job
+// cannot go on, such as when the model returns embeddings of the wrong
+// dimension or Vertex AI keeps failing.
+func (s *ReembedService) embedPartition(ctx context.Context, job *reembedJob, embedder documentEmbedder, iter *spanner.RowIterator, tick <-chan time.Time) error {
+	defer iter.Stop()
+
+	var batch []*spanner.Mutation
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read products: %w", err)
+		}
+		var productID string
+		var productData spanner.NullJSON
+		if err := row.Columns(&productID, &productData); err != nil {
+			return fmt.Errorf("failed to scan product: %v", err)
+		}
+		data, _ := productData.Value.(map[string]interface{})
+		document := embedder.document(data)
+		if document == "" {
+			job.skipped.Add(1)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+		}
+		embedding, err := embedder.embed(ctx, document)
+		if errors.Is(err, ErrCircuitOpen) {
+			return fmt.Errorf("embedding failures tripped the circuit breaker: %w", err)
+		}
+		if errors.Is(err, ErrEmbeddingDimension) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Re-embedding job %s: failed to embed product %s: %v", job.ID, productID, err)
+			job.failed.Add(1)
+			continue
+		}
+
+		batch = append(batch, spanner.Update("products", []string{"product_id", job.Column}, []interface{}{productID, embedding}))
+		if len(batch) == reembedWriteBatch {
+			s.write(ctx, job, batch)
+			batch = nil
+		}
+	}
+	s.write(ctx, job, batch)
+	return nil
+}
+
+// write commits a batch of shadow embeddings. If the batch fails, such as
+// because a product was deleted since it was read, the embeddings are
+// written one at a time and the deleted products ignored.
+func (s *ReembedService) write(ctx context.Context, job *reembedJob, batch []*spanner.Mutation) {
+	if len(batch) == 0 {
+		return
+	}
+	if _, err := s.spanner.client.Apply(ctx, batch); err == nil {
+		job.processed.Add(int64(len(batch)))
+		return
+	}
+	for _, mutation := range batch {
+		_, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+		switch {
+		case err == nil:
+			job.processed.Add(1)
+		case spanner.ErrCode(err) == codes.NotFound:
+			job.skipped.Add(1)
+		default:
+			log.Printf("Re-embedding job %s: failed to write an embedding: %v", job.ID, err)
+			job.failed.Add(1)
+		}
+	}
+}
+
+// count returns the number of products a job will embed
+func (s *ReembedService) count(ctx context.Context, column string, overwrite bool) (int64, error) {
+	iter := s.spanner.client.Single().Query(ctx, reembedStatement("COUNT(*)", column, overwrite))
+	defer iter.Stop()
+	row, err := iter.Next()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count products to embed: %w", err)
+	}
+	var total int64
+	if err := row.Columns(&total); err != nil {
+		return 0, fmt.Errorf("failed to scan product count: %v", err)
+	}
+	return total, nil
+}
+
+// reembedStatement selects the columns of the live products a job embeds.
+// column is ImageEmbeddingColumn or has been validated against
+// EmbeddingColumnPattern.
+func reembedStatement(columns, column string, overwrite bool) spanner.Statement {
+	sql := "SELECT " + columns + " FROM products WHERE deleted_at IS NULL"
+	if !overwrite {
+		sql += " AND " + column + " IS NULL"
+	}
+	return spanner.Statement{SQL: sql}
+}
+
+// save records the job's progress, creating its row if insert is set
+func (s *ReembedService) save(ctx context.Context, job *reembedJob, insert bool) error {
+	job.Processed, job.Skipped, job.Failed = job.processed.Load(), job.skipped.Load(), job.failed.Load()
+	var finishedAt spanner.NullTime
+	if job.FinishedAt != nil {
+		finishedAt = spanner.NullTime{Time: *job.FinishedAt, Valid: true}
+	}
+	columns := []string{"job_id", "status", "processed", "skipped", "failed", "error", "updated_at", "finished_at"}
+	values := []interface{}{job.ID, job.Status, job.Processed, job.Skipped, job.Failed,
+		spanner.NullString{StringVal: job.Error, Valid: job.Error != ""}, spanner.CommitTimestamp, finishedAt}
+	mutation := spanner.Update("reembed_jobs", columns, values)
+	if insert {
+		columns = append(columns, "source", "model", "dimension", "column_name", "total", "started_at")
+		values = append(values, job.Source, job.Model, int64(job.Dimension), job.Column, job.Total, job.StartedAt)
+		mutation = spanner.Insert("reembed_jobs", columns, values)
+	}
+	commitTimestamp, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+	if err != nil {
+		return fmt.Errorf("failed to save re-embedding job: %w", err)
+	}
+	job.UpdatedAt = commitTimestamp
+	return nil
+}
+
+// query runs a job listing statement. Running jobs that stopped recording
+// progress are reported as interrupted.
+func (s *ReembedService) query(ctx context.Context, stmt spanner.Statement) ([]models.ReembedJob, error) {
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var jobs []models.ReembedJob
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through re-embedding jobs: %w", err)
+		}
+
+		var job models.ReembedJob
+		var source spanner.NullString
+		var dimension int64
+		var jobErr spanner.NullString
+		var finishedAt spanner.NullTime
+		if err := row.Columns(&job.ID, &source, &job.Model, &dimension, &job.Column, &job.Status, &job.Total,
+			&job.Processed, &job.Skipped, &job.Failed, &jobErr, &job.StartedAt, &job.UpdatedAt, &finishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan re-embedding job: %v", err)
+		}
+		// Jobs from before image jobs existed have no source
+		job.Source = cmp.Or(source.StringVal, ReembedSourceText)
+		job.Dimension = int(dimension)
+		job.Error = jobErr.StringVal
+		if finishedAt.Valid {
+			job.FinishedAt = &finishedAt.Time
+		}
+		if (job.Status == ReembedRunning || job.Status == ReembedCancelling) && time.Since(job.UpdatedAt) > reembedStaleAfter {
+			job.Status = ReembedInterrupted
+		}
+
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
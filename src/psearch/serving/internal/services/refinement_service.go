@@ -0,0 +1,68 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"crypto/rand"
+
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+)
+
+// RefinementService keeps the product IDs of recent search results under
+// opaque tokens, so a later search can be scoped to them without rerunning
+// the original query
+type RefinementService struct {
+	// sets caches result ID lists by token
+	sets *cache.Cache[[]string]
+}
+
+// NewRefinementService creates a refinement service, or returns nil when
+// refinement is disabled
+func NewRefinementService(cfg *config.Config) *RefinementService {
+	if !cfg.RefinementEnabled {
+		return nil
+	}
+	return &RefinementService{
+		sets: cache.New[[]string]("refinement", cfg.RefinementCacheSize, cfg.RefinementTTL),
+	}
+}
+
+// UseRemoteCache shares result sets across replicas, so a refinement can
+// be served by a different instance than the search it refines
+func (s *RefinementService) UseRemoteCache(remote *cache.Remote) {
+	s.sets.SetRemote(remote)
+}
+
+// CacheLayers returns the caches owned by the refinement service
+func (s *RefinementService) CacheLayers() []cache.Layer {
+	return []cache.Layer{s.sets}
+}
+
+// Save stores the IDs of a search's results and returns the token that
+// refers to them
+func (s *RefinementService) Save(ids []string) string {
+	token := rand.Text()
+	s.sets.Set(token, ids)
+	return token
+}
+
+// Load returns the product IDs saved under token, or false when the token
+// is unknown or has expired
+func (s *RefinementService) Load(token string) ([]string, bool) {
+	return s.sets.Get(token)
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"psearch/serving/internal/config"
+)
+
+// LatencyBaseline is the reference p95 latency for a query class, including
+// the p95 of each stage so regressions can be attributed
+type LatencyBaseline struct {
+	QueryClass  string
+	P95         time.Duration
+	StageP95    map[string]time.Duration
+	SampleCount int64
+	Revision    string
+	UpdatedAt   time.Time
+}
+
+// LatencyRegressionEvent is published when a query class regresses against its baseline
+type LatencyRegressionEvent struct {
+	QueryClass       string             `json:"query_class"`
+	Revision         string             `json:"revision"`
+	BaselineRevision string             `json:"baseline_revision"`
+	BaselineP95Ms    float64            `json:"baseline_p95_ms"`
+	CurrentP95Ms     float64            `json:"current_p95_ms"`
+	Regression       float64            `json:"regression"`
+	OffendingStage   string             `json:"offending_stage,omitempty"`
+	StageDeltasMs    map[string]float64 `json:"stage_deltas_ms,omitempty"`
+	SampleCount      int                `json:"sample_count"`
+	DetectedAt       time.Time          `json:"detected_at"`
+}
+
+// latencySample is a single observed request
+type latencySample struct {
+	total  time.Duration
+	stages map[string]time.Duration
+}
+
+// RegressionDetector tracks per-query-class latency against persisted
+// baselines and raises an alert when the current revision regresses p95
+type RegressionDetector struct {
+	config    *config.Config
+	spanner   *SpannerService
+	publisher *PubSubService
+	revision  string
+
+	mu        sync.Mutex
+	samples   map[string][]latencySample
+	baselines map[string]*LatencyBaseline
+	alertedAt map[string]time.Time
+}
+
+// NewRegressionDetector creates a detector and loads the stored baselines
+func NewRegressionDetector(ctx context.Context, cfg *config.Config, spannerSvc *SpannerService, publisher *PubSubService) *RegressionDetector {
+	d := &RegressionDetector{
+		config:    cfg,
+		spanner:   spannerSvc,
+		publisher: publisher,
+		revision:  os.Getenv("K_REVISION"),
+		samples:   make(map[string][]latencySample),
+		baselines: make(map[string]*LatencyBaseline),
+		alertedAt: make(map[string]time.Time),
+	}
+	if d.revision == "" {
+		d.revision = "local"
+	}
+
+	baselines, err := spannerSvc.LoadLatencyBaselines(ctx)
+	if err != nil {
+		log.Printf("Warning: could not load latency baselines: %v", err)
+	}
+	for _, b := range baselines {
+		d.baselines[b.QueryClass] = b
+	}
+
+	return d
+}
+
+// QueryClass buckets a search so that latency is compared between like requests
+func QueryClass(opts SearchOptions) string {
+	mode := string(opts.Mode)
+	if mode == "" {
+		mode = "hybrid"
+	}
+	length := "short"
+	if len(strings.Fields(opts.Query)) > 3 {
+		length = "long"
+	}
+	class := mode + "/" + length
+	if opts.Filter != nil {
+		class += "/filtered"
+	}
+	return class
+}
+
+// Observe records a completed request for the query class
+func (d *RegressionDetector) Observe(queryClass string, total time.Duration, timings *StageTimings) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.samples[queryClass] = append(d.samples[queryClass], latencySample{
+		total:  total,
+		stages: timings.Snapshot(),
+	})
+}
+
+// Run evaluates the collected windows every interval until the context is cancelled
+func (d *RegressionDetector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.RegressionWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.evaluate(ctx)
+		}
+	}
+}
+
+// evaluate compares each query class window against its baseline, alerts on
+// regressions and folds healthy windows into the baseline
+func (d *RegressionDetector) evaluate(ctx context.Context) {
+	d.mu.Lock()
+	windows := d.samples
+	d.samples = make(map[string][]latencySample)
+	d.mu.Unlock()
+
+	for queryClass, samples := range windows {
+		if len(samples) < d.config.RegressionMinSamples {
+			// Carry small windows over so low-traffic classes still accumulate
+			d.mu.Lock()
+			d.samples[queryClass] = append(samples, d.samples[queryClass]...)
+			d.mu.Unlock()
+			continue
+		}
+
+		current := summarizeWindow(queryClass, samples, d.revision)
+
+		d.mu.Lock()
+		baseline := d.baselines[queryClass]
+		d.mu.Unlock()
+
+		if baseline != nil && baseline.P95 > 0 {
+			regression := float64(current.P95-baseline.P95) / float64(baseline.P95)
+			if regression > d.config.RegressionThreshold {
+				d.alert(ctx, baseline, current, regression, len(samples))
+				// Keep the pre-regression baseline so the alert reflects the deploy
+				continue
+			}
+		}
+
+		d.mu.Lock()
+		d.baselines[queryClass] = current
+		d.mu.Unlock()
+
+		if err := d.spanner.SaveLatencyBaseline(ctx, current); err != nil {
+			log.Printf("Warning: could not save latency baseline for %s: %v", queryClass, err)
+		}
+	}
+}
+
+// alert emits the regression metric and publishes the regression event
+func (d *RegressionDetector) alert(ctx context.Context, baseline, current *LatencyBaseline, regression float64, sampleCount int) {
+	d.mu.Lock()
+	last, alerted := d.alertedAt[current.QueryClass]
+	if alerted && time.Since(last) < d.config.RegressionAlertCooldown {
+		d.mu.Unlock()
+		return
+	}
+	d.alertedAt[current.QueryClass] = time.Now()
+	d.mu.Unlock()
+
+	stage, deltas := offendingStage(baseline, current)
+	event := LatencyRegressionEvent{
+		QueryClass:       current.QueryClass,
+		Revision:         d.revision,
+		BaselineRevision: baseline.Revision,
+		BaselineP95Ms:    durationMs(baseline.P95),
+		CurrentP95Ms:     durationMs(current.P95),
+		Regression:       regression,
+		OffendingStage:   stage,
+		StageDeltasMs:    deltas,
+		SampleCount:      sampleCount,
+		DetectedAt:       time.Now().UTC(),
+	}
+
+	// Structured log line picked up by the log-based regression metric
+	metric, _ := json.Marshal(map[string]interface{}{
+		"severity": "WARNING",
+		"message":  fmt.Sprintf("p95 latency regression for %s", current.QueryClass),
+		"metric":   "search/latency_regression",
+		"labels": map[string]string{
+			"query_class":     current.QueryClass,
+			"revision":        d.revision,
+			"offending_stage": stage,
+		},
+		"regression": regression,
+	})
+	fmt.Println(string(metric))
+
+	if d.publisher == nil || d.config.RegressionAlertTopic == "" {
+		return
+	}
+	attributes := map[string]string{
+		"event_type":  "latency_regression",
+		"query_class": current.QueryClass,
+		"revision":    d.revision,
+	}
+	if err := d.publisher.PublishJSON(ctx, d.config.RegressionAlertTopic, event, attributes); err != nil {
+		log.Printf("Warning: could not publish latency regression event: %v", err)
+	}
+}
+
+// offendingStage returns the stage whose p95 grew the most against the baseline
+func offendingStage(baseline, current *LatencyBaseline) (string, map[string]float64) {
+	var worst string
+	var worstDelta time.Duration
+	deltas := make(map[string]float64, len(current.StageP95))
+	for stage, p95 := range current.StageP95 {
+		delta := p95 - baseline.StageP95[stage]
+		deltas[stage] = durationMs(delta)
+		if delta > worstDelta {
+			worst, worstDelta = stage, delta
+		}
+	}
+	return worst, deltas
+}
+
+// summarizeWindow computes the total and per-stage p95 for a window of samples
+func summarizeWindow(queryClass string, samples []latencySample, revision string) *LatencyBaseline {
+	totals := make([]time.Duration, 0, len(samples))
+	stages := make(map[string][]time.Duration)
+	for _, sample := range samples {
+		totals = append(totals, sample.total)
+		for stage, d := range sample.stages {
+			stages[stage] = append(stages[stage], d)
+		}
+	}
+
+	stageP95 := make(map[string]time.Duration, len(stages))
+	for stage, durations := range stages {
+		stageP95[stage] = percentile(durations, 0.95)
+	}
+
+	return &LatencyBaseline{
+		QueryClass:  queryClass,
+		P95:         percentile(totals, 0.95),
+		StageP95:    stageP95,
+		SampleCount: int64(len(samples)),
+		Revision:    revision,
+		UpdatedAt:   time.Now().UTC(),
+	}
+}
+
+// percentile returns the nearest-rank percentile of the durations
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(float64(len(sorted))*p+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
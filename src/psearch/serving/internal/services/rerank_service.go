@@ -0,0 +1,200 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StageRerank is the stage name recorded for the reranking call
+const StageRerank = "rerank"
+
+// RerankService reorders search candidates with the Vertex AI semantic
+// ranking API
+type RerankService struct {
+	config     *config.Config
+	httpClient *http.Client
+}
+
+// NewRerankService creates a new rerank service using REST
+func NewRerankService(ctx context.Context, cfg *config.Config) (*RerankService, error) {
+	client, err := googleClient(ctx, cfg, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create default google client for ranking API: %v", err)
+	}
+
+	return &RerankService{
+		config:     cfg,
+		httpClient: client,
+	}, nil
+}
+
+// rankingRecord is a candidate sent to the ranking API
+type rankingRecord struct {
+	ID      string  `json:"id"`
+	Title   string  `json:"title,omitempty"`
+	Content string  `json:"content,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+}
+
+// Rerank reorders the top candidates by semantic relevance to the query.
+// Candidates beyond the configured top-N keep their fused order after the
+// reranked ones. Each reranked result gets a "rerank" entry in its score map.
+func (s *RerankService) Rerank(ctx context.Context, query string, results []models.SearchResult) ([]models.SearchResult, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+	startTime := time.Now()
+
+	ctx, span := tracer.Start(ctx, "RerankService.Rerank")
+	defer span.End()
+
+	topN := s.config.RerankTopN
+	if topN > len(results) {
+		topN = len(results)
+	}
+	candidates := results[:topN]
+
+	records := make([]rankingRecord, 0, len(candidates))
+	for _, r := range candidates {
+		records = append(records, rankingRecord{
+			ID:      r.ID,
+			Title:   r.Title,
+			Content: rankingContent(r),
+		})
+	}
+
+	url := fmt.Sprintf("https://discoveryengine.googleapis.com/v1/projects/%s/locations/global/rankingConfigs/%s:rank",
+		s.config.ProjectID,
+		s.config.RerankConfigID,
+	)
+
+	requestPayload := struct {
+		Model                         string          `json:"model"`
+		Query                         string          `json:"query"`
+		Records                       []rankingRecord `json:"records"`
+		TopN                          int             `json:"topN"`
+		IgnoreRecordDetailsInResponse bool            `json:"ignoreRecordDetailsInResponse"`
+	}{
+		Model:                         s.config.RerankModel,
+		Query:                         query,
+		Records:                       records,
+		TopN:                          len(records),
+		IgnoreRecordDetailsInResponse: true,
+	}
+
+	jsonBody, err := json.Marshal(requestPayload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rank request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rank request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goog-User-Project", s.config.ProjectID)
+
+	CostRecorderFromContext(ctx).RecordRerank(len(records))
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute rank request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rank response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("ERROR: Ranking API request failed with status %d: %s", resp.StatusCode, string(responseBodyBytes))
+		return nil, fmt.Errorf("ranking API request failed with status %d", resp.StatusCode)
+	}
+
+	var responsePayload struct {
+		Records []rankingRecord `json:"records"`
+	}
+	if err := json.Unmarshal(responseBodyBytes, &responsePayload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rank response body: %v", err)
+	}
+
+	scores := make(map[string]float64, len(responsePayload.Records))
+	for _, r := range responsePayload.Records {
+		scores[r.ID] = r.Score
+	}
+
+	reranked := make([]models.SearchResult, len(candidates))
+	copy(reranked, candidates)
+	for i := range reranked {
+		if score, ok := scores[reranked[i].ID]; ok {
+			reranked[i].Score = withScore(reranked[i].Score, "rerank", score)
+		}
+	}
+	// Stable sort keeps the fused order for candidates with equal scores
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return scores[reranked[i].ID] > scores[reranked[j].ID]
+	})
+
+	recordStage(ctx, StageRerank, startTime)
+	span.SetAttributes(attribute.Int("rerank.candidate_count", len(candidates)))
+	span.AddEvent("reranked", trace.WithAttributes(attribute.Int("rerank.scored_count", len(scores))))
+	log.Printf("Reranked %d candidates in %s", len(candidates), time.Since(startTime))
+
+	return append(reranked, results[topN:]...), nil
+}
+
+// rankingContent builds the record content from the description and the
+// descriptive product fields
+func rankingContent(r models.SearchResult) string {
+	parts := []string{}
+	if r.Description != "" {
+		parts = append(parts, r.Description)
+	}
+	if len(r.Brands) > 0 {
+		parts = append(parts, "Brands: "+strings.Join(r.Brands, ", "))
+	}
+	if len(r.Categories) > 0 {
+		parts = append(parts, "Categories: "+strings.Join(r.Categories, ", "))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// withScore returns a copy of the score map with the named score set, so
+// results shared with other callers are not mutated
+func withScore(scores map[string]float64, name string, value float64) map[string]float64 {
+	updated := make(map[string]float64, len(scores)+1)
+	for k, v := range scores {
+		updated[k] = v
+	}
+	updated[name] = value
+	return updated
+}
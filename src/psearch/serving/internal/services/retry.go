@@ -0,0 +1,85 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+
+	"psearch/serving/internal/metrics"
+)
+
+// RetryPolicy configures jittered exponential backoff for remote calls
+type RetryPolicy struct {
+	// MaxAttempts includes the first call; values below 1 mean a single attempt
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// backoff returns the full-jitter delay before the given retry (1-based)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.InitialBackoff << (retry - 1)
+	if ceiling <= 0 || ceiling > p.MaxBackoff {
+		ceiling = p.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// retry calls fn until it succeeds, fails with a non-transient error, the
+// attempts run out or ctx is done. It returns the last error.
+func retry(ctx context.Context, policy RetryPolicy, operation string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= policy.MaxAttempts || !isTransient(ctx, err) {
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		metrics.RemoteCallRetries.WithLabelValues(operation).Inc()
+		log.Printf("Retrying %s after attempt %d failed (backoff %s): %v", operation, attempt, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// isTransient reports whether a failed remote call is worth retrying: rate
+// limiting, server errors and network failures, unless ctx itself is done
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if IsRetryable(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
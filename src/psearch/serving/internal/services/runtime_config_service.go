@@ -0,0 +1,292 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// ErrInvalidRuntimeConfig is wrapped by errors in runtime config overrides
+var ErrInvalidRuntimeConfig = errors.New("invalid runtime config")
+
+// runtimeConfigID keys the row persisted overrides are stored in
+const runtimeConfigID = "default"
+
+// RuntimeConfigService overrides the tunable parameters, such as the
+// default alpha, result limits, cache TTLs and feature flags, on
+// top of the configuration loaded from the environment. Searches read the
+// current settings on every request, so overrides take effect without a
+// redeploy.
+//
+// Overrides are held in memory by the instance they were set on. Persisted
+// overrides are also stored in Spanner, where every instance picks them up
+// on its next refresh, replacing any in-memory ones.
+type RuntimeConfigService struct {
+	base    *config.Config
+	spanner *SpannerService
+	// onChange is called with the new settings whenever they change
+	onChange func(*config.Config)
+
+	current atomic.Pointer[config.Config]
+
+	// mu serializes changes to the overrides
+	mu        sync.Mutex
+	overrides models.RuntimeConfig
+	updatedAt time.Time
+	persisted bool
+	// storedAt is the update time of the stored overrides last applied, so
+	// refreshes only replace the in-memory overrides when those change
+	storedAt time.Time
+}
+
+// NewRuntimeConfigService creates a runtime config service with no
+// overrides. onChange, if not nil, is called with the new settings whenever
+// they change.
+func NewRuntimeConfigService(cfg *config.Config, spannerSvc *SpannerService, onChange func(*config.Config)) *RuntimeConfigService {
+	s := &RuntimeConfigService{
+		base:     cfg,
+		spanner:  spannerSvc,
+		onChange: onChange,
+	}
+	s.current.Store(cfg)
+	return s
+}
+
+// Run loads the stored overrides at startup and on every refresh interval
+// until ctx is done
+func (s *RuntimeConfigService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.base.RuntimeConfigRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("Warning: could not load runtime config overrides: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Current returns the configuration with the overrides applied. It must
+// not be modified.
+func (s *RuntimeConfigService) Current() *config.Config {
+	return s.current.Load()
+}
+
+// Get returns the settings in effect and the overrides that produce them
+func (s *RuntimeConfigService) Get() models.RuntimeConfigResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.response()
+}
+
+// Set replaces the overrides. With persist they are also stored in Spanner
+// for every instance to load; otherwise they only apply to this instance
+// until overrides are next persisted.
+func (s *RuntimeConfigService) Set(ctx context.Context, overrides models.RuntimeConfig, persist bool) (*models.RuntimeConfigResponse, error) {
+	cfg, err := applyRuntimeConfig(s.base, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updatedAt := time.Now()
+	if persist {
+		mutation := spanner.InsertOrUpdateMap("runtime_config", map[string]interface{}{
+			"id":         runtimeConfigID,
+			"overrides":  spanner.NullJSON{Value: overrides, Valid: true},
+			"updated_at": spanner.CommitTimestamp,
+		})
+		commitTimestamp, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save runtime config: %w", err)
+		}
+		updatedAt, s.storedAt = commitTimestamp, commitTimestamp
+	}
+	s.install(cfg, overrides, updatedAt, persist)
+
+	response := s.response()
+	return &response, nil
+}
+
+// Refresh applies the stored overrides if they changed since they were
+// last applied
+func (s *RuntimeConfigService) Refresh(ctx context.Context) error {
+	row, err := s.spanner.client.Single().ReadRow(ctx, "runtime_config", spanner.Key{runtimeConfigID}, []string{"overrides", "updated_at"})
+	if spanner.ErrCode(err) == codes.NotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read runtime config: %w", err)
+	}
+
+	var overridesJSON spanner.NullJSON
+	var updatedAt time.Time
+	if err := row.Columns(&overridesJSON, &updatedAt); err != nil {
+		return fmt.Errorf("failed to scan runtime config: %v", err)
+	}
+	var overrides models.RuntimeConfig
+	if err := decodeJSONColumn(overridesJSON, &overrides); err != nil {
+		return fmt.Errorf("failed to decode runtime config: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if updatedAt.Equal(s.storedAt) {
+		return nil
+	}
+	// Overrides stored by an instance with a different environment may not
+	// hold against this one's
+	cfg, err := applyRuntimeConfig(s.base, overrides)
+	if err != nil {
+		return err
+	}
+	s.storedAt = updatedAt
+	s.install(cfg, overrides, updatedAt, true)
+	log.Printf("Applied runtime config overrides stored at %s", updatedAt.Format(time.RFC3339))
+	return nil
+}
+
+// install makes cfg the current settings. s.mu must be held.
+func (s *RuntimeConfigService) install(cfg *config.Config, overrides models.RuntimeConfig, updatedAt time.Time, persisted bool) {
+	s.overrides = overrides
+	s.updatedAt = updatedAt
+	s.persisted = persisted
+	s.current.Store(cfg)
+	if s.onChange != nil {
+		s.onChange(cfg)
+	}
+}
+
+// response describes the current settings. s.mu must be held.
+func (s *RuntimeConfigService) response() models.RuntimeConfigResponse {
+	response := models.RuntimeConfigResponse{
+		Effective: runtimeConfigOf(s.Current()),
+		Overrides: s.overrides,
+		Persisted: s.persisted,
+	}
+	if !s.updatedAt.IsZero() {
+		updatedAt := s.updatedAt
+		response.UpdatedAt = &updatedAt
+	}
+	return response
+}
+
+// applyRuntimeConfig returns a copy of base with the overrides applied
+func applyRuntimeConfig(base *config.Config, overrides models.RuntimeConfig) (*config.Config, error) {
+	cfg := *base
+	setIfNotNil(&cfg.DefaultAlpha, overrides.DefaultAlpha)
+	setIfNotNil(&cfg.MinScoreValue, overrides.MinScore)
+	setIfNotNil(&cfg.RRFK, overrides.RRFK)
+	setIfNotNil(&cfg.DefaultLimit, overrides.DefaultLimit)
+	setIfNotNil(&cfg.MaxResultLimit, overrides.MaxResultLimit)
+	setIfNotNil(&cfg.MaxQueryLength, overrides.MaxQueryLength)
+	setIfNotNil(&cfg.MaxFilterConditions, overrides.MaxFilterConditions)
+	if overrides.ResultCacheTTLSeconds != nil {
+		cfg.ResultCacheTTL = secondsDuration(*overrides.ResultCacheTTLSeconds)
+	}
+	if overrides.ResultCacheSoftTTLSeconds != nil {
+		cfg.ResultCacheSoftTTL = secondsDuration(*overrides.ResultCacheSoftTTLSeconds)
+	}
+	if overrides.EmbeddingCacheTTLSeconds != nil {
+		cfg.EmbeddingCacheTTL = secondsDuration(*overrides.EmbeddingCacheTTLSeconds)
+	}
+	setIfNotNil(&cfg.SKUDetectionEnabled, overrides.SKUDetectionEnabled)
+	setIfNotNil(&cfg.MultiQueryEnabled, overrides.MultiQueryEnabled)
+	setIfNotNil(&cfg.DedupeResultsEnabled, overrides.DedupeResultsEnabled)
+	setIfNotNil(&cfg.LanguageDetectionEnabled, overrides.LanguageDetectionEnabled)
+	if len(overrides.FeatureFlags) > 0 {
+		cfg.FeatureFlags = maps.Clone(cfg.FeatureFlags)
+		for name, enabled := range overrides.FeatureFlags {
+			if _, ok := config.FeatureFlagDefaults[name]; !ok {
+				return nil, fmt.Errorf("%w: unknown feature flag %q", ErrInvalidRuntimeConfig, name)
+			}
+			cfg.FeatureFlags[name] = enabled
+		}
+	}
+
+	if cfg.DefaultAlpha < 0 || cfg.DefaultAlpha > 1 {
+		return nil, fmt.Errorf("%w: default_alpha must be between 0.0 and 1.0", ErrInvalidRuntimeConfig)
+	}
+	if cfg.RRFK < 1 || cfg.DefaultLimit < 1 || cfg.MaxQueryLength < 1 || cfg.MaxFilterConditions < 1 {
+		return nil, fmt.Errorf("%w: rrf_k, limits and caps must be positive", ErrInvalidRuntimeConfig)
+	}
+	if cfg.DefaultLimit > cfg.MaxResultLimit {
+		return nil, fmt.Errorf("%w: default_limit %d exceeds max_result_limit %d", ErrInvalidRuntimeConfig, cfg.DefaultLimit, cfg.MaxResultLimit)
+	}
+	if cfg.ResultCacheTTL <= 0 || cfg.EmbeddingCacheTTL <= 0 {
+		return nil, fmt.Errorf("%w: cache TTLs must be positive", ErrInvalidRuntimeConfig)
+	}
+	// Entries cannot go stale after they expire
+	cfg.ResultCacheSoftTTL = min(cfg.ResultCacheSoftTTL, cfg.ResultCacheTTL)
+	return &cfg, nil
+}
+
+// runtimeConfigOf returns the tunable parameters of cfg. The pointers
+// refer to cfg, which is never modified once current.
+func runtimeConfigOf(cfg *config.Config) models.RuntimeConfig {
+	resultTTL, resultSoftTTL := cfg.ResultCacheTTL.Seconds(), cfg.ResultCacheSoftTTL.Seconds()
+	embeddingTTL := cfg.EmbeddingCacheTTL.Seconds()
+	return models.RuntimeConfig{
+		DefaultAlpha:              &cfg.DefaultAlpha,
+		MinScore:                  &cfg.MinScoreValue,
+		RRFK:                      &cfg.RRFK,
+		DefaultLimit:              &cfg.DefaultLimit,
+		MaxResultLimit:            &cfg.MaxResultLimit,
+		MaxQueryLength:            &cfg.MaxQueryLength,
+		MaxFilterConditions:       &cfg.MaxFilterConditions,
+		ResultCacheTTLSeconds:     &resultTTL,
+		ResultCacheSoftTTLSeconds: &resultSoftTTL,
+		EmbeddingCacheTTLSeconds:  &embeddingTTL,
+		SKUDetectionEnabled:       &cfg.SKUDetectionEnabled,
+		MultiQueryEnabled:         &cfg.MultiQueryEnabled,
+		DedupeResultsEnabled:      &cfg.DedupeResultsEnabled,
+		LanguageDetectionEnabled:  &cfg.LanguageDetectionEnabled,
+		FeatureFlags:              cfg.FeatureFlags,
+	}
+}
+
+// setIfNotNil sets *dst to *v when v is not nil
+func setIfNotNil[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// secondsDuration converts a number of seconds to a duration
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,580 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+)
+
+// ErrSavedSearchNotFound is returned when a saved search does not exist
+var ErrSavedSearchNotFound = fmt.Errorf("saved search not found")
+
+// SavedSearchMatchEvent is delivered to webhooks and Pub/Sub when new
+// products match a saved search
+type SavedSearchMatchEvent struct {
+	SavedSearchID string    `json:"saved_search_id"`
+	Name          string    `json:"name"`
+	Query         string    `json:"query"`
+	Filter        string    `json:"filter,omitempty"`
+	CatalogID     string    `json:"catalog_id,omitempty"`
+	UserID        string    `json:"user_id,omitempty"`
+	ProductIDs    []string  `json:"product_ids"`
+	MatchedAt     time.Time `json:"matched_at"`
+}
+
+// SavedSearchService stores saved searches and evaluates them incrementally
+// against products as they are ingested, and on a schedule by re-running
+// them
+type SavedSearchService struct {
+	config     *config.Config
+	spanner    *SpannerService
+	embeddings Embedder
+	publisher  *PubSubService
+	filters    *filter.Registry
+	httpClient *http.Client
+}
+
+// NewSavedSearchService creates a new saved search service
+func NewSavedSearchService(cfg *config.Config, spannerSvc *SpannerService, embeddings Embedder, publisher *PubSubService, filters *filter.Registry) *SavedSearchService {
+	return &SavedSearchService{
+		config:     cfg,
+		spanner:    spannerSvc,
+		embeddings: embeddings,
+		publisher:  publisher,
+		filters:    filters,
+		httpClient: webhookClient(cfg.SavedSearchWebhookHosts),
+	}
+}
+
+// Create validates and stores a saved search. The query embedding is
+// computed once here so evaluation does not call Vertex AI per batch.
+func (s *SavedSearchService) Create(ctx context.Context, req models.SavedSearchRequest) (*models.SavedSearch, error) {
+	if _, err := filter.Parse(req.Filter, s.filters); err != nil {
+		return nil, err
+	}
+
+	embedding, err := s.embeddings.GenerateEmbedding(ctx, req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+
+	saved := &models.SavedSearch{
+		ID:          newID(),
+		Name:        req.Name,
+		Query:       req.Query,
+		Filter:      req.Filter,
+		WebhookURL:  req.WebhookURL,
+		PubSubTopic: req.PubSubTopic,
+		CatalogID:   req.CatalogID,
+		UserID:      req.UserID,
+	}
+
+	mutation := spanner.InsertMap("saved_searches", map[string]interface{}{
+		"saved_search_id": saved.ID,
+		"name":            saved.Name,
+		"query":           saved.Query,
+		"filter":          saved.Filter,
+		"webhook_url":     saved.WebhookURL,
+		"pubsub_topic":    saved.PubSubTopic,
+		"catalog_id":      spanner.NullString{StringVal: saved.CatalogID, Valid: saved.CatalogID != ""},
+		"user_id":         spanner.NullString{StringVal: saved.UserID, Valid: saved.UserID != ""},
+		"query_embedding": embedding,
+		"created_at":      spanner.CommitTimestamp,
+	})
+
+	commitTimestamp, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save search: %w", err)
+	}
+	saved.CreatedAt = commitTimestamp
+
+	return saved, nil
+}
+
+// savedSearchColumns are the saved_searches columns query scans
+const savedSearchColumns = "saved_search_id, name, query, filter, webhook_url, pubsub_topic, catalog_id, user_id, created_at, last_evaluated_at"
+
+// List returns the saved searches of a catalog, or all of them when
+// catalogID is empty, optionally only those of one user
+func (s *SavedSearchService) List(ctx context.Context, catalogID, userID string) ([]models.SavedSearch, error) {
+	params := map[string]interface{}{}
+	where := ""
+	if conditions := ownerConditions(catalogID, userID, params); len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`SELECT %s
+              FROM saved_searches
+              %s
+              ORDER BY created_at DESC`, savedSearchColumns, where),
+		Params: params,
+	}
+	return s.query(ctx, stmt)
+}
+
+// ownerConditions scopes saved searches to a catalog and a user, when
+// they are set
+func ownerConditions(catalogID, userID string, params map[string]interface{}) []string {
+	var conditions []string
+	if clause := catalogClause("catalog_id", catalogID, params); clause != "" {
+		conditions = append(conditions, clause)
+	}
+	if userID != "" {
+		conditions = append(conditions, "user_id = @user_id")
+		params["user_id"] = userID
+	}
+	return conditions
+}
+
+// Get returns a single saved search. Saved searches of another catalog or
+// user, when those are set, are reported as not found.
+func (s *SavedSearchService) Get(ctx context.Context, catalogID, userID, id string) (*models.SavedSearch, error) {
+	params := map[string]interface{}{"id": id}
+	conditions := append([]string{"saved_search_id = @id"}, ownerConditions(catalogID, userID, params)...)
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`SELECT %s
+              FROM saved_searches
+              WHERE %s`, savedSearchColumns, strings.Join(conditions, " AND ")),
+		Params: params,
+	}
+	saved, err := s.query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(saved) == 0 {
+		return nil, ErrSavedSearchNotFound
+	}
+	return &saved[0], nil
+}
+
+// Delete removes a saved search and its match history, scoped like Get
+func (s *SavedSearchService) Delete(ctx context.Context, catalogID, userID, id string) error {
+	if _, err := s.Get(ctx, catalogID, userID, id); err != nil {
+		return err
+	}
+
+	// Matches are interleaved with ON DELETE CASCADE
+	mutation := spanner.Delete("saved_searches", spanner.Key{id})
+	if _, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation}); err != nil {
+		return fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	return nil
+}
+
+// query runs a saved search listing statement
+func (s *SavedSearchService) query(ctx context.Context, stmt spanner.Statement) ([]models.SavedSearch, error) {
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var results []models.SavedSearch
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through saved searches: %w", err)
+		}
+
+		var saved models.SavedSearch
+		var filterExpr, webhookURL, topic, catalogID, userID spanner.NullString
+		var lastEvaluated spanner.NullTime
+		if err := row.Columns(&saved.ID, &saved.Name, &saved.Query, &filterExpr, &webhookURL, &topic, &catalogID, &userID, &saved.CreatedAt, &lastEvaluated); err != nil {
+			return nil, fmt.Errorf("failed to scan saved search: %v", err)
+		}
+		saved.Filter = filterExpr.StringVal
+		saved.WebhookURL = webhookURL.StringVal
+		saved.PubSubTopic = topic.StringVal
+		saved.CatalogID = catalogID.StringVal
+		saved.UserID = userID.StringVal
+		if lastEvaluated.Valid {
+			saved.LastEvaluatedAt = &lastEvaluated.Time
+		}
+
+		results = append(results, saved)
+	}
+	return results, nil
+}
+
+// EvaluateProducts checks newly ingested products against every saved search
+// of their catalog and notifies subscribers of matches they have not been
+// told about yet. It returns the number of notifications sent.
+func (s *SavedSearchService) EvaluateProducts(ctx context.Context, catalogID string, productIDs []string) (int, error) {
+	if len(productIDs) == 0 {
+		return 0, nil
+	}
+	startTime := time.Now()
+
+	savedSearches, err := s.List(ctx, catalogID, "")
+	if err != nil {
+		return 0, err
+	}
+
+	notified := 0
+	for _, saved := range savedSearches {
+		matches, err := s.matchProducts(ctx, saved, productIDs)
+		if err != nil {
+			log.Printf("Warning: could not evaluate saved search %s: %v", saved.ID, err)
+			continue
+		}
+		if s.deliver(ctx, saved, matches) {
+			notified++
+		}
+	}
+
+	log.Printf("Evaluated %d saved searches against %d products in %s, sent %d notifications",
+		len(savedSearches), len(productIDs), time.Since(startTime), notified)
+
+	return notified, nil
+}
+
+// Run re-runs every saved search each SAVED_SEARCH_EVALUATION_INTERVAL, to
+// catch products that started matching without being re-ingested, such as
+// those back in stock
+func (s *SavedSearchService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SavedSearchEvaluationInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.EvaluateScheduled(ctx); err != nil {
+			log.Printf("Warning: scheduled saved search evaluation failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EvaluateScheduled re-runs the saved searches no replica has evaluated
+// within the last interval and notifies subscribers of new matches among
+// their top results. It returns the number of notifications sent.
+func (s *SavedSearchService) EvaluateScheduled(ctx context.Context) (int, error) {
+	startTime := time.Now()
+
+	savedSearches, err := s.List(ctx, "", "")
+	if err != nil {
+		return 0, err
+	}
+
+	evaluated, notified := 0, 0
+	for _, saved := range savedSearches {
+		if ctx.Err() != nil {
+			break
+		}
+		claimed, err := s.claim(ctx, saved.ID)
+		if err != nil {
+			log.Printf("Warning: could not claim saved search %s: %v", saved.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		evaluated++
+
+		// Products that stopped matching the filter are reported again once
+		// they match it again
+		if err := s.forgetUnmatched(ctx, saved); err != nil {
+			log.Printf("Warning: could not reset matches of saved search %s: %v", saved.ID, err)
+		}
+
+		matches, err := s.rerun(ctx, saved)
+		if err != nil {
+			log.Printf("Warning: could not re-run saved search %s: %v", saved.ID, err)
+			continue
+		}
+		if s.deliver(ctx, saved, matches) {
+			notified++
+		}
+	}
+
+	log.Printf("Re-ran %d of %d saved searches in %s, sent %d notifications",
+		evaluated, len(savedSearches), time.Since(startTime), notified)
+
+	return notified, nil
+}
+
+// claim marks the saved search as evaluated now, unless another replica
+// did so within half an interval, so each saved search is evaluated once
+// per interval however many replicas run the schedule. It reports whether
+// the caller should evaluate it.
+func (s *SavedSearchService) claim(ctx context.Context, id string) (bool, error) {
+	claimed := false
+	_, err := s.spanner.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		claimed = false
+		row, err := txn.ReadRow(ctx, "saved_searches", spanner.Key{id}, []string{"last_evaluated_at"})
+		if spanner.ErrCode(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var lastEvaluated spanner.NullTime
+		if err := row.Columns(&lastEvaluated); err != nil {
+			return err
+		}
+		if lastEvaluated.Valid && time.Since(lastEvaluated.Time) < s.config.SavedSearchEvaluationInterval/2 {
+			return nil
+		}
+		claimed = true
+		return txn.BufferWrite([]*spanner.Mutation{spanner.Update("saved_searches",
+			[]string{"saved_search_id", "last_evaluated_at"},
+			[]interface{}{id, spanner.CommitTimestamp})})
+	})
+	return claimed, err
+}
+
+// rerun searches for the saved search's query and returns its top results
+// that count as matches and have not been reported yet
+func (s *SavedSearchService) rerun(ctx context.Context, saved models.SavedSearch) ([]string, error) {
+	node, err := filter.Parse(saved.Filter, s.filters)
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.spanner.HybridSearch(ctx, SearchOptions{
+		Query:     saved.Query,
+		Limit:     s.config.SavedSearchEvaluationLimit,
+		Mode:      models.SearchModeHybrid,
+		Alpha:     s.config.DefaultAlpha,
+		MinScore:  s.config.MinScoreValue,
+		Filter:    node,
+		CatalogID: saved.CatalogID,
+		IDsOnly:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Results) == 0 {
+		return nil, nil
+	}
+
+	// Results must also pass the match test new products are held to
+	productIDs := make([]string, len(output.Results))
+	for i, result := range output.Results {
+		productIDs[i] = result.ID
+	}
+	return s.matchProducts(ctx, saved, productIDs)
+}
+
+// forgetUnmatched drops the reported matches of the saved search that no
+// longer satisfy its filter, such as products out of stock, so they are
+// notified again when they match again. Saved searches without a filter
+// keep their matches.
+func (s *SavedSearchService) forgetUnmatched(ctx context.Context, saved models.SavedSearch) error {
+	if saved.Filter == "" {
+		return nil
+	}
+	node, err := filter.Parse(saved.Filter, s.filters)
+	if err != nil {
+		return err
+	}
+	filterSQL, params := filter.CompileSQL(node, "filter_")
+	params["id"] = saved.ID
+
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`DELETE FROM saved_search_matches m
+              WHERE m.saved_search_id = @id
+                AND NOT EXISTS (
+                  SELECT 1 FROM products
+                  WHERE product_id = m.product_id AND deleted_at IS NULL AND %s)`, filterSQL),
+		Params: params,
+	}
+	_, err = s.spanner.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		_, err := txn.Update(ctx, stmt)
+		return err
+	})
+	return err
+}
+
+// deliver notifies the saved search's subscribers of its new matches and
+// records them, reporting whether a notification was sent
+func (s *SavedSearchService) deliver(ctx context.Context, saved models.SavedSearch, matches []string) bool {
+	if len(matches) == 0 {
+		return false
+	}
+
+	event := SavedSearchMatchEvent{
+		SavedSearchID: saved.ID,
+		Name:          saved.Name,
+		Query:         saved.Query,
+		Filter:        saved.Filter,
+		CatalogID:     saved.CatalogID,
+		UserID:        saved.UserID,
+		ProductIDs:    matches,
+		MatchedAt:     time.Now().UTC(),
+	}
+	if err := s.notify(ctx, saved, event); err != nil {
+		// Matches are not recorded, so the next evaluation retries them
+		log.Printf("Warning: could not notify saved search %s: %v", saved.ID, err)
+		return false
+	}
+	if err := s.recordMatches(ctx, saved.ID, matches); err != nil {
+		log.Printf("Warning: could not record matches for saved search %s: %v", saved.ID, err)
+	}
+	return true
+}
+
+// matchProducts returns the products among productIDs that match the saved
+// search (keyword match or close enough in embedding space, plus its filter)
+// and have not been reported for it before
+func (s *SavedSearchService) matchProducts(ctx context.Context, saved models.SavedSearch, productIDs []string) ([]string, error) {
+	params := map[string]interface{}{
+		"id":           saved.ID,
+		"product_ids":  productIDs,
+		"query_text":   saved.Query,
+		"max_distance": s.config.SavedSearchMaxDistance,
+	}
+
+	filterClause := ""
+	if saved.Filter != "" {
+		node, err := filter.Parse(saved.Filter, s.filters)
+		if err != nil {
+			return nil, err
+		}
+		filterSQL, filterParams := filter.CompileSQL(node, "filter_")
+		filterClause = "AND " + filterSQL
+		for name, value := range filterParams {
+			params[name] = value
+		}
+	}
+	filterClause += andClause(catalogClause("p.catalog_id", saved.CatalogID, params))
+
+	textMatch, _ := ftsSQL(s.spanner.config.FTSFields, "p", false, KeywordParams{})
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf(`SELECT p.product_id
+              FROM products p
+              JOIN saved_searches s ON s.saved_search_id = @id
+              WHERE p.product_id IN UNNEST(@product_ids) AND p.deleted_at IS NULL
+                AND (%s
+                     OR (p.embedding IS NOT NULL
+                         AND COSINE_DISTANCE(p.embedding, s.query_embedding) <= @max_distance))
+                %s
+                AND p.product_id NOT IN (
+                  SELECT m.product_id FROM saved_search_matches m WHERE m.saved_search_id = @id)`, textMatch, filterClause),
+		Params: params,
+	}
+
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var matches []string
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through saved search matches: %w", err)
+		}
+		var productID string
+		if err := row.Columns(&productID); err != nil {
+			return nil, fmt.Errorf("failed to scan saved search match: %v", err)
+		}
+		matches = append(matches, productID)
+	}
+	return matches, nil
+}
+
+// notify delivers the match event to the saved search's webhook and/or
+// Pub/Sub topic, falling back to the default topic
+func (s *SavedSearchService) notify(ctx context.Context, saved models.SavedSearch, event SavedSearchMatchEvent) error {
+	topic := saved.PubSubTopic
+	if topic == "" && saved.WebhookURL == "" {
+		topic = s.config.SavedSearchTopic
+	}
+
+	if saved.WebhookURL != "" {
+		// Saved searches created before webhooks were restricted may
+		// still hold URLs that are no longer accepted
+		if err := ValidateWebhookURL(saved.WebhookURL, s.config.SavedSearchWebhookHosts); err != nil {
+			return err
+		}
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal webhook payload: %v", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, saved.WebhookURL, bytes.NewBuffer(body))
+		if err != nil {
+			return fmt.Errorf("failed to create webhook request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("webhook delivery failed: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+	}
+
+	if topic != "" && s.publisher != nil {
+		attributes := map[string]string{
+			"event_type":      "saved_search_match",
+			"saved_search_id": saved.ID,
+		}
+		if saved.UserID != "" {
+			attributes["user_id"] = saved.UserID
+		}
+		if err := s.publisher.PublishJSON(ctx, topic, event, attributes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordMatches remembers which products were reported so they are only
+// notified once per saved search
+func (s *SavedSearchService) recordMatches(ctx context.Context, savedSearchID string, productIDs []string) error {
+	mutations := make([]*spanner.Mutation, 0, len(productIDs))
+	for _, productID := range productIDs {
+		mutations = append(mutations, spanner.InsertOrUpdate("saved_search_matches",
+			[]string{"saved_search_id", "product_id", "matched_at"},
+			[]interface{}{savedSearchID, productID, spanner.CommitTimestamp}))
+	}
+	_, err := s.spanner.client.Apply(ctx, mutations)
+	return err
+}
+
+// newID returns a random 128-bit hex identifier
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+)
+
+// schemaMigrationsDDL creates the table recording applied migrations
+const schemaMigrationsDDL = "CREATE TABLE schema_migrations (version INT64 NOT NULL, description STRING(MAX), applied_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(version)"
+
+// SchemaMigration is a versioned change to the Spanner schema
+type SchemaMigration struct {
+	Version     int64
+	Description string
+	Statements  []string
+}
+
+// SchemaMigrations returns the migrations that build the schema this
+// service expects, in version order. Vector columns are sized to
+// EMBEDDING_DIMENSION, and image_embedding to IMAGE_EMBEDDING_DIMENSION. Applied migrations must never change: schema changes
+// are appended as new versions.
+func SchemaMigrations(cfg *config.Config) []SchemaMigration {
+	dim := cfg.EmbeddingDimension
+	return []SchemaMigration{
+		{
+			Version:     1,
+			Description: "baseline schema",
+			Statements: []string{
+				fmt.Sprintf("CREATE TABLE products (product_id STRING(MAX), product_data JSON, title STRING(MAX), catalog_id STRING(64), embedding ARRAY<FLOAT32>(vector_length=>%d), "+
+					"gtin STRING(64) AS (JSON_VALUE(product_data, '$.gtin')) STORED, "+
+					"price FLOAT64 AS (SAFE_CAST(JSON_VALUE(product_data, '$.priceInfo.price') AS FLOAT64)) STORED, "+
+					"%s, %s, %s, %s) PRIMARY KEY(product_id)",
+					dim, ftsColumnDDL["title"], ftsColumnDDL["description"], ftsColumnDDL["brands"], ftsColumnDDL["attributes"]),
+				"CREATE SEARCH INDEX " + ftsSearchIndex + " ON products(title_tokens, description_tokens, brand_tokens, attribute_tokens)",
+				"CREATE VECTOR INDEX products_by_embedding ON products(embedding) STORING (price) WHERE embedding IS NOT NULL OPTIONS(distance_type=\"COSINE\", num_leaves=1000)",
+				"CREATE INDEX products_by_catalog ON products(catalog_id)",
+				"CREATE INDEX products_by_gtin ON products(gtin)",
+				"CREATE TABLE product_quality (product_id STRING(MAX), score FLOAT64 NOT NULL, issues ARRAY<STRING(MAX)>, scored_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(product_id), INTERLEAVE IN PARENT products ON DELETE CASCADE",
+				"CREATE TABLE product_stats (product_id STRING(MAX), click_count INT64 NOT NULL, purchase_count INT64 NOT NULL, updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(product_id), INTERLEAVE IN PARENT products ON DELETE CASCADE",
+				"CREATE TABLE product_change_history (product_id STRING(MAX) NOT NULL, changed_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true), price FLOAT64, currency_code STRING(3), availability STRING(MAX)) PRIMARY KEY(product_id, changed_at DESC)",
+				"CREATE TABLE catalog_versions (catalog_id STRING(64) NOT NULL, version STRING(MAX) NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(catalog_id)",
+				fmt.Sprintf("CREATE TABLE saved_searches (saved_search_id STRING(64) NOT NULL, name STRING(MAX), query STRING(MAX) NOT NULL, filter STRING(MAX), webhook_url STRING(MAX), pubsub_topic STRING(MAX), query_embedding ARRAY<FLOAT32>(vector_length=>%d), catalog_id STRING(64), created_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(saved_search_id)", dim),
+				"CREATE TABLE saved_search_matches (saved_search_id STRING(64) NOT NULL, product_id STRING(MAX) NOT NULL, matched_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(saved_search_id, product_id), INTERLEAVE IN PARENT saved_searches ON DELETE CASCADE",
+				"CREATE TABLE query_latency_baselines (query_class STRING(MAX) NOT NULL, p95_ms FLOAT64, stage_p95_ms JSON, sample_count INT64, revision STRING(MAX), updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(query_class)",
+				"CREATE TABLE head_queries (query STRING(MAX) NOT NULL, search_count INT64 NOT NULL, updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(query)",
+				"CREATE TABLE query_templates (template_id STRING(64) NOT NULL, description STRING(MAX), search JSON NOT NULL, parameters JSON, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(template_id)",
+				"CREATE TABLE scoring_profiles (category STRING(MAX) NOT NULL, alpha FLOAT64, min_score FLOAT64, mode STRING(16), updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(category)",
+				"CREATE TABLE merchandising_rules (rule_id STRING(64) NOT NULL, name STRING(MAX), query_pattern STRING(MAX), category STRING(MAX), boost_product_ids ARRAY<STRING(MAX)>, bury_product_ids ARRAY<STRING(MAX)>, pins JSON, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(rule_id)",
+				fmt.Sprintf("CREATE TABLE user_profiles (user_id STRING(128) NOT NULL, embedding ARRAY<FLOAT32>(vector_length=>%d), clicks INT64 NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(user_id)", dim),
+				"CREATE TABLE search_events (event_id STRING(32) NOT NULL, event_type STRING(32) NOT NULL, query STRING(MAX), product_id STRING(MAX) NOT NULL, position INT64, session_id STRING(MAX), user_id STRING(128), catalog_id STRING(MAX), occurred_at TIMESTAMP NOT NULL, received_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(event_id)",
+				"CREATE INDEX search_events_by_product ON search_events(product_id, event_type, occurred_at DESC)",
+				"CREATE TABLE relevance_samples (week STRING(8) NOT NULL, query STRING(MAX) NOT NULL, stratum STRING(64) NOT NULL, searches INT64 NOT NULL, results JSON, sampled_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(week, query)",
+			},
+		},
+		{
+			Version:     2,
+			Description: "product soft-delete tombstones",
+			Statements: []string{
+				"ALTER TABLE products ADD COLUMN deleted_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)",
+			},
+		},
+		{
+			Version:     3,
+			Description: "ranking experiments",
+			Statements: []string{
+				"CREATE TABLE experiments (experiment_id STRING(64) NOT NULL, description STRING(MAX), enabled BOOL NOT NULL, arms JSON NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(experiment_id)",
+				"ALTER TABLE search_events ADD COLUMN experiment_id STRING(64)",
+				"ALTER TABLE search_events ADD COLUMN experiment_arm STRING(64)",
+				"CREATE INDEX search_events_by_experiment ON search_events(experiment_id, occurred_at) STORING (experiment_arm, event_type)",
+			},
+		},
+		{
+			Version:     4,
+			Description: "hourly query analytics",
+			Statements: []string{
+				"CREATE TABLE query_analytics (hour TIMESTAMP NOT NULL, query STRING(MAX) NOT NULL, searches INT64 NOT NULL, zero_results INT64 NOT NULL, latency_ms_sum FLOAT64 NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(hour, query)",
+			},
+		},
+		{
+			Version:     5,
+			Description: "re-embedding jobs",
+			Statements: []string{
+				"CREATE TABLE reembed_jobs (job_id STRING(64) NOT NULL, model STRING(MAX) NOT NULL, dimension INT64 NOT NULL, column_name STRING(64) NOT NULL, status STRING(16) NOT NULL, total INT64 NOT NULL, processed INT64 NOT NULL, skipped INT64 NOT NULL, failed INT64 NOT NULL, error STRING(MAX), started_at TIMESTAMP NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true), finished_at TIMESTAMP) PRIMARY KEY(job_id)",
+			},
+		},
+		{
+			Version:     6,
+			Description: "product image embeddings",
+			Statements: []string{
+				fmt.Sprintf("ALTER TABLE products ADD COLUMN image_embedding ARRAY<FLOAT32>(vector_length=>%d)", cfg.ImageEmbeddingDimension),
+				"CREATE VECTOR INDEX products_by_image_embedding ON products(image_embedding) STORING (price) WHERE image_embedding IS NOT NULL OPTIONS(distance_type=\"COSINE\", num_leaves=1000)",
+				"ALTER TABLE reembed_jobs ADD COLUMN source STRING(16)",
+			},
+		},
+		{
+			Version:     7,
+			Description: "store availability",
+			Statements: []string{
+				"CREATE TABLE stores (store_id STRING(64) NOT NULL, name STRING(MAX), latitude FLOAT64 NOT NULL, longitude FLOAT64 NOT NULL, updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(store_id)",
+				"CREATE INDEX stores_by_latitude ON stores(latitude) STORING (name, longitude)",
+				"CREATE TABLE product_store_availability (product_id STRING(MAX), store_id STRING(64) NOT NULL, quantity INT64 NOT NULL, updated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(product_id, store_id), INTERLEAVE IN PARENT products ON DELETE CASCADE",
+			},
+		},
+		{
+			Version:     8,
+			Description: "saved search owners and scheduled evaluation",
+			Statements: []string{
+				"ALTER TABLE saved_searches ADD COLUMN user_id STRING(128)",
+				"ALTER TABLE saved_searches ADD COLUMN last_evaluated_at TIMESTAMP OPTIONS (allow_commit_timestamp=true)",
+				"CREATE INDEX saved_searches_by_user ON saved_searches(user_id)",
+			},
+		},
+		{
+			Version:     9,
+			Description: "runtime config overrides",
+			Statements: []string{
+				"CREATE TABLE runtime_config (id STRING(64) NOT NULL, overrides JSON NOT NULL, updated_at TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY(id)",
+			},
+		},
+	}
+}
+
+// SchemaMigrator applies schema migrations to the configured database,
+// recording each applied version in schema_migrations
+type SchemaMigrator struct {
+	admin      *database.DatabaseAdminClient
+	client     *spanner.Client
+	database   string
+	migrations []SchemaMigration
+}
+
+// NewSchemaMigrator connects to the configured database. The database itself
+// must already exist.
+func NewSchemaMigrator(ctx context.Context, cfg *config.Config) (*SchemaMigrator, error) {
+	databaseName := fmt.Sprintf("projects/%s/instances/%s/databases/%s",
+		cfg.ProjectID, cfg.SpannerInstanceID, cfg.SpannerDatabaseID)
+
+	admin, err := database.NewDatabaseAdminClient(ctx, spannerClientOptions(cfg)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Spanner admin client: %v", err)
+	}
+	client, err := spanner.NewClient(ctx, databaseName, spannerClientOptions(cfg)...)
+	if err != nil {
+		admin.Close()
+		return nil, fmt.Errorf("failed to create Spanner client: %v", err)
+	}
+	return &SchemaMigrator{
+		admin:      admin,
+		client:     client,
+		database:   databaseName,
+		migrations: SchemaMigrations(cfg),
+	}, nil
+}
+
+// Close closes the Spanner clients
+func (m *SchemaMigrator) Close() {
+	m.client.Close()
+	m.admin.Close()
+}
+
+// Pending returns the migrations not yet recorded as applied, in version
+// order. A database without a schema_migrations table has applied none.
+func (m *SchemaMigrator) Pending(ctx context.Context) ([]SchemaMigration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []SchemaMigration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Apply runs the migration's statements as one schema update and records
+// it. Spanner cannot roll back a partly applied schema update, so a failed
+// migration has to be repaired by hand before it is retried.
+func (m *SchemaMigrator) Apply(ctx context.Context, migration SchemaMigration) error {
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+	if err := m.updateDDL(ctx, migration.Statements); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Description, err)
+	}
+	return m.record(ctx, migration)
+}
+
+// Baseline records the migrations up to version as applied without running
+// them, for databases whose schema was created before migrations were
+// tracked, such as by Terraform
+func (m *SchemaMigrator) Baseline(ctx context.Context, version int64) ([]SchemaMigration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	var recorded []SchemaMigration
+	for _, migration := range pending {
+		if migration.Version > version {
+			break
+		}
+		if err := m.record(ctx, migration); err != nil {
+			return recorded, err
+		}
+		recorded = append(recorded, migration)
+	}
+	return recorded, nil
+}
+
+// applied returns the versions recorded in schema_migrations
+func (m *SchemaMigrator) applied(ctx context.Context) (map[int64]bool, error) {
+	exists, err := m.tableExists(ctx)
+	if err != nil || !exists {
+		return map[int64]bool{}, err
+	}
+
+	applied := make(map[int64]bool)
+	iter := m.client.Single().Query(ctx, spanner.Statement{SQL: "SELECT version FROM schema_migrations"})
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		var version int64
+		if err := row.Columns(&version); err != nil {
+			return nil, fmt.Errorf("failed to scan schema migration: %v", err)
+		}
+		applied[version] = true
+	}
+	return applied, nil
+}
+
+// tableExists reports whether the database has a schema_migrations table
+func (m *SchemaMigrator) tableExists(ctx context.Context) (bool, error) {
+	resp, err := m.admin.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: m.database})
+	if err != nil {
+		return false, fmt.Errorf("failed to read the database schema: %w", err)
+	}
+	for _, stmt := range resp.GetStatements() {
+		if strings.HasPrefix(stmt, "CREATE TABLE schema_migrations ") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ensureTable creates schema_migrations if it does not exist
+func (m *SchemaMigrator) ensureTable(ctx context.Context) error {
+	exists, err := m.tableExists(ctx)
+	if err != nil || exists {
+		return err
+	}
+	if err := m.updateDDL(ctx, []string{schemaMigrationsDDL}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// updateDDL runs a schema update and waits for it to complete
+func (m *SchemaMigrator) updateDDL(ctx context.Context, statements []string) error {
+	op, err := m.admin.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+		Database:   m.database,
+		Statements: statements,
+	})
+	if err != nil {
+		return err
+	}
+	return op.Wait(ctx)
+}
+
+// record marks the migration as applied
+func (m *SchemaMigrator) record(ctx context.Context, migration SchemaMigration) error {
+	_, err := m.client.Apply(ctx, []*spanner.Mutation{
+		spanner.InsertOrUpdate("schema_migrations",
+			[]string{"version", "description", "applied_at"},
+			[]interface{}{migration.Version, migration.Description, spanner.CommitTimestamp}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return nil
+}
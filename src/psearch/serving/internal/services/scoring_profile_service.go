@@ -0,0 +1,243 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// ErrScoringProfileNotFound is returned when a category has no scoring
+// profile
+var ErrScoringProfileNotFound = errors.New("scoring profile not found")
+
+// ErrInvalidScoringProfile is wrapped by errors in a profile definition
+var ErrInvalidScoringProfile = errors.New("invalid scoring profile")
+
+// categorySeparator separates the levels of a category path
+const categorySeparator = " > "
+
+// ScoringProfileService stores per-category fusion defaults, such as a
+// vector-heavy alpha for fashion or keyword-heavy search for electronics
+// part numbers. Profiles are few, so all of them are kept in memory.
+type ScoringProfileService struct {
+	config  *config.Config
+	spanner *SpannerService
+
+	mu sync.RWMutex
+	// profiles are keyed by lowercased category
+	profiles map[string]models.ScoringProfile
+}
+
+// NewScoringProfileService creates a new scoring profile service
+func NewScoringProfileService(cfg *config.Config, spannerSvc *SpannerService) *ScoringProfileService {
+	return &ScoringProfileService{
+		config:   cfg,
+		spanner:  spannerSvc,
+		profiles: make(map[string]models.ScoringProfile),
+	}
+}
+
+// Run loads the profiles at startup and on every refresh interval until ctx
+// is done
+func (s *ScoringProfileService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ScoringProfileRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("Warning: could not load scoring profiles: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh replaces the in-memory profiles with the stored ones
+func (s *ScoringProfileService) Refresh(ctx context.Context) error {
+	stored, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	profiles := make(map[string]models.ScoringProfile, len(stored))
+	for _, profile := range stored {
+		profiles[strings.ToLower(profile.Category)] = profile
+	}
+
+	s.mu.Lock()
+	s.profiles = profiles
+	s.mu.Unlock()
+	return nil
+}
+
+// Match returns the profile for category, falling back to the nearest
+// parent category that has one, e.g. "Apparel" for "Apparel > Shoes"
+func (s *ScoringProfileService) Match(category string) (models.ScoringProfile, bool) {
+	key := strings.ToLower(strings.TrimSpace(category))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for key != "" {
+		if profile, ok := s.profiles[key]; ok {
+			return profile, true
+		}
+		i := strings.LastIndex(key, categorySeparator)
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return models.ScoringProfile{}, false
+}
+
+// Put creates or replaces the profile for a category
+func (s *ScoringProfileService) Put(ctx context.Context, category string, req models.ScoringProfileRequest) (*models.ScoringProfile, error) {
+	mutation, err := s.putMutation(category, req)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &models.ScoringProfile{
+		Category: strings.TrimSpace(category),
+		Alpha:    req.Alpha,
+		MinScore: req.MinScore,
+		Mode:     req.Mode,
+	}
+
+	commitTimestamp, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save scoring profile: %w", err)
+	}
+	profile.UpdatedAt = commitTimestamp
+
+	s.mu.Lock()
+	s.profiles[strings.ToLower(profile.Category)] = *profile
+	s.mu.Unlock()
+
+	return profile, nil
+}
+
+// putMutation validates the profile and returns the mutation that stores
+// it for category
+func (s *ScoringProfileService) putMutation(category string, req models.ScoringProfileRequest) (*spanner.Mutation, error) {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return nil, fmt.Errorf("%w: category is required", ErrInvalidScoringProfile)
+	}
+	if req.Alpha != nil && (*req.Alpha < 0 || *req.Alpha > 1) {
+		return nil, fmt.Errorf("%w: alpha must be between 0.0 and 1.0", ErrInvalidScoringProfile)
+	}
+	switch req.Mode {
+	case "", models.SearchModeHybrid, models.SearchModeVector, models.SearchModeKeyword:
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidScoringProfile, req.Mode)
+	}
+
+	return spanner.InsertOrUpdateMap("scoring_profiles", map[string]interface{}{
+		"category":   category,
+		"alpha":      spanner.NullFloat64{Float64: derefFloat(req.Alpha), Valid: req.Alpha != nil},
+		"min_score":  spanner.NullFloat64{Float64: derefFloat(req.MinScore), Valid: req.MinScore != nil},
+		"mode":       spanner.NullString{StringVal: string(req.Mode), Valid: req.Mode != ""},
+		"updated_at": spanner.CommitTimestamp,
+	}), nil
+}
+
+// Delete removes the profile for a category
+func (s *ScoringProfileService) Delete(ctx context.Context, category string) error {
+	category = strings.TrimSpace(category)
+	_, err := s.spanner.client.Single().ReadRow(ctx, "scoring_profiles", spanner.Key{category}, []string{"category"})
+	if spanner.ErrCode(err) == codes.NotFound {
+		return ErrScoringProfileNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read scoring profile: %w", err)
+	}
+
+	mutation := spanner.Delete("scoring_profiles", spanner.Key{category})
+	if _, err := s.spanner.client.Apply(ctx, []*spanner.Mutation{mutation}); err != nil {
+		return fmt.Errorf("failed to delete scoring profile: %w", err)
+	}
+
+	s.mu.Lock()
+	delete(s.profiles, strings.ToLower(category))
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns all stored scoring profiles
+func (s *ScoringProfileService) List(ctx context.Context) ([]models.ScoringProfile, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT category, alpha, min_score, mode, updated_at
+              FROM scoring_profiles
+              ORDER BY category`,
+	}
+	iter := s.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var profiles []models.ScoringProfile
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through scoring profiles: %w", err)
+		}
+
+		var profile models.ScoringProfile
+		var alpha, minScore spanner.NullFloat64
+		var mode spanner.NullString
+		if err := row.Columns(&profile.Category, &alpha, &minScore, &mode, &profile.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan scoring profile: %v", err)
+		}
+		if alpha.Valid {
+			profile.Alpha = &alpha.Float64
+		}
+		if minScore.Valid {
+			profile.MinScore = &minScore.Float64
+		}
+		profile.Mode = models.SearchMode(mode.StringVal)
+
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// derefFloat returns the value f points to, or zero
+func derefFloat(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
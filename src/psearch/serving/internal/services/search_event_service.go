@@ -0,0 +1,154 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/models"
+)
+
+// RecordedSearchEvent is a search event as stored in search_events or
+// published to SEARCH_EVENTS_TOPIC
+type RecordedSearchEvent struct {
+	EventID string `json:"event_id"`
+	models.SearchEvent
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// SearchEventService records shopper interactions with search results.
+// Clicks by known users also update their personalization profiles, and
+// clicks in a session its session context.
+type SearchEventService struct {
+	config    *config.Config
+	spanner   *SpannerService
+	publisher *PubSubService
+	profiles  *UserProfileService
+	// sessions is nil unless SESSION_CONTEXT_ENABLED is set
+	sessions *SessionService
+}
+
+// NewSearchEventService creates a new search event service
+func NewSearchEventService(cfg *config.Config, spannerSvc *SpannerService, publisher *PubSubService, profiles *UserProfileService, sessions *SessionService) *SearchEventService {
+	return &SearchEventService{
+		config:    cfg,
+		spanner:   spannerSvc,
+		publisher: publisher,
+		profiles:  profiles,
+		sessions:  sessions,
+	}
+}
+
+// Record stores the events in the configured sink. The events' sessions
+// are the owner's. Profile updates are best effort and do not fail the
+// request.
+func (s *SearchEventService) Record(ctx context.Context, owner string, events []models.SearchEvent) error {
+	receivedAt := time.Now().UTC()
+	recorded := make([]RecordedSearchEvent, len(events))
+	for i, event := range events {
+		if event.OccurredAt == nil {
+			event.OccurredAt = &receivedAt
+		}
+		recorded[i] = RecordedSearchEvent{EventID: newID(), SearchEvent: event, ReceivedAt: receivedAt}
+	}
+
+	var err error
+	if s.config.SearchEventsSink == "pubsub" {
+		err = s.publish(ctx, recorded)
+	} else {
+		err = s.write(ctx, recorded)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		metrics.SearchEvents.WithLabelValues(string(event.Type)).Inc()
+		if event.Experiment != nil {
+			metrics.ExperimentEvents.WithLabelValues(event.Experiment.ID, event.Experiment.Arm, string(event.Type)).Inc()
+		}
+		if event.Type != models.SearchEventClick {
+			continue
+		}
+		if event.UserID != "" {
+			if err := s.profiles.RecordClick(ctx, event.UserID, event.ProductID); err != nil {
+				log.Printf("Warning: could not update profile of user %s from click on %s: %v", event.UserID, event.ProductID, err)
+			}
+		}
+		if err := s.sessions.RecordClick(ctx, owner, event.SessionID, event.ProductID); err != nil {
+			log.Printf("Warning: could not update session %s from click on %s: %v", event.SessionID, event.ProductID, err)
+		}
+	}
+	return nil
+}
+
+// write inserts the events into the search_events table
+func (s *SearchEventService) write(ctx context.Context, events []RecordedSearchEvent) error {
+	mutations := make([]*spanner.Mutation, len(events))
+	for i, event := range events {
+		var position spanner.NullInt64
+		if event.Position != nil {
+			position = spanner.NullInt64{Int64: int64(*event.Position), Valid: true}
+		}
+		var experimentID, experimentArm spanner.NullString
+		if event.Experiment != nil {
+			experimentID = spanner.NullString{StringVal: event.Experiment.ID, Valid: true}
+			experimentArm = spanner.NullString{StringVal: event.Experiment.Arm, Valid: true}
+		}
+		mutations[i] = spanner.InsertMap("search_events", map[string]interface{}{
+			"event_id":       event.EventID,
+			"event_type":     string(event.Type),
+			"query":          spanner.NullString{StringVal: event.Query, Valid: event.Query != ""},
+			"product_id":     event.ProductID,
+			"position":       position,
+			"session_id":     spanner.NullString{StringVal: event.SessionID, Valid: event.SessionID != ""},
+			"user_id":        spanner.NullString{StringVal: event.UserID, Valid: event.UserID != ""},
+			"catalog_id":     spanner.NullString{StringVal: event.CatalogID, Valid: event.CatalogID != ""},
+			"experiment_id":  experimentID,
+			"experiment_arm": experimentArm,
+			"occurred_at":    *event.OccurredAt,
+			"received_at":    spanner.CommitTimestamp,
+		})
+	}
+
+	if _, err := s.spanner.client.Apply(ctx, mutations); err != nil {
+		return fmt.Errorf("failed to write search events: %w", err)
+	}
+	return nil
+}
+
+// publish sends each event as its own message, with its type as an
+// attribute for subscription filters
+func (s *SearchEventService) publish(ctx context.Context, events []RecordedSearchEvent) error {
+	messages := make([]interface{}, len(events))
+	for i, event := range events {
+		messages[i] = event
+	}
+	err := s.publisher.PublishJSONBatch(ctx, s.config.SearchEventsTopic, messages, func(i int) map[string]string {
+		return map[string]string{"event_type": string(events[i].Type)}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish search events: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/metrics"
+)
+
+// searchLogShutdownTimeout bounds writing the buffered logs on shutdown
+const searchLogShutdownTimeout = 5 * time.Second
+
+// searchLogRetryPolicy retries appends that failed transiently. Logs are
+// written off the request path, so backoffs can be long.
+var searchLogRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// searchLogColumn is a column of the search log table and the field that
+// carries it in appended rows
+type searchLogColumn struct {
+	name      string
+	sqlType   string
+	protoType descriptorpb.FieldDescriptorProto_Type
+	repeated  bool
+}
+
+// searchLogColumns are the search log table's columns, in field number
+// order. Columns may only be appended.
+var searchLogColumns = []searchLogColumn{
+	{name: "timestamp", sqlType: "TIMESTAMP", protoType: descriptorpb.FieldDescriptorProto_TYPE_INT64},
+	{name: "query", sqlType: "STRING", protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+	{name: "mode", sqlType: "STRING", protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+	{name: "filter", sqlType: "STRING", protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+	{name: "catalog_id", sqlType: "STRING", protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+	{name: "latency_ms", sqlType: "FLOAT64", protoType: descriptorpb.FieldDescriptorProto_TYPE_DOUBLE},
+	{name: "result_ids", sqlType: "STRING", protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated: true},
+	{name: "scores", sqlType: "FLOAT64", protoType: descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, repeated: true},
+	{name: "fallback", sqlType: "STRING", protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+	{name: "experiment_id", sqlType: "STRING", protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+	{name: "experiment_arm", sqlType: "STRING", protoType: descriptorpb.FieldDescriptorProto_TYPE_STRING},
+}
+
+// SearchLog is a structured record of a served search, for offline
+// relevance analysis
+type SearchLog struct {
+	Timestamp time.Time
+	Query     string
+	Mode      string
+	Filter    string
+	CatalogID string
+	LatencyMs float64
+	// ResultIDs and Scores hold the returned page in rank order
+	ResultIDs     []string
+	Scores        []float64
+	Fallback      string
+	ExperimentID  string
+	ExperimentArm string
+}
+
+// SearchLogTableDDL returns the BigQuery DDL creating the search log table,
+// partitioned by day
+func SearchLogTableDDL(table string) string {
+	columns := make([]string, len(searchLogColumns))
+	for i, column := range searchLogColumns {
+		switch {
+		case column.repeated:
+			columns[i] = fmt.Sprintf("%s ARRAY<%s>", column.name, column.sqlType)
+		case column.name == "timestamp":
+			columns[i] = fmt.Sprintf("%s %s NOT NULL", column.name, column.sqlType)
+		default:
+			columns[i] = fmt.Sprintf("%s %s", column.name, column.sqlType)
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` (%s) PARTITION BY DATE(timestamp)", table, strings.Join(columns, ", "))
+}
+
+// SearchLogSink streams search logs to BigQuery through the Storage Write
+// API's default stream. Logging never blocks a search: logs are buffered
+// and written in batches by Run, and dropped when the buffer is full.
+type SearchLogSink struct {
+	config     *config.Config
+	client     *managedwriter.Client
+	stream     *managedwriter.ManagedStream
+	descriptor protoreflect.MessageDescriptor
+	logs       chan SearchLog
+	// done is closed when Run has written the last batch
+	done chan struct{}
+}
+
+// NewSearchLogSink opens a write stream to SEARCH_LOG_TABLE
+func NewSearchLogSink(ctx context.Context, cfg *config.Config) (*SearchLogSink, error) {
+	project := cfg.ProjectID
+	parts := strings.Split(cfg.SearchLogTable, ".")
+	if len(parts) == 3 {
+		project, parts = parts[0], parts[1:]
+	}
+
+	descriptor, err := searchLogDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := adapt.NormalizeDescriptor(descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize search log descriptor: %v", err)
+	}
+
+	client, err := managedwriter.NewClient(ctx, cfg.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BigQuery write client: %v", err)
+	}
+	stream, err := client.NewManagedStream(ctx,
+		managedwriter.WithDestinationTable(managedwriter.TableParentFromParts(project, parts[0], parts[1])),
+		managedwriter.WithType(managedwriter.DefaultStream),
+		managedwriter.WithSchemaDescriptor(normalized),
+	)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to open BigQuery write stream to %s: %v", cfg.SearchLogTable, err)
+	}
+
+	return &SearchLogSink{
+		config:     cfg,
+		client:     client,
+		stream:     stream,
+		descriptor: descriptor,
+		logs:       make(chan SearchLog, cfg.SearchLogBufferSize),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// searchLogDescriptor builds the message descriptor of appended rows from
+// searchLogColumns
+func searchLogDescriptor() (protoreflect.MessageDescriptor, error) {
+	message := &descriptorpb.DescriptorProto{Name: proto.String("SearchLog")}
+	for i, column := range searchLogColumns {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if column.repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		message.Field = append(message.Field, &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(column.name),
+			Number: proto.Int32(int32(i + 1)),
+			Type:   column.protoType.Enum(),
+			Label:  label.Enum(),
+		})
+	}
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("search_log.proto"),
+		Syntax:      proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{message},
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build search log descriptor: %v", err)
+	}
+	return file.Messages().Get(0), nil
+}
+
+// Log queues a search log for writing. It does nothing on a nil sink, so
+// callers need not check whether search logs are enabled.
+func (s *SearchLogSink) Log(entry SearchLog) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.logs <- entry:
+	default:
+		metrics.SearchLogRows.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run writes the queued logs whenever a batch is full or the flush
+// interval passes, until ctx is done. The logs still queued then are
+// written before it returns.
+func (s *SearchLogSink) Run(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.SearchLogFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SearchLog, 0, s.config.SearchLogBatchSize)
+	for {
+		select {
+		case entry := <-s.logs:
+			batch = append(batch, entry)
+			if len(batch) < s.config.SearchLogBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-ctx.Done():
+			s.drain(batch)
+			return
+		}
+
+		s.write(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// drain writes batch and the logs still queued, within
+// searchLogShutdownTimeout
+func (s *SearchLogSink) drain(batch []SearchLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), searchLogShutdownTimeout)
+	defer cancel()
+	for {
+		select {
+		case entry := <-s.logs:
+			batch = append(batch, entry)
+			if len(batch) < s.config.SearchLogBatchSize {
+				continue
+			}
+		default:
+			if len(batch) > 0 {
+				s.write(ctx, batch)
+			}
+			return
+		}
+		s.write(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// write appends the logs to the table as one request, retrying transient
+// failures. Logs that still fail are counted and discarded.
+func (s *SearchLogSink) write(ctx context.Context, logs []SearchLog) {
+	rows := make([][]byte, 0, len(logs))
+	for _, entry := range logs {
+		row, err := s.encode(entry)
+		if err != nil {
+			log.Printf("Warning: could not encode search log: %v", err)
+			metrics.SearchLogRows.WithLabelValues("failed").Inc()
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	err := retry(ctx, searchLogRetryPolicy, "bigquery.append_rows", func() error {
+		result, err := s.stream.AppendRows(ctx, rows)
+		if err != nil {
+			return err
+		}
+		_, err = result.GetResult(ctx)
+		return err
+	})
+	if err != nil {
+		log.Printf("Warning: could not write %d search logs to BigQuery: %v", len(rows), err)
+		metrics.SearchLogRows.WithLabelValues("failed").Add(float64(len(rows)))
+		return
+	}
+	metrics.SearchLogRows.WithLabelValues("written").Add(float64(len(rows)))
+}
+
+// encode serializes a log as a row message
+func (s *SearchLogSink) encode(entry SearchLog) ([]byte, error) {
+	message := dynamicpb.NewMessage(s.descriptor)
+	fields := s.descriptor.Fields()
+	setString := func(name, value string) {
+		if value != "" {
+			message.Set(fields.ByName(protoreflect.Name(name)), protoreflect.ValueOfString(value))
+		}
+	}
+
+	message.Set(fields.ByName("timestamp"), protoreflect.ValueOfInt64(entry.Timestamp.UnixMicro()))
+	message.Set(fields.ByName("latency_ms"), protoreflect.ValueOfFloat64(entry.LatencyMs))
+	setString("query", entry.Query)
+	setString("mode", entry.Mode)
+	setString("filter", entry.Filter)
+	setString("catalog_id", entry.CatalogID)
+	setString("fallback", entry.Fallback)
+	setString("experiment_id", entry.ExperimentID)
+	setString("experiment_arm", entry.ExperimentArm)
+
+	resultIDs := message.Mutable(fields.ByName("result_ids")).List()
+	for _, id := range entry.ResultIDs {
+		resultIDs.Append(protoreflect.ValueOfString(id))
+	}
+	scores := message.Mutable(fields.ByName("scores")).List()
+	for _, score := range entry.Scores {
+		scores.Append(protoreflect.ValueOfFloat64(score))
+	}
+	return proto.Marshal(message)
+}
+
+// Close waits for Run to write the remaining logs after its context was
+// cancelled, then closes the stream. It does nothing on a nil sink.
+func (s *SearchLogSink) Close() {
+	if s == nil {
+		return
+	}
+	<-s.done
+	s.stream.Close()
+	s.client.Close()
+}
@@ -0,0 +1,441 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// annBranchSQL ranks products by approximate distance to a query embedding.
+// It is instantiated by annBranch once per embedding with the CTE name,
+// filter clause, product data column, distance expression, vector index,
+// ordering, candidate limit parameter and embedding column. Soft-deleted
+// products are never candidates of either branch.
+const annBranchSQL = `%[1]s AS (
+		SELECT offset + 1 AS rank, product_id, title, product_data, distance
+		FROM UNNEST(ARRAY(
+			SELECT AS STRUCT product_id, title, %[3]s,
+				%[4]s AS distance
+			FROM products @{FORCE_INDEX=%[5]s}
+			WHERE %[8]s IS NOT NULL AND deleted_at IS NULL%[2]s
+			ORDER BY %[6]s
+			LIMIT @%[7]s)) WITH OFFSET AS offset
+		)`
+
+// Distance metrics of the ANN branch. Each is served by its own vector
+// index: products_by_embedding for cosine, and for dot product the index
+// DotProductIndexDDL creates. The columns of other embedding versions have
+// their own indexes, named after the column in the same way.
+const (
+	DistanceCosine     = "cosine"
+	DistanceDotProduct = "dot_product"
+)
+
+// DotProductIndexDDL creates the vector index dot product searches need.
+// Deployments setting ANN_DISTANCE_METRIC=dot_product must apply it.
+const DotProductIndexDDL = "CREATE VECTOR INDEX products_by_embedding_dot_product ON products(embedding) STORING (price) WHERE embedding IS NOT NULL OPTIONS(distance_type=\"DOT_PRODUCT\", num_leaves=1000)"
+
+// ANNParams tune the ANN branch's vector index lookup, trading recall for
+// latency
+type ANNParams struct {
+	// NumLeavesToSearch is how many index leaves each lookup searches
+	NumLeavesToSearch int
+	// CandidateMultiplier scales how many candidates the ANN branch ranks
+	// beyond the requested page before fusion
+	CandidateMultiplier float64
+	// DistanceMetric is DistanceCosine or DistanceDotProduct
+	DistanceMetric string
+	// Column is the products embedding column searched, that of the
+	// embedding version the query was embedded for
+	Column string
+}
+
+// DefaultANNParams returns the deployment's ANN parameters, searching the
+// serving embedding version
+func DefaultANNParams(cfg *config.Config) ANNParams {
+	serving, _ := cfg.EmbeddingVersion(cfg.ServingEmbeddingVersion)
+	return ANNParams{
+		NumLeavesToSearch:   cfg.ANNNumLeavesToSearch,
+		CandidateMultiplier: cfg.ANNCandidateMultiplier,
+		DistanceMetric:      cfg.ANNDistanceMetric,
+		Column:              serving.Column,
+	}
+}
+
+// withDefaults fills in the parameters left unset from the deployment's
+func (p ANNParams) withDefaults(cfg *config.Config) ANNParams {
+	defaults := DefaultANNParams(cfg)
+	if p.NumLeavesToSearch <= 0 {
+		p.NumLeavesToSearch = defaults.NumLeavesToSearch
+	}
+	if p.CandidateMultiplier <= 0 {
+		p.CandidateMultiplier = defaults.CandidateMultiplier
+	}
+	if p.DistanceMetric == "" {
+		p.DistanceMetric = defaults.DistanceMetric
+	}
+	if p.Column == "" {
+		p.Column = defaults.Column
+	}
+	return p
+}
+
+// candidates returns how many candidates the ANN branch ranks for a page
+// ending at pageEnd
+func (p ANNParams) candidates(pageEnd int) int {
+	if p.CandidateMultiplier <= 1 {
+		return pageEnd
+	}
+	return int(math.Ceil(float64(pageEnd) * p.CandidateMultiplier))
+}
+
+// annBranch instantiates annBranchSQL for the embedding in param. The
+// distance column is the cosine distance, or one minus the dot product,
+// which is the same for the normalized embeddings Vertex AI returns.
+func annBranch(name, filterClause, param string, hydrate bool, ann ANNParams, limitParam string) string {
+	options := fmt.Sprintf(`OPTIONS=>JSON'{"num_leaves_to_search": %d}'`, max(ann.NumLeavesToSearch, 1))
+	column := cmp.Or(ann.Column, "embedding")
+	distance := fmt.Sprintf("APPROX_COSINE_DISTANCE(%s, @%s,\n\t\t\t\t%s)", column, param, options)
+	index, order := "products_by_"+column, distance
+	if ann.DistanceMetric == DistanceDotProduct {
+		product := fmt.Sprintf("APPROX_DOT_PRODUCT(%s, @%s,\n\t\t\t\t%s)", column, param, options)
+		distance = "1 - " + product
+		index, order = "products_by_"+column+"_dot_product", product+" DESC"
+	}
+	return fmt.Sprintf(annBranchSQL, name, filterClause, productDataColumn(hydrate), distance, index, order, limitParam, column)
+}
+
+// ftsBranchSQL ranks products by full-text match score on their token
+// columns. It is instantiated with the filter clause, product data column,
+// score expression and search predicate.
+const ftsBranchSQL = `fts AS (
+		SELECT offset + 1 AS rank, product_id, title, product_data, score
+		FROM UNNEST(ARRAY(
+			SELECT AS STRUCT product_id, title, %[2]s,
+				%[3]s AS score
+			FROM products
+			WHERE %[4]s AND deleted_at IS NULL%[1]s
+			ORDER BY %[3]s DESC
+			LIMIT @candidate_limit)) WITH OFFSET AS offset
+		)`
+
+// ftsColumns maps the FTS_FIELDS names to their TOKENLIST columns
+var ftsColumns = map[string]string{
+	"title":       "title_tokens",
+	"description": "description_tokens",
+	"brands":      "brand_tokens",
+	"attributes":  "attribute_tokens",
+}
+
+// ftsSQL returns the predicate matching products whose fields contain
+// @query_text, and the weighted sum of the fields' match scores. Columns
+// are qualified with table when it is set. With language, the query is
+// tokenized with the rules of the @query_language language tag, e.g. to
+// split German compound words. keyword sets the SEARCH dialect and query
+// enhancement.
+func ftsSQL(fields []config.FTSField, table string, language bool, keyword KeywordParams) (predicate, score string) {
+	args := keyword.searchArgs(language)
+	var searches, scores []string
+	for _, field := range fields {
+		column := ftsColumns[field.Name]
+		if table != "" {
+			column = table + "." + column
+		}
+		searches = append(searches, fmt.Sprintf("SEARCH(%s, %s)", column, args))
+		term := fmt.Sprintf("SCORE(%s, %s)", column, args)
+		if field.Weight != 1 {
+			term = strconv.FormatFloat(field.Weight, 'g', -1, 64) + " * " + term
+		}
+		scores = append(scores, term)
+	}
+	if len(fields) == 1 {
+		return searches[0], scores[0]
+	}
+	return "(" + strings.Join(searches, " OR ") + ")", "(" + strings.Join(scores, " + ") + ")"
+}
+
+// ftsBranch instantiates ftsBranchSQL for the fields
+func ftsBranch(filterClause string, fields []config.FTSField, language bool, keyword KeywordParams, hydrate bool) string {
+	predicate, score := ftsSQL(fields, "", language, keyword)
+	return fmt.Sprintf(ftsBranchSQL, filterClause, productDataColumn(hydrate), score, predicate)
+}
+
+// productDataColumn returns the product data select expression. Unhydrated
+// searches select NULL instead, so Spanner never reads the JSON documents.
+func productDataColumn(hydrate bool) string {
+	if hydrate {
+		return "product_data"
+	}
+	return "CAST(NULL AS JSON) AS product_data"
+}
+
+// annBranchName returns the CTE name of the i-th ANN branch
+func annBranchName(i int) string {
+	if i == 0 {
+		return "ann"
+	}
+	return fmt.Sprintf("ann_%d", i)
+}
+
+// queryEmbeddingParam returns the parameter holding the i-th query embedding
+func queryEmbeddingParam(i int) string {
+	if i == 0 {
+		return "query_embedding"
+	}
+	return fmt.Sprintf("query_embedding_%d", i)
+}
+
+// usesANN reports whether the mode runs the vector branch
+func usesANN(mode models.SearchMode) bool {
+	return mode != models.SearchModeKeyword
+}
+
+// usesFTS reports whether the mode runs the full-text branch
+func usesFTS(mode models.SearchMode) bool {
+	return mode != models.SearchModeVector
+}
+
+// searchOrderBy maps each sort order other than relevance to its ORDER BY
+// expression over the products row aliased sorted. Products missing the
+// sort field are listed last.
+var searchOrderBy = map[models.SearchSort]string{
+	models.SearchSortPriceAsc:  "sorted.price ASC NULLS LAST",
+	models.SearchSortPriceDesc: "sorted.price DESC NULLS LAST",
+	models.SearchSortNewest:    "SAFE_CAST(JSON_VALUE(sorted.product_data, '$.publishTime') AS TIMESTAMP) DESC NULLS LAST",
+	models.SearchSortRating:    "SAFE_CAST(JSON_VALUE(sorted.product_data, '$.rating.averageRating') AS FLOAT64) DESC NULLS LAST",
+}
+
+// buildSearchSQL builds the search statement for the given mode. Every mode
+// scores results with the same weighted reciprocal rank fusion formula so
+// min_score thresholds stay comparable; single-branch modes simply fuse one
+// branch. Products that only appear in a zero-weight branch are dropped so
+// alpha=0 and alpha=1 behave as pure text and pure vector search. Each row
+// also carries the best rank and raw score (cosine distance, SCORE()) the
+// product had in the ANN and FTS branches, NULL where it was not retrieved,
+// each side's share of the fused score and the quality and popularity
+// factors applied.
+//
+// filterSQL is an optional predicate applied inside each branch, before the
+// branch LIMIT, so filtering never truncates relevant results.
+//
+// annBranches is the number of query embeddings (the query plus any
+// expansions). Each gets its own ANN branch weighted @ann_weight, which the
+// caller divides between them so the vector side's total weight is unchanged.
+//
+// demoteLowQuality multiplies the fused score of products whose stored
+// quality score is below @quality_threshold by @quality_demotion. Unscored
+// products are left alone.
+//
+// popularityColumn names the product_stats count that boosts the fused
+// score by 1 + @popularity_weight * LOG10(1 + count), so bestsellers
+// outrank never-purchased products of equal relevance. Empty disables the
+// boost.
+//
+// ftsFields are the token columns the FTS branch searches and their weights.
+// ftsLanguage tokenizes the query for the @query_language language tag.
+//
+// ann tunes the ANN branches, which rank @ann_candidate_limit candidates.
+//
+// sort orders the page by a product field instead of the fused score,
+// most relevant first among equal values. The fused candidates are the
+// same as for a relevance search, so filters and pagination still apply.
+//
+// Without hydrate, product_data is NULL in every row.
+func buildSearchSQL(mode models.SearchMode, filterSQL string, ftsFields []config.FTSField, ftsLanguage bool, keyword KeywordParams, annBranches int, ann ANNParams, demoteLowQuality bool, popularityColumn string, sort models.SearchSort, hydrate bool) string {
+	var ctes []string
+	var branches []string
+
+	filterClause := ""
+	if filterSQL != "" {
+		filterClause = "\n\t\t\tAND " + filterSQL
+	}
+
+	if usesANN(mode) {
+		for i := 0; i < max(annBranches, 1); i++ {
+			ctes = append(ctes, annBranch(annBranchName(i), filterClause, queryEmbeddingParam(i), hydrate, ann, "ann_candidate_limit"))
+			branches = append(branches, fmt.Sprintf(`(
+		SELECT rank, @ann_weight AS weight, product_id, title, product_data,
+			rank AS ann_rank, distance AS ann_distance,
+			CAST(NULL AS INT64) AS fts_rank, CAST(NULL AS FLOAT64) AS fts_score
+		FROM %s
+		)`, annBranchName(i)))
+		}
+	}
+	if usesFTS(mode) {
+		ctes = append(ctes, ftsBranch(filterClause, ftsFields, ftsLanguage, keyword, hydrate))
+		branches = append(branches, `(
+		SELECT rank, @fts_weight AS weight, product_id, title, product_data,
+			CAST(NULL AS INT64) AS ann_rank, CAST(NULL AS FLOAT64) AS ann_distance,
+			rank AS fts_rank, score AS fts_score
+		FROM fts
+		)`)
+	}
+
+	var ranked string
+	if demoteLowQuality || popularityColumn != "" {
+		qualityFactor, popularityFactor, joins := scoreFactorSQL("fused", demoteLowQuality, popularityColumn)
+		ctes = append(ctes, fmt.Sprintf(`fused AS (
+			SELECT 
+				SUM(weight / (@rrf_k + rank)) AS rrf_score, 
+				product_id,
+				ANY_VALUE(title) AS title,
+				ANY_VALUE(product_data) AS product_data,
+				MIN(ann_rank) AS ann_rank,
+				MIN(ann_distance) AS ann_distance,
+				MIN(fts_rank) AS fts_rank,
+				MAX(fts_score) AS fts_score,
+				SUM(IF(ann_rank IS NULL, 0, weight / (@rrf_k + rank))) AS ann_contribution,
+				SUM(IF(fts_rank IS NULL, 0, weight / (@rrf_k + rank))) AS fts_contribution
+			FROM (%s)
+			GROUP BY product_id
+			HAVING rrf_score > 0
+		)`, strings.Join(branches, "\n\t\tUNION ALL ")))
+		ranked = fmt.Sprintf(`SELECT 
+			fused.rrf_score * %[1]s * %[2]s AS rrf_score,
+			fused.product_id,
+			fused.title,
+			fused.product_data,
+			fused.ann_rank,
+			fused.ann_distance,
+			fused.fts_rank,
+			fused.fts_score,
+			fused.ann_contribution,
+			fused.fts_contribution,
+			%[1]s AS quality_factor,
+			%[2]s AS popularity_factor
+		FROM fused
+		%[3]s`, qualityFactor, popularityFactor, strings.Join(joins, "\n\t\t"))
+	} else {
+		ranked = fmt.Sprintf(`SELECT 
+			SUM(weight / (@rrf_k + rank)) AS rrf_score, 
+			product_id,
+			ANY_VALUE(title) AS title,
+			ANY_VALUE(product_data) AS product_data,
+			MIN(ann_rank) AS ann_rank,
+			MIN(ann_distance) AS ann_distance,
+			MIN(fts_rank) AS fts_rank,
+			MAX(fts_score) AS fts_score,
+			SUM(IF(ann_rank IS NULL, 0, weight / (@rrf_k + rank))) AS ann_contribution,
+			SUM(IF(fts_rank IS NULL, 0, weight / (@rrf_k + rank))) AS fts_contribution,
+			CAST(1 AS FLOAT64) AS quality_factor,
+			CAST(1 AS FLOAT64) AS popularity_factor
+		FROM (%s)
+		GROUP BY product_id
+		HAVING rrf_score > 0`, strings.Join(branches, "\n\t\tUNION ALL "))
+	}
+
+	// Sorted searches order the fused candidates by the product's sort
+	// field, read from products since unhydrated rows carry no product data
+	orderBy, sorted := searchOrderBy[sort]
+	if !sorted {
+		return fmt.Sprintf(`
+		WITH %s
+		%s
+		ORDER BY rrf_score DESC
+		LIMIT @limit OFFSET @offset;
+	`, strings.Join(ctes, ",\n\t\t"), ranked)
+	}
+	ctes = append(ctes, "ranked AS (\n\t\t"+ranked+"\n\t\t)")
+	return fmt.Sprintf(`
+		WITH %s
+		SELECT ranked.*
+		FROM ranked
+		JOIN products AS sorted ON sorted.product_id = ranked.product_id
+		ORDER BY %s, ranked.rrf_score DESC, ranked.product_id
+		LIMIT @limit OFFSET @offset;
+	`, strings.Join(ctes, ",\n\t\t"), orderBy)
+}
+
+// scoreFactorSQL returns the quality and popularity factor expressions for
+// the products of table, and the joins they read from. Disabled factors are
+// a constant 1.
+func scoreFactorSQL(table string, demoteLowQuality bool, popularityColumn string) (qualityFactor, popularityFactor string, joins []string) {
+	qualityFactor = "CAST(1 AS FLOAT64)"
+	popularityFactor = "CAST(1 AS FLOAT64)"
+	if demoteLowQuality {
+		qualityFactor = "IF(quality.score < @quality_threshold, @quality_demotion, 1)"
+		joins = append(joins, fmt.Sprintf("LEFT JOIN product_quality AS quality ON quality.product_id = %s.product_id", table))
+	}
+	if popularityColumn != "" {
+		popularityFactor = fmt.Sprintf("1 + @popularity_weight * LOG10(1 + IFNULL(stats.%s, 0))", popularityColumn)
+		joins = append(joins, fmt.Sprintf("LEFT JOIN product_stats AS stats ON stats.product_id = %s.product_id", table))
+	}
+	return qualityFactor, popularityFactor, joins
+}
+
+// buildBranchSQL builds a statement running one retrieval branch on its own,
+// for searches fused by the service rather than in SQL. The i-th ANN branch
+// is selected with ann; otherwise the FTS branch runs. Rows carry the
+// product's branch rank, product data, raw branch score (cosine distance or
+// SCORE()) and its quality and popularity factors, in rank order. Branches
+// rank @candidate_limit candidates; the FTS branch searches ftsFields, in
+// the @query_language language with ftsLanguage and matching as keyword
+// sets, and ANN branches are tuned by annParams.
+func buildBranchSQL(ann bool, i int, filterSQL string, ftsFields []config.FTSField, ftsLanguage bool, keyword KeywordParams, annParams ANNParams, demoteLowQuality bool, popularityColumn string, hydrate bool) string {
+	filterClause := ""
+	if filterSQL != "" {
+		filterClause = "\n\t\t\tAND " + filterSQL
+	}
+
+	cte, name, rawColumn := ftsBranch(filterClause, ftsFields, ftsLanguage, keyword, hydrate), "fts", "score"
+	if ann {
+		name, rawColumn = annBranchName(i), "distance"
+		cte = annBranch(name, filterClause, queryEmbeddingParam(i), hydrate, annParams, "candidate_limit")
+	}
+
+	qualityFactor, popularityFactor, joins := scoreFactorSQL("branch", demoteLowQuality, popularityColumn)
+	return fmt.Sprintf(`
+		WITH %[1]s
+		SELECT
+			branch.rank,
+			branch.product_id,
+			branch.product_data,
+			branch.%[3]s,
+			%[4]s AS quality_factor,
+			%[5]s AS popularity_factor
+		FROM %[2]s AS branch
+		%[6]s
+		ORDER BY branch.rank;
+	`, cte, name, rawColumn, qualityFactor, popularityFactor, strings.Join(joins, "\n\t\t"))
+}
+
+// rrfWeights splits the hybrid alpha into the weights applied to the ANN and
+// FTS branches during reciprocal rank fusion. Alpha is clamped to [0, 1], and
+// single-branch modes give their branch the full weight.
+func rrfWeights(mode models.SearchMode, alpha float64) (annWeight float64, ftsWeight float64) {
+	switch mode {
+	case models.SearchModeVector:
+		return 1, 0
+	case models.SearchModeKeyword:
+		return 0, 1
+	}
+
+	if alpha < 0 {
+		alpha = 0
+	}
+	if alpha > 1 {
+		alpha = 1
+	}
+	return alpha, 1 - alpha
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+func TestRRFWeights(t *testing.T) {
+	tests := []struct {
+		mode    models.SearchMode
+		alpha   float64
+		wantANN float64
+		wantFTS float64
+	}{
+		{mode: models.SearchModeHybrid, alpha: 0, wantANN: 0, wantFTS: 1},
+		{mode: models.SearchModeHybrid, alpha: 0.5, wantANN: 0.5, wantFTS: 0.5},
+		{mode: models.SearchModeHybrid, alpha: 1, wantANN: 1, wantFTS: 0},
+		{mode: models.SearchModeHybrid, alpha: -0.5, wantANN: 0, wantFTS: 1},
+		{mode: models.SearchModeHybrid, alpha: 1.5, wantANN: 1, wantFTS: 0},
+		{mode: models.SearchModeVector, alpha: 0, wantANN: 1, wantFTS: 0},
+		{mode: models.SearchModeVector, alpha: 0.5, wantANN: 1, wantFTS: 0},
+		{mode: models.SearchModeVector, alpha: 1, wantANN: 1, wantFTS: 0},
+		{mode: models.SearchModeKeyword, alpha: 0, wantANN: 0, wantFTS: 1},
+		{mode: models.SearchModeKeyword, alpha: 0.5, wantANN: 0, wantFTS: 1},
+		{mode: models.SearchModeKeyword, alpha: 1, wantANN: 0, wantFTS: 1},
+	}
+	for _, tt := range tests {
+		ann, fts := rrfWeights(tt.mode, tt.alpha)
+		if ann != tt.wantANN || fts != tt.wantFTS {
+			t.Errorf("rrfWeights(%s, %v) = (%v, %v), want (%v, %v)", tt.mode, tt.alpha, ann, fts, tt.wantANN, tt.wantFTS)
+		}
+	}
+}
+
+// sqlParamPattern matches a statement's parameter references
+var sqlParamPattern = regexp.MustCompile(`@([a-z_0-9]+)`)
+
+// sqlParams returns the distinct parameters a statement references, sorted
+func sqlParams(sql string) []string {
+	var params []string
+	for _, match := range sqlParamPattern.FindAllStringSubmatch(sql, -1) {
+		if !slices.Contains(params, match[1]) {
+			params = append(params, match[1])
+		}
+	}
+	slices.Sort(params)
+	return params
+}
+
+func TestBuildSearchSQLBranches(t *testing.T) {
+	fields := []config.FTSField{{Name: "title", Weight: 1}}
+	ann := ANNParams{NumLeavesToSearch: 10, DistanceMetric: DistanceCosine, Column: "embedding"}
+
+	tests := []struct {
+		name        string
+		mode        models.SearchMode
+		annBranches int
+		ctes        []string
+		absent      []string
+		params      []string
+	}{
+		{
+			name:        "ANN only",
+			mode:        models.SearchModeVector,
+			annBranches: 1,
+			ctes:        []string{"ann AS ("},
+			absent:      []string{"fts AS (", "SEARCH(", "@fts_weight"},
+			params:      []string{"ann_candidate_limit", "ann_weight", "limit", "offset", "query_embedding", "rrf_k"},
+		},
+		{
+			name:        "FTS only",
+			mode:        models.SearchModeKeyword,
+			annBranches: 1,
+			ctes:        []string{"fts AS ("},
+			absent:      []string{"ann AS (", "APPROX_COSINE_DISTANCE", "@ann_weight"},
+			params:      []string{"candidate_limit", "fts_weight", "limit", "offset", "query_text", "rrf_k"},
+		},
+		{
+			name:        "both",
+			mode:        models.SearchModeHybrid,
+			annBranches: 1,
+			ctes:        []string{"ann AS (", "fts AS ("},
+			params:      []string{"ann_candidate_limit", "ann_weight", "candidate_limit", "fts_weight", "limit", "offset", "query_embedding", "query_text", "rrf_k"},
+		},
+		{
+			name:        "both with expansions",
+			mode:        models.SearchModeHybrid,
+			annBranches: 3,
+			ctes:        []string{"ann AS (", "ann_1 AS (", "ann_2 AS (", "fts AS ("},
+			params:      []string{"ann_candidate_limit", "ann_weight", "candidate_limit", "fts_weight", "limit", "offset", "query_embedding", "query_embedding_1", "query_embedding_2", "query_text", "rrf_k"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := buildSearchSQL(tt.mode, "", fields, false, KeywordParams{}, tt.annBranches, ann, false, "", models.SearchSortRelevance, true)
+			for _, cte := range tt.ctes {
+				if !strings.Contains(sql, cte) {
+					t.Errorf("statement has no %q branch:\n%s", cte, sql)
+				}
+			}
+			for _, text := range tt.absent {
+				if strings.Contains(sql, text) {
+					t.Errorf("statement contains %q:\n%s", text, sql)
+				}
+			}
+			if got := sqlParams(sql); !slices.Equal(got, tt.params) {
+				t.Errorf("params = %v, want %v", got, tt.params)
+			}
+			if branches := strings.Count(sql, "FROM products"); branches != len(tt.ctes) {
+				t.Errorf("statement reads products in %d branches, want %d", branches, len(tt.ctes))
+			}
+		})
+	}
+}
+
+func TestBuildSearchSQLOptions(t *testing.T) {
+	fields := []config.FTSField{{Name: "title", Weight: 1}, {Name: "description", Weight: 0.5}}
+	ann := ANNParams{NumLeavesToSearch: 10, DistanceMetric: DistanceDotProduct, Column: "embedding"}
+	sql := buildSearchSQL(models.SearchModeHybrid, "catalog_id = @catalog_id", fields, true, KeywordParams{}, 1, ann, true, "purchases", models.SearchSortPriceAsc, false)
+
+	for _, want := range []string{
+		// The filter applies inside both branches, before their LIMIT
+		"WHERE embedding IS NOT NULL AND deleted_at IS NULL\n\t\t\tAND catalog_id = @catalog_id",
+		"AND deleted_at IS NULL\n\t\t\tAND catalog_id = @catalog_id",
+		"APPROX_DOT_PRODUCT(embedding, @query_embedding",
+		"products_by_embedding_dot_product",
+		"0.5 * SCORE(description_tokens, @query_text, language_tag=>@query_language)",
+		"CAST(NULL AS JSON) AS product_data",
+		"LEFT JOIN product_quality AS quality",
+		"IFNULL(stats.purchases, 0)",
+		"ORDER BY sorted.price ASC NULLS LAST, ranked.rrf_score DESC",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("statement does not contain %q:\n%s", want, sql)
+		}
+	}
+	if count := strings.Count(sql, "AND catalog_id = @catalog_id"); count != 2 {
+		t.Errorf("filter applied in %d branches, want 2", count)
+	}
+
+	params := sqlParams(sql)
+	for _, want := range []string{"catalog_id", "query_language", "quality_threshold", "quality_demotion", "popularity_weight"} {
+		if !slices.Contains(params, want) {
+			t.Errorf("params %v do not include %s", params, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servicestest
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"slices"
+	"sync"
+
+	"psearch/serving/internal/services"
+)
+
+// Embedder is an in-memory services.Embedder. Texts listed in Embeddings
+// get that embedding; any other text is embedded by hashing its terms, so
+// texts sharing terms are close.
+type Embedder struct {
+	// Dimension is the length of hashed embeddings; zero means 768
+	Dimension int
+	// Embeddings overrides the embedding of specific texts
+	Embeddings map[string][]float32
+	// Err, when set, is returned instead of an embedding
+	Err error
+
+	mu    sync.Mutex
+	texts []string
+}
+
+var _ services.Embedder = (*Embedder)(nil)
+
+// GenerateDocumentEmbedding embeds product text the same way as queries
+func (e *Embedder) GenerateDocumentEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return e.GenerateEmbedding(ctx, text)
+}
+
+// GenerateEmbedding returns the embedding of text and records the call
+func (e *Embedder) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	e.mu.Lock()
+	e.texts = append(e.texts, text)
+	e.mu.Unlock()
+
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	if embedding, ok := e.Embeddings[text]; ok {
+		return embedding, nil
+	}
+
+	dimension := e.Dimension
+	if dimension == 0 {
+		dimension = 768
+	}
+	embedding := make([]float32, dimension)
+	for _, term := range tokenize(text) {
+		h := fnv.New32a()
+		h.Write([]byte(term))
+		embedding[h.Sum32()%uint32(dimension)]++
+	}
+	var norm float64
+	for _, v := range embedding {
+		norm += float64(v * v)
+	}
+	if norm == 0 {
+		embedding[0] = 1
+		return embedding, nil
+	}
+	for i := range embedding {
+		embedding[i] /= float32(math.Sqrt(norm))
+	}
+	return embedding, nil
+}
+
+// Texts returns the texts embedded so far, in call order
+func (e *Embedder) Texts() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.texts)
+}
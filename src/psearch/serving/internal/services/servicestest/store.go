@@ -0,0 +1,530 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package servicestest provides in-memory implementations of the service
+// interfaces the API depends on, so handlers can be tested without Spanner
+// or Vertex AI.
+package servicestest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+)
+
+// Store is an in-memory services.Searcher and services.ProductStore. Search
+// scores products by the fraction of query terms found in their text
+// fields, so results are deterministic but not a model of Spanner's
+// ranking. Browse sorts other than price keep insertion order.
+type Store struct {
+	// Err, when set, is returned by every method, to exercise error paths.
+	// Set it before the store is used.
+	Err error
+
+	mu       sync.RWMutex
+	products map[string]storedProduct
+	order    []string
+	searches []services.SearchOptions
+}
+
+// storedProduct is a product and the catalog it belongs to
+type storedProduct struct {
+	catalogID string
+	data      map[string]interface{}
+	// deleted hides a soft-deleted product from reads until it is restored
+	deleted bool
+}
+
+var (
+	_ services.Searcher      = (*Store)(nil)
+	_ services.ProductStore  = (*Store)(nil)
+	_ services.ProductWriter = (*Store)(nil)
+	_ services.ImageSearcher = (*Store)(nil)
+)
+
+// NewStore creates a store holding products in the default catalog
+func NewStore(products ...models.SearchResult) *Store {
+	s := &Store{products: make(map[string]storedProduct)}
+	s.Add("", products...)
+	return s
+}
+
+// Add stores products in a catalog, replacing any with the same ID
+func (s *Store) Add(catalogID string, products ...models.SearchResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, product := range products {
+		product.Score = nil
+		data, err := productData(product)
+		if err != nil {
+			panic(fmt.Sprintf("servicestest: product %s: %v", product.ID, err))
+		}
+		if _, ok := s.products[product.ID]; !ok {
+			s.order = append(s.order, product.ID)
+		}
+		s.products[product.ID] = storedProduct{catalogID: catalogID, data: data}
+	}
+}
+
+// Searches returns the options of every HybridSearch call so far, in order
+func (s *Store) Searches() []services.SearchOptions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.searches)
+}
+
+// HybridSearch returns the products matching any query term, best first
+func (s *Store) HybridSearch(ctx context.Context, opts services.SearchOptions) (*services.SearchOutput, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	s.mu.Lock()
+	s.searches = append(s.searches, opts)
+	s.mu.Unlock()
+
+	terms := tokenize(opts.Query)
+	var results []models.SearchResult
+	for _, p := range s.matching(opts.CatalogID, opts.Filter) {
+		score := termScore(terms, p.data)
+		if score == 0 || score < opts.MinScore {
+			continue
+		}
+		result := models.SearchResult{ID: productID(p.data)}
+		if !opts.IDsOnly {
+			var err error
+			if result, err = s.TransformProduct(result.ID, p.data); err != nil {
+				return nil, err
+			}
+		}
+		result.Score = map[string]float64{"hybrid": score}
+		results = append(results, result)
+	}
+	slices.SortStableFunc(results, func(a, b models.SearchResult) int {
+		if a.Score["hybrid"] != b.Score["hybrid"] {
+			if a.Score["hybrid"] > b.Score["hybrid"] {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return &services.SearchOutput{
+		Results:       page(results, opts.Offset, opts.Limit),
+		ReadTimestamp: time.Now(),
+	}, nil
+}
+
+// IdentifierSearch returns the products whose ID or GTIN is the query, up
+// to the end of the requested page like SpannerService.IdentifierSearch
+func (s *Store) IdentifierSearch(ctx context.Context, opts services.SearchOptions) (*services.SearchOutput, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	query := strings.TrimSpace(opts.Query)
+	output := &services.SearchOutput{ReadTimestamp: time.Now()}
+	for _, p := range s.matching(opts.CatalogID, opts.Filter) {
+		id := productID(p.data)
+		gtin, _ := p.data["gtin"].(string)
+		if !strings.EqualFold(id, query) && !strings.EqualFold(gtin, query) {
+			continue
+		}
+		result, err := s.TransformProduct(id, p.data)
+		if err != nil {
+			return nil, err
+		}
+		result.Score = map[string]float64{"exact": 1}
+		output.Results = append(output.Results, result)
+		if len(output.Results) == opts.Offset+opts.Limit {
+			break
+		}
+	}
+	return output, nil
+}
+
+// BrowseByCategory lists the products in a category or its subcategories
+func (s *Store) BrowseByCategory(ctx context.Context, opts services.BrowseOptions) (*services.BrowseOutput, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	var results []models.SearchResult
+	for _, p := range s.matching(opts.CatalogID, opts.Filter) {
+		result, err := s.TransformProduct(productID(p.data), p.data)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(result.Categories, func(category string) bool {
+			return category == opts.Category || strings.HasPrefix(category, opts.Category+" > ")
+		}) {
+			results = append(results, result)
+		}
+	}
+
+	switch opts.Sort {
+	case models.BrowseSortPriceAsc, models.BrowseSortPriceDesc:
+		slices.SortStableFunc(results, func(a, b models.SearchResult) int {
+			pa, _ := strconv.ParseFloat(a.PriceInfo.Price, 64)
+			pb, _ := strconv.ParseFloat(b.PriceInfo.Price, 64)
+			if opts.Sort == models.BrowseSortPriceDesc {
+				pa, pb = pb, pa
+			}
+			switch {
+			case pa < pb:
+				return -1
+			case pa > pb:
+				return 1
+			}
+			return 0
+		})
+	}
+
+	return &services.BrowseOutput{
+		Results: page(results, opts.Offset, opts.Limit),
+		HasMore: len(results) > opts.Offset+opts.Limit,
+	}, nil
+}
+
+// SimilarProducts ranks products by the share of categories and brands they
+// have in common with the seed product
+func (s *Store) SimilarProducts(ctx context.Context, opts services.SimilarOptions) ([]models.SearchResult, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	s.mu.RLock()
+	seedData, ok := s.products[opts.ProductID]
+	s.mu.RUnlock()
+	if !ok || seedData.deleted || (opts.CatalogID != "" && seedData.catalogID != opts.CatalogID) {
+		return nil, services.ErrProductNotFound
+	}
+	seed, err := s.TransformProduct(opts.ProductID, seedData.data)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.SearchResult
+	for _, p := range s.matching(opts.CatalogID, opts.Filter) {
+		id := productID(p.data)
+		if id == opts.ProductID {
+			continue
+		}
+		result, err := s.TransformProduct(id, p.data)
+		if err != nil {
+			return nil, err
+		}
+		sharedCategories := overlap(seed.Categories, result.Categories)
+		if opts.SameCategory && sharedCategories == 0 {
+			continue
+		}
+		total := len(seed.Categories) + len(seed.Brands)
+		if total == 0 {
+			continue
+		}
+		similarity := float64(sharedCategories+overlap(seed.Brands, result.Brands)) / float64(total)
+		if similarity == 0 {
+			continue
+		}
+		result.Score = map[string]float64{"similarity": similarity}
+		results = append(results, result)
+	}
+	slices.SortStableFunc(results, func(a, b models.SearchResult) int {
+		switch {
+		case a.Score["similarity"] > b.Score["similarity"]:
+			return -1
+		case a.Score["similarity"] < b.Score["similarity"]:
+			return 1
+		}
+		return 0
+	})
+	return page(results, 0, opts.Limit), nil
+}
+
+// GetProductsBatch returns the product data of the IDs found in the catalog
+func (s *Store) GetProductsBatch(ctx context.Context, catalogID string, productIDs []string, staleness time.Duration) (map[string]map[string]interface{}, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	found := make(map[string]map[string]interface{}, len(productIDs))
+	for _, id := range productIDs {
+		if p, ok := s.products[id]; ok && !p.deleted && (catalogID == "" || p.catalogID == catalogID) {
+			found[id] = p.data
+		}
+	}
+	return found, nil
+}
+
+// TransformProduct converts product data back into a search result
+func (s *Store) TransformProduct(productID string, productData map[string]interface{}) (models.SearchResult, error) {
+	var result models.SearchResult
+	data, err := json.Marshal(productData)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("invalid product data for %s: %v", productID, err)
+	}
+	result.ID = productID
+	result.Score = nil
+	return result, nil
+}
+
+// ImageSearch returns the products matching the filter in insertion order,
+// up to the limit. The store holds no image embeddings, so the query
+// embedding is ignored.
+func (s *Store) ImageSearch(ctx context.Context, opts services.ImageSearchOptions) ([]models.SearchResult, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	var results []models.SearchResult
+	for _, p := range s.matching(opts.CatalogID, opts.Filter) {
+		result, err := s.TransformProduct(productID(p.data), p.data)
+		if err != nil {
+			return nil, err
+		}
+		result.Score = map[string]float64{"image": 1}
+		results = append(results, result)
+	}
+	return page(results, 0, opts.Limit), nil
+}
+
+// UpdateProduct merges a JSON merge patch into a product's data. Like
+// SpannerService.UpdateProduct it updates soft-deleted products too, and
+// reports the product as re-embedded when its name, title or description
+// changed.
+func (s *Store) UpdateProduct(ctx context.Context, catalogID, productID string, patch map[string]interface{}) (*services.ProductUpdate, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if id, ok := patch["id"]; ok && id != productID {
+		return nil, fmt.Errorf("%w: id cannot be changed", services.ErrInvalidProductPatch)
+	}
+
+	s.mu.Lock()
+	p, ok := s.products[productID]
+	if !ok || (catalogID != "" && p.catalogID != catalogID) {
+		s.mu.Unlock()
+		return nil, services.ErrProductNotFound
+	}
+	merged, err := clone(p.data)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	merged = mergePatch(merged, patch).(map[string]interface{})
+	reembedded := embeddedText(merged) != embeddedText(p.data)
+	p.data = merged
+	s.products[productID] = p
+	s.mu.Unlock()
+
+	product, err := s.TransformProduct(productID, merged)
+	if err != nil {
+		return nil, err
+	}
+	return &services.ProductUpdate{Product: product, Reembedded: reembedded}, nil
+}
+
+// DeleteProduct removes a product, or with soft hides it until
+// RestoreProduct
+func (s *Store) DeleteProduct(ctx context.Context, catalogID, productID string, soft bool) error {
+	return s.write(catalogID, productID, func(p *storedProduct) {
+		if soft {
+			p.deleted = true
+			return
+		}
+		delete(s.products, productID)
+		s.order = slices.DeleteFunc(s.order, func(id string) bool { return id == productID })
+	})
+}
+
+// RestoreProduct serves a soft-deleted product again
+func (s *Store) RestoreProduct(ctx context.Context, catalogID, productID string) error {
+	return s.write(catalogID, productID, func(p *storedProduct) {
+		p.deleted = false
+	})
+}
+
+// write applies apply to a product once it is confirmed to be in the
+// catalog, as SpannerService does
+func (s *Store) write(catalogID, productID string, apply func(p *storedProduct)) error {
+	if s.Err != nil {
+		return s.Err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[productID]
+	if !ok || (catalogID != "" && p.catalogID != catalogID) {
+		return services.ErrProductNotFound
+	}
+	apply(&p)
+	if _, ok := s.products[productID]; ok {
+		s.products[productID] = p
+	}
+	return nil
+}
+
+// matching returns the stored products in catalogID, or every catalog when
+// it is empty, that satisfy the filter, in insertion order
+func (s *Store) matching(catalogID string, node filter.Node) []storedProduct {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var matched []storedProduct
+	for _, id := range s.order {
+		p := s.products[id]
+		if p.deleted || (catalogID != "" && p.catalogID != catalogID) {
+			continue
+		}
+		if filter.Matches(node, p.data) {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+// productData converts a product to the product_data JSON Spanner stores
+func productData(product models.SearchResult) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// clone deep-copies product data
+func clone(data map[string]interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var copied map[string]interface{}
+	if err := json.Unmarshal(encoded, &copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// mergePatch applies a JSON merge patch (RFC 7396) to target, modifying
+// objects in place
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// embeddedText is the product text an embedding would be generated from
+func embeddedText(data map[string]interface{}) string {
+	var text []string
+	for _, key := range []string{"name", "title", "description"} {
+		value, _ := data[key].(string)
+		text = append(text, value)
+	}
+	return strings.Join(text, "\n")
+}
+
+// productID returns the ID recorded in product data
+func productID(data map[string]interface{}) string {
+	id, _ := data["id"].(string)
+	return id
+}
+
+// termScore returns the fraction of terms found in the product's name,
+// title, description, brands or categories
+func termScore(terms []string, data map[string]interface{}) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	var text []string
+	for _, key := range []string{"name", "title", "description"} {
+		if value, ok := data[key].(string); ok {
+			text = append(text, value)
+		}
+	}
+	for _, key := range []string{"brands", "categories"} {
+		values, _ := data[key].([]interface{})
+		for _, value := range values {
+			if value, ok := value.(string); ok {
+				text = append(text, value)
+			}
+		}
+	}
+	tokens := tokenize(strings.Join(text, " "))
+
+	found := 0
+	for _, term := range terms {
+		if slices.Contains(tokens, term) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(terms))
+}
+
+// tokenize lowercases text and splits it into letter and digit runs
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// overlap counts the values of a that also appear in b
+func overlap(a, b []string) int {
+	n := 0
+	for _, value := range a {
+		if slices.Contains(b, value) {
+			n++
+		}
+	}
+	return n
+}
+
+// page returns results[offset:offset+limit], clamped to the slice; a
+// non-positive limit means no limit
+func page(results []models.SearchResult, offset, limit int) []models.SearchResult {
+	if offset >= len(results) {
+		return nil
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
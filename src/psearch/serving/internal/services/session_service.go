@@ -0,0 +1,278 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// SessionContext is what a shopper has searched for and clicked in the
+// current session
+type SessionContext struct {
+	// Queries are the session's most recent searches, oldest first
+	Queries []SessionQuery `json:"queries,omitempty"`
+	// ClickEmbedding is the unit-length mean of the embeddings of the
+	// products clicked in the session
+	ClickEmbedding []float32 `json:"click_embedding,omitempty"`
+	Clicks         int       `json:"clicks,omitempty"`
+}
+
+// SessionQuery is a search made in a session, after follow-up resolution
+type SessionQuery struct {
+	Query    string   `json:"query"`
+	Filter   string   `json:"filter,omitempty"`
+	MinPrice *float64 `json:"min_price,omitempty"`
+	MaxPrice *float64 `json:"max_price,omitempty"`
+	// MedianPrice is the median price of the results, which "cheaper" and
+	// "pricier" follow-ups are bounded by; zero when unknown
+	MedianPrice float64 `json:"median_price,omitempty"`
+}
+
+// SessionService keeps short-lived search context per session, in the
+// cache so it expires on its own. Sessions are scoped to their owner, the
+// authenticated caller, so one caller cannot read or steer another's
+// session by its ID.
+type SessionService struct {
+	config  *config.Config
+	spanner *SpannerService
+	// sessions caches session context by session ID
+	sessions *cache.Cache[*SessionContext]
+	// mu serializes the read-modify-write updates of this instance
+	mu sync.Mutex
+}
+
+// NewSessionService creates a session service, or returns nil when session
+// context is disabled
+func NewSessionService(cfg *config.Config, spannerSvc *SpannerService) *SessionService {
+	if !cfg.SessionContextEnabled {
+		return nil
+	}
+	return &SessionService{
+		config:   cfg,
+		spanner:  spannerSvc,
+		sessions: cache.New[*SessionContext]("session", cfg.SessionCacheSize, cfg.SessionTTL),
+	}
+}
+
+// UseRemoteCache shares session context across replicas
+func (s *SessionService) UseRemoteCache(remote *cache.Remote) {
+	s.sessions.SetRemote(remote)
+}
+
+// CacheLayers returns the caches owned by the session service
+func (s *SessionService) CacheLayers() []cache.Layer {
+	return []cache.Layer{s.sessions}
+}
+
+// sessionKey keys the owner's session in the cache. Owners are empty when
+// authentication is disabled.
+func sessionKey(owner, sessionID string) string {
+	return owner + "/" + sessionID
+}
+
+// Get returns the context of the owner's session, or nil when the session
+// is unknown or has expired. The context must not be modified.
+func (s *SessionService) Get(owner, sessionID string) *SessionContext {
+	if s == nil || sessionID == "" {
+		return nil
+	}
+	session, _ := s.sessions.Get(sessionKey(owner, sessionID))
+	return session
+}
+
+// update applies fn to a copy of the owner's session context and stores
+// it, restarting its TTL
+func (s *SessionService) update(owner, sessionID string, fn func(session *SessionContext)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sessionKey(owner, sessionID)
+	var session SessionContext
+	if current, ok := s.sessions.Get(key); ok && current != nil {
+		session = *current
+		session.Queries = slices.Clone(current.Queries)
+	}
+	fn(&session)
+	s.sessions.Set(key, &session)
+}
+
+// RecordSearch appends a search to the owner's session, keeping the last
+// SESSION_MAX_QUERIES
+func (s *SessionService) RecordSearch(owner, sessionID string, query SessionQuery) {
+	if s == nil || sessionID == "" {
+		return
+	}
+	s.update(owner, sessionID, func(session *SessionContext) {
+		session.Queries = append(session.Queries, query)
+		if extra := len(session.Queries) - s.config.SessionMaxQueries; extra > 0 {
+			session.Queries = session.Queries[extra:]
+		}
+	})
+}
+
+// RecordClick folds the clicked product's embedding into the owner's
+// session's click embedding. Clicks on products without an embedding are
+// ignored.
+func (s *SessionService) RecordClick(ctx context.Context, owner, sessionID, productID string) error {
+	if s == nil || sessionID == "" {
+		return nil
+	}
+	row, err := s.spanner.client.Single().ReadRow(ctx, "products", spanner.Key{productID}, []string{"embedding"})
+	if spanner.ErrCode(err) == codes.NotFound {
+		return ErrClickedProductNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read clicked product: %w", err)
+	}
+	var product []float32
+	if err := row.Columns(&product); err != nil {
+		return fmt.Errorf("failed to scan clicked product: %v", err)
+	}
+	if len(product) == 0 {
+		return nil
+	}
+
+	s.update(owner, sessionID, func(session *SessionContext) {
+		// Every click of a session counts the same, so the blend weight
+		// of the newest falls as clicks accumulate
+		if len(session.ClickEmbedding) == len(product) {
+			session.ClickEmbedding = blendEmbeddings(session.ClickEmbedding, product, 1/float64(session.Clicks+1))
+		} else {
+			session.ClickEmbedding = normalizeEmbedding(product)
+		}
+		session.Clicks++
+	})
+	return nil
+}
+
+// MedianPrice returns the median price of results, or zero when none has a
+// price
+func MedianPrice(results []models.SearchResult) float64 {
+	var prices []float64
+	for _, result := range results {
+		if price, err := strconv.ParseFloat(result.PriceInfo.Price, 64); err == nil && price > 0 {
+			prices = append(prices, price)
+		}
+	}
+	if len(prices) == 0 {
+		return 0
+	}
+	sort.Float64s(prices)
+	mid := len(prices) / 2
+	if len(prices)%2 == 0 {
+		return (prices[mid-1] + prices[mid]) / 2
+	}
+	return prices[mid]
+}
+
+// Follow-up phrases that refer back to the previous search
+var (
+	cheaperPhrases = []string{"less expensive", "more affordable", "lower priced", "cheaper"}
+	pricierPhrases = []string{"more expensive", "higher priced", "higher end", "pricier", "fancier"}
+	similarPhrases = []string{"more like these", "more like this", "more of these", "others like this", "similar ones", "like these", "similar"}
+)
+
+// followUpFiller are the words follow-ups wrap their phrase in, as in
+// "show me some cheaper ones please"
+var followUpFiller = map[string]bool{
+	"show": true, "me": true, "some": true, "any": true, "ones": true, "one": true,
+	"options": true, "alternatives": true, "something": true, "a": true, "bit": true,
+	"little": true, "please": true, "even": true, "much": true, "what": true,
+	"about": true, "how": true, "else": true, "are": true, "there": true,
+}
+
+// followUpConnectives open short queries that narrow the previous search,
+// as in "in red" or "but waterproof". Those marked true are dropped from
+// the resolved query.
+var followUpConnectives = map[string]bool{
+	"in": false, "with": false, "without": false, "for": false,
+	"but": true, "and": true, "only": true,
+}
+
+// ResolveFollowUp resolves a query that refers back to the previous search
+// of its session, such as "cheaper ones", "similar" or "in red", into a
+// search for the previous query, narrowed by the follow-up, with the
+// previous filter and price bounds. Cheaper and pricier follow-ups are
+// bounded by the previous results' median price. It reports false for
+// queries that stand on their own.
+func ResolveFollowUp(previous SessionQuery, query string) (SessionQuery, bool) {
+	resolved := SessionQuery{Filter: previous.Filter, MinPrice: previous.MinPrice, MaxPrice: previous.MaxPrice}
+	text := " " + cache.NormalizeQuery(query) + " "
+
+	matched := false
+	if phrase, ok := containsPhrase(text, cheaperPhrases); ok {
+		text, matched = strings.Replace(text, " "+phrase+" ", " ", 1), true
+		if previous.MedianPrice > 0 {
+			resolved.MaxPrice = &previous.MedianPrice
+		}
+	}
+	if phrase, ok := containsPhrase(text, pricierPhrases); ok {
+		text, matched = strings.Replace(text, " "+phrase+" ", " ", 1), true
+		if previous.MedianPrice > 0 {
+			resolved.MinPrice, resolved.MaxPrice = &previous.MedianPrice, nil
+		}
+	}
+	if phrase, ok := containsPhrase(text, similarPhrases); ok {
+		text, matched = strings.Replace(text, " "+phrase+" ", " ", 1), true
+	}
+
+	words := strings.Fields(text)
+	if matched {
+		words = slices.DeleteFunc(words, func(word string) bool { return followUpFiller[word] })
+		// Anything longer is a new search that happens to mention price
+		if len(words) > 3 {
+			return SessionQuery{}, false
+		}
+	} else {
+		if len(words) == 0 || len(words) > 4 {
+			return SessionQuery{}, false
+		}
+		drop, ok := followUpConnectives[words[0]]
+		if !ok {
+			return SessionQuery{}, false
+		}
+		if drop {
+			words = words[1:]
+		}
+	}
+
+	resolved.Query = strings.TrimSpace(previous.Query + " " + strings.Join(words, " "))
+	return resolved, true
+}
+
+// containsPhrase returns the first of phrases that text, padded with
+// spaces, contains as whole words
+func containsPhrase(text string, phrases []string) (string, bool) {
+	for _, phrase := range phrases {
+		if strings.Contains(text, " "+phrase+" ") {
+			return phrase, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/models"
+)
+
+// ErrProductNotFound is returned when a product does not exist in the
+// requested catalog
+var ErrProductNotFound = errors.New("product not found")
+
+// sameCategorySQL restricts candidates to products sharing a category with
+// the seed product
+const sameCategorySQL = `EXISTS (
+				SELECT 1 FROM UNNEST(JSON_VALUE_ARRAY(product_data, '$.categories')) AS category
+				WHERE category IN UNNEST(@seed_categories))`
+
+// SimilarOptions holds the parameters for SimilarProducts
+type SimilarOptions struct {
+	ProductID string
+	Limit     int
+	// SameCategory restricts results to products sharing a category with
+	// the seed product
+	SameCategory bool
+	// Filter further restricts the results; nil means no filter
+	Filter    filter.Node
+	Staleness time.Duration
+	// CatalogID restricts the seed and results to one catalog; empty means
+	// all products
+	CatalogID string
+}
+
+// SimilarProducts returns the products whose embeddings are nearest to the
+// seed product's, closest first, for "you may also like" carousels. The
+// seed itself is never returned, and a seed without an embedding has no
+// similar products.
+func (s *SpannerService) SimilarProducts(ctx context.Context, opts SimilarOptions) (results []models.SearchResult, err error) {
+	startTime := time.Now()
+
+	ctx, span := tracer.Start(ctx, "SpannerService.SimilarProducts",
+		trace.WithAttributes(
+			attribute.String("product.id", opts.ProductID),
+			attribute.Int("similar.limit", opts.Limit),
+			attribute.Bool("similar.same_category", opts.SameCategory),
+		))
+	defer func() {
+		if err != nil && !errors.Is(err, ErrProductNotFound) {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, "similar products failed")
+		}
+		span.End()
+	}()
+
+	// Read the seed and the candidates at the same snapshot
+	txn := s.client.ReadOnlyTransaction()
+	if opts.Staleness > 0 {
+		txn = txn.WithTimestampBound(spanner.ExactStaleness(opts.Staleness))
+	}
+	defer txn.Close()
+
+	// Neighbors are found in the serving embedding version's space
+	ann := DefaultANNParams(s.config)
+	row, err := txn.ReadRowWithOptions(ctx, "products", spanner.Key{opts.ProductID}, []string{ann.Column, "catalog_id", "product_data", "deleted_at"}, &spanner.ReadOptions{RequestTag: requestTag(ctx)})
+	if spanner.ErrCode(err) == codes.NotFound {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read product %s: %w", opts.ProductID, err)
+	}
+	var embedding []float32
+	var catalogID spanner.NullString
+	var productDataJSON spanner.NullJSON
+	var deletedAt spanner.NullTime
+	if err := row.Columns(&embedding, &catalogID, &productDataJSON, &deletedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan product %s: %v", opts.ProductID, err)
+	}
+	if deletedAt.Valid || !inCatalog(opts.CatalogID, catalogID) {
+		return nil, ErrProductNotFound
+	}
+	if len(embedding) == 0 {
+		return nil, nil
+	}
+
+	params := map[string]interface{}{
+		"seed_id":         opts.ProductID,
+		"candidate_limit": opts.Limit,
+	}
+
+	filterSQL := "product_id != @seed_id"
+	if opts.SameCategory {
+		productData, _ := productDataJSON.Value.(map[string]interface{})
+		categories := stringSlice(productData["categories"])
+		if len(categories) == 0 {
+			return nil, nil
+		}
+		params["seed_categories"] = categories
+		filterSQL += " AND " + sameCategorySQL
+	}
+	if opts.Filter != nil {
+		compiled, filterParams := filter.CompileSQL(opts.Filter, "filter_")
+		filterSQL += " AND " + compiled
+		for name, value := range filterParams {
+			params[name] = value
+		}
+	}
+	filterSQL += andClause(catalogClause("catalog_id", opts.CatalogID, params))
+
+	results, err = s.nearestProducts(ctx, txn, "similar", embedding, ann, filterSQL, params)
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed := time.Since(startTime)
+	span.SetAttributes(attribute.Int("similar.result_count", len(results)))
+	log.Printf("Similar products lookup completed in %s, found %d results", elapsed, len(results))
+
+	return results, nil
+}
+
+// nearestProducts runs the vector branch for embedding, restricted by
+// filterSQL, and returns the products it finds, nearest first, scored by
+// similarity. params must bind candidate_limit and the filter's
+// parameters; stage labels the query's latency metric.
+func (s *SpannerService) nearestProducts(ctx context.Context, txn *spanner.ReadOnlyTransaction, stage string, embedding []float32, ann ANNParams, filterSQL string, params map[string]interface{}) ([]models.SearchResult, error) {
+	startTime := time.Now()
+	params[queryEmbeddingParam(0)] = embedding
+	stmt := spanner.Statement{
+		SQL: "WITH " + annBranch(annBranchName(0), "\n\t\t\tAND "+filterSQL, queryEmbeddingParam(0), true, ann, "candidate_limit") + `
+		SELECT product_id, product_data, distance FROM ann ORDER BY rank`,
+		Params: params,
+	}
+
+	var results []models.SearchResult
+	iter := txn.QueryWithOptions(ctx, stmt, queryOptions(ctx))
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			metrics.ObserveSince(metrics.SpannerQueryDuration.WithLabelValues(stage, metrics.Outcome(err)), startTime)
+			return nil, fmt.Errorf("error iterating through nearest products: %w", err)
+		}
+
+		var productID string
+		var candidateJSON spanner.NullJSON
+		var distance float64
+		if err := row.Columns(&productID, &candidateJSON, &distance); err != nil {
+			return nil, fmt.Errorf("failed to scan nearest product: %v", err)
+		}
+
+		productData, ok := candidateJSON.Value.(map[string]interface{})
+		if !candidateJSON.Valid || !ok {
+			continue
+		}
+
+		result, err := s.transformToSearchResult(productID, productData, 1-distance)
+		if err != nil {
+			log.Printf("Warning: could not transform product %s: %v", productID, err)
+			continue
+		}
+		result.Score = map[string]float64{"similarity": 1 - distance}
+		results = append(results, result)
+	}
+	metrics.ObserveSince(metrics.SpannerQueryDuration.WithLabelValues(stage, metrics.Outcome(nil)), startTime)
+	return results, nil
+}
+
+// stringSlice returns the strings of a JSON array value
+func stringSlice(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var strs []string
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
@@ -19,39 +19,127 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/iterator"
-	"psearch/serving-go/internal/config"
-	"psearch/serving-go/internal/models"
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/metrics"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/telemetry"
 )
 
+var tracer = otel.Tracer("psearch/serving/internal/services")
+
 // SpannerService handles interactions with Spanner database
 type SpannerService struct {
 	client     *spanner.Client
 	config     *config.Config
-	embeddings *EmbeddingService
+	embeddings Embedder
+	// embeddingVersions are the served embedding versions, the default
+	// one, stored in the embedding column and embedded by embeddings,
+	// first
+	embeddingVersions []embeddingVersion
+
+	// products caches product_data by product ID for batch gets
+	products *cache.Cache[map[string]interface{}]
+	// results caches search output by search options, serving stale
+	// entries while they are refreshed in the background
+	results *cache.Cache[*SearchOutput]
+	// inflight coalesces concurrent searches that miss the result cache
+	inflight *cache.Flight[*SearchOutput]
+	// versions are the catalog versions that result cache keys include
+	versions *catalogVersions
+	// hedger is nil unless SEARCH_HEDGING_ENABLED is set
+	hedger *searchHedger
+	// normalizer is nil unless QUERY_NORMALIZATION is set
+	normalizer *QueryNormalizer
 }
 
 // NewSpannerService creates a new Spanner service
-func NewSpannerService(ctx context.Context, cfg *config.Config, embeddings *EmbeddingService) (*SpannerService, error) {
+func NewSpannerService(ctx context.Context, cfg *config.Config, embeddings Embedder) (*SpannerService, error) {
 	// Create the Spanner client
 	databaseName := fmt.Sprintf("projects/%s/instances/%s/databases/%s", 
 		cfg.ProjectID, cfg.SpannerInstanceID, cfg.SpannerDatabaseID)
 	
-	client, err := spanner.NewClient(ctx, databaseName)
+	poolConfig := spanner.DefaultSessionPoolConfig
+	poolConfig.MinOpened = uint64(cfg.SpannerMinSessions)
+	poolConfig.MaxOpened = uint64(cfg.SpannerMaxSessions)
+	poolConfig.MaxBurst = uint64(cfg.SpannerMaxBurst)
+	clientConfig := spanner.ClientConfig{
+		SessionPoolConfig: poolConfig,
+		// Per-request options, such as request tags, are merged into these
+		QueryOptions: spanner.QueryOptions{
+			Options:  &sppb.ExecuteSqlRequest_QueryOptions{OptimizerVersion: cfg.SpannerOptimizerVersion},
+			Priority: sppb.RequestOptions_Priority(sppb.RequestOptions_Priority_value["PRIORITY_"+cfg.SpannerQueryPriority]),
+		},
+	}
+
+	client, err := spanner.NewClientWithConfig(ctx, databaseName, clientConfig, spannerClientOptions(cfg)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Spanner client: %v", err)
 	}
 
-	return &SpannerService{
+	s := &SpannerService{
 		client:     client,
 		config:     cfg,
 		embeddings: embeddings,
-	}, nil
+		embeddingVersions: []embeddingVersion{
+			{name: config.DefaultEmbeddingVersion, column: "embedding", embedder: embeddings},
+		},
+		products:   cache.New[map[string]interface{}]("product", cfg.ProductCacheSize, cfg.ProductCacheTTL),
+		results:    cache.NewWithSoftTTL[*SearchOutput]("result", cfg.ResultCacheSize, cfg.ResultCacheSoftTTL, cfg.ResultCacheTTL),
+		inflight:   cache.NewFlight[*SearchOutput]("result"),
+		versions:   &catalogVersions{},
+		normalizer: NewQueryNormalizer(cfg),
+	}
+	if cfg.SearchHedgingEnabled {
+		s.hedger = newSearchHedger(cfg)
+	}
+	return s, nil
+}
+
+// WarmSessions runs n trivial queries at once, so the session pool has at
+// least n sessions open before the first searches arrive
+func (s *SpannerService) WarmSessions(ctx context.Context, n int) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.Ping(ctx)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping runs a trivial query to verify that Spanner is reachable
+func (s *SpannerService) Ping(ctx context.Context) error {
+	iter := s.client.Single().QueryWithOptions(ctx, spanner.Statement{SQL: "SELECT 1"}, queryOptions(ctx))
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil {
+		return fmt.Errorf("spanner ping failed: %w", err)
+	}
+	return nil
 }
 
 // Close closes the Spanner client connection
@@ -61,9 +149,30 @@ func (s *SpannerService) Close() {
 	}
 }
 
+// UseRemoteCache backs the search result cache with a shared remote tier
+func (s *SpannerService) UseRemoteCache(remote *cache.Remote) {
+	s.results.SetRemote(remote)
+}
+
+// SetResultCacheTTL changes how long search results are cached from now on
+func (s *SpannerService) SetResultCacheTTL(softTTL, hardTTL time.Duration) {
+	s.results.SetTTL(softTTL, hardTTL)
+}
+
+// CacheLayers returns the caches owned by the Spanner service
+func (s *SpannerService) CacheLayers() []cache.Layer {
+	return []cache.Layer{s.results, s.products}
+}
+
 // GetProduct retrieves a single product by ID
 func (s *SpannerService) GetProduct(ctx context.Context, productID string) (map[string]interface{}, error) {
-	row, err := s.client.Single().ReadRow(ctx, "products", spanner.Key{productID}, []string{"product_data"})
+	ctx, span := tracer.Start(ctx, "SpannerService.GetProduct",
+		trace.WithAttributes(attribute.String("product.id", productID)))
+	defer span.End()
+
+	readStart := time.Now()
+	row, err := s.client.Single().ReadRowWithOptions(ctx, "products", spanner.Key{productID}, []string{"product_data"}, &spanner.ReadOptions{RequestTag: requestTag(ctx)})
+	metrics.ObserveSince(metrics.SpannerQueryDuration.WithLabelValues("get_product", metrics.Outcome(err)), readStart)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read product %s: %v", productID, err)
 	}
@@ -81,28 +190,39 @@ func (s *SpannerService) GetProduct(ctx context.Context, productID string) (map[
 	return productData, nil
 }
 
-// GetProductsBatch retrieves multiple products by their IDs in a single batch
-func (s *SpannerService) GetProductsBatch(ctx context.Context, productIDs []string) (map[string]map[string]interface{}, error) {
+// GetProductsBatch retrieves multiple products by their IDs in a single batch.
+// A non-zero staleness reads from a recent snapshot instead of a strong read.
+// A catalog ID leaves out products of other catalogs. Soft-deleted products
+// are left out too.
+func (s *SpannerService) GetProductsBatch(ctx context.Context, catalogID string, productIDs []string, staleness time.Duration) (map[string]map[string]interface{}, error) {
 	if len(productIDs) == 0 {
 		return make(map[string]map[string]interface{}), nil
 	}
 
 	startTime := time.Now()
 
-	// Create a SQL statement with UNNEST to handle large number of product IDs
-	stmt := spanner.Statement{
-		SQL: `SELECT product_id, product_data 
-              FROM products 
-              WHERE product_id IN UNNEST(@product_ids)`,
-		Params: map[string]interface{}{
-			"product_ids": productIDs,
-		},
-	}
+	ctx, span := tracer.Start(ctx, "SpannerService.GetProductsBatch",
+		trace.WithAttributes(attribute.Int("product.requested_count", len(productIDs))))
+	defer span.End()
 
+	// Serve cached products and only read the rest
 	resultMap := make(map[string]map[string]interface{})
-	
+	var missing []string
+	for _, productID := range productIDs {
+		if productData, ok := s.products.Get(productCacheKey(catalogID, productID)); ok {
+			resultMap[productID] = productData
+		} else {
+			missing = append(missing, productID)
+		}
+	}
+	span.SetAttributes(attribute.Int("product.cached_count", len(resultMap)))
+	if len(missing) == 0 {
+		return resultMap, nil
+	}
+
 	// Execute the query
-	iter := s.client.Single().Query(ctx, stmt)
+	stmt := productsBatchStatement(catalogID, missing)
+	iter := s.singleRead(time.Time{}, staleness).QueryWithOptions(ctx, stmt, queryOptions(ctx))
 	defer iter.Stop()
 
 	for {
@@ -111,7 +231,8 @@ func (s *SpannerService) GetProductsBatch(ctx context.Context, productIDs []stri
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error iterating through query results: %v", err)
+			metrics.ObserveSince(metrics.SpannerQueryDuration.WithLabelValues("batch_get", metrics.Outcome(err)), startTime)
+			return nil, fmt.Errorf("error iterating through query results: %w", err)
 		}
 
 		var productID string
@@ -130,131 +251,749 @@ func (s *SpannerService) GetProductsBatch(ctx context.Context, productIDs []stri
 				return nil, fmt.Errorf("failed to type assert product data from NullJSON.Value")
 			}
 			resultMap[productID] = productData
+			s.products.Set(productCacheKey(catalogID, productID), productData, cache.ProductTag(productID))
 		}
 	}
 
+	span.SetAttributes(attribute.Int("product.found_count", len(resultMap)))
+
 	elapsed := time.Since(startTime)
+	metrics.SpannerQueryDuration.WithLabelValues("batch_get", metrics.Outcome(nil)).Observe(elapsed.Seconds())
 	log.Printf("Spanner batch fetch for %d products took %s, retrieved %d", 
 		len(productIDs), elapsed, len(resultMap))
 
 	return resultMap, nil
 }
 
-// HybridSearch performs a hybrid search using both vector similarity and text search
-func (s *SpannerService) HybridSearch(ctx context.Context, query string, limit int, minScore float64, alpha float64) ([]models.SearchResult, error) {
-	startTime := time.Now()
+// productsBatchStatement reads the product data of the live products among
+// productIDs in the catalog. UNNEST handles large numbers of product IDs.
+func productsBatchStatement(catalogID string, productIDs []string) spanner.Statement {
+	params := map[string]interface{}{
+		"product_ids": productIDs,
+	}
+	return spanner.Statement{
+		SQL: `SELECT product_id, product_data 
+              FROM products 
+              WHERE product_id IN UNNEST(@product_ids) AND deleted_at IS NULL` + andClause(catalogClause("catalog_id", catalogID, params)),
+		Params: params,
+	}
+}
 
-	// Generate embeddings for the query
-	embedding, err := s.embeddings.GenerateEmbedding(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate embedding: %v", err)
-	}
-
-	// Construct hybrid search SQL query
-	// This combines vector similarity search with text search using the configured alpha value
-	sql := `
-		@{optimizer_version=7}
-		WITH ann AS (
-		SELECT offset + 1 AS rank, product_id, title, product_data
-		FROM UNNEST(ARRAY(
-			SELECT AS STRUCT product_id, title, product_data
-			FROM products @{FORCE_INDEX=products_by_embedding}
-			WHERE embedding IS NOT NULL
-			ORDER BY APPROX_COSINE_DISTANCE(embedding, @query_embedding,
-			OPTIONS=>JSON'{"num_leaves_to_search": 10}')
-			LIMIT @limit)) WITH OFFSET AS offset
-		),
-		fts AS (
-		SELECT offset + 1 AS rank, product_id, title, product_data
-		FROM UNNEST(ARRAY(
-			SELECT AS STRUCT product_id, title, product_data
-			FROM products
-			WHERE SEARCH(title_tokens, @query_text)
-			ORDER BY SCORE(title_tokens, @query_text) DESC
-			LIMIT @limit)) WITH OFFSET AS offset
-		)
-		SELECT 
-			SUM(1 / (60 + rank)) AS rrf_score, 
-			product_id,
-			ANY_VALUE(title) AS title,
-			ANY_VALUE(product_data) AS product_data 
-		FROM ((
-		SELECT rank, product_id, title, product_data
-		FROM ann
-		)
-		UNION ALL (
-		SELECT rank, product_id, title, product_data
-		FROM fts
-		))
-		GROUP BY product_id
-		ORDER BY rrf_score DESC
-		LIMIT @limit;
-	`
+// productCacheKey keys cached products by catalog so a product is only
+// served from the cache to lookups in its own catalog
+func productCacheKey(catalogID, productID string) string {
+	if catalogID == "" {
+		return productID
+	}
+	return catalogID + "/" + productID
+}
 
-	// Create parameters
-	params := map[string]interface{}{
-		"query_embedding": embedding,
-		"query_text":      query,
-		"limit":           limit,
+// LoadLatencyBaselines reads the stored per-query-class latency baselines
+func (s *SpannerService) LoadLatencyBaselines(ctx context.Context) ([]*LatencyBaseline, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT query_class, p95_ms, stage_p95_ms, sample_count, revision, updated_at
+              FROM query_latency_baselines`,
 	}
 
-	// Execute the query
-	stmt := spanner.Statement{SQL: sql, Params: params}
 	iter := s.client.Single().Query(ctx, stmt)
 	defer iter.Stop()
 
-	var results []models.SearchResult
+	var baselines []*LatencyBaseline
 	for {
 		row, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error iterating through search results: %v", err)
+			return nil, fmt.Errorf("error iterating through latency baselines: %v", err)
 		}
 
-		var productIDInt string
-		var title string
-		var productDataJSON spanner.NullJSON
-		var hybridScore float64
+		var queryClass, revision string
+		var p95Ms float64
+		var stageP95JSON spanner.NullJSON
+		var sampleCount int64
+		var updatedAt time.Time
+		if err := row.Columns(&queryClass, &p95Ms, &stageP95JSON, &sampleCount, &revision, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan latency baseline: %v", err)
+		}
 
-		if err := row.Columns(&hybridScore, &productIDInt, &title, &productDataJSON); err != nil {
-			return nil, fmt.Errorf("failed to scan search result: %v", err)
+		stageP95 := make(map[string]time.Duration)
+		if stageMs, ok := stageP95JSON.Value.(map[string]interface{}); stageP95JSON.Valid && ok {
+			for stage, v := range stageMs {
+				if ms, ok := v.(float64); ok {
+					stageP95[stage] = time.Duration(ms * float64(time.Millisecond))
+				}
+			}
 		}
 
-		productID := fmt.Sprintf("%d", productIDInt)
+		baselines = append(baselines, &LatencyBaseline{
+			QueryClass:  queryClass,
+			P95:         time.Duration(p95Ms * float64(time.Millisecond)),
+			StageP95:    stageP95,
+			SampleCount: sampleCount,
+			Revision:    revision,
+			UpdatedAt:   updatedAt,
+		})
+	}
+
+	return baselines, nil
+}
+
+// SaveLatencyBaseline upserts the latency baseline for a query class
+func (s *SpannerService) SaveLatencyBaseline(ctx context.Context, baseline *LatencyBaseline) error {
+	stageMs := make(map[string]float64, len(baseline.StageP95))
+	for stage, d := range baseline.StageP95 {
+		stageMs[stage] = durationMs(d)
+	}
+
+	mutation := spanner.InsertOrUpdate("query_latency_baselines",
+		[]string{"query_class", "p95_ms", "stage_p95_ms", "sample_count", "revision", "updated_at"},
+		[]interface{}{
+			baseline.QueryClass,
+			durationMs(baseline.P95),
+			spanner.NullJSON{Value: stageMs, Valid: true},
+			baseline.SampleCount,
+			baseline.Revision,
+			spanner.CommitTimestamp,
+		})
+
+	ctx, span := tracer.Start(ctx, "SpannerService.SaveLatencyBaseline",
+		trace.WithAttributes(attribute.String("search.query_class", baseline.QueryClass)))
+	defer span.End()
+
+	commitTimestamp, err := s.client.Apply(ctx, []*spanner.Mutation{mutation})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "apply failed")
+		return fmt.Errorf("failed to save latency baseline: %v", err)
+	}
+	span.SetAttributes(attribute.String("spanner.commit_timestamp", commitTimestamp.UTC().Format(time.RFC3339Nano)))
+	return nil
+}
+
+// TransformProduct converts raw product data into the typed SearchResult
+// model for callers that fetch products outside of a search
+func (s *SpannerService) TransformProduct(productID string, productData map[string]interface{}) (models.SearchResult, error) {
+	result, err := s.transformToSearchResult(productID, productData, 0)
+	if err != nil {
+		return result, err
+	}
+	result.Score = nil
+	return result, nil
+}
+
+// SearchOptions holds the per-request parameters for HybridSearch
+type SearchOptions struct {
+	Query    string
+	Limit    int
+	Offset   int
+	MinScore float64
+	Alpha    float64
+	Mode     models.SearchMode
+	// Filter restricts both retrieval branches; nil means no filter
+	Filter filter.Node
+	// Rerank reorders the fused candidates with the RerankService
+	Rerank bool
+
+	// ReadTimestamp pins the read to a previous page's timestamp so pages
+	// stay consistent while the catalog changes. Zero means a strong read.
+	ReadTimestamp time.Time
+	// Staleness allows a stale read when no ReadTimestamp is set. Zero means
+	// a strong read.
+	Staleness time.Duration
+	// Expansions are paraphrases of the query that get their own ANN branch
+	Expansions []string
+	// SubQueries are phrases of a long query that get their own ANN branch
+	SubQueries []string
+	// CatalogID restricts the search to one catalog; empty searches all
+	// products
+	CatalogID string
+	// Explain records the filter conditions each result matched and the
+	// executed statement, for debug responses. Explained searches are not
+	// cached.
+	Explain bool
+	// UserEmbedding personalizes the vector branch: it is blended into
+	// every query embedding with PersonalizationWeight. Personalized
+	// searches are not cached.
+	UserEmbedding         []float32
+	PersonalizationWeight float64
+	// IDsOnly skips reading product data: results carry only their ID and
+	// score, for callers that hydrate products from their own cache
+	IDsOnly bool
+	// Language is the query's language tag, detected or requested. It
+	// selects the FTS branch's query tokenization; empty uses the default.
+	Language string
+	// ANN tunes the vector branch's index lookups
+	ANN ANNParams
+	// Keyword tunes how the FTS branch matches the query
+	Keyword KeywordParams
+	// RRFK is the reciprocal rank fusion constant; zero uses RRF_K
+	RRFK int
+	// EmbeddingVersion names the embedding version the vector branch
+	// searches; empty uses EMBEDDING_SERVING_VERSION. Only the default
+	// version is personalized, since user profiles are learned from its
+	// embeddings.
+	EmbeddingVersion string
+	// Local restricts or annotates the results by availability at nearby
+	// stores; nil searches regardless of store availability
+	Local *LocalSearch
+	// Sort orders the results by a product field; empty and
+	// SearchSortRelevance order them by fused score
+	Sort models.SearchSort
+}
+
+// SearchOutput holds the results of HybridSearch and how they were read
+type SearchOutput struct {
+	Results       []models.SearchResult
+	ReadTimestamp time.Time
+	// Fallback names the degraded mode the search ran in, if any
+	Fallback string
+	// RawScores holds the per-branch ranks and scores by product ID
+	RawScores map[string]models.ResultScores
+	// Stale is set when the output came from an expired result cache entry
+	// that is being refreshed in the background
+	Stale bool
+	// Statement is the executed search statement, for explained searches
+	Statement *models.SQLStatement
+}
+
+// popularityColumns maps each POPULARITY_SIGNAL to its product_stats column
+var popularityColumns = map[string]string{
+	"purchases": "purchase_count",
+	"clicks":    "click_count",
+}
+
+// FallbackKeywordOnly marks hybrid searches served without the vector
+// branch because embeddings were unavailable
+const FallbackKeywordOnly = "keyword_only"
+
+// queryEmbeddings embeds the query and its expansions or sub-queries
+// concurrently with embedder. Only a failure to embed the query itself is
+// an error; variants that fail are dropped.
+func (s *SpannerService) queryEmbeddings(ctx context.Context, embedder Embedder, query string, expansions, subQueries []string) ([][]float32, error) {
+	texts := append([]string{query}, expansions...)
+	texts = append(texts, subQueries...)
+	embeddings := make([][]float32, len(texts))
+	errs := make([]error, len(texts))
+
+	var wg sync.WaitGroup
+	for i, text := range texts {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			embeddings[i], errs[i] = embedder.GenerateEmbedding(ctx, text)
+		}(i, text)
+	}
+	wg.Wait()
 
-		if !productDataJSON.Valid {
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	result := [][]float32{embeddings[0]}
+	for i := 1; i < len(texts); i++ {
+		if errs[i] != nil {
+			log.Printf("Warning: could not embed query variant %q: %v", texts[i], errs[i])
 			continue
 		}
+		result = append(result, embeddings[i])
+	}
+	return result, nil
+}
+
+type cacheRefreshKey struct{}
+
+// isCacheRefresh reports whether ctx belongs to a background cache refresh
+// or a coalesced cache fill, which must bypass cache reads
+func isCacheRefresh(ctx context.Context) bool {
+	refresh, _ := ctx.Value(cacheRefreshKey{}).(bool)
+	return refresh
+}
+
+// refreshResults re-runs a search whose cached results went stale, detached
+// from the request that served them. The search stores its fresh results.
+func (s *SpannerService) refreshResults(ctx context.Context, cacheKey string, opts SearchOptions) {
+	// Searches that are not cached, such as keyword fallbacks, leave the
+	// entry stale, so always clear the mark to allow a later refresh
+	defer s.results.EndRefresh(cacheKey)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.config.ResultCacheRefreshTimeout)
+	defer cancel()
+	// Keep the refresh out of the originating request's stage timings
+	ctx = ContextWithStageTimings(context.WithValue(ctx, cacheRefreshKey{}, true), nil)
+
+	if _, err := s.HybridSearch(ctx, opts); err != nil {
+		log.Printf("Warning: background refresh of cached search failed: %v", err)
+	}
+}
+
+// resultCacheKey identifies a search by everything that affects its results,
+// including the version of the catalog it reads. It is built before the
+// query embedding and text are bound. Filter parameters are named by
+// position only, so the filter's operators and fields are keyed by its SQL.
+func resultCacheKey(opts SearchOptions, catalogVersion string, filterSQL string, params map[string]interface{}) string {
+	// fmt prints maps with sorted keys, so equal params give equal keys
+	return fmt.Sprintf("%s|%s|%s|%q|%q|%g|%d|%t|%v|%s|%s|%s|%q|%v", catalogVersion, opts.Mode, cache.NormalizeQuery(opts.Query), opts.Expansions, opts.SubQueries, opts.MinScore, opts.Staleness, opts.IDsOnly, opts.ANN, opts.Keyword.cacheKey(), opts.Local.cacheKey(), opts.Sort, filterSQL, params)
+}
+
+// withBudget bounds ctx by budget, when one is set. The parent's deadline
+// still applies if it is sooner.
+func withBudget(ctx context.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, budget)
+}
+
+// singleRead returns a single-use read-only transaction. A read timestamp
+// takes precedence over staleness; with neither set the read is strong.
+func (s *SpannerService) singleRead(readTimestamp time.Time, staleness time.Duration) *spanner.ReadOnlyTransaction {
+	return s.withTimestampBound(s.client.Single(), readTimestamp, staleness)
+}
+
+// snapshot returns a multi-use read-only transaction bound like singleRead,
+// for queries that must read the same snapshot. Callers must Close it.
+func (s *SpannerService) snapshot(readTimestamp time.Time, staleness time.Duration) *spanner.ReadOnlyTransaction {
+	return s.withTimestampBound(s.client.ReadOnlyTransaction(), readTimestamp, staleness)
+}
+
+// withTimestampBound pins txn to readTimestamp if set, and otherwise reads
+// data up to staleness old in the configured staleness mode
+func (s *SpannerService) withTimestampBound(txn *spanner.ReadOnlyTransaction, readTimestamp time.Time, staleness time.Duration) *spanner.ReadOnlyTransaction {
+	switch {
+	case !readTimestamp.IsZero():
+		txn = txn.WithTimestampBound(spanner.ReadTimestamp(readTimestamp))
+	case staleness > 0 && s.config.SpannerStalenessMode == "max":
+		txn = txn.WithTimestampBound(spanner.MaxStaleness(staleness))
+	case staleness > 0:
+		txn = txn.WithTimestampBound(spanner.ExactStaleness(staleness))
+	}
+	return txn
+}
+
+// requestTagKey carries the Spanner request tag of the calling endpoint
+type requestTagKey struct{}
+
+// maxRequestTagLength is the longest request tag Spanner records
+const maxRequestTagLength = 50
+
+// ContextWithRequestTag tags the Spanner requests made with ctx, so query
+// statistics can be broken down by endpoint. Long tags are truncated.
+func ContextWithRequestTag(ctx context.Context, tag string) context.Context {
+	if len(tag) > maxRequestTagLength {
+		tag = tag[:maxRequestTagLength]
+	}
+	return context.WithValue(ctx, requestTagKey{}, tag)
+}
+
+// requestTag returns the request tag set on ctx, if any
+func requestTag(ctx context.Context) string {
+	tag, _ := ctx.Value(requestTagKey{}).(string)
+	return tag
+}
+
+// queryOptions returns the per-request options of queries made with ctx.
+// The optimizer version and priority are client defaults.
+func queryOptions(ctx context.Context) spanner.QueryOptions {
+	return spanner.QueryOptions{RequestTag: requestTag(ctx)}
+}
+
+// searchQueryOptions returns the options of search queries made with ctx.
+// Queries are profiled only when a debug request is collecting costs.
+func searchQueryOptions(ctx context.Context) spanner.QueryOptions {
+	opts := queryOptions(ctx)
+	if CostRecorderFromContext(ctx) != nil {
+		opts.Mode = sppb.ExecuteSqlRequest_PROFILE.Enum()
+	}
+	return opts
+}
+
+// HybridSearch performs a search using vector similarity, text search, or both
+// depending on the requested mode
+func (s *SpannerService) HybridSearch(ctx context.Context, opts SearchOptions) (output *SearchOutput, err error) {
+	startTime := time.Now()
+
+	if opts.Mode == "" {
+		opts.Mode = models.SearchModeHybrid
+	}
+	opts.ANN = opts.ANN.withDefaults(s.config)
+	opts.Keyword = opts.Keyword.withDefaults(s.config)
+	if opts.RRFK <= 0 {
+		opts.RRFK = s.config.RRFK
+	}
+	version, err := s.embeddingVersion(opts.EmbeddingVersion)
+	if err != nil {
+		return nil, err
+	}
+	opts.EmbeddingVersion, opts.ANN.Column = version.name, version.column
+	if version.name != config.DefaultEmbeddingVersion {
+		opts.UserEmbedding = nil
+	}
+	// Both branches, the result cache and the logs see the normalized query
+	normalized := s.normalizer.Normalize(opts.Query, opts.Language)
+	opts.Query = normalized.Text
+
+	ctx, span := tracer.Start(ctx, "SpannerService.HybridSearch",
+		trace.WithAttributes(
+			attribute.String("search.query_hash", telemetry.HashQuery(opts.Query)),
+			attribute.String("search.mode", string(opts.Mode)),
+			attribute.Int("search.limit", opts.Limit),
+			attribute.Int("search.offset", opts.Offset),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "search failed")
+		}
+		span.End()
+	}()
+
+	// Split alpha into per-branch fusion weights
+	annWeight, ftsWeight := rrfWeights(opts.Mode, opts.Alpha)
+
+	// Create parameters
+	// Each branch ranks enough candidates to fill every page up to this one,
+	// so fused ranks are identical across pages read at the same timestamp
+	params := map[string]interface{}{
+		"limit":               opts.Limit,
+		"offset":              opts.Offset,
+		"candidate_limit":     opts.Limit + opts.Offset,
+		"ann_candidate_limit": opts.ANN.candidates(opts.Limit + opts.Offset),
+		"rrf_k":               opts.RRFK,
+		"ann_weight":          annWeight,
+		"fts_weight":          ftsWeight,
+	}
+	// Sorted searches rank a fixed candidate set instead, since the page
+	// cannot be cut from the top of each branch's ranking
+	_, sorted := searchOrderBy[opts.Sort]
+	if sorted {
+		params["candidate_limit"] = s.config.SortCandidates
+		params["ann_candidate_limit"] = opts.ANN.candidates(s.config.SortCandidates)
+	}
+	if usesFTS(opts.Mode) && opts.Language != "" {
+		params["query_language"] = opts.Language
+	}
+
+	filterSQL := searchFilterSQL(opts, params)
+
+	// Local searches find the shopper's stores first. Filtered searches
+	// covering no store cannot have results.
+	var stores []localStore
+	if opts.Local != nil {
+		stores, err = s.localStores(ctx, s.singleRead(opts.ReadTimestamp, opts.Staleness), opts.Local)
+		if err != nil {
+			return nil, err
+		}
+		span.SetAttributes(attribute.Int("search.local_stores", len(stores)))
+		if !opts.Local.Boost {
+			if len(stores) == 0 {
+				return &SearchOutput{RawScores: map[string]models.ResultScores{}}, nil
+			}
+			filterSQL = localClause(stores, params) + andClause(filterSQL)
+		}
+	}
 
-		// Type assert productDataJSON.Value directly to map[string]interface{}
-		productData, ok := productDataJSON.Value.(map[string]interface{})
-		if !ok {
-			// Log the actual type if the assertion fails
-			log.Printf("DEBUG: Unexpected type for productDataJSON.Value in search result: %T", productDataJSON.Value)
-			return nil, fmt.Errorf("failed to type assert product data from NullJSON.Value for search result")
+	// Pinned snapshots and debug requests always go to Spanner; debug
+	// requests need the query's execution statistics
+	personalized := len(opts.UserEmbedding) > 0 && opts.PersonalizationWeight > 0
+	cacheable := opts.ReadTimestamp.IsZero() && !opts.Explain && !personalized && CostRecorderFromContext(ctx) == nil
+	cacheKey := resultCacheKey(opts, s.versions.get(opts.CatalogID), filterSQL, params)
+	if cacheable && !isCacheRefresh(ctx) {
+		if cached, stale, ok := s.results.GetStale(cacheKey); ok {
+			span.SetAttributes(attribute.Bool("search.cache_hit", true), attribute.Bool("search.cache_stale", stale))
+			if stale && s.results.BeginRefresh(cacheKey) {
+				go s.refreshResults(ctx, cacheKey, opts)
+			}
+			// Callers may replace Results, so hand out a copy of the entry
+			output := *cached
+			output.Stale = stale
+			return &output, nil
 		}
 
+		// Identical searches that miss together share one execution, which
+		// also fills the cache for those that follow
+		if s.config.ResultCacheCoalesce {
+			fillCtx := context.WithValue(ctx, cacheRefreshKey{}, true)
+			shared, coalesced, err := s.inflight.Do(ctx, cacheKey, func() (*SearchOutput, error) {
+				return s.HybridSearch(fillCtx, opts)
+			})
+			if err != nil {
+				return nil, err
+			}
+			span.SetAttributes(attribute.Bool("search.coalesced", coalesced))
+			output := *shared
+			return &output, nil
+		}
+	}
+
+	// Generate embeddings for the query only when the vector branch runs
+	var fallback string
+	annBranches := 1
+	if usesANN(opts.Mode) {
+		embeddingStart := time.Now()
+		embeddingCtx, cancel := withBudget(ContextWithQueryLanguage(ctx, opts.Language), s.config.EmbeddingBudget)
+		embeddings, err := s.queryEmbeddings(embeddingCtx, version.embedder, opts.Query, opts.Expansions, opts.SubQueries)
+		cancel()
+		recordStage(ctx, StageEmbedding, embeddingStart)
+		switch {
+		case err == nil:
+			annBranches = len(embeddings)
+			for i, embedding := range embeddings {
+				if personalized && len(embedding) == len(opts.UserEmbedding) {
+					embedding = blendEmbeddings(embedding, opts.UserEmbedding, opts.PersonalizationWeight)
+				}
+				params[queryEmbeddingParam(i)] = embedding
+			}
+			params["ann_weight"] = annWeight / float64(annBranches)
+			span.SetAttributes(attribute.Int("search.ann_branches", annBranches))
+		case opts.Mode == models.SearchModeHybrid && s.config.EmbeddingFallbackToKeyword && IsRetryable(err):
+			// Serve keyword-only results rather than failing the search
+			log.Printf("Embedding unavailable, falling back to keyword search: %v", err)
+			span.RecordError(err)
+			fallback = FallbackKeywordOnly
+			reason := "embedding_error"
+			switch {
+			case errors.Is(err, ErrCircuitOpen):
+				reason = "circuit_open"
+			case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+				reason = "embedding_budget"
+			}
+			metrics.SearchFallbacks.WithLabelValues(fallback, reason).Inc()
+			span.SetAttributes(attribute.String("search.fallback", fallback))
+			opts.Mode = models.SearchModeKeyword
+			params["ann_weight"], params["fts_weight"] = 0.0, 1.0
+			cacheable = false
+		default:
+			return nil, fmt.Errorf("failed to generate embedding: %w", err)
+		}
+	}
+	if usesFTS(opts.Mode) {
+		params["query_text"] = keywordQuery(normalized.Keywords, opts.Keyword)
+	}
+
+	demote := s.config.QualityDemotionEnabled
+	if demote {
+		params["quality_threshold"] = s.config.QualityLowScoreThreshold
+		params["quality_demotion"] = s.config.QualityDemotionFactor
+	}
+
+	var popularityColumn string
+	if s.config.PopularityWeight > 0 {
+		popularityColumn = popularityColumns[s.config.PopularitySignal]
+		params["popularity_weight"] = s.config.PopularityWeight
+	}
+
+	branches := 0
+	if usesANN(opts.Mode) {
+		branches += annBranches
+	}
+	if usesFTS(opts.Mode) {
+		branches++
+	}
+
+	// Execute the search within its budget
+	queryStart := time.Now()
+	ctx, cancel := withBudget(ctx, s.config.SpannerBudget)
+	defer cancel()
+	var txn *spanner.ReadOnlyTransaction
+	var stmt spanner.Statement
+	var rows []searchRow
+	span.SetAttributes(attribute.String("search.execution", s.config.SearchExecution))
+	// Only the single statement can sort by product fields
+	if s.config.SearchExecution == "parallel" && !sorted {
+		txn = s.snapshot(opts.ReadTimestamp, opts.Staleness)
+		defer txn.Close()
+		rows, stmt, err = s.parallelSearchRows(ctx, txn, opts, params, filterSQL, annBranches, demote, popularityColumn)
+	} else {
+		stmt = spanner.Statement{SQL: buildSearchSQL(opts.Mode, filterSQL, s.config.FTSFields, opts.Language != "", opts.Keyword, annBranches, opts.ANN, demote, popularityColumn, opts.Sort, !opts.IDsOnly), Params: params}
+		rows, txn, err = s.hedgedSearchRows(ctx, opts, stmt, branches, params["candidate_limit"].(int))
+	}
+	queryTime := time.Since(queryStart)
+	metrics.SpannerQueryDuration.WithLabelValues("search", metrics.Outcome(err)).Observe(queryTime.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.SearchResult
+	rawScores := make(map[string]models.ResultScores)
+	transformStart := time.Now()
+	for _, row := range rows {
 		// Skip if score is below minimum threshold
-		if hybridScore < minScore {
+		if row.score < opts.MinScore {
 			continue
 		}
 
-		// Transform to search result
-		searchResult, err := s.transformToSearchResult(productID, productData, hybridScore)
-		if err != nil {
-			log.Printf("Warning: could not transform product %s: %v", productID, err)
-			continue
+		var productData map[string]interface{}
+		var searchResult models.SearchResult
+		if opts.IDsOnly {
+			searchResult = models.SearchResult{ID: row.productID, Score: map[string]float64{"hybrid": row.score}}
+		} else {
+			if !row.productData.Valid {
+				continue
+			}
+
+			// Type assert productData.Value directly to map[string]interface{}
+			var ok bool
+			productData, ok = row.productData.Value.(map[string]interface{})
+			if !ok {
+				// Log the actual type if the assertion fails
+				log.Printf("DEBUG: Unexpected type for productDataJSON.Value in search result: %T", row.productData.Value)
+				return nil, fmt.Errorf("failed to type assert product data from NullJSON.Value for search result")
+			}
+
+			// Transform to search result
+			searchResult, err = s.transformToSearchResult(row.productID, productData, row.score)
+			if err != nil {
+				log.Printf("Warning: could not transform product %s: %v", row.productID, err)
+				continue
+			}
 		}
 
 		results = append(results, searchResult)
+		scores := resultScores(row.productID, row.score, row.annRank, row.annDistance, row.ftsRank, row.ftsScore)
+		if row.annRank.Valid {
+			scores.ANNContribution = &row.annContribution
+		}
+		if row.ftsRank.Valid {
+			scores.FTSContribution = &row.ftsContribution
+		}
+		if row.qualityFactor != 1 {
+			scores.Boosts = append(scores.Boosts, models.AppliedBoost{Type: models.BoostQualityDemotion, Factor: row.qualityFactor})
+		}
+		if row.popularityFactor != 1 {
+			scores.Boosts = append(scores.Boosts, models.AppliedBoost{Type: models.BoostPopularity, Factor: row.popularityFactor})
+		}
+		if opts.Explain && productData != nil {
+			scores.FilterMatches = filter.Matched(opts.Filter, productData)
+		}
+		rawScores[row.productID] = scores
+	}
+
+	transformTime := time.Since(transformStart)
+	if err := s.annotateLocalAvailability(ctx, s.singleRead(opts.ReadTimestamp, opts.Staleness), results, stores); err != nil {
+		return nil, err
+	}
+	timings := StageTimingsFromContext(ctx)
+	timings.Record(StageSpannerQuery, queryTime)
+	timings.Record(StageTransform, transformTime)
+	metrics.SearchResultCount.WithLabelValues(string(opts.Mode)).Observe(float64(len(results)))
+
+	output = &SearchOutput{Results: results, Fallback: fallback, RawScores: rawScores}
+	if opts.Explain {
+		output.Statement = redactStatement(stmt)
+	}
+	span.SetAttributes(attribute.Int("search.result_count", len(results)))
+	if readTimestamp, err := txn.Timestamp(); err == nil {
+		output.ReadTimestamp = readTimestamp
+		span.SetAttributes(attribute.String("spanner.read_timestamp", readTimestamp.UTC().Format(time.RFC3339Nano)))
+	}
+
+	if cacheable {
+		tags := []string{cache.QueryTag(opts.Query)}
+		for _, r := range results {
+			tags = append(tags, cache.ProductTag(r.ID))
+		}
+		s.results.Set(cacheKey, output, tags...)
 	}
 
 	elapsed := time.Since(startTime)
-	log.Printf("Hybrid search completed in %s, found %d results", elapsed, len(results))
+	log.Printf("Search (%s) completed in %s, found %d results", opts.Mode, elapsed, len(results))
+
+	return output, nil
+}
+
+// searchFilterSQL compiles the search's filter into a predicate scoped to
+// its catalog, binding the predicate's parameters in params. Every
+// retrieval branch applies it.
+func searchFilterSQL(opts SearchOptions, params map[string]interface{}) string {
+	var filterSQL string
+	if opts.Filter != nil {
+		var filterParams map[string]interface{}
+		filterSQL, filterParams = filter.CompileSQL(opts.Filter, "filter_")
+		for name, value := range filterParams {
+			params[name] = value
+		}
+	}
+	if clause := catalogClause("catalog_id", opts.CatalogID, params); clause != "" {
+		filterSQL = clause + andClause(filterSQL)
+	}
+	return filterSQL
+}
 
-	return results, nil
+// searchRow is a fused search result as scanned from Spanner, before its
+// product data is transformed
+type searchRow struct {
+	productID        string
+	productData      spanner.NullJSON
+	score            float64
+	annRank          spanner.NullInt64
+	annDistance      spanner.NullFloat64
+	ftsRank          spanner.NullInt64
+	ftsScore         spanner.NullFloat64
+	annContribution  float64
+	ftsContribution  float64
+	qualityFactor    float64
+	popularityFactor float64
+}
+
+// searchRows runs a statement built by buildSearchSQL and scans its rows.
+// branches and candidateLimit describe the statement for cost estimates.
+func (s *SpannerService) searchRows(ctx context.Context, txn *spanner.ReadOnlyTransaction, stmt spanner.Statement, branches, candidateLimit int) ([]searchRow, error) {
+	iter := txn.QueryWithOptions(ctx, stmt, searchQueryOptions(ctx))
+	defer iter.Stop()
+
+	var rows []searchRow
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through search results: %w", err)
+		}
+
+		var r searchRow
+		var title string
+		if err := row.Columns(&r.score, &r.productID, &title, &r.productData, &r.annRank, &r.annDistance, &r.ftsRank, &r.ftsScore, &r.annContribution, &r.ftsContribution, &r.qualityFactor, &r.popularityFactor); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %v", err)
+		}
+		rows = append(rows, r)
+	}
+
+	CostRecorderFromContext(ctx).RecordSpannerQuery(branches, candidateLimit, iter.RowCount, iter.QueryStats)
+	return rows, nil
+}
+
+// resultScores collects the per-branch columns of a search row
+func resultScores(productID string, fused float64, annRank spanner.NullInt64, annDistance spanner.NullFloat64, ftsRank spanner.NullInt64, ftsScore spanner.NullFloat64) models.ResultScores {
+	scores := models.ResultScores{ProductID: productID, Fused: fused}
+	if annRank.Valid {
+		scores.ANNRank = &annRank.Int64
+	}
+	if annDistance.Valid {
+		scores.ANNDistance = &annDistance.Float64
+	}
+	if ftsRank.Valid {
+		scores.FTSRank = &ftsRank.Int64
+	}
+	if ftsScore.Valid {
+		scores.FTSScore = &ftsScore.Float64
+	}
+	return scores
+}
+
+// redactStatement describes stmt for debug responses without exposing its
+// parameter values, which carry the query text and filter values
+func redactStatement(stmt spanner.Statement) *models.SQLStatement {
+	params := make(map[string]string, len(stmt.Params))
+	for name, value := range stmt.Params {
+		switch v := value.(type) {
+		case []float32:
+			params[name] = fmt.Sprintf("[%d]float32", len(v))
+		default:
+			params[name] = fmt.Sprintf("%T", v)
+		}
+	}
+	return &models.SQLStatement{SQL: strings.TrimSpace(stmt.SQL), Params: params}
 }
 
 // transformToSearchResult converts product data into a SearchResult
@@ -270,6 +1009,9 @@ func (s *SpannerService) transformToSearchResult(productID string, productData m
 	// Extract title
 	title, _ := productData["title"].(string)
 
+	// Extract description
+	description, _ := productData["description"].(string)
+
 	// Extract brands
 	var brands []string
 	if brandsData, ok := productData["brands"].([]interface{}); ok {
@@ -292,7 +1034,7 @@ func (s *SpannerService) transformToSearchResult(productID string, productData m
 
 	// Handle price info
 	priceInfo := models.PriceInfo{
-		CurrencyCode: "USD", // Default
+		CurrencyCode: s.config.CatalogCurrencyCode,
 	}
 	if priceInfoData, ok := productData["priceInfo"].(map[string]interface{}); ok {
 		if cost, ok := priceInfoData["cost"].(string); ok {
@@ -360,8 +1102,9 @@ func (s *SpannerService) transformToSearchResult(productID string, productData m
 		}
 	}
 
-	// Extract URI
+	// Extract URI and GTIN
 	uri, _ := productData["uri"].(string)
+	gtin, _ := productData["gtin"].(string)
 
 	// Process attributes
 	var attributes []models.Attribute
@@ -427,6 +1170,7 @@ func (s *SpannerService) transformToSearchResult(productID string, productData m
 		ID:                productID,
 		Name:              name,
 		Title:             title,
+		Description:       description,
 		Brands:            brands,
 		Categories:        categories,
 		PriceInfo:         priceInfo,
@@ -436,7 +1180,9 @@ func (s *SpannerService) transformToSearchResult(productID string, productData m
 		RetrievableFields: "*",
 		Attributes:        attributes,
 		URI:               uri,
+		GTIN:              gtin,
 		Score:             scoreMap,
+		Localizations:     productLocalizations(productData),
 	}
 
 	return result, nil
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"testing"
+
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+)
+
+func TestResultCacheKeyFilters(t *testing.T) {
+	registry := filter.NewRegistry(nil)
+	opts := SearchOptions{Query: "shoes", Mode: models.SearchModeHybrid}
+
+	// Each pair binds the same parameters, so only the SQL tells them apart
+	pairs := [][2]string{
+		{"price < 100", "price > 100"},
+		{`availability = "IN_STOCK"`, `availability != "IN_STOCK"`},
+		{`brands: ANY("x")`, `categories: ANY("x")`},
+		{`price < 100 AND availability = "IN_STOCK"`, `price < 100 OR availability = "IN_STOCK"`},
+	}
+	for _, pair := range pairs {
+		var keys [2]string
+		for i, expr := range pair {
+			node, err := filter.Parse(expr, registry)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", expr, err)
+			}
+			filterSQL, params := filter.CompileSQL(node, "filter_")
+			keys[i] = resultCacheKey(opts, "v1", filterSQL, params)
+		}
+		if keys[0] == keys[1] {
+			t.Errorf("filters %q and %q share the cache key %s", pair[0], pair[1], keys[0])
+		}
+	}
+
+	node, err := filter.Parse("price < 100", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterSQL, params := filter.CompileSQL(node, "filter_")
+	same := resultCacheKey(opts, "v1", filterSQL, params)
+	if again := resultCacheKey(opts, "v1", filterSQL, params); again != same {
+		t.Errorf("equal searches keyed %s and %s", same, again)
+	}
+	params["filter_0"] = float64(200)
+	if other := resultCacheKey(opts, "v1", filterSQL, params); other == same {
+		t.Errorf("filters with different values share the cache key %s", other)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+)
+
+// StageSpellCorrection is the time spent looking up spelling corrections
+const StageSpellCorrection = "spell_correction"
+
+// minCorrectableLength is the shortest word the corrector will rewrite;
+// shorter words are too ambiguous to correct by edit distance
+const minCorrectableLength = 4
+
+// SpellCorrector suggests corrections for misspelled query words using a
+// term dictionary built from product titles
+type SpellCorrector struct {
+	config  *config.Config
+	spanner *SpannerService
+
+	mu sync.RWMutex
+	// terms maps each dictionary term to the number of titles containing it
+	terms map[string]int
+	// byLength indexes terms by rune count so lookups only scan terms
+	// within the edit distance budget
+	byLength map[int][]string
+}
+
+// NewSpellCorrector creates a new spell corrector with an empty dictionary
+func NewSpellCorrector(cfg *config.Config, spannerSvc *SpannerService) *SpellCorrector {
+	return &SpellCorrector{
+		config:  cfg,
+		spanner: spannerSvc,
+	}
+}
+
+// Run rebuilds the dictionary at startup and on every refresh interval
+// until ctx is done
+func (s *SpellCorrector) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SpellDictionaryRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("Warning: could not build spelling dictionary: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh rebuilds the dictionary from the current product titles
+func (s *SpellCorrector) Refresh(ctx context.Context) error {
+	titles, err := s.spanner.LoadProductTitles(ctx)
+	if err != nil {
+		return err
+	}
+
+	terms := make(map[string]int)
+	for _, title := range titles {
+		seen := make(map[string]bool)
+		for _, word := range splitWords(title) {
+			if !seen[word] {
+				seen[word] = true
+				terms[word]++
+			}
+		}
+	}
+
+	byLength := make(map[int][]string)
+	for term := range terms {
+		n := len([]rune(term))
+		byLength[n] = append(byLength[n], term)
+	}
+
+	s.mu.Lock()
+	s.terms = terms
+	s.byLength = byLength
+	s.mu.Unlock()
+
+	log.Printf("Built spelling dictionary with %d terms from %d titles", len(terms), len(titles))
+	return nil
+}
+
+// Correct returns the query with misspelled words replaced by their closest
+// dictionary term, or "" when no word needs correcting
+func (s *SpellCorrector) Correct(ctx context.Context, query string) string {
+	defer recordStage(ctx, StageSpellCorrection, time.Now())
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.terms) == 0 {
+		return ""
+	}
+
+	words := splitWords(query)
+	corrected := false
+	for i, word := range words {
+		if suggestion, ok := s.suggest(word); ok {
+			words[i] = suggestion
+			corrected = true
+		}
+	}
+	if !corrected {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// suggest returns the most frequent dictionary term within the edit budget
+// of an unknown word. Callers must hold s.mu.
+func (s *SpellCorrector) suggest(word string) (string, bool) {
+	runes := []rune(word)
+	if len(runes) < minCorrectableLength || s.terms[word] > 0 || hasDigit(word) {
+		return "", false
+	}
+
+	// Allow one edit for short words and two for longer ones
+	budget := 1
+	if len(runes) > 7 {
+		budget = 2
+	}
+
+	best, bestDistance, bestCount := "", budget+1, 0
+	for n := len(runes) - budget; n <= len(runes)+budget; n++ {
+		for _, term := range s.byLength[n] {
+			d := editDistance(runes, []rune(term), budget)
+			if d > budget {
+				continue
+			}
+			if d < bestDistance || (d == bestDistance && s.terms[term] > bestCount) {
+				best, bestDistance, bestCount = term, d, s.terms[term]
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// splitWords lowercases text and splits it into letter and digit runs
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// hasDigit reports whether the word contains a digit; model numbers and
+// sizes are left alone
+func hasDigit(word string) bool {
+	return strings.IndexFunc(word, unicode.IsDigit) >= 0
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b, counting adjacent transpositions as one edit. Rows are abandoned once
+// every cell exceeds limit, in which case limit+1 is returned.
+func editDistance(a, b []rune, limit int) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
+// LoadProductTitles returns the titles of all products
+func (s *SpannerService) LoadProductTitles(ctx context.Context) ([]string, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT title
+              FROM products
+              WHERE title IS NOT NULL`,
+	}
+
+	iter := s.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var titles []string
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through product titles: %w", err)
+		}
+		var title string
+		if err := row.Columns(&title); err != nil {
+			return nil, fmt.Errorf("failed to scan product title: %v", err)
+		}
+		titles = append(titles, title)
+	}
+	return titles, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Stage names recorded during a search
+const (
+	StageEmbedding    = "embedding"
+	StageSpannerQuery = "spanner_query"
+	StageTransform    = "transform"
+)
+
+// StageTimings collects how long each stage of a request took
+type StageTimings struct {
+	mu     sync.Mutex
+	stages map[string]time.Duration
+}
+
+// NewStageTimings creates an empty stage timing recorder
+func NewStageTimings() *StageTimings {
+	return &StageTimings{stages: make(map[string]time.Duration)}
+}
+
+// Record adds the duration to the named stage
+func (t *StageTimings) Record(stage string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stages[stage] += d
+}
+
+// Snapshot returns a copy of the recorded stage durations
+func (t *StageTimings) Snapshot() map[string]time.Duration {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snapshot := make(map[string]time.Duration, len(t.stages))
+	for stage, d := range t.stages {
+		snapshot[stage] = d
+	}
+	return snapshot
+}
+
+type stageTimingsKey struct{}
+
+// ContextWithStageTimings attaches a stage timing recorder to the context
+func ContextWithStageTimings(ctx context.Context, t *StageTimings) context.Context {
+	return context.WithValue(ctx, stageTimingsKey{}, t)
+}
+
+// StageTimingsFromContext returns the recorder attached to the context, or nil
+func StageTimingsFromContext(ctx context.Context) *StageTimings {
+	t, _ := ctx.Value(stageTimingsKey{}).(*StageTimings)
+	return t
+}
+
+// recordStage records the time elapsed since start against the context's recorder
+func recordStage(ctx context.Context, stage string, start time.Time) {
+	StageTimingsFromContext(ctx).Record(stage, time.Since(start))
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/bits"
+	"math/rand"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+)
+
+// tailSampleCheckInterval is how often the sampler checks whether the
+// current week has been sampled yet
+const tailSampleCheckInterval = time.Hour
+
+// tailQueryVolumesSQL counts last week's searches per query from the
+// impressions in search_events. Each session counts once per query;
+// impressions without a session count individually.
+const tailQueryVolumesSQL = `SELECT query, COUNT(DISTINCT IFNULL(session_id, event_id)) AS searches
+		FROM search_events
+		WHERE event_type = 'impression' AND query IS NOT NULL AND occurred_at >= @since
+		GROUP BY query
+		ORDER BY searches DESC`
+
+// TailQuerySampler persists a weekly sample of tail queries with their top
+// results in relevance_samples, for human relevance review. Tail queries
+// are stratified by search volume so evaluation sets cover the rare end of
+// the tail, not only queries just below the head.
+type TailQuerySampler struct {
+	config  *config.Config
+	spanner *SpannerService
+}
+
+// NewTailQuerySampler creates a new tail query sampler
+func NewTailQuerySampler(cfg *config.Config, spannerSvc *SpannerService) *TailQuerySampler {
+	return &TailQuerySampler{
+		config:  cfg,
+		spanner: spannerSvc,
+	}
+}
+
+// Run samples each week once, checking at startup and hourly, until ctx is
+// done. Instances skip weeks another instance already sampled.
+func (t *TailQuerySampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(tailSampleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		week := SampleWeek(time.Now())
+		sampled, err := t.spanner.HasRelevanceSamples(ctx, week)
+		switch {
+		case err != nil:
+			log.Printf("Warning: could not check relevance samples of week %s: %v", week, err)
+		case !sampled:
+			if _, err := t.Sample(ctx, week); err != nil {
+				log.Printf("Warning: could not sample tail queries for week %s: %v", week, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample draws the week's tail queries from the last seven days of search
+// events, searches each one and stores the samples, replacing any of the
+// week's existing samples for the same queries
+func (t *TailQuerySampler) Sample(ctx context.Context, week string) ([]models.RelevanceSample, error) {
+	startTime := time.Now()
+
+	sampled, err := t.sampleQueries(ctx, time.Now().AddDate(0, 0, -7))
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]models.RelevanceSample, 0, len(sampled))
+	mutations := make([]*spanner.Mutation, 0, len(sampled))
+	for _, query := range sampled {
+		opts := defaultSearchOptions(t.config, query.Query)
+		opts.Limit = t.config.TailSampleResults
+		output, err := t.spanner.HybridSearch(ctx, opts)
+		if err != nil {
+			log.Printf("Warning: could not search sampled tail query: %v", err)
+			continue
+		}
+
+		sample := models.RelevanceSample{
+			Week:     week,
+			Query:    query.Query,
+			Stratum:  query.Stratum,
+			Searches: query.Searches,
+			Results:  make([]models.RelevanceSampleResult, len(output.Results)),
+		}
+		for i, result := range output.Results {
+			sample.Results[i] = models.RelevanceSampleResult{ProductID: result.ID, Title: result.Title, Score: result.Score["hybrid"]}
+		}
+		samples = append(samples, sample)
+		mutations = append(mutations, spanner.InsertOrUpdateMap("relevance_samples", map[string]interface{}{
+			"week":       week,
+			"query":      sample.Query,
+			"stratum":    sample.Stratum,
+			"searches":   sample.Searches,
+			"results":    spanner.NullJSON{Value: sample.Results, Valid: true},
+			"sampled_at": spanner.CommitTimestamp,
+		}))
+	}
+
+	if len(mutations) > 0 {
+		if _, err := t.spanner.client.Apply(ctx, mutations); err != nil {
+			return nil, fmt.Errorf("failed to write relevance samples: %w", err)
+		}
+	}
+
+	log.Printf("Sampled %d tail queries for week %s in %s", len(samples), week, time.Since(startTime))
+	return samples, nil
+}
+
+// sampledQuery is a tail query drawn for review
+type sampledQuery struct {
+	Query    string
+	Stratum  string
+	Searches int64
+}
+
+// sampleQueries reservoir-samples up to TailSamplePerStratum queries from
+// each search volume stratum, skipping the TailHeadSize most searched
+// queries. Strata are powers of two: 1 search, 2-3, 4-7 and so on.
+func (t *TailQuerySampler) sampleQueries(ctx context.Context, since time.Time) ([]sampledQuery, error) {
+	stmt := spanner.Statement{
+		SQL:    tailQueryVolumesSQL,
+		Params: map[string]interface{}{"since": since},
+	}
+
+	iter := t.spanner.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	reservoirs := make(map[int][]sampledQuery)
+	seen := make(map[int]int)
+	rank := 0
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through query volumes: %w", err)
+		}
+		rank++
+		if rank <= t.config.TailHeadSize {
+			continue
+		}
+
+		var query sampledQuery
+		if err := row.Columns(&query.Query, &query.Searches); err != nil {
+			return nil, fmt.Errorf("failed to scan query volume: %v", err)
+		}
+		stratum := bits.Len64(uint64(query.Searches)) - 1
+		query.Stratum = stratumName(stratum)
+
+		seen[stratum]++
+		if len(reservoirs[stratum]) < t.config.TailSamplePerStratum {
+			reservoirs[stratum] = append(reservoirs[stratum], query)
+		} else if i := rand.Intn(seen[stratum]); i < t.config.TailSamplePerStratum {
+			reservoirs[stratum][i] = query
+		}
+	}
+
+	var sampled []sampledQuery
+	for _, reservoir := range reservoirs {
+		sampled = append(sampled, reservoir...)
+	}
+	return sampled, nil
+}
+
+// stratumName describes the search volume range of a stratum
+func stratumName(stratum int) string {
+	low, high := int64(1)<<stratum, int64(1)<<(stratum+1)-1
+	if low == high {
+		return fmt.Sprintf("%d", low)
+	}
+	return fmt.Sprintf("%d-%d", low, high)
+}
+
+// SampleWeek returns the ISO week t falls in, such as 2025-W07
+func SampleWeek(t time.Time) string {
+	year, week := t.UTC().ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// HasRelevanceSamples reports whether the week has been sampled
+func (s *SpannerService) HasRelevanceSamples(ctx context.Context, week string) (bool, error) {
+	stmt := spanner.Statement{
+		SQL:    `SELECT 1 FROM relevance_samples WHERE week = @week LIMIT 1`,
+		Params: map[string]interface{}{"week": week},
+	}
+
+	iter := s.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	_, err := iter.Next()
+	if err == iterator.Done {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to query relevance samples: %v", err)
+	}
+	return true, nil
+}
+
+// ListRelevanceSamples returns the week's relevance samples by stratum and
+// query
+func (s *SpannerService) ListRelevanceSamples(ctx context.Context, week string) ([]models.RelevanceSample, error) {
+	stmt := spanner.Statement{
+		SQL: `SELECT week, query, stratum, searches, results, sampled_at
+              FROM relevance_samples
+              WHERE week = @week
+              ORDER BY searches, query`,
+		Params: map[string]interface{}{"week": week},
+	}
+
+	iter := s.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+
+	var samples []models.RelevanceSample
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through relevance samples: %w", err)
+		}
+
+		var sample models.RelevanceSample
+		var results spanner.NullJSON
+		if err := row.Columns(&sample.Week, &sample.Query, &sample.Stratum, &sample.Searches, &results, &sample.SampledAt); err != nil {
+			return nil, fmt.Errorf("failed to scan relevance sample: %v", err)
+		}
+		if err := decodeJSONColumn(results, &sample.Results); err != nil {
+			return nil, fmt.Errorf("failed to decode relevance sample results: %v", err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
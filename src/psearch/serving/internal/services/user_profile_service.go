@@ -0,0 +1,162 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"psearch/serving/internal/cache"
+	"psearch/serving/internal/config"
+)
+
+// ErrClickedProductNotFound is returned when a click names a product that
+// does not exist
+var ErrClickedProductNotFound = errors.New("clicked product not found")
+
+// UserProfileService maintains a preference embedding per user, learned
+// from the products they click, for personalizing vector search
+type UserProfileService struct {
+	config  *config.Config
+	spanner *SpannerService
+	// profiles caches embeddings by user ID. Users without a profile are
+	// cached as nil so cold starts do not read Spanner on every search.
+	profiles *cache.Cache[[]float32]
+}
+
+// NewUserProfileService creates a new user profile service
+func NewUserProfileService(cfg *config.Config, spannerSvc *SpannerService) *UserProfileService {
+	return &UserProfileService{
+		config:   cfg,
+		spanner:  spannerSvc,
+		profiles: cache.New[[]float32]("user_profile", cfg.UserProfileCacheSize, cfg.UserProfileCacheTTL),
+	}
+}
+
+// CacheLayers returns the caches owned by the user profile service
+func (s *UserProfileService) CacheLayers() []cache.Layer {
+	return []cache.Layer{s.profiles}
+}
+
+// Embedding returns the user's preference embedding, or nil when the user
+// has no profile yet
+func (s *UserProfileService) Embedding(ctx context.Context, userID string) ([]float32, error) {
+	if embedding, ok := s.profiles.Get(userID); ok {
+		return embedding, nil
+	}
+
+	row, err := s.spanner.client.Single().ReadRow(ctx, "user_profiles", spanner.Key{userID}, []string{"embedding"})
+	if spanner.ErrCode(err) == codes.NotFound {
+		s.profiles.Set(userID, nil)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user profile: %w", err)
+	}
+
+	var embedding []float32
+	if err := row.Columns(&embedding); err != nil {
+		return nil, fmt.Errorf("failed to scan user profile: %v", err)
+	}
+	s.profiles.Set(userID, embedding)
+	return embedding, nil
+}
+
+// RecordClick moves the user's embedding toward the clicked product's by
+// USER_PROFILE_LEARNING_RATE, so recent interests outweigh old ones. A
+// user's first click starts their profile at the product's embedding.
+// Clicks on products without an embedding are ignored.
+func (s *UserProfileService) RecordClick(ctx context.Context, userID, productID string) error {
+	_, err := s.spanner.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		row, err := txn.ReadRow(ctx, "products", spanner.Key{productID}, []string{"embedding"})
+		if spanner.ErrCode(err) == codes.NotFound {
+			return ErrClickedProductNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read clicked product: %w", err)
+		}
+		var product []float32
+		if err := row.Columns(&product); err != nil {
+			return fmt.Errorf("failed to scan clicked product: %v", err)
+		}
+		if len(product) == 0 {
+			return nil
+		}
+
+		embedding := normalizeEmbedding(product)
+		var clicks int64
+		row, err = txn.ReadRow(ctx, "user_profiles", spanner.Key{userID}, []string{"embedding", "clicks"})
+		switch {
+		case err == nil:
+			var current []float32
+			if err := row.Columns(&current, &clicks); err != nil {
+				return fmt.Errorf("failed to scan user profile: %v", err)
+			}
+			if len(current) == len(product) {
+				embedding = blendEmbeddings(current, product, s.config.UserProfileLearningRate)
+			}
+		case spanner.ErrCode(err) != codes.NotFound:
+			return fmt.Errorf("failed to read user profile: %w", err)
+		}
+
+		return txn.BufferWrite([]*spanner.Mutation{spanner.InsertOrUpdateMap("user_profiles", map[string]interface{}{
+			"user_id":    userID,
+			"embedding":  embedding,
+			"clicks":     clicks + 1,
+			"updated_at": spanner.CommitTimestamp,
+		})})
+	})
+	if err != nil {
+		return err
+	}
+	s.profiles.Delete(userID)
+	return nil
+}
+
+// blendEmbeddings returns the unit-length weighted average of the unit
+// vectors of a and b, giving b the given weight. Both must have the same
+// dimension.
+func blendEmbeddings(a, b []float32, weight float64) []float32 {
+	a, b = normalizeEmbedding(a), normalizeEmbedding(b)
+	blended := make([]float32, len(a))
+	for i := range a {
+		blended[i] = float32((1-weight)*float64(a[i]) + weight*float64(b[i]))
+	}
+	return normalizeEmbedding(blended)
+}
+
+// normalizeEmbedding scales v to unit length. The zero vector is returned
+// as is.
+func normalizeEmbedding(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := math.Sqrt(sum)
+	normalized := make([]float32, len(v))
+	for i, x := range v {
+		normalized[i] = float32(float64(x) / norm)
+	}
+	return normalized
+}
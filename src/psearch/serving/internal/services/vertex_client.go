@@ -0,0 +1,137 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"psearch/serving/internal/config"
+)
+
+const (
+	// tokenRefreshLead is how long before expiry tokens are refreshed in
+	// the background. Credential token sources hand out their cached token
+	// until 10 seconds before it expires, so refreshing any earlier would
+	// only return the same token.
+	tokenRefreshLead = 9 * time.Second
+	// tokenMinLifetime is the least lifetime a cached token may have left
+	// to still be sent; older ones are refreshed before the request
+	tokenMinLifetime = 2 * time.Second
+)
+
+// vertexModelURL returns the URL of a method of a Vertex AI publisher
+// model, on VERTEX_ENDPOINT if set
+func vertexModelURL(cfg *config.Config, model, method string) string {
+	host := cmp.Or(cfg.VertexEndpoint, cfg.Region+"-aiplatform.googleapis.com")
+	return fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s:%s",
+		host, cfg.ProjectID, cfg.Region, model, method)
+}
+
+// newModelHTTPClient returns an HTTP client for calling embedding models,
+// authorized by tokens unless it is nil. Unlike http.DefaultTransport, it
+// keeps enough idle connections per host for concurrent searches to reuse
+// them instead of each paying for a TLS handshake.
+func newModelHTTPClient(tokens oauth2.TokenSource) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 64,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+	}
+	if tokens == nil {
+		return &http.Client{Transport: transport}
+	}
+	return &http.Client{Transport: &oauth2.Transport{Source: tokens, Base: transport}}
+}
+
+// tokenPrefetcher caches an access token and refreshes it in the
+// background shortly before it expires, so requests do not stall on the
+// metadata server or token endpoint while the token is renewed. Requests
+// only wait for a token at startup, or when background refreshes failed
+// until the cached token expired.
+type tokenPrefetcher struct {
+	source oauth2.TokenSource
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// newTokenPrefetcher fetches tokens from source until ctx is done
+func newTokenPrefetcher(ctx context.Context, source oauth2.TokenSource) *tokenPrefetcher {
+	p := &tokenPrefetcher{source: source}
+	go p.run(ctx)
+	return p
+}
+
+// Token returns the cached token, or fetches one if it is missing or about
+// to expire
+func (p *tokenPrefetcher) Token() (*oauth2.Token, error) {
+	p.mu.Lock()
+	token := p.token
+	p.mu.Unlock()
+	if token != nil && (token.Expiry.IsZero() || time.Until(token.Expiry) > tokenMinLifetime) {
+		return token, nil
+	}
+	return p.refresh()
+}
+
+// refresh fetches a token from the source and caches it
+func (p *tokenPrefetcher) refresh() (*oauth2.Token, error) {
+	token, err := p.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.token = token
+	p.mu.Unlock()
+	return token, nil
+}
+
+// run fetches the first token and then refreshes it as it nears expiry.
+// Failed refreshes are retried every second while the cached token lasts.
+func (p *tokenPrefetcher) run(ctx context.Context) {
+	for {
+		wait := time.Second
+		if token, err := p.refresh(); err != nil {
+			log.Printf("Failed to refresh access token: %v", err)
+		} else if !token.Expiry.IsZero() {
+			wait = max(time.Until(token.Expiry)-tokenRefreshLead, time.Second)
+		} else {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
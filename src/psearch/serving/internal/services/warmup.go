@@ -0,0 +1,78 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// errWarmingUp is reported by the readiness check until the warm-up has
+// finished
+var errWarmingUp = errors.New("warming up")
+
+// WarmupStep is one step of the startup warm-up
+type WarmupStep struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Warmup runs the startup warm-up and holds the instance out of rotation
+// until it has finished, so cold instances do not serve their first
+// searches while opening sessions, fetching tokens and dialing backends
+type Warmup struct {
+	steps   []WarmupStep
+	timeout time.Duration
+	done    chan struct{}
+}
+
+// NewWarmup creates a warm-up running steps in order, all within timeout
+func NewWarmup(timeout time.Duration, steps ...WarmupStep) *Warmup {
+	return &Warmup{steps: steps, timeout: timeout, done: make(chan struct{})}
+}
+
+// Run runs the warm-up steps. Failed steps are logged and the remaining
+// steps still run: once the warm-up has finished, readiness only depends
+// on the dependency checks.
+func (w *Warmup) Run(ctx context.Context) {
+	defer close(w.done)
+	ctx, cancel := withBudget(ctx, w.timeout)
+	defer cancel()
+
+	start := time.Now()
+	for _, step := range w.steps {
+		stepStart := time.Now()
+		if err := step.Run(ctx); err != nil {
+			log.Printf("Warning: warm-up step %s failed after %s: %v", step.Name, time.Since(stepStart), err)
+			continue
+		}
+		log.Printf("Warm-up step %s completed in %s", step.Name, time.Since(stepStart))
+	}
+	log.Printf("Warm-up completed in %s", time.Since(start))
+}
+
+// Check is a readiness check that fails until Run has finished
+func (w *Warmup) Check(ctx context.Context) error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+		return errWarmingUp
+	}
+}
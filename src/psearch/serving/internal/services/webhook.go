@@ -0,0 +1,119 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errWebhookAddress is returned when a webhook resolves to an address the
+// service must not call, so saved searches cannot reach internal endpoints
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// reservedPrefixes are non-public ranges netip has no predicate for:
+// "this network", carrier-grade NAT, IETF protocol assignments, benchmarking
+// and NAT64, which can embed a private IPv4 address
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// ValidateWebhookURL checks that rawURL is an https URL the service may
+// deliver to: one of allowedHosts when any are configured, and not a
+// loopback, private, link-local or metadata host. Names are resolved when
+// dialing, where webhookClient checks the addresses they resolve to.
+func ValidateWebhookURL(rawURL string, allowedHosts []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("webhook_url is not a valid URL: %v", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.New("webhook_url must be an https URL")
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if len(allowedHosts) > 0 && !slices.ContainsFunc(allowedHosts, func(allowed string) bool { return strings.EqualFold(allowed, host) }) {
+		return fmt.Errorf("webhook_url host %q is not allowed", host)
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || host == "metadata.google.internal" {
+		return fmt.Errorf("webhook_url host %q is not allowed", host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return fmt.Errorf("webhook_url host %q is not allowed", host)
+	}
+	return nil
+}
+
+// publicAddr reports whether addr is a globally routable unicast address
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookClient returns the client saved search webhooks are delivered
+// with. It refuses to connect to non-public addresses whatever the URL's
+// host resolves to, ignores proxy settings that would bypass that check,
+// and validates redirect targets like the webhook itself.
+func webhookClient(allowedHosts []string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", errWebhookAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 webhook redirects")
+			}
+			return ValidateWebhookURL(req.URL.String(), allowedHosts)
+		},
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowedHosts []string
+		wantErr      bool
+	}{
+		{url: "https://hooks.example.com/saved-search"},
+		{url: "http://hooks.example.com/saved-search", wantErr: true},
+		{url: "ftp://hooks.example.com", wantErr: true},
+		{url: "https://localhost/hook", wantErr: true},
+		{url: "https://api.localhost./hook", wantErr: true},
+		{url: "https://metadata.google.internal/computeMetadata/v1/", wantErr: true},
+		{url: "https://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "https://127.0.0.1:8443/hook", wantErr: true},
+		{url: "https://10.1.2.3/hook", wantErr: true},
+		{url: "https://172.16.0.1/hook", wantErr: true},
+		{url: "https://192.168.1.1/hook", wantErr: true},
+		{url: "https://100.64.0.1/hook", wantErr: true},
+		{url: "https://[::1]/hook", wantErr: true},
+		{url: "https://[fd00::1]/hook", wantErr: true},
+		{url: "https://[::ffff:10.0.0.1]/hook", wantErr: true},
+		{url: "https://8.8.8.8/hook"},
+		{url: "https://hooks.example.com/hook", allowedHosts: []string{"Hooks.Example.com"}},
+		{url: "https://evil.example.com/hook", allowedHosts: []string{"hooks.example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := ValidateWebhookURL(tt.url, tt.allowedHosts)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateWebhookURL(%q, %v) = %v, want error %v", tt.url, tt.allowedHosts, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	var called bool
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = webhookClient(nil).Do(req)
+	if !errors.Is(err, errWebhookAddress) {
+		t.Errorf("Do(%s) error = %v, want %v", server.URL, err, errWebhookAddress)
+	}
+	if called {
+		t.Error("webhook client connected to a loopback server")
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"psearch/serving/internal/config"
+)
+
+// ServiceName identifies this service in exported traces
+const ServiceName = "psearch-serving"
+
+// InitTracing configures the global OpenTelemetry tracer provider to export
+// spans to Cloud Trace. It returns a shutdown function that flushes pending
+// spans; when tracing is disabled the shutdown function is a no-op.
+func InitTracing(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	// Always propagate W3C trace context so upstream traces are continued
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !cfg.TracingEnabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := texporter.New(texporter.WithProjectID(cfg.ProjectID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud Trace exporter: %v", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(ServiceName),
+			semconv.DeploymentEnvironment(cfg.Environment),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TraceSampleRate))),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Printf("Tracing enabled, exporting to Cloud Trace with sample rate %.2f", cfg.TraceSampleRate)
+
+	return provider.Shutdown, nil
+}
+
+// HashQuery returns a short stable hash of the query text so spans can be
+// correlated by query without recording the raw (possibly personal) text
+func HashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:8])
+}
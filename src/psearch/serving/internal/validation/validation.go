@@ -0,0 +1,159 @@
+/*
+ * Copyright 2025 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package validation enforces the request caps that keep a single request
+// from asking Spanner for unbounded work: the number of results, how deep
+// they page, the query length and the number of filter conditions. It works on the request
+// models, so every API surface shares the same checks and error payload.
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+)
+
+// Violation is a request field outside its bounds
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error lists every bound a request violates
+type Error struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validator checks requests against the configured caps
+type Validator struct {
+	settings func() *config.Config
+	filters  *filter.Registry
+}
+
+// New creates a validator enforcing the caps in the configuration settings
+// returns, which is consulted on every request so caps overridden at
+// runtime apply immediately. Filters are parsed against registry to count
+// their conditions.
+func New(settings func() *config.Config, registry *filter.Registry) *Validator {
+	return &Validator{
+		settings: settings,
+		filters:  registry,
+	}
+}
+
+// Search checks a search request. It returns an *Error listing every
+// violation, or nil.
+func (v *Validator) Search(req *models.SearchRequest) error {
+	var c checker
+	c.limit(v, req.Limit)
+	c.offset(v, req.Offset)
+	c.query(v, "query", req.Query)
+	conditions := v.conditions(req.Filter) + len(req.Ranges)
+	if req.MinPrice != nil || req.MaxPrice != nil {
+		conditions++
+	}
+	c.conditions(v, conditions)
+	return c.err()
+}
+
+// Browse checks a category browse request
+func (v *Validator) Browse(req *models.BrowseRequest) error {
+	var c checker
+	c.limit(v, req.Limit)
+	c.offset(v, req.Offset)
+	c.conditions(v, v.conditions(req.Filter))
+	return c.err()
+}
+
+// SimilarProducts checks a similar products request
+func (v *Validator) SimilarProducts(req *models.SimilarProductsRequest) error {
+	var c checker
+	c.limit(v, req.Limit)
+	c.conditions(v, v.conditions(req.Filter))
+	return c.err()
+}
+
+// ImageSearch checks an image search request
+func (v *Validator) ImageSearch(req *models.ImageSearchRequest) error {
+	var c checker
+	c.limit(v, req.Limit)
+	c.conditions(v, v.conditions(req.Filter))
+	return c.err()
+}
+
+// conditions counts the conditions of a filter expression. Filters that do
+// not parse count as none: their syntax errors are reported by the handler
+// that parses them for the search.
+func (v *Validator) conditions(expr string) int {
+	node, err := filter.Parse(expr, v.filters)
+	if err != nil {
+		return 0
+	}
+	return filter.Conditions(node)
+}
+
+// checker accumulates the violations of one request
+type checker struct {
+	violations []Violation
+}
+
+func (c *checker) add(field, format string, args ...interface{}) {
+	c.violations = append(c.violations, Violation{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) limit(v *Validator, limit *int) {
+	if maxLimit := v.settings().MaxResultLimit; limit != nil && (*limit < 1 || *limit > maxLimit) {
+		c.add("limit", "limit must be between 1 and %d, got %d", maxLimit, *limit)
+	}
+}
+
+func (c *checker) offset(v *Validator, offset *int) {
+	if maxOffset := v.settings().MaxResultOffset; offset != nil && (*offset < 0 || *offset > maxOffset) {
+		c.add("offset", "offset must be between 0 and %d, got %d", maxOffset, *offset)
+	}
+}
+
+func (c *checker) query(v *Validator, field, query string) {
+	maxLength := v.settings().MaxQueryLength
+	if n := utf8.RuneCountInString(query); n > maxLength {
+		c.add(field, "%s must be at most %d characters, got %d", field, maxLength, n)
+	}
+}
+
+func (c *checker) conditions(v *Validator, n int) {
+	if maxConditions := v.settings().MaxFilterConditions; n > maxConditions {
+		c.add("filter", "filter must have at most %d conditions, got %d", maxConditions, n)
+	}
+}
+
+func (c *checker) err() error {
+	if len(c.violations) == 0 {
+		return nil
+	}
+	return &Error{Violations: c.violations}
+}
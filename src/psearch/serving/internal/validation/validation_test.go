@@ -0,0 +1,75 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestSearchPaging(t *testing.T) {
+	cfg := &config.Config{MaxResultLimit: 500, MaxResultOffset: 1000, MaxQueryLength: 1024, MaxFilterConditions: 20}
+	v := New(func() *config.Config { return cfg }, filter.NewRegistry(nil))
+
+	tests := []struct {
+		name   string
+		limit  *int
+		offset *int
+		fields []string
+	}{
+		{name: "unset"},
+		{name: "bounds", limit: intPtr(500), offset: intPtr(1000)},
+		{name: "smallest", limit: intPtr(1), offset: intPtr(0)},
+		{name: "zero limit", limit: intPtr(0), fields: []string{"limit"}},
+		{name: "negative limit", limit: intPtr(-1), fields: []string{"limit"}},
+		{name: "limit over cap", limit: intPtr(501), fields: []string{"limit"}},
+		{name: "negative offset", offset: intPtr(-1), fields: []string{"offset"}},
+		{name: "offset over cap", offset: intPtr(1001), fields: []string{"offset"}},
+		{name: "both", limit: intPtr(-1), offset: intPtr(5000), fields: []string{"limit", "offset"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Search(&models.SearchRequest{Query: "shoes", Limit: tt.limit, Offset: tt.offset})
+			var verr *Error
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("Search() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.As(err, &verr) {
+				t.Fatalf("Search() = %v, want *Error", err)
+			}
+			if len(verr.Violations) != len(tt.fields) {
+				t.Fatalf("violations = %+v, want fields %v", verr.Violations, tt.fields)
+			}
+			for i, field := range tt.fields {
+				if verr.Violations[i].Field != field {
+					t.Errorf("violations[%d].Field = %q, want %q", i, verr.Violations[i].Field, field)
+				}
+			}
+		})
+	}
+}
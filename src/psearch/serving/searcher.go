@@ -0,0 +1,246 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package serving exposes product retrieval as a library, so Go services
+// can search the catalog in-process instead of calling the HTTP API:
+//
+//	import serving "psearch/serving"
+//
+//	cfg, err := serving.LoadConfig()
+//	...
+//	searcher, err := serving.NewSearcher(ctx, cfg)
+//	...
+//	defer searcher.Close()
+//	response, err := searcher.Search(ctx, &serving.SearchRequest{Query: "running shoes"})
+//
+// The library runs hybrid retrieval directly against Spanner. Spelling
+// correction, query understanding, reranking, merchandising and caching are
+// part of the HTTP API, which cmd/server serves.
+package serving
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/filter"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services"
+	"psearch/serving/internal/validation"
+)
+
+// Config holds the search configuration; see LoadConfig
+type Config = config.Config
+
+// Search request and response types, shared with the HTTP API
+type (
+	SearchRequest  = models.SearchRequest
+	SearchResponse = models.SearchResponse
+	SearchResult   = models.SearchResult
+	SearchMode     = models.SearchMode
+)
+
+// Search modes
+const (
+	SearchModeHybrid  = models.SearchModeHybrid
+	SearchModeVector  = models.SearchModeVector
+	SearchModeKeyword = models.SearchModeKeyword
+)
+
+// LoadConfig reads the configuration from the environment, exactly as the
+// server does
+func LoadConfig() (*Config, error) {
+	return config.Load()
+}
+
+// validate checks the "binding" struct tags on request models, as the HTTP
+// API does
+var validate = func() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	return v
+}()
+
+// Searcher retrieves products from the catalog in-process. It is safe for
+// concurrent use.
+type Searcher struct {
+	cfg       *Config
+	searcher  services.Searcher
+	products  services.ProductStore
+	filters   *filter.Registry
+	validator *validation.Validator
+	close     func()
+}
+
+// NewSearcher connects to Spanner and Vertex AI. Call Close when done.
+func NewSearcher(ctx context.Context, cfg *Config) (*Searcher, error) {
+	embeddings, err := services.NewEmbeddingService(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	spannerSvc, err := services.NewSpannerService(ctx, cfg, embeddings)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.RegisterEmbeddingVersions(ctx, cfg, spannerSvc); err != nil {
+		spannerSvc.Close()
+		return nil, err
+	}
+	return newSearcher(cfg, spannerSvc, spannerSvc, spannerSvc.Close), nil
+}
+
+// newSearcher creates a searcher over any retrieval backend, such as the
+// in-memory servicestest.Store in tests
+func newSearcher(cfg *Config, searcher services.Searcher, products services.ProductStore, close func()) *Searcher {
+	filters := filter.NewRegistry(cfg.FilterableAttributes)
+	return &Searcher{
+		cfg:       cfg,
+		searcher:  searcher,
+		products:  products,
+		filters:   filters,
+		validator: validation.New(func() *config.Config { return cfg }, filters),
+		close:     close,
+	}
+}
+
+// Search runs a single search with the request's query, mode, filter,
+// paging, min_score, alpha and catalog_id. Fields that drive the HTTP
+// API's pipeline, such as rerank and boosts, are ignored. Errors for
+// invalid requests satisfy IsInvalidRequest; other errors are backend
+// failures.
+func (s *Searcher) Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	opts, err := s.searchOptions(req)
+	if err != nil {
+		return nil, &invalidRequestError{err: err}
+	}
+
+	output, err := s.searcher.HybridSearch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	results := output.Results
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+	return &SearchResponse{
+		Results:    results,
+		TotalFound: len(results),
+		Fallback:   output.Fallback,
+	}, nil
+}
+
+// searchOptions validates req and fills in the configured defaults
+func (s *Searcher) searchOptions(req *SearchRequest) (services.SearchOptions, error) {
+	if err := validate.Struct(req); err != nil {
+		return services.SearchOptions{}, err
+	}
+	if err := s.validator.Search(req); err != nil {
+		return services.SearchOptions{}, err
+	}
+
+	opts := services.SearchOptions{
+		Query:     req.Query,
+		Limit:     s.cfg.DefaultLimit,
+		MinScore:  s.cfg.MinScoreValue,
+		Alpha:     s.cfg.DefaultAlpha,
+		Mode:      req.Mode,
+		Staleness: s.cfg.SpannerStaleness,
+	}
+	if req.Limit != nil {
+		opts.Limit = *req.Limit
+	}
+	if req.Offset != nil {
+		opts.Offset = *req.Offset
+	}
+	if req.MinScore != nil {
+		opts.MinScore = *req.MinScore
+	}
+	if req.Alpha != nil {
+		opts.Alpha = *req.Alpha
+	}
+	if opts.Alpha < 0 || opts.Alpha > 1 {
+		return services.SearchOptions{}, errors.New("alpha must be between 0.0 and 1.0")
+	}
+	if opts.Mode == "" {
+		opts.Mode = models.SearchModeHybrid
+	}
+
+	var err error
+	if opts.CatalogID, err = s.cfg.ResolveCatalog(req.CatalogID); err != nil {
+		return services.SearchOptions{}, err
+	}
+	if opts.Filter, err = filter.Parse(req.Filter, s.filters); err != nil {
+		return services.SearchOptions{}, err
+	}
+	return opts, nil
+}
+
+// GetProducts returns the products of a catalog with the given IDs, in the
+// order requested. Missing products are left out.
+func (s *Searcher) GetProducts(ctx context.Context, catalogID string, productIDs []string) ([]SearchResult, error) {
+	catalogID, err := s.cfg.ResolveCatalog(catalogID)
+	if err != nil {
+		return nil, &invalidRequestError{err: err}
+	}
+
+	found, err := s.products.GetProductsBatch(ctx, catalogID, productIDs, s.cfg.SpannerStaleness)
+	if err != nil {
+		return nil, err
+	}
+	products := make([]SearchResult, 0, len(found))
+	for _, id := range productIDs {
+		data, ok := found[id]
+		if !ok {
+			continue
+		}
+		product, err := s.products.TransformProduct(id, data)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+// Close releases the Spanner client. It must only be called once in-flight
+// searches have finished.
+func (s *Searcher) Close() {
+	if s.close != nil {
+		s.close()
+	}
+}
+
+// invalidRequestError marks errors caused by the request rather than the
+// backend
+type invalidRequestError struct {
+	err error
+}
+
+func (e *invalidRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidRequestError) Unwrap() error {
+	return e.err
+}
+
+// IsInvalidRequest reports whether err was caused by an invalid request
+// rather than a backend failure
+func IsInvalidRequest(err error) bool {
+	var invalid *invalidRequestError
+	return errors.As(err, &invalid)
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2025 Google LLC
+ * 
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * 
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ * 
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package serving
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"psearch/serving/internal/config"
+	"psearch/serving/internal/models"
+	"psearch/serving/internal/services/servicestest"
+)
+
+func newTestSearcher(store *servicestest.Store) *Searcher {
+	cfg := &config.Config{
+		DefaultLimit:        10,
+		DefaultAlpha:        0.5,
+		MaxResultLimit:      100,
+		MaxResultOffset:     1000,
+		MaxQueryLength:      1024,
+		MaxFilterConditions: 20,
+		CatalogIDs:          []string{"us", "eu"},
+		DefaultCatalogID:    "us",
+	}
+	return newSearcher(cfg, store, store, nil)
+}
+
+func TestSearcherSearch(t *testing.T) {
+	store := servicestest.NewStore()
+	store.Add("us", models.SearchResult{ID: "p1", Name: "trail running shoes"}, models.SearchResult{ID: "p2", Name: "rain jacket"})
+	store.Add("eu", models.SearchResult{ID: "p3", Name: "running shoes"})
+	searcher := newTestSearcher(store)
+
+	response, err := searcher.Search(context.Background(), &SearchRequest{Query: "running shoes"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(response.Results) != 1 || response.Results[0].ID != "p1" {
+		t.Errorf("Search() results = %+v, want only p1 from the default catalog", response.Results)
+	}
+
+	searches := store.Searches()
+	if len(searches) != 1 {
+		t.Fatalf("HybridSearch called %d times, want 1", len(searches))
+	}
+	if opts := searches[0]; opts.Limit != 10 || opts.Alpha != 0.5 || opts.Mode != SearchModeHybrid || opts.CatalogID != "us" {
+		t.Errorf("HybridSearch options = %+v, want the configured defaults in catalog us", opts)
+	}
+}
+
+func TestSearcherInvalidRequests(t *testing.T) {
+	searcher := newTestSearcher(servicestest.NewStore())
+	limit := 0
+	alpha := 2.0
+
+	tests := []struct {
+		name string
+		req  *SearchRequest
+	}{
+		{name: "missing query", req: &SearchRequest{}},
+		{name: "limit below 1", req: &SearchRequest{Query: "shoes", Limit: &limit}},
+		{name: "alpha out of range", req: &SearchRequest{Query: "shoes", Alpha: &alpha}},
+		{name: "unknown catalog", req: &SearchRequest{Query: "shoes", CatalogID: "jp"}},
+		{name: "bad filter", req: &SearchRequest{Query: "shoes", Filter: "price <"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := searcher.Search(context.Background(), tt.req)
+			if !IsInvalidRequest(err) {
+				t.Errorf("Search() error = %v, want an invalid request error", err)
+			}
+		})
+	}
+}
+
+func TestSearcherBackendError(t *testing.T) {
+	store := servicestest.NewStore()
+	store.Err = errors.New("spanner unavailable")
+	_, err := newTestSearcher(store).Search(context.Background(), &SearchRequest{Query: "shoes"})
+	if err == nil || IsInvalidRequest(err) {
+		t.Errorf("Search() error = %v, want a backend error", err)
+	}
+}
+
+func TestSearcherGetProducts(t *testing.T) {
+	store := servicestest.NewStore()
+	store.Add("us", models.SearchResult{ID: "p1", Name: "shoes"}, models.SearchResult{ID: "p2", Name: "jacket"})
+	store.Add("eu", models.SearchResult{ID: "p3", Name: "socks"})
+
+	products, err := newTestSearcher(store).GetProducts(context.Background(), "", []string{"p2", "p3", "missing", "p1"})
+	if err != nil {
+		t.Fatalf("GetProducts() error = %v", err)
+	}
+	var ids []string
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	if len(ids) != 2 || ids[0] != "p2" || ids[1] != "p1" {
+		t.Errorf("GetProducts() IDs = %v, want [p2 p1]", ids)
+	}
+}